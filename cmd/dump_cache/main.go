@@ -6,8 +6,11 @@ package main
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"text/tabwriter"
+	"time"
 
 	log "github.com/sirupsen/logrus"
 	flag "github.com/spf13/pflag"
@@ -15,21 +18,93 @@ import (
 	"git.mills.io/yarnsocial/yarn"
 	"git.mills.io/yarnsocial/yarn/internal"
 	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
 )
 
 var (
-	debug   bool
-	version bool
+	debug    bool
+	version  bool
+	noBackup bool
 )
 
 func init() {
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <cache> [<command> [<args>]]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, `
+Inspect and modify the on-disk feed cache of a pod. The pod MUST be stopped
+before modifying its cache as the cache is overwritten when the pod stops.
+
+Commands:
+  dump [<url>]         dump the whole cache or a single feed as JSON (default)
+  list                 list cached feeds with their twt counts and last modified
+  delete <url>         delete a feed from the cache
+  rekey <from> <to>    move a cached feed to a new url (e.g: domain migrations)
+  compact              remove empty feeds and rewrite the cache
+
+Options:
+`)
 		flag.PrintDefaults()
 	}
 
 	flag.BoolVarP(&debug, "debug", "D", false, "enable debug logging")
 	flag.BoolVarP(&version, "version", "v", false, "display version information")
+	flag.BoolVar(&noBackup, "no-backup", false, "do not backup the cache before modifying it")
+}
+
+func backup(fn string) error {
+	src, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(fn+".bak", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+	return dst.Close()
+}
+
+func dump(cache *internal.Cache, args []string) error {
+	var v interface{} = cache
+	if len(args) > 0 {
+		cached, ok := cache.Feeds.Get(args[0])
+		if !ok {
+			return internal.ErrFeedNotCached
+		}
+		v = cached
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	fmt.Println(string(data))
+	return nil
+}
+
+func list(cache *internal.Cache) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "URL\tTWTS\tLAST FETCHED\tLAST MODIFIED\tERRORS")
+	for _, url := range cache.Feeds.URLs() {
+		cached, _ := cache.Feeds.Get(url)
+		twts := fmt.Sprint(len(cached.GetTwts()))
+		if cached.Evicted {
+			twts = "evicted"
+		}
+		fmt.Fprintf(
+			w, "%s\t%s\t%s\t%s\t%d\n",
+			url, twts, cached.GetLastFetched().Format(time.RFC3339),
+			cached.GetLastModified(), cached.Errors,
+		)
+	}
+	w.Flush()
 }
 
 func main() {
@@ -60,18 +135,68 @@ func main() {
 		os.Exit(1)
 	}
 
+	command, args := "dump", []string{}
+	if flag.NArg() > 1 {
+		command, args = flag.Arg(1), flag.Args()[2:]
+	}
+
 	conf := internal.NewConfig()
-	cache, err := internal.LoadCacheFromFile(conf, fn)
+	cache, err := internal.ReadCacheFile(conf, fn)
 	if err != nil {
 		log.WithError(err).Errorf("error loading cache: %s", fn)
 		os.Exit(2)
 	}
 
-	data, err := json.Marshal(cache)
-	if err != nil {
-		log.WithError(err).Error("error dumping cache")
-		os.Exit(3)
+	switch command {
+	case "dump":
+		if err := dump(cache, args); err != nil {
+			log.WithError(err).Error("error dumping cache")
+			os.Exit(3)
+		}
+		return
+	case "list", "ls":
+		list(cache)
+		return
+	case "delete", "rm":
+		if len(args) != 1 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if !cache.IsCached(args[0]) {
+			log.WithError(internal.ErrFeedNotCached).Errorf("error deleting %s", args[0])
+			os.Exit(3)
+		}
+		cache.DeleteFeeds(types.FetchFeedRequests{types.FetchFeedRequest{URL: args[0]}: true})
+		log.Infof("deleted feed %s", args[0])
+	case "rekey", "mv":
+		if len(args) != 2 {
+			flag.Usage()
+			os.Exit(1)
+		}
+		if err := cache.RekeyFeed(args[0], args[1]); err != nil {
+			log.WithError(err).Errorf("error re-keying %s to %s", args[0], args[1])
+			os.Exit(3)
+		}
+		log.Infof("moved feed %s to %s", args[0], args[1])
+	case "compact":
+		log.Infof("removed %d empty feeds", cache.Compact())
+	default:
+		log.Errorf("unknown command %s", command)
+		flag.Usage()
+		os.Exit(1)
 	}
 
-	fmt.Println(string(data))
+	if !noBackup {
+		if err := backup(fn); err != nil {
+			log.WithError(err).Errorf("error backing up cache %s", fn)
+			os.Exit(4)
+		}
+		log.Infof("backed up cache to %s.bak", fn)
+	}
+
+	if err := cache.WriteFile(fn); err != nil {
+		log.WithError(err).Errorf("error writing cache %s", fn)
+		os.Exit(4)
+	}
+	log.Infof("wrote cache %s (%d feeds)", fn, cache.FeedCount())
 }
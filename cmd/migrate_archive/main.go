@@ -0,0 +1,77 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+	"go.yarn.social/types"
+
+	"git.mills.io/yarnsocial/yarn"
+	"git.mills.io/yarnsocial/yarn/internal"
+)
+
+var (
+	debug         bool
+	version       bool
+	twtHashLength int
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <archive>\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.BoolVarP(&debug, "debug", "D", false, "enable debug logging")
+	flag.BoolVarP(&version, "version", "v", false, "display version information")
+	flag.IntVarP(
+		&twtHashLength, "twt-hash-length", "l", internal.DefaultTwtHashLength,
+		"twt hash length to migrate the archive to",
+	)
+}
+
+func main() {
+	flag.Parse()
+
+	if version {
+		fmt.Printf("%s %s", filepath.Base(os.Args[0]), yarn.FullVersion())
+		os.Exit(0)
+	}
+
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	p := flag.Arg(0)
+	if !internal.FileExists(p) {
+		log.Errorf("archive not found %s", p)
+		os.Exit(1)
+	}
+
+	if !internal.IsValidTwtHashLength(twtHashLength) {
+		log.Errorf("invalid twt hash length %d", twtHashLength)
+		os.Exit(1)
+	}
+	types.TwtHashLength = twtHashLength
+
+	moved, err := internal.MigrateArchive(p)
+	if err != nil {
+		log.WithError(err).Errorf("error migrating archive: %s", p)
+		os.Exit(2)
+	}
+
+	log.Infof("migrated %d twts to %d character hashes", moved, twtHashLength)
+}
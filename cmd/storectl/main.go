@@ -0,0 +1,273 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+
+	"git.mills.io/yarnsocial/yarn"
+	"git.mills.io/yarnsocial/yarn/internal"
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+var (
+	debug   bool
+	version bool
+
+	store     string
+	fsckFix   bool
+	editorCmd string
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <command> [<kind> [<name>]]\n", os.Args[0])
+		fmt.Fprintf(os.Stderr, `
+Inspect and repair the users, feeds and sessions of a pod's store. The pod
+MUST be stopped as the store can only be opened by a single process.
+
+Kinds: users, feeds, peers, sessions
+
+Commands:
+  list <kind>             list the names of all records of kind
+  export <kind> [<name>]  export a record (or all records of kind) as JSON
+  edit <kind> <name>      edit a record as JSON in $EDITOR
+  import <kind> <name>    replace a record with JSON read from stdin
+  delete <kind> <name>    delete a record
+  fsck                    check all records can be decoded
+
+Options:
+`)
+		flag.PrintDefaults()
+	}
+
+	flag.BoolVarP(&debug, "debug", "D", false, "enable debug logging")
+	flag.BoolVarP(&version, "version", "v", false, "display version information")
+
+	flag.StringVarP(&store, "store", "s", internal.DefaultStore, "store to use")
+	flag.BoolVar(&fsckFix, "fix", false, "delete undecodable records found by fsck")
+	flag.StringVarP(&editorCmd, "editor", "e", os.Getenv("EDITOR"), "editor to edit records with")
+}
+
+func export(db internal.RawStore, kind string, names []string, single bool) error {
+	records := make(map[string]json.RawMessage)
+	for _, name := range names {
+		data, err := db.GetRaw(kind, name)
+		if err != nil {
+			return fmt.Errorf("error reading %s/%s: %w", kind, name, err)
+		}
+		if !json.Valid(data) {
+			// Export undecodable records as strings so they can be fixed
+			data, _ = json.Marshal(string(data))
+		}
+		records[name] = data
+	}
+
+	var v interface{} = records
+	if single {
+		v = records[names[0]]
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func edit(db internal.RawStore, kind, name string) error {
+	data, err := db.GetRaw(kind, name)
+	if err != nil {
+		return fmt.Errorf("error reading %s/%s: %w", kind, name, err)
+	}
+
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, data, "", "  "); err == nil {
+		data = buf.Bytes()
+	}
+
+	f, err := ioutil.TempFile("", fmt.Sprintf("storectl-%s-*.json", kind))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	editor := editorCmd
+	if editor == "" {
+		editor = "vi"
+	}
+	cmd := exec.Command(editor, f.Name())
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("error running editor %s: %w", editor, err)
+	}
+
+	edited, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(edited, data) {
+		log.Info("no changes made")
+		return nil
+	}
+
+	return save(db, kind, name, edited)
+}
+
+func save(db internal.RawStore, kind, name string, data []byte) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return fmt.Errorf("error parsing %s/%s: %w", kind, name, err)
+	}
+
+	if err := db.SetRaw(kind, name, buf.Bytes()); err != nil {
+		return fmt.Errorf("error saving %s/%s: %w", kind, name, err)
+	}
+
+	log.Infof("saved %s/%s", kind, name)
+	return nil
+}
+
+func fsck(db internal.RawStore) (int, error) {
+	problems, err := db.Fsck()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, problem := range problems {
+		fmt.Println(problem)
+		if fsckFix {
+			if err := db.DelRaw(problem.Kind, problem.Name); err != nil {
+				return 0, fmt.Errorf("error deleting %s/%s: %w", problem.Kind, problem.Name, err)
+			}
+			log.Infof("deleted %s/%s", problem.Kind, problem.Name)
+		}
+	}
+
+	return len(problems), nil
+}
+
+func main() {
+	flag.Parse()
+
+	if version {
+		fmt.Printf("%s %s", filepath.Base(os.Args[0]), yarn.FullVersion())
+		os.Exit(0)
+	}
+
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+
+		// Disable deadlock detection in production mode
+		sync.Opts.Disable = true
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	command, args := flag.Arg(0), flag.Args()[1:]
+
+	s, err := internal.NewStore(store)
+	if err != nil {
+		log.WithError(err).Errorf("error opening store %s", store)
+		os.Exit(2)
+	}
+	defer s.Close()
+
+	db, ok := s.(internal.RawStore)
+	if !ok {
+		log.Errorf("store %s does not support raw access to its records", store)
+		os.Exit(2)
+	}
+
+	needArgs := func(n int) {
+		if len(args) < n {
+			flag.Usage()
+			s.Close()
+			os.Exit(1)
+		}
+	}
+
+	switch command {
+	case "list", "ls":
+		needArgs(1)
+		var names []string
+		if names, err = db.ListRaw(args[0]); err != nil {
+			break
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Println(name)
+		}
+	case "export":
+		needArgs(1)
+		var names []string
+		if len(args) > 1 {
+			names = []string{args[1]}
+		} else {
+			if names, err = db.ListRaw(args[0]); err != nil {
+				break
+			}
+			sort.Strings(names)
+		}
+		err = export(db, args[0], names, len(args) == 2)
+	case "edit":
+		needArgs(2)
+		err = edit(db, args[0], args[1])
+	case "import":
+		needArgs(2)
+		var data []byte
+		if data, err = ioutil.ReadAll(os.Stdin); err == nil {
+			err = save(db, args[0], args[1], data)
+		}
+	case "delete", "rm":
+		needArgs(2)
+		if err = db.DelRaw(args[0], args[1]); err == nil {
+			log.Infof("deleted %s/%s", args[0], args[1])
+		}
+	case "fsck":
+		var n int
+		if n, err = fsck(db); err == nil {
+			log.Infof("found %d undecodable records", n)
+			if n > 0 && !fsckFix {
+				s.Close()
+				os.Exit(3)
+			}
+		}
+	default:
+		log.Errorf("unknown command %s", command)
+		flag.Usage()
+		s.Close()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		log.WithError(err).Errorf("error running %s", command)
+		s.Close()
+		os.Exit(3)
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	flag "github.com/spf13/pflag"
+
+	"git.mills.io/yarnsocial/yarn"
+	"git.mills.io/yarnsocial/yarn/internal"
+	sync "github.com/sasha-s/go-deadlock"
+	_ "go.yarn.social/lextwt"
+)
+
+var (
+	debug   bool
+	version bool
+
+	jsonOutput    bool
+	feedURL       string
+	maxTwtLength  int
+	maxFetchLimit int64
+)
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] <file|url|-> [<file|url|-> ...]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+
+	flag.BoolVarP(&debug, "debug", "D", false, "enable debug logging")
+	flag.BoolVarP(&version, "version", "v", false, "display version information")
+
+	flag.BoolVarP(&jsonOutput, "json", "j", false, "output the problems found as JSON")
+	flag.StringVarP(&feedURL, "url", "u", "", "url of the feed used to compute twt hashes (if the feed does not declare its url)")
+	flag.IntVar(&maxTwtLength, "max-twt-length", internal.DefaultMaxTwtLength, "maximum length of twts")
+	flag.Int64Var(&maxFetchLimit, "max-fetch-limit", internal.DefaultMaxFetchLimit, "maximum feed size in bytes")
+}
+
+func open(name string) (io.ReadCloser, string, error) {
+	if name == "-" {
+		return os.Stdin, feedURL, nil
+	}
+
+	if strings.HasPrefix(name, "http://") || strings.HasPrefix(name, "https://") {
+		res, err := http.Get(name)
+		if err != nil {
+			return nil, "", err
+		}
+		if res.StatusCode != http.StatusOK {
+			res.Body.Close()
+			return nil, "", fmt.Errorf("error fetching %s: %s", name, res.Status)
+		}
+		uri := feedURL
+		if uri == "" {
+			uri = name
+		}
+		return res.Body, uri, nil
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	return f, feedURL, nil
+}
+
+func main() {
+	flag.Parse()
+
+	if version {
+		fmt.Printf("%s %s", filepath.Base(os.Args[0]), yarn.FullVersion())
+		os.Exit(0)
+	}
+
+	if debug {
+		log.SetLevel(log.DebugLevel)
+	} else {
+		log.SetLevel(log.InfoLevel)
+
+		// Disable deadlock detection in production mode
+		sync.Opts.Disable = true
+	}
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	conf := internal.NewConfig()
+	conf.MaxTwtLength = maxTwtLength
+	conf.MaxFetchLimit = maxFetchLimit
+
+	valid := true
+	reports := make(map[string]*internal.LintReport)
+
+	for _, name := range flag.Args() {
+		r, uri, err := open(name)
+		if err != nil {
+			log.WithError(err).Errorf("error opening feed %s", name)
+			os.Exit(2)
+		}
+
+		report, err := internal.LintFeed(conf, r, uri)
+		r.Close()
+		if err != nil {
+			log.WithError(err).Errorf("error reading feed %s", name)
+			os.Exit(2)
+		}
+
+		reports[name] = report
+		if !report.Valid() {
+			valid = false
+		}
+
+		if jsonOutput {
+			continue
+		}
+
+		for _, problem := range report.Problems {
+			fmt.Printf("%s: %s\n", name, problem)
+		}
+		log.Debugf("%s: %d twts, %d problems", name, report.Twts, len(report.Problems))
+	}
+
+	if jsonOutput {
+		data, err := json.MarshalIndent(reports, "", "  ")
+		if err != nil {
+			log.WithError(err).Error("error encoding reports")
+			os.Exit(2)
+		}
+		fmt.Println(string(data))
+	}
+
+	if !valid {
+		os.Exit(1)
+	}
+}
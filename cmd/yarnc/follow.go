@@ -41,8 +41,7 @@ var followCmd = &cobra.Command{
 		nick := args[0]
 		url := args[1]
 
-		follow(cli, nick, url)
-		if err != nil {
+		if err := follow(cli, nick, url); err != nil {
 			log.WithError(err).Error(fmt.Sprintf("could not follow %s %s", nick, url))
 			os.Exit(1)
 		}
@@ -40,8 +40,7 @@ var unfollowCmd = &cobra.Command{
 
 		nick := args[0]
 
-		unfollow(cli, nick)
-		if err != nil {
+		if err := unfollow(cli, nick); err != nil {
 			log.WithError(err).Error(fmt.Sprintf("could not unfollow %s", nick))
 			os.Exit(1)
 		}
@@ -0,0 +1,180 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+const (
+	// uploadPollInterval is how often the processing of uploads is polled
+	uploadPollInterval = time.Second
+
+	// uploadTimeout is how long to wait for uploads to be processed
+	uploadTimeout = 5 * time.Minute
+)
+
+// uploadCmd represents the upload command
+var uploadCmd = &cobra.Command{
+	Use:     "upload [flags] <file> [<file> ...]",
+	Aliases: []string{"media"},
+	Short:   "Upload media (images, audio or video) to a Yarn.social pod",
+	Long: `The upload command uploads one or more media files to a Yarn.social
+pod and prints the URL of each uploaded file once it has been processed by the
+pod, suitable for including in a post. With -n/--no-wait the URL of the pod's
+processing task is printed instead without waiting for it to complete.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		uri := viper.GetString("uri")
+		token := viper.GetString("token")
+
+		noWait, err := cmd.Flags().GetBool("no-wait")
+		if err != nil {
+			log.WithError(err).Error("error getting no-wait flag")
+			os.Exit(1)
+		}
+
+		for _, fn := range args {
+			mediaURI, err := upload(uri, token, fn, !noWait)
+			if err != nil {
+				log.WithError(err).Errorf("error uploading %s", fn)
+				os.Exit(1)
+			}
+			fmt.Println(mediaURI)
+		}
+	},
+}
+
+func init() {
+	RootCmd.AddCommand(uploadCmd)
+
+	uploadCmd.Flags().BoolP(
+		"no-wait", "n", false,
+		"Do not wait for the uploads to be processed",
+	)
+}
+
+// uploadResult is the response of the upload and task endpoints
+type uploadResult struct {
+	Type  string            `json:"Type"`
+	Path  string            `json:"Path"`
+	State string            `json:"state"`
+	Error string            `json:"error"`
+	Data  map[string]string `json:"data"`
+}
+
+func upload(uri, token, fn string, wait bool) (string, error) {
+	f, err := os.Open(fn)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	// The pod processes uploads based on their content type
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	ctype := mime.TypeByExtension(filepath.Ext(fn))
+	if ctype == "" {
+		ctype = http.DetectContentType(head[:n])
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+
+	h := make(textproto.MIMEHeader)
+	h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="media_file"; filename=%q`, filepath.Base(fn)))
+	h.Set("Content-Type", ctype)
+	part, err := w.CreatePart(h)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, strings.TrimSuffix(uri, "/")+"/upload", body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Token", token)
+
+	var res uploadResult
+	if err := doUploadRequest(req, &res); err != nil {
+		return "", err
+	}
+
+	if res.Type != "taskURI" || !wait {
+		return res.Path, nil
+	}
+
+	return waitForUpload(res.Path)
+}
+
+// waitForUpload polls the task processing an upload until it completes
+// and returns the URL of the processed media
+func waitForUpload(taskURI string) (string, error) {
+	deadline := time.Now().Add(uploadTimeout)
+	for time.Now().Before(deadline) {
+		req, err := http.NewRequest(http.MethodGet, taskURI, nil)
+		if err != nil {
+			return "", err
+		}
+
+		var res uploadResult
+		if err := doUploadRequest(req, &res); err != nil {
+			return "", err
+		}
+
+		switch res.State {
+		case "complete":
+			return res.Data["mediaURI"], nil
+		case "failed":
+			return "", fmt.Errorf("error processing upload: %s", res.Error)
+		}
+
+		time.Sleep(uploadPollInterval)
+	}
+
+	return "", fmt.Errorf("error: timed out waiting for upload to be processed (%s)", taskURI)
+}
+
+func doUploadRequest(req *http.Request, v interface{}) error {
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("error: %s: %s", res.Status, strings.TrimSpace(string(msg)))
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
@@ -57,14 +57,20 @@ func (f *flagSliceOfFeatureType) Set(value string) error {
 }
 
 var (
-	bind    string
-	debug   bool
-	version bool
+	bind        string
+	debug       bool
+	version     bool
+	printConfig bool
 
 	// TLS options
-	tls     bool
-	tlsKey  string
-	tlsCert string
+	tls             bool
+	tlsKey          string
+	tlsCert         string
+	tlsOCSPStapling bool
+	tlsHTTP3        bool
+
+	// Additional listeners
+	listeners []string
 
 	// Basic options
 	name        string
@@ -72,6 +78,7 @@ var (
 	data        string
 	store       string
 	theme       string
+	themesDirs  []string
 	lang        string
 	baseURL     string
 
@@ -82,21 +89,33 @@ var (
 
 	// Pod Settings
 	openProfiles      bool
+	publicAPI         bool
+	apiValidation     bool
 	openRegistrations bool
 	disableGzip       bool
 	disableLogger     bool
 	disableMedia      bool
 	disableFfmpeg     bool
+	disableMediaProxy bool
 
 	// Pod Limits
-	twtsPerPage      int
-	maxTwtLength     int
-	maxUploadSize    int64
-	maxFetchLimit    int64
-	maxCacheFetchers int
-	maxCacheTTL      time.Duration
-	fetchInterval    string
-	maxCacheItems    int
+	twtsPerPage           int
+	maxTwtLength          int
+	maxUploadSize         int64
+	maxFetchLimit         int64
+	maxFetchRedirects     int
+	twtHashLength         int
+	maxCacheFetchers      int
+	maxCacheTTL           time.Duration
+	maxCacheMemory        int64
+	cacheSnapshotInterval time.Duration
+	graylistMinAge        time.Duration
+	graylistMinTwts       int
+	taskMaxRetries        int
+	taskRetryBackoff      time.Duration
+	taskConcurrency       string
+	fetchInterval         string
+	maxCacheItems         int
 
 	// Pod Secrets
 	apiSigningKey   string
@@ -110,16 +129,37 @@ var (
 	smtpPass string
 	smtpFrom string
 
+	// Gateways
+	nntpBind     string
+	xmppJID      string
+	xmppPassword string
+	xmppServer   string
+
+	// Plugins
+	pluginsDir string
+
 	// Timeouts
 	sessionExpiry     time.Duration
 	sessionCacheTTL   time.Duration
 	apiSessionTime    time.Duration
 	transcoderTimeout time.Duration
 
+	// Accounts
+	deletionGracePeriod time.Duration
+
 	// permittedImages, Blocklists, Feedsources
 	feedSources     []string
 	permittedImages []string
 	blockedFeeds    []string
+	allowedFeeds    []string
+
+	// Server-side fetches
+	fetchAllowedNetworks []string
+
+	// CORS
+	corsOrigins []string
+	corsHeaders []string
+	corsMethods []string
 
 	// Optional Features
 	enabledFeatures flagSliceOfFeatureType
@@ -129,11 +169,20 @@ func init() {
 	flag.BoolVarP(&debug, "debug", "D", false, "enable debug logging")
 	flag.StringVarP(&bind, "bind", "b", "0.0.0.0:8000", "[int]:<port> to bind to")
 	flag.BoolVarP(&version, "version", "v", false, "display version information")
+	flag.BoolVar(&printConfig, "print-config", false, "print the effective configuration (with secrets redacted) and exit")
 
 	// TLS options
 	flag.BoolVar(&tls, "tls", internal.DefaultTLS, "enable TLS (HTTPS)")
 	flag.StringVar(&tlsKey, "tls-key", internal.DefaultTLSKey, "path to TLS private key (if blank uses Let's Encrypt)")
 	flag.StringVar(&tlsCert, "tls-cert", internal.DefaultTLSCert, "path to TLS certificate (if blank uses Let's Encrypt)")
+	flag.BoolVar(&tlsOCSPStapling, "tls-ocsp-stapling", internal.DefaultTLSOCSPStapling, "staple OCSP responses to TLS certificates")
+	flag.BoolVar(&tlsHTTP3, "tls-http3", internal.DefaultTLSHTTP3, "also serve HTTP/3 (QUIC) on the UDP port of the bind address")
+
+	// Additional listeners
+	flag.StringSliceVar(
+		&listeners, "listen", nil,
+		"additional [int]:<port> or unix:/path/to/socket to listen on, optionally with TLS (e.g: 127.0.0.1:8443,cert=/path/to/cert,key=/path/to/key)",
+	)
 
 	// Basic options
 	flag.StringVarP(&name, "name", "n", internal.DefaultName, "set the pod's name")
@@ -141,6 +190,7 @@ func init() {
 	flag.StringVarP(&data, "data", "d", internal.DefaultData, "data directory")
 	flag.StringVarP(&store, "store", "s", internal.DefaultStore, "store to use")
 	flag.StringVarP(&theme, "theme", "t", internal.DefaultTheme, "set the theme to use for templates and static assets (if not specified, uses builtin theme)")
+	flag.StringSliceVar(&themesDirs, "themes-dirs", internal.DefaultThemesDirs, "directories containing themes that can be selected at runtime by the pod operator")
 	flag.StringVarP(&lang, "lang", "l", internal.DefaultLang, "set the default language")
 	flag.StringVarP(&baseURL, "base-url", "u", internal.DefaultBaseURL, "base url to use")
 
@@ -158,6 +208,14 @@ func init() {
 		&openProfiles, "open-profiles", "O", internal.DefaultOpenProfiles,
 		"whether or not to have open user profiles",
 	)
+	flag.BoolVar(
+		&publicAPI, "public-api", internal.DefaultPublicAPI,
+		"whether or not to expose read-only public API endpoints without authentication",
+	)
+	flag.BoolVar(
+		&apiValidation, "api-validation", internal.DefaultAPIValidation,
+		"whether or not to validate API requests against the API's specification",
+	)
 	flag.BoolVar(
 		&disableGzip, "disable-gzip", internal.DefaultDisableGzip,
 		"whether or not to disable Gzip compression",
@@ -174,6 +232,10 @@ func init() {
 		&disableFfmpeg, "disable-ffmpeg", internal.DefaultDisableFfmpeg,
 		"whether or not to disable ffmpeg support for video and audio",
 	)
+	flag.BoolVar(
+		&disableMediaProxy, "disable-media-proxy", internal.DefaultDisableMediaProxy,
+		"whether or not to disable proxying external images referenced in twts",
+	)
 
 	// Pod Limits
 	flag.IntVarP(
@@ -192,10 +254,46 @@ func init() {
 		&maxFetchLimit, "max-fetch-limit", "F", internal.DefaultMaxFetchLimit,
 		"maximum feed fetch limit in bytes",
 	)
+	flag.IntVar(
+		&maxFetchRedirects, "max-fetch-redirects", internal.DefaultMaxFetchRedirects,
+		"maximum number of redirects followed when fetching feeds, avatars, etc",
+	)
+	flag.IntVar(
+		&twtHashLength, "twt-hash-length", internal.DefaultTwtHashLength,
+		"length of twt hashes (legacy 7 character hashes are always accepted)",
+	)
 	flag.DurationVarP(
 		&maxCacheTTL, "max-cache-ttl", "C", internal.DefaultMaxCacheTTL,
 		"maximum cache ttl (time-to-live) of cached twts in memory",
 	)
+	flag.Int64VarP(
+		&maxCacheMemory, "max-cache-memory", "", internal.DefaultMaxCacheMemory,
+		"memory budget of the feed cache in bytes (0 means unlimited)",
+	)
+	flag.DurationVarP(
+		&cacheSnapshotInterval, "cache-snapshot-interval", "", internal.DefaultCacheSnapshotInterval,
+		"interval between snapshots of the feed cache to disk",
+	)
+	flag.DurationVarP(
+		&graylistMinAge, "graylist-min-age", "", internal.DefaultGraylistMinAge,
+		"minimum time newly followed external feeds are graylisted (kept out of discover) for",
+	)
+	flag.IntVarP(
+		&graylistMinTwts, "graylist-min-twts", "", internal.DefaultGraylistMinTwts,
+		"minimum number of twts graylisted feeds must have to be shown on discover",
+	)
+	flag.IntVarP(
+		&taskMaxRetries, "task-max-retries", "", internal.DefaultTaskMaxRetries,
+		"number of times failed media tasks are retried before being kept as dead letters",
+	)
+	flag.DurationVarP(
+		&taskRetryBackoff, "task-retry-backoff", "", internal.DefaultTaskRetryBackoff,
+		"time to wait before the first retry of a failed media task (doubled after each retry)",
+	)
+	flag.StringVarP(
+		&taskConcurrency, "task-concurrency", "", internal.DefaultTaskConcurrency,
+		"limits of the number of media tasks of each kind run concurrently (e.g: video=1,audio=2)",
+	)
 	flag.IntVarP(
 		&maxCacheFetchers, "max-cache-fetchers", "", internal.DefaultMaxCacheFetchers,
 		"set maximum numnber of fetchers to use for feed cache updates",
@@ -230,11 +328,24 @@ func init() {
 	flag.StringVar(&smtpPass, "smtp-pass", internal.DefaultSMTPPass, "SMTP Pass to use for email sending")
 	flag.StringVar(&smtpFrom, "smtp-from", internal.DefaultSMTPFrom, "SMTP From to use for email sending")
 
+	// Gateways
+	flag.StringVar(&nntpBind, "nntp-bind", internal.DefaultNNTPBind, "[int]:<port> to bind the read-only NNTP gateway to (disabled if blank)")
+	flag.StringVar(&xmppJID, "xmpp-jid", internal.DefaultXMPPJID, "JID the XMPP notification bridge connects as (disabled if blank)")
+	flag.StringVar(&xmppPassword, "xmpp-password", internal.DefaultXMPPPassword, "password of the XMPP notification bridge's JID")
+	flag.StringVar(&xmppServer, "xmpp-server", internal.DefaultXMPPServer, "XMPP server host:port (discovered from the JID if blank)")
+
+	// Plugins
+	flag.StringVar(&pluginsDir, "plugins-dir", internal.DefaultPluginsDir, "directory to load Go plugins (*.so) from (disabled if blank)")
+
 	// Timeouts
 	flag.DurationVar(
 		&sessionExpiry, "session-expiry", internal.DefaultSessionExpiry,
 		"timeout for sessions to expire",
 	)
+	flag.DurationVar(
+		&deletionGracePeriod, "deletion-grace-period", internal.DefaultDeletionGracePeriod,
+		"time deleted accounts are kept before they are purged (0 to delete immediately)",
+	)
 	flag.DurationVar(
 		&sessionCacheTTL, "session-cache-ttl", internal.DefaultSessionCacheTTL,
 		"time-to-live for cached sessions",
@@ -261,33 +372,137 @@ func init() {
 		&blockedFeeds, "blocked-feeds", internal.DefaultBlockedFeeds,
 		"blocked feeds (regexes) to prohibit fetching",
 	)
+	flag.StringSliceVar(
+		&allowedFeeds, "allowed-feeds", nil,
+		"allowed feeds (regexes), if set only matching feeds may be followed and fetched (allowlist federation)",
+	)
+
+	// Server-side fetches
+	flag.StringSliceVar(
+		&fetchAllowedNetworks, "fetch-allowed-networks", nil,
+		"private or reserved networks (CIDRs) that server-side fetches may connect to (e.g: for intranet pods)",
+	)
+
+	// CORS
+	flag.StringSliceVar(
+		&corsOrigins, "cors-origins", internal.DefaultCORSOrigins,
+		"origins allowed to make cross-origin requests to the API and media endpoints (* for any)",
+	)
+	flag.StringSliceVar(
+		&corsHeaders, "cors-headers", internal.DefaultCORSHeaders,
+		"request headers allowed in cross-origin requests",
+	)
+	flag.StringSliceVar(
+		&corsMethods, "cors-methods", internal.DefaultCORSMethods,
+		"methods allowed in cross-origin requests",
+	)
 
 	// Optional Features
 	flag.Var(&enabledFeatures, "enable-feature", "enable the named feature")
 }
 
+// envPrefix is the prefix of environment variables configuring yarnd
+// (e.g: YARND_BASE_URL for --base-url)
+const envPrefix = "YARND_"
+
+// envFlags are the flags set from the environment
+var envFlags = make(map[string]bool)
+
 func flagNameFromEnvironmentName(s string) string {
 	s = strings.ToLower(s)
 	s = strings.Replace(s, "_", "-", -1)
 	return s
 }
 
+// parseArgs parses the command-line flags and then sets any flags not given
+// on the command-line from the environment. Environment variables prefixed
+// with YARND_ take precedence over unprefixed ones (e.g: BASE_URL) which
+// are still supported for backwards compatibility.
 func parseArgs() error {
+	flag.Parse()
+
+	values := make(map[string]string)
 	for _, v := range os.Environ() {
 		vals := strings.SplitN(v, "=", 2)
+		if len(vals) != 2 {
+			continue
+		}
+		if strings.HasPrefix(vals[0], envPrefix) {
+			values[flagNameFromEnvironmentName(strings.TrimPrefix(vals[0], envPrefix))] = vals[1]
+			continue
+		}
 		flagName := flagNameFromEnvironmentName(vals[0])
+		if _, ok := values[flagName]; !ok {
+			values[flagName] = vals[1]
+		}
+	}
+
+	for flagName, value := range values {
 		fn := flag.CommandLine.Lookup(flagName)
 		if fn == nil || fn.Changed {
 			continue
 		}
-		if err := fn.Value.Set(vals[1]); err != nil {
-			return err
+		if err := fn.Value.Set(value); err != nil {
+			return fmt.Errorf("error setting --%s from the environment: %w", flagName, err)
 		}
+		envFlags[flagName] = true
 	}
-	flag.Parse()
+
 	return nil
 }
 
+// isSet returns true if the named flag was given on the command-line or set
+// from the environment
+func isSet(name string) bool {
+	return flag.CommandLine.Changed(name) || envFlags[name]
+}
+
+// settingsOverrides returns the options of flags also configurable by the
+// pod settings (settings.yaml) that were explicitly set on the command-line
+// or in the environment, so that these take precedence over the pod settings
+func settingsOverrides() []internal.Option {
+	var overrides []internal.Option
+
+	if isSet("name") {
+		overrides = append(overrides, internal.WithName(name))
+	}
+	if isSet("description") {
+		overrides = append(overrides, internal.WithDescription(description))
+	}
+	if isSet("open-profiles") {
+		overrides = append(overrides, internal.WithOpenProfiles(openProfiles))
+	}
+	if isSet("public-api") {
+		overrides = append(overrides, internal.WithPublicAPI(publicAPI))
+	}
+	if isSet("open-registrations") {
+		overrides = append(overrides, internal.WithOpenRegistrations(openRegistrations))
+	}
+	if isSet("twts-per-page") {
+		overrides = append(overrides, internal.WithTwtsPerPage(twtsPerPage))
+	}
+	if isSet("max-twt-length") {
+		overrides = append(overrides, internal.WithMaxTwtLength(maxTwtLength))
+	}
+	if isSet("fetch-interval") {
+		overrides = append(overrides, internal.WithFetchInterval(fetchInterval))
+	}
+	if isSet("permitted-images") {
+		overrides = append(overrides, internal.WithPermittedImages(permittedImages))
+	}
+	if isSet("blocked-feeds") {
+		overrides = append(overrides, internal.WithBlockedFeeds(blockedFeeds))
+	}
+	if isSet("allowed-feeds") {
+		overrides = append(overrides, internal.WithAllowedFeeds(allowedFeeds))
+	}
+	if isSet("enable-feature") {
+		overrides = append(overrides, internal.WithEnabledFeatures(enabledFeatures))
+	}
+
+	return overrides
+}
+
 func extraServiceInfoFactory(svr *internal.Server) profiler.ExtraServiceInfoRetriever {
 	return func() map[string]interface{} {
 		extraInfo := make(map[string]interface{})
@@ -301,7 +516,9 @@ func extraServiceInfoFactory(svr *internal.Server) profiler.ExtraServiceInfoRetr
 }
 
 func main() {
-	parseArgs()
+	if err := parseArgs(); err != nil {
+		log.WithError(err).Fatal("error parsing arguments")
+	}
 
 	if version {
 		fmt.Printf("yarnd %s", yarn.FullVersion())
@@ -317,7 +534,7 @@ func main() {
 		sync.Opts.Disable = true
 	}
 
-	svr, err := internal.NewServer(bind,
+	opts := []internal.Option{
 		// Debug mode
 		internal.WithDebug(debug),
 
@@ -325,6 +542,11 @@ func main() {
 		internal.WithTLS(tls),
 		internal.WithTLSKey(tlsKey),
 		internal.WithTLSCert(tlsCert),
+		internal.WithTLSOCSPStapling(tlsOCSPStapling),
+		internal.WithTLSHTTP3(tlsHTTP3),
+
+		// Additional listeners
+		internal.WithListeners(listeners),
 
 		// Basic options
 		internal.WithName(name),
@@ -332,6 +554,7 @@ func main() {
 		internal.WithData(data),
 		internal.WithStore(store),
 		internal.WithTheme(theme),
+		internal.WithThemesDirs(themesDirs),
 		internal.WithBaseURL(baseURL),
 
 		// Pod Oeprator
@@ -341,19 +564,31 @@ func main() {
 
 		// Pod Settings
 		internal.WithOpenProfiles(openProfiles),
+		internal.WithPublicAPI(publicAPI),
+		internal.WithAPIValidation(apiValidation),
 		internal.WithOpenRegistrations(openRegistrations),
 		internal.WithDisableGzip(disableGzip),
 		internal.WithDisableLogger(disableLogger),
 		internal.WithDisableMedia(disableMedia),
 		internal.WithDisableFfmpeg(disableFfmpeg),
+		internal.WithDisableMediaProxy(disableMediaProxy),
 
 		// Pod Limits
 		internal.WithTwtsPerPage(twtsPerPage),
 		internal.WithMaxTwtLength(maxTwtLength),
 		internal.WithMaxUploadSize(maxUploadSize),
 		internal.WithMaxFetchLimit(maxFetchLimit),
+		internal.WithMaxFetchRedirects(maxFetchRedirects),
+		internal.WithTwtHashLength(twtHashLength),
 		internal.WithMaxCacheFetchers(maxCacheFetchers),
 		internal.WithMaxCacheTTL(maxCacheTTL),
+		internal.WithMaxCacheMemory(maxCacheMemory),
+		internal.WithCacheSnapshotInterval(cacheSnapshotInterval),
+		internal.WithGraylistMinAge(graylistMinAge),
+		internal.WithGraylistMinTwts(graylistMinTwts),
+		internal.WithTaskMaxRetries(taskMaxRetries),
+		internal.WithTaskRetryBackoff(taskRetryBackoff),
+		internal.WithTaskConcurrency(taskConcurrency),
 		internal.WithFetchInterval(fetchInterval),
 		internal.WithMaxCacheItems(maxCacheItems),
 
@@ -369,20 +604,59 @@ func main() {
 		internal.WithSMTPPass(smtpPass),
 		internal.WithSMTPFrom(smtpFrom),
 
+		// Gateways
+		internal.WithNNTPBind(nntpBind),
+		internal.WithXMPPJID(xmppJID),
+		internal.WithXMPPPassword(xmppPassword),
+		internal.WithXMPPServer(xmppServer),
+
+		// Plugins
+		internal.WithPluginsDir(pluginsDir),
+
 		// Timeouts
 		internal.WithSessionExpiry(sessionExpiry),
 		internal.WithSessionCacheTTL(sessionCacheTTL),
 		internal.WithAPISessionTime(apiSessionTime),
 		internal.WithTranscoderTimeout(transcoderTimeout),
 
+		// Accounts
+		internal.WithDeletionGracePeriod(deletionGracePeriod),
+
 		// PermittedImages, Blocklists, Feedsources
 		internal.WithFeedSources(feedSources),
 		internal.WithPermittedImages(permittedImages),
 		internal.WithBlockedFeeds(blockedFeeds),
+		internal.WithAllowedFeeds(allowedFeeds),
+
+		// Server-side fetches
+		internal.WithFetchAllowedNetworks(fetchAllowedNetworks),
+
+		// CORS
+		internal.WithCORSOrigins(corsOrigins),
+		internal.WithCORSHeaders(corsHeaders),
+		internal.WithCORSMethods(corsMethods),
 
 		// Optional Features
 		internal.WithEnabledFeatures(enabledFeatures),
-	)
+
+		// Flags and environment take precedence over the pod settings
+		internal.WithOverrides(settingsOverrides()...),
+	}
+
+	if printConfig {
+		config, err := internal.LoadConfig(opts...)
+		if err != nil {
+			log.WithError(err).Fatal("error loading config")
+		}
+		data, err := config.Dump()
+		if err != nil {
+			log.WithError(err).Fatal("error dumping config")
+		}
+		fmt.Print(string(data))
+		os.Exit(0)
+	}
+
+	svr, err := internal.NewServer(bind, opts...)
 	if err != nil {
 		log.WithError(err).Fatal("error creating server")
 	}
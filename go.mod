@@ -39,6 +39,7 @@ require (
 	github.com/julienschmidt/httprouter v1.3.0
 	github.com/justinas/nosurf v1.1.1
 	github.com/lithammer/shortuuid/v3 v3.0.7
+	github.com/lucas-clemente/quic-go v0.27.0
 	github.com/magiconair/properties v1.8.6 // indirect
 	github.com/makeworld-the-better-one/go-gemini v0.13.0
 	github.com/marksalpeter/sugar v0.0.0-20160713164314-a69afe358ea8 // indirect
@@ -82,7 +83,7 @@ require (
 	go.yarn.social/types v0.0.0-20220304222359-9694f95ad749
 	golang.org/x/crypto v0.0.0-20220315160706-3147a52a75dd
 	golang.org/x/exp v0.0.0-20220314205449-43aec2f8a4e7 // indirect
-	golang.org/x/image v0.0.0-20220302094943-723b81ca9867 // indirect
+	golang.org/x/image v0.0.0-20220302094943-723b81ca9867
 	golang.org/x/net v0.0.0-20220225172249-27dd8689420f
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
 	golang.org/x/sys v0.0.0-20220315194320-039c03cc5b86 // indirect
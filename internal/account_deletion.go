@@ -0,0 +1,301 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+// cancelDeletionClaim is the purpose of magic links that cancel the deletion
+// of an account (so they cannot be used to login and vice versa)
+const cancelDeletionClaim = "cancel-deletion"
+
+// DeletionScheduledAt returns when an account pending deletion will be purged
+func (u *User) DeletionScheduledAt(conf *Config) time.Time {
+	return u.StateChangedAt.Add(conf.DeletionGracePeriod)
+}
+
+// removeTwtsMedia deletes the archived twts of a feed and the media uploaded
+// with them
+func removeTwtsMedia(conf *Config, archive Archiver, twts types.Twts) error {
+	for _, twt := range twts {
+		// Delete archived twts
+		if err := archive.Del(twt.Hash()); err != nil {
+			return err
+		}
+
+		// Remove all uploaded media in a twt
+		for _, mediaPath := range GetMediaNamesFromText(fmt.Sprintf("%t", twt)) {
+			fn := filepath.Join(conf.Data, mediaDir, fmt.Sprintf("%s.png", mediaPath))
+			if FileExists(fn) {
+				if err := os.Remove(fn); err != nil {
+					log.WithError(err).Error("error removing media")
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// PurgeUser permanently deletes a user, the feeds they own, their twts and
+// uploaded media
+func PurgeUser(conf *Config, cache *Cache, archive Archiver, db Store, user *User) error {
+	feeds, err := db.GetAllFeeds()
+	if err != nil {
+		return err
+	}
+
+	for _, feed := range feeds {
+		if !user.OwnsFeed(feed.Name) || feed.Name == "" {
+			continue
+		}
+
+		twts, err := GetAllTwts(conf, feed.Name)
+		if err != nil {
+			return err
+		}
+		if err := removeTwtsMedia(conf, archive, twts); err != nil {
+			return err
+		}
+
+		if err := db.DelFeed(feed.Name); err != nil {
+			return err
+		}
+
+		fn := filepath.Join(conf.Data, feedsDir, feed.Name)
+		if FileExists(fn) {
+			if err := os.Remove(fn); err != nil {
+				log.WithError(err).Error("error removing feed")
+			}
+		}
+
+		cache.DeleteFeeds(feed.Source())
+	}
+
+	twts, err := GetAllTwts(conf, user.Username)
+	if err != nil {
+		return err
+	}
+	if err := removeTwtsMedia(conf, archive, twts); err != nil {
+		return err
+	}
+
+	if err := db.DelFeed(user.Username); err != nil {
+		return err
+	}
+
+	fn := filepath.Join(conf.Data, feedsDir, user.Username)
+	if FileExists(fn) {
+		if err := os.Remove(fn); err != nil {
+			log.WithError(err).Error("error removing user's feed")
+		}
+	}
+
+	if err := db.DelUser(user.Username); err != nil {
+		return err
+	}
+
+	cache.DeleteFeeds(user.Source())
+
+	return nil
+}
+
+// PurgeDeletedUsersJob purges accounts whose deletion grace period is over
+type PurgeDeletedUsersJob struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewPurgeDeletedUsersJob(conf *Config, cache *Cache, archive Archiver, db Store) Job {
+	return &PurgeDeletedUsersJob{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+func (job *PurgeDeletedUsersJob) String() string { return "PurgeDeletedUsers" }
+
+func (job *PurgeDeletedUsersJob) Run() {
+	users, err := job.db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Warn("unable to get all users from database")
+		return
+	}
+
+	now := time.Now()
+	for _, user := range users {
+		if user.AccountState() != AccountPendingDeletion || user.DeletionScheduledAt(job.conf).After(now) {
+			continue
+		}
+
+		if err := PurgeUser(job.conf, job.cache, job.archive, job.db, user); err != nil {
+			log.WithError(err).Errorf("error purging deleted user %s", user.Username)
+			continue
+		}
+
+		if err := audit.Record(user.Username, "purge user", user.Username, ""); err != nil {
+			log.WithError(err).Error("error recording audit entry")
+		}
+
+		log.Infof("purged deleted user %s", user.Username)
+	}
+}
+
+// CancelDeletionHandler sends a magic link to cancel the deletion of an
+// account pending deletion (POST) and cancels the deletion when the magic
+// link is followed (GET with ?token=)
+func (s *Server) CancelDeletionHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if r.Method == http.MethodGet {
+			if tokenString := r.URL.Query().Get("token"); tokenString != "" {
+				s.cancelDeletion(ctx, w, tokenString)
+				return
+			}
+
+			ctx.Title = s.tr(ctx, "CancelDeletionTitle")
+			s.render("cancelDeletion", w, ctx)
+			return
+		}
+
+		username := NormalizeUsername(r.FormValue("username"))
+		email := strings.TrimSpace(r.FormValue("email"))
+		recovery := fmt.Sprintf("email:%s", FastHashString(email))
+
+		user, err := s.db.GetUser(username)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUserNotFound")
+			s.render("error", w, ctx)
+			return
+		}
+
+		if recovery != user.Recovery {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUserRecovery")
+			s.render("error", w, ctx)
+			return
+		}
+
+		if user.AccountState() != AccountPendingDeletion {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorAccountNotPendingDeletion")
+			s.render("error", w, ctx)
+			return
+		}
+
+		token := jwt.NewWithClaims(
+			jwt.SigningMethodHS256,
+			jwt.MapClaims{
+				"username":  username,
+				"purpose":   cancelDeletionClaim,
+				"expiresAt": time.Now().Add(30 * time.Minute).Unix(),
+			},
+		)
+		tokenString, err := token.SignedString([]byte(s.config().MagicLinkSecret))
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = err.Error()
+			s.render("error", w, ctx)
+			return
+		}
+		parts := strings.SplitN(tokenString, ".", 3)
+		tokenCache.Inc(parts[2])
+
+		if err := SendCancelDeletionEmail(s.config(), user, email, tokenString); err != nil {
+			log.WithError(err).Errorf("unable to send cancel deletion email to %s", user.Username)
+			ctx.Error = true
+			ctx.Message = err.Error()
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = s.tr(ctx, "MsgCancelDeletionEmailSent")
+		s.render("error", w, ctx)
+	}
+}
+
+// cancelDeletion reactivates the account a cancel deletion magic link was
+// sent for
+func (s *Server) cancelDeletion(ctx *Context, w http.ResponseWriter, tokenString string) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(s.config().MagicLinkSecret), nil
+	})
+	if err != nil || tokenCache.Get(token.Signature) == 0 {
+		ctx.Error = true
+		ctx.Message = s.tr(ctx, "ErrorInvalidToken")
+		s.render("error", w, ctx)
+		return
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims["purpose"] != cancelDeletionClaim {
+		ctx.Error = true
+		ctx.Message = s.tr(ctx, "ErrorInvalidToken")
+		s.render("error", w, ctx)
+		return
+	}
+
+	if expiresAt, ok := claims["expiresAt"].(float64); !ok || time.Now().Unix() > int64(expiresAt) {
+		ctx.Error = true
+		ctx.Message = s.tr(ctx, "ErrorTokenExpired")
+		s.render("error", w, ctx)
+		return
+	}
+	tokenCache.Dec(token.Signature)
+
+	username := fmt.Sprintf("%v", claims["username"])
+	user, err := s.db.GetUser(username)
+	if err != nil {
+		ctx.Error = true
+		ctx.Message = s.tr(ctx, "ErrorGetUser")
+		s.render("error", w, ctx)
+		return
+	}
+
+	if user.AccountState() != AccountPendingDeletion {
+		ctx.Error = true
+		ctx.Message = s.tr(ctx, "ErrorAccountNotPendingDeletion")
+		s.render("error", w, ctx)
+		return
+	}
+
+	if err := user.SetAccountState(AccountActive, ""); err != nil {
+		ctx.Error = true
+		ctx.Message = s.tr(ctx, "ErrorCancellingDeletion")
+		s.render("error", w, ctx)
+		return
+	}
+
+	if err := s.db.SetUser(username, user); err != nil {
+		log.WithError(err).Errorf("error saving user object for %s", username)
+		ctx.Error = true
+		ctx.Message = s.tr(ctx, "ErrorCancellingDeletion")
+		s.render("error", w, ctx)
+		return
+	}
+
+	if err := audit.Record(username, "cancel deletion", username, ""); err != nil {
+		log.WithError(err).Error("error recording audit entry")
+	}
+
+	ctx.Error = false
+	ctx.Message = s.tr(ctx, "MsgCancelDeletionSuccess")
+	s.render("error", w, ctx)
+}
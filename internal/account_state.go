@@ -0,0 +1,87 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInvalidAccountState is returned for unknown account states
+	ErrInvalidAccountState = errors.New("error: invalid account state")
+
+	// ErrInvalidAccountStateTransition is returned when an account cannot be
+	// moved from its current state to the requested one
+	ErrInvalidAccountStateTransition = errors.New("error: invalid account state transition")
+)
+
+// AccountState is the state of a user's account
+type AccountState string
+
+const (
+	// AccountActive accounts can login and post as normal
+	AccountActive AccountState = "active"
+
+	// AccountSuspended accounts are temporarily suspended by the Pod
+	// Owner/Operator, cannot login and their feeds are gone (410)
+	AccountSuspended AccountState = "suspended"
+
+	// AccountDisabled accounts are disabled indefinitely
+	AccountDisabled AccountState = "disabled"
+
+	// AccountPendingDeletion accounts are deactivated and will be deleted
+	AccountPendingDeletion AccountState = "pending-deletion"
+)
+
+// accountStateTransitions are the valid transitions between account states
+var accountStateTransitions = map[AccountState][]AccountState{
+	AccountActive:          {AccountSuspended, AccountDisabled, AccountPendingDeletion},
+	AccountSuspended:       {AccountActive, AccountDisabled, AccountPendingDeletion},
+	AccountDisabled:        {AccountActive, AccountPendingDeletion},
+	AccountPendingDeletion: {AccountActive},
+}
+
+// ParseAccountState parses the state of an account
+func ParseAccountState(s string) (AccountState, error) {
+	state := AccountState(s)
+	if _, ok := accountStateTransitions[state]; !ok {
+		return "", ErrInvalidAccountState
+	}
+	return state, nil
+}
+
+// AccountState returns the state of the user's account (accounts created
+// before account states existed are active)
+func (u *User) AccountState() AccountState {
+	if u.State == "" {
+		return AccountActive
+	}
+	return u.State
+}
+
+// IsActive returns true if the user's account is active
+func (u *User) IsActive() bool {
+	return u.AccountState() == AccountActive
+}
+
+// SetAccountState moves the user's account to a new state if the transition
+// is valid
+func (u *User) SetAccountState(state AccountState, reason string) error {
+	current := u.AccountState()
+	if state == current {
+		return nil
+	}
+
+	for _, next := range accountStateTransitions[current] {
+		if next == state {
+			u.State = state
+			u.StateReason = reason
+			u.StateChangedAt = time.Now()
+			return nil
+		}
+	}
+
+	return ErrInvalidAccountStateTransition
+}
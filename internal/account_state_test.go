@@ -0,0 +1,104 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"git.mills.io/yarnsocial/yarn/internal/auth"
+	"git.mills.io/yarnsocial/yarn/internal/session"
+)
+
+func TestInactiveAccountsAlternateAuth(t *testing.T) {
+	s := newTestHandlerServer(t)
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = s.config().URLForUser(user.Username)
+	user.Feeds = []string{"alicebot"}
+	user.FeedToken = GenerateRandomToken()
+	user.PostByEmailToken = GenerateRandomToken()
+	require.NoError(t, user.SetAccountState(AccountSuspended, "spam"))
+	require.NoError(t, s.db.SetUser(user.Username, user))
+
+	const botToken = "s3cr3t"
+	feed := NewFeed()
+	feed.Name = "alicebot"
+	feed.BotTokenHash = FastHashString(botToken)
+	require.NoError(t, s.db.SetFeed(feed.Name, feed))
+
+	t.Run("bot tokens", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/feed/alicebot/post", strings.NewReader("Hello World!"))
+		r.Header.Set("Authorization", "Bearer "+botToken)
+		w := httptest.NewRecorder()
+
+		s.BotPostHandler()(w, r, httprouter.Params{{Key: "name", Value: feed.Name}})
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("post-by-email", func(t *testing.T) {
+		recipient := PostByEmailAddress(s.config(), user)
+		msg := fmt.Sprintf("To: %s\r\nSubject: Hello\r\n\r\nHello World!\r\n", recipient)
+		r := httptest.NewRequest(http.MethodPost, "/mail/inbound", strings.NewReader(msg))
+		w := httptest.NewRecorder()
+
+		s.InboundMailHandler()(w, r, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("micropub", func(t *testing.T) {
+		form := url.Values{"h": {"entry"}, "content": {"Hello World!"}}
+		r := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Authorization", "Bearer "+testIndieAuthToken(t, s.config(), user.Username, "create"))
+		w := httptest.NewRecorder()
+
+		s.MicropubHandler()(w, r, nil)
+		assert.Equal(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("private feed tokens", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, GetPrivateFeedURLs(s.config(), user).Timeline, nil)
+		w := httptest.NewRecorder()
+
+		privateFeedsRouter(s).ServeHTTP(w, r)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestInactiveAccountsSession(t *testing.T) {
+	s := newTestHandlerServer(t)
+	s.am = auth.NewManager(auth.NewOptions("/login", "/register", CheckSessionAccount(s.db)))
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = s.config().URLForUser(user.Username)
+	require.NoError(t, user.SetAccountState(AccountSuspended, "spam"))
+	require.NoError(t, s.db.SetUser(user.Username, user))
+
+	// A session from before the account was suspended
+	sess := session.NewSession(session.NewMemoryStore(time.Hour))
+	sess.Data = make(session.Map)
+	require.NoError(t, AddSessionAccount(sess, user.Username))
+
+	r := httptest.NewRequest(http.MethodGet, "/connections", nil)
+	r = r.WithContext(context.WithValue(r.Context(), session.SessionKey, sess))
+	w := httptest.NewRecorder()
+
+	s.am.MustAuth(s.ConnectionsHandler())(w, r, nil)
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/login", w.Header().Get("Location"))
+	assert.Empty(t, SessionAccounts(sess))
+}
@@ -0,0 +1,183 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"git.mills.io/yarnsocial/yarn/internal/auth"
+	"git.mills.io/yarnsocial/yarn/internal/session"
+)
+
+const (
+	// sessionAccountsKey is the session key holding all accounts logged into
+	// a session. The active account is always held by the "username" key.
+	sessionAccountsKey = "accounts"
+
+	// maxSessionAccounts is the maximum number of accounts that can be
+	// logged into a single session
+	maxSessionAccounts = 8
+)
+
+var (
+	// ErrAccountNotInSession is returned when switching to an account that
+	// has not been logged into the session
+	ErrAccountNotInSession = errors.New("error: account not logged into session")
+
+	// ErrTooManyAccounts is returned when adding an account to a session that
+	// is already logged into the maximum number of accounts
+	ErrTooManyAccounts = errors.New("error: too many accounts logged into session")
+)
+
+// SessionAccounts returns all accounts logged into the session with the
+// active account first
+func SessionAccounts(sess *session.Session) []string {
+	var accounts []string
+
+	active, ok := sess.Get("username")
+	if !ok {
+		return nil
+	}
+	accounts = append(accounts, active)
+
+	if val, ok := sess.Get(sessionAccountsKey); ok {
+		for _, username := range strings.Split(val, ",") {
+			if username != "" && username != active {
+				accounts = append(accounts, username)
+			}
+		}
+	}
+
+	return accounts
+}
+
+func setSessionAccounts(sess *session.Session, accounts []string) error {
+	if len(accounts) == 0 {
+		if err := sess.Del(sessionAccountsKey); err != nil {
+			return err
+		}
+		return sess.Del("username")
+	}
+
+	if err := sess.Set(sessionAccountsKey, strings.Join(accounts, ",")); err != nil {
+		return err
+	}
+	return sess.Set("username", accounts[0])
+}
+
+// AddSessionAccount logs an account into the session and makes it the
+// active account
+func AddSessionAccount(sess *session.Session, username string) error {
+	accounts := []string{username}
+	for _, account := range SessionAccounts(sess) {
+		if account != username {
+			accounts = append(accounts, account)
+		}
+	}
+
+	if len(accounts) > maxSessionAccounts {
+		return ErrTooManyAccounts
+	}
+
+	return setSessionAccounts(sess, accounts)
+}
+
+// SwitchSessionAccount makes an account already logged into the session the
+// active account
+func SwitchSessionAccount(sess *session.Session, username string) error {
+	for _, account := range SessionAccounts(sess) {
+		if account == username {
+			return AddSessionAccount(sess, username)
+		}
+	}
+	return ErrAccountNotInSession
+}
+
+// RemoveSessionAccount logs an account out of the session. If the account
+// was the active account the next account (if any) becomes active.
+func RemoveSessionAccount(sess *session.Session, username string) error {
+	var accounts []string
+	for _, account := range SessionAccounts(sess) {
+		if account != username {
+			accounts = append(accounts, account)
+		}
+	}
+
+	return setSessionAccounts(sess, accounts)
+}
+
+// CheckSessionAccount returns the check used by the auth middleware which
+// logs accounts suspended or disabled by the Pod Owner/Operator (or deleted)
+// out of the session so they never reach handlers that require a user
+func CheckSessionAccount(db Store) auth.CheckFunc {
+	return func(sess *session.Session, username string) bool {
+		user, err := db.GetUser(username)
+		if err == nil && user.IsActive() {
+			return true
+		}
+		if err != nil && err != ErrUserNotFound {
+			log.WithError(err).Warnf("error loading user object for %s", username)
+			return false
+		}
+
+		if err := RemoveSessionAccount(sess, username); err != nil {
+			log.WithError(err).Warnf("error removing inactive account %s from session", username)
+		}
+		return false
+	}
+}
+
+// AccountsHandler lists the accounts logged into the session
+func (s *Server) AccountsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Title = s.tr(ctx, "PageAccountsTitle")
+		s.render("accounts", w, ctx)
+	}
+}
+
+// AddAccountHandler renders the login form to log another account into the
+// session
+func (s *Server) AddAccountHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Title = s.tr(ctx, "AccountsAddTitle")
+		ctx.AddAccount = true
+		ctx.Referer = "/"
+		s.render("login", w, ctx)
+	}
+}
+
+// SwitchAccountHandler switches the active account of the session
+func (s *Server) SwitchAccountHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		sess := r.Context().Value(session.SessionKey)
+		if sess == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		username := NormalizeUsername(r.FormValue("username"))
+		if err := SwitchSessionAccount(sess.(*session.Session), username); err != nil {
+			log.WithError(err).Warnf("error switching session account to %s", username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorSwitchAccount")
+			s.render("error", w, ctx)
+			return
+		}
+
+		// Forms rendered for the previous account must not be submitted on
+		// behalf of the new active account
+		s.csrf.RegenerateToken(w, r)
+
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
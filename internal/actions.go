@@ -0,0 +1,89 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// Action is an action of the web UI that can be run from the command palette
+// or with a keyboard shortcut. Actions either navigate to URL or, for actions
+// on the selected twt, trigger the element matching Selector of the twt (the
+// same controls as the HTML forms) with {hash} in URL replaced by its hash.
+type Action struct {
+	ID       string `json:"id"`
+	Title    string `json:"title"`
+	Key      string `json:"key,omitempty"`
+	URL      string `json:"url,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	Twt      bool   `json:"twt,omitempty"`
+}
+
+// actionsFor returns the actions available to the user of a request
+func (s *Server) actionsFor(ctx *Context) []Action {
+	actions := []Action{
+		{ID: "palette", Title: s.tr(ctx, "ActionPalette"), Key: "?"},
+		{ID: "search", Title: s.tr(ctx, "ActionSearch"), Key: "/"},
+		{ID: "next", Title: s.tr(ctx, "ActionNextTwt"), Key: "j"},
+		{ID: "prev", Title: s.tr(ctx, "ActionPrevTwt"), Key: "k"},
+		{ID: "timeline", Title: s.tr(ctx, "NavTimeline"), URL: "/"},
+		{ID: "permalink", Title: s.tr(ctx, "ActionPermalink"), Key: "o", URL: "/twt/{hash}", Twt: true},
+	}
+
+	if !ctx.Authenticated {
+		actions = append(actions, Action{ID: "login", Title: s.tr(ctx, "NavLogin"), URL: "/login"})
+		if s.config().OpenRegistrations {
+			actions = append(actions, Action{ID: "register", Title: s.tr(ctx, "NavRegister"), URL: "/register"})
+		}
+		return actions
+	}
+
+	actions = append(actions, []Action{
+		{ID: "reply", Title: s.tr(ctx, "TwtReplyLinkTitle"), Key: "r", Selector: "[data-reply]", Twt: true},
+		{ID: "bookmark", Title: s.tr(ctx, "ActionBookmark"), Key: "b", Selector: ".bookmarkBtn, .unbookmarkBtn", Twt: true},
+		{ID: "discover", Title: s.tr(ctx, "NavDiscover"), URL: "/discover"},
+		{ID: "mentions", Title: s.tr(ctx, "NavMentions"), URL: "/mentions"},
+		{ID: "summary", Title: s.tr(ctx, "SummaryTitle"), URL: "/summary"},
+		{ID: "webmentions", Title: s.tr(ctx, "WebMentionsTitle"), URL: "/webmentions"},
+		{ID: "feeds", Title: s.tr(ctx, "NavFeeds"), URL: "/feeds"},
+		{ID: "profile", Title: s.tr(ctx, "ActionProfile"), URL: fmt.Sprintf("/user/%s/", ctx.Username)},
+		{ID: "bookmarks", Title: s.tr(ctx, "ActionBookmarks"), URL: fmt.Sprintf("/user/%s/bookmarks", ctx.Username)},
+		{ID: "settings", Title: s.tr(ctx, "NavSettings"), URL: "/settings"},
+		{ID: "lite", Title: s.tr(ctx, "ActionLite"), URL: litePrefix},
+	}...)
+
+	if ctx.IsAdmin {
+		actions = append(actions, []Action{
+			{ID: "manage_pod", Title: s.tr(ctx, "ActionManagePod"), URL: "/manage/pod"},
+			{ID: "manage_users", Title: s.tr(ctx, "ActionManageUsers"), URL: "/manage/users"},
+		}...)
+	}
+
+	return append(actions, Action{ID: "logout", Title: s.tr(ctx, "NavLogout"), URL: "/logout"})
+}
+
+// ActionsHandler lists the actions of the web UI available to the user for
+// the command palette and keyboard shortcuts
+func (s *Server) ActionsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Translate(s.translator)
+
+		data, err := json.Marshal(s.actionsFor(ctx))
+		if err != nil {
+			log.WithError(err).Error("error serializing actions response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "private, no-cache")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,435 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+const announcementsFile = "announcements.json"
+
+// AnnouncementTypes are the types (styles) of announcements
+var AnnouncementTypes = []string{"safe", "warn", "panic", "update"}
+
+var (
+	// ErrInvalidAnnouncement is returned when an announcement has no message
+	// or ends before it starts
+	ErrInvalidAnnouncement = errors.New("error: invalid announcement")
+
+	// ErrAnnouncementNotFound is returned for an unknown announcement
+	ErrAnnouncementNotFound = errors.New("error: announcement not found")
+)
+
+// Announcement is an announcement by the Pod Owner/Operator shown as a banner
+// between StartsAt and EndsAt (if set) and optionally posted as a twt from
+// the @announcements feed when it starts
+type Announcement struct {
+	ID        string    `json:"id"`
+	Type      string    `json:"type"`
+	Message   string    `json:"message"`
+	Guests    bool      `json:"guests"`
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at,omitempty"`
+	PostTwt   bool      `json:"post_twt"`
+	Twt       string    `json:"twt,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// IsActive returns true if the announcement is shown at the given time
+func (a *Announcement) IsActive(now time.Time) bool {
+	return !now.Before(a.StartsAt) && (a.EndsAt.IsZero() || now.Before(a.EndsAt))
+}
+
+// IsScheduled returns true if the announcement starts after the given time
+func (a *Announcement) IsScheduled(now time.Time) bool {
+	return now.Before(a.StartsAt)
+}
+
+// IsExpired returns true if the announcement ended before the given time
+func (a *Announcement) IsExpired(now time.Time) bool {
+	return !a.EndsAt.IsZero() && !now.Before(a.EndsAt)
+}
+
+// Status returns whether the announcement is scheduled, active or expired
+func (a *Announcement) Status() string {
+	now := time.Now()
+	switch {
+	case a.IsScheduled(now):
+		return "scheduled"
+	case a.IsExpired(now):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+// ParseAnnouncementType parses the type of an announcement defaulting to safe
+func ParseAnnouncementType(s string) string {
+	for _, t := range AnnouncementTypes {
+		if t == s {
+			return t
+		}
+	}
+	return "safe"
+}
+
+// Announcements holds the Pod's announcements and is persisted in the data
+// directory. A nil *Announcements has no announcements.
+type Announcements struct {
+	sync.RWMutex
+
+	conf          *Config
+	announcements map[string]*Announcement
+}
+
+// NewAnnouncements ...
+func NewAnnouncements(conf *Config) (*Announcements, error) {
+	as := &Announcements{
+		conf:          conf,
+		announcements: make(map[string]*Announcement),
+	}
+
+	data, err := ioutil.ReadFile(as.filename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return as, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &as.announcements); err != nil {
+		return nil, err
+	}
+
+	return as, nil
+}
+
+func (as *Announcements) filename() string {
+	return filepath.Join(as.conf.Data, announcementsFile)
+}
+
+func (as *Announcements) save() error {
+	data, err := json.Marshal(as.announcements)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(as.filename(), data, 0644)
+}
+
+// Add adds a new announcement, announcements without a start start now
+func (as *Announcements) Add(a *Announcement) error {
+	a.Message = strings.TrimSpace(a.Message)
+	if a.Message == "" {
+		return ErrInvalidAnnouncement
+	}
+
+	a.ID = GenerateRandomToken()
+	a.Type = ParseAnnouncementType(a.Type)
+	a.CreatedAt = time.Now()
+	if a.StartsAt.IsZero() {
+		a.StartsAt = a.CreatedAt
+	}
+	if !a.EndsAt.IsZero() && !a.EndsAt.After(a.StartsAt) {
+		return ErrInvalidAnnouncement
+	}
+
+	as.Lock()
+	defer as.Unlock()
+
+	as.announcements[a.ID] = a
+
+	return as.save()
+}
+
+// Delete removes an announcement
+func (as *Announcements) Delete(id string) error {
+	as.Lock()
+	defer as.Unlock()
+
+	if _, ok := as.announcements[id]; !ok {
+		return ErrAnnouncementNotFound
+	}
+	delete(as.announcements, id)
+
+	return as.save()
+}
+
+// Has returns true if an announcement with the given id exists
+func (as *Announcements) Has(id string) bool {
+	if as == nil {
+		return false
+	}
+
+	as.RLock()
+	defer as.RUnlock()
+
+	_, ok := as.announcements[id]
+	return ok
+}
+
+// SetTwt records the hash of the twt an announcement was posted as
+func (as *Announcements) SetTwt(id, hash string) error {
+	as.Lock()
+	defer as.Unlock()
+
+	a, ok := as.announcements[id]
+	if !ok {
+		return ErrAnnouncementNotFound
+	}
+	a.Twt = hash
+
+	return as.save()
+}
+
+// List returns all announcements, the latest first
+func (as *Announcements) List() []*Announcement {
+	if as == nil {
+		return nil
+	}
+
+	as.RLock()
+	defer as.RUnlock()
+
+	announcements := make([]*Announcement, 0, len(as.announcements))
+	for _, a := range as.announcements {
+		announcements = append(announcements, a)
+	}
+	sort.Slice(announcements, func(i, j int) bool {
+		return announcements[i].StartsAt.After(announcements[j].StartsAt)
+	})
+
+	return announcements
+}
+
+// Active returns the active announcements the user (nil for anonymous
+// visitors) has not dismissed
+func (as *Announcements) Active(user *User, now time.Time) []*Announcement {
+	var active []*Announcement
+	for _, a := range as.List() {
+		if !a.IsActive(now) {
+			continue
+		}
+		if user == nil || user.IsZero() {
+			if !a.Guests {
+				continue
+			}
+		} else if _, dismissed := user.DismissedAnnouncements[a.ID]; dismissed {
+			continue
+		}
+		active = append(active, a)
+	}
+	return active
+}
+
+// Unposted returns the active announcements to be posted as twts which have
+// not been posted yet
+func (as *Announcements) Unposted(now time.Time) []*Announcement {
+	var unposted []*Announcement
+	for _, a := range as.List() {
+		if a.PostTwt && a.Twt == "" && a.IsActive(now) {
+			unposted = append(unposted, a)
+		}
+	}
+	return unposted
+}
+
+// MigrateAlert replaces the single alert of older pod settings with an
+// announcement, returns true if the settings changed
+func (as *Announcements) MigrateAlert(conf *Config) (bool, error) {
+	if conf.AlertMessage == "" {
+		return false, nil
+	}
+
+	if err := as.Add(&Announcement{
+		Type:    conf.AlertType,
+		Message: conf.AlertMessage,
+		Guests:  conf.AlertGuest,
+	}); err != nil {
+		return false, err
+	}
+
+	conf.AlertGuest = false
+	conf.AlertMessage = ""
+	conf.AlertType = ""
+
+	return true, nil
+}
+
+// PublishAnnouncements posts the active announcements to be posted as twts
+// from the @announcements feed
+func PublishAnnouncements(conf *Config, cache *Cache, db Store) error {
+	pending := announcements.Unposted(time.Now())
+	if len(pending) == 0 {
+		return nil
+	}
+
+	adminUser, err := db.GetUser(conf.AdminUser)
+	if err != nil {
+		return err
+	}
+
+	feed, err := db.GetFeed(announcementsSpecialUser)
+	if err != nil {
+		return err
+	}
+
+	appendTwt := AppendTwtFactory(conf, cache, db)
+
+	for _, a := range pending {
+		twt, err := appendTwt(adminUser, feed, CleanTwt(a.Message))
+		if err != nil {
+			return err
+		}
+		feedURL := conf.URLForUser(feed.Name)
+		PublishTwts(conf, nil, adminUser, feedURL, string(VisibilityPublic), twt)
+		cache.InjectFeed(feedURL, twt)
+
+		if err := announcements.SetTwt(a.ID, twt.Hash()); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseAnnouncementTime parses the time of a datetime-local input in the
+// given timezone, returning the zero time if empty or invalid
+func parseAnnouncementTime(s string, loc *time.Location) time.Time {
+	t, err := time.ParseInLocation("2006-01-02T15:04", strings.TrimSpace(s), loc)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// ManageAnnouncementsHandler lists and publishes the Pod's announcements
+func (s *Server) ManageAnnouncementsHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			ctx.Title = s.tr(ctx, "PageManageAnnouncementsTitle")
+			ctx.AllAnnouncements = announcements.List()
+			s.render("manageAnnouncements", w, ctx)
+			return
+		}
+
+		loc, err := time.LoadLocation(ctx.User.DisplayDatesInTimezone)
+		if err != nil {
+			loc = time.UTC
+		}
+
+		a := &Announcement{
+			Type:     r.FormValue("type"),
+			Message:  r.FormValue("message"),
+			Guests:   r.FormValue("guests") == "on",
+			StartsAt: parseAnnouncementTime(r.FormValue("startsAt"), loc),
+			EndsAt:   parseAnnouncementTime(r.FormValue("endsAt"), loc),
+			PostTwt:  r.FormValue("postTwt") == "on",
+		}
+
+		if err := announcements.Add(a); err != nil {
+			log.WithError(err).Error("error adding announcement")
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorInvalidAnnouncement")
+			s.render("error", w, ctx)
+			return
+		}
+
+		// Post announcements that start straight away without waiting for
+		// the PublishAnnouncements job
+		if a.PostTwt && a.IsActive(time.Now()) {
+			if _, err := s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityBackground, func() error {
+				return PublishAnnouncements(s.config(), s.cache, s.db)
+			}); err != nil {
+				log.WithError(err).Warn("error submitting task to publish announcements")
+			}
+		}
+
+		http.Redirect(w, r, "/manage/announcements", http.StatusFound)
+	}
+}
+
+// DelAnnouncementHandler deletes one of the Pod's announcements
+func (s *Server) DelAnnouncementHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		id := r.FormValue("id")
+		if err := announcements.Delete(id); err != nil {
+			log.WithError(err).Errorf("error deleting announcement %s", id)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorDeletingAnnouncement")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/announcements", http.StatusFound)
+	}
+}
+
+// DismissAnnouncementHandler hides an announcement from the user, dismissed
+// announcements that no longer exist are forgotten
+func (s *Server) DismissAnnouncementHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		id := p.ByName("id")
+		if !announcements.Has(id) {
+			http.Error(w, "Announcement Not Found", http.StatusNotFound)
+			return
+		}
+
+		user := ctx.User
+		if user.DismissedAnnouncements == nil {
+			user.DismissedAnnouncements = make(map[string]string)
+		}
+		for dismissed := range user.DismissedAnnouncements {
+			if !announcements.Has(dismissed) {
+				delete(user.DismissedAnnouncements, dismissed)
+			}
+		}
+		user.DismissedAnnouncements[id] = time.Now().Format(time.RFC3339)
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error dismissing announcement for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, RedirectRefererURL(r, s.config(), "/"), http.StatusFound)
+	}
+}
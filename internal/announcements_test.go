@@ -0,0 +1,69 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAnnouncementsActive(t *testing.T) {
+	as, err := NewAnnouncements(&Config{Data: t.TempDir()})
+	require.NoError(t, err)
+
+	now := time.Now()
+
+	members := &Announcement{Message: "Maintenance tonight", PostTwt: true}
+	guests := &Announcement{Message: "Welcome!", Guests: true}
+	scheduled := &Announcement{Message: "Soon", StartsAt: now.Add(time.Hour)}
+	require.NoError(t, as.Add(members))
+	require.NoError(t, as.Add(guests))
+	require.NoError(t, as.Add(scheduled))
+	assert.Error(t, as.Add(&Announcement{Message: "  "}))
+
+	assert.Len(t, as.Active(&User{Username: "alice"}, now.Add(time.Second)), 2)
+	assert.Equal(t, []*Announcement{guests}, as.Active(&User{}, now.Add(time.Second)))
+	assert.Len(t, as.Active(&User{Username: "alice"}, now.Add(2*time.Hour)), 3)
+
+	// Dismissed announcements are no longer shown to the user
+	user := &User{Username: "alice", DismissedAnnouncements: map[string]string{members.ID: ""}}
+	assert.Equal(t, []*Announcement{guests}, as.Active(user, now.Add(time.Second)))
+
+	assert.Equal(t, []*Announcement{members}, as.Unposted(now.Add(time.Second)))
+	require.NoError(t, as.SetTwt(members.ID, "abcdefg"))
+	assert.Empty(t, as.Unposted(now.Add(time.Second)))
+
+	// Announcements are persisted
+	reloaded, err := NewAnnouncements(as.conf)
+	require.NoError(t, err)
+	assert.Len(t, reloaded.List(), 3)
+}
+
+func TestAnnouncementsMigrateAlert(t *testing.T) {
+	conf := &Config{Data: t.TempDir()}
+	as, err := NewAnnouncements(conf)
+	require.NoError(t, err)
+
+	changed, err := as.MigrateAlert(conf)
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	conf.AlertMessage = "We are moving!"
+	conf.AlertType = "warn"
+	conf.AlertGuest = true
+
+	changed, err = as.MigrateAlert(conf)
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Empty(t, conf.AlertMessage)
+
+	list := as.List()
+	require.Len(t, list, 1)
+	assert.Equal(t, "We are moving!", list[0].Message)
+	assert.Equal(t, "warn", list[0].Type)
+	assert.True(t, list[0].Guests)
+}
@@ -4,6 +4,7 @@
 package internal
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -33,6 +34,7 @@ type ContextKey int
 const (
 	TokenContextKey ContextKey = iota
 	UserContextKey
+	RequestIDContextKey
 )
 
 var (
@@ -55,17 +57,34 @@ type Token struct {
 // API ...
 type API struct {
 	router  *Router
-	config  *Config
+	config  func() *Config
 	cache   *Cache
 	archive Archiver
 	db      Store
 	pm      passwords.Passwords
 	tasks   *Dispatcher
+
+	translator *Translator
+
+	// reload reloads the pod's settings (see Server.Reload)
+	reload func() error
+
+	// handles resolves nick@domain handles (see Server.handles)
+	handles *HandleResolver
 }
 
 // NewAPI ...
-func NewAPI(router *Router, config *Config, cache *Cache, archive Archiver, db Store, pm passwords.Passwords, tasks *Dispatcher) *API {
-	api := &API{router, config, cache, archive, db, pm, tasks}
+func NewAPI(router *Router, config *Config, cache *Cache, archive Archiver, db Store, pm passwords.Passwords, tasks *Dispatcher, translator *Translator) *API {
+	api := &API{
+		router:     router,
+		config:     func() *Config { return config },
+		cache:      cache,
+		archive:    archive,
+		db:         db,
+		pm:         pm,
+		tasks:      tasks,
+		translator: translator,
+	}
 
 	api.initRoutes()
 
@@ -73,40 +92,80 @@ func NewAPI(router *Router, config *Config, cache *Cache, archive Archiver, db S
 }
 
 func (a *API) initRoutes() {
-	router := a.router.Group("/api/v1")
+	router := a.router.Group("/api/v1", a.validated, a.metered)
 
 	router.GET("/ping", a.PingEndpoint())
+	router.GET("/spec.json", a.SpecEndpoint())
 	router.POST("/auth", a.AuthEndpoint())
 	router.POST("/register", a.RegisterEndpoint())
 	router.GET("/config", a.PodConfigEndpoint())
+	router.GET("/emoji", a.EmojiEndpoint())
+	router.GET("/langs", a.LangsEndpoint())
+	router.POST("/validate", a.ValidateEndpoint())
 
 	router.POST("/post", a.isAuthorized(a.PostEndpoint()))
+	router.POST("/preview", a.isAuthorized(a.PreviewEndpoint()))
 	router.POST("/upload", a.isAuthorized(a.UploadMediaEndpoint()))
+	router.POST("/mail", a.isAuthorized(a.MailEndpoint()))
 
 	router.GET("/settings", a.isAuthorized(a.SettingsEndpoint()))
 	router.POST("/settings", a.isAuthorized(a.SettingsEndpoint()))
 
+	router.GET("/feeds/:name", a.isAuthorized(a.FeedEndpoint()))
+	router.POST("/feeds/:name", a.isAuthorized(a.FeedEndpoint()))
+
 	router.POST("/follow", a.isAuthorized(a.FollowEndpoint()))
 	router.POST("/unfollow", a.isAuthorized(a.UnfollowEndpoint()))
+	router.GET("/follow-requests", a.isAuthorized(a.FollowRequestsEndpoint()))
+	router.GET("/connections", a.isAuthorized(a.ConnectionsEndpoint()))
+	router.POST("/follow-requests", a.isAuthorized(a.FollowRequestEndpoint()))
 
 	router.POST("/mute", a.isAuthorized(a.MuteEndpoint()))
 	router.POST("/unmute", a.isAuthorized(a.UnmuteEndpoint()))
 
+	router.GET("/read-positions", a.isAuthorized(a.ReadPositionsEndpoint()))
+	router.POST("/read-positions", a.isAuthorized(a.ReadPositionsEndpoint()))
+
 	router.POST("/timeline", a.isAuthorized(a.TimelineEndpoint()))
 	router.POST("/discover", a.DiscoverEndpoint())
 
 	router.GET("/profile", a.ProfileEndpoint())
 	router.GET("/profile/:username", a.ProfileEndpoint())
 	router.POST("/fetch-twts", a.FetchTwtsEndpoint())
+	router.POST("/fetch-media", a.FetchMediaEndpoint())
 	router.POST("/conv", a.ConversationEndpoint())
+	router.POST("/tag/:tag", a.TagEndpoint())
+	router.GET("/twt/:hash/history", a.TwtHistoryEndpoint())
 
 	router.POST("/external", a.ExternalProfileEndpoint())
+	router.POST("/feed-stats", a.FeedStatsEndpoint())
+	router.GET("/directory", a.FeedDirectoryEndpoint())
+	router.POST("/twters", a.TwtersEndpoint())
+	router.POST("/languages", a.LanguagesEndpoint())
+
+	// Read-only public endpoints (no authentication, CORS enabled)
+	public := router.Group("/public", a.public)
+	public.GET("/discover", a.PublicDiscoverEndpoint())
+	public.GET("/profile/:username", a.PublicProfileEndpoint())
+	public.GET("/profile/:username/twts", a.PublicProfileTwtsEndpoint())
+	public.GET("/profile/:username/media", a.PublicProfileMediaEndpoint())
+	public.GET("/twt/:hash", a.PublicTwtEndpoint())
+	public.GET("/conv/:hash", a.PublicConversationEndpoint())
+	public.GET("/tag/:tag", a.PublicTagEndpoint())
 
 	router.POST("/mentions", a.isAuthorized(a.MentionsEndpoint()))
 
+	router.POST("/bookmarks", a.isAuthorized(a.BookmarksEndpoint()))
+	router.POST("/bookmark", a.isAuthorized(a.BookmarkEndpoint()))
+
 	// WebSub (debugging)
 	router.GET("/websub", a.isAuthorized(a.WebSubEndpoint()))
 
+	// Pod management
+	router.POST("/manage/reload", a.isAuthorized(a.ReloadEndpoint()))
+	router.GET("/admin/jobs", a.isAuthorized(a.AdminJobsEndpoint()))
+	router.POST("/admin/jobs/:name/:action", a.isAuthorized(a.AdminJobEndpoint()))
+
 	// Support / Report endpoints
 	router.POST("/support", a.isAuthorized(a.SupportEndpoint()))
 	router.POST("/report", a.isAuthorized(a.ReportEndpoint()))
@@ -118,15 +177,15 @@ func (a *API) CreateToken(user *User, r *http.Request) (*Token, error) {
 	claims["username"] = user.Username
 	createdAt := time.Now()
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(a.config.APISigningKey))
+	tokenString, err := token.SignedString([]byte(a.config().APISigningKey))
 	if err != nil {
-		log.WithError(err).Error("error creating signed token")
+		apiLogger(r).WithError(err).Error("error creating signed token")
 		return nil, err
 	}
 
 	signedToken, err := jwt.Parse(tokenString, a.jwtKeyFunc)
 	if err != nil {
-		log.WithError(err).Error("error creating signed token")
+		apiLogger(r).WithError(err).Error("error creating signed token")
 		return nil, err
 	}
 
@@ -140,11 +199,21 @@ func (a *API) CreateToken(user *User, r *http.Request) (*Token, error) {
 	return tkn, nil
 }
 
+// apiLogger returns the API logger annotated with the request's ID
+func apiLogger(r *http.Request) *log.Entry {
+	return RequestLogger(r.Context(), LogAPI)
+}
+
 func (a *API) jwtKeyFunc(token *jwt.Token) (interface{}, error) {
 	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 		return nil, fmt.Errorf("there was an error")
 	}
-	return []byte(a.config.APISigningKey), nil
+	// API tokens have no type, typed tokens (e.g: IndieAuth access tokens)
+	// are limited to their own endpoints
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && claims["typ"] != nil {
+		return nil, fmt.Errorf("unexpected token type: %v", claims["typ"])
+	}
+	return []byte(a.config().APISigningKey), nil
 }
 
 func (a *API) getLoggedInUser(r *http.Request) *User {
@@ -163,7 +232,7 @@ func (a *API) getLoggedInUser(r *http.Request) *User {
 
 	user, err := a.db.GetUser(username)
 	if err != nil {
-		log.WithError(err).Error("error loading user object")
+		apiLogger(r).WithError(err).Error("error loading user object")
 		return nil
 	}
 
@@ -181,14 +250,14 @@ func (a *API) getLoggedInUser(r *http.Request) *User {
 func (a *API) isAuthorized(endpoint httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		if r.Header.Get("Token") == "" {
-			http.Error(w, "No Token Provided", http.StatusUnauthorized)
+			apiError(w, http.StatusUnauthorized, ErrCodeMissingToken, "No Token Provided")
 			return
 		}
 
 		token, err := jwt.Parse(r.Header.Get("Token"), a.jwtKeyFunc)
 		if err != nil {
-			log.WithError(err).Error("error parsing token")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing token")
+			apiError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid Token")
 			return
 		}
 
@@ -199,8 +268,13 @@ func (a *API) isAuthorized(endpoint httprouter.Handle) httprouter.Handle {
 
 			user, err := a.db.GetUser(username)
 			if err != nil {
-				log.WithError(err).Error("error loading user object")
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error loading user object")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+				return
+			}
+
+			if !user.IsActive() {
+				apiError(w, http.StatusForbidden, ErrCodeAccountInactive, "Account Inactive", user.AccountState())
 				return
 			}
 
@@ -215,14 +289,14 @@ func (a *API) isAuthorized(endpoint httprouter.Handle) httprouter.Handle {
 			ctx = context.WithValue(ctx, UserContextKey, user)
 
 			// TODO: Use event sourcing for this?
-			user.LastSeenAt = time.Now().Round(24 * time.Hour)
+			user.Seen()
 			if err := a.db.SetUser(user.Username, user); err != nil {
-				log.WithError(err).Warnf("error updating user.LastSeenAt for %s", user.Username)
+				apiLogger(r).WithError(err).Warnf("error updating user.LastSeenAt for %s", user.Username)
 			}
 
 			endpoint(w, r.WithContext(ctx), p)
 		} else {
-			http.Error(w, "Invalid Token", http.StatusUnauthorized)
+			apiError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid Token")
 			return
 		}
 	}
@@ -241,8 +315,8 @@ func (a *API) RegisterEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		req, err := types.NewRegisterRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing register request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing register request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -251,32 +325,32 @@ func (a *API) RegisterEndpoint() httprouter.Handle {
 		// XXX: We DO NOT store this! (EVER)
 		email := strings.TrimSpace(req.Email)
 
-		if err := ValidateUsername(username); err != nil {
-			http.Error(w, "Bad Username", http.StatusBadRequest)
+		if err := a.config().ValidateUsername(username); err != nil {
+			apiError(w, http.StatusBadRequest, ErrCodeInvalidUsername, "Bad Username", err.Error())
 			return
 		}
 
 		if a.db.HasUser(username) || a.db.HasFeed(username) {
-			http.Error(w, "Username Exists", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeUsernameExists, "Username Exists")
 			return
 		}
 
-		fn := filepath.Join(a.config.Data, feedsDir, username)
+		fn := filepath.Join(a.config().Data, feedsDir, username)
 		if _, err := os.Stat(fn); err == nil {
-			http.Error(w, "Feed Exists", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeFeedExists, "Feed Exists")
 			return
 		}
 
 		if err := ioutil.WriteFile(fn, []byte{}, 0644); err != nil {
-			log.WithError(err).Error("error creating new user feed")
-			http.Error(w, "Feed Creation Failed", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error creating new user feed")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Feed Creation Failed")
 			return
 		}
 
 		hash, err := a.pm.CreatePassword(password)
 		if err != nil {
-			log.WithError(err).Error("error creating password hash")
-			http.Error(w, "Passwrod Creation Failed", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error creating password hash")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Password Creation Failed")
 			return
 		}
 
@@ -286,13 +360,13 @@ func (a *API) RegisterEndpoint() httprouter.Handle {
 			Username:  username,
 			Password:  hash,
 			Recovery:  recoveryHash,
-			URL:       URLForUser(a.config.BaseURL, username),
+			URL:       URLForUser(a.config().BaseURL, username),
 			CreatedAt: time.Now(),
 		}
 
 		if err := a.db.SetUser(username, user); err != nil {
-			log.WithError(err).Error("error saving user object for new user")
-			http.Error(w, "User Creation Failed", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error saving user object for new user")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "User Creation Failed")
 			return
 		}
 	}
@@ -306,8 +380,8 @@ func (a *API) AuthEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		req, err := types.NewAuthRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing auth request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing auth request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -316,21 +390,21 @@ func (a *API) AuthEndpoint() httprouter.Handle {
 
 		// Error: no username or password provided
 		if username == "" || password == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		// Lookup user
 		user, err := a.db.GetUser(username)
 		if err != nil {
-			log.WithField("username", username).Warn("login attempt from non-existent user")
-			http.Error(w, "Invalid Credentials", http.StatusUnauthorized)
+			apiLogger(r).WithField("username", username).Warn("login attempt from non-existent user")
+			apiError(w, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Invalid Credentials")
 			return
 		}
 
 		// #239: Throttle failed login attempts and lock user  account.
 		if failures.Get(user.Username) > MaxFailedLogins {
-			http.Error(w, "Account Locked", http.StatusTooManyRequests)
+			apiError(w, http.StatusTooManyRequests, ErrCodeAccountLocked, "Account Locked")
 			return
 		}
 
@@ -341,21 +415,26 @@ func (a *API) AuthEndpoint() httprouter.Handle {
 			failed := failures.Inc(user.Username)
 			time.Sleep(time.Duration(IntPow(2, failed)) * time.Second)
 
-			log.WithField("username", username).Warn("login attempt with invalid credentials")
-			http.Error(w, "Invalid Credentials", http.StatusUnauthorized)
+			apiLogger(r).WithField("username", username).Warn("login attempt with invalid credentials")
+			apiError(w, http.StatusUnauthorized, ErrCodeInvalidCredentials, "Invalid Credentials")
 			return
 		}
 
 		// #239: Throttle failed login attempts and lock user  account.
 		failures.Reset(user.Username)
 
+		if !user.IsActive() {
+			apiError(w, http.StatusForbidden, ErrCodeAccountInactive, "Account Inactive", user.AccountState())
+			return
+		}
+
 		// Login successful
-		log.WithField("username", username).Info("login successful")
+		apiLogger(r).WithField("username", username).Info("login successful")
 
 		token, err := a.CreateToken(user, r)
 		if err != nil {
-			log.WithError(err).Error("error creating token")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error creating token")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -363,8 +442,8 @@ func (a *API) AuthEndpoint() httprouter.Handle {
 
 		body, err := res.Bytes()
 		if err != nil {
-			log.WithError(err).Error("error serializing response")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error serializing response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -375,58 +454,95 @@ func (a *API) AuthEndpoint() httprouter.Handle {
 
 // PostEndpoint ...
 func (a *API) PostEndpoint() httprouter.Handle {
-	appendTwt := AppendTwtFactory(a.config, a.cache, a.db)
+	appendTwt := AppendTwtFactory(a.config(), a.cache, a.db)
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		user := r.Context().Value(UserContextKey).(*User)
 
-		req, err := types.NewPostRequest(r.Body)
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error reading post request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		req, err := types.NewPostRequest(bytes.NewReader(body))
 		if err != nil {
-			log.WithError(err).Error("error parsing post request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing post request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
+		// The visibility of the twt and whether to split a twt that is too
+		// long into a thread are extensions of types.PostRequest
+		var opts struct {
+			Visibility string `json:"visibility"`
+			Thread     bool   `json:"thread"`
+		}
+		_ = json.Unmarshal(body, &opts)
+
 		text := CleanTwt(req.Text)
 		if text == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
-		var sources types.FetchFeedRequests
+		thread, err := SplitTwt(text, a.config().MaxTwtLength, a.config().TwtHashLength)
+		if err != nil {
+			apiError(w, http.StatusBadRequest, ErrCodeTwtTooLong, "Twt is too long to split into a thread")
+			return
+		}
+		if thread.IsThread() && !opts.Thread {
+			apiError(w, http.StatusBadRequest, ErrCodeTwtTooLong, "Twt is too long, post it as a thread", map[string]interface{}{
+				"max_length": a.config().MaxTwtLength,
+				"thread":     thread.Parts,
+			})
+			return
+		}
+
+		var (
+			sources types.FetchFeedRequests
+			twts    types.Twts
+			feedURL string
+		)
 
 		switch req.PostAs {
 		case "", me:
 			sources = user.Source()
-			_, err = appendTwt(user, nil, text)
+			feedURL = a.config().URLForUser(user.Username)
+			twts, err = PostThread(appendTwt, user, nil, thread)
 		default:
 			if user.OwnsFeed(req.PostAs) {
 				feed, feedErr := a.db.GetFeed(req.PostAs)
 				if feedErr != nil {
-					log.WithError(err).Error("error posting twt")
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					apiLogger(r).WithError(err).Error("error posting twt")
+					apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 					return
 				}
 				sources = feed.Source()
+				feedURL = a.config().URLForUser(feed.Name)
 
-				_, err = appendTwt(user, feed, text)
+				twts, err = PostThread(appendTwt, user, feed, thread)
 			} else {
 				err = ErrFeedImposter
 			}
 		}
 
 		if err != nil {
-			log.WithError(err).Error("error posting twt")
+			apiLogger(r).WithError(err).Error("error posting twt")
 			if err == ErrFeedImposter {
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				apiError(w, http.StatusUnauthorized, ErrCodeFeedImposter, "You do not own this feed")
 			} else {
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			}
 			return
 		}
 
+		// WebSub and WebMentions ... (local-only twts never leave the Pod)
+		PublishTwts(a.config(), a.tasks, user, feedURL, opts.Visibility, twts...)
+
 		// Update user's own timeline with their own new post.
-		a.cache.FetchFeeds(a.config, a.archive, sources, nil)
+		a.cache.FetchFeeds(a.config(), a.archive, sources, nil)
 
 		// Re-populate/Warm cache for User
 		a.cache.GetByUser(user, true)
@@ -437,28 +553,67 @@ func (a *API) PostEndpoint() httprouter.Handle {
 	}
 }
 
+// MailEndpoint accepts a raw email message (RFC 5322) and posts it as a twt
+// by the authenticated user.
+func (a *API) MailEndpoint() httprouter.Handle {
+	appendTwt := AppendTwtFactory(a.config(), a.cache, a.db)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, a.config().MaxUploadSize)
+		defer r.Body.Close()
+
+		m, err := ParseInboundMail(r.Body)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error parsing mail request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if err := PostInboundMail(a.config(), a.cache, a.tasks, appendTwt, user, m); err != nil {
+			apiLogger(r).WithError(err).Error("error posting twt from mail")
+			if err == ErrNoMailContent {
+				apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+				return
+			}
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
 // TimelineEndpoint ...
 func (a *API) TimelineEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		user := r.Context().Value(UserContextKey).(*User)
 
-		req, err := types.NewPagedRequest(r.Body)
+		req, err := NewTimelineRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing post request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing post request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if notModified(w, r, a.viewETag(user, "timeline", req.TimelineFilters, req.Page)) {
 			return
 		}
 
-		twts := a.cache.GetByUser(user, false)
+		twts := req.TimelineFilters.Filter(user, a.cache.GetByUser(user, false))
 
 		var pagedTwts types.Twts
 
-		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
 		pager.SetPage(req.Page)
 
 		if err = pager.Results(&pagedTwts); err != nil {
-			log.WithError(err).Error("error loading timeline")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error loading timeline")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -473,8 +628,8 @@ func (a *API) TimelineEndpoint() httprouter.Handle {
 
 		body, err := res.Bytes()
 		if err != nil {
-			log.WithError(err).Error("error serializing response")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error serializing response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -488,23 +643,85 @@ func (a *API) DiscoverEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		loggedInUser := a.getLoggedInUser(r)
 
-		req, err := types.NewPagedRequest(r.Body)
+		req, err := NewTimelineRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing post request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing post request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if notModified(w, r, a.viewETag(loggedInUser, "discover", DiscoverRankingFor(a.config(), loggedInUser), req.TimelineFilters, req.Languages, req.Page)) {
 			return
 		}
 
 		twts := a.cache.GetByUserView(loggedInUser, discoverViewKey, false)
+		twts = FilterTwtsByLanguage(req.Languages, twts)
+		twts = RankDiscover(a.config(), loggedInUser, req.TimelineFilters.Filter(loggedInUser, twts))
+
+		var pagedTwts types.Twts
+
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
+		pager.SetPage(req.Page)
+
+		if err = pager.Results(&pagedTwts); err != nil {
+			apiLogger(r).WithError(err).Error("error loading discover")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		res := types.PagedResponse{
+			Twts: pagedTwts,
+			Pager: types.PagerResponse{
+				Current:   pager.Page(),
+				MaxPages:  pager.PageNums(),
+				TotalTwts: pager.Nums(),
+			},
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// TagEndpoint returns the twts with a hashtag newest first
+func (a *API) TagEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		loggedInUser := a.getLoggedInUser(r)
+
+		req, err := types.NewPagedRequest(r.Body)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error parsing tag request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		tag := NormalizeTag(p.ByName("tag"))
+		if tag == "" {
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if notModified(w, r, a.viewETag(loggedInUser, "tag", tag, req.Page)) {
+			return
+		}
+
+		twts := a.cache.GetByUserView(loggedInUser, tagViewKey(tag), false)
 
 		var pagedTwts types.Twts
 
-		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
 		pager.SetPage(req.Page)
 
 		if err = pager.Results(&pagedTwts); err != nil {
-			log.WithError(err).Error("error loading discover")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error loading tag")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -519,8 +736,74 @@ func (a *API) DiscoverEndpoint() httprouter.Handle {
 
 		body, err := res.Bytes()
 		if err != nil {
-			log.WithError(err).Error("error serializing response")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error serializing response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(body)
+	}
+}
+
+// FetchMediaEndpoint returns the twts with media (images, audio, video) of a
+// local or cached external feed newest first, see FetchTwtsEndpoint
+func (a *API) FetchMediaEndpoint() httprouter.Handle {
+	isLocal := IsLocalURLFactory(a.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		loggedInUser := a.getLoggedInUser(r)
+
+		req, err := types.NewFetchTwtsRequest(r.Body)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error parsing fetch media request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		nick := NormalizeUsername(req.Nick)
+
+		var uri string
+		switch {
+		case req.URL != "" && !isLocal(req.URL):
+			uri = req.URL
+		case nick != "" && (a.db.HasUser(nick) || a.db.HasFeed(nick)):
+			uri = URLForUser(a.config().BaseURL, nick)
+		default:
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "User/Feed not found")
+			return
+		}
+
+		if notModified(w, r, a.viewETag(loggedInUser, "media", uri, req.Page)) {
+			return
+		}
+
+		twts := visibility.Filter(a.config(), loggedInUser, a.cache.GetByUserView(loggedInUser, mediaViewKey(uri), false))
+
+		var pagedTwts types.Twts
+
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
+		pager.SetPage(req.Page)
+
+		if err = pager.Results(&pagedTwts); err != nil {
+			apiLogger(r).WithError(err).Error("error loading media")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		res := types.PagedResponse{
+			Twts: pagedTwts,
+			Pager: types.PagerResponse{
+				Current:   pager.Page(),
+				MaxPages:  pager.PageNums(),
+				TotalTwts: pager.Nums(),
+			},
+		}
+
+		body, err := res.Bytes()
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -534,24 +817,28 @@ func (a *API) MentionsEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		req, err := types.NewPagedRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing post request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing post request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		user := r.Context().Value(UserContextKey).(*User)
 
+		if notModified(w, r, a.viewETag(user, "mentions", req.Page)) {
+			return
+		}
+
 		twts := a.cache.GetMentions(user, false)
 		sort.Sort(twts)
 
 		var pagedTwts types.Twts
 
-		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
 		pager.SetPage(req.Page)
 
 		if err = pager.Results(&pagedTwts); err != nil {
-			log.WithError(err).Error("error loading discover")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error loading discover")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -566,8 +853,8 @@ func (a *API) MentionsEndpoint() httprouter.Handle {
 
 		body, err := res.Bytes()
 		if err != nil {
-			log.WithError(err).Error("error serializing response")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error serializing response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -583,31 +870,72 @@ func (a *API) FollowEndpoint() httprouter.Handle {
 
 		req, err := types.NewFollowRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing follow request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing follow request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		nick := strings.TrimSpace(req.Nick)
 		url := NormalizeURL(req.URL)
 
+		// Follow by nick@domain handle given as the url (or nick)
+		handle := strings.TrimSpace(req.URL)
+		if _, _, ok := ParseHandle(handle); !ok {
+			handle = nick
+		}
+		if _, _, ok := ParseHandle(handle); ok {
+			resolvedNick, resolvedURL, err := a.handles.Resolve(handle)
+			if err != nil {
+				apiLogger(r).WithError(err).Warnf("error resolving handle %s", handle)
+				apiError(w, http.StatusBadRequest, ErrCodeInvalidFeed, "Invalid Feed")
+				return
+			}
+			if nick == "" || nick == handle {
+				nick = resolvedNick
+			}
+			url = resolvedURL
+		}
+
 		if nick == "" || url == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
-		if err := user.FollowAndValidate(a.config, nick, url); err != nil {
-			log.WithError(err).Errorf("error validating new feed @<%s %s>", nick, url)
-			http.Error(w, "Invalid Feed", http.StatusBadRequest)
+		requested, err := RequestFollow(a.config(), a.db, user, url)
+		if err != nil {
+			apiLogger(r).WithError(err).Errorf("error requesting to follow @<%s %s>", nick, url)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+		if requested {
+			// The owner of the protected account must approve the follow
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			_, _ = w.Write([]byte(`{"requested":true}`))
+			return
+		}
+
+		// External feeds never seen before are graylisted (See: Graylist)
+		seen := a.cache.IsCached(url)
+
+		if err := user.FollowAndValidate(a.config(), nick, url); err != nil {
+			apiLogger(r).WithError(err).Errorf("error validating new feed @<%s %s>", nick, url)
+			apiError(w, http.StatusBadRequest, ErrCodeInvalidFeed, "Invalid Feed")
 			return
 		}
 
 		if err := a.db.SetUser(user.Username, user); err != nil {
-			log.WithError(err).Error("error saving user object")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error saving user object")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
+		if !seen {
+			if err := graylist.Add(url, user.Username); err != nil {
+				apiLogger(r).WithError(err).Errorf("error graylisting feed %s", url)
+			}
+		}
+
 		a.cache.GetByUser(user, true)
 
 		// No real response
@@ -622,34 +950,35 @@ func (a *API) UnfollowEndpoint() httprouter.Handle {
 		req, err := types.NewUnfollowRequest(r.Body)
 
 		if err != nil {
-			log.WithError(err).Error("error parsing follow request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing follow request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		nick := req.Nick
 
 		if nick == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		user := r.Context().Value(UserContextKey).(*User)
 
 		if user == nil {
-			log.Fatalf("user not found in context")
+			apiError(w, http.StatusUnauthorized, ErrCodeInvalidToken, "Invalid Token")
+			return
 		}
 
 		if _, ok := user.Following[nick]; !ok {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		user.Unfollow(nick)
 
 		if err := a.db.SetUser(user.Username, user); err != nil {
-			log.WithError(err).Warnf("error updating user object for user  %s", user.Username)
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Warnf("error updating user object for user  %s", user.Username)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -665,7 +994,7 @@ func (a *API) UnfollowEndpoint() httprouter.Handle {
 func (a *API) SettingsEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		// Limit request body to to abuse
-		r.Body = http.MaxBytesReader(w, r.Body, a.config.MaxUploadSize)
+		r.Body = http.MaxBytesReader(w, r.Body, a.config().MaxUploadSize)
 		defer r.Body.Close()
 
 		user := r.Context().Value(UserContextKey).(*User)
@@ -673,7 +1002,7 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 		if r.Method == http.MethodGet {
 			data, err := json.Marshal(user)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 				return
 			}
 
@@ -692,16 +1021,16 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 
 		avatarFile, _, err := r.FormFile("avatar_file")
 		if err != nil && err != http.ErrMissingFile {
-			log.WithError(err).Error("error parsing form file")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error parsing form file")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
 		if password != "" {
 			hash, err := a.pm.CreatePassword(password)
 			if err != nil {
-				log.WithError(err).Error("error creating password hash")
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error creating password hash")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 				return
 			}
 
@@ -711,24 +1040,24 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 		if avatarFile != nil {
 			opts := &ImageOptions{
 				Resize: true,
-				Width:  a.config.AvatarResolution,
-				Height: a.config.AvatarResolution,
+				Width:  a.config().AvatarResolution,
+				Height: a.config().AvatarResolution,
 			}
 			_, err = StoreUploadedImage(
-				a.config, avatarFile,
+				a.config(), avatarFile,
 				avatarsDir, user.Username,
 				opts,
 			)
 			if err != nil {
-				log.WithError(err).Error("error updating user avatar")
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error updating user avatar")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 				return
 			}
-			avatarFn := filepath.Join(a.config.Data, avatarsDir, fmt.Sprintf("%s.png", user.Username))
+			avatarFn := filepath.Join(a.config().Data, avatarsDir, fmt.Sprintf("%s.png", user.Username))
 			if avatarHash, err := FastHashFile(avatarFn); err == nil {
 				user.AvatarHash = avatarHash
 			} else {
-				log.WithError(err).Warnf("error updating avatar hash for %s", user.Username)
+				apiLogger(r).WithError(err).Warnf("error updating avatar hash for %s", user.Username)
 			}
 		}
 
@@ -747,8 +1076,8 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 		user.IsFollowingPubliclyVisible = isFollowingPubliclyVisible
 
 		if err := a.db.SetUser(user.Username, user); err != nil {
-			log.WithError(err).Error("error updating user object")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error updating user object")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
@@ -763,30 +1092,32 @@ func (a *API) SettingsEndpoint() httprouter.Handle {
 // XXX: Used for Goryon < v1.0.3
 func (a *API) OldUploadMediaEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		metrics.Counter("api", "old_upload_media").Inc()
+
 		// Limit request body to to abuse
-		r.Body = http.MaxBytesReader(w, r.Body, a.config.MaxUploadSize)
+		r.Body = http.MaxBytesReader(w, r.Body, a.config().MaxUploadSize)
 		defer r.Body.Close()
 
 		mediaFile, _, err := r.FormFile("media_file")
 		if err != nil && err != http.ErrMissingFile {
-			log.WithError(err).Error("error parsing form file")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error parsing form file")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
 		var mediaURI string
 
 		if mediaFile != nil {
-			opts := &ImageOptions{Resize: true, Width: a.config.MediaResolution, Height: 0}
+			opts := &ImageOptions{Resize: true, Width: a.config().MediaResolution, Height: 0}
 			mediaURI, err = StoreUploadedImage(
-				a.config, mediaFile,
+				a.config(), mediaFile,
 				mediaDir, "",
 				opts,
 			)
 
 			if err != nil {
-				log.WithError(err).Error("error storing the file")
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error storing the file")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 				return
 			}
 		}
@@ -794,7 +1125,7 @@ func (a *API) OldUploadMediaEndpoint() httprouter.Handle {
 		uri := URI{"mediaURI", mediaURI}
 		data, err := json.Marshal(uri)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
@@ -815,21 +1146,21 @@ func (a *API) UploadMediaEndpoint() httprouter.Handle {
 		}
 
 		// Limit request body to to abuse
-		r.Body = http.MaxBytesReader(w, r.Body, a.config.MaxUploadSize)
+		r.Body = http.MaxBytesReader(w, r.Body, a.config().MaxUploadSize)
 
 		mfile, headers, err := r.FormFile("media_file")
 		if err != nil && err != http.ErrMissingFile {
 			if err.Error() == "http: request body too large" {
-				http.Error(w, "Media Upload Too Large", http.StatusRequestEntityTooLarge)
+				apiError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "Media Upload Too Large")
 				return
 			}
-			log.WithError(err).Error("error parsing form file")
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error parsing form file")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
 		if mfile == nil || headers == nil {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -840,65 +1171,65 @@ func (a *API) UploadMediaEndpoint() httprouter.Handle {
 		if strings.HasPrefix(ctype, "image/") {
 			fn, err := ReceiveImage(mfile)
 			if err != nil {
-				log.WithError(err).Error("error writing uploaded image")
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error writing uploaded image")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 				return
 			}
 
-			uuid, err := a.tasks.Dispatch(NewImageTask(a.config, fn))
+			uuid, err := a.tasks.Dispatch(NewImageTask(a.config(), fn))
 			if err != nil {
-				log.WithError(err).Error("error dispatching image processing task")
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error dispatching image processing task")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 				return
 			}
 			uri.Type = "taskURI"
-			uri.Path = URLForTask(a.config.BaseURL, uuid)
+			uri.Path = URLForTask(a.config().BaseURL, uuid)
 		}
 
 		if strings.HasPrefix(ctype, "audio/") {
 			fn, err := ReceiveAudio(mfile)
 			if err != nil {
-				log.WithError(err).Error("error writing uploaded audio")
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error writing uploaded audio")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 				return
 			}
 
-			uuid, err := a.tasks.Dispatch(NewAudioTask(a.config, fn))
+			uuid, err := a.tasks.Dispatch(NewAudioTask(a.config(), fn))
 			if err != nil {
-				log.WithError(err).Error("error dispatching audio transcoding task")
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error dispatching audio transcoding task")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 				return
 			}
 			uri.Type = "taskURI"
-			uri.Path = URLForTask(a.config.BaseURL, uuid)
+			uri.Path = URLForTask(a.config().BaseURL, uuid)
 		}
 
 		if strings.HasPrefix(ctype, "video/") {
 			fn, err := ReceiveVideo(mfile)
 			if err != nil {
-				log.WithError(err).Error("error writing uploaded video")
-				http.Error(w, err.Error(), http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error writing uploaded video")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 				return
 			}
 
-			uuid, err := a.tasks.Dispatch(NewVideoTask(a.config, fn))
+			uuid, err := a.tasks.Dispatch(NewVideoTask(a.config(), fn))
 			if err != nil {
-				log.WithError(err).Error("error dispatching vodeo transcode task")
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Error("error dispatching vodeo transcode task")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 				return
 			}
 			uri.Type = "taskURI"
-			uri.Path = URLForTask(a.config.BaseURL, uuid)
+			uri.Path = URLForTask(a.config().BaseURL, uuid)
 		}
 
 		if uri.IsZero() {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		data, err := json.Marshal(uri)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
@@ -925,28 +1256,35 @@ func (a *API) ProfileEndpoint() httprouter.Handle {
 		if a.db.HasUser(username) {
 			user, err := a.db.GetUser(username)
 			if err != nil {
-				log.WithError(err).Errorf("error loading user object for %s", username)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Errorf("error loading user object for %s", username)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+				return
+			}
+
+			// Users blocked by the user cannot see their profile
+			if loggedInUser != nil && user.HasBlocked(loggedInUser.URL) {
+				apiError(w, http.StatusNotFound, ErrCodeNotFound, "User/Feed not found")
 				return
 			}
-			profile = user.Profile(a.config.BaseURL, loggedInUser)
+
+			profile = user.Profile(a.config().BaseURL, loggedInUser)
 		} else if a.db.HasFeed(username) {
 			feed, err := a.db.GetFeed(username)
 			if err != nil {
-				log.WithError(err).Errorf("error loading feed object for %s", username)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Errorf("error loading feed object for %s", username)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 				return
 			}
-			profile = feed.Profile(a.config.BaseURL, loggedInUser)
+			profile = feed.Profile(a.config().BaseURL, loggedInUser)
 		} else {
-			http.Error(w, "User/Feed not found", http.StatusNotFound)
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "User/Feed not found")
 			return
 		}
 
 		if !a.cache.IsCached(profile.URI) {
 			sources := make(types.FetchFeedRequests)
 			sources[types.FetchFeedRequest{Nick: profile.Nick, URL: profile.URI}] = true
-			a.cache.FetchFeeds(a.config, a.archive, sources, nil)
+			a.cache.FetchFeeds(a.config(), a.archive, sources, nil)
 		}
 
 		var twter types.Twter
@@ -968,7 +1306,11 @@ func (a *API) ProfileEndpoint() httprouter.Handle {
 
 		data, err := json.Marshal(profileResponse)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+			return
+		}
+
+		if notModified(w, r, bodyETag(data)) {
 			return
 		}
 
@@ -984,15 +1326,19 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 
 		req, err := types.NewConversationRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing conversation request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing conversation request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		hash := req.Hash
 
 		if hash == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if notModified(w, r, a.viewETag(loggedInUser, "conv", hash, req.Page)) {
 			return
 		}
 
@@ -1002,15 +1348,15 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 			if a.archive.Has(hash) {
 				twt, err = a.archive.Get(hash)
 				if err != nil {
-					log.WithError(err).Errorf("error fetching twt %s from archive", hash)
-					http.Error(w, "Bad Request", http.StatusBadRequest)
+					apiLogger(r).WithError(err).Errorf("error fetching twt %s from archive", hash)
+					apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 					return
 				}
 			}
 		}
 
 		if twt.IsZero() {
-			http.Error(w, "Conversation Not Found", http.StatusNotFound)
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "Conversation Not Found")
 			return
 		}
 
@@ -1022,12 +1368,12 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 
 		var pagedTwts types.Twts
 
-		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
 		pager.SetPage(req.Page)
 
 		if err = pager.Results(&pagedTwts); err != nil {
-			log.WithError(err).Error("error loading twts")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error loading twts")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -1042,7 +1388,7 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 
 		data, err := json.Marshal(res)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
@@ -1053,21 +1399,21 @@ func (a *API) ConversationEndpoint() httprouter.Handle {
 
 // FetchTwtsEndpoint ...
 func (a *API) FetchTwtsEndpoint() httprouter.Handle {
-	isLocal := IsLocalURLFactory(a.config)
+	isLocal := IsLocalURLFactory(a.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		loggedInUser := a.getLoggedInUser(r)
 
 		req, err := types.NewFetchTwtsRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing fetch twts request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing fetch twts request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		nick := NormalizeUsername(req.Nick)
 		if nick == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1078,42 +1424,44 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 			if !a.cache.IsCached(req.URL) {
 				sources := make(types.FetchFeedRequests)
 				sources[types.FetchFeedRequest{Nick: nick, URL: req.URL}] = true
-				a.cache.FetchFeeds(a.config, a.archive, sources, nil)
+				a.cache.FetchFeeds(a.config(), a.archive, sources, nil)
 			}
 
 			twts = a.cache.GetByURL(req.URL)
 		} else if a.db.HasUser(nick) {
 			user, err := a.db.GetUser(nick)
 			if err != nil {
-				log.WithError(err).Errorf("error loading user object for %s", nick)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Errorf("error loading user object for %s", nick)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 				return
 			}
-			profile = user.Profile(a.config.BaseURL, loggedInUser)
+			profile = user.Profile(a.config().BaseURL, loggedInUser)
 			twts = a.cache.GetByURL(profile.URI)
 		} else if a.db.HasFeed(nick) {
 			feed, err := a.db.GetFeed(nick)
 			if err != nil {
-				log.WithError(err).Errorf("error loading feed object for %s", nick)
-				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				apiLogger(r).WithError(err).Errorf("error loading feed object for %s", nick)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 				return
 			}
-			profile = feed.Profile(a.config.BaseURL, loggedInUser)
+			profile = feed.Profile(a.config().BaseURL, loggedInUser)
 
 			twts = a.cache.GetByURL(profile.URI)
 		} else {
-			http.Error(w, "User/Feed not found", http.StatusNotFound)
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "User/Feed not found")
 			return
 		}
 
+		twts = visibility.Filter(a.config(), loggedInUser, twts)
+
 		var pagedTwts types.Twts
 
-		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
 		pager.SetPage(req.Page)
 
 		if err = pager.Results(&pagedTwts); err != nil {
-			log.WithError(err).Error("error loading twts")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error loading twts")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -1128,7 +1476,7 @@ func (a *API) FetchTwtsEndpoint() httprouter.Handle {
 
 		data, err := json.Marshal(res)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
 			return
 		}
 
@@ -1143,8 +1491,8 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 		loggedInUser := a.getLoggedInUser(r)
 		req, err := types.NewExternalProfileRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing external profile request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing external profile request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1152,15 +1500,15 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 		nick := req.Nick
 
 		if uri == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		if !a.cache.IsCached(uri) {
-			a.tasks.DispatchFunc(func() error {
+			a.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityInteractive, func() error {
 				sources := make(types.FetchFeedRequests)
 				sources[types.FetchFeedRequest{Nick: nick, URL: uri}] = true
-				a.cache.FetchFeeds(a.config, a.archive, sources, nil)
+				a.cache.FetchFeeds(a.config(), a.archive, sources, nil)
 				return nil
 			})
 		}
@@ -1215,7 +1563,7 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 
 			Nick:        nick,
 			Description: twter.Tagline,
-			Avatar:      URLForExternalAvatar(a.config, uri),
+			Avatar:      URLForExternalAvatar(a.config(), uri),
 			URI:         uri,
 
 			Following:  follows,
@@ -1237,7 +1585,11 @@ func (a *API) ExternalProfileEndpoint() httprouter.Handle {
 
 		data, err := json.Marshal(profileResponse)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+			return
+		}
+
+		if notModified(w, r, bodyETag(data)) {
 			return
 		}
 
@@ -1253,8 +1605,8 @@ func (a *API) MuteEndpoint() httprouter.Handle {
 
 		req, err := types.NewMuteRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing mute request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing mute request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1262,7 +1614,7 @@ func (a *API) MuteEndpoint() httprouter.Handle {
 		url := req.URL
 
 		if nick == "" || url == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1271,8 +1623,8 @@ func (a *API) MuteEndpoint() httprouter.Handle {
 		a.cache.GetByUser(user, true)
 
 		if err := a.db.SetUser(user.Username, user); err != nil {
-			log.WithError(err).Error("error updating user object")
-			http.Error(w, "User Update Failed", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error updating user object")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "User Update Failed")
 			return
 		}
 
@@ -1290,15 +1642,15 @@ func (a *API) UnmuteEndpoint() httprouter.Handle {
 
 		req, err := types.NewUnmuteRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing unmute request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing unmute request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
 		nick := req.Nick
 
 		if nick == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1307,8 +1659,8 @@ func (a *API) UnmuteEndpoint() httprouter.Handle {
 		a.cache.GetByUser(user, true)
 
 		if err := a.db.SetUser(user.Username, user); err != nil {
-			log.WithError(err).Error("error updating user object")
-			http.Error(w, "User Update Failed", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error updating user object")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "User Update Failed")
 			return
 		}
 
@@ -1323,8 +1675,8 @@ func (a *API) SupportEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		req, err := types.NewSupportRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing support request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing support request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1333,14 +1685,14 @@ func (a *API) SupportEndpoint() httprouter.Handle {
 		subject := req.Subject
 		message := req.Message
 
-		if err := SendSupportRequestEmail(a.config, name, email, subject, message); err != nil {
-			log.WithError(err).Errorf("unable to send support email for %s", email)
-			log.WithError(err).Error("error sending support request")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err := SendSupportRequestEmail(a.config(), name, email, subject, message); err != nil {
+			apiLogger(r).WithError(err).Errorf("unable to send support email for %s", email)
+			apiLogger(r).WithError(err).Error("error sending support request")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
-		log.Infof("support message email sent for %s", email)
+		apiLogger(r).Infof("support message email sent for %s", email)
 
 		// No real response
 		w.Header().Set("Content-Type", "application/json")
@@ -1354,8 +1706,8 @@ func (a *API) ReportEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		req, err := types.NewReportRequest(r.Body)
 		if err != nil {
-			log.WithError(err).Error("error parsing report request")
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiLogger(r).WithError(err).Error("error parsing report request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1363,7 +1715,7 @@ func (a *API) ReportEndpoint() httprouter.Handle {
 		url := req.URL
 
 		if nick == "" || url == "" {
-			http.Error(w, "Bad Request", http.StatusBadRequest)
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
 			return
 		}
 
@@ -1372,9 +1724,9 @@ func (a *API) ReportEndpoint() httprouter.Handle {
 		category := req.Category
 		message := req.Message
 
-		if err := SendReportAbuseEmail(a.config, nick, url, name, email, category, message); err != nil {
-			log.WithError(err).Errorf("unable to send report email for %s", email)
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		if err := SendReportAbuseEmail(a.config(), nick, url, name, email, category, message); err != nil {
+			apiLogger(r).WithError(err).Errorf("unable to send report email for %s", email)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -1387,10 +1739,10 @@ func (a *API) ReportEndpoint() httprouter.Handle {
 // PodConfigEndpoint ...
 func (a *API) PodConfigEndpoint() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		data, err := json.Marshal(a.config.Settings())
+		data, err := json.Marshal(a.config().Settings())
 		if err != nil {
-			log.WithError(err).Error("error serializing pod config response")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			apiLogger(r).WithError(err).Error("error serializing pod config response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
 			return
 		}
 
@@ -1399,18 +1751,228 @@ func (a *API) PodConfigEndpoint() httprouter.Handle {
 	}
 }
 
+// EmojiEndpoint returns the pod's custom emoji so clients can render them
+func (a *API) EmojiEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		emoji := emojis.List()
+		if emoji == nil {
+			emoji = []*Emoji{}
+		}
+
+		data, err := json.Marshal(emoji)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing emoji response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// TwtHistoryEndpoint returns the edit and deletion history of a local twt
+// the user (if any) may see, less the revisions they may not see
+func (a *API) TwtHistoryEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		hash := p.ByName("hash")
+		loggedInUser := a.getLoggedInUser(r)
+
+		history, ok := edits.Get(hash)
+		if !ok {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "Not Found")
+			return
+		}
+
+		// The history is only served along with a twt that can be checked
+		twt, _ := a.lookupTwt(hash)
+		if twt.IsZero() || !a.canViewHistory(loggedInUser, twt.Twter().URI, hash) {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "Not Found")
+			return
+		}
+
+		visible := *history
+		visible.Revisions = nil
+		for _, revision := range history.Revisions {
+			if a.canViewHistory(loggedInUser, twt.Twter().URI, revision.Hash) {
+				visible.Revisions = append(visible.Revisions, revision)
+			}
+		}
+
+		data, err := json.Marshal(visible)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing twt history response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// canViewHistory returns true if the user (nil for anonymous clients) may see
+// the twt (or previous revision of a twt) with the given hash of a feed.
+// Local-only twts are never shown to anonymous clients which may be anywhere.
+func (a *API) canViewHistory(user *User, feed, hash string) bool {
+	if visibility.IsProtected(feed) && !visibility.IsApproved(user, feed) {
+		return false
+	}
+
+	switch visibility.Get(hash) {
+	case VisibilityFollowers:
+		return CanViewFollowersOnly(a.config(), user, feed)
+	case VisibilityLocal:
+		return user != nil
+	default:
+		return true
+	}
+}
+
+// LangsEndpoint lists the languages available on the pod along with the
+// completeness of their translations
+func (a *API) LangsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		data, err := json.Marshal(a.translator.Languages())
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing langs response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// ValidateEndpoint lints the twtxt feed in the request body and reports the
+// problems found. The optional url query parameter is used to compute twt
+// hashes of feeds that do not declare their url.
+func (a *API) ValidateEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		defer r.Body.Close()
+
+		report, err := LintFeed(a.config(), r.Body, r.URL.Query().Get("url"))
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error reading feed to validate")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		data, err := json.Marshal(report)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing validate response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// ReloadEndpoint reloads the pod's settings without restarting the pod
+func (a *API) ReloadEndpoint() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(a.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if !isAdminUser(user) {
+			apiError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden")
+			return
+		}
+
+		if a.reload == nil {
+			apiError(w, http.StatusNotImplemented, ErrCodeNotImplemented, "Not Implemented")
+			return
+		}
+
+		if err := a.reload(); err != nil {
+			apiLogger(r).WithError(err).Error("error reloading pod")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, err.Error())
+			return
+		}
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
+
 // WebSubEndpoint ...
 func (a *API) WebSubEndpoint() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(a.config)
+	isAdminUser := IsAdminUserFactory(a.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		user := r.Context().Value(UserContextKey).(*User)
 
 		if !isAdminUser(user) {
-			http.Error(w, "Forbidden", http.StatusForbidden)
+			apiError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden")
 			return
 		}
 
 		websub.DebugEndpoint(w, r)
 	}
 }
+
+// maxTwtersRequest is the maximum number of feeds that can be looked up by a
+// single request to /api/v1/twters
+const maxTwtersRequest = 100
+
+// TwtersRequest is the request to /api/v1/twters to look up the twters of
+// many feeds at once
+type TwtersRequest struct {
+	URIs []string `json:"uris"`
+}
+
+// TwtersResponse is the response of /api/v1/twters with the cached twters by
+// the uri of their feed and the uris of the feeds that are not cached
+type TwtersResponse struct {
+	Twters  map[string]types.Twter `json:"twters"`
+	Missing []string               `json:"missing"`
+}
+
+// TwtersEndpoint returns the cached twters (nick, avatar, ...) of many feeds
+// so clients rendering timelines don't need to look up every feed
+func (a *API) TwtersEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		var req TwtersRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apiLogger(r).WithError(err).Error("error parsing twters request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if len(req.URIs) > maxTwtersRequest {
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("Too many uris (max %d)", maxTwtersRequest))
+			return
+		}
+
+		res := TwtersResponse{
+			Twters:  make(map[string]types.Twter),
+			Missing: []string{},
+		}
+
+		for _, uri := range req.URIs {
+			twter := a.cache.GetTwter(uri)
+			if twter == nil {
+				twter = a.cache.GetTwter(NormalizeURL(uri))
+			}
+			if twter == nil {
+				res.Missing = append(res.Missing, uri)
+				continue
+			}
+			res.Twters[uri] = *twter
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Machine-readable codes of the errors returned by the API
+const (
+	ErrCodeBadRequest         = "bad_request"
+	ErrCodeMissingToken       = "missing_token"
+	ErrCodeInvalidToken       = "invalid_token"
+	ErrCodeInvalidCredentials = "invalid_credentials"
+	ErrCodeAccountLocked      = "account_locked"
+	ErrCodeAccountInactive    = "account_inactive"
+	ErrCodeFeedImposter       = "feed_imposter"
+	ErrCodeInvalidUsername    = "invalid_username"
+	ErrCodeUsernameExists     = "username_exists"
+	ErrCodeFeedExists         = "feed_exists"
+	ErrCodeInvalidFeed        = "invalid_feed"
+	ErrCodeForbidden          = "forbidden"
+	ErrCodeNotFound           = "not_found"
+	ErrCodeTooLarge           = "too_large"
+	ErrCodeTwtTooLong         = "twt_too_long"
+	ErrCodeNotImplemented     = "not_implemented"
+	ErrCodeInternal           = "internal_error"
+)
+
+// APIError is the JSON error envelope of every error returned by the API so
+// clients can present proper errors instead of parsing English text
+type APIError struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// apiError responds to an API request with the given status and error code
+// and optional details of the error
+func apiError(w http.ResponseWriter, status int, code, message string, details ...interface{}) {
+	res := APIError{Code: code, Message: message}
+	if len(details) == 1 {
+		res.Details = details[0]
+	} else if len(details) > 1 {
+		res.Details = details
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, message, status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,56 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// viewETag returns a validator of an API response derived from when the
+// cache's views were last updated, the state of the user (nil for anonymous
+// clients) the response is for and the parameters of the request so clients
+// polling for new twts can be answered without rendering identical responses
+func (a *API) viewETag(user *User, params ...interface{}) string {
+	h := sha256.New()
+
+	fmt.Fprintf(h, "%d", a.cache.UpdatedAt().UnixNano())
+
+	if user != nil {
+		if data, err := user.Bytes(); err == nil {
+			h.Write(data)
+		}
+	}
+
+	for _, param := range params {
+		fmt.Fprintf(h, ":%v", param)
+	}
+
+	return fmt.Sprintf(`W/"%s"`, hex.EncodeToString(h.Sum(nil))[:32])
+}
+
+// bodyETag returns a validator of the body of an API response
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:])[:32])
+}
+
+// notModified sets the ETag of a response and returns true after responding
+// with 304 Not Modified if the client already has the response
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+
+	for _, match := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		match = strings.TrimSpace(match)
+		if match == "*" || strings.TrimPrefix(match, "W/") == strings.TrimPrefix(etag, "W/") {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,121 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// CanManageFeedFactory returns a function that checks whether a user may
+// manage (edit the description and avatar of) a feed: its owner, or the Pod
+// Owner/Operator for special feeds
+func CanManageFeedFactory(conf *Config) func(feed string, u *User) bool {
+	isAdminUser := IsAdminUserFactory(conf)
+	return func(feed string, u *User) bool {
+		if u.OwnsFeed(feed) {
+			return true
+		}
+		if IsSpecialFeed(feed) && isAdminUser(u) {
+			return true
+		}
+		return false
+	}
+}
+
+// FeedEndpoint returns the metadata of an owned feed (GET) or updates its
+// description and/or avatar (POST, multipart form with `description` and
+// `avatar_file`). The changes are reflected in the feed's profile and the
+// metadata of its twtxt.txt preamble.
+func (a *API) FeedEndpoint() httprouter.Handle {
+	canManageFeed := CanManageFeedFactory(a.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, a.config().MaxUploadSize)
+		defer r.Body.Close()
+
+		user := r.Context().Value(UserContextKey).(*User)
+		name := NormalizeFeedName(p.ByName("name"))
+
+		feed, err := a.db.GetFeed(name)
+		if err != nil {
+			if err == ErrFeedNotFound {
+				apiError(w, http.StatusNotFound, ErrCodeNotFound, "Feed Not Found")
+				return
+			}
+			apiLogger(r).WithError(err).Errorf("error loading feed object for %s", name)
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+			return
+		}
+
+		if !canManageFeed(feed.Name, user) {
+			apiError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden")
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			avatarFile, _, err := r.FormFile("avatar_file")
+			if err != nil && err != http.ErrMissingFile {
+				if err.Error() == "http: request body too large" {
+					apiError(w, http.StatusRequestEntityTooLarge, ErrCodeTooLarge, "Avatar Upload Too Large")
+					return
+				}
+				apiLogger(r).WithError(err).Error("error parsing form file")
+				apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request", err.Error())
+				return
+			}
+
+			// Only update the description if it was given (an empty
+			// description clears it)
+			if _, ok := r.Form["description"]; ok {
+				feed.Description = strings.TrimSpace(r.FormValue("description"))
+			}
+
+			if avatarFile != nil {
+				opts := &ImageOptions{
+					Resize: true,
+					Width:  a.config().AvatarResolution,
+					Height: a.config().AvatarResolution,
+				}
+				if _, err := StoreUploadedImage(a.config(), avatarFile, avatarsDir, feed.Name, opts); err != nil {
+					apiLogger(r).WithError(err).Error("error updating feed avatar")
+					apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Avatar", err.Error())
+					return
+				}
+				avatarFn := filepath.Join(a.config().Data, avatarsDir, fmt.Sprintf("%s.png", feed.Name))
+				if avatarHash, err := FastHashFile(avatarFn); err == nil {
+					feed.AvatarHash = avatarHash
+				} else {
+					apiLogger(r).WithError(err).Warnf("error updating avatar hash for %s", feed.Name)
+				}
+			}
+
+			if err := a.db.SetFeed(feed.Name, feed); err != nil {
+				apiLogger(r).WithError(err).Errorf("error updating feed object for %s", feed.Name)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+				return
+			}
+		}
+
+		profile := feed.Profile(a.config().BaseURL, user)
+		followers := a.cache.GetFollowers(profile)
+		profile.Followers = followers
+		profile.NFollowers = len(followers)
+
+		data, err := json.Marshal(profile)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
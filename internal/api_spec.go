@@ -0,0 +1,362 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"git.mills.io/yarnsocial/yarn"
+	"github.com/julienschmidt/httprouter"
+	"go.yarn.social/types"
+)
+
+// maxValidatedRequestSize is the maximum size of a request body validated
+// against the API's specification
+const maxValidatedRequestSize = 1 << 20
+
+// ErrCodeValidationFailed is the code of the error returned for requests
+// whose payload does not match the API's specification
+const ErrCodeValidationFailed = "validation_failed"
+
+// apiOperation describes an endpoint of the API for its OpenAPI document and
+// the validation of its requests
+type apiOperation struct {
+	Method   string
+	Path     string
+	Summary  string
+	Auth     bool
+	Request  interface{}
+	Response interface{}
+}
+
+// apiOperations are the documented endpoints of the API (relative to /api/v1)
+var apiOperations = []apiOperation{
+	{Method: http.MethodGet, Path: "/ping", Summary: "Check the API is up"},
+	{Method: http.MethodPost, Path: "/auth", Summary: "Authenticate and obtain a token", Request: types.AuthRequest{}, Response: types.AuthResponse{}},
+	{Method: http.MethodPost, Path: "/register", Summary: "Register a new account", Request: types.RegisterRequest{}},
+	{Method: http.MethodPost, Path: "/post", Summary: "Post a new twt", Auth: true, Request: types.PostRequest{}},
+	{Method: http.MethodPost, Path: "/preview", Summary: "Preview a twt as it would be posted", Auth: true, Request: types.PostRequest{}, Response: PreviewResponse{}},
+	{Method: http.MethodPost, Path: "/timeline", Summary: "Get the user's timeline", Auth: true, Request: TimelineRequest{}, Response: types.PagedResponse{}},
+	{Method: http.MethodGet, Path: "/read-positions", Summary: "Get the user's read positions by view", Auth: true, Response: map[string]string{}},
+	{Method: http.MethodPost, Path: "/read-positions", Summary: "Set the user's read position of a view", Auth: true, Request: ReadPositionRequest{}, Response: map[string]string{}},
+	{Method: http.MethodPost, Path: "/discover", Summary: "Get the pod's discover timeline", Request: TimelineRequest{}, Response: types.PagedResponse{}},
+	{Method: http.MethodPost, Path: "/mentions", Summary: "Get the user's mentions", Auth: true, Request: types.PagedRequest{}, Response: types.PagedResponse{}},
+	{Method: http.MethodPost, Path: "/bookmarks", Summary: "Get the user's bookmarks by folder and/or tag", Auth: true, Request: BookmarksRequest{}, Response: BookmarksResponse{}},
+	{Method: http.MethodPost, Path: "/bookmark", Summary: "Bookmark a twt with a folder, tags and note or remove a bookmark", Auth: true, Request: BookmarkRequest{}},
+	{Method: http.MethodPost, Path: "/follow", Summary: "Follow a feed", Auth: true, Request: types.FollowRequest{}},
+	{Method: http.MethodPost, Path: "/unfollow", Summary: "Unfollow a feed", Auth: true, Request: types.UnfollowRequest{}},
+	{Method: http.MethodPost, Path: "/mute", Summary: "Mute a feed", Auth: true, Request: types.MuteRequest{}},
+	{Method: http.MethodPost, Path: "/unmute", Summary: "Unmute a feed", Auth: true, Request: types.UnmuteRequest{}},
+	{Method: http.MethodGet, Path: "/feeds/{name}", Summary: "Get the metadata of an owned feed", Auth: true, Response: types.Profile{}},
+	{Method: http.MethodPost, Path: "/feeds/{name}", Summary: "Update the description and/or avatar of an owned feed (multipart form)", Auth: true, Response: types.Profile{}},
+	{Method: http.MethodGet, Path: "/profile/{username}", Summary: "Get the profile of a user or feed", Response: types.ProfileResponse{}},
+	{Method: http.MethodPost, Path: "/fetch-twts", Summary: "Get the twts of a feed", Request: types.FetchTwtsRequest{}, Response: types.PagedResponse{}},
+	{Method: http.MethodPost, Path: "/fetch-media", Summary: "Get the twts with media of a feed", Request: types.FetchTwtsRequest{}, Response: types.PagedResponse{}},
+	{Method: http.MethodPost, Path: "/conv", Summary: "Get the twts of a conversation", Request: types.ConversationRequest{}, Response: types.PagedResponse{}},
+	{Method: http.MethodPost, Path: "/tag/{tag}", Summary: "Get the twts with a hashtag", Request: types.PagedRequest{}, Response: types.PagedResponse{}},
+	{Method: http.MethodPost, Path: "/external", Summary: "Get the profile of an external feed", Request: types.ExternalProfileRequest{}, Response: types.ProfileResponse{}},
+	{Method: http.MethodPost, Path: "/feed-stats", Summary: "Get the statistics of a feed's activity", Request: FeedStatsRequest{}, Response: FeedStats{}},
+	{Method: http.MethodGet, Path: "/directory", Summary: "Get the pod's feed directory: its curated feeds and the feeds and health of its feed sources", Response: FeedDirectoryResponse{}},
+	{Method: http.MethodPost, Path: "/twters", Summary: "Look up the cached twters of many feeds", Request: TwtersRequest{}, Response: TwtersResponse{}},
+	{Method: http.MethodPost, Path: "/languages", Summary: "Look up the detected languages of many twts", Request: LanguagesRequest{}, Response: LanguagesResponse{}},
+	{Method: http.MethodGet, Path: "/admin/jobs", Summary: "Get the status of the background jobs (Pod Owner)", Auth: true, Response: []JobStatus{}},
+	{Method: http.MethodPost, Path: "/admin/jobs/{name}/{action}", Summary: "Run a background job now, disable or enable it (Pod Owner)", Auth: true, Response: JobStatus{}},
+	{Method: http.MethodPost, Path: "/support", Summary: "Contact the pod's support", Auth: true, Request: types.SupportRequest{}},
+	{Method: http.MethodPost, Path: "/report", Summary: "Report abuse", Auth: true, Request: types.ReportRequest{}},
+	{Method: http.MethodGet, Path: "/public/discover", Summary: "Get the pod's discover timeline (public API)", Response: types.PagedResponse{}},
+	{Method: http.MethodGet, Path: "/public/profile/{username}", Summary: "Get the profile of a user or feed (public API)", Response: types.ProfileResponse{}},
+	{Method: http.MethodGet, Path: "/public/profile/{username}/twts", Summary: "Get the twts of a user or feed (public API)", Response: types.PagedResponse{}},
+	{Method: http.MethodGet, Path: "/public/profile/{username}/media", Summary: "Get the twts with media of a user or feed (public API)", Response: types.PagedResponse{}},
+	{Method: http.MethodGet, Path: "/public/twt/{hash}", Summary: "Get a twt (public API)", Response: types.PagedResponse{}},
+	{Method: http.MethodGet, Path: "/public/conv/{hash}", Summary: "Get the twts of a conversation (public API)", Response: types.PagedResponse{}},
+	{Method: http.MethodGet, Path: "/public/tag/{tag}", Summary: "Get the twts with a hashtag (public API)", Response: types.PagedResponse{}},
+}
+
+// schemaGenerator generates the JSON schemas of Go types as serialized by
+// encoding/json for an OpenAPI document
+type schemaGenerator struct {
+	schemas map[string]interface{}
+}
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	marshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+)
+
+func (g *schemaGenerator) schema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	case t.Implements(marshalerType) || reflect.PtrTo(t).Implements(marshalerType):
+		// Custom serialization we know nothing about
+		return map[string]interface{}{}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		return g.ref(t)
+	default:
+		// Interfaces (e.g: types.Twt) can be anything
+		return map[string]interface{}{}
+	}
+}
+
+// ref registers the schema of a named struct as a component and returns a
+// reference to it
+func (g *schemaGenerator) ref(t reflect.Type) map[string]interface{} {
+	if t.Name() == "" {
+		return g.object(t)
+	}
+
+	name := t.Name()
+	if _, ok := g.schemas[name]; !ok {
+		g.schemas[name] = map[string]interface{}{} // Recursive types
+		g.schemas[name] = g.object(t)
+	}
+
+	return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+}
+
+func (g *schemaGenerator) object(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	g.fields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (g *schemaGenerator) fields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		name, _ := jsonFieldName(field)
+		if name == "-" {
+			continue
+		}
+
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			for ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				g.fields(ft, properties)
+				continue
+			}
+		}
+
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = g.schema(field.Type)
+	}
+}
+
+// jsonFieldName returns the name of a struct field in its json tag
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	tag, ok := field.Tag.Lookup("json")
+	if !ok {
+		return "", false
+	}
+	return strings.Split(tag, ",")[0], true
+}
+
+// OpenAPISpec returns the OpenAPI 3 document of the API generated from the
+// request and response types of its endpoints
+func (a *API) OpenAPISpec() map[string]interface{} {
+	g := &schemaGenerator{schemas: make(map[string]interface{})}
+
+	errorResponse := map[string]interface{}{
+		"description": "Error",
+		"content": map[string]interface{}{
+			"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(APIError{}))},
+		},
+	}
+
+	paths := make(map[string]interface{})
+	for _, op := range apiOperations {
+		success := map[string]interface{}{"description": "Success"}
+		if op.Response != nil {
+			success["content"] = map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.Response))},
+			}
+		}
+
+		operation := map[string]interface{}{
+			"summary": op.Summary,
+			"responses": map[string]interface{}{
+				"200":     success,
+				"default": errorResponse,
+			},
+		}
+
+		if op.Request != nil {
+			operation["requestBody"] = map[string]interface{}{
+				"required": true,
+				"content": map[string]interface{}{
+					"application/json": map[string]interface{}{"schema": g.schema(reflect.TypeOf(op.Request))},
+				},
+			}
+		}
+
+		var parameters []interface{}
+		for _, part := range strings.Split(op.Path, "/") {
+			if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+				parameters = append(parameters, map[string]interface{}{
+					"name":     strings.Trim(part, "{}"),
+					"in":       "path",
+					"required": true,
+					"schema":   map[string]interface{}{"type": "string"},
+				})
+			}
+		}
+		if len(parameters) > 0 {
+			operation["parameters"] = parameters
+		}
+
+		if op.Auth {
+			operation["security"] = []interface{}{map[string]interface{}{"token": []string{}}}
+		}
+
+		item, ok := paths[op.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[op.Path] = item
+		}
+		item[strings.ToLower(op.Method)] = operation
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   fmt.Sprintf("%s API", a.config().Name),
+			"version": yarn.FullVersion(),
+		},
+		"servers": []interface{}{
+			map[string]interface{}{"url": strings.TrimSuffix(a.config().BaseURL, "/") + "/api/v1"},
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]interface{}{
+				"token": map[string]interface{}{"type": "apiKey", "in": "header", "name": "Token"},
+			},
+		},
+	}
+}
+
+// SpecEndpoint serves the OpenAPI document of the API
+func (a *API) SpecEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		data, err := json.Marshal(a.OpenAPISpec())
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing api spec")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// FieldError is a field-level error of a request that failed validation
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// validateRequest decodes the payload of a request strictly into the request
+// type of its endpoint and returns the field-level errors if it doesn't match
+func validateRequest(data []byte, t reflect.Type) []FieldError {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(reflect.New(t).Interface())
+	if err == nil || err == io.EOF {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return []FieldError{{
+			Field:   typeErr.Field,
+			Message: fmt.Sprintf("expected %s but got %s", typeErr.Type, typeErr.Value),
+		}}
+	}
+
+	if strings.HasPrefix(err.Error(), "json: unknown field ") {
+		return []FieldError{{
+			Field:   strings.Trim(strings.TrimPrefix(err.Error(), "json: unknown field "), `"`),
+			Message: "unknown field",
+		}}
+	}
+
+	return []FieldError{{Message: err.Error()}}
+}
+
+// validated validates the payload of requests against the specification of
+// their endpoint if the Pod Owner/Operator enabled request validation and
+// responds with 422 Unprocessable Entity and field-level errors on mismatch
+func (a *API) validated(next httprouter.Handle) httprouter.Handle {
+	requests := make(map[string]reflect.Type)
+	for _, op := range apiOperations {
+		if op.Request != nil {
+			requests[op.Method+" /api/v1"+op.Path] = reflect.TypeOf(op.Request)
+		}
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		t, ok := requests[r.Method+" "+r.URL.Path]
+		if !a.config().APIValidation || !ok {
+			next(w, r, p)
+			return
+		}
+
+		data, err := io.ReadAll(io.LimitReader(r.Body, maxValidatedRequestSize))
+		if err != nil {
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+		r.Body.Close()
+
+		if errs := validateRequest(data, t); len(errs) > 0 {
+			apiError(w, http.StatusUnprocessableEntity, ErrCodeValidationFailed, "Validation Failed", errs)
+			return
+		}
+
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		next(w, r, p)
+	}
+}
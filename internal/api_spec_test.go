@@ -0,0 +1,52 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateRequest(t *testing.T) {
+	assert := assert.New(t)
+
+	typ := reflect.TypeOf(TwtersRequest{})
+
+	assert.Empty(validateRequest([]byte(`{"uris": ["https://example.com/twtxt.txt"]}`), typ))
+	assert.Empty(validateRequest([]byte(``), typ))
+
+	assert.Equal(
+		[]FieldError{{Field: "uris", Message: "expected []string but got string"}},
+		validateRequest([]byte(`{"uris": "https://example.com/twtxt.txt"}`), typ),
+	)
+	assert.Equal(
+		[]FieldError{{Field: "url", Message: "unknown field"}},
+		validateRequest([]byte(`{"url": "https://example.com/twtxt.txt"}`), typ),
+	)
+}
+
+func TestSchemaGenerator(t *testing.T) {
+	assert := assert.New(t)
+
+	g := &schemaGenerator{schemas: make(map[string]interface{})}
+
+	assert.Equal(
+		map[string]interface{}{"$ref": "#/components/schemas/TwtersRequest"},
+		g.schema(reflect.TypeOf(TwtersRequest{})),
+	)
+	assert.Equal(
+		map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"uris": map[string]interface{}{
+					"type":  "array",
+					"items": map[string]interface{}{"type": "string"},
+				},
+			},
+		},
+		g.schemas["TwtersRequest"],
+	)
+}
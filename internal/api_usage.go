@@ -0,0 +1,164 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// APIClientGoryon is the Goryon mobile app (a Flutter/Dart client)
+	APIClientGoryon = "goryon"
+
+	// APIClientWeb are web browsers (e.g: web based clients)
+	APIClientWeb = "web"
+
+	// APIClientOther is any other client (scripts, bots, yarnc, ...)
+	APIClientOther = "other"
+)
+
+// APIClientFamily returns the family of an API client from its User-Agent
+func APIClientFamily(ua string) string {
+	lua := strings.ToLower(ua)
+	switch {
+	case strings.Contains(lua, "goryon") || strings.HasPrefix(lua, "dart"):
+		return APIClientGoryon
+	case strings.HasPrefix(lua, "mozilla"):
+		return APIClientWeb
+	default:
+		return APIClientOther
+	}
+}
+
+// apiEndpointName returns the route of a request with its parameters
+// substituted by their names (e.g: /api/v1/profile/:username) so that every
+// request to the same endpoint is counted together
+func apiEndpointName(r *http.Request, p httprouter.Params) string {
+	path := r.URL.Path
+	for _, param := range p {
+		if param.Value == "" {
+			continue
+		}
+		path = strings.Replace(path, "/"+param.Value, "/:"+param.Key, 1)
+	}
+	return r.Method + " " + path
+}
+
+// APIUsageStat is the usage of an API endpoint by a client family
+type APIUsageStat struct {
+	Endpoint string
+	Client   string
+	Requests uint64
+	Errors   uint64
+}
+
+// ErrorRate returns the percentage of requests that errored
+func (s APIUsageStat) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests) * 100
+}
+
+// APIUsage keeps per endpoint and per client usage of the API since the pod
+// was started
+type APIUsage struct {
+	mu    sync.RWMutex
+	stats map[string]*APIUsageStat
+}
+
+// NewAPIUsage ...
+func NewAPIUsage() *APIUsage {
+	return &APIUsage{stats: make(map[string]*APIUsageStat)}
+}
+
+// Record records a request to an endpoint by a client and its response status
+func (u *APIUsage) Record(endpoint, client string, status int) {
+	errored := status >= http.StatusBadRequest
+
+	labels := map[string]string{"endpoint": endpoint, "client": client}
+	metrics.CounterVec("api", "requests").With(labels).Inc()
+	if errored {
+		metrics.CounterVec("api", "errors").With(labels).Inc()
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	key := endpoint + "|" + client
+	stat, ok := u.stats[key]
+	if !ok {
+		stat = &APIUsageStat{Endpoint: endpoint, Client: client}
+		u.stats[key] = stat
+	}
+	stat.Requests++
+	if errored {
+		stat.Errors++
+	}
+}
+
+// Stats returns the usage of the API ordered by the busiest endpoints
+func (u *APIUsage) Stats() []APIUsageStat {
+	u.mu.RLock()
+	defer u.mu.RUnlock()
+
+	stats := make([]APIUsageStat, 0, len(u.stats))
+	for _, stat := range u.stats {
+		stats = append(stats, *stat)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		if stats[i].Requests == stats[j].Requests {
+			return stats[i].Endpoint < stats[j].Endpoint
+		}
+		return stats[i].Requests > stats[j].Requests
+	})
+
+	return stats
+}
+
+// statusRecorder records the status code of a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	sr.status = status
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+// metered is a Middleware that records the usage of API endpoints
+func (a *API) metered(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		sr := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(sr, r, p)
+		apiUsage.Record(apiEndpointName(r, p), APIClientFamily(r.UserAgent()), sr.status)
+	}
+}
+
+// ManageStatsHandler shows the usage of the API by endpoint and client
+func (s *Server) ManageStatsHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		ctx.Title = s.tr(ctx, "ManageStatsTitle")
+		ctx.APIUsage = apiUsage.Stats()
+
+		s.render("manageStats", w, ctx)
+	}
+}
@@ -84,6 +84,63 @@ func (a *DiskArchiver) makePath(hash string) (string, error) {
 	return filepath.Join(components...), nil
 }
 
+// lookupPath returns the path of an archived twt. Twts archived before the
+// twt hash length was increased are found by their legacy hash until the
+// archive is migrated with MigrateArchive.
+func (a *DiskArchiver) lookupPath(hash string) (string, bool, error) {
+	fn, err := a.makePath(hash)
+	if err != nil {
+		return "", false, err
+	}
+
+	if a.fileExists(fn) || len(hash) <= LegacyTwtHashLength {
+		return fn, false, nil
+	}
+
+	legacy, err := a.makePath(LegacyTwtHash(hash))
+	if err != nil {
+		return fn, false, nil
+	}
+
+	// Symlinks are aliases of twts archived under their full hash
+	if stat, err := os.Lstat(legacy); err == nil && stat.Mode().IsRegular() {
+		return legacy, true, nil
+	}
+
+	return fn, false, nil
+}
+
+// alias links the legacy hash of a twt to its archive file so that links and
+// replies using the legacy hash still resolve
+func (a *DiskArchiver) alias(hash, fn string) {
+	if len(hash) <= LegacyTwtHashLength {
+		return
+	}
+
+	legacy, err := a.makePath(LegacyTwtHash(hash))
+	if err != nil || legacy == fn {
+		return
+	}
+
+	if _, err := os.Lstat(legacy); err == nil {
+		// Keep the first twt claiming a legacy hash
+		return
+	}
+
+	if err := os.MkdirAll(filepath.Dir(legacy), 0755); err != nil {
+		log.WithError(err).Warnf("error creating archive directory for legacy hash of %s", hash)
+		return
+	}
+
+	target, err := filepath.Rel(filepath.Dir(legacy), fn)
+	if err != nil {
+		target = fn
+	}
+	if err := os.Symlink(target, legacy); err != nil {
+		log.WithError(err).Warnf("error linking legacy hash of %s", hash)
+	}
+}
+
 func (a *DiskArchiver) fileExists(fn string) bool {
 	if _, err := os.Stat(fn); err != nil {
 		return false
@@ -92,7 +149,7 @@ func (a *DiskArchiver) fileExists(fn string) bool {
 }
 
 func (a *DiskArchiver) Del(hash string) error {
-	fn, err := a.makePath(hash)
+	fn, _, err := a.lookupPath(hash)
 	if err != nil {
 		log.WithError(err).Errorf("error computing archive file for twt %s", hash)
 		return err
@@ -106,7 +163,7 @@ func (a *DiskArchiver) Del(hash string) error {
 }
 
 func (a *DiskArchiver) Has(hash string) bool {
-	fn, err := a.makePath(hash)
+	fn, _, err := a.lookupPath(hash)
 	if err != nil {
 		log.WithError(err).Errorf("error computing archive file for twt %s", hash)
 		return false
@@ -116,7 +173,7 @@ func (a *DiskArchiver) Has(hash string) bool {
 }
 
 func (a *DiskArchiver) Get(hash string) (types.Twt, error) {
-	fn, err := a.makePath(hash)
+	fn, legacy, err := a.lookupPath(hash)
 	if err != nil {
 		log.WithError(err).Errorf("error computing archive file for twt %s", hash)
 		return types.NilTwt, err
@@ -138,6 +195,12 @@ func (a *DiskArchiver) Get(hash string) (types.Twt, error) {
 		return twt, err
 	}
 
+	// A twt found by its legacy hash may be a different twt that collides
+	// with the legacy hash
+	if legacy && twt.Hash() != hash {
+		return types.NilTwt, ErrTwtNotArchived
+	}
+
 	return twt, nil
 }
 
@@ -168,6 +231,8 @@ func (a *DiskArchiver) Archive(twt types.Twt) error {
 		return err
 	}
 
+	a.alias(twt.Hash(), fn)
+
 	return nil
 }
 
@@ -180,7 +245,7 @@ func (a *DiskArchiver) Count() (int, error) {
 			return err
 		}
 
-		if !info.IsDir() && filepath.Ext(info.Name()) == ".json" {
+		if info.Mode().IsRegular() && filepath.Ext(info.Name()) == ".json" {
 			count++
 		}
 		return nil
@@ -191,3 +256,65 @@ func (a *DiskArchiver) Count() (int, error) {
 
 	return count, err
 }
+
+// MigrateArchive moves archived twts to the archive path of their hash at the
+// current twt hash length (types.TwtHashLength) and links their legacy hash
+// to the new location. It returns the number of twts moved.
+func MigrateArchive(p string) (int, error) {
+	a := &DiskArchiver{path: p}
+
+	var moved int
+
+	err := filepath.Walk(p, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() || filepath.Ext(info.Name()) != ".json" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		twt, err := types.DecodeJSON(data)
+		if err != nil {
+			log.WithError(err).Warnf("error decoding archived twt %s (skipping)", path)
+			return nil
+		}
+
+		hash := twt.Hash()
+		fn, err := a.makePath(hash)
+		if err != nil {
+			return err
+		}
+
+		if fn == path {
+			return nil
+		}
+
+		if a.fileExists(fn) {
+			log.Warnf("twt %s is already archived at %s (skipping)", hash, fn)
+			return nil
+		}
+
+		if err := os.MkdirAll(filepath.Dir(fn), 0755); err != nil {
+			return err
+		}
+
+		if err := os.Rename(path, fn); err != nil {
+			return err
+		}
+		a.alias(hash, fn)
+
+		moved++
+		return nil
+	})
+	if err != nil {
+		log.WithError(err).Error("error migrating archive")
+	}
+
+	return moved, err
+}
@@ -3,11 +3,7 @@
 
 package internal
 
-import (
-	"fmt"
-
-	log "github.com/sirupsen/logrus"
-)
+import "fmt"
 
 type AudioTask struct {
 	*BaseTask
@@ -17,20 +13,25 @@ type AudioTask struct {
 }
 
 func NewAudioTask(conf *Config, fn string) *AudioTask {
-	return &AudioTask{
+	task := &AudioTask{
 		BaseTask: NewBaseTask(),
 
 		conf: conf,
 		fn:   fn,
 	}
+	// Media tasks are for uploads users are waiting on
+	task.SetPriority(TaskPriorityInteractive)
+	return task
 }
 
 func (t *AudioTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *AudioTask) Kind() string   { return "audio" }
+func (t *AudioTask) Args() TaskData { return TaskData{"fn": t.fn} }
 func (t *AudioTask) Run() error {
 	defer t.Done()
 	t.SetState(TaskStateRunning)
 
-	log.Infof("starting audio transcode task for %s", t.fn)
+	Logger(LogMedia).Infof("starting audio transcode task for %s", t.fn)
 
 	opts := &AudioOptions{
 		Resample:   true,
@@ -40,10 +41,10 @@ func (t *AudioTask) Run() error {
 	}
 	mediaURI, err := TranscodeAudio(t.conf, t.fn, mediaDir, "", opts)
 	if err != nil {
-		log.WithError(err).Errorf("error transcoding audio %s", t.fn)
+		Logger(LogMedia).WithError(err).Errorf("error transcoding audio %s", t.fn)
 		return t.Fail(err)
 	}
-	log.Infof("audio transcode complete for %s with uri %s", t.fn, mediaURI)
+	Logger(LogMedia).Infof("audio transcode complete for %s with uri %s", t.fn, mediaURI)
 
 	t.SetData("mediaURI", mediaURI)
 
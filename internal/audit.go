@@ -0,0 +1,121 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+const (
+	auditLogFile = "audit.log"
+
+	// maxAuditEntries is the number of recent audit entries shown to the Pod
+	// Owner/Operator
+	maxAuditEntries = 50
+)
+
+// AuditEntry is an action taken by the Pod Owner/Operator on a user or feed
+type AuditEntry struct {
+	At      time.Time `json:"at"`
+	Actor   string    `json:"actor"`
+	Action  string    `json:"action"`
+	Target  string    `json:"target"`
+	Details string    `json:"details,omitempty"`
+}
+
+// AuditLog records the actions taken by the Pod Owner/Operator on users and
+// feeds to an append-only log in the data directory. A nil *AuditLog records
+// nothing.
+type AuditLog struct {
+	sync.Mutex
+
+	conf *Config
+}
+
+// NewAuditLog ...
+func NewAuditLog(conf *Config) *AuditLog {
+	return &AuditLog{conf: conf}
+}
+
+func (al *AuditLog) filename() string {
+	return filepath.Join(al.conf.Data, auditLogFile)
+}
+
+// Record appends an entry to the audit log
+func (al *AuditLog) Record(actor, action, target, details string) error {
+	if al == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(AuditEntry{
+		At:      time.Now(),
+		Actor:   actor,
+		Action:  action,
+		Target:  target,
+		Details: details,
+	})
+	if err != nil {
+		return err
+	}
+
+	al.Lock()
+	defer al.Unlock()
+
+	f, err := os.OpenFile(al.filename(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Entries returns the last n entries of the audit log, most recent first
+func (al *AuditLog) Entries(n int) ([]AuditEntry, error) {
+	if al == nil {
+		return nil, nil
+	}
+
+	al.Lock()
+	defer al.Unlock()
+
+	f, err := os.Open(al.filename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []AuditEntry
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		entries = append(entries, entry)
+		if len(entries) > n {
+			entries = entries[1:]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+
+	return entries, nil
+}
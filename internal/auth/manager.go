@@ -11,15 +11,20 @@ import (
 	"git.mills.io/yarnsocial/yarn/internal/session"
 )
 
+// CheckFunc reports whether the account logged into a session may still use
+// it. It is expected to log the account out of the session if it may not.
+type CheckFunc func(sess *session.Session, username string) bool
+
 // Options ...
 type Options struct {
 	login    string
 	register string
+	check    CheckFunc
 }
 
 // NewOptions ...
-func NewOptions(login, register string) *Options {
-	return &Options{login, register}
+func NewOptions(login, register string, check CheckFunc) *Options {
+	return &Options{login, register, check}
 }
 
 // Manager ...
@@ -32,14 +37,28 @@ func NewManager(options *Options) *Manager {
 	return &Manager{options}
 }
 
+// authenticated reports whether the request has a session with an account
+// logged into it that passes the check (if any)
+func (m *Manager) authenticated(r *http.Request) bool {
+	sess, ok := r.Context().Value(session.SessionKey).(*session.Session)
+	if !ok || sess == nil {
+		return false
+	}
+
+	username, ok := sess.Get("username")
+	if !ok {
+		return false
+	}
+
+	return m.options.check == nil || m.options.check(sess, username)
+}
+
 // MustAuth ...
 func (m *Manager) MustAuth(next httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if sess := r.Context().Value(session.SessionKey); sess != nil {
-			if _, ok := sess.(*session.Session).Get("username"); ok {
-				next(w, r, p)
-				return
-			}
+		if m.authenticated(r) {
+			next(w, r, p)
+			return
 		}
 
 		http.Redirect(w, r, m.options.login, http.StatusFound)
@@ -49,11 +68,9 @@ func (m *Manager) MustAuth(next httprouter.Handle) httprouter.Handle {
 // ShouldAuth ...
 func (m *Manager) ShouldAuth(next httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if sess := r.Context().Value(session.SessionKey); sess != nil {
-			if _, ok := sess.(*session.Session).Get("username"); ok {
-				next(w, r, p)
-				return
-			}
+		if m.authenticated(r) {
+			next(w, r, p)
+			return
 		}
 
 		http.Redirect(w, r, m.options.login, http.StatusFound)
@@ -62,11 +79,9 @@ func (m *Manager) ShouldAuth(next httprouter.Handle) httprouter.Handle {
 
 func (m *Manager) HasAuth(next httprouter.Handle) httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if sess := r.Context().Value(session.SessionKey); sess != nil {
-			if _, ok := sess.(*session.Session).Get("username"); ok {
-				http.Redirect(w, r, "/", http.StatusFound)
-				return
-			}
+		if m.authenticated(r) {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
 		}
 		next(w, r, p)
 	}
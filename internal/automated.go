@@ -0,0 +1,87 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"strings"
+
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+// botMetadataFields are the metadata fields with which a feed declares it is
+// automated (`# bot = true` and the older suggestion `# automated = true`)
+var botMetadataFields = []string{"bot", "automated"}
+
+// IsBotTwter returns true if the feed of a twter declares it is automated
+// in its metadata
+func IsBotTwter(twter *types.Twter) bool {
+	if twter == nil {
+		return false
+	}
+	for _, field := range botMetadataFields {
+		if strings.EqualFold(twter.Metadata.Get(field), "true") {
+			return true
+		}
+	}
+	return false
+}
+
+// AutomatedFeeds tracks the feeds of bots and other automated accounts, the
+// local users and feeds flagged as automated and the external feeds that
+// declare so in their metadata. Automated feeds are labeled as such and
+// kept out of the Pod's Discover timeline.
+type AutomatedFeeds struct {
+	sync.RWMutex
+
+	flagged  map[string]bool
+	declared map[string]bool
+}
+
+// NewAutomatedFeeds ...
+func NewAutomatedFeeds() *AutomatedFeeds {
+	return &AutomatedFeeds{
+		flagged:  make(map[string]bool),
+		declared: make(map[string]bool),
+	}
+}
+
+// automated are the automated feeds known to the Pod
+var automated = NewAutomatedFeeds()
+
+// Flag flags (or unflags) a local user's or feed's feed as automated
+func (af *AutomatedFeeds) Flag(uri string, isAutomated bool) {
+	af.Lock()
+	defer af.Unlock()
+
+	uri = NormalizeURL(uri)
+	if isAutomated {
+		af.flagged[uri] = true
+	} else {
+		delete(af.flagged, uri)
+	}
+}
+
+// Declare records whether an external feed declares it is automated in its
+// metadata (See: IsBotTwter)
+func (af *AutomatedFeeds) Declare(uri string, twter *types.Twter) {
+	af.Lock()
+	defer af.Unlock()
+
+	uri = NormalizeURL(uri)
+	if IsBotTwter(twter) {
+		af.declared[uri] = true
+	} else {
+		delete(af.declared, uri)
+	}
+}
+
+// IsAutomated returns true if the feed is automated
+func (af *AutomatedFeeds) IsAutomated(uri string) bool {
+	af.RLock()
+	defer af.RUnlock()
+
+	uri = NormalizeURL(uri)
+	return af.flagged[uri] || af.declared[uri]
+}
@@ -0,0 +1,37 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.yarn.social/types"
+)
+
+func TestAutomatedFeeds(t *testing.T) {
+	af := NewAutomatedFeeds()
+
+	const (
+		local    = "https://example.com/user/stats/twtxt.txt"
+		external = "https://example.org/twtxt.txt"
+	)
+
+	assert.False(t, af.IsAutomated(local))
+
+	af.Flag(local, true)
+	assert.True(t, af.IsAutomated(local))
+	af.Flag(local, false)
+	assert.False(t, af.IsAutomated(local))
+
+	af.Declare(external, &types.Twter{URI: external, Metadata: url.Values{"bot": []string{"true"}}})
+	assert.True(t, af.IsAutomated(external))
+	af.Declare(external, &types.Twter{URI: external})
+	assert.False(t, af.IsAutomated(external))
+
+	assert.True(t, IsBotTwter(&types.Twter{Metadata: url.Values{"automated": []string{"True"}}}))
+	assert.False(t, IsBotTwter(&types.Twter{Metadata: url.Values{"bot": []string{"false"}}}))
+	assert.False(t, IsBotTwter(nil))
+}
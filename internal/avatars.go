@@ -0,0 +1,219 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"math"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/nullrocks/identicon"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	// AvatarStyleIdenticon is the classic symmetric identicon (the default)
+	AvatarStyleIdenticon = "identicon"
+
+	// AvatarStyleRings are concentric rings
+	AvatarStyleRings = "rings"
+
+	// AvatarStyleInitials are the initials of the nick on a solid color
+	AvatarStyleInitials = "initials"
+)
+
+// AvatarStyles are the available styles of generated avatars
+var AvatarStyles = []string{AvatarStyleIdenticon, AvatarStyleRings, AvatarStyleInitials}
+
+// IsAvatarStyle returns true if style is a valid generated avatar style
+func IsAvatarStyle(style string) bool {
+	for _, s := range AvatarStyles {
+		if s == style {
+			return true
+		}
+	}
+	return false
+}
+
+// avatarColor derives a saturated color from a hash byte
+func avatarColor(h byte, lightness float64) color.RGBA {
+	hue := float64(h) / 256 * 360
+	s, l := 0.55, lightness
+
+	c := (1 - math.Abs(2*l-1)) * s
+	x := c * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := l - c/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = c, x, 0
+	case hue < 120:
+		r, g, b = x, c, 0
+	case hue < 180:
+		r, g, b = 0, c, x
+	case hue < 240:
+		r, g, b = 0, x, c
+	case hue < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+
+	return color.RGBA{
+		R: uint8((r + m) * 255),
+		G: uint8((g + m) * 255),
+		B: uint8((b + m) * 255),
+		A: 0xff,
+	}
+}
+
+func generateIdenticon(conf *Config, name string) (image.Image, error) {
+	ig, err := identicon.New(conf.Name, 7, 4)
+	if err != nil {
+		log.WithError(err).Error("error creating identicon generator")
+		return nil, err
+	}
+
+	ii, err := ig.Draw(name)
+	if err != nil {
+		log.WithError(err).Errorf("error generating identicon for %s", name)
+		return nil, err
+	}
+
+	return ii.Image(conf.AvatarResolution), nil
+}
+
+func generateRings(size int, hash []byte) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	rings := 3 + int(hash[0]%3)
+	colors := make([]color.RGBA, rings)
+	for i := range colors {
+		colors[i] = avatarColor(hash[1+i], 0.35+0.1*float64(i%3))
+	}
+
+	center := float64(size) / 2
+	width := center / float64(rings)
+
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			d := math.Hypot(float64(x)+0.5-center, float64(y)+0.5-center)
+			if d > center {
+				continue
+			}
+			ring := int(d / width)
+			if ring >= rings {
+				ring = rings - 1
+			}
+			img.SetRGBA(x, y, colors[ring])
+		}
+	}
+
+	return img
+}
+
+// avatarInitials returns up to two initials of a nick (or domain nick)
+func avatarInitials(name string) string {
+	if i := strings.Index(name, "@"); i > 0 {
+		name = name[:i]
+	}
+
+	var initials []rune
+	next := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			next = true
+			continue
+		}
+		if next || len(initials) == 0 {
+			initials = append(initials, unicode.ToUpper(r))
+			next = false
+		}
+		if len(initials) == 2 {
+			break
+		}
+	}
+
+	// A single word gets its first two letters
+	if len(initials) == 1 {
+		for i, r := range name {
+			if i > 0 && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+				initials = append(initials, unicode.ToUpper(r))
+				break
+			}
+		}
+	}
+
+	if len(initials) == 0 {
+		return "?"
+	}
+	return string(initials)
+}
+
+func generateInitials(size int, hash []byte, name string) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	draw.Draw(img, img.Bounds(), &image.Uniform{avatarColor(hash[0], 0.4)}, image.Point{}, draw.Src)
+
+	// Render the initials with the basic bitmap font then scale them up
+	face := basicfont.Face7x13
+	text := avatarInitials(name)
+	width := font.MeasureString(face, text).Ceil()
+	height := face.Metrics().Height.Ceil()
+
+	glyphs := image.NewRGBA(image.Rect(0, 0, width, height))
+	d := &font.Drawer{
+		Dst:  glyphs,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P(0, face.Metrics().Ascent.Ceil()),
+	}
+	d.DrawString(text)
+
+	scale := size / 2 / width
+	if scale < 1 {
+		scale = 1
+	}
+	offsetX := (size - width*scale) / 2
+	offsetY := (size - height*scale) / 2
+
+	for y := 0; y < height*scale; y++ {
+		for x := 0; x < width*scale; x++ {
+			if _, _, _, a := glyphs.At(x/scale, y/scale).RGBA(); a > 0 {
+				img.Set(offsetX+x, offsetY+y, color.White)
+			}
+		}
+	}
+
+	return img
+}
+
+// HasUploadedAvatar returns true if the user or feed has uploaded an avatar
+func HasUploadedAvatar(conf *Config, name string) bool {
+	return FileExists(filepath.Join(conf.Data, avatarsDir, fmt.Sprintf("%s.png", name)))
+}
+
+// GenerateAvatarWithStyle generates an avatar for name in the given style.
+// The seed lets users regenerate a different avatar of the same style.
+func GenerateAvatarWithStyle(conf *Config, style, name, seed string) (image.Image, error) {
+	hash := sha256.Sum256([]byte(conf.Name + name + seed))
+
+	switch style {
+	case AvatarStyleRings:
+		return generateRings(conf.AvatarResolution, hash[:]), nil
+	case AvatarStyleInitials:
+		return generateInitials(conf.AvatarResolution, hash[:], name), nil
+	default:
+		return generateIdenticon(conf, name+seed)
+	}
+}
@@ -16,6 +16,11 @@ type BaseTask struct {
 	data  TaskData
 	err   error
 	id    string
+
+	// requestID is the ID of the request (if any) that dispatched the task
+	requestID string
+
+	priority TaskPriority
 }
 
 func NewBaseTask() *BaseTask {
@@ -25,6 +30,14 @@ func NewBaseTask() *BaseTask {
 	}
 }
 
+// setID sets the id of a new task, used to restore persisted tasks (See:
+// TaskRecord)
+func (t *BaseTask) setID(id string) {
+	t.mu.Lock()
+	t.id = id
+	t.mu.Unlock()
+}
+
 func (t *BaseTask) SetState(state TaskState) {
 	t.mu.Lock()
 	t.state = state
@@ -84,6 +97,36 @@ func (t *BaseTask) ID() string {
 	return t.id
 }
 
+// SetRequestID ...
+func (t *BaseTask) SetRequestID(id string) {
+	t.mu.Lock()
+	t.requestID = id
+	t.mu.Unlock()
+}
+
+// RequestID returns the ID of the request that dispatched the task (if any)
+func (t *BaseTask) RequestID() string {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.requestID
+}
+
+// SetPriority ...
+func (t *BaseTask) SetPriority(priority TaskPriority) {
+	t.mu.Lock()
+	t.priority = priority
+	t.mu.Unlock()
+}
+
+// Priority returns the priority of the task (See: TaskPriority)
+func (t *BaseTask) Priority() TaskPriority {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return t.priority
+}
+
 func (t *BaseTask) State() TaskState {
 	t.mu.RLock()
 	defer t.mu.RUnlock()
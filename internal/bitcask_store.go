@@ -18,7 +18,9 @@ import (
 
 const (
 	feedsKeyPrefix    = "/feeds"
+	peersKeyPrefix    = "/peers"
 	sessionsKeyPrefix = "/sessions"
+	tasksKeyPrefix    = "/tasks"
 	usersKeyPrefix    = "/users"
 )
 
@@ -27,6 +29,8 @@ type BitcaskStore struct {
 	db *bitcask.Bitcask
 }
 
+var _ RawStore = (*BitcaskStore)(nil)
+
 func newBitcaskStore(path string) (*BitcaskStore, error) {
 	db, err := bitcask.Open(
 		path,
@@ -60,6 +64,89 @@ func (bs *BitcaskStore) scanKeys(prefix string) (keys [][]byte, err error) {
 	return
 }
 
+func rawKey(kind, name string) ([]byte, error) {
+	switch kind {
+	case StoreKindFeeds, StoreKindPeers, StoreKindSessions, StoreKindTasks, StoreKindUsers:
+		return []byte(fmt.Sprintf("/%s/%s", kind, name)), nil
+	default:
+		return nil, fmt.Errorf("error: unknown kind of record %q", kind)
+	}
+}
+
+// ListRaw returns the names of all records of kind
+func (bs *BitcaskStore) ListRaw(kind string) ([]string, error) {
+	prefix, err := rawKey(kind, "")
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := bs.scanKeys(string(prefix))
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, key := range keys {
+		names = append(names, strings.TrimPrefix(string(key), string(prefix)))
+	}
+	return names, nil
+}
+
+// GetRaw returns the raw (undecoded) record of kind with the given name
+func (bs *BitcaskStore) GetRaw(kind, name string) ([]byte, error) {
+	key, err := rawKey(kind, name)
+	if err != nil {
+		return nil, err
+	}
+	return bs.db.Get(key)
+}
+
+// SetRaw sets the raw record of kind with the given name once validated
+func (bs *BitcaskStore) SetRaw(kind, name string, data []byte) error {
+	key, err := rawKey(kind, name)
+	if err != nil {
+		return err
+	}
+	if err := ValidateStoreRecord(kind, data); err != nil {
+		return err
+	}
+	return bs.db.Put(key, data)
+}
+
+// DelRaw deletes the record of kind with the given name
+func (bs *BitcaskStore) DelRaw(kind, name string) error {
+	key, err := rawKey(kind, name)
+	if err != nil {
+		return err
+	}
+	return bs.db.Delete(key)
+}
+
+// Fsck checks that all records of the store can be decoded and returns the
+// problems found
+func (bs *BitcaskStore) Fsck() ([]StoreProblem, error) {
+	var problems []StoreProblem
+
+	for _, kind := range []string{StoreKindFeeds, StoreKindPeers, StoreKindSessions, StoreKindTasks, StoreKindUsers} {
+		names, err := bs.ListRaw(kind)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, name := range names {
+			data, err := bs.GetRaw(kind, name)
+			if err == nil {
+				err = ValidateStoreRecord(kind, data)
+			}
+			if err != nil {
+				problems = append(problems, StoreProblem{Kind: kind, Name: name, Err: err})
+			}
+		}
+	}
+
+	return problems, nil
+}
+
 // Sync ...
 func (bs *BitcaskStore) Sync() error {
 	return bs.db.Sync()
@@ -344,3 +431,100 @@ func (bs *BitcaskStore) GetAllSessions() ([]*session.Session, error) {
 
 	return sessions, nil
 }
+
+func (bs *BitcaskStore) DelPeer(uri string) error {
+	key := []byte(fmt.Sprintf("%s/%s", peersKeyPrefix, uri))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) GetPeer(uri string) (*ManagedPeer, error) {
+	key := []byte(fmt.Sprintf("%s/%s", peersKeyPrefix, uri))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrPeerNotFound
+	}
+	return LoadManagedPeer(data)
+}
+
+func (bs *BitcaskStore) SetPeer(uri string, peer *ManagedPeer) error {
+	data, err := peer.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", peersKeyPrefix, uri))
+	return bs.db.Put(key, data)
+}
+
+func (bs *BitcaskStore) GetAllPeers() ([]*ManagedPeer, error) {
+	var peers []*ManagedPeer
+
+	keys, err := bs.scanKeys(peersKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		peer, err := LoadManagedPeer(data)
+		if err != nil {
+			return nil, err
+		}
+		peers = append(peers, peer)
+	}
+
+	return peers, nil
+}
+
+func (bs *BitcaskStore) DelTask(id string) error {
+	key := []byte(fmt.Sprintf("%s/%s", tasksKeyPrefix, id))
+	return bs.db.Delete(key)
+}
+
+func (bs *BitcaskStore) GetTask(id string) (*TaskRecord, error) {
+	key := []byte(fmt.Sprintf("%s/%s", tasksKeyPrefix, id))
+	data, err := bs.db.Get(key)
+	if err == bitcask.ErrKeyNotFound {
+		return nil, ErrTaskNotFound
+	}
+	return LoadTaskRecord(data)
+}
+
+func (bs *BitcaskStore) SetTask(id string, task *TaskRecord) error {
+	data, err := task.Bytes()
+	if err != nil {
+		return err
+	}
+
+	key := []byte(fmt.Sprintf("%s/%s", tasksKeyPrefix, id))
+	return bs.db.Put(key, data)
+}
+
+func (bs *BitcaskStore) GetAllTasks() ([]*TaskRecord, error) {
+	var tasks []*TaskRecord
+
+	keys, err := bs.scanKeys(tasksKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range keys {
+		data, err := bs.db.Get(key)
+		if err != nil {
+			return nil, err
+		}
+
+		task, err := LoadTaskRecord(data)
+		if err != nil {
+			log.WithError(err).Warnf("error loading task %s", key)
+			continue
+		}
+		tasks = append(tasks, task)
+	}
+
+	return tasks, nil
+}
@@ -5,7 +5,6 @@ package internal
 
 import (
 	"net/http"
-	"sort"
 
 	"go.yarn.social/types"
 	"github.com/julienschmidt/httprouter"
@@ -79,21 +78,6 @@ func (s *Server) BookmarksHandler() httprouter.Handle {
 
 		var twts types.Twts
 
-		getTwts := func(hashes []string) (twts types.Twts) {
-			for _, hash := range hashes {
-				if twt, ok := s.cache.Lookup(hash); ok {
-					twts = append(twts, twt)
-				} else if s.archive.Has(hash) {
-					if twt, err := s.archive.Get(hash); err == nil {
-						twts = append(twts, twt)
-					} else {
-						log.WithError(err).Errorf("error loading twt %s from archive", hash)
-					}
-				}
-			}
-			return
-		}
-
 		if s.db.HasUser(nick) {
 			user, err := s.db.GetUser(nick)
 			if err != nil {
@@ -108,8 +92,14 @@ func (s *Server) BookmarksHandler() httprouter.Handle {
 				s.render("401", w, ctx)
 				return
 			}
-			twts = getTwts(StringKeys(user.Bookmarks))
-			sort.Sort(twts)
+
+			ctx.BookmarkFolder = r.FormValue("folder")
+			ctx.BookmarkTag = r.FormValue("tag")
+			ctx.BookmarkFolders = user.BookmarkFolders()
+			ctx.BookmarkTags = user.BookmarkTags()
+			ctx.IsBookmarksOwner = ctx.User.Is(user.URL)
+
+			twts = s.getBookmarkedTwts(user.FilterBookmarks(ctx.BookmarkFolder, ctx.BookmarkTag))
 		} else {
 			ctx.Error = true
 			ctx.Message = "User Not Found"
@@ -120,7 +110,7 @@ func (s *Server) BookmarksHandler() httprouter.Handle {
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config().TwtsPerPage)
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
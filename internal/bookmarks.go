@@ -0,0 +1,327 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+	"go.yarn.social/types"
+)
+
+// maxBookmarkNote is the maximum length of the note of a bookmark
+const maxBookmarkNote = 1024
+
+// BookmarkDetails are the folder, tags and private note of a user's bookmark
+type BookmarkDetails struct {
+	Folder string   `json:"folder,omitempty"`
+	Tags   []string `json:"tags,omitempty"`
+	Note   string   `json:"note,omitempty"`
+}
+
+// IsZero returns true if the bookmark has no folder, tags nor note
+func (d BookmarkDetails) IsZero() bool {
+	return d.Folder == "" && len(d.Tags) == 0 && d.Note == ""
+}
+
+// HasTag returns true if the bookmark is tagged with tag
+func (d BookmarkDetails) HasTag(tag string) bool {
+	for _, t := range d.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseBookmarkTags parses comma or space separated tags (See:
+// NormalizeBookmarkTags)
+func ParseBookmarkTags(s string) []string {
+	return NormalizeBookmarkTags(strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	}))
+}
+
+// NormalizeBookmarkTags lowercases tags and strips their leading #, empty
+// and duplicate tags are dropped and the tags are sorted
+func NormalizeBookmarkTags(tags []string) []string {
+	var normalized []string
+
+	seen := make(map[string]bool)
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimLeft(strings.TrimSpace(tag), "#"))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	sort.Strings(normalized)
+
+	return normalized
+}
+
+// GetBookmarkDetails returns the details of the user's bookmark of a twt
+func (u *User) GetBookmarkDetails(hash string) BookmarkDetails {
+	return u.BookmarkDetails[hash]
+}
+
+// SetBookmarkDetails sets the folder, tags and note of the user's bookmark
+// of a twt, bookmarking the twt if not already bookmarked
+func (u *User) SetBookmarkDetails(hash string, details BookmarkDetails) {
+	if u.BookmarkDetails == nil {
+		u.BookmarkDetails = make(map[string]BookmarkDetails)
+	}
+
+	u.Bookmarks[hash] = ""
+
+	details.Folder = strings.TrimSpace(details.Folder)
+	details.Tags = NormalizeBookmarkTags(details.Tags)
+	details.Note = strings.TrimSpace(details.Note)
+	if note := []rune(details.Note); len(note) > maxBookmarkNote {
+		details.Note = string(note[:maxBookmarkNote])
+	}
+
+	if details.IsZero() {
+		delete(u.BookmarkDetails, hash)
+		return
+	}
+	u.BookmarkDetails[hash] = details
+}
+
+// BookmarkFolders returns the folders of the user's bookmarks, sorted
+func (u *User) BookmarkFolders() []string {
+	var folders []string
+
+	seen := make(map[string]bool)
+	for hash, details := range u.BookmarkDetails {
+		if !u.Bookmarked(hash) || details.Folder == "" || seen[details.Folder] {
+			continue
+		}
+		seen[details.Folder] = true
+		folders = append(folders, details.Folder)
+	}
+	sort.Strings(folders)
+
+	return folders
+}
+
+// BookmarkTags returns the tags of the user's bookmarks, sorted
+func (u *User) BookmarkTags() []string {
+	var tags []string
+	for hash, details := range u.BookmarkDetails {
+		if u.Bookmarked(hash) {
+			tags = append(tags, details.Tags...)
+		}
+	}
+	return NormalizeBookmarkTags(tags)
+}
+
+// FilterBookmarks returns the hashes of the user's bookmarks in folder and
+// tagged with tag, an empty folder or tag matches any bookmark
+func (u *User) FilterBookmarks(folder, tag string) []string {
+	tag = strings.ToLower(strings.TrimLeft(tag, "#"))
+
+	var hashes []string
+	for hash := range u.Bookmarks {
+		details := u.GetBookmarkDetails(hash)
+		if folder != "" && details.Folder != folder {
+			continue
+		}
+		if tag != "" && !details.HasTag(tag) {
+			continue
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes
+}
+
+// getBookmarkedTwts returns the bookmarked twts (from the cache or archive)
+func (s *Server) getBookmarkedTwts(hashes []string) (twts types.Twts) {
+	for _, hash := range hashes {
+		if twt, ok := s.cache.Lookup(hash); ok {
+			twts = append(twts, twt)
+		} else if s.archive.Has(hash) {
+			if twt, err := s.archive.Get(hash); err == nil {
+				twts = append(twts, twt)
+			} else {
+				log.WithError(err).Errorf("error loading twt %s from archive", hash)
+			}
+		}
+	}
+	sort.Sort(twts)
+	return
+}
+
+// BookmarkDetailsHandler sets the folder, tags and note of a bookmark
+func (s *Server) BookmarkDetailsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		hash := p.ByName("hash")
+		if hash == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if _, ok := s.cache.Lookup(hash); !ok && !s.archive.Has(hash) && !ctx.User.Bookmarked(hash) {
+			ctx.Error = true
+			ctx.Message = "No matching twt found!"
+			s.render("404", w, ctx)
+			return
+		}
+
+		ctx.User.SetBookmarkDetails(hash, BookmarkDetails{
+			Folder: r.FormValue("folder"),
+			Tags:   ParseBookmarkTags(r.FormValue("tags")),
+			Note:   r.FormValue("note"),
+		})
+
+		if err := s.db.SetUser(ctx.Username, ctx.User); err != nil {
+			ctx.Error = true
+			ctx.Message = "Error updating user"
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, RedirectRefererURL(r, s.config(), "/user/"+ctx.Username+"/bookmarks"), http.StatusFound)
+	}
+}
+
+// BookmarksRequest is a paged request of the user's bookmarks in a folder
+// and/or tagged with a tag
+type BookmarksRequest struct {
+	Page   int    `json:"page"`
+	Folder string `json:"folder"`
+	Tag    string `json:"tag"`
+}
+
+// BookmarksResponse is a page of the user's bookmarked twts and the details
+// of all of the user's bookmarks by twt hash
+type BookmarksResponse struct {
+	Twts      types.Twts                 `json:"twts"`
+	Pager     types.PagerResponse        `json:"Pager"`
+	Folders   []string                   `json:"folders"`
+	Tags      []string                   `json:"tags"`
+	Bookmarks map[string]BookmarkDetails `json:"bookmarks"`
+}
+
+// BookmarkRequest bookmarks a twt (with details) or removes a bookmark
+type BookmarkRequest struct {
+	Hash   string   `json:"hash"`
+	Folder string   `json:"folder"`
+	Tags   []string `json:"tags"`
+	Note   string   `json:"note"`
+	Remove bool     `json:"remove"`
+}
+
+// BookmarksEndpoint returns a page of the user's bookmarks filtered by
+// folder and/or tag
+func (a *API) BookmarksEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		var req BookmarksRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apiLogger(r).WithError(err).Error("error parsing bookmarks request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		var twts types.Twts
+		for _, hash := range user.FilterBookmarks(req.Folder, req.Tag) {
+			if twt, ok := a.cache.Lookup(hash); ok {
+				twts = append(twts, twt)
+			} else if a.archive.Has(hash) {
+				if twt, err := a.archive.Get(hash); err == nil {
+					twts = append(twts, twt)
+				}
+			}
+		}
+		sort.Sort(twts)
+
+		var pagedTwts types.Twts
+
+		pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
+		pager.SetPage(req.Page)
+
+		if err := pager.Results(&pagedTwts); err != nil {
+			apiLogger(r).WithError(err).Error("error loading bookmarks")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		res := BookmarksResponse{
+			Twts: pagedTwts,
+			Pager: types.PagerResponse{
+				Current:   pager.Page(),
+				MaxPages:  pager.PageNums(),
+				TotalTwts: pager.Nums(),
+			},
+			Folders:   user.BookmarkFolders(),
+			Tags:      user.BookmarkTags(),
+			Bookmarks: make(map[string]BookmarkDetails),
+		}
+		for hash := range user.Bookmarks {
+			res.Bookmarks[hash] = user.GetBookmarkDetails(hash)
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// BookmarkEndpoint bookmarks a twt and sets the bookmark's folder, tags and
+// note, or removes the bookmark
+func (a *API) BookmarkEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		var req BookmarkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Hash == "" {
+			apiLogger(r).WithError(err).Error("error parsing bookmark request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if req.Remove {
+			delete(user.Bookmarks, req.Hash)
+			delete(user.BookmarkDetails, req.Hash)
+		} else {
+			if _, ok := a.cache.Lookup(req.Hash); !ok && !a.archive.Has(req.Hash) && !user.Bookmarked(req.Hash) {
+				apiError(w, http.StatusNotFound, ErrCodeNotFound, "Twt Not Found")
+				return
+			}
+			user.SetBookmarkDetails(req.Hash, BookmarkDetails{
+				Folder: req.Folder,
+				Tags:   req.Tags,
+				Note:   req.Note,
+			})
+		}
+
+		if err := a.db.SetUser(user.Username, user); err != nil {
+			apiLogger(r).WithError(err).Error("error updating user object")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "User Update Failed")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBookmarkTags(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"go", "read-later"}, ParseBookmarkTags("#Go, read-later  go"))
+	assert.Empty(ParseBookmarkTags(" , "))
+}
+
+func TestFilterBookmarks(t *testing.T) {
+	assert := assert.New(t)
+
+	user := NewUser()
+	user.Bookmark("aaaaaaa")
+	user.SetBookmarkDetails("bbbbbbb", BookmarkDetails{Folder: "Recipes", Tags: []string{"#Vegan"}})
+	user.SetBookmarkDetails("ccccccc", BookmarkDetails{Folder: " Recipes ", Note: "try this"})
+
+	assert.Equal([]string{"Recipes"}, user.BookmarkFolders())
+	assert.Equal([]string{"vegan"}, user.BookmarkTags())
+
+	all := user.FilterBookmarks("", "")
+	sort.Strings(all)
+	assert.Equal([]string{"aaaaaaa", "bbbbbbb", "ccccccc"}, all)
+
+	recipes := user.FilterBookmarks("Recipes", "")
+	sort.Strings(recipes)
+	assert.Equal([]string{"bbbbbbb", "ccccccc"}, recipes)
+
+	assert.Equal([]string{"bbbbbbb"}, user.FilterBookmarks("Recipes", "#vegan"))
+
+	// Removing a bookmark removes its details
+	user.Bookmark("bbbbbbb")
+	assert.Empty(user.BookmarkTags())
+	assert.NotContains(user.BookmarkDetails, "bbbbbbb")
+}
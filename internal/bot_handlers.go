@@ -0,0 +1,207 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// ErrFeedOwnerNotFound is returned when no user owns a feed
+var ErrFeedOwnerNotFound = errors.New("error: feed owner not found")
+
+// FindFeedOwner returns the user that owns the named feed
+func FindFeedOwner(conf *Config, db Store, name string) (*User, error) {
+	isAdminUser := IsAdminUserFactory(conf)
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, user := range users {
+		if user.OwnsFeed(name) {
+			return user, nil
+		}
+	}
+
+	if IsSpecialFeed(name) {
+		for _, user := range users {
+			if isAdminUser(user) {
+				return user, nil
+			}
+		}
+	}
+
+	return nil, ErrFeedOwnerNotFound
+}
+
+// HasBotToken returns true if a bot token has been issued for the feed
+func (f *Feed) HasBotToken() bool {
+	return f.BotTokenHash != ""
+}
+
+// IsBotToken returns true if the token is the feed's current bot token
+func (f *Feed) IsBotToken(token string) bool {
+	if f.BotTokenHash == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(f.BotTokenHash), []byte(FastHashString(token))) == 1
+}
+
+// BotPostHandler allows bots to publish twts to a single feed using the
+// feed's bot token. Bot tokens are scoped to the feed they were issued for
+// and cannot be used to post to the owner's feed or change any settings.
+func (s *Server) BotPostHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		feedName := NormalizeFeedName(p.ByName("name"))
+
+		token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer"))
+		if token == "" {
+			http.Error(w, "No Token Provided", http.StatusUnauthorized)
+			return
+		}
+
+		feed, err := s.db.GetFeed(feedName)
+		if err != nil {
+			http.Error(w, "Invalid Token", http.StatusUnauthorized)
+			return
+		}
+
+		if !feed.IsBotToken(token) {
+			log.Warnf("invalid bot token used for feed %s", feedName)
+			http.Error(w, "Invalid Token", http.StatusUnauthorized)
+			return
+		}
+
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, int64(s.config().MaxTwtLength*4))
+		defer r.Body.Close()
+
+		var text string
+
+		ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch ctype {
+		case "application/x-www-form-urlencoded", "multipart/form-data":
+			text = r.FormValue("text")
+		default:
+			data, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			text = string(data)
+		}
+
+		text = CleanTwt(text)
+		if text == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		owner, err := FindFeedOwner(s.config(), s.db, feed.Name)
+		if err != nil {
+			log.WithError(err).Errorf("error finding owner of feed %s", feed.Name)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Bots of suspended or disabled accounts cannot post
+		if !owner.IsActive() {
+			http.Error(w, "Account Inactive", http.StatusForbidden)
+			return
+		}
+
+		twt, err := s.AppendTwt(owner, feed, text)
+		if err != nil {
+			log.WithError(err).Errorf("error posting bot twt to feed %s", feed.Name)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Bot twts have the visibility of the owner's twts by default
+		feedURL := s.config().URLForUser(feed.Name)
+		PublishTwts(s.config(), s.tasks, owner, feedURL, "", twt)
+
+		s.cache.InjectFeed(feedURL, twt)
+
+		data, err := json.Marshal(map[string]string{
+			"hash": twt.Hash(),
+			"url":  URLForTwt(s.config().BaseURL, twt.Hash()),
+		})
+		if err != nil {
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write(data)
+	}
+}
+
+// ManageFeedTokenHandler rotates or revokes a feed's bot token
+func (s *Server) ManageFeedTokenHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+	canManageFeed := func(feed string, u *User) bool {
+		if u.OwnsFeed(feed) {
+			return true
+		}
+		if IsSpecialFeed(feed) && isAdminUser(u) {
+			return true
+		}
+		return false
+	}
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		feedName := NormalizeFeedName(p.ByName("name"))
+
+		feed, err := s.db.GetFeed(feedName)
+		if err != nil {
+			log.WithError(err).Errorf("error loading feed object for %s", feedName)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorGetFeed")
+			s.render("error", w, ctx)
+			return
+		}
+
+		if !canManageFeed(feed.Name, ctx.User) {
+			ctx.Error = true
+			s.render("401", w, ctx)
+			return
+		}
+
+		var token string
+		if r.FormValue("action") == "revoke" {
+			feed.BotTokenHash = ""
+		} else {
+			token = GenerateRandomToken()
+			feed.BotTokenHash = FastHashString(token)
+		}
+
+		if err := s.db.SetFeed(feed.Name, feed); err != nil {
+			log.WithError(err).Errorf("error updating bot token for feed %s", feed.Name)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorSetFeed")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Profile = feed.Profile(s.config().BaseURL, ctx.User)
+		ctx.BotToken = token
+		ctx.HasBotToken = feed.HasBotToken()
+		ctx.BotPostURL = URLForBotPost(s.config().BaseURL, feed.Name)
+		ctx.Title = s.tr(ctx, "PageManageFeedTitle", map[string]interface{}{"Feed": feed.Name})
+		s.render("manageFeed", w, ctx)
+	}
+}
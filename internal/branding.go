@@ -0,0 +1,196 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const brandingDir = "branding"
+
+// Branding variants uploaded by the Pod Owner/Operator on /manage/pod
+const (
+	BrandingLogoLight    = "logo-light"
+	BrandingLogoDark     = "logo-dark"
+	BrandingFaviconLight = "favicon-light"
+	BrandingFaviconDark  = "favicon-dark"
+)
+
+// BrandingVariants are the branding images that can be uploaded
+var BrandingVariants = []string{
+	BrandingLogoLight, BrandingLogoDark,
+	BrandingFaviconLight, BrandingFaviconDark,
+}
+
+// ErrInvalidBrandingVariant is returned for an unknown branding variant
+var ErrInvalidBrandingVariant = errors.New("error: invalid branding variant")
+
+// IsBrandingVariant returns true if variant is a branding variant
+func IsBrandingVariant(variant string) bool {
+	for _, v := range BrandingVariants {
+		if v == variant {
+			return true
+		}
+	}
+	return false
+}
+
+// brandingImageOptions returns the size uploaded branding images are resized
+// to fit, logos fit the header and favicons are square
+func brandingImageOptions(variant string) *ImageOptions {
+	if strings.HasPrefix(variant, "favicon") {
+		return &ImageOptions{Resize: true, Width: 64, Height: 64}
+	}
+	return &ImageOptions{Resize: true, Width: 512, Height: 128}
+}
+
+// Branding are the urls of the uploaded branding images (empty if not
+// uploaded), the dark variants are shown to visitors who prefer a dark color
+// scheme
+type Branding struct {
+	LogoLight    string
+	LogoDark     string
+	FaviconLight string
+	FaviconDark  string
+}
+
+// HasLogo returns true if a light or dark logo was uploaded
+func (b Branding) HasLogo() bool { return b.LogoLight != "" || b.LogoDark != "" }
+
+// HasFavicon returns true if a light or dark favicon was uploaded
+func (b Branding) HasFavicon() bool { return b.FaviconLight != "" || b.FaviconDark != "" }
+
+// Logo returns the logo shown by default (the light logo if uploaded)
+func (b Branding) Logo() string {
+	if b.LogoLight != "" {
+		return b.LogoLight
+	}
+	return b.LogoDark
+}
+
+// Favicon returns the favicon used by default (the light favicon if uploaded)
+func (b Branding) Favicon() string {
+	if b.FaviconLight != "" {
+		return b.FaviconLight
+	}
+	return b.FaviconDark
+}
+
+// GetBranding returns the urls of the Pod's uploaded branding images, the
+// urls include the image's hash to bust caches when replaced
+func (c *Config) GetBranding() Branding {
+	url := func(variant string) string {
+		hash, ok := c.Branding[variant]
+		if !ok {
+			return ""
+		}
+		return fmt.Sprintf("/branding/%s?v=%s", variant, hash)
+	}
+
+	return Branding{
+		LogoLight:    url(BrandingLogoLight),
+		LogoDark:     url(BrandingLogoDark),
+		FaviconLight: url(BrandingFaviconLight),
+		FaviconDark:  url(BrandingFaviconDark),
+	}
+}
+
+// brandingImage returns the file of an uploaded branding image (empty if
+// not uploaded)
+func brandingImage(conf *Config, variant string) string {
+	for _, ext := range []string{"png", "gif"} {
+		fn := filepath.Join(conf.Data, brandingDir, fmt.Sprintf("%s.%s", variant, ext))
+		if FileExists(fn) {
+			return fn
+		}
+	}
+	return ""
+}
+
+// removeBrandingImage removes the files of an uploaded branding image
+func removeBrandingImage(conf *Config, variant string) {
+	files, _ := filepath.Glob(filepath.Join(conf.Data, brandingDir, fmt.Sprintf("%s.*", variant)))
+	for _, fn := range files {
+		if err := os.Remove(fn); err != nil {
+			log.WithError(err).Warnf("error removing branding image %s", fn)
+		}
+	}
+}
+
+// StoreBrandingImage resizes and stores an uploaded branding image replacing
+// the previous one of the variant
+func StoreBrandingImage(conf *Config, variant string, r io.Reader) error {
+	if !IsBrandingVariant(variant) {
+		return ErrInvalidBrandingVariant
+	}
+
+	fn, err := ReceiveImage(r)
+	if err != nil {
+		return err
+	}
+
+	removeBrandingImage(conf, variant)
+
+	if _, err := ProcessImage(conf, fn, brandingDir, variant, brandingImageOptions(variant)); err != nil {
+		return err
+	}
+
+	// Only the resized image is served
+	orig, _ := filepath.Glob(filepath.Join(conf.Data, brandingDir, fmt.Sprintf("%s.orig.*", variant)))
+	for _, fn := range orig {
+		os.Remove(fn)
+	}
+
+	hash, err := FastHashFile(brandingImage(conf, variant))
+	if err != nil {
+		return err
+	}
+
+	if conf.Branding == nil {
+		conf.Branding = make(map[string]string)
+	}
+	conf.Branding[variant] = hash
+
+	return nil
+}
+
+// RemoveBrandingImage removes an uploaded branding image
+func RemoveBrandingImage(conf *Config, variant string) {
+	removeBrandingImage(conf, variant)
+	delete(conf.Branding, variant)
+}
+
+// BrandingHandler serves the Pod's uploaded branding images
+func (s *Server) BrandingHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		variant := p.ByName("variant")
+		if !IsBrandingVariant(variant) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		fn := brandingImage(s.config(), variant)
+		if fn == "" {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		if hash := r.URL.Query().Get("v"); hash != "" && hash == s.config().Branding[variant] {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		} else {
+			w.Header().Set("Cache-Control", "public, no-cache, must-revalidate")
+		}
+
+		http.ServeFile(w, r, fn)
+	}
+}
@@ -4,6 +4,7 @@
 package internal
 
 import (
+	"bytes"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
@@ -18,13 +19,13 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"git.mills.io/yarnsocial/yarn"
 	"git.mills.io/yarnsocial/yarn/internal/indieweb"
 	"github.com/dustin/go-humanize"
 	sync "github.com/sasha-s/go-deadlock"
-	log "github.com/sirupsen/logrus"
 	"go.yarn.social/types"
 )
 
@@ -40,12 +41,24 @@ const (
 	minimumFeedRefresh  = 300.0 // 5m
 	maximumFeedRefresh  = 900.0 // 15m
 	movingAverageWindow = 7     // no. of most recent twts in moving avg calc
+
+	// missingTwtRetryTTL is how long to wait before looking for the same
+	// missing twt again
+	missingTwtRetryTTL = 15 * time.Minute
+
+	// maxMissingTwtFeeds and maxMissingTwtPeers limit the number of feeds
+	// and peers asked for a missing twt on demand
+	maxMissingTwtFeeds = 5
+	maxMissingTwtPeers = 5
 )
 
 var (
 	alwaysRefreshDomains = []string{
 		"feeds.twtxt.net",
 	}
+
+	// missingTwtLookups tracks recent lookups of missing twts
+	missingTwtLookups = NewTTLCache(missingTwtRetryTTL)
 )
 
 // FilterFunc ...
@@ -54,11 +67,9 @@ type FilterFunc func(twt types.Twt) bool
 // GroupFunc ...
 type GroupFunc func(twt types.Twt) []string
 
-// TODO: We need to define a formal way of declaring a feed is automated.
-// Suggestion by @jan6 on #yarn.social is to introduce a new field:
-// # automated = true
+// FilterOutFeedsAndBotsFactory filters out the twts of automated feeds (See:
+// AutomatedFeeds) and of the well-known twtxt feed aggregators
 func FilterOutFeedsAndBotsFactory(conf *Config) FilterFunc {
-	isLocal := IsLocalURLFactory(conf)
 	return func(twt types.Twt) bool {
 		twter := twt.Twter()
 		if strings.HasPrefix(twter.URI, "https://feeds.twtxt.net") {
@@ -70,7 +81,7 @@ func FilterOutFeedsAndBotsFactory(conf *Config) FilterFunc {
 		if strings.HasPrefix(twter.URI, "https://search.twtxt.net") {
 			return false
 		}
-		if isLocal(twter.URI) && HasString(automatedFeeds, twter.Nick) {
+		if automated.IsAutomated(twter.URI) {
 			return false
 		}
 		return true
@@ -84,6 +95,15 @@ func FilterByMentionFactory(u *User) FilterFunc {
 				return true
 			}
 		}
+
+		// Replies to conversations the user watches count as mentions
+		if len(u.Watching) > 0 && !u.Is(twt.Twter().URI) {
+			hash := ExtractHashFromSubject(twt.Subject().String())
+			if hash != "" && hash != twt.Hash() && u.IsWatching(hash) {
+				return true
+			}
+		}
+
 		return false
 	}
 }
@@ -177,6 +197,34 @@ func FirstNTwts(twts types.Twts, n int) types.Twts {
 	return twts[:n]
 }
 
+// FeedDelta is the set of new twts of a feed since it was last fetched
+type FeedDelta struct {
+	URL  string
+	Twts types.Twts
+}
+
+// FeedDeltas are the deltas of the feeds fetched in a single FetchFeeds cycle
+type FeedDeltas []FeedDelta
+
+// Count returns the total number of new twts across all deltas
+func (deltas FeedDeltas) Count() int {
+	n := 0
+	for _, delta := range deltas {
+		n += len(delta.Twts)
+	}
+	return n
+}
+
+// Twts returns all new twts across all deltas sorted by their creation time
+func (deltas FeedDeltas) Twts() types.Twts {
+	var twts types.Twts
+	for _, delta := range deltas {
+		twts = append(twts, delta.Twts...)
+	}
+	sort.Sort(twts)
+	return twts
+}
+
 // Cached ...
 type Cached struct {
 	mu sync.RWMutex
@@ -187,6 +235,34 @@ type Cached struct {
 	LastFetched   time.Time
 	LastModified  string
 	MovingAverage float64
+
+	// PublicKey is the signing key pinned the first time the feed was
+	// verified and Tampered is set when the feed fails verification
+	PublicKey string
+	Tampered  bool
+
+	// LastViewed is when the feed's twts were last viewed and determines the
+	// order in which feeds are evicted to stay within the memory budget
+	LastViewed time.Time
+	Evicted    bool
+
+	// EvictedHashes are the hashes of the evicted twts so that twts restored
+	// by the next fetch are not mistaken for new twts
+	EvictedHashes map[string]bool
+
+	// Fetch diagnostics as of the last fetch: the HTTP status, the size of
+	// the feed in bytes, whether it was truncated by MaxFetchLimit, the
+	// number of lines that could not be parsed as twts and when the last
+	// error occurred (See: FeedHealth)
+	LastStatus  int
+	LastSize    int64
+	Truncated   bool
+	Malformed   int
+	LastErrorAt time.Time
+
+	// size is the estimated memory used by the feed's twts if sized
+	size  int64
+	sized bool
 }
 
 func NewCached() *Cached {
@@ -209,6 +285,7 @@ func (cached *Cached) Inject(twt types.Twt) {
 	sort.Sort(twts)
 
 	cached.Twts = twts
+	cached.sized = false
 }
 
 // Snipe deletes a twt from a Cached.
@@ -228,13 +305,15 @@ func (cached *Cached) Snipe(twt types.Twt) {
 	sort.Sort(twts)
 
 	cached.Twts = twts
+	cached.sized = false
 }
 
-// Update ...
-func (cached *Cached) Update(lastmodified string, twts types.Twts) {
+// Update replaces the twts of a cached feed and returns the twts that were
+// not previously cached
+func (cached *Cached) Update(lastmodified string, twts types.Twts) types.Twts {
 	// Avoid overwriting a cached Feed with no Twts
 	if len(twts) == 0 {
-		return
+		return nil
 	}
 
 	cached.mu.Lock()
@@ -242,8 +321,26 @@ func (cached *Cached) Update(lastmodified string, twts types.Twts) {
 
 	oldTwts := cached.Twts[:]
 
+	seen := make(map[string]bool, len(oldTwts)+len(cached.EvictedHashes))
+	for _, twt := range oldTwts {
+		seen[twt.Hash()] = true
+	}
+	for hash := range cached.EvictedHashes {
+		seen[hash] = true
+	}
+
+	var newTwts types.Twts
+	for _, twt := range twts {
+		if !seen[twt.Hash()] {
+			newTwts = append(newTwts, twt)
+		}
+	}
+
 	cached.Twts = twts
 	cached.LastModified = lastmodified
+	cached.Evicted = false
+	cached.EvictedHashes = nil
+	cached.sized = false
 
 	//
 	// Calculate the moving average of a feed
@@ -267,6 +364,8 @@ func (cached *Cached) Update(lastmodified string, twts types.Twts) {
 	avg := sum / float64(len(deltas))
 
 	cached.MovingAverage = (cached.MovingAverage + avg) / 2
+
+	return newTwts
 }
 
 // GetTwts ...
@@ -322,6 +421,26 @@ func (cached *Cached) SetError(err error) {
 
 	cached.Errors++
 	cached.LastError = err.Error()
+	cached.LastErrorAt = time.Now()
+}
+
+// SetLastStatus records the HTTP status of the last fetch of a feed
+func (cached *Cached) SetLastStatus(status int) {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	cached.LastStatus = status
+}
+
+// SetFetchStatus records the diagnostics of the last fetch of a feed
+func (cached *Cached) SetFetchStatus(status int, size int64, truncated bool, malformed int) {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	cached.LastStatus = status
+	cached.LastSize = size
+	cached.Truncated = truncated
+	cached.Malformed = malformed
 }
 
 // SetLastFetched ...
@@ -332,6 +451,39 @@ func (cached *Cached) SetLastFetched() {
 	cached.LastFetched = time.Now()
 }
 
+// VerifySignature verifies the signature of a fetched feed against the public
+// key it advertises. The first key that verifies is pinned so that a feed that
+// later drops or changes its key is flagged as tampered.
+func (cached *Cached) VerifySignature(data []byte, signature string) bool {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	advertised, ok := FeedPublicKey(data)
+	switch {
+	case !ok && cached.PublicKey == "":
+		// Unsigned feed
+		cached.Tampered = false
+	case !ok || (cached.PublicKey != "" && advertised != cached.PublicKey):
+		cached.Tampered = true
+	default:
+		pub, err := ParsePublicKey(advertised)
+		cached.Tampered = err != nil || VerifyFeed(pub, data, signature) != nil
+		if !cached.Tampered {
+			cached.PublicKey = advertised
+		}
+	}
+
+	return !cached.Tampered
+}
+
+// IsTampered ...
+func (cached *Cached) IsTampered() bool {
+	cached.mu.RLock()
+	defer cached.mu.RUnlock()
+
+	return cached.Tampered
+}
+
 type Peer struct {
 	URI string `json:"-"`
 
@@ -422,15 +574,26 @@ func (peers Peers) Swap(i, j int)      { peers[i], peers[j] = peers[j], peers[i]
 type Cache struct {
 	mu sync.RWMutex
 
-	conf       *Config
+	conf       atomic.Value // *Config (See: SetConfig)
 	filterTwts FilterTwtsFunc
+	journal    *CacheJournal
+	timelines  *Timelines
+
+	// filterTimeline also applies the user's TimelineFilters
+	filterTimeline FilterTwtsFunc
+
+	// managed are the peers managed by the Pod Owner/Operator (See: Store)
+	managed map[string]*ManagedPeer
+
+	// updatedAt is when the cache's views were last updated
+	updatedAt time.Time
 
 	Version int
 
 	List  *Cached
 	Map   map[string]types.Twt
 	Peers map[string]*Peer
-	Feeds map[string]*Cached
+	Feeds *FeedShards
 	Views map[string]*Cached
 
 	Followers map[string]types.Followers
@@ -458,7 +621,7 @@ func (cache *Cache) MarshalJSON() ([]byte, error) {
 		List:  cache.List,
 		Map:   cache.Map,
 		Peers: cache.Peers,
-		Feeds: cache.Feeds,
+		Feeds: cache.Feeds.Map(),
 		Views: cache.Views,
 
 		Followers: cache.Followers,
@@ -467,21 +630,39 @@ func (cache *Cache) MarshalJSON() ([]byte, error) {
 }
 
 func NewCache(conf *Config) *Cache {
-	return &Cache{
-		conf:       conf,
-		filterTwts: FilterTwtsFactory(conf),
+	filterTwts := FilterTwtsFactory(conf)
+	filterTimeline := TimelineFilterTwtsFactory(conf)
+
+	cache := &Cache{
+		filterTwts:     filterTwts,
+		filterTimeline: filterTimeline,
+		timelines:      NewTimelines(filterTimeline),
+		managed:        make(map[string]*ManagedPeer),
 
 		Version: feedCacheVersion,
 
 		List:  NewCached(),
 		Map:   make(map[string]types.Twt),
 		Peers: make(map[string]*Peer),
-		Feeds: make(map[string]*Cached),
+		Feeds: NewFeedShards(),
 		Views: make(map[string]*Cached),
 
 		Followers: make(map[string]types.Followers),
 		Twters:    make(map[string]*types.Twter),
 	}
+	cache.conf.Store(conf)
+
+	return cache
+}
+
+// config returns the cache's current config
+func (cache *Cache) config() *Config {
+	return cache.conf.Load().(*Config)
+}
+
+// SetConfig replaces the cache's config when the pod's settings are reloaded
+func (cache *Cache) SetConfig(conf *Config) {
+	cache.conf.Store(conf)
 }
 
 // FromOldCacheFile attempts to load an oldver version of the on-disk cache stored
@@ -494,7 +675,7 @@ func FromOldCacheFile(conf *Config, fn string) (*Cache, error) {
 	f, err := os.Open(fn)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			log.WithError(err).Error("error loading cache, cache file found but unreadable")
+			Logger(LogCache).WithError(err).Error("error loading cache, cache file found but unreadable")
 			return nil, err
 		}
 		return NewCache(conf), nil
@@ -510,31 +691,33 @@ func FromOldCacheFile(conf *Config, fn string) (*Cache, error) {
 	dec := gob.NewDecoder(f)
 
 	if err := dec.Decode(&cache.Version); err != nil {
-		log.WithError(err).Error("error decoding cache.Version, removing corrupt file")
+		Logger(LogCache).WithError(err).Error("error decoding cache.Version, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
 	if err := dec.Decode(&cache.Peers); err != nil {
-		log.WithError(err).Error("error decoding cache.Peers, removing corrupt file")
+		Logger(LogCache).WithError(err).Error("error decoding cache.Peers, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
-	if err := dec.Decode(&cache.Feeds); err != nil {
-		log.WithError(err).Error("error decoding cache.Feeds, removing corrupt file")
+	var feeds map[string]*Cached
+	if err := dec.Decode(&feeds); err != nil {
+		Logger(LogCache).WithError(err).Error("error decoding cache.Feeds, removing corrupt file")
 		return cleanupCorruptCache()
 	}
+	cache.Feeds = NewFeedShardsFrom(feeds)
 
 	if err := dec.Decode(&cache.Followers); err != nil {
-		log.WithError(err).Warn("error decoding cache.Followers, removing corrupt file")
+		Logger(LogCache).WithError(err).Warn("error decoding cache.Followers, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
 	if err := dec.Decode(&cache.Twters); err != nil {
-		log.WithError(err).Warn("error decoding cache.Twters, removing corrupt file")
+		Logger(LogCache).WithError(err).Warn("error decoding cache.Twters, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
-	log.Infof("Loaded old Cache v%d", cache.Version)
+	Logger(LogCache).Infof("Loaded old Cache v%d", cache.Version)
 
 	// Migrate old Cache ...
 
@@ -546,10 +729,10 @@ func FromOldCacheFile(conf *Config, fn string) (*Cache, error) {
 	cache.Refresh()
 
 	if err := cache.Store(conf); err != nil {
-		log.WithError(err).Errorf("error migrating old cache")
+		Logger(LogCache).WithError(err).Errorf("error migrating old cache")
 		return cleanupCorruptCache()
 	}
-	log.Infof("Successfully migrated old cache to v%d", cache.Version)
+	Logger(LogCache).Infof("Successfully migrated old cache to v%d", cache.Version)
 
 	return cache, nil
 }
@@ -561,7 +744,7 @@ func LoadCacheFromFile(conf *Config, fn string) (*Cache, error) {
 	f, err := os.Open(fn)
 	if err != nil {
 		if !os.IsNotExist(err) {
-			log.WithError(err).Error("error loading cache, cache file found but unreadable")
+			Logger(LogCache).WithError(err).Error("error loading cache, cache file found but unreadable")
 			return nil, err
 		}
 		return NewCache(conf), nil
@@ -577,44 +760,46 @@ func LoadCacheFromFile(conf *Config, fn string) (*Cache, error) {
 	}
 
 	if err := dec.Decode(&cache.Version); err != nil {
-		log.WithError(err).Error("error decoding cache.Version, removing corrupt file")
+		Logger(LogCache).WithError(err).Error("error decoding cache.Version, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
 	if cache.Version != feedCacheVersion {
-		log.Warnf(
+		Logger(LogCache).Warnf(
 			"cache.Version %d does not match %d, will try to load old cache v%d instead...",
 			cache.Version, feedCacheVersion, (feedCacheVersion - 1),
 		)
 		cache, err := FromOldCacheFile(conf, fn)
 		if err != nil {
-			log.WithError(err).Error("error loading old cache, removing corrupt file")
+			Logger(LogCache).WithError(err).Error("error loading old cache, removing corrupt file")
 			return cleanupCorruptCache()
 		}
 		return cache, nil
 	}
 
 	if err := dec.Decode(&cache.Peers); err != nil {
-		log.WithError(err).Error("error decoding cache.Peers, removing corrupt file")
+		Logger(LogCache).WithError(err).Error("error decoding cache.Peers, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
-	if err := dec.Decode(&cache.Feeds); err != nil {
-		log.WithError(err).Error("error decoding cache.Feeds, removing corrupt file")
+	var feeds map[string]*Cached
+	if err := dec.Decode(&feeds); err != nil {
+		Logger(LogCache).WithError(err).Error("error decoding cache.Feeds, removing corrupt file")
 		return cleanupCorruptCache()
 	}
+	cache.Feeds = NewFeedShardsFrom(feeds)
 
 	if err := dec.Decode(&cache.Followers); err != nil {
-		log.WithError(err).Warn("error decoding cache.Followers, removing corrupt file")
+		Logger(LogCache).WithError(err).Warn("error decoding cache.Followers, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
 	if err := dec.Decode(&cache.Twters); err != nil {
-		log.WithError(err).Warn("error decoding cache.Twters, removing corrupt file")
+		Logger(LogCache).WithError(err).Warn("error decoding cache.Twters, removing corrupt file")
 		return cleanupCorruptCache()
 	}
 
-	log.Infof("Cache version %d", cache.Version)
+	Logger(LogCache).Infof("Cache version %d", cache.Version)
 
 	return cache, nil
 }
@@ -626,50 +811,105 @@ func LoadCache(conf *Config) (*Cache, error) {
 	if err != nil {
 		return nil, err
 	}
+
+	if err := cache.replayJournal(filepath.Join(conf.Data, cacheJournalFile)); err != nil {
+		Logger(LogCache).WithError(err).Error("error replaying cache journal")
+	}
+
 	cache.Refresh()
 	return cache, nil
 }
 
-// Store ...
+// replayJournal replays twts injected since the last snapshot (e.g: before a
+// crash) from the journal at fn which is then used for further injections
+func (cache *Cache) replayJournal(fn string) error {
+	cache.journal = NewCacheJournal(fn)
+	n, err := cache.journal.Replay(func(url string, twt types.Twt) {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+
+		if _, ok := cache.Map[twt.Hash()]; !ok {
+			cache.injectFeed(url, twt)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		Logger(LogCache).Infof("replayed %d twts from cache journal", n)
+	}
+	return nil
+}
+
+// Store writes a snapshot of the cache to disk (See: WriteFile)
 func (cache *Cache) Store(conf *Config) error {
+	return cache.WriteFile(filepath.Join(conf.Data, feedCacheFile))
+}
+
+// WriteFile writes a snapshot of the cache to fn. The snapshot is written to
+// a temporary file first and atomically renamed so that a crash mid-write
+// never corrupts the previous snapshot.
+func (cache *Cache) WriteFile(fn string) error {
 	cache.mu.RLock()
 	defer cache.mu.RUnlock()
 
-	fn := filepath.Join(conf.Data, feedCacheFile)
-	f, err := os.OpenFile(fn, os.O_CREATE|os.O_WRONLY, 0666)
+	tmp := fn + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
-		log.WithError(err).Error("error opening cache file for writing")
+		Logger(LogCache).WithError(err).Error("error opening cache file for writing")
 		return err
 	}
+	defer os.Remove(tmp)
 	defer f.Close()
 
 	enc := gob.NewEncoder(f)
 
 	if err := enc.Encode(cache.Version); err != nil {
-		log.WithError(err).Error("error encoding cache.Version")
+		Logger(LogCache).WithError(err).Error("error encoding cache.Version")
 		return err
 	}
 
 	if err := enc.Encode(cache.Peers); err != nil {
-		log.WithError(err).Error("error encoding cache.Peers")
+		Logger(LogCache).WithError(err).Error("error encoding cache.Peers")
 		return err
 	}
 
-	if err := enc.Encode(cache.Feeds); err != nil {
-		log.WithError(err).Error("error encoding cache.Feeds")
+	if err := enc.Encode(cache.Feeds.Map()); err != nil {
+		Logger(LogCache).WithError(err).Error("error encoding cache.Feeds")
 		return err
 	}
 
 	if err := enc.Encode(cache.Followers); err != nil {
-		log.WithError(err).Error("error encoding cache.Followers")
+		Logger(LogCache).WithError(err).Error("error encoding cache.Followers")
 		return err
 	}
 
 	if err := enc.Encode(cache.Twters); err != nil {
-		log.WithError(err).Error("error encoding cache.Twters")
+		Logger(LogCache).WithError(err).Error("error encoding cache.Twters")
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		Logger(LogCache).WithError(err).Error("error syncing cache file")
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		Logger(LogCache).WithError(err).Error("error closing cache file")
+		return err
+	}
+
+	if err := os.Rename(tmp, fn); err != nil {
+		Logger(LogCache).WithError(err).Error("error renaming cache file")
 		return err
 	}
 
+	// Injected twts are now part of the snapshot. The cache's read lock is
+	// still held so no twts can be injected before the journal is truncated
+	if err := cache.journal.Truncate(); err != nil {
+		Logger(LogCache).WithError(err).Warn("error truncating cache journal")
+	}
+
 	return nil
 }
 
@@ -715,14 +955,14 @@ func (cache *Cache) DetectClientFromRequest(req *http.Request, profile types.Pro
 
 	if ua.IsPod() {
 		if err := cache.DetectPodFromUserAgent(ua); err != nil {
-			log.WithError(err).Error("error detecting pod")
+			Logger(LogIPP).WithError(err).Error("error detecting pod")
 			return err
 		}
 	}
 
 	// Update Followers cache
 
-	newFollowers := ua.Followers(cache.conf)
+	newFollowers := ua.Followers(cache.config())
 	currentFollowers := cache.GetFollowers(profile)
 	mergedFollowers := MergeFollowers(currentFollowers, newFollowers)
 
@@ -742,14 +982,14 @@ func (cache *Cache) DetectClientFromResponse(res *http.Response) error {
 
 	ua, err := ParseUserAgent(poweredBy)
 	if err != nil {
-		log.WithError(err).Warnf("error parsing Powered-By header '%s'", poweredBy)
+		Logger(LogIPP).WithError(err).Warnf("error parsing Powered-By header '%s'", poweredBy)
 		return nil
 	}
 
-	if cache.conf.Features.IsEnabled(FeatureWebSub) {
+	if cache.config().Features.IsEnabled(FeatureWebSub) {
 		// TOOD: Should this be a function in indieweb package?
 		links := indieweb.GetHeaderLinks(res.Header["Link"])
-		log.Debugf("links: %v", links)
+		Logger(LogIPP).Debugf("links: %v", links)
 
 		var (
 			hubEndpoint *url.URL
@@ -768,21 +1008,21 @@ func (cache *Cache) DetectClientFromResponse(res *http.Response) error {
 		}
 
 		if hubEndpoint == nil {
-			log.Debugf("no rel=hub link found for %s", res.Request.URL.String())
+			Logger(LogIPP).Debugf("no rel=hub link found for %s", res.Request.URL.String())
 		} else if selfURL == nil {
-			log.Debugf("no rel=self link found for %s", res.Request.URL.String())
+			Logger(LogIPP).Debugf("no rel=self link found for %s", res.Request.URL.String())
 		} else if sub := websub.GetSubscription(selfURL.String()); sub != nil {
-			log.Debugf("already subscribed to %s", selfURL.String())
+			Logger(LogIPP).Debugf("already subscribed to %s", selfURL.String())
 		} else {
-			callback := fmt.Sprintf("%s/notify", cache.conf.BaseURL)
+			callback := fmt.Sprintf("%s/notify", cache.config().BaseURL)
 			if err := websub.Subscribe(selfURL.String(), callback); err != nil {
-				log.WithError(err).Errorf("error subscribing to %s", res.Request.URL.RequestURI())
+				Logger(LogIPP).WithError(err).Errorf("error subscribing to %s", res.Request.URL.RequestURI())
 			}
 		}
 	}
 
 	if err := cache.DetectPodFromUserAgent(ua); err != nil {
-		log.WithError(err).Error("error detecting pod")
+		Logger(LogIPP).WithError(err).Error("error detecting pod")
 	}
 
 	return nil
@@ -794,7 +1034,7 @@ func (cache *Cache) DetectPodFromUserAgent(ua TwtxtUserAgent) error {
 		return nil
 	}
 
-	if !cache.conf.Debug && !ua.IsPublicURL() {
+	if !cache.config().Debug && !ua.IsPublicURL() {
 		return nil
 	}
 
@@ -803,6 +1043,10 @@ func (cache *Cache) DetectPodFromUserAgent(ua TwtxtUserAgent) error {
 		return nil
 	}
 
+	if cache.IsPeerBlocked(podBaseURL) {
+		return nil
+	}
+
 	cache.mu.RLock()
 	oldPeer, hasSeen := cache.Peers[podBaseURL]
 	cache.mu.RUnlock()
@@ -842,64 +1086,21 @@ func (cache *Cache) DetectPodFromUserAgent(ua TwtxtUserAgent) error {
 		cache.mu.Unlock()
 	}
 
-	headers := make(http.Header)
-	headers.Set("Accept", "application/json")
-
-	res, err := RequestHTTP(cache.conf, http.MethodGet, podBaseURL+"/info", headers)
-	if err != nil {
-		resetDummyPeer()
-		log.WithError(err).Errorf("error making /info request to pod running at %s", podBaseURL)
-		return err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode/100 != 2 {
-		resetDummyPeer()
-		log.Errorf("HTTP %s response for /info of pod running at %s", res.Status, podBaseURL)
-		return fmt.Errorf("non-success HTTP %s response for %s/info", res.Status, podBaseURL)
-	}
-
-	if ctype := res.Header.Get("Content-Type"); ctype != "" {
-		mediaType, _, err := mime.ParseMediaType(ctype)
-		if err != nil {
-			resetDummyPeer()
-			log.WithError(err).Errorf("error parsing content type header '%s' for /info of pod running at %s", ctype, podBaseURL)
-			return err
-		}
-		if mediaType != "application/json" {
-			resetDummyPeer()
-			log.Errorf("non-JSON response '%s' for /info of pod running at %s", ctype, podBaseURL)
-			return fmt.Errorf("non-JSON response content type '%s' for %s/info", ctype, podBaseURL)
-		}
-	}
-
-	data, err := io.ReadAll(res.Body)
+	peer, err := GetPeerInfo(cache.config(), podBaseURL)
 	if err != nil {
 		resetDummyPeer()
-		log.WithError(err).Errorf("error reading response body for /info of pod running at %s", podBaseURL)
-		return err
-	}
-
-	var peer Peer
-
-	if err := json.Unmarshal(data, &peer); err != nil {
-		resetDummyPeer()
-		log.WithError(err).Errorf("error decoding response body for /info of pod running at %s", podBaseURL)
+		Logger(LogIPP).WithError(err).Errorf("error making /info request to pod running at %s", podBaseURL)
 		return err
 	}
-	peer.URI = podBaseURL
-	peer.LastSeen = time.Now()
-	peer.LastUpdated = time.Now()
 
-	cache.mu.Lock()
-	cache.Peers[podBaseURL] = &peer
-	cache.mu.Unlock()
+	cache.UpdatePeer(peer)
 
 	return nil
 }
 
-// FetchFeeds ...
-func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.FetchFeedRequests, publicFollowers map[types.FetchFeedRequest][]string) {
+// FetchFeeds fetches the given feeds and returns the deltas of new twts of
+// each feed since it was last fetched
+func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.FetchFeedRequests, publicFollowers map[types.FetchFeedRequest][]string) FeedDeltas {
 	stime := time.Now()
 	defer func() {
 		metrics.Gauge(
@@ -914,7 +1115,7 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 
 	// buffered to let goroutines write without blocking before the main thread
 	// begins reading
-	twtsch := make(chan types.Twts, len(feeds))
+	deltach := make(chan FeedDelta, len(feeds))
 
 	var wg sync.WaitGroup
 	// max parallel http fetchers
@@ -932,8 +1133,14 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 		}
 
 		// Skip feeds that are blocked by the Pod
-		if cache.conf.BlockedFeed(feed.URL) {
-			log.Warnf("attempt to fetch blocked feed %s", feed)
+		if cache.config().BlockedFeed(feed.URL) {
+			Logger(LogFetcher).Warnf("attempt to fetch blocked feed %s", feed)
+			continue
+		}
+
+		// Skip feeds that are not allowed (allowlist federation mode)
+		if !cache.config().AllowedFeed(feed.URL) {
+			Logger(LogFetcher).Warnf("attempt to fetch feed %s not allowed by the pod", feed)
 			continue
 		}
 
@@ -968,7 +1175,7 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 			// 2) An exponential back-off based on a weighted moving average of a feed's update frequency (TBD)
 			// 3) FetchFeedRequest.Force is `true` so we fetch the feed immediately (Subscription Notification)
 			if !feed.Force && !cache.ShouldRefreshFeed(feed.URL) {
-				twtsch <- nil
+				deltach <- FeedDelta{}
 				return
 			}
 
@@ -981,31 +1188,41 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 				res, err := RequestGopher(conf, feed.URL)
 				if err != nil {
 					cachedFeed.SetError(err)
-					twtsch <- nil
+					deltach <- FeedDelta{}
 					return
 				}
 
 				limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
 
-				tf, err := types.ParseFile(limitedReader, twter)
+				data, err := io.ReadAll(limitedReader)
+				if err != nil {
+					cachedFeed.SetError(err)
+					deltach <- FeedDelta{}
+					return
+				}
+
+				tf, err := types.ParseFile(bytes.NewReader(data), twter)
 				if err != nil {
+					cachedFeed.SetFetchStatus(0, int64(len(data)), limitedReader.N <= 0, 0)
 					cachedFeed.SetError(err)
-					twtsch <- nil
+					deltach <- FeedDelta{}
 					return
 				}
+				cachedFeed.SetFetchStatus(0, int64(len(data)), limitedReader.N <= 0, countMalformedLines(data, tf))
+
 				if !isLocalURL(twter.Avatar) {
 					GetExternalAvatar(conf, *twter)
 				}
 
 				future, twts, old := types.SplitTwts(tf.Twts(), conf.MaxCacheTTL, conf.MaxCacheItems)
 				if len(future) > 0 {
-					log.Warnf("feed %s has %d posts in the future, possible bad client or misconfigured timezone", feed, len(future))
+					Logger(LogFetcher).Warnf("feed %s has %d posts in the future, possible bad client or misconfigured timezone", feed, len(future))
 				}
 
 				// If N == 0 we possibly exceeded conf.MaxFetchLimit when
 				// reading this feed. Log it and bump a cache_limited counter
 				if limitedReader.N <= 0 {
-					log.Warnf("feed size possibly exceeds MaxFetchLimit of %s for %s", humanize.Bytes(uint64(conf.MaxFetchLimit)), feed)
+					Logger(LogFetcher).Warnf("feed size possibly exceeds MaxFetchLimit of %s for %s", humanize.Bytes(uint64(conf.MaxFetchLimit)), feed)
 					metrics.Counter("cache", "limited").Inc()
 				}
 
@@ -1014,7 +1231,7 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 					for _, twt := range twts {
 						if !archive.Has(twt.Hash()) {
 							if err := archive.Archive(twt); err != nil {
-								log.WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
+								Logger(LogFetcher).WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
 								metrics.Counter("archive", "error").Inc()
 							} else {
 								metrics.Counter("archive", "size").Inc()
@@ -1025,10 +1242,10 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 				archiveTwts(old)
 				archiveTwts(twts)
 
-				cache.SetTwter(feed.URL, twter)
-				cache.UpdateFeed(feed.URL, "", twts)
+				twts = plugins.OnFetch(feed.URL, twts)
 
-				twtsch <- twts
+				cache.SetTwter(feed.URL, twter)
+				deltach <- FeedDelta{URL: feed.URL, Twts: cache.UpdateFetchedFeed(feed.URL, "", twts, data, len(tf.Twts()))}
 				return
 			}
 
@@ -1038,31 +1255,40 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 				res, err := RequestGemini(conf, feed.URL)
 				if err != nil {
 					cachedFeed.SetError(err)
-					twtsch <- nil
+					deltach <- FeedDelta{}
 					return
 				}
 
 				limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
 
-				tf, err := types.ParseFile(limitedReader, twter)
+				data, err := io.ReadAll(limitedReader)
 				if err != nil {
 					cachedFeed.SetError(err)
-					twtsch <- nil
+					deltach <- FeedDelta{}
 					return
 				}
+
+				tf, err := types.ParseFile(bytes.NewReader(data), twter)
+				if err != nil {
+					cachedFeed.SetFetchStatus(0, int64(len(data)), limitedReader.N <= 0, 0)
+					cachedFeed.SetError(err)
+					deltach <- FeedDelta{}
+					return
+				}
+				cachedFeed.SetFetchStatus(0, int64(len(data)), limitedReader.N <= 0, countMalformedLines(data, tf))
 				if !isLocalURL(twter.Avatar) {
 					GetExternalAvatar(conf, *twter)
 				}
 
 				future, twts, old := types.SplitTwts(tf.Twts(), conf.MaxCacheTTL, conf.MaxCacheItems)
 				if len(future) > 0 {
-					log.Warnf("feed %s has %d posts in the future, possible bad client or misconfigured timezone", feed, len(future))
+					Logger(LogFetcher).Warnf("feed %s has %d posts in the future, possible bad client or misconfigured timezone", feed, len(future))
 				}
 
 				// If N == 0 we possibly exceeded conf.MaxFetchLimit when
 				// reading this feed. Log it and bump a cache_limited counter
 				if limitedReader.N <= 0 {
-					log.Warnf("feed size possibly exceeds MaxFetchLimit of %s for %s", humanize.Bytes(uint64(conf.MaxFetchLimit)), feed)
+					Logger(LogFetcher).Warnf("feed size possibly exceeds MaxFetchLimit of %s for %s", humanize.Bytes(uint64(conf.MaxFetchLimit)), feed)
 					metrics.Counter("cache", "limited").Inc()
 				}
 
@@ -1071,7 +1297,7 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 					for _, twt := range twts {
 						if !archive.Has(twt.Hash()) {
 							if err := archive.Archive(twt); err != nil {
-								log.WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
+								Logger(LogFetcher).WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
 								metrics.Counter("archive", "error").Inc()
 							} else {
 								metrics.Counter("archive", "size").Inc()
@@ -1082,10 +1308,10 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 				archiveTwts(old)
 				archiveTwts(twts)
 
-				cache.SetTwter(feed.URL, twter)
-				cache.UpdateFeed(feed.URL, "", twts)
+				twts = plugins.OnFetch(feed.URL, twts)
 
-				twtsch <- twts
+				cache.SetTwter(feed.URL, twter)
+				deltach <- FeedDelta{URL: feed.URL, Twts: cache.UpdateFetchedFeed(feed.URL, "", twts, data, len(tf.Twts()))}
 				return
 			}
 
@@ -1123,53 +1349,68 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 			res, err := RequestHTTP(conf, http.MethodGet, feed.URL, headers)
 			if err != nil {
 				cachedFeed.SetError(err)
-				twtsch <- nil
+				deltach <- FeedDelta{}
 				return
 			}
 			defer res.Body.Close()
 
 			actualURL := res.Request.URL.String()
 			if actualURL == "" {
-				log.WithField("feed", feed).Warnf("%s trying to redirect to an empty url", feed)
-				twtsch <- nil
+				Logger(LogFetcher).WithField("feed", feed).Warnf("%s trying to redirect to an empty url", feed)
+				deltach <- FeedDelta{}
 				return
 			}
 
 			if actualURL != feed.URL {
-				log.WithError(err).Warnf("feed %s has moved to %s", feed, actualURL)
-				cache.mu.Lock()
-				cache.Feeds[actualURL] = cachedFeed
-				cache.mu.Unlock()
+				Logger(LogFetcher).WithError(err).Warnf("feed %s has moved to %s", feed, actualURL)
+				cache.Feeds.Set(actualURL, cachedFeed)
 				feed.URL = actualURL
 			}
 
 			cache.DetectClientFromResponse(res)
 
-			var twts types.Twts
+			cachedFeed.SetLastStatus(res.StatusCode)
+
+			var delta types.Twts
 
 			switch res.StatusCode {
 			case http.StatusOK: // 200
 				limitedReader := &io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit}
 
-				tf, err := types.ParseFile(limitedReader, twter)
+				data, err := io.ReadAll(limitedReader)
+				if err != nil {
+					cachedFeed.SetError(err)
+					deltach <- FeedDelta{}
+					return
+				}
+
+				tf, err := types.ParseFile(bytes.NewReader(data), twter)
 				if err != nil {
+					cachedFeed.SetFetchStatus(res.StatusCode, int64(len(data)), limitedReader.N <= 0, 0)
 					cachedFeed.SetError(err)
-					twtsch <- nil
+					deltach <- FeedDelta{}
 					return
 				}
+				cachedFeed.SetFetchStatus(res.StatusCode, int64(len(data)), limitedReader.N <= 0, countMalformedLines(data, tf))
+
+				if !cachedFeed.VerifySignature(data, res.Header.Get(twtxtSignatureHeader)) {
+					Logger(LogFetcher).Warnf("feed %s failed signature verification, possibly tampered", feed)
+					metrics.Counter("cache", "tampered").Inc()
+				}
+
 				if !isLocalURL(twter.Avatar) {
 					GetExternalAvatar(conf, *twter)
 				}
 
 				future, twts, old := types.SplitTwts(tf.Twts(), conf.MaxCacheTTL, conf.MaxCacheItems)
 				if len(future) > 0 {
-					log.Warnf("feed %s has %d posts in the future, possible bad client or misconfigured timezone", feed, len(future))
+					Logger(LogFetcher).Warnf("feed %s has %d posts in the future, possible bad client or misconfigured timezone", feed, len(future))
 				}
 
 				// If N == 0 we possibly exceeded conf.MaxFetchLimit when
 				// reading this feed. Log it and bump a cache_limited counter
 				if limitedReader.N <= 0 {
-					log.Warnf("feed size possibly exceeds MaxFetchLimit of %s for %s", humanize.Bytes(uint64(conf.MaxFetchLimit)), feed)
+					Logger(LogFetcher).Warnf("feed size possibly exceeds MaxFetchLimit of %s for %s", humanize.Bytes(uint64(conf.MaxFetchLimit)), feed)
 					metrics.Counter("cache", "limited").Inc()
 				}
 
@@ -1178,7 +1419,7 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 					for _, twt := range twts {
 						if !archive.Has(twt.Hash()) {
 							if err := archive.Archive(twt); err != nil {
-								log.WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
+								Logger(LogFetcher).WithError(err).Errorf("error archiving twt %s aborting", twt.Hash())
 								metrics.Counter("archive", "error").Inc()
 							} else {
 								metrics.Counter("archive", "size").Inc()
@@ -1189,32 +1430,47 @@ func (cache *Cache) FetchFeeds(conf *Config, archive Archiver, feeds types.Fetch
 				archiveTwts(old)
 				archiveTwts(twts)
 
+				// Reconstruct the feed's history from its archives (if any)
+				FetchFeedArchives(conf, archive, *twter, data)
+
+				twts = plugins.OnFetch(feed.URL, twts)
+
 				lastmodified := res.Header.Get("Last-Modified")
 				cache.SetTwter(feed.URL, twter)
-				cache.UpdateFeed(feed.URL, lastmodified, twts)
+				delta = cache.UpdateFetchedFeed(feed.URL, lastmodified, twts, data, len(tf.Twts()))
 			case http.StatusNotModified: // 304
-				twts = cachedFeed.GetTwts()
 				cachedFeed.UpdateMovingAverage()
 			case 401, 402, 403, 404, 407, 410, 451:
 				// These are permanent 4xx errors and considered a dead feed
 				cachedFeed.SetError(types.ErrDeadFeed{Reason: res.Status})
 			}
 
-			twtsch <- twts
+			deltach <- FeedDelta{URL: feed.URL, Twts: delta}
 		}(feed)
 	}
 
-	// close twts channel when all goroutines are done
+	// close deltas channel when all goroutines are done
 	go func() {
 		wg.Wait()
-		close(twtsch)
+		close(deltach)
 	}()
 
-	for range twtsch {
+	var deltas FeedDeltas
+	for delta := range deltach {
+		if len(delta.Twts) > 0 {
+			deltas = append(deltas, delta)
+		}
 	}
 
+	metrics.Counter("cache", "new_twts").Add(float64(deltas.Count()))
+
+	// Merge new twts into the materialized timelines of users
+	cache.timelines.Apply(deltas)
+
 	// Bust and repopulate twts for GetAll()
 	cache.Refresh()
+
+	return deltas
 }
 
 // Lookup ...
@@ -1226,14 +1482,32 @@ func (cache *Cache) Lookup(hash string) (types.Twt, bool) {
 	if ok {
 		return twt, true
 	}
+
+	// Hashes of a different length than the configured twt hash length are
+	// resolved by their common suffix for backwards compatibility
+	switch {
+	case len(hash) > types.TwtHashLength:
+		if twt, ok := cache.Map[hash[len(hash)-types.TwtHashLength:]]; ok {
+			return twt, true
+		}
+	case len(hash) < types.TwtHashLength:
+		for h, twt := range cache.Map {
+			if strings.HasSuffix(h, hash) {
+				return twt, true
+			}
+		}
+	}
+
 	return types.NilTwt, false
 }
 
 func (cache *Cache) FeedCount() int {
-	cache.mu.RLock()
-	defer cache.mu.RUnlock()
+	return cache.Feeds.Len()
+}
 
-	return len(cache.Feeds)
+// GetFeedURLs returns the urls of all feeds currently held in the cache
+func (cache *Cache) GetFeedURLs() []string {
+	return cache.Feeds.URLs()
 }
 
 func (cache *Cache) TwtCount() int {
@@ -1299,7 +1573,7 @@ func (cache *Cache) Converge(archive Archiver) {
 		if len(peers) == 0 {
 			peers = RandomSubsetOfPeers(cache.getPeers(), 0.6)
 		}
-		missingRootTwts[hash] = peers
+		missingRootTwts[hash] = append(cache.getPinnedPeers(), peers...)
 	}
 	cache.mu.RUnlock()
 
@@ -1308,8 +1582,8 @@ func (cache *Cache) Converge(archive Archiver) {
 	for hash, peers := range missingRootTwts {
 		var missingTwt types.Twt
 		for _, possiblePeer := range peers {
-			if !cache.conf.IsLocalURL(possiblePeer.URI) {
-				if twt, err := possiblePeer.GetTwt(cache.conf, hash); err == nil {
+			if !cache.config().IsLocalURL(possiblePeer.URI) {
+				if twt, err := possiblePeer.GetTwt(cache.config(), hash); err == nil {
 					missingTwt = twt
 					break
 				}
@@ -1317,25 +1591,84 @@ func (cache *Cache) Converge(archive Archiver) {
 		}
 		if missingTwt != nil {
 			cache.InjectFeed(missingTwt.Twter().URI, missingTwt)
-			GetExternalAvatar(cache.conf, missingTwt.Twter())
+			GetExternalAvatar(cache.config(), missingTwt.Twter())
 		}
 	}
 
 	cache.Refresh()
 }
 
-// Refresh ...
-func (cache *Cache) Refresh() {
-	var allTwts types.Twts
+// FetchMissingTwt looks for a twt that is neither in the cache nor in the
+// archive (such as the root of a conversation) on demand. The feeds of the
+// authors of related twts (replies) and the feeds they mention are fetched
+// first, then peering pods are asked for the twt by its hash. Lookups of the
+// same hash are not retried until missingTwtRetryTTL has passed.
+func (cache *Cache) FetchMissingTwt(archive Archiver, hash string, related types.Twts) (types.Twt, bool) {
+	if missingTwtLookups.Inc(hash) > 1 {
+		return types.NilTwt, false
+	}
 
-	cache.mu.RLock()
-	for _, cached := range cache.Feeds {
-		allTwts = append(allTwts, cached.GetTwts()...)
+	sources := make(types.FetchFeedRequests)
+	addSource := func(twter types.Twter) {
+		if twter.URI == "" || cache.config().IsLocalURL(twter.URI) || len(sources) >= maxMissingTwtFeeds {
+			return
+		}
+		sources[types.FetchFeedRequest{Nick: twter.Nick, URL: twter.URI}] = true
+	}
+
+	// Replies usually mention the author of the twt they reply to
+	for _, twt := range related {
+		for _, mention := range twt.Mentions() {
+			addSource(mention.Twter())
+		}
+	}
+	for _, twt := range related {
+		addSource(twt.Twter())
+	}
+
+	if len(sources) > 0 {
+		cache.FetchFeeds(cache.config(), archive, sources, nil)
+	}
+
+	if twt, inCache := cache.Lookup(hash); inCache {
+		return twt, true
+	}
+	if archive.Has(hash) {
+		if twt, err := archive.Get(hash); err == nil {
+			return twt, true
+		}
 	}
+
+	peers := cache.GetPeers()
+	if len(peers) > maxMissingTwtPeers {
+		peers = RandomSubsetOfPeers(peers, float64(maxMissingTwtPeers)/float64(len(peers)))
+	}
+
+	cache.mu.RLock()
+	peers = append(cache.getPinnedPeers(), peers...)
 	cache.mu.RUnlock()
 
-	allTwts = UniqTwts(allTwts)
-	sort.Sort(allTwts)
+	for _, peer := range peers {
+		if cache.config().IsLocalURL(peer.URI) {
+			continue
+		}
+		twt, err := peer.GetTwt(cache.config(), hash)
+		if err != nil || twt.Hash() != hash {
+			continue
+		}
+		cache.InjectFeed(twt.Twter().URI, twt)
+		GetExternalAvatar(cache.config(), twt.Twter())
+		return twt, true
+	}
+
+	Logger(LogIPP).Debugf("missing twt %s not found", hash)
+
+	return types.NilTwt, false
+}
+
+// Refresh ...
+func (cache *Cache) Refresh() {
+	allTwts := cache.Feeds.Twts()
 
 	//
 	// Generate some default views...
@@ -1349,18 +1682,26 @@ func (cache *Cache) Refresh() {
 	byHash := make(map[string]types.Twt)
 	byTags := make(map[string]types.Twts)
 	bySubjects := make(map[string]types.Twts)
+	byMedia := make(map[string]types.Twts)
+
+	graylisted := make(map[string]bool)
 
-	filterOutFeedsAndBots := FilterOutFeedsAndBotsFactory(cache.conf)
+	filterOutFeedsAndBots := FilterOutFeedsAndBotsFactory(cache.config())
 	for _, twt := range allTwts {
 		byHash[twt.Hash()] = twt
 
-		if !cache.conf.IsShadowed(twt.Twter().URI) {
+		uri := twt.Twter().URI
+		if _, ok := graylisted[uri]; !ok {
+			graylisted[uri] = cache.isGraylisted(uri)
+		}
+
+		if !cache.config().IsShadowed(twt.Twter().URI) {
 			// Pod's Local Timeline (alternate Discover view)
-			if cache.conf.IsLocalURL(twt.Twter().URI) {
+			if cache.config().IsLocalURL(twt.Twter().URI) && visibility.Listed(twt) {
 				localTwts = append(localTwts, twt)
 			}
 			// Pod's Discover Timeline (Primary Discover view)
-			if filterOutFeedsAndBots(twt) {
+			if filterOutFeedsAndBots(twt) && visibility.Listed(twt) && !graylisted[uri] {
 				discoverTwts = append(discoverTwts, twt)
 			}
 		}
@@ -1372,6 +1713,11 @@ func (cache *Cache) Refresh() {
 		for _, k := range GroupBySubject(twt) {
 			bySubjects[k] = append(bySubjects[k], twt)
 		}
+
+		// Media index of each feed (See: media tab of profiles)
+		if HasMedia(twt) {
+			byMedia[twt.Twter().URI] = append(byMedia[twt.Twter().URI], twt)
+		}
 	}
 
 	// Insert at the top of all subject views the original Twt (if any)
@@ -1385,6 +1731,9 @@ func (cache *Cache) Refresh() {
 		}
 	}
 
+	// Detect the languages of new twts (See: FilterTwtsByLanguage)
+	twtLanguages.Reset(allTwts)
+
 	cache.mu.Lock()
 	cache.List = NewCachedTwts(allTwts, "")
 	cache.Map = byHash
@@ -1398,9 +1747,16 @@ func (cache *Cache) Refresh() {
 	for k, v := range bySubjects {
 		cache.Views["subject:"+k] = NewCachedTwts(v, "")
 	}
+	for k, v := range byMedia {
+		cache.Views[mediaViewKey(k)] = NewCachedTwts(v, "")
+	}
+	cache.updatedAt = time.Now()
 
-	// Cleanup dead Peers
+	// Cleanup dead Peers (except those trusted by the Pod Owner/Operator)
 	for k, peer := range cache.Peers {
+		if state := cache.peerState(k); state == PeerTrusted || state == PeerPinned {
+			continue
+		}
 		if (peer.LastSeen.Sub(peer.LastUpdated)) > (podInfoUpdateTTL/2) || time.Since(peer.LastUpdated) > podInfoUpdateTTL {
 			delete(cache.Peers, k)
 		}
@@ -1417,11 +1773,19 @@ func (cache *Cache) InjectFeed(url string, twt types.Twt) {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
-	cached, ok := cache.Feeds[url]
+	if err := cache.journal.Append(url, twt); err != nil {
+		Logger(LogCache).WithError(err).Warnf("error journaling twt %s", twt.Hash())
+	}
 
+	cache.injectFeed(url, twt)
+	cache.timelines.Apply(FeedDeltas{{URL: url, Twts: types.Twts{twt}}})
+}
+
+// injectFeed injects a twt into a feed and the cache's views, the caller
+// must hold the cache's lock
+func (cache *Cache) injectFeed(url string, twt types.Twt) {
+	cached, ok := cache.Feeds.GetOrSet(url, NewCachedTwts(types.Twts{twt}, time.Now().Format(http.TimeFormat)))
 	if !ok {
-		cache.Feeds[url] = NewCachedTwts(types.Twts{twt}, time.Now().Format(http.TimeFormat))
-	} else {
 		cached.Inject(twt)
 	}
 
@@ -1432,11 +1796,14 @@ func (cache *Cache) InjectFeed(url string, twt types.Twt) {
 	// Update Cache.Map (hash -> Twt)
 	cache.Map[twt.Hash()] = twt
 
+	// Detect the language of the twt (See: FilterTwtsByLanguage)
+	twtLanguages.Get(twt)
+
 	// Update Cache.List ([]Twt)
 	cache.List.Inject(twt)
 
 	// Update Cache.Views (Local)
-	if cache.conf.IsLocalURL(twt.Twter().URI) {
+	if cache.config().IsLocalURL(twt.Twter().URI) && visibility.Listed(twt) {
 		if cache.Views[localViewKey] == nil {
 			cache.Views[localViewKey] = NewCached()
 		}
@@ -1444,7 +1811,7 @@ func (cache *Cache) InjectFeed(url string, twt types.Twt) {
 	}
 
 	// Update Cache.Views (Discover)
-	if FilterOutFeedsAndBotsFactory(cache.conf)(twt) {
+	if FilterOutFeedsAndBotsFactory(cache.config())(twt) && visibility.Listed(twt) && !cache.isGraylisted(twt.Twter().URI) {
 		if cache.Views[discoverViewKey] == nil {
 			cache.Views[discoverViewKey] = NewCached()
 		}
@@ -1484,6 +1851,8 @@ func (cache *Cache) InjectFeed(url string, twt types.Twt) {
 	// Update cached Twters
 	twter := twt.Twter()
 	cache.Twters[twter.URI] = &twter
+
+	cache.updatedAt = time.Now()
 }
 
 // SnipeFeed deletes a twt from a Cache.
@@ -1491,23 +1860,24 @@ func (cache *Cache) SnipeFeed(url string, twt types.Twt) {
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 
-	cached, ok := cache.Feeds[url]
-	if ok {
+	if cached, ok := cache.Feeds.Get(url); ok {
 		cached.Snipe(twt)
 	}
 
 	// Update Cache.Map (hash -> Twt)
 	delete(cache.Map, twt.Hash())
 
+	cache.updatedAt = time.Now()
+
 	// Update Cache.List ([]Twt)
 	cache.List.Snipe(twt)
+
+	cache.timelines.Snipe(twt)
 }
 
 // ShouldRefreshFeed ...
 func (cache *Cache) ShouldRefreshFeed(uri string) bool {
-	cache.mu.RLock()
-	cachedFeed, isCachedFeed := cache.Feeds[uri]
-	cache.mu.RUnlock()
+	cachedFeed, isCachedFeed := cache.Feeds.Get(uri)
 
 	if !isCachedFeed {
 		return true
@@ -1521,7 +1891,7 @@ func (cache *Cache) ShouldRefreshFeed(uri string) bool {
 	}
 
 	// Always refresh feeds on the same pod.
-	if cache.conf.IsLocalURL(uri) {
+	if cache.config().IsLocalURL(uri) {
 		return true
 	}
 
@@ -1537,11 +1907,11 @@ func (cache *Cache) ShouldRefreshFeed(uri string) bool {
 		}
 	}
 
-	if cache.conf.Features.IsEnabled(FeatureMovingAverageFeedRefresh) {
+	if cache.config().Features.IsEnabled(FeatureMovingAverageFeedRefresh) {
 		movingAverage := cachedFeed.GetMovingAverage()
 		boundedMovingAverage := math.Max(minimumFeedRefresh, math.Min(maximumFeedRefresh, movingAverage))
 		lastFetched := time.Since(cachedFeed.GetLastFetched())
-		log.
+		Logger(LogFetcher).
 			WithField("minimumFeedRefresh", minimumFeedRefresh).
 			WithField("maximumFeedRefresh", maximumFeedRefresh).
 			WithField("movingAverage", movingAverage).
@@ -1553,19 +1923,14 @@ func (cache *Cache) ShouldRefreshFeed(uri string) bool {
 	return true
 }
 
-// UpdateFeed ...
-func (cache *Cache) UpdateFeed(url, lastmodified string, twts types.Twts) {
-	cache.mu.RLock()
-	cached, ok := cache.Feeds[url]
-	cache.mu.RUnlock()
-
-	if !ok {
-		cache.mu.Lock()
-		cache.Feeds[url] = NewCachedTwts(twts, lastmodified)
-		cache.mu.Unlock()
-	} else {
-		cached.Update(lastmodified, twts)
+// UpdateFeed updates the cached twts of a feed and returns its new twts
+func (cache *Cache) UpdateFeed(url, lastmodified string, twts types.Twts) types.Twts {
+	cached, ok := cache.Feeds.GetOrSet(url, NewCachedTwts(twts, lastmodified))
+	if ok {
+		return twts
 	}
+
+	return cached.Update(lastmodified, twts)
 }
 
 func (cache *Cache) getFollowersv1(profile types.Profile) types.Followers {
@@ -1647,7 +2012,7 @@ func (cache *Cache) FollowedBy(user *User, uri string) bool {
 
 func (cache *Cache) getPeers() (peers Peers) {
 	for k, peer := range cache.Peers {
-		if k == "" || peer.IsZero() {
+		if k == "" || peer.IsZero() || cache.peerState(k) == PeerBlocked {
 			continue
 		}
 		peers = append(peers, peer)
@@ -1688,8 +2053,9 @@ func (cache *Cache) GetAll(refresh bool) types.Twts {
 	return nil
 }
 
+// FilterBy filters the twts of all cached feeds shard by shard
 func (cache *Cache) FilterBy(f FilterFunc) types.Twts {
-	return FilterTwtsBy(cache.GetAll(false), f)
+	return cache.Feeds.FilterBy(f)
 }
 
 func (cache *Cache) GroupBy(g GroupFunc) (res map[string]types.Twts) {
@@ -1719,29 +2085,32 @@ func (cache *Cache) GetMentions(u *User, refresh bool) types.Twts {
 	return twts
 }
 
+// IsTampered returns true if the feed failed signature verification when it
+// was last fetched
+func (cache *Cache) IsTampered(url string) bool {
+	cached, ok := cache.Feeds.Get(url)
+	return ok && cached.IsTampered()
+}
+
+// IsArchived returns true if a twt is no longer (or was never) in the cache
+// and is only available from the archive
+func (cache *Cache) IsArchived(twt types.Twt) bool {
+	if twt.IsZero() {
+		return false
+	}
+	_, ok := cache.Lookup(twt.Hash())
+	return !ok
+}
+
 // IsCached ...
 func (cache *Cache) IsCached(url string) bool {
-	cache.mu.RLock()
-	defer cache.mu.RUnlock()
-
-	_, ok := cache.Feeds[url]
+	_, ok := cache.Feeds.Get(url)
 	return ok
 }
 
 // GetOrSetCachedFeed ...
 func (cache *Cache) GetOrSetCachedFeed(url string) *Cached {
-	cache.mu.RLock()
-	cached, ok := cache.Feeds[url]
-	cache.mu.RUnlock()
-
-	if !ok {
-		cached = NewCached()
-
-		cache.mu.Lock()
-		cache.Feeds[url] = cached
-		cache.mu.Unlock()
-	}
-
+	cached, _ := cache.Feeds.GetOrSet(url, NewCached())
 	return cached
 }
 
@@ -1757,16 +2126,14 @@ func (cache *Cache) GetByView(key string) types.Twts {
 	return nil
 }
 
-// GetByUser ...
+// GetByUser returns the user's materialized timeline, building it if the
+// user has no timeline yet or refresh is true
 func (cache *Cache) GetByUser(u *User, refresh bool) types.Twts {
-	key := fmt.Sprintf("user:%s", u.Username)
-
-	cache.mu.RLock()
-	cached, ok := cache.Views[key]
-	cache.mu.RUnlock()
-
-	if ok && !refresh {
-		return cached.GetTwts()
+	if !refresh {
+		if twts, ok := cache.timelines.Get(u); ok {
+			cache.viewSources(u)
+			return twts
+		}
 	}
 
 	var twts types.Twts
@@ -1774,7 +2141,7 @@ func (cache *Cache) GetByUser(u *User, refresh bool) types.Twts {
 	for feed := range u.Sources() {
 		twts = append(twts, cache.GetByURL(feed.URL)...)
 	}
-	twts = cache.filterTwts(u, twts)
+	twts = cache.filterTimeline(u, twts)
 	sort.Sort(twts)
 
 	if u.DisplayTimelinePreference == "flat" {
@@ -1792,13 +2159,21 @@ func (cache *Cache) GetByUser(u *User, refresh bool) types.Twts {
 		twts = yarns.AsTwts()
 	}
 
-	cache.mu.Lock()
-	cache.Views[key] = NewCachedTwts(twts, "")
-	cache.mu.Unlock()
+	cache.timelines.Set(u, twts)
 
 	return twts
 }
 
+// viewSources records that the twts of the feeds of a user's timeline were
+// viewed so the feeds read most often are the last ones evicted
+func (cache *Cache) viewSources(u *User) {
+	for feed := range u.Sources() {
+		if cached, ok := cache.Feeds.Get(feed.URL); ok {
+			cached.SetLastViewed()
+		}
+	}
+}
+
 // GetByUserView ...
 func (cache *Cache) GetByUserView(u *User, view string, refresh bool) types.Twts {
 	if u == nil || u.Username == "" {
@@ -1816,7 +2191,15 @@ func (cache *Cache) GetByUserView(u *User, view string, refresh bool) types.Twts
 		return cached.GetTwts()
 	}
 
-	twts := cache.filterTwts(u, cache.GetByView(view))
+	filterTwts := cache.filterTwts
+	if view == discoverViewKey || view == localViewKey {
+		filterTwts = cache.filterTimeline
+	}
+
+	twts := filterTwts(u, cache.GetByView(view))
+	if view == discoverViewKey {
+		twts = FilterTwtsByLanguage(u.DiscoverLanguages, twts)
+	}
 	sort.Sort(twts)
 
 	cache.mu.Lock()
@@ -1828,10 +2211,8 @@ func (cache *Cache) GetByUserView(u *User, view string, refresh bool) types.Twts
 
 // GetByURL ...
 func (cache *Cache) GetByURL(url string) types.Twts {
-	cache.mu.RLock()
-	defer cache.mu.RUnlock()
-
-	if cached, ok := cache.Feeds[url]; ok {
+	if cached, ok := cache.Feeds.Get(url); ok {
+		cached.SetLastViewed()
 		return cached.GetTwts()
 	}
 	return types.Twts{}
@@ -1887,6 +2268,11 @@ func (cache *Cache) GetTwter(uri string) *types.Twter {
 
 // SetTwter ...
 func (cache *Cache) SetTwter(uri string, twter *types.Twter) {
+	// Local feeds are flagged as automated by their owners instead
+	if !cache.config().IsLocalURL(uri) {
+		automated.Declare(uri, twter)
+	}
+
 	cache.mu.Lock()
 	defer cache.mu.Unlock()
 	cache.Twters[uri] = twter
@@ -1904,15 +2290,16 @@ func (cache *Cache) DeleteUserViews(u *User) {
 		}
 	}
 	cache.mu.Unlock()
+
+	cache.timelines.Delete(u.Username)
 }
 
 // DeleteFeeds ...
 func (cache *Cache) DeleteFeeds(feeds types.FetchFeedRequests) {
-	cache.mu.Lock()
 	for feed := range feeds {
-		delete(cache.Feeds, feed.URL)
+		cache.Feeds.Delete(feed.URL)
 	}
-	cache.mu.Unlock()
+	cache.timelines.Reset()
 	cache.Refresh()
 }
 
@@ -1922,15 +2309,26 @@ func (cache *Cache) Reset() {
 
 	cache.Map = make(map[string]types.Twt)
 	cache.Peers = make(map[string]*Peer)
-	cache.Feeds = make(map[string]*Cached)
+	cache.Feeds.Reset()
 	cache.Views = make(map[string]*Cached)
+	cache.timelines.Reset()
 
 	cache.Followers = make(map[string]types.Followers)
 	cache.Twters = make(map[string]*types.Twter)
 
+	cache.updatedAt = time.Now()
+
 	cache.mu.Unlock()
 }
 
+// UpdatedAt returns when the cache's views were last updated
+func (cache *Cache) UpdatedAt() time.Time {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	return cache.updatedAt
+}
+
 // PruneFollowers ...
 func (cache *Cache) PruneFollowers(olderThan time.Duration) {
 	cache.mu.Lock()
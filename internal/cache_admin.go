@@ -0,0 +1,128 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+var (
+	// ErrFeedNotCached is returned when operating on a feed not in the cache
+	ErrFeedNotCached = errors.New("error: feed not cached")
+
+	// ErrFeedAlreadyCached is returned when re-keying a feed to a url that
+	// is already cached
+	ErrFeedAlreadyCached = errors.New("error: feed already cached")
+)
+
+// ReadCacheFile reads the on-disk cache at fn for inspection or surgery by
+// admin tools while the pod is stopped. Unlike LoadCacheFromFile a corrupt
+// or outdated cache is never removed or migrated, an error is returned
+// instead. Twts in the cache's journal are replayed so that these are not
+// lost when the cache is written back with WriteFile.
+func ReadCacheFile(conf *Config, fn string) (*Cache, error) {
+	cache := NewCache(conf)
+
+	f, err := os.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dec := gob.NewDecoder(f)
+
+	if err := dec.Decode(&cache.Version); err != nil {
+		return nil, fmt.Errorf("error decoding cache.Version: %w", err)
+	}
+
+	if cache.Version != feedCacheVersion {
+		return nil, fmt.Errorf(
+			"error: cache version %d is not supported (expected v%d), start the pod once to migrate it",
+			cache.Version, feedCacheVersion,
+		)
+	}
+
+	if err := dec.Decode(&cache.Peers); err != nil {
+		return nil, fmt.Errorf("error decoding cache.Peers: %w", err)
+	}
+
+	var feeds map[string]*Cached
+	if err := dec.Decode(&feeds); err != nil {
+		return nil, fmt.Errorf("error decoding cache.Feeds: %w", err)
+	}
+	cache.Feeds = NewFeedShardsFrom(feeds)
+
+	if err := dec.Decode(&cache.Followers); err != nil {
+		return nil, fmt.Errorf("error decoding cache.Followers: %w", err)
+	}
+
+	if err := dec.Decode(&cache.Twters); err != nil {
+		return nil, fmt.Errorf("error decoding cache.Twters: %w", err)
+	}
+
+	if err := cache.replayJournal(filepath.Join(filepath.Dir(fn), cacheJournalFile)); err != nil {
+		return nil, fmt.Errorf("error replaying cache journal: %w", err)
+	}
+
+	cache.Refresh()
+
+	return cache, nil
+}
+
+// RekeyFeed moves the cached feed at url from to url to along with its
+// followers and twter (e.g: when a feed has moved to another domain). The
+// feed's twts are left untouched so their hashes remain the same.
+func (cache *Cache) RekeyFeed(from, to string) error {
+	cached, ok := cache.Feeds.Get(from)
+	if !ok {
+		return ErrFeedNotCached
+	}
+	if _, ok := cache.Feeds.GetOrSet(to, cached); !ok {
+		return ErrFeedAlreadyCached
+	}
+	cache.Feeds.Delete(from)
+
+	cache.mu.Lock()
+	if followers, ok := cache.Followers[from]; ok {
+		cache.Followers[to] = followers
+		delete(cache.Followers, from)
+	}
+	if twter, ok := cache.Twters[from]; ok {
+		moved := *twter
+		moved.URI = to
+		cache.Twters[to] = &moved
+		delete(cache.Twters, from)
+	}
+	cache.mu.Unlock()
+
+	cache.timelines.Reset()
+	cache.Refresh()
+
+	return nil
+}
+
+// Compact removes cached feeds without any twts (that were not evicted to
+// the archive) and returns the number of feeds removed
+func (cache *Cache) Compact() int {
+	removed := 0
+	for url, cached := range cache.Feeds.Map() {
+		cached.mu.RLock()
+		empty := len(cached.Twts) == 0 && !cached.Evicted
+		cached.mu.RUnlock()
+
+		if empty {
+			cache.Feeds.Delete(url)
+			removed++
+		}
+	}
+
+	cache.timelines.Reset()
+	cache.Refresh()
+
+	return removed
+}
@@ -0,0 +1,181 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"go.yarn.social/types"
+)
+
+// twtMemoryOverhead approximates the memory used by a parsed twt relative
+// to the size of its serialized form
+const twtMemoryOverhead = 4
+
+// MemorySize returns the estimated memory used by the feed's twts
+func (cached *Cached) MemorySize() int64 {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	if !cached.sized {
+		var size int64
+		for _, twt := range cached.Twts {
+			size += int64(len(fmt.Sprintf("%+l", twt))) * twtMemoryOverhead
+		}
+		cached.size = size
+		cached.sized = true
+	}
+
+	return cached.size
+}
+
+// SetMemorySize records the estimated memory used by the feed's twts
+func (cached *Cached) SetMemorySize(size int64) {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	cached.size = size
+	cached.sized = true
+}
+
+// fetchedMemorySize estimates the memory used by the kept twts of a fetched
+// feed of fetched twts from the size of the feed, so that fetched twts are
+// never serialized again just to size them
+func fetchedMemorySize(data []byte, fetched, kept int) int64 {
+	if fetched == 0 {
+		return 0
+	}
+	return int64(len(data)) * int64(kept) / int64(fetched) * twtMemoryOverhead
+}
+
+// UpdateFetchedFeed updates the twts of a fetched feed (See: UpdateFeed) and
+// records their memory size estimated from the fetched feed's data
+func (cache *Cache) UpdateFetchedFeed(url, lastmodified string, twts types.Twts, data []byte, fetched int) types.Twts {
+	delta := cache.UpdateFeed(url, lastmodified, twts)
+
+	// UpdateFeed keeps the cached twts if the feed has none
+	if len(twts) > 0 {
+		if cached, ok := cache.Feeds.Get(url); ok {
+			cached.SetMemorySize(fetchedMemorySize(data, fetched, len(twts)))
+		}
+	}
+
+	return delta
+}
+
+// SetLastViewed records that the feed's twts were viewed. If the feed was
+// evicted its last modified time is reset so the next fetch restores it.
+func (cached *Cached) SetLastViewed() {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	cached.LastViewed = time.Now()
+	if cached.Evicted {
+		cached.LastModified = ""
+	}
+}
+
+// GetLastViewed ...
+func (cached *Cached) GetLastViewed() time.Time {
+	cached.mu.RLock()
+	defer cached.mu.RUnlock()
+
+	return cached.LastViewed
+}
+
+// Evict drops the feed's twts from memory keeping only its metadata and
+// returns the evicted twts
+func (cached *Cached) Evict() types.Twts {
+	cached.mu.Lock()
+	defer cached.mu.Unlock()
+
+	twts := cached.Twts
+	if cached.EvictedHashes == nil {
+		cached.EvictedHashes = make(map[string]bool, len(twts))
+	}
+	for _, twt := range twts {
+		cached.EvictedHashes[twt.Hash()] = true
+	}
+	cached.Twts = nil
+	cached.Evicted = true
+	cached.size = 0
+	cached.sized = true
+
+	return twts
+}
+
+// MemoryUsage returns the estimated memory used by the twts of all feeds
+func (cache *Cache) MemoryUsage() int64 {
+	var usage int64
+	for _, cached := range cache.Feeds.Map() {
+		usage += cached.MemorySize()
+	}
+	return usage
+}
+
+// EnforceMemoryBudget evicts the least recently viewed external feeds to the
+// archive until the cache is within its memory budget (if any) and returns
+// the number of evicted feeds. It walks every feed and so is run once per
+// fetch cycle (See: UpdateFeedsJob) rather than on every fetch.
+func (cache *Cache) EnforceMemoryBudget(archive Archiver) int {
+	type feed struct {
+		url    string
+		cached *Cached
+		size   int64
+	}
+
+	var (
+		feeds []feed
+		usage int64
+	)
+
+	for url, cached := range cache.Feeds.Map() {
+		size := cached.MemorySize()
+		usage += size
+		if size > 0 && !cache.config().IsLocalURL(url) {
+			feeds = append(feeds, feed{url, cached, size})
+		}
+	}
+
+	budget := cache.config().MaxCacheMemory
+	if budget <= 0 || usage <= budget {
+		metrics.Gauge("cache", "memory_bytes").Set(float64(usage))
+		return 0
+	}
+
+	sort.Slice(feeds, func(i, j int) bool {
+		return feeds[i].cached.GetLastViewed().Before(feeds[j].cached.GetLastViewed())
+	})
+
+	evicted := 0
+	for _, feed := range feeds {
+		if usage <= budget {
+			break
+		}
+
+		for _, twt := range feed.cached.Evict() {
+			if archive.Has(twt.Hash()) {
+				continue
+			}
+			if err := archive.Archive(twt); err != nil {
+				Logger(LogCache).WithError(err).Errorf("error archiving evicted twt %s", twt.Hash())
+				metrics.Counter("archive", "error").Inc()
+			} else {
+				metrics.Counter("archive", "size").Inc()
+			}
+		}
+
+		usage -= feed.size
+		evicted++
+	}
+
+	metrics.Counter("cache", "evictions").Add(float64(evicted))
+	metrics.Gauge("cache", "memory_bytes").Set(float64(usage))
+
+	Logger(LogCache).Infof("evicted %d feeds to stay within the memory budget of %d bytes", evicted, budget)
+
+	return evicted
+}
@@ -0,0 +1,139 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+const (
+	// cacheJournalFile is the write-ahead journal of twts injected into the
+	// cache since its last snapshot
+	cacheJournalFile = "cache.journal"
+)
+
+// cacheJournalEntry is a single InjectFeed operation
+type cacheJournalEntry struct {
+	URL string          `json:"url"`
+	Twt json.RawMessage `json:"twt"`
+}
+
+// CacheJournal is a write-ahead journal of InjectFeed operations so that
+// twts injected into the cache (e.g: locally posted twts) survive a crash
+// between cache snapshots. The journal is truncated when the cache is stored.
+type CacheJournal struct {
+	mu sync.Mutex
+	fn string
+	f  *os.File
+}
+
+// NewCacheJournal ...
+func NewCacheJournal(fn string) *CacheJournal {
+	return &CacheJournal{fn: fn}
+}
+
+// Append appends an InjectFeed operation to the journal and syncs it to disk
+func (j *CacheJournal) Append(url string, twt types.Twt) error {
+	if j == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(&twt)
+	if err != nil {
+		return err
+	}
+
+	line, err := json.Marshal(cacheJournalEntry{URL: url, Twt: data})
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		f, err := os.OpenFile(j.fn, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		j.f = f
+	}
+
+	if _, err := j.f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+
+	return j.f.Sync()
+}
+
+// Replay calls f for every InjectFeed operation in the journal
+func (j *CacheJournal) Replay(f func(url string, twt types.Twt)) (int, error) {
+	if j == nil {
+		return 0, nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	r, err := os.Open(j.fn)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	defer r.Close()
+
+	var n int
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1<<20)
+	for scanner.Scan() {
+		var entry cacheJournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			// A torn write of the last entry before a crash
+			Logger(LogCache).WithError(err).Warn("error decoding cache journal entry (skipping)")
+			continue
+		}
+
+		twt, err := types.DecodeJSON(entry.Twt)
+		if err != nil {
+			Logger(LogCache).WithError(err).Warn("error decoding twt in cache journal (skipping)")
+			continue
+		}
+
+		f(entry.URL, twt)
+		n++
+	}
+
+	return n, scanner.Err()
+}
+
+// Truncate empties the journal once its operations are part of a snapshot
+func (j *CacheJournal) Truncate() error {
+	if j == nil {
+		return nil
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f != nil {
+		if err := j.f.Close(); err != nil {
+			return err
+		}
+		j.f = nil
+	}
+
+	if err := os.Remove(j.fn); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
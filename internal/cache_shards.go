@@ -0,0 +1,188 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"hash/fnv"
+	"sort"
+
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+// feedCacheShards is the number of shards the cached feeds are split into
+const feedCacheShards = 32
+
+type feedShard struct {
+	mu    sync.RWMutex
+	feeds map[string]*Cached
+}
+
+// FeedShards holds the cached feeds sharded by the hash of their url, each
+// shard with its own lock, so that slow readers of some feeds (such as a
+// Refresh) do not block updates of others during a refresh cycle
+type FeedShards struct {
+	shards [feedCacheShards]*feedShard
+}
+
+// NewFeedShards ...
+func NewFeedShards() *FeedShards {
+	fs := &FeedShards{}
+	for i := range fs.shards {
+		fs.shards[i] = &feedShard{feeds: make(map[string]*Cached)}
+	}
+	return fs
+}
+
+// NewFeedShardsFrom shards a map of cached feeds (as stored on disk)
+func NewFeedShardsFrom(feeds map[string]*Cached) *FeedShards {
+	fs := NewFeedShards()
+	for url, cached := range feeds {
+		fs.Set(url, cached)
+	}
+	return fs
+}
+
+func (fs *FeedShards) shard(url string) *feedShard {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(url))
+	return fs.shards[h.Sum32()%feedCacheShards]
+}
+
+// Get returns the cached feed of url
+func (fs *FeedShards) Get(url string) (*Cached, bool) {
+	shard := fs.shard(url)
+	shard.mu.RLock()
+	defer shard.mu.RUnlock()
+
+	cached, ok := shard.feeds[url]
+	return cached, ok
+}
+
+// Set sets the cached feed of url
+func (fs *FeedShards) Set(url string, cached *Cached) {
+	shard := fs.shard(url)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.feeds[url] = cached
+}
+
+// GetOrSet returns the cached feed of url, or sets it to cached if the feed
+// is not cached yet. Returns true if cached was set.
+func (fs *FeedShards) GetOrSet(url string, cached *Cached) (*Cached, bool) {
+	shard := fs.shard(url)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	if existing, ok := shard.feeds[url]; ok {
+		return existing, false
+	}
+	shard.feeds[url] = cached
+	return cached, true
+}
+
+// Delete removes the cached feed of url
+func (fs *FeedShards) Delete(url string) {
+	shard := fs.shard(url)
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	delete(shard.feeds, url)
+}
+
+// Reset removes all cached feeds
+func (fs *FeedShards) Reset() {
+	for _, shard := range fs.shards {
+		shard.mu.Lock()
+		shard.feeds = make(map[string]*Cached)
+		shard.mu.Unlock()
+	}
+}
+
+// Len returns the number of cached feeds
+func (fs *FeedShards) Len() int {
+	n := 0
+	for _, shard := range fs.shards {
+		shard.mu.RLock()
+		n += len(shard.feeds)
+		shard.mu.RUnlock()
+	}
+	return n
+}
+
+// URLs returns the sorted urls of all cached feeds
+func (fs *FeedShards) URLs() []string {
+	var urls []string
+	for _, shard := range fs.shards {
+		shard.mu.RLock()
+		for url := range shard.feeds {
+			urls = append(urls, url)
+		}
+		shard.mu.RUnlock()
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// Map returns a copy of all cached feeds keyed by their url
+func (fs *FeedShards) Map() map[string]*Cached {
+	feeds := make(map[string]*Cached)
+	for _, shard := range fs.shards {
+		shard.mu.RLock()
+		for url, cached := range shard.feeds {
+			feeds[url] = cached
+		}
+		shard.mu.RUnlock()
+	}
+	return feeds
+}
+
+// FilterBy returns the twts of all cached feeds matching f (or all twts if f
+// is nil). Each shard is filtered concurrently holding only its own lock and
+// the results are merged, de-duplicated and sorted.
+func (fs *FeedShards) FilterBy(f FilterFunc) types.Twts {
+	results := make([]types.Twts, feedCacheShards)
+
+	var wg sync.WaitGroup
+	for i, shard := range fs.shards {
+		wg.Add(1)
+		go func(i int, shard *feedShard) {
+			defer wg.Done()
+
+			shard.mu.RLock()
+			feeds := make([]*Cached, 0, len(shard.feeds))
+			for _, cached := range shard.feeds {
+				feeds = append(feeds, cached)
+			}
+			shard.mu.RUnlock()
+
+			var twts types.Twts
+			for _, cached := range feeds {
+				for _, twt := range cached.GetTwts() {
+					if f == nil || f(twt) {
+						twts = append(twts, twt)
+					}
+				}
+			}
+			results[i] = twts
+		}(i, shard)
+	}
+	wg.Wait()
+
+	var twts types.Twts
+	for _, res := range results {
+		twts = append(twts, res...)
+	}
+
+	twts = UniqTwts(twts)
+	sort.Sort(twts)
+
+	return twts
+}
+
+// Twts returns the twts of all cached feeds de-duplicated and sorted
+func (fs *FeedShards) Twts() types.Twts {
+	return fs.FilterBy(nil)
+}
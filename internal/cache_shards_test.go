@@ -0,0 +1,141 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.yarn.social/types"
+)
+
+const (
+	benchmarkFeeds       = 512
+	benchmarkTwtsPerFeed = 20
+)
+
+// feedStore is implemented by FeedShards and the single-lock baseline
+type feedStore interface {
+	Set(url string, cached *Cached)
+	FilterBy(f FilterFunc) types.Twts
+}
+
+// singleLockFeeds is a cache of feeds behind a single lock, as the cache was
+// before it was sharded, used as the baseline of the benchmarks
+type singleLockFeeds struct {
+	mu    sync.RWMutex
+	feeds map[string]*Cached
+}
+
+func (s *singleLockFeeds) Set(url string, cached *Cached) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.feeds[url] = cached
+}
+
+func (s *singleLockFeeds) FilterBy(f FilterFunc) types.Twts {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var twts types.Twts
+	for _, cached := range s.feeds {
+		for _, twt := range cached.GetTwts() {
+			if f == nil || f(twt) {
+				twts = append(twts, twt)
+			}
+		}
+	}
+
+	twts = UniqTwts(twts)
+	sort.Sort(twts)
+
+	return twts
+}
+
+func benchmarkFeedURL(i int) string {
+	return fmt.Sprintf("https://example.com/user/user%d/twtxt.txt", i)
+}
+
+func benchmarkCachedFeed(i int) *Cached {
+	twter := types.NewTwter(fmt.Sprintf("user%d", i), benchmarkFeedURL(i))
+
+	twts := make(types.Twts, 0, benchmarkTwtsPerFeed)
+	for j := 0; j < benchmarkTwtsPerFeed; j++ {
+		created := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(i*benchmarkTwtsPerFeed+j) * time.Minute)
+		twts = append(twts, types.MakeTwt(twter, created, fmt.Sprintf("Hello #%d from user%d", j, i)))
+	}
+
+	return NewCachedTwts(twts, "")
+}
+
+func populateFeedStore(fs feedStore) {
+	for i := 0; i < benchmarkFeeds; i++ {
+		fs.Set(benchmarkFeedURL(i), benchmarkCachedFeed(i))
+	}
+}
+
+// benchmarkFeedStore runs readers filtering all feeds concurrently with
+// writers updating feeds (as fetches do during a refresh cycle). One in every
+// readEvery operations is a read, the others are updates.
+func benchmarkFeedStore(b *testing.B, fs feedStore, readEvery int) {
+	populateFeedStore(fs)
+
+	cached := make([]*Cached, benchmarkFeeds)
+	for i := range cached {
+		cached[i] = benchmarkCachedFeed(i)
+	}
+
+	var n int64
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			i := int(atomic.AddInt64(&n, 1))
+			if i%readEvery == 0 {
+				fs.FilterBy(nil)
+			} else {
+				fs.Set(benchmarkFeedURL(i%benchmarkFeeds), cached[i%benchmarkFeeds])
+			}
+		}
+	})
+}
+
+func TestFeedShardsFilterBy(t *testing.T) {
+	assert := assert.New(t)
+
+	sharded := NewFeedShards()
+	baseline := &singleLockFeeds{feeds: make(map[string]*Cached)}
+	populateFeedStore(sharded)
+	populateFeedStore(baseline)
+
+	assert.Equal(benchmarkFeeds, sharded.Len())
+	assert.Equal(baseline.FilterBy(nil), sharded.FilterBy(nil))
+
+	first := func(twt types.Twt) bool { return twt.Twter().Nick == "user0" }
+	assert.Len(sharded.FilterBy(first), benchmarkTwtsPerFeed)
+}
+
+func BenchmarkFeedShards_FilterBy(b *testing.B) {
+	benchmarkFeedStore(b, NewFeedShards(), 1)
+}
+
+func BenchmarkSingleLock_FilterBy(b *testing.B) {
+	benchmarkFeedStore(b, &singleLockFeeds{feeds: make(map[string]*Cached)}, 1)
+}
+
+func BenchmarkFeedShards_Contention(b *testing.B) {
+	benchmarkFeedStore(b, NewFeedShards(), 10)
+}
+
+func BenchmarkSingleLock_Contention(b *testing.B) {
+	benchmarkFeedStore(b, &singleLockFeeds{feeds: make(map[string]*Cached)}, 10)
+}
@@ -9,6 +9,7 @@ import (
 	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -18,7 +19,13 @@ import (
 )
 
 var (
-	testConfig = &Config{Debug: true, requestTimeout: 100 * time.Millisecond}
+	testConfig = &Config{
+		Debug:          true,
+		requestTimeout: 100 * time.Millisecond,
+
+		// Test servers listen on the loopback interface
+		fetchAllowedNetworks: mustParseCIDRs("127.0.0.0/8"),
+	}
 
 	testLocalNick  = "admin"
 	testLocalFeed  = "http://127.0.0.1:8000/user/admin/twtxt.txt"
@@ -440,6 +447,109 @@ func TestCache_Counts(t *testing.T) {
 	})
 }
 
+func TestCache_UpdateFeedDelta(t *testing.T) {
+	cache := NewCache(testConfig)
+
+	delta := cache.UpdateFeed(testExternalFeed, "", testExternalTwts[:1])
+	assert.Equal(t, 1, len(delta))
+
+	delta = cache.UpdateFeed(testExternalFeed, "", testExternalTwts)
+	assert.Equal(t, 1, len(delta))
+	assert.Equal(t, testExternalTwts[1].Hash(), delta[0].Hash())
+
+	delta = cache.UpdateFeed(testExternalFeed, "", testExternalTwts)
+	assert.Equal(t, 0, len(delta))
+}
+
+func TestCache_MaterializedTimeline(t *testing.T) {
+	cache := NewCache(testConfig)
+	user := &User{Username: "test", URL: testExternalFeed}
+
+	cache.UpdateFeed(testExternalFeed, "", testExternalTwts[:1])
+	assert.Equal(t, 1, len(cache.GetByUser(user, false)))
+
+	delta := cache.UpdateFeed(testExternalFeed, "", testExternalTwts)
+	cache.timelines.Apply(FeedDeltas{{URL: testExternalFeed, Twts: delta}})
+	assert.Equal(t, 2, len(cache.GetByUser(user, false)))
+
+	cache.DeleteUserViews(user)
+	assert.Equal(t, 0, cache.timelines.Len())
+}
+
+func TestCache_MaterializedTimelineSettings(t *testing.T) {
+	cache := NewCache(testConfig)
+	user := &User{
+		Username: "test",
+		URL:      testExternalFeed,
+		Muted:    make(map[string]string),
+		muted:    make(map[string]string),
+	}
+
+	cache.UpdateFeed(testExternalFeed, "", testExternalTwts)
+	assert.Equal(t, 2, len(cache.GetByUser(user, false)))
+
+	// The timeline is rebuilt with the user's new settings
+	hash := testExternalTwts[0].Hash()
+	user.Mute(hash, hash)
+	twts := cache.GetByUser(user, false)
+	assert.Equal(t, 1, len(twts))
+	assert.NotEqual(t, hash, twts[0].Hash())
+}
+
+func TestCached_Evict(t *testing.T) {
+	cached := NewCachedTwts(testExternalTwts, "Mon, 01 Jan 2022 00:00:00 GMT")
+	assert.True(t, cached.MemorySize() > 0)
+
+	evicted := cached.Evict()
+	assert.Equal(t, len(testExternalTwts), len(evicted))
+	assert.Equal(t, int64(0), cached.MemorySize())
+	assert.Equal(t, 0, len(cached.GetTwts()))
+
+	cached.SetLastViewed()
+	assert.Equal(t, "", cached.GetLastModified())
+
+	// Restored twts are not new twts
+	assert.Empty(t, cached.Update("", testExternalTwts))
+	assert.False(t, cached.Evicted)
+	assert.True(t, cached.MemorySize() > 0)
+}
+
+func TestCache_GetByUserLastViewed(t *testing.T) {
+	cache := NewCache(testConfig)
+	user := &User{
+		Username: "test",
+		URL:      testExternalFeed,
+		Muted:    make(map[string]string),
+		muted:    make(map[string]string),
+	}
+
+	cache.UpdateFeed(testExternalFeed, "", testExternalTwts)
+	cached, ok := cache.Feeds.Get(testExternalFeed)
+	require.True(t, ok)
+
+	cache.GetByUser(user, false)
+	assert.False(t, cached.GetLastViewed().IsZero())
+
+	// Reads of the materialized timeline are views of its feeds too
+	cached.LastViewed = time.Time{}
+	cache.GetByUser(user, false)
+	assert.False(t, cached.GetLastViewed().IsZero())
+}
+
+func TestCache_UpdateFetchedFeed(t *testing.T) {
+	cache := NewCache(testConfig)
+	data := []byte("2021-01-01T00:00:00Z\tHello\n2021-01-02T00:00:00Z\tWorld\n")
+
+	cache.UpdateFetchedFeed(testExternalFeed, "", testExternalTwts, data, 4)
+	cached, ok := cache.Feeds.Get(testExternalFeed)
+	require.True(t, ok)
+	assert.Equal(t, int64(len(data))/2*twtMemoryOverhead, cached.MemorySize())
+
+	// Feeds without twts keep their cached twts and size
+	cache.UpdateFetchedFeed(testExternalFeed, "", nil, nil, 0)
+	assert.Equal(t, int64(len(data))/2*twtMemoryOverhead, cached.MemorySize())
+}
+
 // Ensure that when a twt is sniped, it never occurs in
 // a Cache again.
 func TestCache_Snipe(t *testing.T) {
@@ -469,7 +579,7 @@ func TestCache_Snipe(t *testing.T) {
 	//
 
 	// Check cache.Feeds
-	for key, cached := range cache.Feeds {
+	for key, cached := range cache.Feeds.Map() {
 		for _, twt := range cached.GetTwts() {
 			if twt.Hash() == badtwt.Hash() {
 				err := fmt.Errorf("error, deleted twt found in Cache.Feeds[%s]", key)
@@ -546,3 +656,53 @@ func TestCache_InjectUpdatesTwters(t *testing.T) {
 	assert.Equal(&testExternalTwter, cache.GetTwter(testExternalTwter.URI))
 	assert.Equal(&testExternalTwter, cache.FindTwter(testExternalTwter.Nick))
 }
+
+func TestCache_JournalReplay(t *testing.T) {
+	conf := &Config{Debug: true, Data: t.TempDir(), requestTimeout: 100 * time.Millisecond}
+
+	cache, err := LoadCache(conf)
+	require.NoError(t, err)
+
+	twt := types.MakeTwt(testLocalTwter, time.Time{}, "Not lost in a crash")
+	cache.InjectFeed(testLocalFeed, twt)
+
+	// Simulate a crash before the next snapshot
+	cache, err = LoadCache(conf)
+	require.NoError(t, err)
+
+	_, has := cache.Lookup(twt.Hash())
+	assert.True(t, has)
+
+	// Snapshots truncate the journal
+	require.NoError(t, cache.Store(conf))
+	assert.False(t, FileExists(filepath.Join(conf.Data, cacheJournalFile)))
+
+	cache, err = LoadCache(conf)
+	require.NoError(t, err)
+
+	_, has = cache.Lookup(twt.Hash())
+	assert.True(t, has)
+}
+
+func TestCache_RekeyFeed(t *testing.T) {
+	conf := &Config{Debug: true, Data: t.TempDir(), requestTimeout: 100 * time.Millisecond}
+	fn := filepath.Join(conf.Data, feedCacheFile)
+
+	cache := NewCache(conf)
+	cache.UpdateFeed(testExternalFeed, "", testExternalTwts)
+	cache.Refresh()
+	require.NoError(t, cache.WriteFile(fn))
+
+	cache, err := ReadCacheFile(conf, fn)
+	require.NoError(t, err)
+
+	moved := "https://moved.example.com/twtxt.txt"
+	require.NoError(t, cache.RekeyFeed(testExternalFeed, moved))
+	assert.ErrorIs(t, cache.RekeyFeed(testExternalFeed, moved), ErrFeedNotCached)
+	assert.False(t, cache.IsCached(testExternalFeed))
+	assert.Equal(t, len(testExternalTwts), len(cache.GetByURL(moved)))
+
+	cache.UpdateFeed(testExternalFeed, "", nil)
+	assert.Equal(t, 1, cache.Compact())
+	assert.Equal(t, 1, cache.FeedCount())
+}
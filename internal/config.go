@@ -6,9 +6,12 @@ import (
 	"io/fs"
 	"io/ioutil"
 	"math/rand"
+	"net"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"reflect"
 	"regexp"
 	"strings"
 	"time"
@@ -45,10 +48,13 @@ type Settings struct {
 	CSS         string `yaml:"pod_css"`
 	Description string `yaml:"pod_description"`
 
-	AlertFloat   bool   `yaml:"pod_alert_float"`
-	AlertGuest   bool   `yaml:"pod_alert_guest"`
-	AlertMessage string `yaml:"pod_alert_message"`
-	AlertType    string `yaml:"pod_alert_type"`
+	AlertFloat bool `yaml:"pod_alert_float"`
+
+	// Deprecated: The alert is migrated to an announcement (See:
+	// Announcements.MigrateAlert)
+	AlertGuest   bool   `yaml:"pod_alert_guest,omitempty"`
+	AlertMessage string `yaml:"pod_alert_message,omitempty"`
+	AlertType    string `yaml:"pod_alert_type,omitempty"`
 
 	MaxTwtLength     int `yaml:"max_twt_length"`
 	TwtsPerPage      int `yaml:"twts_per_page"`
@@ -57,6 +63,13 @@ type Settings struct {
 
 	OpenProfiles      bool `yaml:"open_profiles"`
 	OpenRegistrations bool `yaml:"open_registrations"`
+	PublicAPI         bool `yaml:"public_api"`
+
+	ReservedUsernames []string `yaml:"reserved_usernames"`
+	UsernameMinLength int      `yaml:"username_min_length"`
+	UsernameMaxLength int      `yaml:"username_max_length"`
+	UsernamePattern   string   `yaml:"username_pattern"`
+	UsernameProfanity []string `yaml:"username_profanity"`
 
 	// XXX: Deprecated fields (See: https://git.mills.io/yarnsocial/yarn/pulls/711)
 	// TODO: Remove post v0.14.x
@@ -64,9 +77,19 @@ type Settings struct {
 	WhitelistedImages []string `yaml:"whitelisted_images"`
 
 	BlockedFeeds    []string      `yaml:"blocked_feeds"`
+	AllowedFeeds    []string      `yaml:"allowed_feeds"`
 	PermittedImages []string      `yaml:"permitted_images"`
 	Features        *FeatureFlags `yaml:"features"`
 
+	ActiveTheme string `yaml:"active_theme"`
+
+	FetchInterval string `yaml:"fetch_interval"`
+
+	LogLevels map[string]string `yaml:"log_levels"`
+
+	// Branding are the hashes of the uploaded logo and favicon variants
+	Branding map[string]string `yaml:"branding"`
+
 	// Pod Level Settings (overridable by Users)
 	DisplayDatesInTimezone  string `yaml:"display_dates_in_timezone"`
 	DisplayTimePreference   string `yaml:"display_time_preference"`
@@ -74,6 +97,7 @@ type Settings struct {
 	DisplayImagesPreference string `yaml:"display_images_preference"`
 	DisplayMedia            bool   `yaml:"display_media"`
 	OriginalMedia           bool   `yaml:"original_media"`
+	DiscoverRanking         string `yaml:"discover_ranking"`
 
 	VisibilityCompact  bool `yaml:"visibility_compact"`
 	VisibilityReadmore bool `yaml:"visibility_readmore"`
@@ -103,17 +127,25 @@ type Config struct {
 
 	Debug bool
 
-	TLS     bool
-	TLSKey  string
-	TLSCert string
+	TLS             bool
+	TLSKey          string
+	TLSCert         string
+	TLSOCSPStapling bool
+	TLSHTTP3        bool
+
+	Listeners []string `json:"-"`
 
 	Data              string `json:"-"`
 	Name              string
 	Logo              string
 	CSS               string
 	Description       string
-	Store             string `json:"-"`
-	Theme             string `json:"-"`
+	Store             string            `json:"-"`
+	Theme             string            `json:"-"`
+	ThemesDirs        []string          `json:"-"`
+	ActiveTheme       string            `json:"-"`
+	LogLevels         map[string]string `json:"-"`
+	Branding          map[string]string `json:"-"`
 	AlertFloat        bool
 	AlertGuest        bool
 	AlertMessage      string
@@ -124,6 +156,9 @@ type Config struct {
 	AdminName         string `json:"-"`
 	AdminEmail        string `json:"-"`
 	FeedSources       []string
+	CORSOrigins       []string
+	CORSHeaders       []string
+	CORSMethods       []string
 	CookieSecret      string `json:"-"`
 	TwtPrompts        []string
 	TwtsPerPage       int
@@ -136,14 +171,28 @@ type Config struct {
 	MaxCacheItems     int
 	OpenProfiles      bool
 	OpenRegistrations bool
+	PublicAPI         bool
+	APIValidation     bool
 	DisableGzip       bool
 	DisableLogger     bool
 	DisableMedia      bool
 	DisableFfmpeg     bool
+	DisableMediaProxy bool
 	SessionExpiry     time.Duration
 	SessionCacheTTL   time.Duration
 	TranscoderTimeout time.Duration
 
+	DeletionGracePeriod time.Duration
+
+	ReservedUsernames []string
+	UsernameMinLength int
+	UsernameMaxLength int
+	UsernamePattern   string
+	UsernameProfanity []string
+
+	usernamePattern *regexp.Regexp
+	usernamePolicy  UsernamePolicy
+
 	MagicLinkSecret string `json:"-"`
 
 	SMTPHost string `json:"-"`
@@ -152,8 +201,29 @@ type Config struct {
 	SMTPPass string `json:"-"`
 	SMTPFrom string `json:"-"`
 
+	NNTPBind string `json:"-"`
+
+	XMPPJID      string `json:"-"`
+	XMPPPassword string `json:"-"`
+	XMPPServer   string `json:"-"`
+
+	PluginsDir string `json:"-"`
+
 	MaxCacheFetchers int
+	MaxCacheMemory   int64
 	MaxFetchLimit    int64
+	TwtHashLength    int
+
+	MaxFetchRedirects int
+
+	CacheSnapshotInterval time.Duration
+
+	GraylistMinAge  time.Duration
+	GraylistMinTwts int
+
+	TaskMaxRetries   int
+	TaskRetryBackoff time.Duration
+	TaskConcurrency  string
 
 	APISessionTime time.Duration `json:"-"`
 	APISigningKey  string        `json:"-"`
@@ -166,6 +236,17 @@ type Config struct {
 	blockedFeeds []*regexp.Regexp
 	BlockedFeeds []string `json:"-"`
 
+	allowedFeeds []*regexp.Regexp
+	AllowedFeeds []string `json:"-"`
+
+	fetchAllowedNetworks []*net.IPNet
+	FetchAllowedNetworks []string `json:"-"`
+
+	listeners []Listener
+
+	// overrides are re-applied after merging the pod settings
+	overrides []Option
+
 	Features *FeatureFlags
 
 	// Pod Level Settings (overridable by Users)
@@ -175,6 +256,7 @@ type Config struct {
 	DisplayImagesPreference string
 	DisplayMedia            bool
 	OriginalMedia           bool
+	DiscoverRanking         string
 
 	VisibilityCompact  bool
 	VisibilityReadmore bool
@@ -216,6 +298,17 @@ func (c *Config) Settings() *Settings {
 	return settings
 }
 
+// CORSAllowedOrigin returns true if browser-based clients on the given origin
+// may use the API and media endpoints as per the configuration
+func (c *Config) CORSAllowedOrigin(origin string) bool {
+	for _, allowed := range c.CORSOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
 // PermittedImage returns true if the domain name of an image's url provided
 // is a whiltelisted domain as per the configuration
 func (c *Config) PermittedImage(domain string) (bool, bool) {
@@ -251,6 +344,24 @@ func (c *Config) BlockedFeed(uri string) bool {
 	return false
 }
 
+// AllowedFeed returns true if the feed uri may be followed and fetched. If
+// the pod is in allowlist federation mode (any allowed feeds are configured)
+// only feeds matching the allowed feeds may be, otherwise any feed may be.
+// The pod itself is always allowed.
+func (c *Config) AllowedFeed(uri string) bool {
+	if len(c.allowedFeeds) == 0 || strings.HasPrefix(uri, c.BaseURL) {
+		return true
+	}
+
+	// Check against list of allowed feeds (regexes)
+	for _, re := range c.allowedFeeds {
+		if re.MatchString(uri) {
+			return true
+		}
+	}
+	return false
+}
+
 // IsShadowed returns true if a feed has been Shadowed Banned by the Pod Owner/Operator (poderator)
 // This is currently functionally equivilent to Blocklisting a feed and uses the same configuration
 func (c *Config) IsShadowed(uri string) bool {
@@ -283,6 +394,18 @@ func (c *Config) Validate() error {
 		return fmt.Errorf("error applying blocked feeds: %w", err)
 	}
 
+	if err := WithAllowedFeeds(c.AllowedFeeds)(c); err != nil {
+		return fmt.Errorf("error applying allowed feeds: %w", err)
+	}
+
+	if err := WithUsernamePattern(c.UsernamePattern)(c); err != nil {
+		return fmt.Errorf("error applying username pattern: %w", err)
+	}
+
+	if err := WithTwtHashLength(c.TwtHashLength)(c); err != nil {
+		return fmt.Errorf("error applying twt hash length: %w", err)
+	}
+
 	// Automatically correct missing Scheme in Pod Base URL
 	if c.baseURL.Scheme == "" {
 		log.Warnf("pod base url (-u/--base-url) %s is missing the scheme", c.BaseURL)
@@ -339,7 +462,8 @@ func (c *Config) Validate() error {
 }
 
 func (c *Config) TemplatesFS() fs.FS {
-	if c.Theme == "" {
+	theme := c.ThemePath()
+	if theme == "" {
 		if c.Debug {
 			return os.DirFS("./internal/theme/templates")
 		}
@@ -350,7 +474,51 @@ func (c *Config) TemplatesFS() fs.FS {
 		return templatesFS
 	}
 
-	return os.DirFS(filepath.Join(c.Theme, "templates"))
+	return os.DirFS(filepath.Join(theme, "templates"))
+}
+
+// StaticFS returns the static assets of the configured theme (or the
+// builtin theme if none is configured)
+func (c *Config) StaticFS() fs.FS {
+	theme := c.ThemePath()
+	if theme == "" {
+		if c.Debug {
+			return os.DirFS("./internal/theme/static")
+		}
+		staticFS, err := fs.Sub(builtinThemeFS, "theme/static")
+		if err != nil {
+			log.WithError(err).Fatalf("error loading builtin theme static assets")
+		}
+		return staticFS
+	}
+
+	return os.DirFS(filepath.Join(theme, "static"))
+}
+
+// InstalledThemes returns the names of the stylesheets users can choose from
+// found in the configured theme's static/css/themes directory
+func (c *Config) InstalledThemes() []string {
+	fns, err := fs.Glob(c.StaticFS(), "css/themes/*.css")
+	if err != nil {
+		log.WithError(err).Warn("error listing installed themes")
+		return nil
+	}
+
+	var themes []string
+	for _, fn := range fns {
+		themes = append(themes, strings.TrimSuffix(path.Base(fn), ".css"))
+	}
+	return themes
+}
+
+// IsInstalledTheme returns true if name is one of the installed themes
+func (c *Config) IsInstalledTheme(name string) bool {
+	for _, theme := range c.InstalledThemes() {
+		if theme == name {
+			return true
+		}
+	}
+	return false
 }
 
 // RequestTimeout returns the configured timeout for outgoing HTTP requests. If
@@ -362,6 +530,90 @@ func (c *Config) RequestTimeout() time.Duration {
 	return c.requestTimeout
 }
 
+// LoadConfig returns the effective configuration of the pod: the defaults,
+// the given options, the pod settings (settings.yaml) and finally any options
+// that override the pod settings (See: WithOverrides)
+func LoadConfig(options ...Option) (*Config, error) {
+	config := NewConfig()
+
+	for _, opt := range options {
+		if err := opt(config); err != nil {
+			return nil, err
+		}
+	}
+
+	settingsFn := filepath.Join(config.Data, "settings.yaml")
+	if FileExists(settingsFn) {
+		if settings, err := LoadSettings(settingsFn); err != nil {
+			log.Warnf("error loading pod settings from %s: %s", settingsFn, err)
+		} else {
+			if err := merger.MergeOverwrite(config, settings); err != nil {
+				return nil, fmt.Errorf("error merging pod settings: %w", err)
+			}
+		}
+	}
+
+	if err := config.applyOverrides(); err != nil {
+		return nil, err
+	}
+
+	config.blockedFeeds = nil
+	config.allowedFeeds = nil
+	config.permittedImages = nil
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("error validating config: %w", err)
+	}
+
+	return config, nil
+}
+
+// applyOverrides re-applies the options overriding the pod settings
+func (c *Config) applyOverrides() error {
+	for _, opt := range c.overrides {
+		if err := opt(c); err != nil {
+			return fmt.Errorf("error applying config overrides: %w", err)
+		}
+	}
+	return nil
+}
+
+// redactedConfigFields are the secrets redacted when dumping the config
+var redactedConfigFields = map[string]bool{
+	"APISigningKey":   true,
+	"CookieSecret":    true,
+	"MagicLinkSecret": true,
+	"SMTPPass":        true,
+	"XMPPPassword":    true,
+}
+
+// Dump returns the configuration as YAML with secrets redacted
+func (c *Config) Dump() ([]byte, error) {
+	var items yaml.MapSlice
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		var value interface{} = v.Field(i).Interface()
+		switch {
+		case redactedConfigFields[field.Name]:
+			if value != "" {
+				value = "<redacted>"
+			}
+		case field.Type == reflect.TypeOf(time.Duration(0)):
+			value = value.(time.Duration).String()
+		}
+
+		items = append(items, yaml.MapItem{Key: field.Name, Value: value})
+	}
+
+	return yaml.Marshal(items)
+}
+
 // LoadSettings loads pod settings from the given path
 func LoadSettings(path string) (*Settings, error) {
 	var settings Settings
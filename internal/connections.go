@@ -0,0 +1,160 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultSilentDays is the number of days without twts after which a
+	// followed feed is considered silent
+	defaultSilentDays = 30
+
+	// maxSilentDays ...
+	maxSilentDays = 3650
+)
+
+// Connection is a feed a user follows or is followed by
+type Connection struct {
+	Nick      string    `json:"nick"`
+	URI       string    `json:"uri"`
+	LastTwtAt time.Time `json:"last_twt_at,omitempty"`
+
+	// LastSeenAt is when a follower last fetched the user's feed
+	LastSeenAt time.Time `json:"last_seen_at,omitempty"`
+}
+
+// Connections is an analysis of a user's follower/following graph to help
+// them groom their follow list
+type Connections struct {
+	// Mutuals are feeds the user follows and that follow them back
+	Mutuals []Connection `json:"mutuals"`
+
+	// NotFollowedBack are followers the user does not follow back
+	NotFollowedBack []Connection `json:"not_followed_back"`
+
+	// Silent are feeds the user follows without any twts in SilentDays
+	Silent []Connection `json:"silent"`
+
+	SilentDays int `json:"silent_days"`
+}
+
+// ParseSilentDays parses the number of days a feed must be without twts to
+// be considered silent
+func ParseSilentDays(s string) int {
+	days, err := strconv.Atoi(s)
+	if err != nil || days <= 0 {
+		return defaultSilentDays
+	}
+	if days > maxSilentDays {
+		return maxSilentDays
+	}
+	return days
+}
+
+func sortConnections(cs []Connection) {
+	sort.Slice(cs, func(i, j int) bool {
+		return cs[i].Nick < cs[j].Nick
+	})
+}
+
+// GetConnections computes the connections of a user from the feeds they
+// follow and the followers and twts recorded in the cache
+func GetConnections(conf *Config, cache *Cache, user *User, days int) *Connections {
+	connections := &Connections{
+		Mutuals:         []Connection{},
+		NotFollowedBack: []Connection{},
+		Silent:          []Connection{},
+		SilentDays:      days,
+	}
+
+	followers := cache.GetFollowers(user.Profile(conf.BaseURL, user))
+	followedBy := make(map[string]bool, len(followers))
+	for _, follower := range followers {
+		uri := NormalizeURL(follower.URI)
+		followedBy[uri] = true
+
+		if !user.Follows(uri) && !user.Is(uri) {
+			connections.NotFollowedBack = append(connections.NotFollowedBack, Connection{
+				Nick:       follower.Nick,
+				URI:        uri,
+				LastSeenAt: follower.LastSeenAt,
+			})
+		}
+	}
+
+	threshold := time.Now().AddDate(0, 0, -days)
+
+	for nick, uri := range user.Following {
+		c := Connection{Nick: nick, URI: uri}
+		for _, twt := range cache.GetByURL(uri) {
+			if twt.Created().After(c.LastTwtAt) {
+				c.LastTwtAt = twt.Created()
+			}
+		}
+
+		if followedBy[NormalizeURL(uri)] {
+			connections.Mutuals = append(connections.Mutuals, c)
+		}
+
+		// Feeds without twts in the cache have not twted within the cache's
+		// TTL at least
+		if c.LastTwtAt.Before(threshold) && !user.Is(uri) {
+			connections.Silent = append(connections.Silent, c)
+		}
+	}
+
+	sortConnections(connections.Mutuals)
+	sortConnections(connections.NotFollowedBack)
+	sort.Slice(connections.Silent, func(i, j int) bool {
+		return connections.Silent[i].LastTwtAt.Before(connections.Silent[j].LastTwtAt)
+	})
+
+	return connections
+}
+
+// ConnectionsHandler shows the user's mutuals, followers they don't follow
+// back and followed feeds that have gone silent
+func (s *Server) ConnectionsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		ctx.Title = s.tr(ctx, "ConnectionsTitle")
+		ctx.Connections = GetConnections(s.config(), s.cache, user, ParseSilentDays(r.URL.Query().Get("days")))
+		s.render("connections", w, ctx)
+	}
+}
+
+// ConnectionsEndpoint ...
+func (a *API) ConnectionsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		connections := GetConnections(a.config(), a.cache, user, ParseSilentDays(r.URL.Query().Get("days")))
+
+		data, err := json.Marshal(connections)
+		if err != nil {
+			log.WithError(err).Error("error serializing connections")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
@@ -11,7 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/robfig/cron"
 	log "github.com/sirupsen/logrus"
 	"github.com/vcraescu/go-paginator"
 
@@ -44,13 +43,35 @@ type Meta struct {
 	Author      string
 	URL         string
 	Keywords    string
+
+	// NoIndex discourages search engines from indexing the page
+	NoIndex bool
 }
 
 type Context struct {
 	Debug bool
 
-	Logo             template.HTML
-	CSS              template.CSS
+	Logo     template.HTML
+	Branding Branding
+	CSS      template.CSS
+
+	InstalledThemes []string
+	Stylesheet      string
+	UserCSS         template.CSS
+
+	AvailableThemes []*ThemeInfo
+	ActiveTheme     string
+
+	// Log levels of subsystems (Poderator)
+	LogSubsystems []string
+	LogLevels     map[string]string
+	LogLevelNames []string
+
+	// Memory usage of the feed cache and runtime (Poderator)
+	CacheMemoryUsage   string
+	CacheMemoryBudget  string
+	RuntimeMemoryUsage string
+
 	BaseURL          string
 	InstanceName     string
 	SoftwareVersion  SoftwareConfig
@@ -61,24 +82,37 @@ type Context struct {
 	MediaResolution  int
 	RegisterDisabled bool
 	OpenProfiles     bool
+	PublicAPI        bool
 	DisableMedia     bool
+	XMPPEnabled      bool
 	DisableFfmpeg    bool
 	PermittedImages  []string
 	BlockedFeeds     []string
+	AllowedFeeds     []string
 	EnabledFeatures  []string
 
-	AlertFloat   bool
-	AlertGuest   bool
-	AlertMessage string
-	AlertType    string
+	// Days deleted accounts are kept before they are purged
+	DeletionGraceDays int
+
+	AlertFloat bool
+
+	// Announcements are the active announcements shown to the user
+	Announcements []*Announcement
+
+	// AllAnnouncements are all of the Pod's announcements (See:
+	// ManageAnnouncementsHandler)
+	AllAnnouncements []*Announcement
 
 	Timezones []*timezones.Zoneinfo
 
 	Reply         string
 	Username      string
+	Accounts      []string
+	AddAccount    bool
 	User          *User
 	LastTwt       types.Twt
 	Profile       types.Profile
+	PrevArchive   *FeedArchive
 	Authenticated bool
 	IsAdmin       bool
 
@@ -88,6 +122,9 @@ type Context struct {
 	DisplayImagesPreference string
 	DisplayMedia            bool
 	OriginalMedia           bool
+	DiscoverRanking         string
+	DiscoverRankings        []string
+	DetectedLanguages       []DetectedLanguage
 
 	VisibilityCompact  bool
 	VisibilityReadmore bool
@@ -118,11 +155,56 @@ type Context struct {
 	Twts  types.Twts
 	Root  types.Twt
 
+	// MissingRoot is true if the root twt of a conversation could not be
+	// found, most likely because it was edited or deleted
+	MissingRoot bool
+
+	TwtHistory *TwtHistory
+
+	FollowRequests []FollowRequest
+	FeedHealth     []FeedHealth
+	Connections    *Connections
+
+	// WebMentions received from other sites (approved ones on permalinks)
+	WebMentions []ReceivedWebMention
+
+	// Bookmark folders and tags of the user whose bookmarks are viewed and
+	// the folder and tag they are filtered by
+	BookmarkFolders  []string
+	BookmarkTags     []string
+	BookmarkFolder   string
+	BookmarkTag      string
+	IsBookmarksOwner bool
+
+	ConversationHash    string
+	ConversationMuted   bool
+	ConversationWatched bool
+
 	Pager *paginator.Paginator
 
-	LocalFeeds  []*Feed
-	UserFeeds   []*Feed
-	FeedSources FeedSourceMap
+	LocalFeeds []*Feed
+	UserFeeds  []*Feed
+
+	// Feed directory, the Pod's curated feeds and the feeds of the feed
+	// sources by category and the health of the feed sources
+	CuratedFeeds      []FeedCategory
+	FeedCategories    []FeedCategory
+	FeedSourcesHealth map[string]FeedSourceHealth
+
+	// Automated is true if the feed served is automated (a bot)
+	Automated bool
+
+	// Onboarding wizard step and the feeds suggested to new users
+	OnboardingStep  string
+	OnboardingSteps []string
+	FeedSuggestions []FeedSuggestion
+
+	// Preview of a twt too long to post split into a thread and the values
+	// of the form to post it as a thread
+	Thread           Thread
+	ThreadText       string
+	ThreadPostAs     string
+	ThreadVisibility string
 
 	// Time
 	TimelineUpdatedAt time.Time
@@ -130,16 +212,67 @@ type Context struct {
 	LastMentionedAt   time.Time
 
 	// Discovered Pods peering with us
-	Peers Peers
+	Peers        Peers
+	ManagedPeers []*ManagedPeer
+	Graylist     []GraylistEntry
 
-	// Background Jobs
-	Jobs []*cron.Entry
+	// Account states and admin actions
+	InactiveUsers []*User
+	AuditEntries  []AuditEntry
+
+	// Username policy
+	ReservedUsernames []string
+	UsernameMinLength int
+	UsernameMaxLength int
+	UsernamePattern   string
+	UsernameProfanity []string
+
+	// API usage by endpoint and client
+	APIUsage []APIUsageStat
+
+	// Background Jobs and media tasks that failed all their attempts
+	Jobs      []JobStatus
+	DeadTasks []*TaskRecord
 
 	// Search
 	SearchQuery string
 
+	// Tag is the hashtag of a tag page
+	Tag string
+
+	// ProfileTab is the selected tab of a profile ("" for twts or "media")
+	ProfileTab string
+
+	// Summary is the "catch up" summary of the user's timeline
+	Summary *Summary
+
+	// ReadPosition is the hash of the last twt read by the user in the
+	// current view, newer twts are marked as unread
+	ReadPosition string
+
 	// Tools
-	Bookmarklet string
+	Bookmarklet        string
+	PostByEmailAddress string
+	PrivateFeedURLs    *PrivateFeedURLs
+	SigningPublicKey   string
+
+	// ProfileDetails are the structured fields of the user's profile viewed
+	ProfileDetails *ProfileDetails
+
+	// FeedStats are the statistics of the feed whose profile is viewed
+	FeedStats *FeedStats
+
+	// Custom Emoji
+	CustomEmoji []*Emoji
+
+	// Custom Pages (linked in the footer) and the page edited
+	CustomPages []*CustomPage
+	EditPage    *CustomPage
+
+	// Bot Tokens
+	BotToken    string
+	BotPostURL  string
+	HasBotToken bool
 
 	// Report abuse
 	ReportNick string
@@ -157,17 +290,22 @@ type Context struct {
 	// Profile post box user handle
 	PostText string
 
+	// Prefilled nick and url of a remote follow
+	FollowNick string
+	FollowURL  string
+
 	// Prompt text
 	PromptTitle    string
 	PromptMessage  string
 	PromptCallback string
+	PromptParams   map[string]string
 	PromptApprove  string
 	PromptCancel   string
 	PromptTarget   string
 }
 
 func NewContext(s *Server, req *http.Request) *Context {
-	conf := s.config
+	conf := s.config()
 	db := s.db
 
 	// build logo
@@ -188,6 +326,7 @@ func NewContext(s *Server, req *http.Request) *Context {
 		Debug: conf.Debug,
 
 		Logo:             logo,
+		Branding:         conf.GetBranding(),
 		CSS:              css,
 		BaseURL:          conf.BaseURL,
 		InstanceName:     conf.Name,
@@ -199,17 +338,21 @@ func NewContext(s *Server, req *http.Request) *Context {
 		MediaResolution:  conf.MediaResolution,
 		RegisterDisabled: !conf.OpenRegistrations,
 		OpenProfiles:     conf.OpenProfiles,
+		PublicAPI:        conf.PublicAPI,
 		DisableMedia:     conf.DisableMedia,
+		XMPPEnabled:      conf.XMPPJID != "",
+		CustomEmoji:      emojis.List(),
+		CustomPages:      customPages.List(),
 		DisableFfmpeg:    conf.DisableFfmpeg,
 		LastTwt:          types.NilTwt,
 		PermittedImages:  conf.PermittedImages,
 		BlockedFeeds:     conf.BlockedFeeds,
+		AllowedFeeds:     conf.AllowedFeeds,
 		EnabledFeatures:  conf.Features.AsStrings(),
 
-		AlertFloat:   conf.AlertFloat,
-		AlertGuest:   conf.AlertGuest,
-		AlertMessage: conf.AlertMessage,
-		AlertType:    conf.AlertType,
+		DeletionGraceDays: int(conf.DeletionGracePeriod.Hours() / 24),
+
+		AlertFloat: conf.AlertFloat,
 
 		DisplayDatesInTimezone:  conf.DisplayDatesInTimezone,
 		DisplayTimePreference:   conf.DisplayTimePreference,
@@ -217,8 +360,11 @@ func NewContext(s *Server, req *http.Request) *Context {
 		DisplayImagesPreference: conf.DisplayImagesPreference,
 		DisplayMedia:            conf.DisplayMedia,
 		OriginalMedia:           conf.OriginalMedia,
+		DiscoverRanking:         conf.DiscoverRanking,
+		DiscoverRankings:        DiscoverRankings(),
+		DetectedLanguages:       DetectedLanguages(),
 
-    VisibilityCompact:  conf.VisibilityCompact,
+		VisibilityCompact:  conf.VisibilityCompact,
 		VisibilityReadmore: conf.VisibilityReadmore,
 		LinkVerification:   conf.LinkVerification,
 		StripTrackingParam: conf.StripTrackingParam,
@@ -272,10 +418,20 @@ func NewContext(s *Server, req *http.Request) *Context {
 		if username, ok := sess.(*session.Session).Get("username"); ok {
 			ctx.Authenticated = true
 			ctx.Username = username
+			ctx.Accounts = SessionAccounts(sess.(*session.Session))
 			user, err := db.GetUser(ctx.Username)
 			if err != nil {
 				// TODO: What's the side effect of this happenning?
 				log.WithError(err).Warnf("error loading user object for %s", ctx.Username)
+			} else if !user.IsActive() {
+				// Accounts suspended or disabled by the Pod Owner/Operator
+				// are logged out
+				if err := RemoveSessionAccount(sess.(*session.Session), username); err != nil {
+					log.WithError(err).Warnf("error removing inactive account %s from session", username)
+				}
+				ctx.Authenticated = false
+				ctx.Username = ""
+				ctx.Accounts = nil
 			} else {
 				ctx.Twter = types.Twter{
 					Nick: user.Username,
@@ -291,7 +447,7 @@ func NewContext(s *Server, req *http.Request) *Context {
 				user.Following[user.Username] = user.URL
 
 				// TODO: Use event sourcing for this?
-				user.LastSeenAt = time.Now().Round(24 * time.Hour)
+				user.Seen()
 				if err := db.SetUser(user.Username, user); err != nil {
 					log.WithError(err).Warnf("error updating user.LastSeenAt for %s", user.Username)
 				}
@@ -310,12 +466,23 @@ func NewContext(s *Server, req *http.Request) *Context {
 		// Default to the configured theme
 		ctx.Theme = conf.Theme
 	}
+	// Set the user's stylesheet and custom css
+	ctx.InstalledThemes = conf.InstalledThemes()
+	if ctx.User.Stylesheet != "" && conf.IsInstalledTheme(ctx.User.Stylesheet) {
+		ctx.Stylesheet = ctx.User.Stylesheet
+	}
+	if ctx.User.CustomCSS != "" {
+		ctx.UserCSS = template.CSS(SanitizeCSS(conf.BaseURL, ctx.User.CustomCSS))
+	}
+
 	// Set user language
 	lang := strings.ToLower(ctx.User.Lang)
 	if lang != "" && lang != "auto" {
 		ctx.Lang = lang
 	}
 
+	ctx.Announcements = announcements.Active(ctx.User, time.Now())
+
 	return ctx
 }
 
@@ -23,7 +23,7 @@ import (
 
 // ConversationHandler ...
 func (s *Server) ConversationHandler() httprouter.Handle {
-	isLocal := IsLocalURLFactory(s.config)
+	isLocal := IsLocalURLFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -34,7 +34,7 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		if len(hash) < types.TwtHashLength {
+		if !IsValidTwtHash(hash) {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
@@ -59,13 +59,49 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			}
 		}
 
+		subject := fmt.Sprintf("subject:(#%s)", hash)
+
+		// The root of the conversation is missing, try to fetch it on demand
+		// from the feeds of those replying or from peering pods.
+		var missingRoot bool
 		if twt.IsZero() {
+			replies := s.cache.GetByUserView(ctx.User, subject, false)
+			if len(replies) == 0 {
+				ctx.Error = true
+				ctx.Message = "No matching twt found!"
+				s.render("404", w, ctx)
+				return
+			}
+
+			if root, found := s.cache.FetchMissingTwt(s.archive, hash, replies); found {
+				twt = root
+				_, inCache = s.cache.Lookup(hash)
+			} else {
+				// The root twt was most likely edited or deleted by its
+				// author, the conversation is shown as a fork of it.
+				missingRoot = true
+			}
+		}
+		ctx.Root = twt
+		ctx.MissingRoot = missingRoot
+
+		twts := s.cache.GetByUserView(ctx.User, subject, false)[:]
+		if !inCache && !missingRoot {
+			twts = append(twts, twt)
+		}
+		sort.Sort(sort.Reverse(twts))
+
+		if len(twts) == 0 {
 			ctx.Error = true
-			ctx.Message = "No matching twt found!"
+			ctx.Message = "No matching twts found due to muted feeds"
 			s.render("404", w, ctx)
 			return
 		}
-		ctx.Root = twt
+
+		// Describe the conversation by its oldest twt if its root is missing
+		if missingRoot {
+			twt = twts[0]
+		}
 
 		var (
 			who   string
@@ -74,15 +110,15 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 
 		twter := twt.Twter()
 		if isLocal(twter.URI) {
-			who = fmt.Sprintf("%s@%s", twter.Nick, s.config.LocalURL().Hostname())
-			image = URLForAvatar(s.config.BaseURL, twter.Nick, "")
+			who = fmt.Sprintf("%s@%s", twter.Nick, s.config().LocalURL().Hostname())
+			image = URLForAvatar(s.config().BaseURL, twter.Nick, "")
 		} else {
 			who = fmt.Sprintf("@<%s %s>", twter.Nick, twter.URI)
-			image = URLForExternalAvatar(s.config, twter.URI)
+			image = URLForExternalAvatar(s.config(), twter.URI)
 		}
 
 		when := twt.Created().Format(time.RFC3339)
-		what := twt.FormatText(types.TextFmt, s.config)
+		what := twt.FormatText(types.TextFmt, s.config())
 
 		var ks []string
 		if ks, err = keywords.Extract(what); err != nil {
@@ -96,20 +132,7 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 		ks = append(ks, tags.Tags()...)
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
-		w.Header().Set("Link", fmt.Sprintf(`<%s/webmention>; rel="webmention"`, s.config.BaseURL))
-
-		twts := s.cache.GetByUserView(ctx.User, fmt.Sprintf("subject:(#%s)", hash), false)[:]
-		if !inCache {
-			twts = append(twts, twt)
-		}
-		sort.Sort(sort.Reverse(twts))
-
-		if len(twts) == 0 {
-			ctx.Error = true
-			ctx.Message = "No matching twts found due to muted feeds"
-			s.render("404", w, ctx)
-			return
-		}
+		w.Header().Set("Link", fmt.Sprintf(`<%s/webmention>; rel="webmention"`, s.config().BaseURL))
 
 		if accept.PreferredContentTypeLike(r.Header, "application/json") == "application/json" {
 			data, err := json.Marshal(twts)
@@ -128,7 +151,7 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config().TwtsPerPage)
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
@@ -147,16 +170,16 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 
 		ctx.Title = title
 		ctx.Meta = Meta{
-			Title:       fmt.Sprintf("%s #%s", s.tr(ctx, "ConversationTitle"), twt.Hash()),
+			Title:       fmt.Sprintf("%s #%s", s.tr(ctx, "ConversationTitle"), hash),
 			Description: what,
 			UpdatedAt:   when,
 			Author:      who,
 			Image:       image,
-			URL:         URLForTwt(s.config.BaseURL, hash),
+			URL:         URLForTwt(s.config().BaseURL, hash),
 			Keywords:    strings.Join(ks, ", "),
 		}
 
-		if strings.HasPrefix(twt.Twter().URI, s.config.BaseURL) {
+		if strings.HasPrefix(twt.Twter().URI, s.config().BaseURL) {
 			ctx.Alternatives = append(ctx.Alternatives, Alternatives{
 				Alternative{
 					Type:  "text/plain",
@@ -171,8 +194,14 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			}...)
 		}
 
+		ctx.Alternatives = append(ctx.Alternatives, Alternative{
+			Type:  "application/atom+xml",
+			Title: fmt.Sprintf("Conversation #%s Atom Feed", hash),
+			URL:   fmt.Sprintf("%s/atom.xml", URLForConv(s.config().BaseURL, hash)),
+		})
+
 		if ctx.Authenticated {
-			lastTwt, _, err := GetLastTwt(s.config, ctx.User)
+			lastTwt, _, err := GetLastTwt(s.config(), ctx.User)
 			if err != nil {
 				log.WithError(err).Error("error getting user last twt")
 				ctx.Error = true
@@ -183,9 +212,95 @@ func (s *Server) ConversationHandler() httprouter.Handle {
 			ctx.LastTwt = lastTwt
 		}
 
-		ctx.Reply = fmt.Sprintf("#%s", twt.Hash())
+		ctx.Reply = fmt.Sprintf("#%s", hash)
+		ctx.ConversationHash = hash
+		if ctx.Authenticated {
+			ctx.ConversationMuted = ctx.User.HasMuted(hash)
+			ctx.ConversationWatched = ctx.User.IsWatching(hash)
+		}
 		ctx.Twts = pagedTwts
 		ctx.Pager = &pager
 		s.render("conversation", w, ctx)
 	}
 }
+
+// MuteConversationHandler mutes (or unmutes) a conversation by its subject
+// hash so that its replies no longer appear in the user's timeline and
+// mentions
+func (s *Server) MuteConversationHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		hash := p.ByName("hash")
+		if hash == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		key := fmt.Sprintf("#%s", hash)
+		if r.FormValue("action") == "unmute" {
+			user.Unmute(key)
+		} else {
+			user.Mute(key, hash)
+			user.Unwatch(hash)
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating muted conversations for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		s.cache.DeleteUserViews(user)
+
+		http.Redirect(w, r, URLForConv(s.config().BaseURL, hash), http.StatusFound)
+	}
+}
+
+// WatchConversationHandler watches (or unwatches) a conversation by its
+// subject hash so that new replies appear in the user's mentions even if
+// they do not mention the user
+func (s *Server) WatchConversationHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		hash := p.ByName("hash")
+		if hash == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if r.FormValue("action") == "unwatch" {
+			user.Unwatch(hash)
+		} else {
+			user.Watch(hash)
+			user.Unmute(fmt.Sprintf("#%s", hash))
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating watched conversations for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		s.cache.DeleteUserViews(user)
+
+		http.Redirect(w, r, URLForConv(s.config().BaseURL, hash), http.StatusFound)
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"strings"
+)
+
+// corsPathPrefixes are the paths browser-based clients on other origins may
+// use if their origin is allowed
+var corsPathPrefixes = []string{"/api/v1/", "/media/"}
+
+func isCORSPath(path string) bool {
+	for _, prefix := range corsPathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORSHandler adds Cross-Origin Resource Sharing headers to the responses of
+// the API and media endpoints for requests from allowed origins and answers
+// their preflight requests
+func CORSHandler(conf *Config, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" || !isCORSPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+
+		if !conf.CORSAllowedOrigin(origin) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+
+		// Preflight request
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(conf.CORSMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(conf.CORSHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", "86400")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
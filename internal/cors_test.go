@@ -0,0 +1,57 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCORSHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &Config{
+		CORSOrigins: []string{"https://app.example.com"},
+		CORSHeaders: DefaultCORSHeaders,
+		CORSMethods: DefaultCORSMethods,
+	}
+	handler := CORSHandler(conf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	t.Run("answers preflight requests from allowed origins", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodOptions, "/api/v1/timeline", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		r.Header.Set("Access-Control-Request-Method", "POST")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(http.StatusNoContent, w.Code)
+		assert.Equal("https://app.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+		assert.Equal("GET, POST", w.Header().Get("Access-Control-Allow-Methods"))
+		assert.Equal("Content-Type, Token", w.Header().Get("Access-Control-Allow-Headers"))
+	})
+
+	t.Run("ignores other origins", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/media/foo.png", nil)
+		r.Header.Set("Origin", "https://evil.example.com")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		assert.Equal(http.StatusOK, w.Code)
+		assert.Empty(w.Header().Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("ignores other paths", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/settings", nil)
+		r.Header.Set("Origin", "https://app.example.com")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		assert.Empty(w.Header().Get("Access-Control-Allow-Origin"))
+	})
+}
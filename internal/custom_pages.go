@@ -0,0 +1,225 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/james4k/fmatter"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrInvalidPageName is returned when a custom page's name is invalid
+	ErrInvalidPageName = errors.New("error: invalid page name")
+
+	// ErrReservedPageName is returned when a custom page's name is that of a
+	// builtin page or an existing route
+	ErrReservedPageName = errors.New("error: reserved page name")
+
+	validPageName = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+)
+
+// BuiltinPageNames are the names of the builtin pages (whose content can be
+// overridden in the data directory but which are not custom pages)
+var BuiltinPageNames = []string{"about", "abuse", "help", "privacy"}
+
+// IsBuiltinPage returns true if name is the name of a builtin page
+func IsBuiltinPage(name string) bool {
+	for _, builtin := range BuiltinPageNames {
+		if builtin == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidatePageName ...
+func ValidatePageName(name string) error {
+	if !validPageName.MatchString(name) {
+		return ErrInvalidPageName
+	}
+	if IsBuiltinPage(name) {
+		return ErrReservedPageName
+	}
+	return nil
+}
+
+// CustomPage is an additional markdown page created by the Pod Owner/Operator
+// and served at /<name>
+type CustomPage struct {
+	Name        string
+	Title       string
+	Description string
+	Content     string
+}
+
+// URL returns the path the page is served at
+func (p *CustomPage) URL() string {
+	return fmt.Sprintf("/%s", p.Name)
+}
+
+// CustomPages holds the custom pages of a pod stored as markdown files (with
+// front matter) named after the page in the data directory's pages. A nil
+// *CustomPages has no pages.
+type CustomPages struct {
+	sync.RWMutex
+
+	conf  *Config
+	pages map[string]*CustomPage
+}
+
+// NewCustomPages ...
+func NewCustomPages(conf *Config) *CustomPages {
+	return &CustomPages{
+		conf:  conf,
+		pages: make(map[string]*CustomPage),
+	}
+}
+
+func (cp *CustomPages) dir() string {
+	return filepath.Join(cp.conf.Data, pagesDir)
+}
+
+func (cp *CustomPages) filename(name string) string {
+	return filepath.Join(cp.dir(), fmt.Sprintf("%s.md", name))
+}
+
+// Load (re)loads all custom pages from the data directory
+func (cp *CustomPages) Load() error {
+	if err := os.MkdirAll(cp.dir(), 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(cp.dir())
+	if err != nil {
+		return err
+	}
+
+	pages := make(map[string]*CustomPage)
+
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".md")
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".md" || ValidatePageName(name) != nil {
+			continue
+		}
+
+		data, err := os.ReadFile(cp.filename(name))
+		if err != nil {
+			log.WithError(err).Warnf("error reading custom page %s", name)
+			continue
+		}
+
+		var frontmatter FrontMatter
+		content, err := fmatter.Read(data, &frontmatter)
+		if err != nil {
+			log.WithError(err).Warnf("error parsing front matter of custom page %s", name)
+			continue
+		}
+
+		title := frontmatter.Title
+		if title == "" {
+			title = strings.Title(name)
+		}
+
+		pages[name] = &CustomPage{
+			Name:        name,
+			Title:       title,
+			Description: frontmatter.Description,
+			Content:     strings.TrimSpace(string(content)),
+		}
+	}
+
+	cp.Lock()
+	cp.pages = pages
+	cp.Unlock()
+
+	return nil
+}
+
+// Save stores a new (or replaces an existing) custom page
+func (cp *CustomPages) Save(page *CustomPage) error {
+	if err := ValidatePageName(page.Name); err != nil {
+		return err
+	}
+
+	frontmatter, err := yaml.Marshal(FrontMatter{
+		Title:       strings.TrimSpace(page.Title),
+		Description: strings.TrimSpace(page.Description),
+	})
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("---\n")
+	buf.Write(frontmatter)
+	buf.WriteString("---\n\n")
+	buf.WriteString(strings.TrimSpace(strings.ReplaceAll(page.Content, "\r\n", "\n")))
+	buf.WriteString("\n")
+
+	if err := os.WriteFile(cp.filename(page.Name), buf.Bytes(), 0644); err != nil {
+		return err
+	}
+
+	return cp.Load()
+}
+
+// Delete removes a custom page
+func (cp *CustomPages) Delete(name string) error {
+	if err := ValidatePageName(name); err != nil {
+		return err
+	}
+
+	if err := os.Remove(cp.filename(name)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return cp.Load()
+}
+
+// Get returns the custom page with the given name
+func (cp *CustomPages) Get(name string) (*CustomPage, bool) {
+	if cp == nil {
+		return nil, false
+	}
+
+	cp.RLock()
+	defer cp.RUnlock()
+
+	page, ok := cp.pages[name]
+	return page, ok
+}
+
+// List returns all custom pages sorted by title
+func (cp *CustomPages) List() []*CustomPage {
+	if cp == nil {
+		return nil
+	}
+
+	cp.RLock()
+	defer cp.RUnlock()
+
+	pages := make([]*CustomPage, 0, len(cp.pages))
+	for _, page := range cp.pages {
+		pages = append(pages, page)
+	}
+	sort.Slice(pages, func(i, j int) bool {
+		if pages[i].Title == pages[j].Title {
+			return pages[i].Name < pages[j].Name
+		}
+		return pages[i].Title < pages[j].Title
+	})
+
+	return pages
+}
@@ -0,0 +1,56 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidatePageName(t *testing.T) {
+	assert.NoError(t, ValidatePageName("rules"))
+	assert.NoError(t, ValidatePageName("code-of-conduct"))
+	assert.Equal(t, ErrInvalidPageName, ValidatePageName(""))
+	assert.Equal(t, ErrInvalidPageName, ValidatePageName("Rules"))
+	assert.Equal(t, ErrInvalidPageName, ValidatePageName("../settings"))
+	assert.Equal(t, ErrInvalidPageName, ValidatePageName("-donate"))
+	assert.Equal(t, ErrReservedPageName, ValidatePageName("about"))
+}
+
+func TestCustomPages(t *testing.T) {
+	pages := NewCustomPages(&Config{Data: t.TempDir()})
+	require.NoError(t, pages.Load())
+
+	require.NoError(t, pages.Save(&CustomPage{
+		Name:        "rules",
+		Title:       "Pod Rules",
+		Description: "The rules of this pod",
+		Content:     "# Rules\r\n\r\nBe nice.\r\n",
+	}))
+	require.NoError(t, pages.Save(&CustomPage{Name: "donate", Title: "Donate"}))
+
+	// Builtin pages overridden in the data directory are not custom pages
+	require.Error(t, pages.Save(&CustomPage{Name: "about", Title: "About"}))
+
+	require.NoError(t, pages.Load())
+
+	page, ok := pages.Get("rules")
+	require.True(t, ok)
+	assert.Equal(t, "Pod Rules", page.Title)
+	assert.Equal(t, "The rules of this pod", page.Description)
+	assert.Equal(t, "# Rules\n\nBe nice.", page.Content)
+	assert.Equal(t, "/rules", page.URL())
+
+	list := pages.List()
+	require.Len(t, list, 2)
+	assert.Equal(t, "donate", list[0].Name)
+	assert.Equal(t, "rules", list[1].Name)
+
+	require.NoError(t, pages.Delete("rules"))
+	_, ok = pages.Get("rules")
+	assert.False(t, ok)
+	assert.Len(t, pages.List(), 1)
+}
@@ -0,0 +1,159 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"go.yarn.social/types"
+)
+
+const (
+	// DiscoverChronological ranks the Discover timeline newest first
+	DiscoverChronological = "chronological"
+
+	// DiscoverConversations ranks the twts of the most active conversations
+	// (many recent replies) first
+	DiscoverConversations = "conversations"
+
+	// DiscoverDiverse ranks the Discover timeline newest first but samples
+	// feeds so a single prolific feed cannot dominate any page
+	DiscoverDiverse = "diverse"
+
+	// discoverMaxPerFeed is the number of twts of a single feed allowed on a
+	// page of the diverse Discover timeline
+	discoverMaxPerFeed = 3
+)
+
+// DiscoverRanker ranks the (newest first) twts of the Discover timeline for
+// display given the page size, it must not modify twts
+type DiscoverRanker func(twts types.Twts, pageSize int) types.Twts
+
+// discoverRankers are the available rankings of the Discover timeline
+var discoverRankers = map[string]DiscoverRanker{
+	DiscoverChronological: func(twts types.Twts, _ int) types.Twts { return twts },
+	DiscoverConversations: rankDiscoverConversations,
+	DiscoverDiverse:       rankDiscoverDiverse,
+}
+
+// IsDiscoverRanking returns true if name is a known ranking of the Discover
+// timeline
+func IsDiscoverRanking(name string) bool {
+	_, ok := discoverRankers[name]
+	return ok
+}
+
+// DiscoverRankings returns the names of the available rankings of the
+// Discover timeline
+func DiscoverRankings() []string {
+	return []string{DiscoverChronological, DiscoverConversations, DiscoverDiverse}
+}
+
+// DiscoverRankingFor returns the ranking of the Discover timeline used for a
+// user (or anonymous visitors if nil), the user's own preference if any or
+// the pod's ranking
+func DiscoverRankingFor(conf *Config, user *User) string {
+	if user != nil && IsDiscoverRanking(user.DiscoverRanking) {
+		return user.DiscoverRanking
+	}
+	if IsDiscoverRanking(conf.DiscoverRanking) {
+		return conf.DiscoverRanking
+	}
+	return DiscoverChronological
+}
+
+// RankDiscover ranks the twts of the Discover timeline for a user (See:
+// DiscoverRankingFor)
+func RankDiscover(conf *Config, user *User, twts types.Twts) types.Twts {
+	return discoverRankers[DiscoverRankingFor(conf, user)](twts, conf.TwtsPerPage)
+}
+
+// rankDiscoverConversations groups twts by conversation and orders the
+// conversations by activity, the number of their twts decayed by the time
+// since their latest twt
+func rankDiscoverConversations(twts types.Twts, _ int) types.Twts {
+	type conversation struct {
+		twts   types.Twts
+		latest time.Time
+	}
+
+	var keys []string
+	convs := make(map[string]*conversation)
+
+	for _, twt := range twts {
+		key := ExtractHashFromSubject(twt.Subject().String())
+		if key == "" {
+			key = twt.Hash()
+		}
+
+		conv, ok := convs[key]
+		if !ok {
+			conv = &conversation{}
+			convs[key] = conv
+			keys = append(keys, key)
+		}
+		conv.twts = append(conv.twts, twt)
+		if twt.Created().After(conv.latest) {
+			conv.latest = twt.Created()
+		}
+	}
+
+	now := time.Now()
+	score := func(conv *conversation) float64 {
+		hours := now.Sub(conv.latest).Hours()
+		if hours < 0 {
+			hours = 0
+		}
+		return float64(len(conv.twts)) / math.Pow(hours+2, 1.5)
+	}
+
+	sort.SliceStable(keys, func(i, j int) bool {
+		return score(convs[keys[i]]) > score(convs[keys[j]])
+	})
+
+	ranked := make(types.Twts, 0, len(twts))
+	for _, key := range keys {
+		ranked = append(ranked, convs[key].twts...)
+	}
+	return ranked
+}
+
+// rankDiscoverDiverse fills pages newest first with at most
+// discoverMaxPerFeed twts of any feed, twts of feeds over the limit are moved
+// to the following pages. Once a page can no longer be filled the remaining
+// twts are kept in order.
+func rankDiscoverDiverse(twts types.Twts, pageSize int) types.Twts {
+	if pageSize <= 0 {
+		return twts
+	}
+
+	ranked := make(types.Twts, 0, len(twts))
+	pending := twts
+
+	for len(pending) > 0 {
+		var page, rest types.Twts
+
+		counts := make(map[string]int)
+		for _, twt := range pending {
+			uri := twt.Twter().URI
+			if len(page) < pageSize && counts[uri] < discoverMaxPerFeed {
+				page = append(page, twt)
+				counts[uri]++
+			} else {
+				rest = append(rest, twt)
+			}
+		}
+
+		ranked = append(ranked, page...)
+		if len(page) < pageSize {
+			ranked = append(ranked, rest...)
+			break
+		}
+		pending = rest
+	}
+
+	return ranked
+}
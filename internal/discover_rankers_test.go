@@ -0,0 +1,43 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.yarn.social/types"
+)
+
+func TestRankDiscoverDiverse(t *testing.T) {
+	prolific := types.NewTwter("prolific", "https://example.com/prolific.txt")
+	quiet := types.NewTwter("quiet", "https://example.com/quiet.txt")
+
+	now := time.Now()
+
+	// Ten twts of a prolific feed followed by two of a quiet feed (newest first)
+	var twts types.Twts
+	for i := 0; i < 10; i++ {
+		twts = append(twts, types.MakeTwt(prolific, now.Add(-time.Duration(i)*time.Minute), fmt.Sprintf("P%d", i)))
+	}
+	for i := 0; i < 2; i++ {
+		twts = append(twts, types.MakeTwt(quiet, now.Add(-time.Duration(10+i)*time.Minute), fmt.Sprintf("Q%d", i)))
+	}
+
+	ranked := rankDiscoverDiverse(twts, 5)
+	assert.Len(t, ranked, len(twts))
+
+	// The first page has at most discoverMaxPerFeed twts of the prolific feed
+	var n int
+	for _, twt := range ranked[:5] {
+		if twt.Twter().URI == prolific.URI {
+			n++
+		}
+	}
+	assert.Equal(t, discoverMaxPerFeed, n)
+	assert.Equal(t, twts[10].Hash(), ranked[3].Hash())
+	assert.Equal(t, twts[11].Hash(), ranked[4].Hash())
+}
@@ -4,36 +4,86 @@
 package internal
 
 import (
+	"context"
 	"errors"
+	"sort"
 	"time"
 
 	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
 )
 
 // Dispatcher maintains a pool for available workers
-// and a task queue that workers will process
+// and a task queue that workers will process.
+//
+// Persistent tasks (See: PersistentTask) are stored in the Store (if set)
+// until they complete so they survive restarts, failed attempts are retried
+// following the dispatcher's RetryPolicy and tasks that failed all their
+// attempts are kept as dead letters. The number of tasks of a kind run
+// concurrently can be limited.
+//
+// Queued tasks are run by priority (See: TaskPriority), first in first out
+// within a priority, and a quarter of the workers are reserved for tasks that
+// are not background tasks so users never wait behind bulk work.
 type Dispatcher struct {
 	sync.RWMutex
 	maxWorkers int
-	maxQueue   int
 	workers    []*Worker
 	workerPool chan chan Task
-	taskQueue  chan Task
+	queue      []Task
+	notify     chan struct{}
 	taskMap    map[string]Task
 	quit       chan bool
 	active     bool
+
+	conf    *Config
+	db      Store
+	policy  RetryPolicy
+	limits  map[string]int
+	running map[string]int
+
+	// background is the number of background tasks running
+	background int
 }
 
 // NewDispatcher creates a new dispatcher with the given
-// number of workers and buffers the task queue based on maxQueue.
-// It also initializes the channels for the worker pool and task queue
+// number of workers, the task queue is initially sized for maxQueue
+// tasks and grows as needed
 func NewDispatcher(maxWorkers int, maxQueue int) *Dispatcher {
 	return &Dispatcher{
 		maxWorkers: maxWorkers,
-		maxQueue:   maxQueue,
+		queue:      make([]Task, 0, maxQueue),
+		limits:     make(map[string]int),
+		running:    make(map[string]int),
 	}
 }
 
+// SetStore persists the persistent tasks in the store, tasks still queued
+// in the store are restored when the dispatcher is started
+func (d *Dispatcher) SetStore(conf *Config, db Store) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.conf = conf
+	d.db = db
+}
+
+// SetRetryPolicy sets the policy for retrying failed persistent tasks
+func (d *Dispatcher) SetRetryPolicy(policy RetryPolicy) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.policy = policy
+}
+
+// SetLimits limits the number of tasks of each kind run concurrently
+func (d *Dispatcher) SetLimits(limits map[string]int) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.limits = limits
+}
+
 // Start creates and starts workers, adding them to the worker pool.
 // Then, it starts a select loop to wait for tasks to be dispatched
 // to available workers
@@ -43,7 +93,7 @@ func (d *Dispatcher) Start() {
 
 	d.workers = []*Worker{}
 	d.workerPool = make(chan chan Task, d.maxWorkers)
-	d.taskQueue = make(chan Task, d.maxQueue)
+	d.notify = make(chan struct{}, 1)
 	d.taskMap = make(map[string]Task)
 	d.quit = make(chan bool)
 
@@ -55,6 +105,8 @@ func (d *Dispatcher) Start() {
 
 	d.active = true
 
+	d.restore()
+
 	go func() {
 		c := time.Tick(5 * time.Minute)
 		for range c {
@@ -68,19 +120,249 @@ func (d *Dispatcher) Start() {
 		}
 	}()
 
-	go func() {
+	go func(quit chan bool) {
 		for {
 			select {
-			case task := <-d.taskQueue:
-				go func(task Task) {
-					taskChannel := <-d.workerPool
-					taskChannel <- task
-				}(task)
-			case <-d.quit:
+			case taskChannel := <-d.workerPool:
+				task, ok := d.next(quit)
+				if !ok {
+					return
+				}
+				taskChannel <- &dispatchedTask{Task: task, d: d}
+			case <-quit:
 				return
 			}
 		}
-	}()
+	}(d.quit)
+}
+
+// restore queues the persisted tasks still queued in the store
+func (d *Dispatcher) restore() {
+	if d.db == nil {
+		return
+	}
+
+	records, err := d.db.GetAllTasks()
+	if err != nil {
+		log.WithError(err).Error("error loading persisted tasks")
+		return
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CreatedAt.Before(records[j].CreatedAt) })
+
+	for _, record := range records {
+		if record.State != TaskRecordQueued {
+			continue
+		}
+		task, err := record.Restore(d.conf)
+		if err != nil {
+			log.WithError(err).Warnf("error restoring task %s", record.ID)
+			continue
+		}
+		d.queue = append(d.queue, task)
+		d.taskMap[task.ID()] = task
+		log.Infof("restored %s task %s", record.Kind, record.ID)
+	}
+
+	d.signal()
+}
+
+// taskPriority returns the priority of a task (TaskPriorityNormal if the
+// task has none)
+func taskPriority(task Task) TaskPriority {
+	if pt, ok := task.(interface{ Priority() TaskPriority }); ok {
+		return pt.Priority()
+	}
+	return TaskPriorityNormal
+}
+
+// maxBackground returns the number of workers background tasks may use
+func (d *Dispatcher) maxBackground() int {
+	reserved := d.maxWorkers / 4
+	if reserved < 1 && d.maxWorkers > 1 {
+		reserved = 1
+	}
+	return d.maxWorkers - reserved
+}
+
+// signal wakes up the dispatch loop
+func (d *Dispatcher) signal() {
+	select {
+	case d.notify <- struct{}{}:
+	default:
+	}
+}
+
+// next waits for and dequeues the oldest task of the highest priority whose
+// kind is under its concurrency limit
+func (d *Dispatcher) next(quit chan bool) (Task, bool) {
+	for {
+		d.Lock()
+		best := -1
+		for i, task := range d.queue {
+			kind, priority := taskKind(task), taskPriority(task)
+			if limit, ok := d.limits[kind]; ok && d.running[kind] >= limit {
+				continue
+			}
+			if priority == TaskPriorityBackground && d.background >= d.maxBackground() {
+				continue
+			}
+			if best == -1 || priority > taskPriority(d.queue[best]) {
+				best = i
+			}
+		}
+		if best != -1 {
+			task := d.queue[best]
+			d.queue = append(d.queue[:best], d.queue[best+1:]...)
+			d.running[taskKind(task)]++
+			if taskPriority(task) == TaskPriorityBackground {
+				d.background++
+			}
+			d.Unlock()
+			return task, true
+		}
+		d.Unlock()
+
+		select {
+		case <-d.notify:
+		case <-quit:
+			return nil, false
+		}
+	}
+}
+
+// done records the outcome of a run of a task, removing completed persistent
+// tasks from the store and retrying (or keeping as dead letters) failed ones
+func (d *Dispatcher) done(task Task, err error) {
+	d.Lock()
+	defer d.Unlock()
+
+	d.running[taskKind(task)]--
+	if taskPriority(task) == TaskPriorityBackground {
+		d.background--
+	}
+	d.signal()
+
+	pt, ok := task.(PersistentTask)
+	if !ok || d.db == nil {
+		return
+	}
+
+	if err == nil {
+		if err := d.db.DelTask(task.ID()); err != nil {
+			log.WithError(err).Warnf("error deleting persisted task %s", task.ID())
+		}
+		return
+	}
+
+	record, e := d.db.GetTask(task.ID())
+	if e != nil {
+		record = NewTaskRecord(pt)
+	}
+	record.Attempts++
+	record.LastError = err.Error()
+	record.FailedAt = time.Now()
+
+	if record.Attempts > d.policy.MaxRetries {
+		record.State = TaskRecordDead
+		log.Warnf("task %s failed %d times, keeping it as a dead letter", task.ID(), record.Attempts)
+	} else {
+		d.retry(record, d.policy.Delay(record.Attempts))
+	}
+
+	if err := d.db.SetTask(record.ID, record); err != nil {
+		log.WithError(err).Warnf("error persisting task %s", task.ID())
+	}
+}
+
+// retry queues a new attempt of a persisted task after delay, the task's
+// state is pending in the meantime
+func (d *Dispatcher) retry(record *TaskRecord, delay time.Duration) {
+	task, err := record.Restore(d.conf)
+	if err != nil {
+		log.WithError(err).Warnf("error restoring task %s", record.ID)
+		return
+	}
+	record.State = TaskRecordQueued
+	d.taskMap[task.ID()] = task
+
+	log.Infof("retrying task %s in %s (attempt %d)", task.ID(), delay, record.Attempts+1)
+
+	time.AfterFunc(delay, func() {
+		d.Lock()
+		defer d.Unlock()
+
+		if !d.active {
+			return
+		}
+		d.queue = append(d.queue, task)
+		d.signal()
+	})
+}
+
+// DeadTasks returns the persisted tasks that failed all their attempts
+func (d *Dispatcher) DeadTasks() ([]*TaskRecord, error) {
+	d.RLock()
+	defer d.RUnlock()
+
+	if d.db == nil {
+		return nil, nil
+	}
+
+	records, err := d.db.GetAllTasks()
+	if err != nil {
+		return nil, err
+	}
+
+	var dead []*TaskRecord
+	for _, record := range records {
+		if record.State == TaskRecordDead {
+			dead = append(dead, record)
+		}
+	}
+	sort.Slice(dead, func(i, j int) bool { return dead[i].FailedAt.After(dead[j].FailedAt) })
+
+	return dead, nil
+}
+
+// RetryDeadTask queues a dead letter again with its attempts reset
+func (d *Dispatcher) RetryDeadTask(id string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	record, err := d.deadTask(id)
+	if err != nil {
+		return err
+	}
+
+	record.Attempts = 0
+	d.retry(record, 0)
+
+	return d.db.SetTask(record.ID, record)
+}
+
+// DiscardDeadTask deletes a dead letter
+func (d *Dispatcher) DiscardDeadTask(id string) error {
+	d.Lock()
+	defer d.Unlock()
+
+	if _, err := d.deadTask(id); err != nil {
+		return err
+	}
+
+	return d.db.DelTask(id)
+}
+
+func (d *Dispatcher) deadTask(id string) (*TaskRecord, error) {
+	if d.db == nil {
+		return nil, ErrTaskNotFound
+	}
+
+	record, err := d.db.GetTask(id)
+	if err != nil || record.State != TaskRecordDead {
+		return nil, ErrTaskNotFound
+	}
+
+	return record, nil
 }
 
 // Stop ends execution for all workers and closes all channels, then removes
@@ -100,7 +382,7 @@ func (d *Dispatcher) Stop() {
 	}
 
 	d.workers = []*Worker{}
-	d.quit <- true
+	close(d.quit)
 }
 
 // Lookup returns the matching `Task` given its id
@@ -112,7 +394,8 @@ func (d *Dispatcher) Lookup(id string) (Task, bool) {
 	return task, ok
 }
 
-// Dispatch pushes the given task into the task queue.
+// Dispatch pushes the given task into the task queue, persisting it first
+// if it is a PersistentTask and the dispatcher has a store.
 // The first available worker will perform the task
 func (d *Dispatcher) Dispatch(task Task) (string, error) {
 	d.Lock()
@@ -122,8 +405,16 @@ func (d *Dispatcher) Dispatch(task Task) (string, error) {
 		return "", errors.New("dispatcher is not active")
 	}
 
-	d.taskQueue <- task
+	if pt, ok := task.(PersistentTask); ok && d.db != nil {
+		if err := d.db.SetTask(task.ID(), NewTaskRecord(pt)); err != nil {
+			log.WithError(err).Warnf("error persisting task %s", task.ID())
+		}
+	}
+
+	d.queue = append(d.queue, task)
 	d.taskMap[task.ID()] = task
+	d.signal()
+
 	return task.ID(), nil
 }
 
@@ -132,3 +423,40 @@ func (d *Dispatcher) Dispatch(task Task) (string, error) {
 func (d *Dispatcher) DispatchFunc(f func() error) (string, error) {
 	return d.Dispatch(NewFuncTask(f))
 }
+
+// DispatchFuncWithContext is DispatchFunc for tasks dispatched by a request
+// handler, the task is tagged with the request's ID to correlate its logs
+// with the request's logs.
+func (d *Dispatcher) DispatchFuncWithContext(ctx context.Context, f func() error) (string, error) {
+	return d.DispatchFuncWithPriority(ctx, TaskPriorityNormal, f)
+}
+
+// DispatchFuncWithPriority is DispatchFuncWithContext for a task of the
+// given priority
+func (d *Dispatcher) DispatchFuncWithPriority(ctx context.Context, priority TaskPriority, f func() error) (string, error) {
+	task := NewFuncTask(f)
+	task.SetRequestID(RequestID(ctx))
+	task.SetPriority(priority)
+	return d.Dispatch(task)
+}
+
+// dispatchedTask is a task handed to a worker that reports the outcome of
+// its run to the dispatcher
+type dispatchedTask struct {
+	Task
+
+	d *Dispatcher
+}
+
+func (t *dispatchedTask) Run() (err error) {
+	defer func() { t.d.done(t.Task, err) }()
+	return t.Task.Run()
+}
+
+// RequestID returns the ID of the request that dispatched the task (if any)
+func (t *dispatchedTask) RequestID() string {
+	if rt, ok := t.Task.(interface{ RequestID() string }); ok {
+		return rt.RequestID()
+	}
+	return ""
+}
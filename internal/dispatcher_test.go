@@ -4,6 +4,7 @@
 package internal
 
 import (
+	"context"
 	"sync"
 	"testing"
 	"time"
@@ -111,3 +112,35 @@ func TestDispatcher_Stop(t *testing.T) {
 	})
 	assert.NotNil(t, err)
 }
+
+func TestDispatcher_Priority(t *testing.T) {
+	d := NewDispatcher(1, 3)
+	d.Start()
+
+	// Occupy the only worker until all the prioritized tasks are queued
+	started := make(chan bool)
+	release := make(chan bool)
+	_, _ = d.DispatchFunc(func() error {
+		close(started)
+		<-release
+		return nil
+	})
+	<-started
+
+	ran := make(chan TaskPriority, 3)
+	for _, priority := range []TaskPriority{TaskPriorityBackground, TaskPriorityNormal, TaskPriorityInteractive} {
+		priority := priority
+		_, _ = d.DispatchFuncWithPriority(context.Background(), priority, func() error {
+			ran <- priority
+			return nil
+		})
+	}
+
+	close(release)
+
+	var order []TaskPriority
+	for i := 0; i < 3; i++ {
+		order = append(order, <-ran)
+	}
+	assert.Equal(t, []TaskPriority{TaskPriorityInteractive, TaskPriorityNormal, TaskPriorityBackground}, order)
+}
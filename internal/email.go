@@ -42,6 +42,18 @@ To reset your password, please visit the following link:
 
 Kind regards,
 
+{{ .Pod }} Support
+`))
+
+	cancelDeletionEmailTemplate = template.Must(template.New("email").Parse(`Hello {{ .Username }},
+
+You have requested to cancel the deletion of your account on {{ .Pod }}. If this was **NOT** initiated by you, please ignore this email and contact support.
+
+To cancel the deletion and reactivate your account, please visit the following link:
+{{ .BaseURL }}/delete/cancel?token={{ .Token }}
+
+Kind regards,
+
 {{ .Pod }} Support
 `))
 
@@ -256,6 +268,34 @@ func SendPasswordResetEmail(conf *Config, user *User, email, token string) error
 	return nil
 }
 
+func SendCancelDeletionEmail(conf *Config, user *User, email, token string) error {
+	recipients := []string{email}
+	subject := fmt.Sprintf(
+		"[%s]: Cancel Account Deletion for %s",
+		conf.Name, user.Username,
+	)
+	ctx := MagicLinkAuthContext{
+		Pod:     conf.Name,
+		BaseURL: conf.BaseURL,
+
+		Token:    token,
+		Username: user.Username,
+	}
+
+	buf := &bytes.Buffer{}
+	if err := cancelDeletionEmailTemplate.Execute(buf, ctx); err != nil {
+		log.WithError(err).Error("error rendering email template")
+		return err
+	}
+
+	if err := SendEmail(conf, recipients, conf.SMTPFrom, subject, buf.String()); err != nil {
+		log.WithError(err).Errorf("error sending new token to %s", recipients[0])
+		return err
+	}
+
+	return nil
+}
+
 func SendSupportRequestEmail(conf *Config, name, email, subject, message string) error {
 	recipients := []string{conf.AdminEmail, email}
 	emailSubject := fmt.Sprintf(
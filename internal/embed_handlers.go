@@ -0,0 +1,245 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+const (
+	// embedWidth and embedHeight are the default dimensions of embedded twts
+	embedWidth  = 550
+	embedHeight = 250
+
+	// embedMaxAge is how long embeds and oEmbed responses may be cached for
+	embedMaxAge = 5 * time.Minute
+)
+
+// OEmbedResponse is an oEmbed (https://oembed.com) response of the "rich"
+// type embedding a twt
+type OEmbedResponse struct {
+	Type         string `json:"type"`
+	Version      string `json:"version"`
+	Title        string `json:"title,omitempty"`
+	AuthorName   string `json:"author_name,omitempty"`
+	AuthorURL    string `json:"author_url,omitempty"`
+	ProviderName string `json:"provider_name"`
+	ProviderURL  string `json:"provider_url"`
+	CacheAge     int    `json:"cache_age"`
+	HTML         string `json:"html"`
+	Width        int    `json:"width"`
+	Height       int    `json:"height"`
+}
+
+// URLForEmbed returns the url of the embeddable snippet of a twt
+func URLForEmbed(baseURL, hash string) string {
+	return fmt.Sprintf("%s/embed", URLForTwt(baseURL, hash))
+}
+
+// URLForOEmbed returns the url of the oEmbed endpoint for a twt
+func URLForOEmbed(baseURL, hash string) string {
+	return fmt.Sprintf(
+		"%s/oembed?url=%s&format=json",
+		strings.TrimSuffix(baseURL, "/"),
+		url.QueryEscape(URLForTwt(baseURL, hash)),
+	)
+}
+
+// lookupPublicTwt returns the twt with the given hash from the cache or
+// archive only if it is visible to anonymous visitors, may leave the Pod and
+// was neither edited nor deleted
+func (s *Server) lookupPublicTwt(hash string) (types.Twt, bool) {
+	if !IsValidTwtHash(hash) {
+		return types.NilTwt, false
+	}
+
+	twt, ok := s.cache.Lookup(hash)
+	if !ok && s.archive.Has(hash) {
+		if archived, err := s.archive.Get(hash); err == nil {
+			twt = archived
+		}
+	}
+
+	if twt == nil || twt.IsZero() || !visibility.CanView(s.config(), nil, twt) || visibility.Get(hash) == VisibilityLocal {
+		return types.NilTwt, false
+	}
+
+	if history, _ := edits.Get(hash); history != nil && (history.ReplacedBy != "" || history.Deleted()) {
+		return types.NilTwt, false
+	}
+
+	return twt, true
+}
+
+// ConversationAtomHandler serves an Atom feed of the (public) twts of a
+// conversation so visitors can subscribe to busy threads
+func (s *Server) ConversationAtomHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		hash := p.ByName("hash")
+		if !IsValidTwtHash(hash) {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		root, _ := s.lookupPublicTwt(hash)
+
+		twts := visibility.Federated(visibility.Filter(s.config(), nil, s.cache.GetByUserView(nil, fmt.Sprintf("subject:(#%s)", hash), false)))
+		if root.IsZero() && len(twts) == 0 {
+			http.Error(w, "Conversation Not Found", http.StatusNotFound)
+			return
+		}
+
+		// Sort a copy (newest first) so the cached view is never modified,
+		// the root may only be in the archive
+		sorted := make(types.Twts, len(twts), len(twts)+1)
+		copy(sorted, twts)
+		if !root.IsZero() {
+			sorted = append(sorted, root)
+		}
+		twts = UniqTwts(sorted)
+		sort.Sort(twts)
+
+		if r.Method == http.MethodHead {
+			defer r.Body.Close()
+			if len(twts) > 0 {
+				w.Header().Set("Last-Modified", twts[0].Created().Format(http.TimeFormat))
+			}
+			return
+		}
+
+		title := fmt.Sprintf("Conversation #%s", hash)
+		if !root.IsZero() {
+			what := root.FormatText(types.TextFmt, s.config())
+			title = fmt.Sprintf("%s: %s", root.Twter().DomainNick(), TextWithEllipsis(what, maxPermalinkTitle))
+		}
+
+		feed := &feeds.Feed{
+			Title:       title,
+			Link:        &feeds.Link{Href: URLForConv(s.config().BaseURL, hash)},
+			Description: fmt.Sprintf("Twts of the conversation #%s on %s", hash, s.config().Name),
+			Author:      &feeds.Author{Name: s.config().Name, Email: s.config().AdminEmail},
+			Created:     time.Now(),
+		}
+
+		s.writeAtomFeed(w, feed, twts)
+	}
+}
+
+// EmbedHandler renders a single (public) twt as a small standalone HTML
+// snippet that can be embedded by other sites (e.g. in an iframe)
+func (s *Server) EmbedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		hash := p.ByName("hash")
+
+		twt, ok := s.lookupPublicTwt(hash)
+		if !ok {
+			http.Error(w, "Twt Not Found", http.StatusNotFound)
+			return
+		}
+
+		// Embeds are the same for everyone and never depend on a session
+		ctx := NewContext(s, r)
+		ctx.Translate(s.translator)
+		ctx.Title = fmt.Sprintf("%s \"%s\"", twt.Twter().DomainNick(), TextWithEllipsis(twt.FormatText(types.TextFmt, s.config()), maxPermalinkTitle))
+		ctx.Twts = types.Twts{twt}
+
+		buf, err := s.tmplman.ExecStandalone("embed", ctx)
+		if err != nil {
+			log.WithError(err).Error("error rendering embed")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(embedMaxAge.Seconds())))
+		w.Header().Set("Last-Modified", twt.Created().Format(http.TimeFormat))
+
+		if r.Method == http.MethodHead {
+			defer r.Body.Close()
+			return
+		}
+
+		_, _ = buf.WriteTo(w)
+	}
+}
+
+// OEmbedHandler is the oEmbed endpoint for the permalinks of (public) twts
+// (See: https://oembed.com), only the json format is supported
+func (s *Server) OEmbedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if format := r.URL.Query().Get("format"); format != "" && format != "json" {
+			http.Error(w, "Not Implemented", http.StatusNotImplemented)
+			return
+		}
+
+		u, err := url.Parse(r.URL.Query().Get("url"))
+		if err != nil || !s.config().IsLocalURL(u.String()) || !strings.HasPrefix(u.Path, "/twt/") {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		hash := strings.Trim(strings.TrimPrefix(u.Path, "/twt/"), "/")
+		twt, ok := s.lookupPublicTwt(hash)
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		width := SafeParseInt(r.URL.Query().Get("maxwidth"), embedWidth)
+		if width <= 0 || width > embedWidth {
+			width = embedWidth
+		}
+		height := SafeParseInt(r.URL.Query().Get("maxheight"), embedHeight)
+		if height <= 0 || height > embedHeight {
+			height = embedHeight
+		}
+
+		twter := twt.Twter()
+		authorURL := twter.URI
+		if s.config().IsLocalURL(authorURL) {
+			authorURL = UserURL(authorURL)
+		}
+
+		res := OEmbedResponse{
+			Type:         "rich",
+			Version:      "1.0",
+			Title:        TextWithEllipsis(twt.FormatText(types.TextFmt, s.config()), maxPermalinkTitle),
+			AuthorName:   twter.DomainNick(),
+			AuthorURL:    authorURL,
+			ProviderName: s.config().Name,
+			ProviderURL:  s.config().BaseURL,
+			CacheAge:     int(embedMaxAge.Seconds()),
+			HTML: fmt.Sprintf(
+				`<iframe src="%s" width="%d" height="%d" frameborder="0" loading="lazy" title="%s"></iframe>`,
+				html.EscapeString(URLForEmbed(s.config().BaseURL, twt.Hash())), width, height,
+				html.EscapeString(twter.DomainNick()),
+			),
+			Width:  width,
+			Height: height,
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			log.WithError(err).Error("error serializing oembed response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(embedMaxAge.Seconds())))
+		_, _ = w.Write(data)
+	}
+}
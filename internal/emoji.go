@@ -0,0 +1,236 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	emojiDir = "emoji"
+
+	// emojiResolution is the maximum width and height of custom emoji
+	emojiResolution = 64
+)
+
+var (
+	// ErrInvalidShortcode is returned when an emoji's shortcode is invalid
+	ErrInvalidShortcode = errors.New("error: invalid emoji shortcode")
+
+	validShortcode = regexp.MustCompile(`^[a-z0-9_+-]{2,32}$`)
+	emojiPattern   = regexp.MustCompile(`:([a-z0-9_+-]{2,32}):`)
+	htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+)
+
+// Emoji is a pod's custom emoji
+type Emoji struct {
+	Shortcode string `json:"shortcode"`
+	URL       string `json:"url"`
+}
+
+// CustomEmoji holds the custom emoji of a pod stored as images named after
+// their shortcode in the data directory. A nil *CustomEmoji has no emoji.
+type CustomEmoji struct {
+	sync.RWMutex
+
+	conf  *Config
+	emoji map[string]*Emoji
+}
+
+// NewCustomEmoji ...
+func NewCustomEmoji(conf *Config) *CustomEmoji {
+	return &CustomEmoji{
+		conf:  conf,
+		emoji: make(map[string]*Emoji),
+	}
+}
+
+// NormalizeShortcode strips surrounding colons and whitespace from a shortcode
+func NormalizeShortcode(shortcode string) string {
+	return strings.ToLower(strings.Trim(strings.TrimSpace(shortcode), ":"))
+}
+
+// ValidateShortcode ...
+func ValidateShortcode(shortcode string) error {
+	if !validShortcode.MatchString(shortcode) {
+		return ErrInvalidShortcode
+	}
+	return nil
+}
+
+func (e *CustomEmoji) dir() string {
+	return filepath.Join(e.conf.Data, emojiDir)
+}
+
+// Load (re)loads all custom emoji from the data directory
+func (e *CustomEmoji) Load() error {
+	if err := os.MkdirAll(e.dir(), 0755); err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(e.dir())
+	if err != nil {
+		return err
+	}
+
+	emoji := make(map[string]*Emoji)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		ext := filepath.Ext(name)
+		if entry.IsDir() || (ext != ".png" && ext != ".gif") || strings.HasSuffix(strings.TrimSuffix(name, ext), ".orig") {
+			continue
+		}
+
+		shortcode := strings.TrimSuffix(name, ext)
+		if ValidateShortcode(shortcode) != nil {
+			continue
+		}
+
+		emoji[shortcode] = &Emoji{
+			Shortcode: shortcode,
+			URL:       fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(e.conf.BaseURL, "/"), emojiDir, name),
+		}
+	}
+
+	e.Lock()
+	e.emoji = emoji
+	e.Unlock()
+
+	return nil
+}
+
+// Add stores a new (or replaces an existing) custom emoji
+func (e *CustomEmoji) Add(shortcode string, r io.Reader) error {
+	if err := ValidateShortcode(shortcode); err != nil {
+		return err
+	}
+
+	// Remove any previous image as the new one may be of a different type
+	e.remove(shortcode)
+
+	opts := &ImageOptions{Resize: true, Width: emojiResolution, Height: emojiResolution}
+	if _, err := StoreUploadedImage(e.conf, r, emojiDir, shortcode, opts); err != nil {
+		return err
+	}
+
+	return e.Load()
+}
+
+func (e *CustomEmoji) remove(shortcode string) {
+	for _, ext := range []string{"png", "gif"} {
+		for _, fn := range []string{
+			filepath.Join(e.dir(), fmt.Sprintf("%s.%s", shortcode, ext)),
+			filepath.Join(e.dir(), fmt.Sprintf("%s.orig.%s", shortcode, ext)),
+		} {
+			if err := os.Remove(fn); err != nil && !os.IsNotExist(err) {
+				log.WithError(err).Warnf("error removing emoji file %s", fn)
+			}
+		}
+	}
+}
+
+// Delete removes a custom emoji
+func (e *CustomEmoji) Delete(shortcode string) error {
+	if err := ValidateShortcode(shortcode); err != nil {
+		return err
+	}
+
+	e.remove(shortcode)
+
+	return e.Load()
+}
+
+// Get returns the custom emoji for a shortcode
+func (e *CustomEmoji) Get(shortcode string) (*Emoji, bool) {
+	if e == nil {
+		return nil, false
+	}
+
+	e.RLock()
+	defer e.RUnlock()
+
+	emoji, ok := e.emoji[shortcode]
+	return emoji, ok
+}
+
+// List returns all custom emoji sorted by shortcode
+func (e *CustomEmoji) List() []*Emoji {
+	if e == nil {
+		return nil
+	}
+
+	e.RLock()
+	defer e.RUnlock()
+
+	emoji := make([]*Emoji, 0, len(e.emoji))
+	for _, em := range e.emoji {
+		emoji = append(emoji, em)
+	}
+	sort.Slice(emoji, func(i, j int) bool {
+		return emoji[i].Shortcode < emoji[j].Shortcode
+	})
+
+	return emoji
+}
+
+// Render replaces all :shortcode: of known custom emoji in sanitized HTML
+// with images, leaving tags and the contents of code blocks untouched.
+func (e *CustomEmoji) Render(html string) string {
+	if e == nil || !strings.Contains(html, ":") {
+		return html
+	}
+
+	var (
+		sb    strings.Builder
+		last  int
+		depth int
+	)
+
+	replace := func(text string) string {
+		if depth > 0 {
+			return text
+		}
+		return emojiPattern.ReplaceAllStringFunc(text, func(m string) string {
+			emoji, ok := e.Get(strings.Trim(m, ":"))
+			if !ok {
+				return m
+			}
+			return fmt.Sprintf(
+				`<img class="emoji" src="%s" alt="%s" title="%s" loading="lazy">`,
+				emoji.URL, m, m,
+			)
+		})
+	}
+
+	for _, loc := range htmlTagPattern.FindAllStringIndex(html, -1) {
+		sb.WriteString(replace(html[last:loc[0]]))
+
+		tag := strings.ToLower(html[loc[0]:loc[1]])
+		switch {
+		case strings.HasPrefix(tag, "<code"), strings.HasPrefix(tag, "<pre"):
+			depth++
+		case strings.HasPrefix(tag, "</code"), strings.HasPrefix(tag, "</pre"):
+			if depth > 0 {
+				depth--
+			}
+		}
+
+		sb.WriteString(html[loc[0]:loc[1]])
+		last = loc[1]
+	}
+	sb.WriteString(replace(html[last:]))
+
+	return sb.String()
+}
@@ -0,0 +1,148 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// EmojiHandler serves the images of custom emoji
+func (s *Server) EmojiHandler() httprouter.Handle {
+	dir := filepath.Join(s.config().Data, emojiDir)
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		name := filepath.Base(p.ByName("name"))
+
+		ext := filepath.Ext(name)
+		switch ext {
+		case ".gif", ".png":
+			w.Header().Set("Content-Type", fmt.Sprintf("image/%s", strings.TrimPrefix(ext, ".")))
+		default:
+			http.Error(w, "Emoji Not Found", http.StatusNotFound)
+			return
+		}
+
+		fn := filepath.Join(dir, name)
+
+		fileInfo, err := os.Stat(fn)
+		if err != nil {
+			http.Error(w, "Emoji Not Found", http.StatusNotFound)
+			return
+		}
+
+		etag := fmt.Sprintf("W/\"%s-%s\"", r.RequestURI, fileInfo.ModTime().Format(time.RFC3339))
+		if match := r.Header.Get("If-None-Match"); match != "" {
+			if strings.Contains(match, etag) {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+
+		f, err := os.Open(fn)
+		if err != nil {
+			log.WithError(err).Error("error opening emoji file")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+
+		w.Header().Set("Etag", etag)
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+
+		if r.Method == http.MethodHead {
+			return
+		}
+
+		http.ServeContent(w, r, filepath.Base(fn), fileInfo.ModTime(), f)
+	}
+}
+
+// ManageEmojiHandler lists and uploads the pod's custom emoji
+func (s *Server) ManageEmojiHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			ctx.Title = s.tr(ctx, "PageManageEmojiTitle")
+			s.render("manageEmoji", w, ctx)
+			return
+		}
+
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
+		defer r.Body.Close()
+
+		shortcode := NormalizeShortcode(r.FormValue("shortcode"))
+		if err := ValidateShortcode(shortcode); err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorInvalidShortcode")
+			s.render("error", w, ctx)
+			return
+		}
+
+		file, _, err := r.FormFile("emoji_file")
+		if err != nil {
+			log.WithError(err).Error("error parsing emoji file")
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUploadingEmoji")
+			s.render("error", w, ctx)
+			return
+		}
+		defer file.Close()
+
+		if err := emojis.Add(shortcode, file); err != nil {
+			log.WithError(err).Errorf("error storing emoji %s", shortcode)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUploadingEmoji")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/emoji", http.StatusFound)
+	}
+}
+
+// DelEmojiHandler deletes one of the pod's custom emoji
+func (s *Server) DelEmojiHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		shortcode := NormalizeShortcode(r.FormValue("shortcode"))
+		if err := emojis.Delete(shortcode); err != nil {
+			log.WithError(err).Errorf("error deleting emoji %s", shortcode)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorDeletingEmoji")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/emoji", http.StatusFound)
+	}
+}
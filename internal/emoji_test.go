@@ -0,0 +1,60 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomEmojiRender(t *testing.T) {
+	e := &CustomEmoji{
+		emoji: map[string]*Emoji{
+			"yarn": {Shortcode: "yarn", URL: "https://example.com/emoji/yarn.png"},
+		},
+	}
+
+	img := `<img class="emoji" src="https://example.com/emoji/yarn.png" alt=":yarn:" title=":yarn:" loading="lazy">`
+
+	testCases := []struct {
+		name     string
+		html     string
+		expected string
+	}{
+		{
+			name:     "known shortcode",
+			html:     `<p>hello :yarn: world</p>`,
+			expected: `<p>hello ` + img + ` world</p>`,
+		},
+		{
+			name:     "unknown shortcode",
+			html:     `<p>hello :wool: world</p>`,
+			expected: `<p>hello :wool: world</p>`,
+		},
+		{
+			name:     "inside code",
+			html:     `<p><code>:yarn:</code> :yarn:</p>`,
+			expected: `<p><code>:yarn:</code> ` + img + `</p>`,
+		},
+		{
+			name:     "inside attribute",
+			html:     `<a href="https://example.com/:yarn:/">link</a>`,
+			expected: `<a href="https://example.com/:yarn:/">link</a>`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, e.Render(testCase.html))
+		})
+	}
+}
+
+func TestNormalizeShortcode(t *testing.T) {
+	assert.Equal(t, "yarn", NormalizeShortcode(" :Yarn: "))
+	assert.NoError(t, ValidateShortcode("yarn_ball+1"))
+	assert.Error(t, ValidateShortcode("../etc"))
+	assert.Error(t, ValidateShortcode("y"))
+}
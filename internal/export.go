@@ -0,0 +1,277 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// maxExportPages is the maximum number of pages of a timeline or profile
+// rendered by a static export
+const maxExportPages = 100
+
+var (
+	exportLinkRegexp  = regexp.MustCompile(`(href|src)="([^"]*)"`)
+	exportPagerRegexp = regexp.MustCompile(`^\?p=(\d+)$`)
+
+	exportAssetPrefixes = []string{"/css/", "/js/", "/img/", "/media/", "/emoji/", "/custom/"}
+)
+
+// staticExport renders a read-only static copy of the pod, or of a single
+// profile, by rendering the pod's own pages with the existing templates as
+// an anonymous visitor and writing them together with the feeds, media and
+// assets they reference to a zip archive
+type staticExport struct {
+	s  *Server
+	zw *zip.Writer
+
+	seen    map[string]bool
+	pending []string
+}
+
+// ExportStatic writes a static site of the pod, or of the profile of nick if
+// it is not empty, to w as a zip archive
+func (s *Server) ExportStatic(w io.Writer, nick string) error {
+	e := &staticExport{s: s, zw: zip.NewWriter(w), seen: make(map[string]bool)}
+
+	var nicks, listings []string
+	if nick != "" {
+		nicks = append(nicks, nick)
+	} else {
+		listings = append(listings, "/", "/about", "/help", "/privacy", "/abuse")
+		users, err := s.db.GetAllUsers()
+		if err != nil {
+			return err
+		}
+		for _, user := range users {
+			nicks = append(nicks, user.Username)
+		}
+		if err := e.exportFile("/atom.xml"); err != nil {
+			return err
+		}
+	}
+
+	for _, nick := range nicks {
+		listings = append(listings, fmt.Sprintf("/user/%s/", nick))
+		for _, name := range []string{"twtxt.txt", "atom.xml", "avatar"} {
+			if err := e.exportFile(fmt.Sprintf("/user/%s/%s", nick, name)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, listing := range listings {
+		for page := 1; page <= maxExportPages; page++ {
+			uri := listing
+			if page > 1 {
+				uri = fmt.Sprintf("%s?p=%d", listing, page)
+			}
+			pages, err := e.exportPage(uri, true)
+			if err != nil {
+				return err
+			}
+			if !pages[page+1] {
+				break
+			}
+		}
+	}
+
+	// Permalinks and conversations linked from timelines and profiles
+	for len(e.pending) > 0 {
+		uri := e.pending[0]
+		e.pending = e.pending[1:]
+		if _, err := e.exportPage(uri, false); err != nil {
+			return err
+		}
+	}
+
+	return e.zw.Close()
+}
+
+// get renders uri with the pod's router as an anonymous visitor would see it
+func (e *staticExport) get(uri string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, strings.TrimSuffix(e.s.config().BaseURL, "/")+uri, nil)
+	w := httptest.NewRecorder()
+	e.s.router.ServeHTTP(w, req)
+	return w
+}
+
+func (e *staticExport) write(name string, data []byte) error {
+	f, err := e.zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+// exportFile exports uri as is (feeds, media and assets)
+func (e *staticExport) exportFile(uri string) error {
+	if e.seen[uri] {
+		return nil
+	}
+	e.seen[uri] = true
+
+	res := e.get(uri)
+	if res.Code != http.StatusOK {
+		log.Debugf("skipping %s from static export: %d", uri, res.Code)
+		return nil
+	}
+
+	return e.write(strings.TrimPrefix(path.Clean(uri), "/"), res.Body.Bytes())
+}
+
+// exportPage exports the html page uri with links rewritten for static
+// hosting and returns the pages of the pager of the page. Permalinks are only
+// followed from listing pages (timelines and profiles).
+func (e *staticExport) exportPage(uri string, listing bool) (map[int]bool, error) {
+	pages := make(map[int]bool)
+
+	if e.seen[uri] {
+		return pages, nil
+	}
+	e.seen[uri] = true
+
+	res := e.get(uri)
+	if res.Code != http.StatusOK {
+		log.Debugf("skipping %s from static export: %d", uri, res.Code)
+		return pages, nil
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var errs []error
+	body := exportLinkRegexp.ReplaceAllStringFunc(res.Body.String(), func(match string) string {
+		m := exportLinkRegexp.FindStringSubmatch(match)
+		attr, link := m[1], m[2]
+
+		if pm := exportPagerRegexp.FindStringSubmatch(link); pm != nil {
+			n, _ := strconv.Atoi(pm[1])
+			pages[n] = true
+			return fmt.Sprintf(`%s="%s"`, attr, exportPagePath(u.Path, n))
+		}
+
+		local := e.localPath(link)
+		if local == "" {
+			return match
+		}
+
+		switch {
+		case isExportAsset(local):
+			if err := e.exportFile(stripQuery(local)); err != nil {
+				errs = append(errs, err)
+			}
+			return fmt.Sprintf(`%s="%s"`, attr, local)
+		case listing && (strings.HasPrefix(local, "/twt/") || strings.HasPrefix(local, "/conv/")):
+			if target := stripQuery(local); !e.seen[target] {
+				e.pending = append(e.pending, target)
+			}
+		}
+
+		return fmt.Sprintf(`%s="%s"`, attr, local)
+	})
+	if len(errs) > 0 {
+		return nil, errs[0]
+	}
+
+	page, _ := strconv.Atoi(u.Query().Get("p"))
+	name := path.Join(strings.TrimPrefix(exportPagePath(u.Path, page), "/"), "index.html")
+	if err := e.write(name, []byte(body)); err != nil {
+		return nil, err
+	}
+
+	return pages, nil
+}
+
+// localPath returns the path of a link to the pod or an empty string for
+// links to other sites
+func (e *staticExport) localPath(link string) string {
+	link = strings.TrimPrefix(link, strings.TrimSuffix(e.s.config().BaseURL, "/"))
+	if !strings.HasPrefix(link, "/") || strings.HasPrefix(link, "//") {
+		return ""
+	}
+	return link
+}
+
+// exportPagePath returns the path a page of a timeline or profile is
+// exported to (the first page is the timeline or profile itself)
+func exportPagePath(p string, page int) string {
+	if page <= 1 {
+		return p
+	}
+	return strings.TrimSuffix(p, "/") + fmt.Sprintf("/page/%d/", page)
+}
+
+func isExportAsset(p string) bool {
+	for _, prefix := range exportAssetPrefixes {
+		if strings.HasPrefix(p, prefix) {
+			return true
+		}
+	}
+	return strings.HasPrefix(p, "/user/") && strings.HasSuffix(stripQuery(p), "/avatar")
+}
+
+func stripQuery(p string) string {
+	if i := strings.IndexAny(p, "?#"); i != -1 {
+		return p[:i]
+	}
+	return p
+}
+
+// ExportHandler downloads a static site of the pod, or of a single profile
+// with ?nick=, as a zip archive
+func (s *Server) ExportHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		name := s.config().Name
+		nick := NormalizeUsername(r.FormValue("nick"))
+		if nick != "" {
+			if !s.db.HasUser(nick) {
+				ctx.Error = true
+				ctx.Message = "No user found by that name"
+				s.render("error", w, ctx)
+				return
+			}
+			name = nick
+		}
+
+		filename := fmt.Sprintf("%s-%s.zip", name, time.Now().Format("2006-01-02"))
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+		if err := s.ExportStatic(w, nick); err != nil {
+			log.WithError(err).Error("error exporting static site")
+		}
+	}
+}
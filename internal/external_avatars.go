@@ -0,0 +1,127 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// externalAvatarMaxAge is how long a cached external avatar is used
+	// before it is re-validated against the avatar advertised by its feed
+	externalAvatarMaxAge = 7 * 24 * time.Hour
+)
+
+// externalAvatarVersions caches the content hashes of external avatars that
+// are used to bust browser caches when an avatar changes
+var externalAvatarVersions = &avatarVersions{versions: make(map[string]string)}
+
+type avatarVersions struct {
+	sync.RWMutex
+	versions map[string]string
+}
+
+func (av *avatarVersions) Get(conf *Config, slug string) string {
+	av.RLock()
+	version, ok := av.versions[slug]
+	av.RUnlock()
+	if ok {
+		return version
+	}
+
+	fn := filepath.Join(conf.Data, externalDir, fmt.Sprintf("%s.png", slug))
+	if !FileExists(fn) {
+		return ""
+	}
+
+	version, err := FastHashFile(fn)
+	if err != nil {
+		log.WithError(err).Warnf("error hashing external avatar %s", slug)
+		return ""
+	}
+
+	av.Lock()
+	av.versions[slug] = version
+	av.Unlock()
+
+	return version
+}
+
+func (av *avatarVersions) Forget(slug string) {
+	av.Lock()
+	delete(av.versions, slug)
+	av.Unlock()
+}
+
+// IsExternalAvatarStale returns true if the cached external avatar is older
+// than externalAvatarMaxAge and should be re-validated
+func IsExternalAvatarStale(fn string) bool {
+	stat, err := os.Stat(fn)
+	if err != nil {
+		return true
+	}
+	return time.Since(stat.ModTime()) > externalAvatarMaxAge
+}
+
+// PurgeExternalAvatars removes cached external avatars of feeds that are no
+// longer referenced by the cache or followed by any user
+func PurgeExternalAvatars(conf *Config, cache *Cache, db Store) (int, error) {
+	referenced := make(map[string]bool)
+
+	for _, uri := range cache.GetFeedURLs() {
+		referenced[Slugify(NormalizeURL(uri))] = true
+	}
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		return 0, err
+	}
+	for _, user := range users {
+		for _, uri := range user.Following {
+			referenced[Slugify(NormalizeURL(uri))] = true
+		}
+	}
+
+	dir := filepath.Join(conf.Data, externalDir)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	purged := 0
+	for _, file := range files {
+		ext := filepath.Ext(file.Name())
+		if ext != ".png" && ext != ".cbf" {
+			continue
+		}
+
+		slug := strings.TrimSuffix(file.Name(), ext)
+		if referenced[slug] {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			log.WithError(err).Warnf("error removing external avatar %s", file.Name())
+			continue
+		}
+		externalAvatarVersions.Forget(slug)
+
+		if ext == ".png" {
+			purged++
+		}
+	}
+
+	return purged, nil
+}
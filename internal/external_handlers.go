@@ -39,11 +39,11 @@ func (s *Server) ExternalHandler() httprouter.Handle {
 			return
 		}
 
-		if !s.cache.IsCached(uri) {
-			s.tasks.DispatchFunc(func() error {
+		if !s.cache.IsCached(uri) && !ctx.User.HasBlocked(uri) {
+			s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityInteractive, func() error {
 				sources := make(types.FetchFeedRequests)
 				sources[types.FetchFeedRequest{Nick: nick, URL: uri}] = true
-				s.cache.FetchFeeds(s.config, s.archive, sources, nil)
+				s.cache.FetchFeeds(s.config(), s.archive, sources, nil)
 				return nil
 			})
 		}
@@ -54,12 +54,14 @@ func (s *Server) ExternalHandler() httprouter.Handle {
 			ctx.Twter = types.Twter{Nick: nick, URI: uri}
 		}
 
+		ctx.FeedStats = feedStats.Get(s.config(), uri, s.cache.GetByURL(uri))
+
 		twts := s.FilterTwts(ctx.User, s.cache.GetByURL(uri))
 
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config().TwtsPerPage)
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
@@ -175,11 +177,11 @@ func (s *Server) ExternalFollowingHandler() httprouter.Handle {
 			return
 		}
 
-		if !s.cache.IsCached(uri) {
-			s.tasks.DispatchFunc(func() error {
+		if !s.cache.IsCached(uri) && !ctx.User.HasBlocked(uri) {
+			s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityInteractive, func() error {
 				sources := make(types.FetchFeedRequests)
 				sources[types.FetchFeedRequest{Nick: nick, URL: uri}] = true
-				s.cache.FetchFeeds(s.config, s.archive, sources, nil)
+				s.cache.FetchFeeds(s.config(), s.archive, sources, nil)
 				return nil
 			})
 		}
@@ -229,7 +231,7 @@ func (s *Server) ExternalFollowingHandler() httprouter.Handle {
 
 			Nick:        nick,
 			Description: ctx.Twter.Tagline,
-			Avatar:      URLForExternalAvatar(s.config, uri),
+			Avatar:      URLForExternalAvatar(s.config(), uri),
 			URI:         uri,
 
 			Following:  follows,
@@ -282,7 +284,12 @@ func (s *Server) ExternalAvatarHandler() httprouter.Handle {
 		}
 
 		slug := Slugify(uri)
-		fn, err := securejoin.SecureJoin(filepath.Join(s.config.Data, externalDir), fmt.Sprintf("%s.png", slug))
+
+		// Versioned URLs change whenever the avatar does so can be cached forever
+		if version := r.URL.Query().Get("v"); version != "" && version == externalAvatarVersions.Get(s.config(), slug) {
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		}
+		fn, err := securejoin.SecureJoin(filepath.Join(s.config().Data, externalDir), fmt.Sprintf("%s.png", slug))
 		if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
@@ -295,7 +302,7 @@ func (s *Server) ExternalAvatarHandler() httprouter.Handle {
 				domainNick = twter.DomainNick()
 			}
 
-			img, err := GenerateAvatar(s.config, domainNick)
+			img, err := GenerateAvatar(s.config(), domainNick)
 			if err != nil {
 				log.WithError(err).Errorf("error generating external avatar for %s", uri)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -22,6 +22,7 @@ const (
 	FeatureMovingAverageFeedRefresh
 	FeatureJumpTimelineAge
 	FeatureWebSub
+	FeatureLinkShortener
 )
 
 // Interface guards
@@ -42,6 +43,8 @@ func (f FeatureType) String() string {
 		return "jump_timeline_age"
 	case FeatureWebSub:
 		return "websub"
+	case FeatureLinkShortener:
+		return "link_shortener"
 	default:
 		return "invalid_feature"
 	}
@@ -78,6 +81,8 @@ func FeatureFromString(s string) (FeatureType, error) {
 		return FeatureJumpTimelineAge, nil
 	case "websub":
 		return FeatureWebSub, nil
+	case "link_shortener":
+		return FeatureLinkShortener, nil
 	default:
 		fs := fmt.Sprintf("available features: %s", strings.Join(AvailableFeatures(), " "))
 		return FeatureInvalid, fmt.Errorf("Error unrecognised feature: %s (%s)", s, fs)
@@ -167,6 +172,22 @@ func (f *FeatureFlags) EnableAll(features []FeatureType) {
 	}
 }
 
+// Set replaces the flags with those of other
+func (f *FeatureFlags) Set(other *FeatureFlags) {
+	flags := make(map[FeatureType]bool)
+	if other != nil {
+		other.RLock()
+		for feature, enabled := range other.flags {
+			flags[feature] = enabled
+		}
+		other.RUnlock()
+	}
+
+	f.Lock()
+	f.flags = flags
+	f.Unlock()
+}
+
 func (f *FeatureFlags) IsEnabled(feature FeatureType) bool {
 	f.RLock()
 	defer f.RUnlock()
@@ -0,0 +1,306 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+// FeedArchive is an archived (rotated) part of a local feed advertised with
+// `# prev = <hash> <url>` as per the twtxt archive feeds extension, where the
+// hash is that of the most recent twt of the archive
+type FeedArchive struct {
+	ID   int
+	Hash string
+	URL  string
+}
+
+// URLForFeedArchive returns the url an archived part of a local feed is
+// served at (the most recent archive has the id 0)
+func URLForFeedArchive(baseURL, nick string, id int) string {
+	return fmt.Sprintf(
+		"%s/user/%s/archive/%d",
+		strings.TrimSuffix(baseURL, "/"),
+		nick, id,
+	)
+}
+
+// feedArchiveFilename returns the filename of an archived part of a feed
+func feedArchiveFilename(conf *Config, nick string, id int) string {
+	return filepath.Join(conf.Data, feedsDir, fmt.Sprintf("%s.%d", nick, id))
+}
+
+// GetFeedArchive returns the archived part of a local feed with the given id
+// or nil if the feed has no such archive
+func GetFeedArchive(conf *Config, nick string, id int) *FeedArchive {
+	f, err := os.Open(feedArchiveFilename(conf, nick, id))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.WithError(err).Warnf("error opening archived feed %s.%d", nick, id)
+		}
+		return nil
+	}
+	defer f.Close()
+
+	// Twt hashes depend on the url of the feed, not the url of the archive
+	twter := types.Twter{Nick: nick, URI: URLForUser(conf.BaseURL, nick)}
+	tf, err := types.ParseFile(f, &twter)
+	if err != nil {
+		log.WithError(err).Warnf("error parsing archived feed %s.%d", nick, id)
+		return nil
+	}
+
+	var latest types.Twt = types.NilTwt
+	for _, twt := range tf.Twts() {
+		if latest.IsZero() || twt.Created().After(latest.Created()) {
+			latest = twt
+		}
+	}
+	if latest.IsZero() {
+		return nil
+	}
+
+	return &FeedArchive{
+		ID:   id,
+		Hash: latest.Hash(),
+		URL:  URLForFeedArchive(conf.BaseURL, nick, id),
+	}
+}
+
+// GetFeedHistory returns the full history of a local feed, the twts of the
+// feed and all of its archived (rotated) parts, newest first
+func GetFeedHistory(conf *Config, nick string) (types.Twts, error) {
+	twts, err := GetAllTwts(conf, nick)
+	if err != nil {
+		return nil, err
+	}
+
+	for id := 0; ; id++ {
+		f, err := os.Open(feedArchiveFilename(conf, nick, id))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				log.WithError(err).Warnf("error opening archived feed %s.%d", nick, id)
+			}
+			break
+		}
+
+		// Twt hashes depend on the url of the feed, not the url of the archive
+		twter := types.Twter{Nick: nick, URI: URLForUser(conf.BaseURL, nick)}
+		tf, err := types.ParseFile(f, &twter)
+		f.Close()
+		if err != nil {
+			log.WithError(err).Warnf("error parsing archived feed %s.%d", nick, id)
+			break
+		}
+		twts = append(twts, tf.Twts()...)
+	}
+
+	sort.Sort(twts)
+
+	return twts, nil
+}
+
+// MergeFeedHistory merges the history of a local feed (See: GetFeedHistory)
+// into its cached twts so older twts can be paged through. Twts of the
+// history that are not archived yet are archived so their permalinks and
+// conversations keep working once they are no longer cached.
+func MergeFeedHistory(archive Archiver, cached, history types.Twts) types.Twts {
+	seen := make(map[string]bool, len(cached))
+	for _, twt := range cached {
+		seen[twt.Hash()] = true
+	}
+
+	// Copy the cached twts so the cache's own slice is never modified
+	twts := make(types.Twts, len(cached), len(cached)+len(history))
+	copy(twts, cached)
+
+	for _, twt := range history {
+		hash := twt.Hash()
+		if seen[hash] {
+			continue
+		}
+		seen[hash] = true
+
+		if !archive.Has(hash) {
+			if err := archive.Archive(twt); err != nil {
+				log.WithError(err).Errorf("error archiving twt %s", hash)
+			}
+		}
+
+		twts = append(twts, twt)
+	}
+
+	sort.Sort(twts)
+
+	return twts
+}
+
+// FeedArchiveHandler serves an archived part of a local feed with a minimal
+// preamble linking to the next (older) archive if any
+func (s *Server) FeedArchiveHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		nick := NormalizeUsername(p.ByName("nick"))
+		id, err := strconv.Atoi(p.ByName("id"))
+		if nick == "" || err != nil || id < 0 {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if user, err := s.db.GetUser(nick); err == nil && !user.IsActive() {
+			http.Error(w, "Feed Gone", http.StatusGone)
+			return
+		}
+
+		fn := feedArchiveFilename(s.config(), nick, id)
+		stat, err := os.Stat(fn)
+		if err != nil {
+			if os.IsNotExist(err) {
+				http.Error(w, "Archive Not Found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			log.WithError(err).Errorf("error reading archived feed %s.%d", nick, id)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// Archives are subject to the same visibility as the feed itself
+		feed, err := s.visibleFeed(w, r, NewContext(s, r).User, nick, bytes.NewReader(data))
+		if err == nil {
+			data, err = io.ReadAll(feed)
+		}
+		if err != nil {
+			log.WithError(err).Errorf("error filtering archived feed %s.%d", nick, id)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		buf := &bytes.Buffer{}
+		fmt.Fprintf(buf, "# nick = %s\n", nick)
+		fmt.Fprintf(buf, "# url = %s\n", URLForUser(s.config().BaseURL, nick))
+		if prev := GetFeedArchive(s.config(), nick, id+1); prev != nil {
+			fmt.Fprintf(buf, "# prev = %s %s\n", prev.Hash, prev.URL)
+		}
+		buf.WriteString("#\n")
+		buf.Write(data)
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Last-Modified", stat.ModTime().UTC().Format(http.TimeFormat))
+		w.Header().Set("ETag", feedETag(buf.Bytes()))
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(buf.Bytes()))
+	}
+}
+
+// maxFeedArchiveFetches bounds the number of archives of a feed followed via
+// its prev links in a single fetch so history can be reconstructed without
+// letting a feed make the fetcher walk an unbounded chain
+const maxFeedArchiveFetches = 5
+
+// ParseFeedPrev returns the hash and (absolute) url of the archive a feed
+// links to with `# prev = <hash> <url>` (See: twtxt archive feeds extension)
+func ParseFeedPrev(feedURL string, data []byte) (hash, prevURL string, ok bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) != "prev" {
+			continue
+		}
+
+		fields := strings.Fields(parts[1])
+		if len(fields) != 2 {
+			continue
+		}
+
+		base, err := url.Parse(feedURL)
+		if err != nil {
+			return "", "", false
+		}
+		ref, err := url.Parse(fields[1])
+		if err != nil {
+			return "", "", false
+		}
+		return fields[0], base.ResolveReference(ref).String(), true
+	}
+	return "", "", false
+}
+
+// FetchFeedArchives follows the prev links of a fetched feed (bounded) and
+// archives the twts of archives not seen before so the full history of the
+// feed can be reconstructed. Archives are never cached, only archived.
+func FetchFeedArchives(conf *Config, archive Archiver, twter types.Twter, data []byte) {
+	feedURL := twter.URI
+
+	for i := 0; i < maxFeedArchiveFetches; i++ {
+		hash, prevURL, ok := ParseFeedPrev(feedURL, data)
+		if !ok || archive.Has(hash) {
+			return
+		}
+
+		if u, err := url.Parse(prevURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+
+		res, err := RequestHTTP(conf, http.MethodGet, prevURL, nil)
+		if err != nil {
+			Logger(LogFetcher).WithError(err).Warnf("error fetching archive %s of %s", prevURL, twter.URI)
+			return
+		}
+
+		data, err = io.ReadAll(&io.LimitedReader{R: res.Body, N: conf.MaxFetchLimit})
+		res.Body.Close()
+		if err != nil || res.StatusCode != http.StatusOK {
+			Logger(LogFetcher).Warnf("error fetching archive %s of %s: %s", prevURL, twter.URI, res.Status)
+			return
+		}
+
+		// Twt hashes depend on the url of the feed, not the url of the archive
+		archiveTwter := twter
+		tf, err := types.ParseFile(bytes.NewReader(data), &archiveTwter)
+		if err != nil {
+			Logger(LogFetcher).WithError(err).Warnf("error parsing archive %s of %s", prevURL, twter.URI)
+			return
+		}
+
+		for _, twt := range tf.Twts() {
+			if archive.Has(twt.Hash()) {
+				continue
+			}
+			if err := archive.Archive(twt); err != nil {
+				Logger(LogFetcher).WithError(err).Errorf("error archiving twt %s", twt.Hash())
+				metrics.Counter("archive", "error").Inc()
+				return
+			}
+			metrics.Counter("archive", "size").Inc()
+		}
+
+		// Archives link to the next (older) archive relative to themselves
+		feedURL = prevURL
+	}
+}
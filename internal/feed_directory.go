@@ -0,0 +1,230 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+const feedDirectoryFile = "directory.json"
+
+// ErrInvalidDirectoryFeed is returned when a feed added to the feed directory
+// has no name or an invalid url
+var ErrInvalidDirectoryFeed = errors.New("error: invalid directory feed")
+
+// FeedDirectory is the Pod's own curated directory of feeds maintained by
+// the Pod Owner/Operator and listed at /feeds above the feeds of the feed
+// sources. A nil *FeedDirectory has no feeds.
+type FeedDirectory struct {
+	sync.RWMutex
+
+	conf  *Config
+	feeds map[string]FeedSource
+}
+
+// NewFeedDirectory ...
+func NewFeedDirectory(conf *Config) (*FeedDirectory, error) {
+	fd := &FeedDirectory{
+		conf:  conf,
+		feeds: make(map[string]FeedSource),
+	}
+
+	data, err := ioutil.ReadFile(fd.filename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fd, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &fd.feeds); err != nil {
+		return nil, err
+	}
+
+	return fd, nil
+}
+
+func (fd *FeedDirectory) filename() string {
+	return filepath.Join(fd.conf.Data, feedDirectoryFile)
+}
+
+func (fd *FeedDirectory) save() error {
+	data, err := json.Marshal(fd.feeds)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fd.filename(), data, 0644)
+}
+
+// Add adds (or replaces) a feed of the directory
+func (fd *FeedDirectory) Add(feed FeedSource) error {
+	feed.Name = strings.TrimSpace(feed.Name)
+	feed.URL = NormalizeURL(strings.TrimSpace(feed.URL))
+	feed.Avatar = strings.TrimSpace(feed.Avatar)
+	feed.Description = strings.TrimSpace(feed.Description)
+	feed.Category = strings.TrimSpace(feed.Category)
+
+	if feed.Name == "" || feed.URL == "" {
+		return ErrInvalidDirectoryFeed
+	}
+	if u, err := url.Parse(feed.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrInvalidDirectoryFeed
+	}
+
+	fd.Lock()
+	defer fd.Unlock()
+
+	fd.feeds[feed.URL] = feed
+
+	return fd.save()
+}
+
+// Delete removes a feed from the directory
+func (fd *FeedDirectory) Delete(uri string) error {
+	fd.Lock()
+	defer fd.Unlock()
+
+	delete(fd.feeds, uri)
+
+	return fd.save()
+}
+
+// List returns the feeds of the directory sorted by category and name
+func (fd *FeedDirectory) List() []FeedSource {
+	if fd == nil {
+		return nil
+	}
+
+	fd.RLock()
+	defer fd.RUnlock()
+
+	feeds := make([]FeedSource, 0, len(fd.feeds))
+	for _, feed := range fd.feeds {
+		feeds = append(feeds, feed)
+	}
+	sort.Slice(feeds, func(i, j int) bool {
+		if feeds[i].Category == feeds[j].Category {
+			return feeds[i].Name < feeds[j].Name
+		}
+		return feeds[i].Category < feeds[j].Category
+	})
+
+	return feeds
+}
+
+// FeedDirectoryResponse is the Pod's feed directory, its curated feeds and
+// the feeds and health of its feed sources
+type FeedDirectoryResponse struct {
+	Curated []FeedSource                `json:"curated"`
+	Sources FeedSourceMap               `json:"sources"`
+	Health  map[string]FeedSourceHealth `json:"health"`
+}
+
+// FeedDirectoryEndpoint returns the Pod's feed directory
+func (a *API) FeedDirectoryEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		feedSources, err := LoadFeedSources(a.config().Data)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error loading feed sources")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		data, err := json.Marshal(FeedDirectoryResponse{
+			Curated: directory.List(),
+			Sources: feedSources.Sources,
+			Health:  feedSources.Health,
+		})
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing feed directory")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// ManageDirectoryHandler lists and adds the feeds of the Pod's curated feed
+// directory
+func (s *Server) ManageDirectoryHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			ctx.Title = s.tr(ctx, "PageManageDirectoryTitle")
+			ctx.CuratedFeeds = CategorizeFeeds(FeedSourceMap{"": directory.List()}, nil)
+			s.render("manageDirectory", w, ctx)
+			return
+		}
+
+		feed := FeedSource{
+			Name:        r.FormValue("name"),
+			URL:         r.FormValue("url"),
+			Avatar:      r.FormValue("avatar"),
+			Description: r.FormValue("description"),
+			Category:    r.FormValue("category"),
+		}
+
+		if err := directory.Add(feed); err != nil {
+			log.WithError(err).Error("error adding feed to directory")
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorInvalidDirectoryFeed")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/directory", http.StatusFound)
+	}
+}
+
+// DelDirectoryFeedHandler removes a feed from the Pod's curated feed
+// directory
+func (s *Server) DelDirectoryFeedHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		uri := r.FormValue("url")
+		if err := directory.Delete(uri); err != nil {
+			log.WithError(err).Errorf("error removing feed %s from directory", uri)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorDeletingDirectoryFeed")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/directory", http.StatusFound)
+	}
+}
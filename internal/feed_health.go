@@ -0,0 +1,129 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	humanize "github.com/dustin/go-humanize"
+	"github.com/julienschmidt/httprouter"
+	"go.yarn.social/types"
+)
+
+// FeedHealth is the fetch diagnostics of a feed a user follows as recorded
+// by the cache when the feed was last fetched
+type FeedHealth struct {
+	Nick string
+	URL  string
+
+	Cached      bool
+	Evicted     bool
+	Twts        int
+	LastFetched time.Time
+	LastStatus  int
+	Size        int64
+	Truncated   bool
+	Malformed   int
+	Errors      int
+	LastError   string
+	Failing     bool
+}
+
+// HumanSize returns the size of the feed in human readable form
+func (h FeedHealth) HumanSize() string {
+	return humanize.Bytes(uint64(h.Size))
+}
+
+// Healthy returns true if the last fetch of the feed succeeded without
+// truncating the feed or dropping any malformed twts
+func (h FeedHealth) Healthy() bool {
+	return h.Cached && !h.Failing && !h.Truncated && h.Malformed == 0
+}
+
+// GetFeedHealth returns the fetch diagnostics of a cached feed
+func (cached *Cached) GetFeedHealth() FeedHealth {
+	cached.mu.RLock()
+	defer cached.mu.RUnlock()
+
+	failing := cached.LastStatus >= http.StatusBadRequest ||
+		(!cached.LastErrorAt.IsZero() && !cached.LastErrorAt.Before(cached.LastFetched))
+
+	return FeedHealth{
+		Cached:      true,
+		Evicted:     cached.Evicted,
+		Twts:        len(cached.Twts),
+		LastFetched: cached.LastFetched,
+		LastStatus:  cached.LastStatus,
+		Size:        cached.LastSize,
+		Truncated:   cached.Truncated,
+		Malformed:   cached.Malformed,
+		Errors:      cached.Errors,
+		LastError:   cached.LastError,
+		Failing:     failing,
+	}
+}
+
+// FeedHealth returns the fetch diagnostics of the feeds a user follows with
+// failing feeds first so users can tell why twts stopped appearing
+func (cache *Cache) FeedHealth(user *User) []FeedHealth {
+	var feeds []FeedHealth
+
+	for nick, url := range user.Following {
+		var health FeedHealth
+		if cached, ok := cache.Feeds.Get(NormalizeURL(url)); ok {
+			health = cached.GetFeedHealth()
+		}
+		health.Nick = nick
+		health.URL = url
+		feeds = append(feeds, health)
+	}
+
+	sort.Slice(feeds, func(i, j int) bool {
+		if feeds[i].Healthy() != feeds[j].Healthy() {
+			return !feeds[i].Healthy()
+		}
+		return strings.ToLower(feeds[i].Nick) < strings.ToLower(feeds[j].Nick)
+	})
+
+	return feeds
+}
+
+// countMalformedLines returns the number of lines of a feed that look like
+// twts but were dropped by the parser
+func countMalformedLines(data []byte, tf types.TwtFile) int {
+	lines := 0
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 || line[0] == '#' {
+			continue
+		}
+		lines++
+	}
+
+	if n := lines - len(tf.Twts()); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// FeedHealthHandler shows the fetch diagnostics of the feeds a user follows
+func (s *Server) FeedHealthHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		ctx.Title = s.tr(ctx, "FeedHealthTitle")
+		ctx.FeedHealth = s.cache.FeedHealth(user)
+		s.render("feedHealth", w, ctx)
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"go.yarn.social/lextwt"
+	"go.yarn.social/types"
+)
+
+// LintSeverity is the severity of a problem found in a feed
+type LintSeverity string
+
+const (
+	// LintError is a problem that causes a feed or twt to be rejected
+	LintError LintSeverity = "error"
+
+	// LintWarning is a problem that may cause twts to be displayed incorrectly
+	LintWarning LintSeverity = "warning"
+)
+
+// LintProblem is a problem found in a feed
+type LintProblem struct {
+	Line     int          `json:"line"`
+	Severity LintSeverity `json:"severity"`
+	Message  string       `json:"message"`
+}
+
+func (p LintProblem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.Severity, p.Message)
+	}
+	return fmt.Sprintf("line %d: %s: %s", p.Line, p.Severity, p.Message)
+}
+
+// LintReport is the result of linting a feed
+type LintReport struct {
+	Twts     int           `json:"twts"`
+	Problems []LintProblem `json:"problems"`
+}
+
+// Valid returns true if no errors were found in the feed
+func (r *LintReport) Valid() bool {
+	for _, p := range r.Problems {
+		if p.Severity == LintError {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *LintReport) add(line int, severity LintSeverity, format string, args ...interface{}) {
+	r.Problems = append(r.Problems, LintProblem{
+		Line:     line,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// lintURLMetadata are the metadata fields whose value must be a URL
+var lintURLMetadata = map[string]bool{
+	"url":    true,
+	"avatar": true,
+}
+
+// LintFeed parses a twtxt feed and reports the problems that cause the feed
+// or some of its twts to be rejected or mangled when fetched by the pod, such
+// as invalid or future dated timestamps, over-long twts, broken metadata and
+// duplicate twt hashes. The uri is used to compute the twt hashes if the
+// feed does not declare its url.
+func LintFeed(conf *Config, r io.Reader, uri string) (*LintReport, error) {
+	limitedReader := &io.LimitedReader{R: r, N: conf.MaxFetchLimit + 1}
+	data, err := io.ReadAll(limitedReader)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &LintReport{}
+
+	if int64(len(data)) > conf.MaxFetchLimit {
+		report.add(0, LintWarning, "feed exceeds the maximum fetch limit of %d bytes and will be truncated", conf.MaxFetchLimit)
+		data = data[:conf.MaxFetchLimit]
+	}
+
+	if !utf8.Valid(data) {
+		report.add(0, LintError, "feed is not valid UTF-8")
+	}
+
+	twter := types.Twter{URI: uri}
+	if _, err := types.ParseFile(bytes.NewReader(data), &twter); err != nil {
+		report.add(0, LintError, "feed is rejected by the parser: %s", err)
+	}
+
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	// Metadata first as the twt hashes depend on the feed's url
+	for i, line := range lines {
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		lintMetadata(report, i+1, line, &twter)
+	}
+
+	hashes := make(map[string]int)
+	now := time.Now()
+
+	for i, line := range lines {
+		n := i + 1
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		parts := strings.SplitN(line, "\t", 2)
+		if len(parts) != 2 {
+			report.add(n, LintError, "twt is missing the tab separating its timestamp and text")
+			continue
+		}
+
+		twt, err := lextwt.ParseLine(line, &twter)
+		if err != nil || twt == nil || twt.IsZero() {
+			report.add(n, LintError, "invalid timestamp %q (expected RFC 3339 e.g: 2006-01-02T15:04:05Z)", parts[0])
+			continue
+		}
+		report.Twts++
+
+		if twt.Created().After(now) {
+			report.add(n, LintError, "twt is dated in the future (%s), possible bad client or misconfigured timezone", twt.Created().Format(time.RFC3339))
+		}
+
+		if strings.TrimSpace(parts[1]) == "" {
+			report.add(n, LintWarning, "twt has no text")
+		}
+
+		if length := utf8.RuneCountInString(parts[1]); length > conf.MaxTwtLength {
+			report.add(n, LintWarning, "twt is %d characters long which exceeds the maximum of %d", length, conf.MaxTwtLength)
+		}
+
+		if prev, ok := hashes[twt.Hash()]; ok {
+			report.add(n, LintError, "twt has the same hash %s as the twt on line %d", twt.Hash(), prev)
+		} else {
+			hashes[twt.Hash()] = n
+		}
+	}
+
+	if report.Twts == 0 {
+		report.add(0, LintWarning, "feed has no twts")
+	}
+
+	return report, nil
+}
+
+func lintMetadata(report *LintReport, n int, line string, twter *types.Twter) {
+	comment := strings.TrimSpace(strings.TrimPrefix(line, "#"))
+	if !strings.Contains(comment, "=") {
+		// Plain comment
+		return
+	}
+
+	kv := strings.SplitN(comment, "=", 2)
+	key, value := strings.TrimSpace(kv[0]), strings.TrimSpace(kv[1])
+	if key == "" || strings.ContainsAny(key, " \t") {
+		// Most likely a comment containing an =
+		return
+	}
+	if value == "" {
+		report.add(n, LintWarning, "metadata field %q has no value", key)
+		return
+	}
+
+	switch {
+	case lintURLMetadata[key]:
+		if !isAbsoluteURL(value) {
+			report.add(n, LintError, "metadata field %q is not a valid absolute url: %s", key, value)
+			return
+		}
+		if key == "url" && twter.URI == "" {
+			twter.URI = value
+		}
+	case key == "nick":
+		if strings.ContainsAny(value, " \t@") {
+			report.add(n, LintWarning, "nick %q contains spaces or @", value)
+		}
+		twter.Nick = value
+	case key == "follow":
+		fields := strings.Fields(value)
+		if len(fields) != 2 || !isAbsoluteURL(fields[1]) {
+			report.add(n, LintError, "follow must be of the form <nick> <url>: %s", value)
+		}
+	case key == "prev":
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			report.add(n, LintError, "prev must be of the form <hash> <url>: %s", value)
+		}
+	case key == "refresh":
+		if _, err := strconv.Atoi(value); err != nil {
+			report.add(n, LintError, "refresh must be a number of seconds: %s", value)
+		}
+	case key == "bot" || key == "automated":
+		if value != "true" && value != "false" {
+			report.add(n, LintWarning, "%s must be true or false: %s", key, value)
+		}
+	}
+}
+
+func isAbsoluteURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
@@ -0,0 +1,56 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLintFeed(t *testing.T) {
+	conf := NewConfig()
+	conf.MaxTwtLength = 20
+
+	lint := func(feed string) *LintReport {
+		report, err := LintFeed(conf, strings.NewReader(feed), "https://example.com/twtxt.txt")
+		require.NoError(t, err)
+		return report
+	}
+
+	lines := func(report *LintReport) []int {
+		var ns []int
+		for _, p := range report.Problems {
+			if p.Line > 0 {
+				ns = append(ns, p.Line)
+			}
+		}
+		return ns
+	}
+
+	t.Run("Valid", func(t *testing.T) {
+		report := lint("# nick = test\n# url = https://example.com/twtxt.txt\n\n2021-01-01T00:00:00Z\tHello World!\n")
+		assert.True(t, report.Valid())
+		assert.Equal(t, 1, report.Twts)
+		assert.Empty(t, report.Problems)
+	})
+
+	t.Run("Problems", func(t *testing.T) {
+		future := time.Now().Add(time.Hour * 24).UTC().Format(time.RFC3339)
+		report := lint(strings.Join([]string{
+			"# url = example.com",
+			"2021-01-01T00:00:00Z\tHello World!",
+			"2021-01-01T00:00:00Z\tHello World!",
+			"yesterday\tHello World!",
+			future + "\tHello Future!",
+			"2021-01-02T00:00:00Z\tThis twt is far too long",
+			"2021-01-03T00:00:00Z Missing tab",
+		}, "\n"))
+		assert.False(t, report.Valid())
+		assert.Equal(t, []int{1, 3, 4, 5, 6, 7}, lines(report))
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+const (
+	// feedStatsWeeks is the number of weeks of the twts per week chart
+	feedStatsWeeks = 12
+
+	// feedStatsTopTags is the number of top tags of a feed's statistics
+	feedStatsTopTags = 5
+
+	// feedStatsTTL is how long a feed's statistics are cached for (unless
+	// the feed changes)
+	feedStatsTTL = time.Hour
+)
+
+// TagCount is the number of twts of a feed with a tag
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// WeekCount is the number of twts of a feed in the week starting at Start
+type WeekCount struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// FeedStats are the statistics of a feed's (public) twts that give a sense
+// of the feed's activity
+type FeedStats struct {
+	Twts          int         `json:"twts"`
+	Replies       int         `json:"replies"`
+	ReplyRatio    float64     `json:"reply_ratio"`
+	FirstPostedAt time.Time   `json:"first_posted_at"`
+	LastPostedAt  time.Time   `json:"last_posted_at"`
+	TwtsPerWeek   []WeekCount `json:"twts_per_week"`
+	TopTags       []TagCount  `json:"top_tags"`
+	ComputedAt    time.Time   `json:"computed_at"`
+}
+
+// MaxWeekCount returns the largest number of twts in a week of the chart
+func (s *FeedStats) MaxWeekCount() int {
+	max := 0
+	for _, week := range s.TwtsPerWeek {
+		if week.Count > max {
+			max = week.Count
+		}
+	}
+	return max
+}
+
+// WeekPercent returns the number of twts of a week as a percentage of the
+// busiest week (the height of the week's bar in the chart)
+func (s *FeedStats) WeekPercent(week WeekCount) int {
+	if max := s.MaxWeekCount(); max > 0 {
+		return week.Count * 100 / max
+	}
+	return 0
+}
+
+// ReplyPercent returns the reply ratio as a percentage
+func (s *FeedStats) ReplyPercent() int {
+	return int(s.ReplyRatio*100 + 0.5)
+}
+
+// startOfWeek returns the start (Monday 00:00 UTC) of the week of t
+func startOfWeek(t time.Time) time.Time {
+	t = t.UTC()
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+}
+
+// ComputeFeedStats computes the statistics of a feed's twts as of now
+func ComputeFeedStats(twts types.Twts, now time.Time) *FeedStats {
+	stats := &FeedStats{Twts: len(twts), ComputedAt: now}
+
+	thisWeek := startOfWeek(now)
+	for i := feedStatsWeeks - 1; i >= 0; i-- {
+		stats.TwtsPerWeek = append(stats.TwtsPerWeek, WeekCount{Start: thisWeek.AddDate(0, 0, -7*i)})
+	}
+	firstWeek := stats.TwtsPerWeek[0].Start
+
+	tags := make(map[string]int)
+	for _, twt := range twts {
+		created := twt.Created()
+		if stats.FirstPostedAt.IsZero() || created.Before(stats.FirstPostedAt) {
+			stats.FirstPostedAt = created
+		}
+		if created.After(stats.LastPostedAt) {
+			stats.LastPostedAt = created
+		}
+
+		if week := startOfWeek(created); !week.Before(firstWeek) && !week.After(thisWeek) {
+			stats.TwtsPerWeek[int(week.Sub(firstWeek).Hours())/(7*24)].Count++
+		}
+
+		if hash := ExtractHashFromSubject(twt.Subject().String()); hash != "" && hash != twt.Hash() {
+			stats.Replies++
+		}
+
+		for _, tag := range GroupByTag(twt) {
+			tags[tag]++
+		}
+	}
+
+	if stats.Twts > 0 {
+		stats.ReplyRatio = float64(stats.Replies) / float64(stats.Twts)
+	}
+
+	for tag, count := range tags {
+		stats.TopTags = append(stats.TopTags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(stats.TopTags, func(i, j int) bool {
+		if stats.TopTags[i].Count == stats.TopTags[j].Count {
+			return stats.TopTags[i].Tag < stats.TopTags[j].Tag
+		}
+		return stats.TopTags[i].Count > stats.TopTags[j].Count
+	})
+	if len(stats.TopTags) > feedStatsTopTags {
+		stats.TopTags = stats.TopTags[:feedStatsTopTags]
+	}
+
+	return stats
+}
+
+// cachedFeedStats are the statistics of a feed and the state of the feed
+// they were computed for
+type cachedFeedStats struct {
+	stats   *FeedStats
+	nTwts   int
+	lastTwt string
+}
+
+// FeedStatsCache caches the statistics of feeds, computed lazily when a
+// feed's profile is viewed and recomputed when the feed changes or they are
+// older than feedStatsTTL
+type FeedStatsCache struct {
+	sync.RWMutex
+
+	feeds map[string]cachedFeedStats
+}
+
+// NewFeedStatsCache ...
+func NewFeedStatsCache() *FeedStatsCache {
+	return &FeedStatsCache{feeds: make(map[string]cachedFeedStats)}
+}
+
+// feedStats are the cached statistics of all feeds
+var feedStats = NewFeedStatsCache()
+
+// Get returns the statistics of a feed's twts (only the twts anonymous
+// visitors can see are counted)
+func (fs *FeedStatsCache) Get(conf *Config, uri string, twts types.Twts) *FeedStats {
+	var lastTwt string
+	if len(twts) > 0 {
+		lastTwt = twts[0].Hash()
+	}
+
+	fs.RLock()
+	cached, ok := fs.feeds[uri]
+	fs.RUnlock()
+
+	if ok && cached.nTwts == len(twts) && cached.lastTwt == lastTwt && time.Since(cached.stats.ComputedAt) < feedStatsTTL {
+		return cached.stats
+	}
+
+	public := make(types.Twts, 0, len(twts))
+	for _, twt := range twts {
+		if visibility.CanView(conf, nil, twt) {
+			public = append(public, twt)
+		}
+	}
+	stats := ComputeFeedStats(public, time.Now())
+
+	fs.Lock()
+	fs.feeds[uri] = cachedFeedStats{stats: stats, nTwts: len(twts), lastTwt: lastTwt}
+	fs.Unlock()
+
+	return stats
+}
+
+// FeedStatsRequest requests the statistics of a feed
+type FeedStatsRequest struct {
+	URL string `json:"url"`
+}
+
+// FeedStatsEndpoint returns the statistics of a feed
+func (a *API) FeedStatsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		var req FeedStatsRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.URL) == "" {
+			apiLogger(r).WithError(err).Error("error parsing feed stats request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		uri := strings.TrimSpace(req.URL)
+		if !a.cache.IsCached(uri) {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "Feed Not Found")
+			return
+		}
+
+		stats := feedStats.Get(a.config(), uri, a.cache.GetByURL(uri))
+
+		data, err := json.Marshal(stats)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing feed stats")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,42 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.yarn.social/types"
+)
+
+func TestComputeFeedStats(t *testing.T) {
+	assert := assert.New(t)
+
+	// Wednesday
+	now := time.Date(2021, 3, 17, 12, 0, 0, 0, time.UTC)
+
+	twts := types.Twts{
+		types.MakeTwt(testLocalTwter, now.Add(-time.Hour), "(#ygn7f4q) Nice! #go"),
+		types.MakeTwt(testLocalTwter, now.AddDate(0, 0, -2), "Hello #Go #yarn"),
+		types.MakeTwt(testLocalTwter, now.AddDate(0, 0, -7), "Last week #yarn"),
+		types.MakeTwt(testLocalTwter, now.AddDate(-1, 0, 0), "A year ago #go"),
+	}
+
+	stats := ComputeFeedStats(twts, now)
+
+	assert.Equal(4, stats.Twts)
+	assert.Equal(1, stats.Replies)
+	assert.Equal(25, stats.ReplyPercent())
+	assert.Equal(now.AddDate(-1, 0, 0), stats.FirstPostedAt)
+	assert.Equal(now.Add(-time.Hour), stats.LastPostedAt)
+
+	assert.Len(stats.TwtsPerWeek, feedStatsWeeks)
+	assert.Equal(time.Date(2021, 3, 15, 0, 0, 0, 0, time.UTC), stats.TwtsPerWeek[feedStatsWeeks-1].Start)
+	assert.Equal(2, stats.TwtsPerWeek[feedStatsWeeks-1].Count)
+	assert.Equal(1, stats.TwtsPerWeek[feedStatsWeeks-2].Count)
+	assert.Equal(50, stats.WeekPercent(stats.TwtsPerWeek[feedStatsWeeks-2]))
+
+	assert.Equal([]TagCount{{Tag: "go", Count: 3}, {Tag: "yarn", Count: 2}}, stats.TopTags)
+}
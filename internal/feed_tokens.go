@@ -0,0 +1,172 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+// maxPrivateFeedItems is the number of twts in a user's private feeds
+const maxPrivateFeedItems = 50
+
+// PrivateFeedURLs are the urls of a user's personal read-only feeds
+type PrivateFeedURLs struct {
+	Timeline  string
+	Bookmarks string
+}
+
+// GetPrivateFeedURLs returns the urls of the user's personal read-only feeds
+// (nil if disabled), the urls include the user's secret feed token
+func GetPrivateFeedURLs(conf *Config, user *User) *PrivateFeedURLs {
+	if user.FeedToken == "" {
+		return nil
+	}
+
+	baseURL := strings.TrimSuffix(conf.BaseURL, "/")
+
+	return &PrivateFeedURLs{
+		Timeline:  fmt.Sprintf("%s/user/%s/timeline.xml?token=%s", baseURL, user.Username, user.FeedToken),
+		Bookmarks: fmt.Sprintf("%s/user/%s/bookmarks.xml?token=%s", baseURL, user.Username, user.FeedToken),
+	}
+}
+
+// HasFeedToken returns true if token is the user's secret feed token
+func (u *User) HasFeedToken(token string) bool {
+	if u.FeedToken == "" || token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(u.FeedToken), []byte(token)) == 1
+}
+
+// feedTokenUser returns the user of a private feed request if the request's
+// token is the user's secret feed token
+func (s *Server) feedTokenUser(r *http.Request, p httprouter.Params) (*User, bool) {
+	nick := NormalizeUsername(p.ByName("nick"))
+	if !s.db.HasUser(nick) {
+		return nil, false
+	}
+
+	user, err := s.db.GetUser(nick)
+	if err != nil {
+		log.WithError(err).Errorf("error loading user object for %s", nick)
+		return nil, false
+	}
+
+	if !user.HasFeedToken(r.URL.Query().Get("token")) {
+		return nil, false
+	}
+
+	// Private feeds of suspended or disabled accounts are not served
+	if !user.IsActive() {
+		return nil, false
+	}
+
+	return user, true
+}
+
+// writePrivateFeed writes a user's private Atom feed, which must never be
+// cached by shared caches nor indexed
+func (s *Server) writePrivateFeed(w http.ResponseWriter, r *http.Request, user *User, title string, twts types.Twts) {
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Header().Set("X-Robots-Tag", "noindex, nofollow")
+
+	if len(twts) > maxPrivateFeedItems {
+		twts = twts[:maxPrivateFeedItems]
+	}
+
+	if r.Method == http.MethodHead {
+		defer r.Body.Close()
+		if len(twts) > 0 {
+			w.Header().Set("Last-Modified", twts[0].Created().Format(http.TimeFormat))
+		}
+		return
+	}
+
+	profile := user.Profile(s.config().BaseURL, user)
+
+	feed := &feeds.Feed{
+		Title:       title,
+		Link:        &feeds.Link{Href: profile.URI},
+		Description: profile.Description,
+		Author:      &feeds.Author{Name: profile.Nick},
+		Created:     time.Now(),
+	}
+
+	s.writeAtomFeed(w, feed, twts)
+}
+
+// PrivateTimelineFeedHandler serves the user's timeline as an Atom feed to
+// requests with the user's secret feed token
+func (s *Server) PrivateTimelineFeedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, ok := s.feedTokenUser(r, p)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		twts := s.getTimelineTwts(user)
+
+		s.writePrivateFeed(w, r, user, fmt.Sprintf("%s's Timeline", user.Username), twts)
+	}
+}
+
+// PrivateBookmarksFeedHandler serves the user's bookmarks as an Atom feed to
+// requests with the user's secret feed token
+func (s *Server) PrivateBookmarksFeedHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user, ok := s.feedTokenUser(r, p)
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Bookmarks of twts the user may no longer see (e.g: followers-only
+		// twts of feeds the user unfollowed) are left out
+		twts := visibility.Filter(s.config(), user, s.getBookmarkedTwts(StringKeys(user.Bookmarks)))
+
+		s.writePrivateFeed(w, r, user, fmt.Sprintf("%s's Bookmarks", user.Username), twts)
+	}
+}
+
+// SettingsFeedTokenHandler enables, regenerates or disables the user's
+// secret feed token (which also revokes the urls of the private feeds)
+func (s *Server) SettingsFeedTokenHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if r.FormValue("action") == "disable" {
+			user.FeedToken = ""
+		} else {
+			user.FeedToken = GenerateRandomToken()
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating feed token for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = s.tr(ctx, "MsgUpdateSettingsSuccess")
+		s.render("error", w, ctx)
+	}
+}
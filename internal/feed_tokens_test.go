@@ -0,0 +1,52 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yarn.social/types"
+)
+
+func TestPrivateBookmarksFeedVisibility(t *testing.T) {
+	s := newTestHandlerServer(t)
+
+	tv, err := NewTwtVisibility(s.config())
+	require.NoError(t, err)
+
+	oldVisibility := visibility
+	defer func() { visibility = oldVisibility }()
+	visibility = tv
+
+	bobURL := s.config().URLForUser("bob")
+	bob := types.NewTwter("bob", bobURL)
+
+	public := types.MakeTwt(bob, time.Now(), "Hello World!")
+	followers := types.MakeTwt(bob, time.Now(), "Hello followers!")
+	require.NoError(t, tv.Set(followers.Hash(), bobURL, VisibilityFollowers))
+
+	s.cache.InjectFeed(bobURL, public)
+	s.cache.InjectFeed(bobURL, followers)
+
+	// Alice bookmarked both twts but no longer follows bob
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = s.config().URLForUser(user.Username)
+	user.FeedToken = GenerateRandomToken()
+	user.Bookmarks = map[string]string{public.Hash(): "", followers.Hash(): ""}
+	require.NoError(t, s.db.SetUser(user.Username, user))
+
+	r := httptest.NewRequest(http.MethodGet, GetPrivateFeedURLs(s.config(), user).Bookmarks, nil)
+	w := httptest.NewRecorder()
+
+	privateFeedsRouter(s).ServeHTTP(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Hello World!")
+	assert.NotContains(t, w.Body.String(), "Hello followers!")
+}
@@ -10,6 +10,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
 )
 
 // FeedHandler ...
@@ -19,7 +20,7 @@ func (s *Server) FeedHandler() httprouter.Handle {
 
 		name := NormalizeFeedName(r.FormValue("name"))
 		trdata := map[string]interface{}{}
-		if err := ValidateFeedName(s.config.Data, name); err != nil {
+		if err := ValidateFeedName(s.config().Data, name); err != nil {
 			ctx.Error = true
 			trdata["Error"] = err.Error()
 			ctx.Message = s.tr(ctx, "ErrorInvalidFeedName", trdata)
@@ -27,7 +28,7 @@ func (s *Server) FeedHandler() httprouter.Handle {
 			return
 		}
 
-		if err := CreateFeed(s.config, s.db, ctx.User, name, false); err != nil {
+		if err := CreateFeed(s.config(), s.db, ctx.User, name, false); err != nil {
 			ctx.Error = true
 			trdata["Error"] = err.Error()
 			ctx.Message = s.tr(ctx, "ErrorCreateFeed", trdata)
@@ -35,7 +36,7 @@ func (s *Server) FeedHandler() httprouter.Handle {
 			return
 		}
 
-		ctx.User.Follow(name, URLForUser(s.config.BaseURL, name))
+		ctx.User.Follow(name, URLForUser(s.config().BaseURL, name))
 
 		if err := s.db.SetUser(ctx.Username, ctx.User); err != nil {
 			ctx.Error = true
@@ -56,16 +57,7 @@ func (s *Server) FeedHandler() httprouter.Handle {
 
 // FeedsHandler ...
 func (s *Server) FeedsHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
-	canManageFeed := func(feed string, u *User) bool {
-		if u.OwnsFeed(feed) {
-			return true
-		}
-		if IsSpecialFeed(feed) && isAdminUser(u) {
-			return true
-		}
-		return false
-	}
+	canManageFeed := CanManageFeedFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -78,7 +70,7 @@ func (s *Server) FeedsHandler() httprouter.Handle {
 			return
 		}
 
-		feedSources, err := LoadFeedSources(s.config.Data)
+		feedSources, err := LoadFeedSources(s.config().Data)
 		if err != nil {
 			ctx.Error = true
 			ctx.Message = s.tr(ctx, "ErrorLoadingFeeds")
@@ -102,7 +94,18 @@ func (s *Server) FeedsHandler() httprouter.Handle {
 		ctx.Title = s.tr(ctx, "PageFeedsTitle")
 		ctx.LocalFeeds = localFeeds
 		ctx.UserFeeds = userFeeds
-		ctx.FeedSources = feedSources.Sources
+
+		preview := func(uri string) types.Twt {
+			for _, twt := range s.cache.GetByURL(uri) {
+				if visibility.CanView(s.config(), ctx.User, twt) {
+					return twt
+				}
+			}
+			return nil
+		}
+		ctx.CuratedFeeds = CategorizeFeeds(FeedSourceMap{"": directory.List()}, preview)
+		ctx.FeedCategories = CategorizeFeeds(feedSources.Sources, preview)
+		ctx.FeedSourcesHealth = feedSources.Health
 
 		s.render("feeds", w, ctx)
 	}
@@ -110,16 +113,7 @@ func (s *Server) FeedsHandler() httprouter.Handle {
 
 // ManageFeedHandler...
 func (s *Server) ManageFeedHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
-	canManageFeed := func(feed string, u *User) bool {
-		if u.OwnsFeed(feed) {
-			return true
-		}
-		if IsSpecialFeed(feed) && isAdminUser(u) {
-			return true
-		}
-		return false
-	}
+	canManageFeed := CanManageFeedFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -155,7 +149,9 @@ func (s *Server) ManageFeedHandler() httprouter.Handle {
 		trdata := map[string]interface{}{}
 		switch r.Method {
 		case http.MethodGet:
-			ctx.Profile = feed.Profile(s.config.BaseURL, ctx.User)
+			ctx.Profile = feed.Profile(s.config().BaseURL, ctx.User)
+			ctx.HasBotToken = feed.HasBotToken()
+			ctx.BotPostURL = URLForBotPost(s.config().BaseURL, feed.Name)
 			trdata["Feed"] = feed.Name
 			ctx.Title = s.tr(ctx, "PageManageFeedTitle", trdata)
 			s.render("manageFeed", w, ctx)
@@ -164,6 +160,10 @@ func (s *Server) ManageFeedHandler() httprouter.Handle {
 			description := r.FormValue("description")
 			feed.Description = description
 
+			isAutomated := r.FormValue("automated") == "on"
+			reflag := isAutomated != feed.Automated
+			feed.Automated = isAutomated
+
 			avatarFile, _, err := r.FormFile("avatar_file")
 			if err != nil && err != http.ErrMissingFile {
 				log.WithError(err).Error("error parsing form file")
@@ -174,11 +174,11 @@ func (s *Server) ManageFeedHandler() httprouter.Handle {
 			if avatarFile != nil {
 				opts := &ImageOptions{
 					Resize: true,
-					Width:  s.config.AvatarResolution,
-					Height: s.config.AvatarResolution,
+					Width:  s.config().AvatarResolution,
+					Height: s.config().AvatarResolution,
 				}
 				_, err = StoreUploadedImage(
-					s.config, avatarFile,
+					s.config(), avatarFile,
 					avatarsDir, feedName,
 					opts,
 				)
@@ -189,7 +189,7 @@ func (s *Server) ManageFeedHandler() httprouter.Handle {
 					s.render("error", w, ctx)
 					return
 				}
-				avatarFn := filepath.Join(s.config.Data, avatarsDir, fmt.Sprintf("%s.png", feedName))
+				avatarFn := filepath.Join(s.config().Data, avatarsDir, fmt.Sprintf("%s.png", feedName))
 				if avatarHash, err := FastHashFile(avatarFn); err == nil {
 					feed.AvatarHash = avatarHash
 				} else {
@@ -206,6 +206,17 @@ func (s *Server) ManageFeedHandler() httprouter.Handle {
 				return
 			}
 
+			// Rebuild the Discover view with or without the feed's twts
+			automated.Flag(feed.URL, feed.Automated)
+			if reflag {
+				if _, err := s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityBackground, func() error {
+					s.cache.Refresh()
+					return nil
+				}); err != nil {
+					log.WithError(err).Warn("error submitting task to refresh cache")
+				}
+			}
+
 			ctx.Error = false
 			ctx.Message = s.tr(ctx, "MsgUpdateFeedSuccess")
 			s.render("error", w, ctx)
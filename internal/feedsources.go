@@ -7,26 +7,59 @@ import (
 	"bufio"
 	"bytes"
 	"encoding/gob"
+	"fmt"
+	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	sync "github.com/sasha-s/go-deadlock"
 	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
 )
 
 type FeedSource struct {
-	Name        string
-	URL         string
-	Avatar      string
-	Description string
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	Avatar      string `json:"avatar"`
+	Description string `json:"description"`
+
+	// Category is the (optional) category of the feed given as a 5th column
+	// of the feed source
+	Category string `json:"category,omitempty"`
 }
 
 type FeedSourceMap map[string][]FeedSource
 
+// FeedSourceHealth is the health of fetching a feed source
+type FeedSourceHealth struct {
+	// Feeds is the number of feeds listed by the source
+	Feeds int `json:"feeds"`
+
+	// LastFetchedAt is when the source was last fetched (successfully or not)
+	LastFetchedAt time.Time `json:"last_fetched_at"`
+
+	// LastUpdatedAt is when the source's listing last changed
+	LastUpdatedAt time.Time `json:"last_updated_at"`
+
+	// LastError is the error of the last fetch, empty if it succeeded
+	LastError string `json:"last_error,omitempty"`
+
+	// Hash is the hash of the source's listing to detect updates
+	Hash string `json:"-"`
+}
+
+// IsHealthy returns true if the last fetch of the source succeeded
+func (h FeedSourceHealth) IsHealthy() bool {
+	return h.LastError == ""
+}
+
 type FeedSources struct {
-	Sources FeedSourceMap `json:"sources"`
+	Sources FeedSourceMap               `json:"sources"`
+	Health  map[string]FeedSourceHealth `json:"health"`
 }
 
 func SaveFeedSources(feedsources *FeedSources, path string) error {
@@ -38,7 +71,7 @@ func SaveFeedSources(feedsources *FeedSources, path string) error {
 		return err
 	}
 
-	f, err := os.OpenFile(filepath.Join(path, "feedsources"), os.O_CREATE|os.O_WRONLY, 0666)
+	f, err := os.OpenFile(filepath.Join(path, "feedsources"), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0666)
 	if err != nil {
 		log.WithError(err).Error("error opening feed sources file for writing")
 		return err
@@ -56,6 +89,7 @@ func SaveFeedSources(feedsources *FeedSources, path string) error {
 func LoadFeedSources(path string) (*FeedSources, error) {
 	feedsources := &FeedSources{
 		Sources: make(FeedSourceMap),
+		Health:  make(map[string]FeedSourceHealth),
 	}
 
 	f, err := os.Open(filepath.Join(path, "feedsources"))
@@ -74,10 +108,15 @@ func LoadFeedSources(path string) (*FeedSources, error) {
 		log.WithError(err).Error("error decoding feed sources")
 		return nil, err
 	}
+	if feedsources.Health == nil {
+		feedsources.Health = make(map[string]FeedSourceHealth)
+	}
 	return feedsources, nil
 }
 
-func FetchFeedSources(conf *Config, sources []string) *FeedSources {
+// FetchFeedSources fetches the feed sources and records the health of each,
+// the previously fetched listing of a source is kept if fetching it fails
+func FetchFeedSources(conf *Config, sources []string, previous *FeedSources) *FeedSources {
 	var (
 		mu sync.RWMutex
 		wg sync.WaitGroup
@@ -85,6 +124,7 @@ func FetchFeedSources(conf *Config, sources []string) *FeedSources {
 
 	feedsources := &FeedSources{
 		Sources: make(FeedSourceMap),
+		Health:  make(map[string]FeedSourceHealth),
 	}
 
 	for _, url := range sources {
@@ -95,26 +135,38 @@ func FetchFeedSources(conf *Config, sources []string) *FeedSources {
 				wg.Done()
 			}()
 
-			res, err := RequestHTTP(conf, http.MethodGet, url, nil)
+			var (
+				prevFeeds  []FeedSource
+				prevHealth FeedSourceHealth
+			)
+			if previous != nil {
+				prevFeeds = previous.Sources[url]
+				prevHealth = previous.Health[url]
+			}
+
+			fs, hash, err := fetchFeedSource(conf, url)
+
+			health := prevHealth
+			health.LastFetchedAt = time.Now()
 			if err != nil {
 				log.WithError(err).Errorf("error fetching feedsource %s", url)
-				return
-			}
-			defer res.Body.Close()
-
-			switch res.StatusCode {
-			case http.StatusOK: // 200
-				scanner := bufio.NewScanner(res.Body)
-				fs, err := ParseFeedSource(scanner)
-				if err != nil {
-					log.WithError(err).Errorf("error parsing feed source: %s", url)
-					return
+				health.LastError = err.Error()
+				fs = prevFeeds
+			} else {
+				health.LastError = ""
+				if hash != prevHealth.Hash {
+					health.Hash = hash
+					health.LastUpdatedAt = health.LastFetchedAt
 				}
+			}
+			health.Feeds = len(fs)
 
-				mu.Lock()
+			mu.Lock()
+			if fs != nil {
 				feedsources.Sources[url] = fs
-				mu.Unlock()
 			}
+			feedsources.Health[url] = health
+			mu.Unlock()
 		}(url)
 	}
 
@@ -123,6 +175,32 @@ func FetchFeedSources(conf *Config, sources []string) *FeedSources {
 	return feedsources
 }
 
+// fetchFeedSource fetches and parses a feed source returning its feeds and
+// the hash of its listing
+func fetchFeedSource(conf *Config, url string) ([]FeedSource, string, error) {
+	res, err := RequestHTTP(conf, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("non-success HTTP %s response", res.Status)
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", err
+	}
+
+	fs, err := ParseFeedSource(bufio.NewScanner(bytes.NewReader(data)))
+	if err != nil {
+		return nil, "", err
+	}
+
+	return fs, FastHash(data), nil
+}
+
 func ParseFeedSource(scanner *bufio.Scanner) (feedsources []FeedSource, err error) {
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -134,14 +212,83 @@ func ParseFeedSource(scanner *bufio.Scanner) (feedsources []FeedSource, err erro
 		}
 
 		parts := strings.Split(line, "\t")
-		if len(parts) != 4 {
+		if len(parts) != 4 && len(parts) != 5 {
 			log.Warnf("could not parse: '%s'", line)
 			continue
 		}
-		feedsources = append(feedsources, FeedSource{parts[0], parts[1], parts[2], parts[3]})
+		feedsource := FeedSource{
+			Name:        parts[0],
+			URL:         parts[1],
+			Avatar:      parts[2],
+			Description: parts[3],
+		}
+		if len(parts) == 5 {
+			feedsource.Category = strings.TrimSpace(parts[4])
+		}
+		feedsources = append(feedsources, feedsource)
 	}
 	if err := scanner.Err(); err != nil {
 		return nil, err
 	}
 	return feedsources, nil
 }
+
+// FeedDirectoryEntry is a feed listed in the feed directory at /feeds with
+// the source that lists it and a preview of its latest twt (if cached)
+type FeedDirectoryEntry struct {
+	FeedSource
+
+	Source  string
+	Preview types.Twt
+}
+
+// FeedCategory is a category of the feed directory and its feeds
+type FeedCategory struct {
+	Name  string
+	Feeds []FeedDirectoryEntry
+}
+
+// CategorizeFeeds groups the feeds of the feed sources by category (sorted
+// by name with uncategorized feeds last), feeds listed by several sources
+// are listed once
+func CategorizeFeeds(sources FeedSourceMap, preview func(uri string) types.Twt) []FeedCategory {
+	var urls []string
+	for url := range sources {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	seen := make(map[string]bool)
+	categories := make(map[string][]FeedDirectoryEntry)
+	for _, url := range urls {
+		for _, feed := range sources[url] {
+			if seen[feed.URL] {
+				continue
+			}
+			seen[feed.URL] = true
+
+			entry := FeedDirectoryEntry{FeedSource: feed, Source: url}
+			if preview != nil {
+				entry.Preview = preview(feed.URL)
+			}
+			categories[feed.Category] = append(categories[feed.Category], entry)
+		}
+	}
+
+	var feedCategories []FeedCategory
+	for name, feeds := range categories {
+		sort.Slice(feeds, func(i, j int) bool {
+			return strings.ToLower(feeds[i].Name) < strings.ToLower(feeds[j].Name)
+		})
+		feedCategories = append(feedCategories, FeedCategory{Name: name, Feeds: feeds})
+	}
+	sort.Slice(feedCategories, func(i, j int) bool {
+		a, b := feedCategories[i].Name, feedCategories[j].Name
+		if a == "" || b == "" {
+			return b == ""
+		}
+		return strings.ToLower(a) < strings.ToLower(b)
+	})
+
+	return feedCategories
+}
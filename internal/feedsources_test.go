@@ -0,0 +1,73 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFeedSourceCategory(t *testing.T) {
+	feeds, err := ParseFeedSource(bufio.NewScanner(strings.NewReader(
+		"# Feeds\n" +
+			"news\thttps://example.com/news.txt\t\tThe News\n" +
+			"go\thttps://example.com/go.txt\t\tGo twts\tProgramming\n" +
+			"broken\thttps://example.com/broken.txt\n",
+	)))
+	require.NoError(t, err)
+	require.Len(t, feeds, 2)
+	assert.Equal(t, "", feeds[0].Category)
+	assert.Equal(t, "Programming", feeds[1].Category)
+}
+
+func TestCategorizeFeeds(t *testing.T) {
+	sources := FeedSourceMap{
+		"https://a.example.com/": {
+			{Name: "news", URL: "https://example.com/news.txt"},
+			{Name: "rust", URL: "https://example.com/rust.txt", Category: "Programming"},
+		},
+		"https://b.example.com/": {
+			{Name: "Go", URL: "https://example.com/go.txt", Category: "Programming"},
+			{Name: "rust", URL: "https://example.com/rust.txt", Category: "Programming"},
+			{Name: "art", URL: "https://example.com/art.txt", Category: "Art"},
+		},
+	}
+
+	categories := CategorizeFeeds(sources, nil)
+	require.Len(t, categories, 3)
+
+	// Categories by name with uncategorized feeds last
+	assert.Equal(t, "Art", categories[0].Name)
+	assert.Equal(t, "Programming", categories[1].Name)
+	assert.Equal(t, "", categories[2].Name)
+
+	// Feeds listed by several sources are listed once (by the first source)
+	require.Len(t, categories[1].Feeds, 2)
+	assert.Equal(t, "Go", categories[1].Feeds[0].Name)
+	assert.Equal(t, "rust", categories[1].Feeds[1].Name)
+	assert.Equal(t, "https://a.example.com/", categories[1].Feeds[1].Source)
+}
+
+func TestFeedDirectory(t *testing.T) {
+	conf := &Config{Data: t.TempDir()}
+	fd, err := NewFeedDirectory(conf)
+	require.NoError(t, err)
+
+	assert.Error(t, fd.Add(FeedSource{Name: "", URL: "https://example.com/twtxt.txt"}))
+	assert.Error(t, fd.Add(FeedSource{Name: "ftp", URL: "ftp://example.com/twtxt.txt"}))
+	require.NoError(t, fd.Add(FeedSource{Name: "example", URL: "https://example.com/twtxt.txt", Category: "Misc"}))
+
+	reloaded, err := NewFeedDirectory(conf)
+	require.NoError(t, err)
+	feeds := reloaded.List()
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "Misc", feeds[0].Category)
+
+	require.NoError(t, reloaded.Delete(feeds[0].URL))
+	assert.Empty(t, reloaded.List())
+}
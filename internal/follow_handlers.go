@@ -6,6 +6,7 @@ package internal
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net/http"
 	"regexp"
 	"strings"
@@ -28,6 +29,37 @@ func (s *Server) FollowHandler() httprouter.Handle {
 			return
 		}
 
+		// Remote follows from other pods are confirmed before following
+		if r.Method == "GET" && r.FormValue("remote") != "" {
+			ctx.Title = s.tr(ctx, "PageFollowTitle")
+			ctx.FollowNick = nick
+			ctx.FollowURL = strings.TrimSpace(r.FormValue("url"))
+			s.render("follow", w, ctx)
+			return
+		}
+
+		// Follow by nick@domain handle given as the url (or nick)
+		handle := strings.TrimSpace(r.FormValue("url"))
+		if _, _, ok := ParseHandle(handle); !ok {
+			handle = nick
+		}
+		if _, _, ok := ParseHandle(handle); ok {
+			resolvedNick, resolvedURL, err := s.handles.Resolve(handle)
+			if err != nil {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorResolveHandle", map[string]interface{}{
+					"Handle": handle,
+					"Error":  err.Error(),
+				})
+				s.render("error", w, ctx)
+				return
+			}
+			if nick == "" || nick == handle {
+				nick = resolvedNick
+			}
+			url = resolvedURL
+		}
+
 		if url == "" {
 			ctx.Error = true
 			ctx.Message = s.tr(ctx, "ErrorNoFeed")
@@ -37,12 +69,32 @@ func (s *Server) FollowHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
 		}
 		trdata := map[string]interface{}{}
 		trdata["Nick"] = nick
 		trdata["URL"] = url
-		if err := user.FollowAndValidate(s.config, nick, url); err != nil {
+
+		requested, err := RequestFollow(s.config(), s.db, user, url)
+		if err != nil {
+			ctx.Error = true
+			trdata["Error"] = err.Error()
+			ctx.Message = s.tr(ctx, "ErrorFollowAndValidate", trdata)
+			s.render("error", w, ctx)
+			return
+		}
+		if requested {
+			ctx.Error = false
+			ctx.Message = s.tr(ctx, "MsgFollowRequestSent", trdata)
+			s.render("error", w, ctx)
+			return
+		}
+
+		// External feeds never seen before are graylisted (See: Graylist)
+		seen := s.cache.IsCached(url)
+
+		if err := user.FollowAndValidate(s.config(), nick, url); err != nil {
 			ctx.Error = true
 			trdata["Error"] = err.Error()
 			ctx.Message = s.tr(ctx, "ErrorFollowAndValidate", trdata)
@@ -58,6 +110,12 @@ func (s *Server) FollowHandler() httprouter.Handle {
 			return
 		}
 
+		if !seen {
+			if err := graylist.Add(url, ctx.Username); err != nil {
+				log.WithError(err).Errorf("error graylisting feed %s", url)
+			}
+		}
+
 		s.cache.GetByUser(ctx.User, true)
 
 		ctx.Error = false
@@ -66,6 +124,38 @@ func (s *Server) FollowHandler() httprouter.Handle {
 	}
 }
 
+// RemoteFollowHandler redirects visitors from other pods to the /follow page
+// of their own pod prefilled to follow a feed of this pod
+func (s *Server) RemoteFollowHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		nick := strings.TrimSpace(r.FormValue("nick"))
+		url := NormalizeURL(r.FormValue("url"))
+		pod := strings.TrimSpace(r.FormValue("pod"))
+
+		if url == "" {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorNoFeed")
+			s.render("error", w, ctx)
+			return
+		}
+
+		redirectURL, err := RemoteFollowURL(pod, nick, url)
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorRemoteFollowPod", map[string]interface{}{
+				"Pod":   pod,
+				"Error": err.Error(),
+			})
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, redirectURL, http.StatusFound)
+	}
+}
+
 // ImportHandler ...
 func (s *Server) ImportHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -77,9 +167,22 @@ func (s *Server) ImportHandler() httprouter.Handle {
 			return
 		}
 
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
+		defer r.Body.Close()
+
 		feeds := r.FormValue("feeds")
 
-		if feeds == "" {
+		// OPML exported from RSS readers or other clients can be uploaded or pasted
+		var opml io.Reader
+		if f, _, err := r.FormFile("opml"); err == nil {
+			defer f.Close()
+			opml = f
+		} else if strings.HasPrefix(strings.TrimSpace(feeds), "<") {
+			opml = strings.NewReader(feeds)
+		}
+
+		if feeds == "" && opml == nil {
 			ctx.Error = true
 			ctx.Message = "Nothing to import!"
 			s.render("error", w, ctx)
@@ -88,13 +191,37 @@ func (s *Server) ImportHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
 		}
 
-		re := regexp.MustCompile(`(?P<nick>.*?)[: ](?P<url>.*)`)
-
 		imported := 0
 
+		if opml != nil {
+			entries, err := ParseOPML(opml)
+			if err != nil {
+				log.WithError(err).Error("error parsing opml for import")
+				ctx.Error = true
+				ctx.Message = "Error importing feeds"
+				s.render("error", w, ctx)
+				return
+			}
+
+			// TODO: Map categories to lists once users can organise feeds into lists
+			for _, entry := range entries {
+				if entry.Nick != "" && entry.URL != "" {
+					if requested, _ := RequestFollow(s.config(), s.db, user, entry.URL); !requested {
+						user.Follow(entry.Nick, entry.URL)
+					}
+					imported++
+				}
+			}
+
+			feeds = ""
+		}
+
+		re := regexp.MustCompile(`(?P<nick>.*?)[: ](?P<url>.*)`)
+
 		scanner := bufio.NewScanner(strings.NewReader(feeds))
 		for scanner.Scan() {
 			line := scanner.Text()
@@ -103,7 +230,9 @@ func (s *Server) ImportHandler() httprouter.Handle {
 				nick := strings.TrimSpace(matches[1])
 				url := NormalizeURL(strings.TrimSpace(matches[2]))
 				if nick != "" && url != "" {
-					user.Follow(nick, url)
+					if requested, _ := RequestFollow(s.config(), s.db, user, url); !requested {
+						user.Follow(nick, url)
+					}
 					imported++
 				}
 			}
@@ -131,6 +260,30 @@ func (s *Server) ImportHandler() httprouter.Handle {
 	}
 }
 
+// ExportOPMLHandler exports the feeds the user follows as OPML
+func (s *Server) ExportOPMLHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		data, err := ExportOPML(s.config(), user)
+		if err != nil {
+			log.WithError(err).Errorf("error exporting opml for %s", user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/x-opml; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.opml"`, user.Username))
+		_, _ = w.Write(data)
+	}
+}
+
 // UnfollowHandler ...
 func (s *Server) UnfollowHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -147,7 +300,8 @@ func (s *Server) UnfollowHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
 		}
 		trdata := map[string]interface{}{}
 		url, ok := user.Following[nick]
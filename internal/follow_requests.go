@@ -0,0 +1,214 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrFollowRequestNotFound is returned when approving or denying a follow
+	// request that does not exist
+	ErrFollowRequestNotFound = errors.New("error: follow request not found")
+)
+
+// FollowRequest is a pending request to follow a protected account
+type FollowRequest struct {
+	Nick string `json:"nick"`
+	URL  string `json:"url"`
+}
+
+// GetFollowRequests returns the pending follow requests of a user sorted by nick
+func GetFollowRequests(user *User) []FollowRequest {
+	requests := make([]FollowRequest, 0, len(user.FollowRequests))
+	for nick, url := range user.FollowRequests {
+		requests = append(requests, FollowRequest{Nick: nick, URL: url})
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Nick < requests[j].Nick
+	})
+	return requests
+}
+
+// RequestFollow queues a follow request if the url is the feed of a protected
+// local account the follower is not yet approved to follow. It returns true if
+// a request was queued and the follower must wait for approval.
+func RequestFollow(conf *Config, db Store, follower *User, url string) (bool, error) {
+	if !conf.IsLocalURL(url) {
+		return false, nil
+	}
+
+	target, err := GetUserFromURL(conf, db, url)
+	if err != nil {
+		// Not a user (e.g: a feed)
+		return false, nil
+	}
+
+	if !target.Protected || target.Is(follower.URL) || target.FollowedBy(follower.URL) {
+		return false, nil
+	}
+
+	target.AddFollowRequest(follower.Username, follower.URL)
+	if err := db.SetUser(target.Username, target); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ApproveFollowRequest approves a pending follow request of a user and, if the
+// follower is a local user, completes the follow on their behalf
+func ApproveFollowRequest(conf *Config, db Store, user *User, nick string) error {
+	url, ok := user.FollowRequests[nick]
+	if !ok {
+		return ErrFollowRequestNotFound
+	}
+
+	user.AddFollower(nick, url)
+	user.RemoveFollowRequest(nick)
+
+	if err := db.SetUser(user.Username, user); err != nil {
+		return err
+	}
+
+	visibility.Protect(user)
+
+	if follower, err := GetUserFromURL(conf, db, url); err == nil {
+		if err := follower.Follow(user.Username, user.URL); err != nil {
+			return err
+		}
+		if err := db.SetUser(follower.Username, follower); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DenyFollowRequest removes a pending follow request of a user
+func DenyFollowRequest(db Store, user *User, nick string) error {
+	if _, ok := user.FollowRequests[nick]; !ok {
+		return ErrFollowRequestNotFound
+	}
+
+	user.RemoveFollowRequest(nick)
+
+	return db.SetUser(user.Username, user)
+}
+
+// FollowRequestsHandler lists the user's pending follow requests
+func (s *Server) FollowRequestsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		ctx.Title = s.tr(ctx, "FollowRequestsTitle")
+		ctx.FollowRequests = GetFollowRequests(user)
+		s.render("followRequests", w, ctx)
+	}
+}
+
+// FollowRequestHandler approves or denies a pending follow request
+func (s *Server) FollowRequestHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		nick := strings.TrimSpace(r.FormValue("nick"))
+
+		var err error
+		if r.FormValue("action") == "deny" {
+			err = DenyFollowRequest(s.db, user, nick)
+		} else {
+			err = ApproveFollowRequest(s.config(), s.db, user, nick)
+		}
+
+		if err != nil {
+			log.WithError(err).Errorf("error updating follow request from %s for %s", nick, user.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorFollowRequest")
+			s.render("error", w, ctx)
+			return
+		}
+
+		s.cache.GetByUser(user, true)
+
+		http.Redirect(w, r, "/follow-requests", http.StatusFound)
+	}
+}
+
+// FollowRequestsEndpoint lists the pending follow requests of the user
+func (a *API) FollowRequestsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		data, err := json.Marshal(GetFollowRequests(user))
+		if err != nil {
+			log.WithError(err).Error("error serializing follow requests")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// FollowRequestEndpoint approves (or with "action": "deny" denies) a pending
+// follow request of the user
+func (a *API) FollowRequestEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		var req struct {
+			Nick   string `json:"nick"`
+			Action string `json:"action"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			log.WithError(err).Error("error parsing follow request action")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if req.Action == "deny" {
+			err = DenyFollowRequest(a.db, user, req.Nick)
+		} else {
+			err = ApproveFollowRequest(a.config(), a.db, user, req.Nick)
+		}
+
+		if err != nil {
+			if err == ErrFollowRequestNotFound {
+				http.Error(w, "Follow Request Not Found", http.StatusNotFound)
+				return
+			}
+			log.WithError(err).Errorf("error updating follow request from %s for %s", req.Nick, user.Username)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		a.cache.GetByUser(user, true)
+
+		// No real response
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{}`))
+	}
+}
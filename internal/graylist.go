@@ -0,0 +1,173 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+const graylistFile = "graylist.json"
+
+// GraylistEntry is an external feed on the graylist
+type GraylistEntry struct {
+	URL     string    `json:"url"`
+	AddedBy string    `json:"added_by"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Graylist is a lightweight antispam measure: external feeds never seen
+// before by the pod are graylisted when first followed. Graylisted feeds are
+// fetched as usual but are kept out of the Pod's Discover timeline until they
+// have been known for GraylistMinAge and have at least GraylistMinTwts cached
+// twts, or until a poderator approves them. The graylist is persisted in the
+// data directory. A nil *Graylist graylists nothing.
+type Graylist struct {
+	sync.RWMutex
+
+	conf  *Config
+	feeds map[string]GraylistEntry
+}
+
+// NewGraylist ...
+func NewGraylist(conf *Config) (*Graylist, error) {
+	gl := &Graylist{
+		conf:  conf,
+		feeds: make(map[string]GraylistEntry),
+	}
+
+	data, err := ioutil.ReadFile(gl.filename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return gl, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &gl.feeds); err != nil {
+		return nil, err
+	}
+
+	return gl, nil
+}
+
+func (gl *Graylist) filename() string {
+	return filepath.Join(gl.conf.Data, graylistFile)
+}
+
+func (gl *Graylist) save() error {
+	data, err := json.Marshal(gl.feeds)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(gl.filename(), data, 0644)
+}
+
+// Add graylists an external feed first followed by the given user
+func (gl *Graylist) Add(url, by string) error {
+	if gl == nil || gl.conf.IsLocalURL(url) {
+		return nil
+	}
+
+	url = NormalizeURL(url)
+
+	gl.Lock()
+	defer gl.Unlock()
+
+	if _, ok := gl.feeds[url]; ok {
+		return nil
+	}
+	gl.feeds[url] = GraylistEntry{URL: url, AddedBy: by, AddedAt: time.Now()}
+
+	return gl.save()
+}
+
+// Approve removes a feed from the graylist
+func (gl *Graylist) Approve(url string) error {
+	if gl == nil {
+		return nil
+	}
+
+	url = NormalizeURL(url)
+
+	gl.Lock()
+	defer gl.Unlock()
+
+	if _, ok := gl.feeds[url]; !ok {
+		return nil
+	}
+	delete(gl.feeds, url)
+
+	return gl.save()
+}
+
+// Has returns true if the feed is on the graylist (matured or not)
+func (gl *Graylist) Has(url string) bool {
+	if gl == nil {
+		return false
+	}
+
+	gl.RLock()
+	defer gl.RUnlock()
+
+	_, ok := gl.feeds[NormalizeURL(url)]
+	return ok
+}
+
+// Graylisted returns true if the feed is graylisted and has not yet matured,
+// that is been known for long enough and with enough twts (ntwts cached)
+func (gl *Graylist) Graylisted(url string, ntwts int) bool {
+	if gl == nil {
+		return false
+	}
+
+	gl.RLock()
+	defer gl.RUnlock()
+
+	entry, ok := gl.feeds[NormalizeURL(url)]
+	if !ok {
+		return false
+	}
+
+	return time.Since(entry.AddedAt) < gl.conf.GraylistMinAge || ntwts < gl.conf.GraylistMinTwts
+}
+
+// Entries returns the feeds on the graylist, most recently added first
+func (gl *Graylist) Entries() []GraylistEntry {
+	if gl == nil {
+		return nil
+	}
+
+	gl.RLock()
+	defer gl.RUnlock()
+
+	var entries []GraylistEntry
+	for _, entry := range gl.feeds {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].AddedAt.After(entries[j].AddedAt) })
+
+	return entries
+}
+
+// isGraylisted returns true if a feed is graylisted and its twts must be
+// kept out of the Pod's Discover timeline
+func (cache *Cache) isGraylisted(uri string) bool {
+	if !graylist.Has(uri) {
+		return false
+	}
+
+	var ntwts int
+	if cached, ok := cache.Feeds.Get(uri); ok {
+		ntwts = len(cached.GetTwts())
+	}
+
+	return graylist.Graylisted(uri, ntwts)
+}
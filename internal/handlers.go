@@ -38,6 +38,14 @@ func (s *Server) NotFoundHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Custom pages are served at /<name>
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		if page, ok := customPages.Get(strings.TrimPrefix(r.URL.Path, "/")); ok {
+			s.PageHandler(page.Name)(w, r, nil)
+			return
+		}
+	}
+
 	ctx := NewContext(s, r)
 	ctx.Title = s.tr(ctx, "PageNotFoundTitle")
 	w.WriteHeader(http.StatusNotFound)
@@ -129,12 +137,12 @@ func (s *Server) AvatarHandler() httprouter.Handle {
 			return
 		}
 
-		if !s.db.HasUser(nick) && !FeedExists(s.config, nick) {
+		if !s.db.HasUser(nick) && !FeedExists(s.config(), nick) {
 			http.Error(w, "User or Feed Not Found", http.StatusNotFound)
 			return
 		}
 
-		fn, err := securejoin.SecureJoin(filepath.Join(s.config.Data, avatarsDir), fmt.Sprintf("%s.png", nick))
+		fn, err := securejoin.SecureJoin(filepath.Join(s.config().Data, avatarsDir), fmt.Sprintf("%s.png", nick))
 		if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
@@ -147,7 +155,12 @@ func (s *Server) AvatarHandler() httprouter.Handle {
 			return
 		}
 
-		etag := fmt.Sprintf("W/\"%s\"", r.RequestURI)
+		style, seed := AvatarStyleIdenticon, ""
+		if user, err := s.db.GetUser(nick); err == nil {
+			style, seed = user.AvatarStyle, user.AvatarSeed
+		}
+
+		etag := fmt.Sprintf("W/\"%s-%s-%s\"", r.RequestURI, style, seed)
 
 		if match := r.Header.Get("If-None-Match"); match != "" {
 			if strings.Contains(match, etag) {
@@ -161,7 +174,7 @@ func (s *Server) AvatarHandler() httprouter.Handle {
 			return
 		}
 
-		img, err := GenerateAvatar(s.config, nick)
+		img, err := GenerateAvatarWithStyle(s.config(), style, nick, seed)
 		if err != nil {
 			log.WithError(err).Errorf("error generating avatar for %s", nick)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -206,7 +219,7 @@ func (s *Server) LookupHandler() httprouter.Handle {
 		if len(prefix) > 0 {
 			for nick, url := range user.Following {
 				if strings.HasPrefix(strings.ToLower(nick), prefix) {
-					avatar, domain := GetLookupMatches(s.config, nick, url)
+					avatar, domain := GetLookupMatches(s.config(), nick, url)
 					matches = append(matches, struct {
 						Nick   string
 						Avatar string
@@ -216,7 +229,22 @@ func (s *Server) LookupHandler() httprouter.Handle {
 			}
 		} else {
 			for nick, url := range user.Following {
-				avatar, domain := GetLookupMatches(s.config, nick, url)
+				avatar, domain := GetLookupMatches(s.config(), nick, url)
+				matches = append(matches, struct {
+					Nick   string
+					Avatar string
+					Domain string
+				}{nick, avatar, domain})
+			}
+		}
+
+		// Resolve nick@domain handles of feeds not followed (yet)
+		if nick, handleDomain, ok := ParseHandle(prefix); ok {
+			if _, uri, err := s.handles.Resolve(prefix); err == nil && !user.Follows(uri) {
+				avatar, domain := GetLookupMatches(s.config(), nick, uri)
+				if domain == "" {
+					domain = handleDomain
+				}
 				matches = append(matches, struct {
 					Nick   string
 					Avatar string
@@ -260,7 +288,7 @@ func (s *Server) FollowersHandler() httprouter.Handle {
 				s.render("401", w, ctx)
 				return
 			}
-			profile = user.Profile(s.config.BaseURL, ctx.User)
+			profile = user.Profile(s.config().BaseURL, ctx.User)
 		} else if s.db.HasFeed(nick) {
 			feed, err := s.db.GetFeed(nick)
 			if err != nil {
@@ -270,7 +298,7 @@ func (s *Server) FollowersHandler() httprouter.Handle {
 				s.render("error", w, ctx)
 				return
 			}
-			profile = feed.Profile(s.config.BaseURL, ctx.User)
+			profile = feed.Profile(s.config().BaseURL, ctx.User)
 		} else {
 			ctx.Error = true
 			ctx.Message = s.tr(ctx, "ErrorUserOrFeedNotFound")
@@ -325,7 +353,7 @@ func (s *Server) FollowingHandler() httprouter.Handle {
 				s.render("401", w, ctx)
 				return
 			}
-			ctx.Profile = user.Profile(s.config.BaseURL, ctx.User)
+			ctx.Profile = user.Profile(s.config().BaseURL, ctx.User)
 		} else {
 			ctx.Error = true
 			ctx.Message = s.tr(ctx, "ErrorUserNotFound")
@@ -394,7 +422,7 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 		if nick != "" {
 			if s.db.HasUser(nick) {
 				if user, err := s.db.GetUser(nick); err == nil {
-					profile = user.Profile(s.config.BaseURL, nil)
+					profile = user.Profile(s.config().BaseURL, nil)
 					twts = s.cache.GetByURL(profile.URI)
 				} else {
 					log.WithError(err).Error("error loading user object")
@@ -403,7 +431,7 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 				}
 			} else if s.db.HasFeed(nick) {
 				if feed, err := s.db.GetFeed(nick); err == nil {
-					profile = feed.Profile(s.config.BaseURL, nil)
+					profile = feed.Profile(s.config().BaseURL, nil)
 					twts = s.cache.GetByURL(profile.URI)
 				} else {
 					log.WithError(err).Error("error loading user object")
@@ -419,9 +447,9 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 
 			profile = types.Profile{
 				Type:        "Local",
-				Nick:        s.config.Name,
-				Description: s.config.Description,
-				URI:         s.config.BaseURL,
+				Nick:        s.config().Name,
+				Description: s.config().Description,
+				URI:         s.config().BaseURL,
 			}
 		}
 
@@ -431,6 +459,8 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 			return
 		}
 
+		twts = visibility.Federated(visibility.Filter(s.config(), nil, twts))
+
 		if r.Method == http.MethodHead {
 			defer r.Body.Close()
 			if len(twts) > 0 {
@@ -446,7 +476,7 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 		// feed author.email
 		email := ""
 		if nick == "" {
-			email = s.config.AdminEmail
+			email = s.config().AdminEmail
 		}
 		// main feed
 		feed := &feeds.Feed{
@@ -456,45 +486,50 @@ func (s *Server) SyndicationHandler() httprouter.Handle {
 			Author:      &feeds.Author{Name: profile.Nick, Email: email},
 			Created:     now,
 		}
-		// feed items
-		var items []*feeds.Item
-
-		for _, twt := range twts {
-			url := URLForTwt(s.config.BaseURL, twt.Hash())
-			what := twt.FormatText(types.TextFmt, s.config)
-			title := TextWithEllipsis(what, maxPermalinkTitle)
-			items = append(items, &feeds.Item{
-				Id:          url,
-				Title:       title,
-				Link:        &feeds.Link{Href: url},
-				Author:      &feeds.Author{Name: twt.Twter().DomainNick()},
-				Description: twt.FormatText(types.HTMLFmt, s.config),
-				Created:     twt.Created(),
-			},
-			)
-		}
-		feed.Items = items
-
-		w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
-		data, err := feed.ToAtom()
-		if err != nil {
-			log.WithError(err).Error("error serializing feed")
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-			return
-		}
 
-		_, _ = w.Write([]byte(data))
+		s.writeAtomFeed(w, feed, twts)
 	}
 }
 
+// writeAtomFeed writes an Atom feed with an item for each of the twts
+func (s *Server) writeAtomFeed(w http.ResponseWriter, feed *feeds.Feed, twts types.Twts) {
+	var items []*feeds.Item
+
+	for _, twt := range twts {
+		url := URLForTwt(s.config().BaseURL, twt.Hash())
+		what := twt.FormatText(types.TextFmt, s.config())
+		title := TextWithEllipsis(what, maxPermalinkTitle)
+		items = append(items, &feeds.Item{
+			Id:          url,
+			Title:       title,
+			Link:        &feeds.Link{Href: url},
+			Author:      &feeds.Author{Name: twt.Twter().DomainNick()},
+			Description: twt.FormatText(types.HTMLFmt, s.config()),
+			Created:     twt.Created(),
+		},
+		)
+	}
+	feed.Items = items
+
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	data, err := feed.ToAtom()
+	if err != nil {
+		log.WithError(err).Error("error serializing feed")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	_, _ = w.Write([]byte(data))
+}
+
 // PodInfoHandler ...
 func (s *Server) PodInfoHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		if r.Header.Get("Accept") == "application/json" {
 			data, err := json.Marshal(Peer{
-				Name:            s.config.Name,
-				Description:     s.config.Description,
-				SoftwareVersion: s.config.Version.FullVersion,
+				Name:            s.config().Name,
+				Description:     s.config().Description,
+				SoftwareVersion: s.config().Version.FullVersion,
 			})
 			if err != nil {
 				log.WithError(err).Error("error serializing pod version response")
@@ -514,7 +549,7 @@ func (s *Server) PodInfoHandler() httprouter.Handle {
 // PodConfigHandler ...
 func (s *Server) PodConfigHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		data, err := json.Marshal(s.config)
+		data, err := json.Marshal(s.config())
 		if err != nil {
 			log.WithError(err).Error("error serializing pod config response")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -526,160 +561,50 @@ func (s *Server) PodConfigHandler() httprouter.Handle {
 	}
 }
 
-// DeleteHandler ...
+// DeleteHandler deactivates the user's account and schedules it to be purged
+// after the deletion grace period (or deletes it immediately if there is none)
 func (s *Server) DeleteHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
 
-		// Get all user feeds
-		feeds, err := s.db.GetAllFeeds()
-		if err != nil {
-			ctx.Error = true
-			ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-			s.render("error", w, ctx)
-			return
-		}
-
-		for _, feed := range feeds {
-			// Get user's owned feeds
-			if ctx.User.OwnsFeed(feed.Name) {
-				// Get twts in a feed
-				nick := feed.Name
-				if nick != "" {
-					if s.db.HasFeed(nick) {
-						// Fetch feed twts
-						twts, err := GetAllTwts(s.config, nick)
-						if err != nil {
-							ctx.Error = true
-							ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-							s.render("error", w, ctx)
-							return
-						}
-
-						// Parse twts to search and remove uploaded media
-						for _, twt := range twts {
-							// Delete archived twts
-							if err := s.archive.Del(twt.Hash()); err != nil {
-								ctx.Error = true
-								ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-								s.render("error", w, ctx)
-								return
-							}
-
-							mediaPaths := GetMediaNamesFromText(fmt.Sprintf("%t", twt))
-
-							// Remove all uploaded media in a twt
-							for _, mediaPath := range mediaPaths {
-								// Delete .png
-								fn := filepath.Join(s.config.Data, mediaDir, fmt.Sprintf("%s.png", mediaPath))
-								if FileExists(fn) {
-									if err := os.Remove(fn); err != nil {
-										ctx.Error = true
-										ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-										s.render("error", w, ctx)
-										return
-									}
-								}
-							}
-						}
-					}
-				}
-
-				// Delete feed
-				if err := s.db.DelFeed(nick); err != nil {
-					ctx.Error = true
-					ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-					s.render("error", w, ctx)
-					return
-				}
-
-				// Delete feeds's twtxt.txt
-				fn := filepath.Join(s.config.Data, feedsDir, nick)
-				if FileExists(fn) {
-					if err := os.Remove(fn); err != nil {
-						log.WithError(err).Error("error removing feed")
-						ctx.Error = true
-						ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-						s.render("error", w, ctx)
-					}
-				}
-
-				// Delete feed from cache
-				s.cache.DeleteFeeds(feed.Source())
-			}
-		}
-
-		// Get user's primary feed twts
-		twts, err := GetAllTwts(s.config, ctx.User.Username)
-		if err != nil {
-			ctx.Error = true
-			ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-			s.render("error", w, ctx)
-			return
-		}
-
-		// Parse twts to search and remove primary feed uploaded media
-		for _, twt := range twts {
-			// Delete archived twts
-			if err := s.archive.Del(twt.Hash()); err != nil {
+		if s.config().DeletionGracePeriod > 0 {
+			if err := ctx.User.SetAccountState(AccountPendingDeletion, "deleted by user"); err != nil {
 				ctx.Error = true
 				ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
 				s.render("error", w, ctx)
 				return
 			}
 
-			mediaPaths := GetMediaNamesFromText(fmt.Sprintf("%t", twt))
-
-			// Remove all uploaded media in a twt
-			for _, mediaPath := range mediaPaths {
-				// Delete .png
-				fn := filepath.Join(s.config.Data, mediaDir, fmt.Sprintf("%s.png", mediaPath))
-				if FileExists(fn) {
-					if err := os.Remove(fn); err != nil {
-						log.WithError(err).Error("error removing media")
-						ctx.Error = true
-						ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-						s.render("error", w, ctx)
-					}
-				}
-			}
-		}
-
-		// Delete user's primary feed
-		if err := s.db.DelFeed(ctx.User.Username); err != nil {
-			ctx.Error = true
-			ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
-			s.render("error", w, ctx)
-			return
-		}
-
-		// Delete user's twtxt.txt
-		fn := filepath.Join(s.config.Data, feedsDir, ctx.User.Username)
-		if FileExists(fn) {
-			if err := os.Remove(fn); err != nil {
-				log.WithError(err).Error("error removing user's feed")
+			if err := s.db.SetUser(ctx.Username, ctx.User); err != nil {
+				log.WithError(err).Errorf("error saving user object for %s", ctx.Username)
 				ctx.Error = true
 				ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
 				s.render("error", w, ctx)
+				return
 			}
-		}
 
-		// Delete user
-		if err := s.db.DelUser(ctx.Username); err != nil {
+			if err := audit.Record(ctx.Username, "schedule deletion", ctx.Username, ""); err != nil {
+				log.WithError(err).Error("error recording audit entry")
+			}
+		} else if err := PurgeUser(s.config(), s.cache, s.archive, s.db, ctx.User); err != nil {
+			log.WithError(err).Errorf("error deleting account %s", ctx.Username)
 			ctx.Error = true
 			ctx.Message = s.tr(ctx, "ErrorDeletingAccount")
 			s.render("error", w, ctx)
 			return
 		}
 
-		// Delete user's feed from cache
-		s.cache.DeleteFeeds(ctx.User.Source())
-
 		s.sm.Delete(w, r)
 		ctx.Authenticated = false
 
 		ctx.Error = false
-		ctx.Message = s.tr(ctx, "MsgDeleteAccountSuccess")
+		if s.config().DeletionGracePeriod > 0 {
+			ctx.Message = s.tr(ctx, "MsgDeleteAccountScheduled", map[string]interface{}{
+				"DeleteAt": ctx.User.DeletionScheduledAt(s.config()).Format(time.RFC1123),
+			})
+		} else {
+			ctx.Message = s.tr(ctx, "MsgDeleteAccountSuccess")
+		}
 		s.render("error", w, ctx)
 	}
 }
@@ -0,0 +1,56 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestHandlerServer returns a server with a config and store sufficient
+// to test handlers that authenticate requests themselves
+func newTestHandlerServer(t *testing.T) *Server {
+	conf := NewConfig()
+	conf.Data = t.TempDir()
+	conf.APISigningKey = GenerateRandomToken()
+	conf.MagicLinkSecret = GenerateRandomToken()
+	conf.MaxUploadSize = DefaultMaxUploadSize
+	require.NoError(t, WithBaseURL("http://example.com")(conf))
+
+	db, err := NewStore(fmt.Sprintf("bitcask://%s", filepath.Join(conf.Data, "yarn.db")))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+
+	s := &Server{db: db, cache: NewCache(conf), tasks: NewDispatcher(1, 1)}
+	s.liveConfig.Store(conf)
+
+	return s
+}
+
+// testIndieAuthToken returns an IndieAuth access token for the user
+func testIndieAuthToken(t *testing.T, conf *Config, username, scope string) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"typ":       indieAuthTokenType,
+		"username":  username,
+		"client_id": "https://client.example.org/",
+		"scope":     scope,
+		"exp":       time.Now().Add(time.Hour).Unix(),
+	})
+	tokenString, err := token.SignedString(indieAuthSigningKey(conf))
+	require.NoError(t, err)
+	return tokenString
+}
+
+// privateFeedsRouter routes the private feeds as the server does
+func privateFeedsRouter(s *Server) *Router {
+	router := NewRouter()
+	router.GET("/user/:nick/timeline.xml", s.PrivateTimelineFeedHandler())
+	router.GET("/user/:nick/bookmarks.xml", s.PrivateBookmarksFeedHandler())
+	return router
+}
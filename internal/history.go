@@ -0,0 +1,161 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+const (
+	historyDir = "history"
+)
+
+// TwtRevision is a previous version of an edited twt
+type TwtRevision struct {
+	Hash     string    `json:"hash"`
+	Text     string    `json:"text"`
+	EditedAt time.Time `json:"edited_at"`
+}
+
+// TwtHistory is the edit and deletion history of a local twt
+type TwtHistory struct {
+	Hash string `json:"hash"`
+
+	// Revisions are the previous versions of the twt, oldest first
+	Revisions []TwtRevision `json:"revisions,omitempty"`
+
+	// ReplacedBy is the hash of the twt this twt was edited into
+	ReplacedBy string `json:"replaced_by,omitempty"`
+
+	// DeletedAt is when the twt was deleted by its author
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// Edited returns true if the twt is the result of one or more edits
+func (h *TwtHistory) Edited() bool {
+	return h != nil && len(h.Revisions) > 0
+}
+
+// Deleted returns true if the twt was deleted by its author
+func (h *TwtHistory) Deleted() bool {
+	return h != nil && h.DeletedAt != nil
+}
+
+// EditHistory records the history of edited and deleted local twts in the
+// data directory so that the permalinks of edited-away or deleted twts point
+// to their replacement (or tombstone) instead of serving stale content.
+// A nil *EditHistory records nothing.
+type EditHistory struct {
+	sync.RWMutex
+
+	conf *Config
+}
+
+// NewEditHistory ...
+func NewEditHistory(conf *Config) (*EditHistory, error) {
+	h := &EditHistory{conf: conf}
+	if err := os.MkdirAll(h.dir(), 0755); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+func (eh *EditHistory) dir() string {
+	return filepath.Join(eh.conf.Data, historyDir)
+}
+
+func (eh *EditHistory) filename(hash string) string {
+	return filepath.Join(eh.dir(), fmt.Sprintf("%s.json", filepath.Base(hash)))
+}
+
+func (eh *EditHistory) get(hash string) (*TwtHistory, bool) {
+	data, err := ioutil.ReadFile(eh.filename(hash))
+	if err != nil {
+		return nil, false
+	}
+
+	var h TwtHistory
+	if err := json.Unmarshal(data, &h); err != nil {
+		return nil, false
+	}
+
+	return &h, true
+}
+
+func (eh *EditHistory) set(h *TwtHistory) error {
+	data, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(eh.filename(h.Hash), data, 0644)
+}
+
+// Get returns the history of the twt with the given hash if it has any
+func (eh *EditHistory) Get(hash string) (*TwtHistory, bool) {
+	if eh == nil {
+		return nil, false
+	}
+
+	eh.RLock()
+	defer eh.RUnlock()
+
+	return eh.get(hash)
+}
+
+// RecordEdit records that twt old was edited and replaced by twt new
+func (eh *EditHistory) RecordEdit(old, new types.Twt) error {
+	if eh == nil || old.Hash() == new.Hash() {
+		return nil
+	}
+
+	eh.Lock()
+	defer eh.Unlock()
+
+	prev, ok := eh.get(old.Hash())
+	if !ok {
+		prev = &TwtHistory{Hash: old.Hash()}
+	}
+
+	revisions := append([]TwtRevision{}, prev.Revisions...)
+	revisions = append(revisions, TwtRevision{
+		Hash:     old.Hash(),
+		Text:     fmt.Sprintf("%c", old),
+		EditedAt: time.Now(),
+	})
+
+	if err := eh.set(&TwtHistory{Hash: new.Hash(), Revisions: revisions}); err != nil {
+		return err
+	}
+
+	prev.ReplacedBy = new.Hash()
+	return eh.set(prev)
+}
+
+// RecordDelete records that the twt was deleted by its author
+func (eh *EditHistory) RecordDelete(twt types.Twt) error {
+	if eh == nil {
+		return nil
+	}
+
+	eh.Lock()
+	defer eh.Unlock()
+
+	h, ok := eh.get(twt.Hash())
+	if !ok {
+		h = &TwtHistory{Hash: twt.Hash()}
+	}
+
+	now := time.Now()
+	h.DeletedAt = &now
+
+	return eh.set(h)
+}
@@ -0,0 +1,75 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yarn.social/types"
+)
+
+func TestTwtHistoryEndpointVisibility(t *testing.T) {
+	s := newTestHandlerServer(t)
+
+	tv, err := NewTwtVisibility(s.config())
+	require.NoError(t, err)
+	eh, err := NewEditHistory(s.config())
+	require.NoError(t, err)
+
+	oldVisibility, oldEdits := visibility, edits
+	defer func() { visibility, edits = oldVisibility, oldEdits }()
+	visibility, edits = tv, eh
+
+	feed := s.config().URLForUser("bob")
+	twter := types.NewTwter("bob", feed)
+
+	now := time.Now()
+	old := types.MakeTwt(twter, now.Add(-time.Hour), "Hello followers!")
+	edited := types.MakeTwt(twter, now, "Hello followers, edited!")
+	require.NoError(t, tv.Set(old.Hash(), feed, VisibilityFollowers))
+	require.NoError(t, tv.Set(edited.Hash(), feed, VisibilityFollowers))
+	require.NoError(t, eh.RecordEdit(old, edited))
+
+	s.cache.UpdateFeed(feed, "", types.Twts{edited})
+	s.cache.Refresh()
+
+	alice := NewUser()
+	alice.Username = "alice"
+	alice.URL = s.config().URLForUser(alice.Username)
+	require.NoError(t, s.db.SetUser(alice.Username, alice))
+
+	api := &API{config: s.config, cache: s.cache, db: s.db}
+	params := httprouter.Params{{Key: "hash", Value: edited.Hash()}}
+
+	getHistory := func(user *User) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/v1/twt/"+edited.Hash()+"/history", nil)
+		if user != nil {
+			token, err := api.CreateToken(user, r)
+			require.NoError(t, err)
+			r.Header.Set("Token", token.Value)
+		}
+		w := httptest.NewRecorder()
+		api.TwtHistoryEndpoint()(w, r, params)
+		return w
+	}
+
+	// Neither anonymous clients nor users who don't follow the feed see the
+	// previous text of followers-only twts
+	assert.Equal(t, http.StatusNotFound, getHistory(nil).Code)
+	assert.Equal(t, http.StatusNotFound, getHistory(alice).Code)
+
+	// Followers do
+	require.NoError(t, alice.Follow("bob", feed))
+	require.NoError(t, s.db.SetUser(alice.Username, alice))
+
+	w := getHistory(alice)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Hello followers!")
+}
@@ -0,0 +1,44 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/tls"
+	"net/http"
+
+	"github.com/lucas-clemente/quic-go/http3"
+	log "github.com/sirupsen/logrus"
+)
+
+// altSvcHandler advertises the HTTP/3 server to clients of the HTTP/1.1 and
+// HTTP/2 server with an Alt-Svc header so they can switch to QUIC
+func altSvcHandler(h3 *http3.Server, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := h3.SetQuicHeaders(w.Header()); err != nil {
+			log.WithError(err).Warn("error setting Alt-Svc header")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// serveHTTP3 serves the pod over HTTP/3 (QUIC) on the UDP port of the bind
+// address with the TLS config of the HTTP/1.1 and HTTP/2 server. It must be
+// called before the latter is started so its responses advertise HTTP/3.
+func (s *Server) serveHTTP3(tlsConfig *tls.Config) {
+	s.http3 = &http3.Server{
+		Server: &http.Server{
+			Addr:      s.bind,
+			Handler:   s.server.Handler,
+			TLSConfig: tlsConfig.Clone(),
+		},
+	}
+	s.server.Handler = altSvcHandler(s.http3, s.server.Handler)
+
+	go func() {
+		log.Infof("serving HTTP/3 on udp %s", s.bind)
+		if err := s.http3.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.WithError(err).Error("error running http/3 server")
+		}
+	}()
+}
@@ -3,11 +3,7 @@
 
 package internal
 
-import (
-	"fmt"
-
-	log "github.com/sirupsen/logrus"
-)
+import "fmt"
 
 type ImageTask struct {
 	*BaseTask
@@ -17,28 +13,33 @@ type ImageTask struct {
 }
 
 func NewImageTask(conf *Config, fn string) *ImageTask {
-	return &ImageTask{
+	task := &ImageTask{
 		BaseTask: NewBaseTask(),
 
 		conf: conf,
 		fn:   fn,
 	}
+	// Media tasks are for uploads users are waiting on
+	task.SetPriority(TaskPriorityInteractive)
+	return task
 }
 
 func (t *ImageTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *ImageTask) Kind() string   { return "image" }
+func (t *ImageTask) Args() TaskData { return TaskData{"fn": t.fn} }
 func (t *ImageTask) Run() error {
 	defer t.Done()
 	t.SetState(TaskStateRunning)
 
-	log.Infof("starting image processing task for %s", t.fn)
+	Logger(LogMedia).Infof("starting image processing task for %s", t.fn)
 
 	opts := &ImageOptions{Resize: true, Width: t.conf.MediaResolution, Height: 0}
 	mediaURI, err := ProcessImage(t.conf, t.fn, mediaDir, "", opts)
 	if err != nil {
-		log.WithError(err).Errorf("error processing image %s", t.fn)
+		Logger(LogMedia).WithError(err).Errorf("error processing image %s", t.fn)
 		return t.Fail(err)
 	}
-	log.Infof("image processing complete for %s with uri %s", t.fn, mediaURI)
+	Logger(LogMedia).Infof("image processing complete for %s with uri %s", t.fn, mediaURI)
 
 	t.SetData("mediaURI", mediaURI)
 
@@ -0,0 +1,429 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/http"
+	"net/mail"
+	"regexp"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+)
+
+const (
+	// mailSignatureSeparator is the conventional separator of an email signature
+	mailSignatureSeparator = "\n-- \n"
+)
+
+var (
+	// ErrInvalidMailRecipient is returned when an inbound message does not
+	// match any user's post-by-email address
+	ErrInvalidMailRecipient = errors.New("error: invalid mail recipient")
+
+	// ErrNoMailContent is returned when an inbound message has no usable content
+	ErrNoMailContent = errors.New("error: no content found in message")
+)
+
+// InboundMail is a parsed inbound email message
+type InboundMail struct {
+	Recipients  []string
+	Subject     string
+	Body        string
+	Attachments []*MailAttachment
+
+	// htmlBody is the body of messages without a text/plain part
+	htmlBody string
+}
+
+// MailAttachment ...
+type MailAttachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Text renders the message as the text of a twt with the subject and body
+// separated by a newline and the signature (if any) removed.
+func (m *InboundMail) Text() string {
+	body := strings.ReplaceAll(m.Body, "\r\n", "\n")
+	if i := strings.Index(body, mailSignatureSeparator); i >= 0 {
+		body = body[:i]
+	}
+	body = strings.TrimSpace(body)
+
+	var parts []string
+	if subject := strings.TrimSpace(m.Subject); subject != "" {
+		parts = append(parts, subject)
+	}
+	if body != "" {
+		parts = append(parts, body)
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+// PostByEmailAddress returns the secret address a user can send mail to in
+// order to post a twt or an empty string if posting by email is disabled.
+func PostByEmailAddress(conf *Config, user *User) string {
+	if user.PostByEmailToken == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s+%s@%s", user.Username, user.PostByEmailToken, conf.baseURL.Hostname())
+}
+
+// ParsePostByEmailAddress splits a post-by-email address into its username
+// and secret token
+func ParsePostByEmailAddress(conf *Config, addr string) (username, token string, err error) {
+	a, err := mail.ParseAddress(addr)
+	if err != nil {
+		return "", "", err
+	}
+
+	at := strings.LastIndex(a.Address, "@")
+	if at < 0 || !strings.EqualFold(a.Address[at+1:], conf.baseURL.Hostname()) {
+		return "", "", ErrInvalidMailRecipient
+	}
+
+	parts := strings.SplitN(a.Address[:at], "+", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", ErrInvalidMailRecipient
+	}
+
+	return NormalizeUsername(parts[0]), parts[1], nil
+}
+
+func decodeMailPart(encoding string, r io.Reader) io.Reader {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "base64":
+		return base64.NewDecoder(base64.StdEncoding, r)
+	case "quoted-printable":
+		return quotedprintable.NewReader(r)
+	default:
+		return r
+	}
+}
+
+// decodeMailCharset converts the text of a part in the given charset to UTF-8
+func decodeMailCharset(label string, data []byte) []byte {
+	switch strings.ToLower(strings.TrimSpace(label)) {
+	case "", "utf-8", "utf8", "us-ascii":
+		return data
+	}
+
+	r, err := charset.NewReaderLabel(label, bytes.NewReader(data))
+	if err != nil {
+		log.WithError(err).Warnf("unsupported mail charset %s", label)
+		return data
+	}
+
+	decoded, err := ioutil.ReadAll(r)
+	if err != nil {
+		log.WithError(err).Warnf("error decoding mail charset %s", label)
+		return data
+	}
+
+	return decoded
+}
+
+// mailBlankLines matches the runs of blank lines of text rendered from html
+var mailBlankLines = regexp.MustCompile(`\n{3,}`)
+
+// mailHTMLToText renders the html body of a message as plain text keeping its
+// paragraphs and line breaks
+func mailHTMLToText(body string) string {
+	var (
+		sb   strings.Builder
+		skip int
+	)
+
+	z := html.NewTokenizer(strings.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			lines := strings.Split(sb.String(), "\n")
+			for i, line := range lines {
+				lines[i] = strings.Join(strings.Fields(line), " ")
+			}
+			return strings.TrimSpace(mailBlankLines.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			switch string(name) {
+			case "script", "style", "head", "title":
+				if tt == html.StartTagToken {
+					skip++
+				} else if tt == html.EndTagToken && skip > 0 {
+					skip--
+				}
+			case "br":
+				sb.WriteString("\n")
+			case "p", "div", "li", "tr", "h1", "h2", "h3", "h4", "h5", "h6", "blockquote":
+				sb.WriteString("\n\n")
+			}
+		case html.TextToken:
+			if skip == 0 {
+				sb.Write(z.Text())
+			}
+		}
+	}
+}
+
+func (m *InboundMail) parsePart(contentType, encoding, disposition string, r io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		mediaType = "text/plain"
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		mr := multipart.NewReader(r, params["boundary"])
+		for {
+			p, err := mr.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			// multipart.Reader transparently decodes quoted-printable parts
+			enc := p.Header.Get("Content-Transfer-Encoding")
+			if strings.EqualFold(enc, "quoted-printable") {
+				enc = ""
+			}
+
+			if err := m.parsePart(
+				p.Header.Get("Content-Type"), enc,
+				p.Header.Get("Content-Disposition"), p,
+			); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := ioutil.ReadAll(decodeMailPart(encoding, r))
+	if err != nil {
+		return err
+	}
+
+	_, dparams, _ := mime.ParseMediaType(disposition)
+	isAttachment := strings.HasPrefix(strings.ToLower(disposition), "attachment") || dparams["filename"] != ""
+
+	if mediaType == "text/plain" && !isAttachment {
+		if m.Body == "" {
+			m.Body = string(decodeMailCharset(params["charset"], data))
+		}
+		return nil
+	}
+
+	if mediaType == "text/html" && !isAttachment {
+		if m.htmlBody == "" {
+			m.htmlBody = string(decodeMailCharset(params["charset"], data))
+		}
+		return nil
+	}
+
+	if strings.HasPrefix(mediaType, "image/") {
+		m.Attachments = append(m.Attachments, &MailAttachment{
+			Filename:    dparams["filename"],
+			ContentType: mediaType,
+			Data:        data,
+		})
+	}
+
+	return nil
+}
+
+// ParseInboundMail parses a raw RFC 5322 message
+func ParseInboundMail(r io.Reader) (*InboundMail, error) {
+	msg, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+
+	m := &InboundMail{}
+
+	dec := &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+	if subject, err := dec.DecodeHeader(msg.Header.Get("Subject")); err == nil {
+		m.Subject = subject
+	} else {
+		m.Subject = msg.Header.Get("Subject")
+	}
+
+	for _, key := range []string{"X-Original-To", "Delivered-To", "To", "Cc"} {
+		addrs, err := msg.Header.AddressList(key)
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			m.Recipients = append(m.Recipients, addr.Address)
+		}
+	}
+
+	contentType := msg.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = "text/plain"
+	}
+
+	if err := m.parsePart(
+		contentType, msg.Header.Get("Content-Transfer-Encoding"),
+		msg.Header.Get("Content-Disposition"), msg.Body,
+	); err != nil {
+		return nil, err
+	}
+
+	// Messages sent as HTML only are posted as plain text
+	if m.Body == "" && m.htmlBody != "" {
+		m.Body = mailHTMLToText(m.htmlBody)
+	}
+
+	return m, nil
+}
+
+// PostInboundMail posts the message as a twt by the given user storing any
+// image attachments as media.
+func PostInboundMail(conf *Config, cache *Cache, tasks *Dispatcher, appendTwt AppendTwtFunc, user *User, m *InboundMail) error {
+	text := m.Text()
+
+	if !conf.DisableMedia {
+		for _, attachment := range m.Attachments {
+			opts := &ImageOptions{Resize: true, Width: conf.MediaResolution, Height: 0}
+			mediaURI, err := StoreUploadedImage(conf, bytes.NewReader(attachment.Data), mediaDir, "", opts)
+			if err != nil {
+				log.WithError(err).Warnf("error storing mail attachment %s", attachment.Filename)
+				continue
+			}
+			text = strings.TrimSpace(fmt.Sprintf("%s ![](%s)", text, mediaURI))
+		}
+	}
+
+	text = CleanTwt(text)
+	if text == "" {
+		return ErrNoMailContent
+	}
+
+	twt, err := appendTwt(user, nil, text)
+	if err != nil {
+		return err
+	}
+
+	feedURL := conf.URLForUser(user.Username)
+	PublishTwts(conf, tasks, user, feedURL, "", twt)
+
+	cache.InjectFeed(feedURL, twt)
+	cache.DeleteUserViews(user)
+	cache.GetByUser(user, true)
+
+	return nil
+}
+
+// InboundMailHandler accepts raw messages piped from a mail server (for
+// example `curl --data-binary @- https://pod/mail/inbound`) and posts them
+// as twts for the user whose secret post-by-email address the message was
+// sent to. The envelope recipient may be passed with ?recipient=<addr>.
+func (s *Server) InboundMailHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
+		defer r.Body.Close()
+
+		m, err := ParseInboundMail(r.Body)
+		if err != nil {
+			log.WithError(err).Warn("error parsing inbound mail")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		recipients := m.Recipients
+		if recipient := r.URL.Query().Get("recipient"); recipient != "" {
+			recipients = []string{recipient}
+		}
+
+		var user *User
+		for _, recipient := range recipients {
+			username, token, err := ParsePostByEmailAddress(s.config(), recipient)
+			if err != nil {
+				continue
+			}
+			u, err := s.db.GetUser(username)
+			if err != nil || u.PostByEmailToken == "" {
+				continue
+			}
+			if subtle.ConstantTimeCompare([]byte(u.PostByEmailToken), []byte(token)) != 1 {
+				continue
+			}
+			user = u
+			break
+		}
+
+		if user == nil {
+			log.Warnf("no valid post-by-email recipient found in %v", recipients)
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		if !user.IsActive() {
+			log.Warnf("ignoring inbound mail for inactive account %s", user.Username)
+			http.Error(w, "Account Inactive", http.StatusForbidden)
+			return
+		}
+
+		if err := PostInboundMail(s.config(), s.cache, s.tasks, s.AppendTwt, user, m); err != nil {
+			log.WithError(err).Errorf("error posting inbound mail for %s", user.Username)
+			if err == ErrNoMailContent {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// SettingsPostByEmailHandler enables, regenerates or disables the user's
+// secret post-by-email address
+func (s *Server) SettingsPostByEmailHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if r.FormValue("action") == "disable" {
+			user.PostByEmailToken = ""
+		} else {
+			user.PostByEmailToken = GenerateRandomToken()
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating post by email token for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = s.tr(ctx, "MsgUpdateSettingsSuccess")
+		s.render("error", w, ctx)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func mailMessage(lines ...string) string {
+	return strings.Join(lines, "\r\n")
+}
+
+func TestParseInboundMail(t *testing.T) {
+	testCases := []struct {
+		name        string
+		message     string
+		recipients  []string
+		subject     string
+		body        string
+		attachments []string
+	}{
+		{
+			name: "plain text message",
+			message: mailMessage(
+				"To: alice+token@example.com",
+				"Subject: Hello",
+				"",
+				"Hello World!",
+			),
+			recipients: []string{"alice+token@example.com"},
+			subject:    "Hello",
+			body:       "Hello World!",
+		}, {
+			name: "quoted-printable body",
+			message: mailMessage(
+				"To: alice+token@example.com",
+				"Content-Type: text/plain; charset=utf-8",
+				"Content-Transfer-Encoding: quoted-printable",
+				"",
+				"Caf=C3=A9 au lait, a very long line that is wrapped by a soft line=",
+				" break",
+			),
+			recipients: []string{"alice+token@example.com"},
+			body:       "Café au lait, a very long line that is wrapped by a soft line break",
+		}, {
+			name: "base64 body",
+			message: mailMessage(
+				"To: alice+token@example.com",
+				"Content-Type: text/plain; charset=utf-8",
+				"Content-Transfer-Encoding: base64",
+				"",
+				"SGVsbG8gV29ybGQh",
+			),
+			recipients: []string{"alice+token@example.com"},
+			body:       "Hello World!",
+		}, {
+			name: "latin-1 body and encoded subject",
+			message: mailMessage(
+				"To: alice+token@example.com",
+				"Subject: =?ISO-8859-1?Q?Caf=E9?=",
+				"Content-Type: text/plain; charset=iso-8859-1",
+				"",
+				"Un caf\xe9 cr\xe8me",
+			),
+			recipients: []string{"alice+token@example.com"},
+			subject:    "Café",
+			body:       "Un café crème",
+		}, {
+			name: "nested multipart/alternative with an image attachment",
+			message: mailMessage(
+				"To: Alice <alice+token@example.com>",
+				"Cc: bob@example.org",
+				"Subject: Photo",
+				"MIME-Version: 1.0",
+				`Content-Type: multipart/mixed; boundary="mixed"`,
+				"",
+				"--mixed",
+				`Content-Type: multipart/alternative; boundary="alt"`,
+				"",
+				"--alt",
+				"Content-Type: text/plain; charset=utf-8",
+				"Content-Transfer-Encoding: quoted-printable",
+				"",
+				"Look at this =F0=9F=93=B7",
+				"--alt",
+				"Content-Type: text/html; charset=utf-8",
+				"",
+				"<p>Look at <b>this</b> &#x1F4F7;</p>",
+				"--alt--",
+				"--mixed",
+				"Content-Type: image/png",
+				`Content-Disposition: attachment; filename="photo.png"`,
+				"Content-Transfer-Encoding: base64",
+				"",
+				"aGVsbG8=",
+				"--mixed--",
+			),
+			recipients:  []string{"alice+token@example.com", "bob@example.org"},
+			subject:     "Photo",
+			body:        "Look at this 📷",
+			attachments: []string{"photo.png"},
+		}, {
+			name: "html only body",
+			message: mailMessage(
+				"To: alice+token@example.com",
+				"Content-Type: text/html; charset=utf-8",
+				"",
+				"<html><head><title>Ignored</title><style>p { color: red; }</style></head>",
+				"<body><p>Hello <b>World</b>!</p><p>Line one<br>Line   two</p></body></html>",
+			),
+			recipients: []string{"alice+token@example.com"},
+			body:       "Hello World!\n\nLine one\nLine two",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			m, err := ParseInboundMail(strings.NewReader(testCase.message))
+			require.NoError(t, err)
+
+			assert.Equal(t, testCase.recipients, m.Recipients)
+			assert.Equal(t, testCase.subject, m.Subject)
+			assert.Equal(t, testCase.body, strings.TrimSpace(m.Body))
+
+			var attachments []string
+			for _, attachment := range m.Attachments {
+				attachments = append(attachments, attachment.Filename)
+			}
+			assert.Equal(t, testCase.attachments, attachments)
+		})
+	}
+}
+
+func TestParsePostByEmailAddress(t *testing.T) {
+	conf := NewConfig()
+	require.NoError(t, WithBaseURL("https://example.com")(conf))
+
+	testCases := []struct {
+		name     string
+		addr     string
+		username string
+		token    string
+		err      bool
+	}{
+		{name: "valid address", addr: "alice+s3cr3t@example.com", username: "alice", token: "s3cr3t"},
+		{name: "display name and mixed case", addr: "Alice <Alice+s3cr3t@EXAMPLE.com>", username: "alice", token: "s3cr3t"},
+		{name: "token containing a plus", addr: "alice+s3+cr3t@example.com", username: "alice", token: "s3+cr3t"},
+		{name: "other domain", addr: "alice+s3cr3t@example.org", err: true},
+		{name: "missing token", addr: "alice@example.com", err: true},
+		{name: "empty token", addr: "alice+@example.com", err: true},
+		{name: "empty username", addr: "+s3cr3t@example.com", err: true},
+		{name: "malformed address", addr: "alice+s3cr3t", err: true},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			username, token, err := ParsePostByEmailAddress(conf, testCase.addr)
+			if testCase.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, testCase.username, username)
+			assert.Equal(t, testCase.token, token)
+		})
+	}
+}
@@ -1,6 +1,10 @@
 package internal
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -16,6 +20,18 @@ import (
 	"golang.org/x/net/html"
 )
 
+const (
+	// indieAuthTokenType is the type (`typ` claim) of IndieAuth access tokens
+	// which are never accepted as API tokens
+	indieAuthTokenType = "indieauth"
+
+	// indieAuthTokenExpiry is how long IndieAuth access tokens are valid for
+	indieAuthTokenExpiry = 90 * 24 * time.Hour
+
+	// pkceMethodS256 is the only supported PKCE code challenge method
+	pkceMethodS256 = "S256"
+)
+
 // HApp ...
 type HApp struct {
 	Name string
@@ -101,7 +117,7 @@ func ValidateIndieRedirectURL(clientID, redirectURI string) error {
 		return err
 	}
 
-	u2, err := url.Parse(clientID)
+	u2, err := url.Parse(redirectURI)
 	if err != nil {
 		log.WithError(err).Errorf("error parsing redirectURI: %s", redirectURI)
 		return err
@@ -131,6 +147,9 @@ func (s *Server) IndieAuthHandler() httprouter.Handle {
 		clientID := r.FormValue("client_id")
 		redirectURI := r.FormValue("redirect_uri")
 		state := r.FormValue("state")
+		scope := r.FormValue("scope")
+		codeChallenge := r.FormValue("code_challenge")
+		codeChallengeMethod := r.FormValue("code_challenge_method")
 
 		if me == "" || clientID == "" || redirectURI == "" || state == "" {
 			log.Warn("missing authentication parameters")
@@ -146,6 +165,20 @@ func (s *Server) IndieAuthHandler() httprouter.Handle {
 			return
 		}
 
+		if codeChallenge != "" && codeChallengeMethod != pkceMethodS256 {
+			log.Warnf("unsupported code challenge method %q", codeChallengeMethod)
+
+			if r.Method == http.MethodHead {
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			ctx.Error = true
+			ctx.Message = "Error unsupported code challenge method"
+			s.render("error", w, ctx)
+			return
+		}
+
 		/* TODO: What is `response_type` used for?
 		responseType := r.FormValue("response_type")
 		if responseType == "" {
@@ -154,7 +187,7 @@ func (s *Server) IndieAuthHandler() httprouter.Handle {
 		responseType = strings.ToLower(responseType)
 		*/
 
-		happ, err := GetIndieClientInfo(s.config, clientID)
+		happ, err := GetIndieClientInfo(s.config(), clientID)
 		if err != nil {
 			log.WithError(err).Warnf("error retrieving client information from %s", clientID)
 		}
@@ -176,12 +209,17 @@ func (s *Server) IndieAuthHandler() httprouter.Handle {
 		ctx.PromptTitle = s.tr(ctx, "IndieAuthTitle")
 		ctx.PromptMessage = fmt.Sprintf(
 			s.tr(ctx, "IndieAuthMessage"),
-			happ, s.config.Name,
-		)
-		ctx.PromptCallback = fmt.Sprintf(
-			"/indieauth/callback?redirect_uri=%s&state=%s",
-			redirectURI, state,
+			happ, s.config().Name,
 		)
+		ctx.PromptCallback = "/indieauth/callback"
+		ctx.PromptParams = map[string]string{
+			"client_id":             clientID,
+			"redirect_uri":          redirectURI,
+			"state":                 state,
+			"scope":                 scope,
+			"code_challenge":        codeChallenge,
+			"code_challenge_method": codeChallengeMethod,
+		}
 		ctx.PromptApprove = s.tr(ctx, "IndieAuthApprove")
 		ctx.PromptCancel = s.tr(ctx, "IndieAuthCancel")
 		ctx.PromptTarget = ""
@@ -190,20 +228,29 @@ func (s *Server) IndieAuthHandler() httprouter.Handle {
 	}
 }
 
-// IndieAuthCallbackHandler ...
+// IndieAuthCallbackHandler issues an authorization code to the client once
+// the user approves it on the consent page and redirects back to the client
 func (s *Server) IndieAuthCallbackHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s, r)
 
+		clientID := r.FormValue("client_id")
 		redirectURI := r.FormValue("redirect_uri")
 		state := r.FormValue("state")
+		scope := r.FormValue("scope")
 
-		if redirectURI == "" || state == "" {
+		if clientID == "" || redirectURI == "" || state == "" {
 			log.Warn("missing callback parameters")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
+		if err := ValidateIndieRedirectURL(clientID, redirectURI); err != nil {
+			log.WithError(err).Errorf("error validating redirectURI %s from client %s", redirectURI, clientID)
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
 		u, err := url.Parse(redirectURI)
 		if err != nil {
 			log.WithError(err).Errorf("error parsing redirectURI %s", redirectURI)
@@ -211,27 +258,15 @@ func (s *Server) IndieAuthCallbackHandler() httprouter.Handle {
 			return
 		}
 
-		// TOOD: Make the expiry time configurable?
-		expiryTime := time.Now().Add(30 * time.Minute).Unix()
-
-		// Create auth token
-		token := jwt.NewWithClaims(
-			jwt.SigningMethodHS256,
-			jwt.MapClaims{
-				"expiresAt": expiryTime,
-				"username":  ctx.Username,
-			},
-		)
-		tokenString, err := token.SignedString([]byte(s.config.MagicLinkSecret))
+		code, err := s.newIndieAuthCode(ctx.Username, clientID, redirectURI, scope, r.FormValue("code_challenge"))
 		if err != nil {
+			log.WithError(err).Error("error creating indieauth code")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
-		parts := strings.SplitN(tokenString, ".", 3)
-		tokenCache.Inc(parts[2])
 
 		v := url.Values{}
-		v.Add("code", tokenString)
+		v.Add("code", code)
 		v.Add("state", state)
 		u.RawQuery = v.Encode()
 
@@ -257,61 +292,281 @@ func (s *Server) IndieAuthVerifyHandler() httprouter.Handle {
 			return
 		}
 
-		indieAuthToken := code
-
-		// Check if token is valid
-		token, err := jwt.Parse(indieAuthToken, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-
-			return []byte(s.config.MagicLinkSecret), nil
-		})
+		claims, err := s.verifyIndieAuthCode(code)
 		if err != nil {
-			log.WithError(err).Error("error validing indieauth token")
+			log.WithError(err).Warn("error verifying indieauth code")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		if tokenCache.Get(token.Signature) == 0 {
-			log.Warn("no valid indieauth token found")
+
+		if err := checkIndieAuthCode(claims, clientID, redirectURI, r.FormValue("code_verifier")); err != nil {
+			log.WithError(err).Warn("error verifying indieauth code")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		tokenCache.Dec(token.Signature)
+		username, _ := claims["username"].(string)
 
-		var username string
+		me := map[string]string{
+			"me": UserURL(s.config().URLForUser(username)),
+		}
 
-		if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-			expiresAt := int(claims["expiresAt"].(float64))
-			username = string(claims["username"].(string))
+		data, err := json.Marshal(me)
+		if err != nil {
+			log.WithError(err).Error("error serializing me response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
 
-			now := time.Now()
-			secs := now.Unix()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
 
-			// Check token expiry
-			if secs > int64(expiresAt) {
-				log.Warn("indieauth token expired")
-				http.Error(w, "Bad Request", http.StatusBadRequest)
+// IndieAuthTokenHandler implements the IndieAuth Token Endpoint used by
+// clients (such as Micropub clients) to exchange an authorization code for
+// an access token and to verify existing access tokens.
+func (s *Server) IndieAuthTokenHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if r.Method == http.MethodGet {
+			claims, err := s.parseIndieAuthAccessToken(r)
+			if err != nil {
+				log.WithError(err).Warn("error verifying indieauth access token")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			data, err := json.Marshal(map[string]string{
+				"me":        UserURL(s.config().URLForUser(claims.Username)),
+				"client_id": claims.ClientID,
+				"scope":     claims.Scope,
+			})
+			if err != nil {
+				log.WithError(err).Error("error serializing token response")
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
-		} else {
-			log.Warn("invalid indieauth token or invalid claims")
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(data)
+			return
+		}
+
+		code := r.FormValue("code")
+		clientID := r.FormValue("client_id")
+		redirectURI := r.FormValue("redirect_uri")
+
+		if code == "" || clientID == "" || redirectURI == "" {
+			log.Warn("missing token request parameters")
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		me := map[string]string{
-			"me": UserURL(s.config.URLForUser(username)),
+		claims, err := s.verifyIndieAuthCode(code)
+		if err != nil {
+			log.WithError(err).Warn("error verifying indieauth code")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
 		}
 
-		data, err := json.Marshal(me)
+		if err := checkIndieAuthCode(claims, clientID, redirectURI, r.FormValue("code_verifier")); err != nil {
+			log.WithError(err).Warn("error verifying indieauth code")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		username, _ := claims["username"].(string)
+		scope, _ := claims["scope"].(string)
+		if username == "" || scope == "" {
+			log.Warn("indieauth code has no username or scope")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		token := jwt.NewWithClaims(
+			jwt.SigningMethodHS256,
+			jwt.MapClaims{
+				"typ":       indieAuthTokenType,
+				"username":  username,
+				"client_id": clientID,
+				"scope":     scope,
+				"iat":       now.Unix(),
+				"exp":       now.Add(indieAuthTokenExpiry).Unix(),
+			},
+		)
+		tokenString, err := token.SignedString(indieAuthSigningKey(s.config()))
 		if err != nil {
-			log.WithError(err).Error("error serializing me response")
+			log.WithError(err).Error("error creating indieauth access token")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := json.Marshal(map[string]interface{}{
+			"access_token": tokenString,
+			"token_type":   "Bearer",
+			"expires_in":   int64(indieAuthTokenExpiry.Seconds()),
+			"scope":        scope,
+			"me":           UserURL(s.config().URLForUser(username)),
+		})
+		if err != nil {
+			log.WithError(err).Error("error serializing token response")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		w.Write(data)
+		_, _ = w.Write(data)
+	}
+}
+
+// IndieAuthClaims ...
+type IndieAuthClaims struct {
+	Username string
+	ClientID string
+	Scope    string
+}
+
+// HasScope returns true if the access token was granted the given scope
+func (c IndieAuthClaims) HasScope(scope string) bool {
+	return HasString(strings.Fields(c.Scope), scope)
+}
+
+// indieAuthSigningKey is the key IndieAuth access tokens are signed with. It
+// is derived from the API signing key so that IndieAuth access tokens, which
+// are limited to their scope, can never be used as API tokens.
+func indieAuthSigningKey(conf *Config) []byte {
+	mac := hmac.New(sha256.New, []byte(conf.APISigningKey))
+	mac.Write([]byte(indieAuthTokenType))
+	return mac.Sum(nil)
+}
+
+// checkIndieAuthCode checks that an authorization code is redeemed by the
+// client it was issued to with the same redirect url and, if the client sent
+// a PKCE code challenge, with the code verifier of the challenge.
+func checkIndieAuthCode(claims jwt.MapClaims, clientID, redirectURI, codeVerifier string) error {
+	if cid, _ := claims["client_id"].(string); cid != clientID {
+		return fmt.Errorf("error: mismatched client_id %s for indieauth code issued to %s", clientID, cid)
+	}
+
+	if uri, _ := claims["redirect_uri"].(string); uri != redirectURI {
+		return fmt.Errorf("error: mismatched redirect_uri %s for indieauth code issued for %s", redirectURI, uri)
+	}
+
+	if challenge, _ := claims["code_challenge"].(string); challenge != "" {
+		sum := sha256.Sum256([]byte(codeVerifier))
+		expected := base64.RawURLEncoding.EncodeToString(sum[:])
+		if codeVerifier == "" || subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) != 1 {
+			return errors.New("error: invalid code_verifier for indieauth code")
+		}
+	}
+
+	return nil
+}
+
+// newIndieAuthCode issues a single-use authorization code bound to the client,
+// its redirect url and its PKCE code challenge (if any)
+func (s *Server) newIndieAuthCode(username, clientID, redirectURI, scope, codeChallenge string) (string, error) {
+	// TOOD: Make the expiry time configurable?
+	expiryTime := time.Now().Add(30 * time.Minute).Unix()
+
+	token := jwt.NewWithClaims(
+		jwt.SigningMethodHS256,
+		jwt.MapClaims{
+			"expiresAt":      expiryTime,
+			"username":       username,
+			"client_id":      clientID,
+			"redirect_uri":   redirectURI,
+			"scope":          scope,
+			"code_challenge": codeChallenge,
+		},
+	)
+	tokenString, err := token.SignedString([]byte(s.config().MagicLinkSecret))
+	if err != nil {
+		return "", err
+	}
+	parts := strings.SplitN(tokenString, ".", 3)
+	tokenCache.Inc(parts[2])
+
+	return tokenString, nil
+}
+
+// verifyIndieAuthCode validates a single-use authorization code issued by
+// IndieAuthCallbackHandler and returns its claims.
+func (s *Server) verifyIndieAuthCode(code string) (jwt.MapClaims, error) {
+	token, err := jwt.Parse(code, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return []byte(s.config().MagicLinkSecret), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if tokenCache.Get(token.Signature) == 0 {
+		return nil, errors.New("error: no valid indieauth token found")
+	}
+	tokenCache.Dec(token.Signature)
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, errors.New("error: invalid indieauth token or invalid claims")
+	}
+
+	expiresAt, _ := claims["expiresAt"].(float64)
+	if time.Now().Unix() > int64(expiresAt) {
+		return nil, errors.New("error: indieauth token expired")
+	}
+
+	return claims, nil
+}
+
+// parseIndieAuthAccessToken parses and validates the access token passed
+// either as a Bearer token in the Authorization header or as the
+// `access_token` form parameter.
+func (s *Server) parseIndieAuthAccessToken(r *http.Request) (*IndieAuthClaims, error) {
+	tokenString := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer"))
+	if tokenString == "" {
+		tokenString = r.FormValue("access_token")
+	}
+	if tokenString == "" {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+
+		return indieAuthSigningKey(s.config()), nil
+	})
+	if err != nil {
+		return nil, err
 	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	// Access tokens always expire (jwt-go only validates exp if present)
+	if typ, _ := claims["typ"].(string); typ != indieAuthTokenType {
+		return nil, ErrInvalidToken
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, ErrInvalidToken
+	}
+
+	username, _ := claims["username"].(string)
+	clientID, _ := claims["client_id"].(string)
+	scope, _ := claims["scope"].(string)
+	if username == "" || scope == "" {
+		return nil, ErrInvalidToken
+	}
+
+	return &IndieAuthClaims{
+		Username: username,
+		ClientID: clientID,
+		Scope:    scope,
+	}, nil
 }
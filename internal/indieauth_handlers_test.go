@@ -0,0 +1,202 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	jwt "github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testIndieAuthClientID    = "https://client.example.org/"
+	testIndieAuthRedirectURI = "https://client.example.org/callback"
+)
+
+// exchangeIndieAuthCode posts a token request to the IndieAuth token endpoint
+func exchangeIndieAuthCode(s *Server, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/indieauth/token", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+
+	s.IndieAuthTokenHandler()(w, r, nil)
+	return w
+}
+
+func testIndieAuthTokenRequest(code string) url.Values {
+	return url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"client_id":    {testIndieAuthClientID},
+		"redirect_uri": {testIndieAuthRedirectURI},
+	}
+}
+
+func TestIndieAuthTokenExchange(t *testing.T) {
+	s := newTestHandlerServer(t)
+
+	t.Run("code exchange", func(t *testing.T) {
+		code, err := s.newIndieAuthCode("alice", testIndieAuthClientID, testIndieAuthRedirectURI, "create media", "")
+		require.NoError(t, err)
+
+		w := exchangeIndieAuthCode(s, testIndieAuthTokenRequest(code))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		var res struct {
+			AccessToken string `json:"access_token"`
+			TokenType   string `json:"token_type"`
+			ExpiresIn   int64  `json:"expires_in"`
+			Scope       string `json:"scope"`
+			Me          string `json:"me"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&res))
+		assert.NotEmpty(t, res.AccessToken)
+		assert.Equal(t, "Bearer", res.TokenType)
+		assert.Equal(t, int64(indieAuthTokenExpiry.Seconds()), res.ExpiresIn)
+		assert.Equal(t, "create media", res.Scope)
+		assert.Equal(t, UserURL(s.config().URLForUser("alice")), res.Me)
+
+		// The access token can be verified by the client
+		r := httptest.NewRequest(http.MethodGet, "/indieauth/token", nil)
+		r.Header.Set("Authorization", "Bearer "+res.AccessToken)
+		w = httptest.NewRecorder()
+		s.IndieAuthTokenHandler()(w, r, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Contains(t, w.Body.String(), testIndieAuthClientID)
+
+		// But is not an API token
+		api := &API{config: s.config}
+		_, err = jwt.Parse(res.AccessToken, api.jwtKeyFunc)
+		assert.Error(t, err)
+	})
+
+	t.Run("code reuse", func(t *testing.T) {
+		code, err := s.newIndieAuthCode("alice", testIndieAuthClientID, testIndieAuthRedirectURI, "create", "")
+		require.NoError(t, err)
+
+		w := exchangeIndieAuthCode(s, testIndieAuthTokenRequest(code))
+		require.Equal(t, http.StatusOK, w.Code)
+
+		w = exchangeIndieAuthCode(s, testIndieAuthTokenRequest(code))
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("wrong redirect_uri", func(t *testing.T) {
+		code, err := s.newIndieAuthCode("alice", testIndieAuthClientID, testIndieAuthRedirectURI, "create", "")
+		require.NoError(t, err)
+
+		form := testIndieAuthTokenRequest(code)
+		form.Set("redirect_uri", "https://client.example.org/callback/evil")
+		w := exchangeIndieAuthCode(s, form)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("wrong client_id", func(t *testing.T) {
+		code, err := s.newIndieAuthCode("alice", testIndieAuthClientID, testIndieAuthRedirectURI, "create", "")
+		require.NoError(t, err)
+
+		form := testIndieAuthTokenRequest(code)
+		form.Set("client_id", "https://evil.example.org/")
+		w := exchangeIndieAuthCode(s, form)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("pkce", func(t *testing.T) {
+		verifier := GenerateRandomToken()
+		sum := sha256.Sum256([]byte(verifier))
+		challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+		testCases := []struct {
+			name     string
+			verifier string
+			status   int
+		}{
+			{name: "missing verifier", verifier: "", status: http.StatusBadRequest},
+			{name: "wrong verifier", verifier: GenerateRandomToken(), status: http.StatusBadRequest},
+			{name: "valid verifier", verifier: verifier, status: http.StatusOK},
+		}
+
+		for _, testCase := range testCases {
+			t.Run(testCase.name, func(t *testing.T) {
+				code, err := s.newIndieAuthCode("alice", testIndieAuthClientID, testIndieAuthRedirectURI, "create", challenge)
+				require.NoError(t, err)
+
+				form := testIndieAuthTokenRequest(code)
+				if testCase.verifier != "" {
+					form.Set("code_verifier", testCase.verifier)
+				}
+				w := exchangeIndieAuthCode(s, form)
+				assert.Equal(t, testCase.status, w.Code)
+			})
+		}
+	})
+
+	t.Run("invalid access token", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/indieauth/token", nil)
+		r.Header.Set("Authorization", "Bearer invalid")
+		w := httptest.NewRecorder()
+
+		s.IndieAuthTokenHandler()(w, r, nil)
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestIndieAuthVerify(t *testing.T) {
+	s := newTestHandlerServer(t)
+
+	verify := func(form url.Values) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/indieauth/auth", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+
+		s.IndieAuthVerifyHandler()(w, r, nil)
+		return w
+	}
+
+	code, err := s.newIndieAuthCode("alice", testIndieAuthClientID, testIndieAuthRedirectURI, "", "")
+	require.NoError(t, err)
+
+	form := testIndieAuthTokenRequest(code)
+	form.Set("redirect_uri", "https://client.example.org/other")
+	assert.Equal(t, http.StatusBadRequest, verify(form).Code)
+
+	code, err = s.newIndieAuthCode("alice", testIndieAuthClientID, testIndieAuthRedirectURI, "", "")
+	require.NoError(t, err)
+
+	w := verify(testIndieAuthTokenRequest(code))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), UserURL(s.config().URLForUser("alice")))
+
+	assert.Equal(t, http.StatusBadRequest, verify(testIndieAuthTokenRequest(code)).Code)
+}
+
+func TestValidateIndieRedirectURL(t *testing.T) {
+	testCases := []struct {
+		redirectURI string
+		valid       bool
+	}{
+		{redirectURI: testIndieAuthRedirectURI, valid: true},
+		{redirectURI: "http://client.example.org/callback", valid: false},
+		{redirectURI: "https://evil.example.org/callback", valid: false},
+		{redirectURI: "https://client.example.org:8443/callback", valid: false},
+	}
+
+	for _, testCase := range testCases {
+		err := ValidateIndieRedirectURL(testIndieAuthClientID, testCase.redirectURI)
+		if testCase.valid {
+			assert.NoError(t, err, testCase.redirectURI)
+		} else {
+			assert.Error(t, err, testCase.redirectURI)
+		}
+	}
+}
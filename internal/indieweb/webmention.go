@@ -4,6 +4,7 @@
 package indieweb
 
 import (
+	"fmt"
 	"net/http"
 	"net/url"
 	"time"
@@ -23,12 +24,17 @@ type WebMention struct {
 	inboxTicker  *time.Ticker
 	outboxTicker *time.Ticker
 	Mention      func(source, target *url.URL, sourceData *microformats.Data) error
+
+	// Client is the HTTP client used to verify sources and send webmentions,
+	// consumers may override it (e.g: to restrict the addresses fetched)
+	Client *http.Client
 }
 
 func NewWebMention() *WebMention {
 	wm := &WebMention{
 		inbox:  make(chan *mention, 100),
 		outbox: make(chan *mention, 100),
+		Client: http.DefaultClient,
 	}
 	wm.inboxTicker = time.NewTicker(5 * time.Second)
 	wm.outboxTicker = time.NewTicker(5 * time.Second)
@@ -52,7 +58,7 @@ type mention struct {
 }
 
 func (wm *WebMention) GetTargetEndpoint(target *url.URL) (*url.URL, error) {
-	res, err := http.Get(target.String())
+	res, err := wm.Client.Get(target.String())
 	if err != nil {
 		log.WithError(err).Error("error getting target endpoint")
 		return nil, err
@@ -64,7 +70,7 @@ func (wm *WebMention) GetTargetEndpoint(target *url.URL) (*url.URL, error) {
 	for _, link := range links {
 		for _, rel := range link.Params["rel"] {
 			if rel == "webmention" || rel == "http://webmention.org" {
-				return link.URL, nil
+				return res.Request.URL.ResolveReference(link.URL), nil
 			}
 		}
 	}
@@ -79,7 +85,7 @@ func (wm *WebMention) GetTargetEndpoint(target *url.URL) (*url.URL, error) {
 			log.WithError(err).Warn("error parsing webmention link")
 			continue
 		}
-		return wmurl, nil
+		return res.Request.URL.ResolveReference(wmurl), nil
 	}
 	log.Debugf("no webmention endpoint found in Document")
 
@@ -123,7 +129,7 @@ func (wm *WebMention) processInbox() {
 
 	log.Debugf("processing mention from %s to %s", mention.source, mention.target)
 
-	res, err := http.Get(mention.source.String())
+	res, err := wm.Client.Get(mention.source.String())
 	if err != nil {
 		log.WithError(err).Errorf("error verifying source: %s", mention.source.String())
 		return
@@ -171,35 +177,44 @@ func (wm *WebMention) processOutbox() {
 		return
 	}
 
-	endpoint, err := wm.GetTargetEndpoint(mention.target)
-	if err != nil {
-		log.WithError(err).Errorf("error retrieving webmention endpoint, requeueing (attempts %d)", mention.attempts)
+	if err := wm.Send(mention.source, mention.target); err != nil {
+		log.WithError(err).Errorf("error sending webmention, requeueing (attempts %d)", mention.attempts)
 		// Attempt re-delivery
 		wm.outbox <- mention
-		return
+	}
+}
+
+// Send discovers the webmention endpoint of the target and sends it a
+// webmention for the source, targets without an endpoint are ignored
+func (wm *WebMention) Send(source, target *url.URL) error {
+	endpoint, err := wm.GetTargetEndpoint(target)
+	if err != nil {
+		return fmt.Errorf("error retrieving webmention endpoint of %s: %w", target, err)
 	}
 	if endpoint == nil {
-		log.Debugf("no endpoint found! requeueing (attempts %d)", mention.attempts)
-		return
+		log.Debugf("no webmention endpoint found for %s", target)
+		return nil
 	}
+
 	values := make(url.Values)
-	values.Set("source", mention.source.String())
-	values.Set("target", mention.target.String())
+	values.Set("source", source.String())
+	values.Set("target", target.String())
 	log.Debugf("Sending webmention to %s", endpoint.String())
 	log.Debugf("values: %q", values)
-	res, err := http.PostForm(endpoint.String(), values)
-	if err != nil || (res.StatusCode%100 != 2) {
-		log.WithError(err).Errorf(
-			"error sending webmention source=%s target=%s status=%s",
-			mention.source.String(), mention.target.String(), res.Status,
-		)
-		// Attempt re-delivery
-		wm.outbox <- mention
-		return
+	res, err := wm.Client.PostForm(endpoint.String(), values)
+	if err != nil {
+		return fmt.Errorf("error sending webmention to %s: %w", endpoint, err)
 	}
 	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return fmt.Errorf("non-success response %s sending webmention to %s", res.Status, endpoint)
+	}
+
 	log.Debugf(
 		"successfully sent webmention to %s (source=%s target=%s)",
-		endpoint.String(), mention.source.String(), mention.target.String(),
+		endpoint.String(), source.String(), target.String(),
 	)
+
+	return nil
 }
@@ -4,9 +4,16 @@
 package indieweb
 
 import (
+	"bytes"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
 	"net/url"
@@ -25,6 +32,19 @@ const (
 	defaultWebSubLeaseTime          = time.Hour
 	defaultWebSubQueueSize          = 100
 	defaulWebSubTimeout             = 5 * time.Minute
+
+	// defaultWebSubRenewBefore is how long before a subscription's lease
+	// expires it is renewed and defaultWebSubRenewRetry how long to wait
+	// before retrying a renewal that has not been confirmed yet
+	defaultWebSubRenewBefore = 10 * time.Minute
+	defaultWebSubRenewRetry  = 5 * time.Minute
+
+	// maxWebSubSecretLength is the maximum length of a hub.secret
+	maxWebSubSecretLength = 200
+
+	// webSubSignatureHeader is the header content distribution requests are
+	// signed with when subscribers provide a hub.secret
+	webSubSignatureHeader = "X-Hub-Signature"
 )
 
 var (
@@ -32,6 +52,16 @@ var (
 	_ json.Unmarshaler = (*Subscription)(nil)
 )
 
+// websubLogger returns the logger used by WebSub (See: SetWebSubLogger)
+var websubLogger = func() *log.Entry {
+	return log.NewEntry(log.StandardLogger())
+}
+
+// SetWebSubLogger sets the function returning the logger used by WebSub
+func SetWebSubLogger(f func() *log.Entry) {
+	websubLogger = f
+}
+
 func fileExists(fn string) bool {
 	if _, err := os.Stat(fn); err != nil {
 		if os.IsNotExist(err) {
@@ -47,13 +77,60 @@ func generateRandomChallengeString() string {
 	return fmt.Sprintf("%x", b)
 }
 
+func generateRandomSecret() string {
+	b := make([]byte, 32)
+	_, _ = rand.Read(b)
+	return fmt.Sprintf("%x", b)
+}
+
+// signBody returns the X-Hub-Signature of body signed with secret
+func signBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return fmt.Sprintf("sha256=%x", mac.Sum(nil))
+}
+
+// verifyBody verifies the X-Hub-Signature signature of body against secret
+func verifyBody(secret, signature string, body []byte) bool {
+	parts := strings.SplitN(signature, "=", 2)
+	if len(parts) != 2 {
+		return false
+	}
+
+	var h func() hash.Hash
+	switch strings.ToLower(parts[0]) {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+
+	expected, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
 type callback struct {
-	topic string
+	topic   string
+	content []byte
 }
 
 type notification struct {
 	topic    string
 	target   string
+	secret   string
+	content  []byte
 	attempts int
 }
 
@@ -69,15 +146,17 @@ type verification struct {
 type Subscriber struct {
 	Topic     string    `json:"topic"`
 	Callback  string    `json:"callback"`
+	Secret    string    `json:"secret,omitempty"`
 	Verified  bool      `json:"verified"`
 	CreatedAt time.Time `json:"created_at"`
 	ExpiresAt time.Time `json:"expires_at"`
 }
 
-func NewSubscriber(topic, callback string) *Subscriber {
+func NewSubscriber(topic, callback, secret string) *Subscriber {
 	return &Subscriber{
 		Topic:     topic,
 		Callback:  callback,
+		Secret:    secret,
 		CreatedAt: time.Now(),
 	}
 }
@@ -98,13 +177,22 @@ type Subscription struct {
 	confirmed bool
 	createdAt time.Time
 	expiresAt time.Time
+	renewedAt time.Time
 
-	Topic string
+	// secret is the hub.secret notifications are signed with and signed is
+	// set once a signed notification is received from the hub
+	secret string
+	signed bool
+
+	Topic    string
+	Callback string
 }
 
-func NewSubscription(topic string) *Subscription {
+func NewSubscription(topic, callback string) *Subscription {
 	return &Subscription{
 		Topic:     topic,
+		Callback:  callback,
+		secret:    generateRandomSecret(),
 		createdAt: time.Now(),
 	}
 }
@@ -115,12 +203,20 @@ func (s *Subscription) MarshalJSON() ([]byte, error) {
 
 	o := struct {
 		Confirmed bool      `json:"confirmed"`
+		CreatedAt time.Time `json:"created_at"`
 		ExpiresAt time.Time `json:"expires_at"`
 		Topic     string    `json:"topic"`
+		Callback  string    `json:"callback"`
+		Secret    string    `json:"secret,omitempty"`
+		Signed    bool      `json:"signed"`
 	}{
 		Confirmed: s.confirmed,
+		CreatedAt: s.createdAt,
 		ExpiresAt: s.expiresAt,
 		Topic:     s.Topic,
+		Callback:  s.Callback,
+		Secret:    s.secret,
+		Signed:    s.signed,
 	}
 	return json.Marshal(o)
 }
@@ -128,8 +224,12 @@ func (s *Subscription) MarshalJSON() ([]byte, error) {
 func (s *Subscription) UnmarshalJSON(data []byte) error {
 	o := struct {
 		Confirmed bool      `json:"confirmed"`
+		CreatedAt time.Time `json:"created_at"`
 		ExpiresAt time.Time `json:"expires_at"`
 		Topic     string    `json:"topic"`
+		Callback  string    `json:"callback"`
+		Secret    string    `json:"secret,omitempty"`
+		Signed    bool      `json:"signed"`
 	}{}
 
 	if err := json.Unmarshal(data, &o); err != nil {
@@ -140,8 +240,12 @@ func (s *Subscription) UnmarshalJSON(data []byte) error {
 	defer s.Unlock()
 
 	s.confirmed = o.Confirmed
+	s.createdAt = o.CreatedAt
 	s.expiresAt = o.ExpiresAt
 	s.Topic = o.Topic
+	s.Callback = o.Callback
+	s.secret = o.Secret
+	s.signed = o.Signed
 
 	return nil
 }
@@ -164,7 +268,23 @@ func (s *Subscription) Timedout(timeout time.Duration) bool {
 	s.RLock()
 	defer s.RUnlock()
 
-	return s.createdAt.Add(timeout).After(time.Now())
+	return time.Now().After(s.createdAt.Add(timeout))
+}
+
+// DueForRenewal returns true if the subscription is confirmed and its lease
+// expires within before and it was not renewed within the last retry
+func (s *Subscription) DueForRenewal(before, retry time.Duration) bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.confirmed && s.Callback != "" &&
+		time.Until(s.expiresAt) < before && time.Since(s.renewedAt) > retry
+}
+
+func (s *Subscription) markRenewed() {
+	s.Lock()
+	s.renewedAt = time.Now()
+	s.Unlock()
 }
 
 func (s *Subscription) Expired() bool {
@@ -174,6 +294,32 @@ func (s *Subscription) Expired() bool {
 	return time.Now().After(s.expiresAt)
 }
 
+// Active returns true if the subscription is confirmed, has not expired and
+// notifications can be trusted. Subscriptions with a secret are only trusted
+// once a signed notification is received as hubs that do not support
+// hub.secret send unsigned notifications which are ignored.
+func (s *Subscription) Active() bool {
+	s.RLock()
+	defer s.RUnlock()
+
+	return s.confirmed && time.Now().Before(s.expiresAt) && (s.secret == "" || s.signed)
+}
+
+// Verify verifies the signature of a notification for the subscription
+func (s *Subscription) Verify(signature string, body []byte) bool {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.secret == "" {
+		return true
+	}
+	if !verifyBody(s.secret, signature, body) {
+		return false
+	}
+	s.signed = true
+	return true
+}
+
 type WebSubStats struct {
 	Topics int
 
@@ -182,6 +328,11 @@ type WebSubStats struct {
 
 	Subscriptions int
 	Confirmed     int
+	Active        int
+	Expired       int
+
+	Renewals      int
+	RenewalErrors int
 }
 
 type WebSub struct {
@@ -209,16 +360,27 @@ type WebSub struct {
 	verifyTicker *time.Ticker
 
 	cleanupTicker *time.Ticker
+	renewTicker   *time.Ticker
 	stateTicker   *time.Ticker
 
+	// renewals and renewalErrors count the renewals of subscriptions sent
+	renewals      int
+	renewalErrors int
+
 	// Notify is the callback called when processing inbound notifications requests
-	// from a hub we're subscribed to as a client for a given topic
-	Notify func(topic string) error
+	// from a hub we're subscribed to as a client for a given topic. The content
+	// is the changed portion of the topic (fat ping) if the notification was
+	// signed with the subscription's secret or nil otherwise (thin ping).
+	Notify func(topic string, content []byte) error
 
 	// ValidateTopic is a function that takes a `topic` string as input and returns `true` if it is
 	// a valid topic or `false` otherwise. Consumers should override this field with a custom
 	// topic validation function that suits the application.
 	ValidateTopic func(topic string) bool
+
+	// Client is the HTTP client used for all requests to hubs, subscribers and
+	// topics, consumers may override it (e.g: to restrict the addresses fetched)
+	Client *http.Client
 }
 
 func NewWebSub(fn, endpoint string) *WebSub {
@@ -231,8 +393,9 @@ func NewWebSub(fn, endpoint string) *WebSub {
 		outbox:        make(chan *notification, defaultWebSubQueueSize),
 		verify:        make(chan *verification, defaultWebSubQueueSize),
 
-		Notify:        func(topic string) error { return nil },
+		Notify:        func(topic string, content []byte) error { return nil },
 		ValidateTopic: func(topic string) bool { return true },
+		Client:        http.DefaultClient,
 	}
 
 	ws.inboxTicker = time.NewTicker(1 * time.Second)
@@ -263,6 +426,13 @@ func NewWebSub(fn, endpoint string) *WebSub {
 		}
 	}()
 
+	ws.renewTicker = time.NewTicker(1 * time.Minute)
+	go func() {
+		for range ws.renewTicker.C {
+			ws.renew()
+		}
+	}()
+
 	ws.stateTicker = time.NewTicker(1 * time.Minute)
 	go func() {
 		for range ws.stateTicker.C {
@@ -285,7 +455,8 @@ func (ws *WebSub) Load() error {
 	}
 
 	state := struct {
-		Subscribers map[string]Subscribers
+		Subscribers   map[string]Subscribers
+		Subscriptions map[string]*Subscription
 	}{}
 
 	if err := json.Unmarshal(data, &state); err != nil {
@@ -294,7 +465,12 @@ func (ws *WebSub) Load() error {
 	}
 
 	ws.Lock()
-	ws.subscribers = state.Subscribers
+	if state.Subscribers != nil {
+		ws.subscribers = state.Subscribers
+	}
+	if state.Subscriptions != nil {
+		ws.subscriptions = state.Subscriptions
+	}
 	ws.Unlock()
 
 	return nil
@@ -305,9 +481,11 @@ func (ws *WebSub) Save() error {
 	defer ws.RUnlock()
 
 	state := struct {
-		Subscribers map[string]Subscribers
+		Subscribers   map[string]Subscribers
+		Subscriptions map[string]*Subscription
 	}{
-		Subscribers: ws.subscribers,
+		Subscribers:   ws.subscribers,
+		Subscriptions: ws.subscriptions,
 	}
 
 	data, err := json.Marshal(state)
@@ -315,7 +493,8 @@ func (ws *WebSub) Save() error {
 		return fmt.Errorf("error serializing state: %s", err)
 	}
 
-	if err := os.WriteFile(ws.fn, data, 0644); err != nil {
+	// State includes the secrets of subscribers and subscriptions
+	if err := os.WriteFile(ws.fn, data, 0600); err != nil {
 		return fmt.Errorf("error saving state: %w", err)
 	}
 
@@ -349,6 +528,36 @@ func (ws *WebSub) cleanup() {
 	}
 }
 
+// renew renews subscriptions from this client ahead of their lease expiring
+// so that notifications keep being delivered instead of falling back to
+// polling the subscribed feeds
+func (ws *WebSub) renew() {
+	var due []*Subscription
+
+	ws.RLock()
+	for _, subscription := range ws.subscriptions {
+		if subscription.DueForRenewal(defaultWebSubRenewBefore, defaultWebSubRenewRetry) {
+			due = append(due, subscription)
+		}
+	}
+	ws.RUnlock()
+
+	for _, subscription := range due {
+		subscription.markRenewed()
+
+		websubLogger().Debugf("renewing websub subscription for %s", subscription.Topic)
+		err := ws.Subscribe(subscription.Topic, subscription.Callback)
+
+		ws.Lock()
+		if err != nil {
+			ws.renewalErrors++
+		} else {
+			ws.renewals++
+		}
+		ws.Unlock()
+	}
+}
+
 func (ws *WebSub) addSubscriber(subscriber *Subscriber) {
 	ws.subscribers[subscriber.Topic] = append(ws.subscribers[subscriber.Topic], subscriber)
 }
@@ -400,42 +609,54 @@ func (ws *WebSub) DelSubscriber(topic string, idx int) {
 }
 
 func (ws *WebSub) Subscribe(uri, callback string) error {
-	log.Debugf("creating websub subscription for %s", uri)
+	websubLogger().Debugf("creating websub subscription for %s", uri)
 
 	u, err := url.Parse(uri)
 	if err != nil {
-		log.WithError(err).Errorf("error parsing uri %s", uri)
+		websubLogger().WithError(err).Errorf("error parsing uri %s", uri)
 		return err
 	}
 
 	if _, err := url.Parse(callback); err != nil {
-		log.WithError(err).Errorf("error parsing cwllback %s", callback)
+		websubLogger().WithError(err).Errorf("error parsing cwllback %s", callback)
 		return err
 	}
 
 	hubEndpoint, selfURL, err := ws.GetHubEndpoint(u)
 	if err != nil {
-		log.WithError(err).Errorf("error discovering hub endpoint for %s", uri)
+		websubLogger().WithError(err).Errorf("error discovering hub endpoint for %s", uri)
 		return err
 	}
-	log.Debugf("found hub endpoint: %s", hubEndpoint.String())
-	log.Debugf("found self url: %s", selfURL.String())
+	websubLogger().Debugf("found hub endpoint: %s", hubEndpoint.String())
+	websubLogger().Debugf("found self url: %s", selfURL.String())
 
 	topic := selfURL.String()
 
+	// Keep existing subscriptions (being renewed) confirmed until they expire
 	ws.Lock()
-	ws.subscriptions[topic] = NewSubscription(topic)
+	subscription, ok := ws.subscriptions[topic]
+	if !ok {
+		subscription = NewSubscription(topic, callback)
+		ws.subscriptions[topic] = subscription
+	}
 	ws.Unlock()
 
+	subscription.RLock()
+	secret := subscription.secret
+	subscription.RUnlock()
+
 	values := make(url.Values)
 	values.Set("hub.mode", "subscribe")
 	values.Set("hub.topic", topic)
 	values.Set("hub.callback", callback)
-	log.Debugf("Sending websub subscription request to %s", hubEndpoint.String())
-	log.Debugf("values: %q", values)
-	res, err := http.PostForm(hubEndpoint.String(), values)
+	if secret != "" {
+		values.Set("hub.secret", secret)
+	}
+	websubLogger().Debugf("Sending websub subscription request to %s", hubEndpoint.String())
+	websubLogger().Debugf("values: %q", values)
+	res, err := ws.Client.PostForm(hubEndpoint.String(), values)
 	if err != nil {
-		log.WithError(err).Errorf(
+		websubLogger().WithError(err).Errorf(
 			"error sending websub subscription request to hubEndpoint=%s",
 			hubEndpoint.String(),
 		)
@@ -448,10 +669,10 @@ func (ws *WebSub) Subscribe(uri, callback string) error {
 			"bad response %s from subscription request for to hubEndpoint=%s",
 			res.Status, hubEndpoint.String(),
 		)
-		log.Error(err)
+		websubLogger().Error(err)
 		return err
 	}
-	log.Debugf("successfully sent websub subscription to %s for %s with callback %s", hubEndpoint.String(), uri, callback)
+	websubLogger().Debugf("successfully sent websub subscription to %s for %s with callback %s", hubEndpoint.String(), uri, callback)
 
 	return nil
 }
@@ -473,15 +694,15 @@ func (ws *WebSub) IsSubscribed(topic string) bool {
 }
 
 func (ws *WebSub) GetHubEndpoint(target *url.URL) (hubEndpoint *url.URL, selfURL *url.URL, err error) {
-	res, err := http.Get(target.String())
+	res, err := ws.Client.Get(target.String())
 	if err != nil {
-		log.WithError(err).Error("error getting hub endpoint")
+		websubLogger().WithError(err).Error("error getting hub endpoint")
 		return nil, nil, err
 	}
 	defer res.Body.Close()
 
 	links := GetHeaderLinks(res.Header["Link"])
-	log.Debugf("links: %v", links)
+	websubLogger().Debugf("links: %v", links)
 	for _, link := range links {
 		for _, rel := range link.Params["rel"] {
 			if rel == "hub" {
@@ -493,10 +714,10 @@ func (ws *WebSub) GetHubEndpoint(target *url.URL) (hubEndpoint *url.URL, selfURL
 		}
 	}
 	if hubEndpoint == nil {
-		log.Debugf("no hub endpoint found in HTTP Header Links")
+		websubLogger().Debugf("no hub endpoint found in HTTP Header Links")
 	}
 	if selfURL == nil {
-		log.Debugf("no self url found in HTTP Header Links")
+		websubLogger().Debugf("no self url found in HTTP Header Links")
 	}
 	if hubEndpoint != nil && selfURL != nil {
 		return
@@ -509,31 +730,31 @@ func (ws *WebSub) GetHubEndpoint(target *url.URL) (hubEndpoint *url.URL, selfURL
 
 	data := microformats.Parse(res.Body, target)
 
-	log.Debugf("Rels: %v", data.Rels["hub"])
+	websubLogger().Debugf("Rels: %v", data.Rels["hub"])
 	for _, link := range data.Rels["hub"] {
 		u, err := url.Parse(link)
 		if err != nil {
-			log.WithError(err).Warn("error parsing hub link")
+			websubLogger().WithError(err).Warn("error parsing hub link")
 			continue
 		}
 		hubEndpoint = u
 	}
 
-	log.Debugf("Rels: %v", data.Rels["self"])
+	websubLogger().Debugf("Rels: %v", data.Rels["self"])
 	for _, link := range data.Rels["self"] {
 		u, err := url.Parse(link)
 		if err != nil {
-			log.WithError(err).Warn("error parsing self link")
+			websubLogger().WithError(err).Warn("error parsing self link")
 			continue
 		}
 		selfURL = u
 	}
 
 	if hubEndpoint == nil {
-		log.Debugf("no hub endpoint found in Document")
+		websubLogger().Debugf("no hub endpoint found in Document")
 	}
 	if selfURL == nil {
-		log.Debugf("no self url found in Document")
+		websubLogger().Debugf("no self url found in Document")
 	}
 	if hubEndpoint != nil && selfURL != nil {
 		return
@@ -542,51 +763,60 @@ func (ws *WebSub) GetHubEndpoint(target *url.URL) (hubEndpoint *url.URL, selfURL
 	return nil, nil, fmt.Errorf("no hub endpoint found")
 }
 
+// SendNotification notifies subscribers of topic that it has changed so they
+// re-fetch the topic (thin ping)
 func (ws *WebSub) SendNotification(topic string) {
+	ws.SendContent(topic, nil)
+}
+
+// SendContent notifies subscribers of topic with the changed portion of the
+// topic as the content so they don't have to re-fetch it (fat ping)
+func (ws *WebSub) SendContent(topic string, content []byte) {
 	ws.RLock()
 	defer ws.RUnlock()
 
 	subs, ok := ws.subscribers[topic]
 	if !ok {
-		log.Debugf("no subscriptions found for %s", topic)
+		websubLogger().Debugf("no subscriptions found for %s", topic)
 		return
 	}
-	log.Debugf("%d subscriptions found for %s", len(subs), topic)
+	websubLogger().Debugf("%d subscriptions found for %s", len(subs), topic)
 
 	for _, sub := range subs {
-		ws.outbox <- &notification{topic: topic, target: sub.Callback}
+		ws.outbox <- &notification{topic: topic, target: sub.Callback, secret: sub.Secret, content: content}
 	}
 }
 
 func (ws *WebSub) NotifyEndpoint(w http.ResponseWriter, r *http.Request) {
-	log.Debugf("NotifyEndpoint:")
+	websubLogger().Debugf("NotifyEndpoint:")
 
 	mode := r.FormValue("hub.mode")
 	topic := r.FormValue("hub.topic")
 	challenge := r.FormValue("hub.challenge")
 	leaseSeconds := r.FormValue("hub.lease_seconds")
 
-	log.Debugf("mode: %s", mode)
-	log.Debugf("topic: %s", topic)
-	log.Debugf("challenge: %s", challenge)
+	websubLogger().Debugf("mode: %s", mode)
+	websubLogger().Debugf("topic: %s", topic)
+	websubLogger().Debugf("challenge: %s", challenge)
 
 	if strings.ToLower(mode) == "subscribe" {
-		if !ws.IsSubscribed(topic) {
-			n, err := strconv.Atoi(leaseSeconds)
-			if err != nil {
-				log.WithError(err).Errorf("error parsing leaseSeconds %s", leaseSeconds)
-				http.Error(w, "Bad hub.lease_seconds", http.StatusNotFound)
-				return
-			}
+		n, err := strconv.Atoi(leaseSeconds)
+		if err != nil {
+			websubLogger().WithError(err).Errorf("error parsing leaseSeconds %s", leaseSeconds)
+			http.Error(w, "Bad hub.lease_seconds", http.StatusNotFound)
+			return
+		}
 
-			sub := ws.GetSubscription(topic)
-			if sub == nil {
-				log.Debugf("no subscription found for topic=%s", topic)
-				http.Error(w, "Subscription Not Found", http.StatusNotFound)
-				return
-			}
-			sub.Confirm(n)
+		sub := ws.GetSubscription(topic)
+		if sub == nil {
+			websubLogger().Debugf("no subscription found for topic=%s", topic)
+			http.Error(w, "Subscription Not Found", http.StatusNotFound)
+			return
 		}
+
+		// Confirms new subscriptions and extends the lease of renewed ones
+		sub.Confirm(n)
+
 		http.Error(w, challenge, http.StatusAccepted)
 		return
 	}
@@ -597,7 +827,7 @@ func (ws *WebSub) NotifyEndpoint(w http.ResponseWriter, r *http.Request) {
 	)
 
 	links := GetHeaderLinks(r.Header["Link"])
-	log.Debugf("links: %v", links)
+	websubLogger().Debugf("links: %v", links)
 	for _, link := range links {
 		for _, rel := range link.Params["rel"] {
 			if rel == "hub" {
@@ -610,22 +840,49 @@ func (ws *WebSub) NotifyEndpoint(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if hubEndpoint == nil {
-		log.Debugf("hub endpoint not found in request Link headers")
+		websubLogger().Debugf("hub endpoint not found in request Link headers")
 		http.Error(w, "Missing rel=hub Link", http.StatusNotFound)
 		return
 	}
 
 	if selfURL == nil {
-		log.Debugf("self url not found in request Link headers")
+		websubLogger().Debugf("self url not found in request Link headers")
 		http.Error(w, "Missing rel=self Link", http.StatusNotFound)
 		return
 	}
 
-	// TODO: Verify we actually have a valid and confirmed Subscription for
-	//       for the given topic (selfURL) with the Pod (hubEndpoint)
-	//       to prevent abuse of the WebSub /notify endpoint
+	// Notifications for topics we are not subscribed to or that are not
+	// signed with the subscription's secret are acknowledged but ignored
+	// to prevent abuse of the WebSub /notify endpoint
+	sub := ws.GetSubscription(selfURL.String())
+	if sub == nil {
+		websubLogger().Debugf("ignoring notification for unknown topic=%s", selfURL.String())
+		http.Error(w, "Notification Ignored", http.StatusAccepted)
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		websubLogger().WithError(err).Errorf("error reading notification for topic=%s", selfURL.String())
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	if !sub.Verify(r.Header.Get(webSubSignatureHeader), body) {
+		websubLogger().Warnf("ignoring notification for topic=%s with a missing or invalid signature", selfURL.String())
+		http.Error(w, "Notification Ignored", http.StatusAccepted)
+		return
+	}
+
+	// Only trust the content of notifications signed with our secret
+	sub.RLock()
+	signed := sub.secret != ""
+	sub.RUnlock()
+	if !signed || len(body) == 0 {
+		body = nil
+	}
 
-	ws.inbox <- &callback{topic: selfURL.String()}
+	ws.inbox <- &callback{topic: selfURL.String(), content: body}
 
 	http.Error(w, "Notification Enqueued for Processing", http.StatusAccepted)
 }
@@ -649,8 +906,16 @@ func (ws *WebSub) Stats() (stats WebSubStats) {
 	for _, sub := range ws.subscriptions {
 		if sub.Confirmed() {
 			stats.Confirmed++
+			if sub.Expired() {
+				stats.Expired++
+			} else {
+				stats.Active++
+			}
 		}
 	}
+
+	stats.Renewals = ws.renewals
+	stats.RenewalErrors = ws.renewalErrors
 	return
 }
 
@@ -679,34 +944,41 @@ func (ws *WebSub) DebugEndpoint(w http.ResponseWriter, r *http.Request) {
 }
 
 func (ws *WebSub) WebSubEndpoint(w http.ResponseWriter, r *http.Request) {
-	log.Debug("WebSubEndpoint:")
+	websubLogger().Debug("WebSubEndpoint:")
 	mode := r.FormValue("hub.mode")
 	topic := r.FormValue("hub.topic")
 	callback := r.FormValue("hub.callback")
+	secret := r.FormValue("hub.secret")
+
+	websubLogger().Debugf("mode: %s", mode)
+	websubLogger().Debugf("topic: %s", topic)
+	websubLogger().Debugf("callback: %s", callback)
 
-	log.Debugf("mode: %s", mode)
-	log.Debugf("topic: %s", topic)
-	log.Debugf("callback: %s", callback)
+	if len(secret) > maxWebSubSecretLength {
+		websubLogger().Errorf("hub.secret exceeds %d bytes", maxWebSubSecretLength)
+		http.Error(w, "Bad Secret", http.StatusBadRequest)
+		return
+	}
 
 	if strings.TrimSpace(callback) == "" {
-		log.Errorf("no callback provided")
+		websubLogger().Errorf("no callback provided")
 		http.Error(w, "No Callback", http.StatusBadRequest)
 		return
 	}
 
 	if _, err := url.Parse(callback); err != nil {
-		log.WithError(err).Errorf("error parsing callback %s", callback)
+		websubLogger().WithError(err).Errorf("error parsing callback %s", callback)
 		http.Error(w, "Bad Callback", http.StatusBadRequest)
 		return
 	}
 
 	if _, err := url.Parse(topic); err != nil {
-		log.WithError(err).Errorf("error parsing topic %s", callback)
+		websubLogger().WithError(err).Errorf("error parsing topic %s", callback)
 		http.Error(w, "Bad Topic", http.StatusBadRequest)
 		return
 	}
 	if !ws.ValidateTopic(topic) {
-		log.Debugf("invalid topic %q", topic)
+		websubLogger().Debugf("invalid topic %q", topic)
 		http.Error(w, "Invalid Topic", http.StatusBadRequest)
 		return
 	}
@@ -714,8 +986,12 @@ func (ws *WebSub) WebSubEndpoint(w http.ResponseWriter, r *http.Request) {
 	switch strings.ToLower(mode) {
 
 	case "subscribe":
-		if !ws.HasSubscriberFor(topic, callback) {
-			ws.AddSubscriber(NewSubscriber(topic, callback))
+		if subscriber, idx := ws.GetSubscriberFor(topic, callback); idx == -1 {
+			ws.AddSubscriber(NewSubscriber(topic, callback, secret))
+		} else {
+			ws.Lock()
+			subscriber.Secret = secret
+			ws.Unlock()
 		}
 		ws.verify <- &verification{
 			target:       callback,
@@ -736,15 +1012,15 @@ func (ws *WebSub) WebSubEndpoint(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Debugf("invalid mode %q", mode)
+	websubLogger().Debugf("invalid mode %q", mode)
 	http.Error(w, "Invalid Mode", http.StatusBadRequest)
 }
 
 func (ws *WebSub) processInbox() {
 	notification := <-ws.inbox
 
-	if err := ws.Notify(notification.topic); err != nil {
-		log.WithError(err).Errorf("error processing notification for %s", notification.topic)
+	if err := ws.Notify(notification.topic, notification.content); err != nil {
+		websubLogger().WithError(err).Errorf("error processing notification for %s", notification.topic)
 	}
 }
 
@@ -753,16 +1029,16 @@ func (ws *WebSub) processOutbox() {
 	notification.attempts++
 
 	if notification.attempts > defaultWebSubRedeliveryAttempts {
-		log.Errorf(
+		websubLogger().Errorf(
 			"giving up processing notification for topic=%s target=%s after %d attempts",
 			notification.topic, notification.target, notification.attempts,
 		)
 		return
 	}
 
-	req, err := http.NewRequest(http.MethodPost, notification.target, nil)
+	req, err := http.NewRequest(http.MethodPost, notification.target, bytes.NewReader(notification.content))
 	if err != nil {
-		log.WithError(err).Errorf(
+		websubLogger().WithError(err).Errorf(
 			"error creating notification request for topic=%s target=%s",
 			notification.topic, notification.target,
 		)
@@ -771,14 +1047,19 @@ func (ws *WebSub) processOutbox() {
 
 	req.Header.Add("Link", fmt.Sprintf(`<%s/websub>; rel="hub"`, ws.endpoint))
 	req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="self"`, notification.topic))
-
-	client := http.Client{
-		Timeout: time.Second * 5,
+	if len(notification.content) > 0 {
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
 	}
+	if notification.secret != "" {
+		req.Header.Set(webSubSignatureHeader, signBody(notification.secret, notification.content))
+	}
+
+	client := *ws.Client
+	client.Timeout = time.Second * 5
 
 	res, err := client.Do(req)
 	if err != nil {
-		log.WithError(err).Errorf(
+		websubLogger().WithError(err).Errorf(
 			"error sending notification request for topic=%s target=%s",
 			notification.topic, notification.target,
 		)
@@ -787,14 +1068,14 @@ func (ws *WebSub) processOutbox() {
 	defer res.Body.Close()
 
 	if res.StatusCode != http.StatusAccepted {
-		log.Errorf(
+		websubLogger().Errorf(
 			"bad response %s from callback for topic=%s target=%s",
 			res.Status, notification.topic, notification.target,
 		)
 		return
 	}
 
-	log.Debugf("successfully sent notification to %s", notification.target)
+	websubLogger().Debugf("successfully sent notification to %s", notification.target)
 }
 
 func (ws *WebSub) processVerify() {
@@ -802,7 +1083,7 @@ func (ws *WebSub) processVerify() {
 	verification.attempts++
 
 	if verification.attempts > defaultWebSubRedeliveryAttempts {
-		log.Errorf(
+		websubLogger().Errorf(
 			"giving up processing verificationg for topic=%s callbac=%s after %d attempts",
 			verification.topic, verification.callback, verification.attempts,
 		)
@@ -817,7 +1098,7 @@ func (ws *WebSub) processVerify() {
 
 	req, err := http.NewRequest(http.MethodGet, verification.target, nil)
 	if err != nil {
-		log.WithError(err).Errorf(
+		websubLogger().WithError(err).Errorf(
 			"error creating verification request topic=%s callbac=%s",
 			verification.topic, verification.callback,
 		)
@@ -833,16 +1114,15 @@ func (ws *WebSub) processVerify() {
 	qs.Set("hub.challenge", verification.challenge)
 	qs.Set("hub.lease_seconds", fmt.Sprintf("%d", verification.leaseSeconds))
 	req.URL.RawQuery = qs.Encode()
-	log.Debugf("Sending websub verification request to %s", verification.target)
-	log.Debugf("req.URL.Query(): %q", req.URL.Query())
+	websubLogger().Debugf("Sending websub verification request to %s", verification.target)
+	websubLogger().Debugf("req.URL.Query(): %q", req.URL.Query())
 
-	client := http.Client{
-		Timeout: time.Second * 5,
-	}
+	client := *ws.Client
+	client.Timeout = time.Second * 5
 
 	res, err := client.Do(req)
 	if err != nil {
-		log.WithError(err).Errorf(
+		websubLogger().WithError(err).Errorf(
 			"error sending verification request topic=%s callbac=%s",
 			verification.topic, verification.callback,
 		)
@@ -851,18 +1131,18 @@ func (ws *WebSub) processVerify() {
 	defer res.Body.Close()
 
 	if res.StatusCode/100 != 2 {
-		log.Errorf(
+		websubLogger().Errorf(
 			"bad response %s from verification for topic=%s callbac=%s",
 			res.Status, verification.topic, verification.callback,
 		)
 		return
 	}
 
-	log.Debugf("successfully sent verification to %s", verification.target)
+	websubLogger().Debugf("successfully sent verification to %s", verification.target)
 
 	body, err := io.ReadAll(res.Body)
 	if err != nil {
-		log.WithError(err).Errorf(
+		websubLogger().WithError(err).Errorf(
 			"error reading verification response for topic=%s callback=%s",
 			verification.topic, verification.callback,
 		)
@@ -870,7 +1150,7 @@ func (ws *WebSub) processVerify() {
 	}
 	response := strings.TrimSpace(string(body))
 	if response != verification.challenge {
-		log.Debugf(
+		websubLogger().Debugf(
 			"challenge verification failed for topic=%s callbac=%s %q != %q",
 			verification.topic, verification.callback,
 			response, verification.challenge,
@@ -880,10 +1160,10 @@ func (ws *WebSub) processVerify() {
 
 	subscriber, idx := ws.GetSubscriberFor(verification.topic, verification.callback)
 	if idx == -1 {
-		log.Errorf("no subscriber found for topic=%s callback=%s but verification was sent?!", verification.topic, verification.callback)
+		websubLogger().Errorf("no subscriber found for topic=%s callback=%s but verification was sent?!", verification.topic, verification.callback)
 		return
 	}
 	subscriber.Verified = true
 	subscriber.ExpiresAt = time.Now().Add(time.Duration(verification.leaseSeconds) * time.Second)
-	log.Debugf("successfully verified subscriber for topic=%s callback=%s", verification.topic, verification.callback)
+	websubLogger().Debugf("successfully verified subscriber for topic=%s callback=%s", verification.topic, verification.callback)
 }
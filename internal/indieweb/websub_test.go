@@ -0,0 +1,70 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package indieweb
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionRenewal(t *testing.T) {
+	assert := assert.New(t)
+
+	sub := NewSubscription("https://example.com/user/alice/twtxt.txt", "https://pod.example.com/notify")
+	assert.False(sub.DueForRenewal(defaultWebSubRenewBefore, defaultWebSubRenewRetry))
+	assert.False(sub.Timedout(defaulWebSubTimeout))
+
+	sub.Confirm(int(defaultWebSubLeaseTime.Seconds()))
+	assert.False(sub.DueForRenewal(defaultWebSubRenewBefore, defaultWebSubRenewRetry))
+
+	sub.Confirm(60)
+	assert.True(sub.DueForRenewal(defaultWebSubRenewBefore, defaultWebSubRenewRetry))
+
+	sub.markRenewed()
+	assert.False(sub.DueForRenewal(defaultWebSubRenewBefore, defaultWebSubRenewRetry))
+}
+
+func TestSubscriptionJSON(t *testing.T) {
+	assert := assert.New(t)
+
+	sub := NewSubscription("https://example.com/user/alice/twtxt.txt", "https://pod.example.com/notify")
+	sub.Confirm(3600)
+
+	data, err := json.Marshal(sub)
+	assert.NoError(err)
+
+	loaded := &Subscription{}
+	assert.NoError(json.Unmarshal(data, loaded))
+	assert.Equal(sub.Topic, loaded.Topic)
+	assert.Equal(sub.Callback, loaded.Callback)
+	assert.True(loaded.Confirmed())
+	assert.False(loaded.Expired())
+	assert.WithinDuration(sub.createdAt, loaded.createdAt, time.Second)
+}
+
+func TestSubscriptionSignatures(t *testing.T) {
+	assert := assert.New(t)
+
+	body := []byte("2022-03-01T12:00:00Z\tHello World!\n")
+
+	sub := NewSubscription("https://example.com/user/alice/twtxt.txt", "https://pod.example.com/notify")
+	sub.Confirm(3600)
+	assert.False(sub.Active())
+
+	assert.False(sub.Verify("", body))
+	assert.False(sub.Verify(signBody("wrong secret", body), body))
+	assert.False(sub.Verify("md5=d41d8cd98f00b204e9800998ecf8427e", body))
+	assert.False(sub.Active())
+
+	assert.True(sub.Verify(signBody(sub.secret, body), body))
+	assert.True(sub.Active())
+
+	unsigned := &Subscription{Topic: sub.Topic}
+	unsigned.Confirm(3600)
+	assert.True(unsigned.Verify("", body))
+	assert.True(unsigned.Active())
+}
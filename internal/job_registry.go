@@ -0,0 +1,331 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/robfig/cron"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+// jobHistorySize is the number of runs kept in the status history of a job
+const jobHistorySize = 10
+
+var (
+	// ErrJobNotFound is returned for an unknown background job
+	ErrJobNotFound = errors.New("error: job not found")
+
+	// ErrJobRunning is returned when a job is run while already running
+	ErrJobRunning = errors.New("error: job already running")
+
+	// ErrInvalidJobAction is returned for an unknown action on a job
+	ErrInvalidJobAction = errors.New("error: invalid job action")
+)
+
+// FallibleJob is a Job that returns the error of a run, recorded in the
+// job's status history (Run logs it)
+type FallibleJob interface {
+	Job
+	RunE() error
+}
+
+// JobRun is a run of a background job
+type JobRun struct {
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	Manual    bool          `json:"manual"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// JobStatus is the status of a background job, History is most recent first
+type JobStatus struct {
+	Name     string    `json:"name"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+	Disabled bool      `json:"disabled"`
+	Running  bool      `json:"running"`
+	History  []JobRun  `json:"history"`
+}
+
+// LastRun returns the most recent run of the job (zero if never run)
+func (s JobStatus) LastRun() JobRun {
+	if len(s.History) == 0 {
+		return JobRun{}
+	}
+	return s.History[0]
+}
+
+// JobRegistry tracks the background jobs (See: Jobs) so their runs, duration
+// and errors are recorded and they can be run on demand or disabled at
+// runtime. Disabled jobs are skipped when scheduled.
+type JobRegistry struct {
+	sync.RWMutex
+
+	jobs map[string]*TrackedJob
+}
+
+// NewJobRegistry ...
+func NewJobRegistry() *JobRegistry {
+	return &JobRegistry{jobs: make(map[string]*TrackedJob)}
+}
+
+// Track registers a job with its schedule (empty for jobs only run on
+// startup or on demand) and returns the job to schedule. Tracking a job again
+// (e.g: after its schedule changed) keeps its status.
+func (r *JobRegistry) Track(name, schedule string, job Job) *TrackedJob {
+	r.Lock()
+	defer r.Unlock()
+
+	tj, ok := r.jobs[name]
+	if !ok {
+		tj = &TrackedJob{name: name}
+		r.jobs[name] = tj
+	}
+
+	tj.Lock()
+	tj.job = job
+	tj.schedule = schedule
+	tj.Unlock()
+
+	return tj
+}
+
+// Get returns a tracked job by name (case insensitive)
+func (r *JobRegistry) Get(name string) (*TrackedJob, bool) {
+	r.RLock()
+	defer r.RUnlock()
+
+	for key, tj := range r.jobs {
+		if strings.EqualFold(key, name) {
+			return tj, true
+		}
+	}
+	return nil, false
+}
+
+// Statuses returns the status of all jobs ordered by name
+func (r *JobRegistry) Statuses() []JobStatus {
+	r.RLock()
+	defer r.RUnlock()
+
+	var statuses []JobStatus
+	for _, tj := range r.jobs {
+		statuses = append(statuses, tj.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses
+}
+
+// TrackedJob is a background job tracked by the JobRegistry
+type TrackedJob struct {
+	sync.RWMutex
+
+	name     string
+	schedule string
+	job      Job
+	disabled bool
+	running  bool
+	history  []JobRun
+}
+
+func (tj *TrackedJob) String() string { return tj.name }
+
+// Run runs the job as scheduled, unless it is disabled or already running
+func (tj *TrackedJob) Run() {
+	tj.RLock()
+	disabled := tj.disabled
+	tj.RUnlock()
+
+	if disabled {
+		log.Debugf("skipping disabled job %s", tj.name)
+		return
+	}
+
+	if err := tj.run(false); err == ErrJobRunning {
+		log.Warnf("skipping job %s still running", tj.name)
+	}
+}
+
+// RunNow runs the job on demand even if disabled
+func (tj *TrackedJob) RunNow() error {
+	return tj.run(true)
+}
+
+func (tj *TrackedJob) run(manual bool) (err error) {
+	tj.Lock()
+	if tj.running {
+		tj.Unlock()
+		return ErrJobRunning
+	}
+	tj.running = true
+	job := tj.job
+	tj.Unlock()
+
+	run := JobRun{StartedAt: time.Now(), Manual: manual}
+
+	defer func() {
+		if e := recover(); e != nil {
+			log.Errorf("job %s panicked: %v", tj.name, e)
+			err = fmt.Errorf("panic: %v", e)
+		}
+
+		run.Duration = time.Since(run.StartedAt)
+		if err != nil {
+			run.Error = err.Error()
+		}
+
+		tj.Lock()
+		tj.running = false
+		tj.history = append([]JobRun{run}, tj.history...)
+		if len(tj.history) > jobHistorySize {
+			tj.history = tj.history[:jobHistorySize]
+		}
+		tj.Unlock()
+	}()
+
+	if fj, ok := job.(FallibleJob); ok {
+		if err := fj.RunE(); err != nil {
+			log.WithError(err).Warnf("error running job %s", tj.name)
+			return err
+		}
+		return nil
+	}
+
+	job.Run()
+	return nil
+}
+
+// SetDisabled disables or enables the job
+func (tj *TrackedJob) SetDisabled(disabled bool) {
+	tj.Lock()
+	defer tj.Unlock()
+
+	tj.disabled = disabled
+}
+
+// Status returns the status of the job
+func (tj *TrackedJob) Status() JobStatus {
+	tj.RLock()
+	defer tj.RUnlock()
+
+	status := JobStatus{
+		Name:     tj.name,
+		Schedule: tj.schedule,
+		Disabled: tj.disabled,
+		Running:  tj.running,
+		History:  append([]JobRun(nil), tj.history...),
+	}
+
+	if tj.schedule != "" && !tj.disabled {
+		if schedule, err := cron.Parse(tj.schedule); err == nil {
+			status.Next = schedule.Next(time.Now())
+		}
+	}
+
+	return status
+}
+
+// manageJob runs a job on demand (in the background), disables or enables it
+// given the action "run", "disable" or "enable"
+func manageJob(tasks *Dispatcher, name, action string) error {
+	job, ok := jobRegistry.Get(name)
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	switch action {
+	case "run":
+		_, err := tasks.DispatchFuncWithPriority(context.Background(), TaskPriorityBackground, job.RunNow)
+		return err
+	case "disable":
+		job.SetDisabled(true)
+	case "enable":
+		job.SetDisabled(false)
+	default:
+		return ErrInvalidJobAction
+	}
+
+	return nil
+}
+
+// AdminJobsEndpoint returns the status of the background jobs
+func (a *API) AdminJobsEndpoint() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(a.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if !isAdminUser(user) {
+			apiError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden")
+			return
+		}
+
+		data, err := json.Marshal(jobRegistry.Statuses())
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing jobs")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// AdminJobEndpoint runs a background job now, disables or enables it
+// (See: manageJob) and returns its status
+func (a *API) AdminJobEndpoint() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(a.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if !isAdminUser(user) {
+			apiError(w, http.StatusForbidden, ErrCodeForbidden, "Forbidden")
+			return
+		}
+
+		name, action := p.ByName("name"), p.ByName("action")
+
+		if err := manageJob(a.tasks, name, action); err != nil {
+			switch err {
+			case ErrJobNotFound:
+				apiError(w, http.StatusNotFound, ErrCodeNotFound, "Job Not Found")
+			case ErrInvalidJobAction:
+				apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid Action")
+			default:
+				apiLogger(r).WithError(err).Errorf("error managing job %s (%s)", name, action)
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			}
+			return
+		}
+
+		if err := audit.Record(user.Username, fmt.Sprintf("%s job", action), name, ""); err != nil {
+			apiLogger(r).WithError(err).Error("error recording audit entry")
+		}
+
+		job, _ := jobRegistry.Get(name)
+
+		data, err := json.Marshal(job.Status())
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing job")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testJob struct {
+	runs int
+	err  error
+}
+
+func (job *testJob) String() string { return "Test" }
+func (job *testJob) Run()           { _ = job.RunE() }
+func (job *testJob) RunE() error {
+	job.runs++
+	return job.err
+}
+
+func TestTrackedJob(t *testing.T) {
+	registry := NewJobRegistry()
+	job := &testJob{err: errors.New("boom")}
+
+	tj := registry.Track("Test", "@hourly", job)
+
+	tj.Run()
+	require.Equal(t, 1, job.runs)
+
+	status := tj.Status()
+	require.Len(t, status.History, 1)
+	assert.Equal(t, "boom", status.LastRun().Error)
+	assert.False(t, status.LastRun().Manual)
+	assert.False(t, status.Next.IsZero())
+
+	// Disabled jobs are skipped when scheduled but can be run now
+	tj.SetDisabled(true)
+	tj.Run()
+	assert.Equal(t, 1, job.runs)
+
+	job.err = nil
+	require.NoError(t, tj.RunNow())
+	assert.Equal(t, 2, job.runs)
+
+	status = tj.Status()
+	require.Len(t, status.History, 2)
+	assert.True(t, status.Disabled)
+	assert.True(t, status.LastRun().Manual)
+	assert.Empty(t, status.LastRun().Error)
+	assert.True(t, status.Next.IsZero())
+
+	// Tracking a job again keeps its status
+	same, ok := registry.Get("test")
+	require.True(t, ok)
+	assert.Len(t, registry.Track("Test", "@daily", job).Status().History, 2)
+	assert.Equal(t, tj, same)
+}
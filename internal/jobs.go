@@ -38,8 +38,10 @@ var (
 func InitJobs(conf *Config) {
 	Jobs = map[string]JobSpec{
 		"SyncStore":         NewJobSpec("@every 1m", NewSyncStoreJob),
+		"SnapshotCache":     NewJobSpec(fmt.Sprintf("@every %s", conf.CacheSnapshotInterval), NewSnapshotCacheJob),
 		"UpdateFeeds":       NewJobSpec(conf.FetchInterval, NewUpdateFeedsJob),
 		"UpdateFeedSources": NewJobSpec("@every 15m", NewUpdateFeedSourcesJob),
+		"UpdatePeers":       NewJobSpec("@hourly", NewUpdatePeersJob),
 
 		"ActiveUsers":       NewJobSpec("@hourly", NewActiveUsersJob),
 		"DeleteOldSessions": NewJobSpec("@hourly", NewDeleteOldSessionsJob),
@@ -49,6 +51,13 @@ func InitJobs(conf *Config) {
 		"PruneFollowers": NewJobSpec("0 0 2 * * 0", NewPruneFollowersJob),
 		"PruneUsers":     NewJobSpec("0 0 3 * * 0", NewPruneUsersJob),
 
+		"PurgeDeletedUsers": NewJobSpec("@hourly", NewPurgeDeletedUsersJob),
+
+		"PurgeExternalAvatars": NewJobSpec("0 0 4 * * 0", NewPurgeExternalAvatarsJob),
+		"PurgeProxiedImages":   NewJobSpec("0 0 5 * * *", NewPurgeProxiedImagesJob),
+		"VerifyProfileLinks":   NewJobSpec("0 0 6 * * 0", NewVerifyProfileLinksJob),
+		"PublishAnnouncements": NewJobSpec("@every 1m", NewPublishAnnouncementsJob),
+
 		"CreateAdminFeeds":     NewJobSpec("", NewCreateAdminFeedsJob),
 		"CreateAutomatedFeeds": NewJobSpec("", NewCreateAutomatedFeedsJob),
 
@@ -61,6 +70,7 @@ func InitJobs(conf *Config) {
 		"RotateFeeds":          Jobs["RotateFeeds"],
 		"UpdateFeeds":          Jobs["UpdateFeeds"],
 		"UpdateFeedSources":    Jobs["UpdateFeedSources"],
+		"UpdatePeers":          Jobs["UpdatePeers"],
 		"CreateAdminFeeds":     Jobs["CreateAdminFeeds"],
 		"CreateAutomatedFeeds": Jobs["CreateAutomatedFeeds"],
 		"DeleteOldSessions":    Jobs["DeleteOldSessions"],
@@ -85,10 +95,44 @@ func NewSyncStoreJob(conf *Config, cache *Cache, archive Archiver, db Store) Job
 func (job *SyncStoreJob) String() string { return "SyncStore" }
 
 func (job *SyncStoreJob) Run() {
-	if err := job.db.Sync(); err != nil {
+	if err := job.RunE(); err != nil {
 		log.WithError(err).Warn("error sycning store")
 	}
+}
+
+func (job *SyncStoreJob) RunE() error {
+	if err := job.db.Sync(); err != nil {
+		return err
+	}
 	log.Info("synced store")
+	return nil
+}
+
+type SnapshotCacheJob struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewSnapshotCacheJob(conf *Config, cache *Cache, archive Archiver, db Store) Job {
+	return &SnapshotCacheJob{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+func (job *SnapshotCacheJob) String() string { return "SnapshotCache" }
+
+func (job *SnapshotCacheJob) Run() {
+	if err := job.RunE(); err != nil {
+		log.WithError(err).Warn("error snapshotting feed cache")
+	}
+}
+
+func (job *SnapshotCacheJob) RunE() error {
+	if err := job.cache.Store(job.conf); err != nil {
+		return err
+	}
+	log.Info("snapshotted feed cache")
+	return nil
 }
 
 type StatsJob struct {
@@ -179,9 +223,12 @@ func (job *StatsJob) Run() {
 		len(users), len(feeds), twts, archiveSize, job.cache.TwtCount(), len(followers), len(following),
 	)
 
-	if _, err := job.appendTwt(adminUser, statsFeed, text); err != nil {
+	twt, err := job.appendTwt(adminUser, statsFeed, text)
+	if err != nil {
 		log.WithError(err).Warn("error updating stats feed")
+		return
 	}
+	PublishTwts(job.conf, nil, adminUser, job.conf.URLForUser(statsFeed.Name), string(VisibilityPublic), twt)
 }
 
 type UpdateFeedsJob struct {
@@ -247,7 +294,7 @@ func (job *UpdateFeedsJob) Run() {
 			if !job.cache.IsCached(source.URL) {
 				continue
 			}
-			if sub := websub.GetSubscription(source.URL); sub != nil && sub.Confirmed() && !sub.Expired() {
+			if sub := websub.GetSubscription(source.URL); sub != nil && sub.Active() {
 				delete(sources, source)
 				subscribed++
 			}
@@ -256,7 +303,10 @@ func (job *UpdateFeedsJob) Run() {
 	}
 
 	log.Infof("updating %d sources", len(sources))
-	job.cache.FetchFeeds(job.conf, job.archive, sources, publicFollowers)
+	deltas := job.cache.FetchFeeds(job.conf, job.archive, sources, publicFollowers)
+	log.Infof("found %d new twts in %d feeds", deltas.Count(), len(deltas))
+
+	job.cache.EnforceMemoryBudget(job.archive)
 
 	log.Infof("converging cache with %d potential peers", len(job.cache.GetPeers()))
 	job.cache.Converge(job.archive)
@@ -287,7 +337,12 @@ func (job *UpdateFeedSourcesJob) String() string { return "UpdateFeedSources" }
 func (job *UpdateFeedSourcesJob) Run() {
 	log.Infof("updating %d feed sources", len(job.conf.FeedSources))
 
-	feedsources := FetchFeedSources(job.conf, job.conf.FeedSources)
+	previous, err := LoadFeedSources(job.conf.Data)
+	if err != nil {
+		log.WithError(err).Warn("error loading previous feed sources")
+	}
+
+	feedsources := FetchFeedSources(job.conf, job.conf.FeedSources, previous)
 
 	log.Infof("fetched %d feed sources", len(feedsources.Sources))
 
@@ -356,13 +411,51 @@ func (job *CreateAutomatedFeedsJob) Run() {
 	log.Infof("creating automated feeds ...")
 
 	// Create automated feeds
-	for _, feed := range automatedFeeds {
-		if !job.db.HasFeed(feed) {
-			if err := CreateFeed(job.conf, job.db, nil, feed, true); err != nil {
-				log.WithError(err).Warnf("error creating new feed %s", feed)
+	for _, name := range automatedFeeds {
+		if !job.db.HasFeed(name) {
+			if err := CreateFeed(job.conf, job.db, nil, name, true); err != nil {
+				log.WithError(err).Warnf("error creating new feed %s", name)
+				continue
+			}
+		}
+
+		feed, err := job.db.GetFeed(name)
+		if err != nil {
+			log.WithError(err).Warnf("error loading feed %s", name)
+			continue
+		}
+		if !feed.Automated {
+			feed.Automated = true
+			if err := job.db.SetFeed(name, feed); err != nil {
+				log.WithError(err).Warnf("error flagging feed %s as automated", name)
 			}
 		}
+		automated.Flag(feed.URL, true)
+	}
+}
+
+type UpdatePeersJob struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewUpdatePeersJob(conf *Config, cache *Cache, archive Archiver, db Store) Job {
+	return &UpdatePeersJob{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+func (job *UpdatePeersJob) String() string { return "UpdatePeers" }
+
+func (job *UpdatePeersJob) Run() {
+	log.Info("updating managed peers")
+
+	if err := RefreshManagedPeers(job.conf, job.cache, job.db); err != nil {
+		log.WithError(err).Warn("unable to get all peers from database")
+		return
 	}
+
+	log.Infof("updated %d managed peers", len(job.cache.GetManagedPeers()))
 }
 
 type ActiveUsersJob struct {
@@ -462,8 +555,18 @@ func (job *RotateFeedsJob) Run() {
 			continue
 		}
 
-		if stat.Size() > job.conf.MaxFetchLimit {
-			log.Infof("rotating %s with size %s > %s", feed, humanize.Bytes(uint64(stat.Size())), humanize.Bytes(uint64(job.conf.MaxFetchLimit)))
+		count, err := GetFeedCount(job.conf, feed)
+		if err != nil {
+			log.WithError(err).Error("error getting feed count")
+			continue
+		}
+
+		if stat.Size() > job.conf.MaxFetchLimit || count > job.conf.MaxCacheItems {
+			log.Infof(
+				"rotating %s with size %s (max %s) and %d twts (max %d)",
+				feed, humanize.Bytes(uint64(stat.Size())), humanize.Bytes(uint64(job.conf.MaxFetchLimit)),
+				count, job.conf.MaxCacheItems,
+			)
 
 			if err := RotateFeed(job.conf, feed); err != nil {
 				log.WithError(err).Error("error rotating feed")
@@ -491,6 +594,102 @@ func (job *PruneFollowersJob) Run() {
 	job.cache.PruneFollowers(90 * 24 * time.Hour)
 }
 
+type PurgeExternalAvatarsJob struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewPurgeExternalAvatarsJob(conf *Config, cache *Cache, archive Archiver, db Store) Job {
+	return &PurgeExternalAvatarsJob{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+func (job *PurgeExternalAvatarsJob) String() string { return "PurgeExternalAvatars" }
+
+func (job *PurgeExternalAvatarsJob) Run() {
+	purged, err := PurgeExternalAvatars(job.conf, job.cache, job.db)
+	if err != nil {
+		log.WithError(err).Warn("error purging external avatars")
+		return
+	}
+	log.Infof("purged %d unreferenced external avatars", purged)
+}
+
+type PurgeProxiedImagesJob struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewPurgeProxiedImagesJob(conf *Config, cache *Cache, archive Archiver, db Store) Job {
+	return &PurgeProxiedImagesJob{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+func (job *PurgeProxiedImagesJob) String() string { return "PurgeProxiedImages" }
+
+func (job *PurgeProxiedImagesJob) Run() {
+	purged, err := PurgeProxiedImages(job.conf)
+	if err != nil {
+		log.WithError(err).Warn("error purging proxied images")
+		return
+	}
+	log.Infof("purged %d stale proxied images", purged)
+}
+
+type VerifyProfileLinksJob struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewVerifyProfileLinksJob(conf *Config, cache *Cache, archive Archiver, db Store) Job {
+	return &VerifyProfileLinksJob{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+func (job *VerifyProfileLinksJob) String() string { return "VerifyProfileLinks" }
+
+// Run verifies the websites of all users again as websites can remove their
+// rel=me links (or add them later)
+func (job *VerifyProfileLinksJob) Run() {
+	users, err := job.db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Warn("unable to get all users from database")
+		return
+	}
+
+	for _, user := range users {
+		if len(user.Websites()) == 0 {
+			continue
+		}
+		if err := VerifyProfileLinks(job.conf, job.db, user.Username); err != nil {
+			log.WithError(err).Warnf("error verifying links of %s", user.Username)
+		}
+	}
+}
+
+type PublishAnnouncementsJob struct {
+	conf    *Config
+	cache   *Cache
+	archive Archiver
+	db      Store
+}
+
+func NewPublishAnnouncementsJob(conf *Config, cache *Cache, archive Archiver, db Store) Job {
+	return &PublishAnnouncementsJob{conf: conf, cache: cache, archive: archive, db: db}
+}
+
+func (job *PublishAnnouncementsJob) String() string { return "PublishAnnouncements" }
+
+// Run posts scheduled announcements as twts once they start
+func (job *PublishAnnouncementsJob) Run() {
+	if err := PublishAnnouncements(job.conf, job.cache, job.db); err != nil {
+		log.WithError(err).Warn("error publishing announcements")
+	}
+}
+
 type PruneUsersJob struct {
 	conf    *Config
 	cache   *Cache
@@ -0,0 +1,370 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/julienschmidt/httprouter"
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+// DetectedLanguage is a language detected by DetectLanguage
+type DetectedLanguage struct {
+	Code string
+	Name string
+}
+
+// languageNames are the (native) names of the languages detected by their
+// ISO 639-1 codes
+var languageNames = map[string]string{
+	"ar": "العربية",
+	"de": "Deutsch",
+	"el": "Ελληνικά",
+	"en": "English",
+	"es": "Español",
+	"fr": "Français",
+	"he": "עברית",
+	"hi": "हिन्दी",
+	"hy": "Հայերեն",
+	"it": "Italiano",
+	"ja": "日本語",
+	"ka": "ქართული",
+	"ko": "한국어",
+	"nl": "Nederlands",
+	"pt": "Português",
+	"ru": "Русский",
+	"sv": "Svenska",
+	"th": "ไทย",
+	"uk": "Українська",
+	"zh": "中文",
+}
+
+// languageScripts are the scripts written in (mostly) one language
+var languageScripts = []struct {
+	lang  string
+	table *unicode.RangeTable
+}{
+	{"ja", unicode.Hiragana},
+	{"ja", unicode.Katakana},
+	{"ko", unicode.Hangul},
+	{"zh", unicode.Han},
+	{"th", unicode.Thai},
+	{"el", unicode.Greek},
+	{"he", unicode.Hebrew},
+	{"ar", unicode.Arabic},
+	{"ru", unicode.Cyrillic},
+	{"hi", unicode.Devanagari},
+	{"hy", unicode.Armenian},
+	{"ka", unicode.Georgian},
+}
+
+// languageStopwords are the most common words of the languages written in the
+// latin script
+var languageStopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "were", "of", "to", "in", "that", "it", "with", "for", "this", "you", "have", "not", "but", "be", "on", "what", "just"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "ein", "eine", "zu", "mit", "auf", "den", "von", "sich", "auch", "es", "wir", "sind", "für", "dass"},
+	"fr": {"le", "la", "les", "et", "est", "une", "des", "du", "que", "pour", "pas", "dans", "je", "ce", "qui", "sur", "avec", "mais", "vous", "nous", "sont"},
+	"es": {"el", "los", "las", "y", "es", "una", "del", "que", "por", "para", "con", "no", "pero", "como", "más", "está", "yo", "muy", "se", "lo", "son"},
+	"it": {"il", "lo", "gli", "le", "e", "è", "una", "di", "che", "per", "non", "con", "del", "della", "sono", "ma", "anche", "questo", "io", "ho"},
+	"pt": {"o", "os", "as", "e", "é", "uma", "do", "da", "que", "para", "não", "com", "em", "mas", "por", "se", "eu", "são", "isso", "muito", "está"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "van", "dat", "ik", "je", "op", "met", "zijn", "voor", "maar", "ook", "wat", "er", "dit", "wel"},
+	"sv": {"och", "är", "det", "att", "en", "ett", "jag", "inte", "som", "på", "med", "för", "har", "av", "till", "men", "om", "vi", "den", "så"},
+}
+
+// stopwordLanguages are the languages of each stopword
+var stopwordLanguages = func() map[string][]string {
+	words := make(map[string][]string)
+	for lang, stopwords := range languageStopwords {
+		for _, word := range stopwords {
+			words[word] = append(words[word], lang)
+		}
+	}
+	return words
+}()
+
+const (
+	// minLanguageLetters is the minimum number of letters of a twt written
+	// in a non-latin script to detect its language
+	minLanguageLetters = 3
+
+	// minLanguageStopwords is the minimum number of stopwords of a twt
+	// written in the latin script to detect its language
+	minLanguageStopwords = 2
+)
+
+// DetectedLanguages returns the languages detected sorted by their code
+func DetectedLanguages() []DetectedLanguage {
+	langs := make([]DetectedLanguage, 0, len(languageNames))
+	for code, name := range languageNames {
+		langs = append(langs, DetectedLanguage{Code: code, Name: name})
+	}
+	sort.Slice(langs, func(i, j int) bool { return langs[i].Code < langs[j].Code })
+	return langs
+}
+
+// IsDetectedLanguage returns true if lang is the code of a language detected
+func IsDetectedLanguage(lang string) bool {
+	_, ok := languageNames[lang]
+	return ok
+}
+
+// NormalizeLanguage normalizes a language tag (e.g: en-US) to the code of a
+// language detected, empty if the language is not detected
+func NormalizeLanguage(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if i := strings.IndexAny(lang, "-_"); i > 0 {
+		lang = lang[:i]
+	}
+	if !IsDetectedLanguage(lang) {
+		return ""
+	}
+	return lang
+}
+
+// DetectLanguage detects the language of text by the scripts of its letters
+// and, for text written in the latin script, by its most common words.
+// Mentions, tags and links are ignored. Returns the ISO 639-1 code of the
+// language or empty if the language could not be detected.
+func DetectLanguage(text string) string {
+	var (
+		latin   int
+		scripts = make(map[string]int)
+		words   []string
+	)
+
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "@") || strings.HasPrefix(word, "#") ||
+			strings.HasPrefix(word, "(#") || strings.Contains(word, "://") {
+			continue
+		}
+		for _, r := range word {
+			if !unicode.IsLetter(r) {
+				continue
+			}
+			if unicode.Is(unicode.Latin, r) {
+				latin++
+				continue
+			}
+			for _, script := range languageScripts {
+				if unicode.Is(script.table, r) {
+					scripts[script.lang]++
+					break
+				}
+			}
+		}
+		words = append(words, strings.ToLower(strings.TrimFunc(word, func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})))
+	}
+
+	// Japanese is written in Kanji (Han) as well as Hiragana and Katakana
+	if scripts["ja"] > 0 {
+		scripts["ja"] += scripts["zh"]
+		delete(scripts, "zh")
+	}
+
+	lang, letters := "", 0
+	for l, n := range scripts {
+		if n > letters || (n == letters && l < lang) {
+			lang, letters = l, n
+		}
+	}
+
+	if letters > latin {
+		if letters < minLanguageLetters {
+			return ""
+		}
+		// Ukrainian is written in the Cyrillic script with a few letters
+		// not used in Russian
+		if lang == "ru" && strings.ContainsAny(strings.ToLower(text), "іїєґ") {
+			return "uk"
+		}
+		return lang
+	}
+
+	scores := make(map[string]int)
+	for _, word := range words {
+		for _, l := range stopwordLanguages[word] {
+			scores[l]++
+		}
+	}
+
+	lang, best, second := "", 0, 0
+	for l, score := range scores {
+		switch {
+		case score > best:
+			lang, best, second = l, score, best
+		case score > second:
+			second = score
+		}
+	}
+	if best < minLanguageStopwords || best == second {
+		return ""
+	}
+	return lang
+}
+
+// DetectTwtLanguage detects the language of a twt falling back to the
+// language of its feed, if declared in its metadata (`# lang = en`)
+func DetectTwtLanguage(twt types.Twt) string {
+	text := fmt.Sprintf("%t", twt)
+	text = strings.Replace(text, twt.Subject().String(), "", 1)
+	text = mentionRegex.ReplaceAllString(text, "")
+	text = linkRegex.ReplaceAllString(text, "")
+
+	if lang := DetectLanguage(text); lang != "" {
+		return lang
+	}
+
+	return NormalizeLanguage(twt.Twter().Metadata.Get("lang"))
+}
+
+// TwtLanguages caches the languages of twts by their hash as they are
+// detected when twts are cached (See: Cache.Refresh)
+type TwtLanguages struct {
+	sync.RWMutex
+
+	langs map[string]string
+}
+
+// NewTwtLanguages ...
+func NewTwtLanguages() *TwtLanguages {
+	return &TwtLanguages{langs: make(map[string]string)}
+}
+
+// twtLanguages are the languages of the cached twts
+var twtLanguages = NewTwtLanguages()
+
+// Get returns the language of a twt, detecting it if not detected yet
+func (tl *TwtLanguages) Get(twt types.Twt) string {
+	hash := twt.Hash()
+
+	tl.RLock()
+	lang, ok := tl.langs[hash]
+	tl.RUnlock()
+
+	if ok {
+		return lang
+	}
+
+	lang = DetectTwtLanguage(twt)
+
+	tl.Lock()
+	tl.langs[hash] = lang
+	tl.Unlock()
+
+	return lang
+}
+
+// Lookup returns the language of a twt by its hash if detected
+func (tl *TwtLanguages) Lookup(hash string) (string, bool) {
+	tl.RLock()
+	defer tl.RUnlock()
+
+	lang, ok := tl.langs[hash]
+	return lang, ok
+}
+
+// Reset detects the languages of the twts forgetting the languages of twts
+// no longer cached, languages already detected are kept
+func (tl *TwtLanguages) Reset(twts types.Twts) {
+	langs := make(map[string]string, len(twts))
+	for _, twt := range twts {
+		langs[twt.Hash()] = tl.Get(twt)
+	}
+
+	tl.Lock()
+	tl.langs = langs
+	tl.Unlock()
+}
+
+// FilterTwtsByLanguage keeps the twts written in one of the languages (all
+// twts if none) and the twts whose language could not be detected
+func FilterTwtsByLanguage(langs []string, twts types.Twts) types.Twts {
+	if len(langs) == 0 {
+		return twts
+	}
+
+	wanted := make(map[string]bool, len(langs))
+	for _, lang := range langs {
+		wanted[lang] = true
+	}
+
+	filtered := make(types.Twts, 0, len(twts))
+	for _, twt := range twts {
+		if lang := twtLanguages.Get(twt); lang == "" || wanted[lang] {
+			filtered = append(filtered, twt)
+		}
+	}
+	return filtered
+}
+
+// maxLanguagesRequest is the maximum number of twts that can be looked up by a
+// single request to /api/v1/languages
+const maxLanguagesRequest = 100
+
+// LanguagesRequest is the request to /api/v1/languages to look up the
+// languages of many twts at once by their hashes
+type LanguagesRequest struct {
+	Hashes []string `json:"hashes"`
+}
+
+// LanguagesResponse is the response of /api/v1/languages with the ISO 639-1
+// codes of the languages detected by the hashes of their twts (empty if the
+// language could not be detected) and the hashes of the twts not cached
+type LanguagesResponse struct {
+	Languages map[string]string `json:"languages"`
+	Missing   []string          `json:"missing"`
+}
+
+// LanguagesEndpoint returns the detected languages of many twts so clients
+// can filter or label twts by their language
+func (a *API) LanguagesEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		var req LanguagesRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			apiLogger(r).WithError(err).Error("error parsing languages request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		if len(req.Hashes) > maxLanguagesRequest {
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, fmt.Sprintf("Too many hashes (max %d)", maxLanguagesRequest))
+			return
+		}
+
+		res := LanguagesResponse{
+			Languages: make(map[string]string),
+			Missing:   []string{},
+		}
+
+		for _, hash := range req.Hashes {
+			if lang, ok := twtLanguages.Lookup(hash); ok {
+				res.Languages[hash] = lang
+				continue
+			}
+			if twt, ok := a.cache.Lookup(hash); ok {
+				res.Languages[hash] = twtLanguages.Get(twt)
+				continue
+			}
+			res.Missing = append(res.Missing, hash)
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
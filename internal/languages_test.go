@@ -0,0 +1,37 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("en", DetectLanguage("This is the best thing that happened to me this week"))
+	assert.Equal("de", DetectLanguage("Das ist nicht so schlimm, ich bin auch dabei"))
+	assert.Equal("fr", DetectLanguage("Je pense que c'est une bonne idée pour nous"))
+	assert.Equal("ja", DetectLanguage("今日はとても良い天気です"))
+	assert.Equal("ru", DetectLanguage("Сегодня хорошая погода"))
+	assert.Equal("uk", DetectLanguage("Сьогодні гарна погода, їдемо гуляти"))
+
+	// Mentions, tags and links are ignored
+	assert.Equal("en", DetectLanguage("@<bob https://example.com/bob/twtxt.txt> this is what I was looking for #golang"))
+
+	// Text too short to tell
+	assert.Equal("", DetectLanguage("ok"))
+	assert.Equal("", DetectLanguage("https://example.com/some/link"))
+}
+
+func TestNormalizeLanguage(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("en", NormalizeLanguage("en-US"))
+	assert.Equal("pt", NormalizeLanguage("PT_br"))
+	assert.Equal("", NormalizeLanguage("tlh"))
+	assert.Equal("", NormalizeLanguage(""))
+}
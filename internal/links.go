@@ -0,0 +1,230 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	shortLinksFile = "links.json"
+
+	// shortLinkIDLength is the length of the ids of short links
+	shortLinkIDLength = 8
+
+	// shortenLinksOver is the length of links shortened when the link
+	// shortener is enabled
+	shortenLinksOver = 80
+)
+
+// trackingParams are the query parameters of links used for tracking which
+// are stripped from links posted, parameters ending in _ are prefixes e.g:
+// utm_source, utm_medium, ...
+var trackingParams = []string{
+	"utm_", "fbclid", "gclid", "gclsrc", "dclid", "msclkid", "yclid",
+	"mc_cid", "mc_eid", "igshid", "mkt_tok", "_ga", "_hsenc", "_hsmi",
+}
+
+// linksRegexp matches the links of a twt, and the mentions, tags and images
+// of a twt so their links are left as is
+var linksRegexp = regexp.MustCompile(`[@#]<[^>]+>|!\[[^\]]*\]\([^)]*\)|https?://[^\s<>()\[\]]+`)
+
+// IsTrackingParam returns true if a query parameter is used for tracking
+func IsTrackingParam(name string) bool {
+	name = strings.ToLower(name)
+	for _, param := range trackingParams {
+		if strings.HasSuffix(param, "_") && strings.HasPrefix(name, param) {
+			return true
+		}
+		if name == param {
+			return true
+		}
+	}
+	return false
+}
+
+// StripTrackingParams removes the tracking parameters from the query of a
+// link keeping the order of the other parameters
+func StripTrackingParams(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.RawQuery == "" {
+		return uri
+	}
+
+	var params []string
+	for _, param := range strings.Split(u.RawQuery, "&") {
+		name := strings.SplitN(param, "=", 2)[0]
+		if unescaped, err := url.QueryUnescape(name); err == nil {
+			name = unescaped
+		}
+		if param == "" || IsTrackingParam(name) {
+			continue
+		}
+		params = append(params, param)
+	}
+
+	u.RawQuery = strings.Join(params, "&")
+	return u.String()
+}
+
+// ShortLink is a link shortened by the Pod's link shortener
+type ShortLink struct {
+	URL       string    `json:"url"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ShortLinks is the Pod's own link shortener which shortens long links of
+// twts to /l/:id on the Pod without relying on third-party shorteners. A nil
+// *ShortLinks shortens no links.
+type ShortLinks struct {
+	sync.RWMutex
+
+	conf  *Config
+	links map[string]ShortLink
+}
+
+// NewShortLinks ...
+func NewShortLinks(conf *Config) (*ShortLinks, error) {
+	sl := &ShortLinks{
+		conf:  conf,
+		links: make(map[string]ShortLink),
+	}
+
+	data, err := ioutil.ReadFile(sl.filename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return sl, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &sl.links); err != nil {
+		return nil, err
+	}
+
+	return sl, nil
+}
+
+func (sl *ShortLinks) filename() string {
+	return filepath.Join(sl.conf.Data, shortLinksFile)
+}
+
+func (sl *ShortLinks) save() error {
+	data, err := json.Marshal(sl.links)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(sl.filename(), data, 0644)
+}
+
+// Shorten returns the short link of a link, the same link is always
+// shortened to the same short link
+func (sl *ShortLinks) Shorten(uri string) (string, error) {
+	if sl == nil {
+		return uri, nil
+	}
+
+	id := FastHashString(uri)[:shortLinkIDLength]
+	shortURL := fmt.Sprintf("%s/l/%s", strings.TrimSuffix(sl.conf.BaseURL, "/"), id)
+
+	sl.Lock()
+	defer sl.Unlock()
+
+	if link, ok := sl.links[id]; ok && link.URL == uri {
+		return shortURL, nil
+	} else if ok {
+		// Keep the link shortened first in the unlikely event of a collision
+		return uri, nil
+	}
+
+	sl.links[id] = ShortLink{URL: uri, CreatedAt: time.Now()}
+	if err := sl.save(); err != nil {
+		delete(sl.links, id)
+		return uri, err
+	}
+
+	return shortURL, nil
+}
+
+// Get returns the link of a short link
+func (sl *ShortLinks) Get(id string) (string, bool) {
+	if sl == nil {
+		return "", false
+	}
+
+	sl.RLock()
+	defer sl.RUnlock()
+
+	link, ok := sl.links[id]
+	return link.URL, ok
+}
+
+// ProcessLinks post-processes the links of a twt as it is posted. Tracking
+// parameters are stripped from links if the user strips them and, if the
+// link shortener is enabled, long links to other sites are shortened.
+// Mentions, tags and images are left as is.
+func ProcessLinks(conf *Config, user *User, text string) string {
+	isLocalURL := IsLocalURLFactory(conf)
+	stripTracking := user != nil && user.StripTrackingParam
+	shorten := conf.Features.IsEnabled(FeatureLinkShortener)
+
+	if !stripTracking && !shorten {
+		return text
+	}
+
+	return linksRegexp.ReplaceAllStringFunc(text, func(link string) string {
+		if !strings.HasPrefix(link, "http") {
+			return link
+		}
+
+		// Punctuation following a link is not part of it
+		trimmed := strings.TrimRight(link, ".,;:!?'\"")
+		trailer := link[len(trimmed):]
+		link = trimmed
+
+		if stripTracking {
+			link = StripTrackingParams(link)
+		}
+
+		if shorten && len(link) > shortenLinksOver && !isLocalURL(link) {
+			shortURL, err := shortLinks.Shorten(link)
+			if err != nil {
+				log.WithError(err).Warnf("error shortening link %s", link)
+			} else {
+				link = shortURL
+			}
+		}
+
+		return link + trailer
+	})
+}
+
+// ShortLinkHandler redirects short links of the link shortener to their links
+func (s *Server) ShortLinkHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		uri, ok := shortLinks.Get(p.ByName("id"))
+		if !ok {
+			ctx := NewContext(s, r)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorShortLinkNotFound")
+			s.render("404", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, uri, http.StatusMovedPermanently)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStripTrackingParams(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("https://example.com/a?id=1&page=2", StripTrackingParams("https://example.com/a?utm_source=x&id=1&fbclid=abc&page=2&utm_medium=y"))
+	assert.Equal("https://example.com/a", StripTrackingParams("https://example.com/a?utm_source=x"))
+	assert.Equal("https://example.com/a?utmost=1", StripTrackingParams("https://example.com/a?utmost=1"))
+	assert.Equal("https://example.com/a", StripTrackingParams("https://example.com/a"))
+}
+
+func TestShortLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &Config{Data: t.TempDir(), BaseURL: "https://example.com"}
+	sl, err := NewShortLinks(conf)
+	require.NoError(t, err)
+
+	const link = "https://example.org/a/very/long/link"
+
+	shortURL, err := sl.Shorten(link)
+	require.NoError(t, err)
+	assert.True(strings.HasPrefix(shortURL, "https://example.com/l/"))
+
+	again, err := sl.Shorten(link)
+	require.NoError(t, err)
+	assert.Equal(shortURL, again)
+
+	uri, ok := sl.Get(strings.TrimPrefix(shortURL, "https://example.com/l/"))
+	assert.True(ok)
+	assert.Equal(link, uri)
+
+	// Short links are persisted
+	sl, err = NewShortLinks(conf)
+	require.NoError(t, err)
+	uri, ok = sl.Get(strings.TrimPrefix(shortURL, "https://example.com/l/"))
+	assert.True(ok)
+	assert.Equal(link, uri)
+
+	var none *ShortLinks
+	uri, err = none.Shorten(link)
+	assert.NoError(err)
+	assert.Equal(link, uri)
+}
+
+func TestProcessLinks(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := NewConfig()
+	user := &User{StripTrackingParam: true}
+
+	assert.Equal(
+		"see https://example.org/post?id=1. and @<bob https://example.org/bob/twtxt.txt?utm_source=x>",
+		ProcessLinks(conf, user, "see https://example.org/post?id=1&utm_source=feed. and @<bob https://example.org/bob/twtxt.txt?utm_source=x>"),
+	)
+	assert.Equal(
+		"[link](https://example.org/post)",
+		ProcessLinks(conf, user, "[link](https://example.org/post?fbclid=abc)"),
+	)
+
+	text := "see https://example.org/post?utm_source=feed"
+	assert.Equal(text, ProcessLinks(conf, &User{}, text))
+}
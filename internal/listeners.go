@@ -0,0 +1,155 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// unixListenerPrefix is the prefix of listener specs of UNIX domain sockets
+const unixListenerPrefix = "unix:"
+
+// Listener is an additional address the pod listens on besides its bind
+// address, such as a UNIX domain socket for a reverse proxy
+type Listener struct {
+	Network string
+	Address string
+
+	// TLSCert and TLSKey enable TLS on this listener
+	TLSCert string
+	TLSKey  string
+}
+
+// ParseListener parses a listener spec of the form <addr>[,cert=<path>,key=<path>]
+// where <addr> is either [int]:<port> or unix:/path/to/socket
+func ParseListener(spec string) (Listener, error) {
+	parts := strings.Split(spec, ",")
+
+	var l Listener
+	addr := strings.TrimSpace(parts[0])
+	if strings.HasPrefix(addr, unixListenerPrefix) {
+		l.Network = "unix"
+		l.Address = strings.TrimPrefix(addr, unixListenerPrefix)
+	} else {
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return Listener{}, fmt.Errorf("error parsing listener address %q: %w", addr, err)
+		}
+		l.Network = "tcp"
+		l.Address = addr
+	}
+	if l.Address == "" {
+		return Listener{}, fmt.Errorf("error: listener %q has no address", spec)
+	}
+
+	for _, opt := range parts[1:] {
+		kv := strings.SplitN(strings.TrimSpace(opt), "=", 2)
+		if len(kv) != 2 {
+			return Listener{}, fmt.Errorf("error parsing listener option %q", opt)
+		}
+		switch kv[0] {
+		case "cert":
+			l.TLSCert = kv[1]
+		case "key":
+			l.TLSKey = kv[1]
+		default:
+			return Listener{}, fmt.Errorf("error: unknown listener option %q", kv[0])
+		}
+	}
+
+	if (l.TLSCert == "") != (l.TLSKey == "") {
+		return Listener{}, fmt.Errorf("error: listener %q requires both a cert and a key for TLS", spec)
+	}
+
+	return l, nil
+}
+
+// TLS returns true if the listener is configured with TLS
+func (l Listener) TLS() bool {
+	return l.TLSCert != "" && l.TLSKey != ""
+}
+
+func (l Listener) String() string {
+	if l.Network == "unix" {
+		return unixListenerPrefix + l.Address
+	}
+	if l.TLS() {
+		return "https://" + l.Address
+	}
+	return "http://" + l.Address
+}
+
+// Listen opens the listener, removing a stale UNIX domain socket if any
+func (l Listener) Listen() (net.Listener, error) {
+	if l.Network == "unix" {
+		if err := os.Remove(l.Address); err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("error removing stale socket %s: %w", l.Address, err)
+		}
+	}
+
+	ln, err := net.Listen(l.Network, l.Address)
+	if err != nil {
+		return nil, err
+	}
+
+	if l.Network == "unix" {
+		// Let a reverse proxy in the same group connect to the socket
+		if err := os.Chmod(l.Address, 0660); err != nil {
+			ln.Close()
+			return nil, fmt.Errorf("error setting permissions of socket %s: %w", l.Address, err)
+		}
+	}
+
+	return ln, nil
+}
+
+// serveListeners serves the pod on each of the additional listeners
+func (s *Server) serveListeners() error {
+	for _, l := range s.config().listeners {
+		ln, err := l.Listen()
+		if err != nil {
+			return fmt.Errorf("error listening on %s: %w", l, err)
+		}
+
+		srv := &http.Server{Handler: s.server.Handler}
+		s.listeners = append(s.listeners, srv)
+
+		certFile, keyFile := l.TLSCert, l.TLSKey
+		if l.TLS() && s.config().TLSOCSPStapling {
+			cert, err := tls.LoadX509KeyPair(l.TLSCert, l.TLSKey)
+			if err != nil {
+				ln.Close()
+				return fmt.Errorf("error loading TLS certificate of %s: %w", l, err)
+			}
+			srv.TLSConfig = &tls.Config{
+				GetCertificate: NewOCSPStapler().GetCertificate(func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+					return &cert, nil
+				}),
+			}
+			certFile, keyFile = "", ""
+		}
+
+		go func(l Listener, ln net.Listener) {
+			var err error
+			if l.TLS() {
+				err = srv.ServeTLS(ln, certFile, keyFile)
+			} else {
+				err = srv.Serve(ln)
+			}
+			if err != nil && err != http.ErrServerClosed {
+				log.WithError(err).Errorf("error serving on %s", l)
+			}
+		}(l, ln)
+
+		log.Infof("listening on %s", l)
+	}
+
+	return nil
+}
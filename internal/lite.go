@@ -0,0 +1,51 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// litePrefix is the url prefix of the lite UI
+	litePrefix = "/lite"
+
+	// liteTwtsPerPage is the (smaller) number of twts per page of the lite UI
+	liteTwtsPerPage = 10
+)
+
+// isLite returns true if a request is to be rendered with the lite UI, either
+// because of the /lite url prefix or the user's preference
+func isLite(r *http.Request, ctx *Context) bool {
+	if strings.HasPrefix(r.URL.Path, litePrefix) {
+		return true
+	}
+	return ctx.User != nil && ctx.User.LiteMode
+}
+
+// twtsPerPage returns the number of twts per page for the lite or full UI
+func (s *Server) twtsPerPage(lite bool) int {
+	if lite && liteTwtsPerPage < s.config().TwtsPerPage {
+		return liteTwtsPerPage
+	}
+	return s.config().TwtsPerPage
+}
+
+// renderLite renders the timeline or profile (if ctx.Profile is set) with the
+// lite UI, a standalone page without any JavaScript and minimal CSS for old
+// devices, text browsers, high-latency connections and printing
+func (s *Server) renderLite(w http.ResponseWriter, ctx *Context) {
+	buf, err := s.tmplman.ExecStandalone("lite", ctx)
+	if err != nil {
+		log.WithError(err).Error("error rendering lite UI")
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, _ = buf.WriteTo(w)
+}
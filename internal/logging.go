@@ -0,0 +1,180 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/renstrom/shortuuid"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// LogCache is the subsystem of the feed cache
+	LogCache = "cache"
+
+	// LogFetcher is the subsystem of the feed fetcher
+	LogFetcher = "fetcher"
+
+	// LogWebSub is the subsystem of the WebSub hub and subscriber
+	LogWebSub = "websub"
+
+	// LogIPP is the subsystem of the inter-pod protocol (peering)
+	LogIPP = "ipp"
+
+	// LogAPI is the subsystem of the API
+	LogAPI = "api"
+
+	// LogMedia is the subsystem of media uploads and processing
+	LogMedia = "media"
+
+	// RequestIDHeader is the header carrying the ID of a request
+	RequestIDHeader = "X-Request-Id"
+)
+
+// LogSubsystems are the subsystems with their own loggers and log levels
+var LogSubsystems = []string{LogCache, LogFetcher, LogWebSub, LogIPP, LogAPI, LogMedia}
+
+var loggers = newSubsystemLoggers()
+
+type subsystemLoggers struct {
+	mu      sync.RWMutex
+	loggers map[string]*log.Logger
+
+	// levels are the levels explicitly set for subsystems, subsystems
+	// without a level log at the global log level
+	levels map[string]log.Level
+}
+
+func newSubsystemLoggers() *subsystemLoggers {
+	sl := &subsystemLoggers{
+		loggers: make(map[string]*log.Logger),
+		levels:  make(map[string]log.Level),
+	}
+
+	for _, name := range LogSubsystems {
+		logger := log.New()
+		logger.SetOutput(log.StandardLogger().Out)
+		logger.SetFormatter(log.StandardLogger().Formatter)
+		sl.loggers[name] = logger
+	}
+
+	return sl
+}
+
+// Logger returns the logger of a subsystem. Unknown subsystems use the
+// global logger.
+func Logger(subsystem string) *log.Entry {
+	loggers.mu.RLock()
+	logger, ok := loggers.loggers[subsystem]
+	level, explicit := loggers.levels[subsystem]
+	loggers.mu.RUnlock()
+
+	if !ok {
+		return log.WithField("subsystem", subsystem)
+	}
+
+	if !explicit {
+		level = log.GetLevel()
+	}
+	logger.SetLevel(level)
+
+	return logger.WithField("subsystem", subsystem)
+}
+
+// RequestLogger returns the logger of a subsystem annotated with the ID of
+// the request (if any) of ctx
+func RequestLogger(ctx context.Context, subsystem string) *log.Entry {
+	entry := Logger(subsystem)
+	if id := RequestID(ctx); id != "" {
+		entry = entry.WithField("request_id", id)
+	}
+	return entry
+}
+
+// SetLogLevel sets the log level of a subsystem, an empty level resets the
+// subsystem to the global log level
+func SetLogLevel(subsystem, level string) error {
+	loggers.mu.Lock()
+	defer loggers.mu.Unlock()
+
+	if _, ok := loggers.loggers[subsystem]; !ok {
+		return fmt.Errorf("error: unknown log subsystem %s", subsystem)
+	}
+
+	if level == "" {
+		delete(loggers.levels, subsystem)
+		return nil
+	}
+
+	lvl, err := log.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	loggers.levels[subsystem] = lvl
+
+	return nil
+}
+
+// SetLogLevels sets the log levels of subsystems from a map of subsystem to
+// level resetting any subsystems not present to the global log level
+func SetLogLevels(levels map[string]string) error {
+	for _, subsystem := range LogSubsystems {
+		if err := SetLogLevel(subsystem, strings.TrimSpace(levels[subsystem])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// LogLevels returns the explicitly set log levels of subsystems
+func LogLevels() map[string]string {
+	loggers.mu.RLock()
+	defer loggers.mu.RUnlock()
+
+	levels := make(map[string]string, len(loggers.levels))
+	for subsystem, level := range loggers.levels {
+		levels[subsystem] = level.String()
+	}
+	return levels
+}
+
+// LogLevelNames returns the names of the available log levels
+func LogLevelNames() []string {
+	var names []string
+	for _, level := range log.AllLevels {
+		names = append(names, level.String())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// RequestID returns the ID of the request of ctx (if any)
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(RequestIDContextKey).(string)
+	return id
+}
+
+// RequestIDHandler assigns every request an ID (or uses the one provided by
+// a reverse proxy) that is returned in the X-Request-Id header and
+// propagated through the request's context
+func RequestIDHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > 64 {
+			id = shortuuid.New()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), RequestIDContextKey, id)))
+	})
+}
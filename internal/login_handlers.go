@@ -79,6 +79,22 @@ func (s *Server) LoginHandler() httprouter.Handle {
 		// #239: Throttle failed login attempts and lock user  account.
 		failures.Reset(user.Username)
 
+		if user.AccountState() == AccountPendingDeletion {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorAccountPendingDeletion", map[string]interface{}{
+				"DeleteAt": user.DeletionScheduledAt(s.config()).Format(time.RFC1123),
+			})
+			s.render("error", w, ctx)
+			return
+		}
+
+		if !user.IsActive() {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorAccountInactive", map[string]interface{}{"State": user.AccountState()})
+			s.render("error", w, ctx)
+			return
+		}
+
 		// Lookup session
 		sess := r.Context().Value(session.SessionKey)
 		if sess == nil {
@@ -86,14 +102,31 @@ func (s *Server) LoginHandler() httprouter.Handle {
 			return
 		}
 
+		// Forms rendered for a previously active account must not be
+		// submitted on behalf of the newly logged in account
+		if len(SessionAccounts(sess.(*session.Session))) > 0 {
+			s.csrf.RegenerateToken(w, r)
+		}
+
 		// Authorize session
-		_ = sess.(*session.Session).Set("username", username)
+		if err := AddSessionAccount(sess.(*session.Session), username); err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorTooManyAccounts")
+			s.render("error", w, ctx)
+			return
+		}
 
 		// Persist session?
 		if rememberme {
 			_ = sess.(*session.Session).Set("persist", "1")
 		}
 
+		// Newly registered users are welcomed by the onboarding wizard
+		if !user.OnboardingComplete {
+			http.Redirect(w, r, "/onboarding", http.StatusFound)
+			return
+		}
+
 		http.Redirect(w, r, r.FormValue("referer"), http.StatusFound)
 	}
 }
@@ -154,7 +187,7 @@ func (s *Server) LoginEmailHandler() httprouter.Handle {
 			jwt.SigningMethodHS256,
 			jwt.MapClaims{"username": username, "expiresAt": expiryTime},
 		)
-		tokenString, err := token.SignedString([]byte(s.config.MagicLinkSecret))
+		tokenString, err := token.SignedString([]byte(s.config().MagicLinkSecret))
 		if err != nil {
 			ctx.Error = true
 			ctx.Message = err.Error()
@@ -164,7 +197,7 @@ func (s *Server) LoginEmailHandler() httprouter.Handle {
 		parts := strings.SplitN(tokenString, ".", 3)
 		tokenCache.Inc(parts[2])
 
-		if err := SendMagicLinkAuthEmail(s.config, user, email, tokenString); err != nil {
+		if err := SendMagicLinkAuthEmail(s.config(), user, email, tokenString); err != nil {
 			log.WithError(err).Errorf("unable to send magic-link-auth email to %s", user.Username)
 			ctx.Error = true
 			ctx.Message = err.Error()
@@ -203,7 +236,7 @@ func (s *Server) MagicLinkAuthHandler() httprouter.Handle {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
 
-			return []byte(s.config.MagicLinkSecret), nil
+			return []byte(s.config().MagicLinkSecret), nil
 		})
 		if err != nil {
 			ctx.Error = true
@@ -242,6 +275,13 @@ func (s *Server) MagicLinkAuthHandler() httprouter.Handle {
 				return
 			}
 
+			if !user.IsActive() {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorAccountInactive", map[string]interface{}{"State": user.AccountState()})
+				s.render("error", w, ctx)
+				return
+			}
+
 			// Lookup session
 			sess := r.Context().Value(session.SessionKey)
 			if sess == nil {
@@ -249,8 +289,17 @@ func (s *Server) MagicLinkAuthHandler() httprouter.Handle {
 				return
 			}
 
+			if len(SessionAccounts(sess.(*session.Session))) > 0 {
+				s.csrf.RegenerateToken(w, r)
+			}
+
 			// Authorize session
-			_ = sess.(*session.Session).Set("username", user.Username)
+			if err := AddSessionAccount(sess.(*session.Session), user.Username); err != nil {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorTooManyAccounts")
+				s.render("error", w, ctx)
+				return
+			}
 
 			// Persist session?
 			_ = sess.(*session.Session).Set("persist", "1")
@@ -7,12 +7,33 @@ import (
 	"net/http"
 
 	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+
+	"git.mills.io/yarnsocial/yarn/internal/session"
 )
 
-// LogoutHandler ...
+// LogoutHandler logs the active account out of the session switching to the
+// next logged in account (if any). With all=1 all accounts are logged out.
 func (s *Server) LogoutHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		s.sm.Delete(w, r)
+		sess, ok := r.Context().Value(session.SessionKey).(*session.Session)
+		if !ok || r.FormValue("all") == "1" {
+			s.sm.Delete(w, r)
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+
+		username, _ := sess.Get("username")
+		if err := RemoveSessionAccount(sess, username); err != nil {
+			log.WithError(err).Warnf("error removing %s from session", username)
+		}
+
+		if len(SessionAccounts(sess)) == 0 {
+			s.sm.Delete(w, r)
+		} else {
+			s.csrf.RegenerateToken(w, r)
+		}
+
 		http.Redirect(w, r, "/", http.StatusFound)
 	}
 }
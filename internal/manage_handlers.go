@@ -12,6 +12,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/dustin/go-humanize"
 	"github.com/julienschmidt/httprouter"
 	"github.com/renstrom/shortuuid"
 	log "github.com/sirupsen/logrus"
@@ -19,7 +20,7 @@ import (
 
 // ManagePodHandler ...
 func (s *Server) ManagePodHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -32,28 +33,50 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 		}
 
 		if r.Method == "GET" {
+			ctx.AvailableThemes = s.config().AvailableThemes()
+			ctx.ActiveTheme = s.config().ActiveTheme
+			ctx.LogSubsystems = LogSubsystems
+			ctx.LogLevels = LogLevels()
+			ctx.LogLevelNames = LogLevelNames()
+			ctx.CacheMemoryUsage = humanize.Bytes(uint64(s.cache.MemoryUsage()))
+			if s.config().MaxCacheMemory > 0 {
+				ctx.CacheMemoryBudget = humanize.Bytes(uint64(s.config().MaxCacheMemory))
+			} else {
+				ctx.CacheMemoryBudget = s.tr(ctx, "ManagePodCacheMemoryUnlimited")
+			}
+			ctx.RuntimeMemoryUsage = MemoryUsage()
+			ctx.ReservedUsernames = s.config().ReservedUsernames
+			ctx.UsernameMinLength = s.config().UsernameMinLength
+			ctx.UsernameMaxLength = s.config().UsernameMaxLength
+			ctx.UsernamePattern = s.config().UsernamePattern
+			ctx.UsernameProfanity = s.config().UsernameProfanity
 			s.render("managePod", w, ctx)
 			return
 		}
 
 		name := strings.TrimSpace(r.FormValue("podName"))
+		theme := strings.TrimSpace(r.FormValue("podTheme"))
 		logo := strings.TrimSpace(r.FormValue("podLogo"))
 		css := strings.TrimSpace(r.FormValue("podCSS"))
 		description := strings.TrimSpace(r.FormValue("podDescription"))
-		maxTwtLength := SafeParseInt(r.FormValue("maxTwtLength"), s.config.MaxTwtLength)
-		twtsPerPage := SafeParseInt(r.FormValue("twtsPerPage"), s.config.TwtsPerPage)
-		avatarResolution := SafeParseInt(r.FormValue("avatarResolution"), s.config.AvatarResolution)
-		mediaResolution := SafeParseInt(r.FormValue("mediaResolution"), s.config.MediaResolution)
+		maxTwtLength := SafeParseInt(r.FormValue("maxTwtLength"), s.config().MaxTwtLength)
+		twtsPerPage := SafeParseInt(r.FormValue("twtsPerPage"), s.config().TwtsPerPage)
+		avatarResolution := SafeParseInt(r.FormValue("avatarResolution"), s.config().AvatarResolution)
+		mediaResolution := SafeParseInt(r.FormValue("mediaResolution"), s.config().MediaResolution)
 		openProfiles := r.FormValue("enableOpenProfiles") == "on"
+		publicAPI := r.FormValue("enablePublicAPI") == "on"
 		openRegistrations := r.FormValue("enableOpenRegistrations") == "on"
 		permittedImages := r.FormValue("permittedImages")
 		blockedFeeds := r.FormValue("blockedFeeds")
+		allowedFeeds := r.FormValue("allowedFeeds")
 		enabledFeatures := r.FormValue("enabledFeatures")
+		reservedUsernames := r.FormValue("reservedUsernames")
+		usernameMinLength := SafeParseInt(r.FormValue("usernameMinLength"), s.config().UsernameMinLength)
+		usernameMaxLength := SafeParseInt(r.FormValue("usernameMaxLength"), s.config().UsernameMaxLength)
+		usernamePattern := strings.TrimSpace(r.FormValue("usernamePattern"))
+		usernameProfanity := r.FormValue("usernameProfanity")
 
 		alertFloat := r.FormValue("podAlertFloat") == "on"
-		alertGuest := r.FormValue("podAlertGuest") == "on"
-		alertMessage := strings.TrimSpace(r.FormValue("podAlertMessage"))
-		alertType := r.FormValue("podAlertType")
 
 		displayDatesInTimezone := r.FormValue("displayDatesInTimezone")
 		displayTimePreference := r.FormValue("displayTimePreference")
@@ -61,6 +84,7 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 		displayImagesPreference := r.FormValue("displayImagesPreference")
 		displayMedia := r.FormValue("displayMedia") == "on"
 		originalMedia := r.FormValue("originalMedia") == "on"
+		discoverRanking := r.FormValue("discoverRanking")
 
 		// Clean lines from DOS (\r\n) to UNIX (\n)
 		logo = strings.ReplaceAll(logo, "\r\n", "\n")
@@ -68,11 +92,21 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 
 		permittedImages = strings.Trim(strings.ReplaceAll(permittedImages, "\r\n", "\n"), "\n")
 		blockedFeeds = strings.Trim(strings.ReplaceAll(blockedFeeds, "\r\n", "\n"), "\n")
+		allowedFeeds = strings.Trim(strings.ReplaceAll(allowedFeeds, "\r\n", "\n"), "\n")
 		enabledFeatures = strings.Trim(strings.ReplaceAll(enabledFeatures, "\r\n", "\n"), "\n")
+		reservedUsernames = strings.Trim(strings.ReplaceAll(reservedUsernames, "\r\n", "\n"), "\n")
+		usernameProfanity = strings.Trim(strings.ReplaceAll(usernameProfanity, "\r\n", "\n"), "\n")
+
+		logLevels := make(map[string]string)
+		for _, subsystem := range LogSubsystems {
+			if level := r.FormValue("logLevel-" + subsystem); level != "" {
+				logLevels[subsystem] = level
+			}
+		}
 
 		// Update pod name
 		if name != "" {
-			s.config.Name = name
+			s.config().Name = name
 		} else {
 			ctx.Error = true
 			ctx.Message = "Pod name not specified"
@@ -82,7 +116,7 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 
 		// Update pod logo
 		if logo != "" {
-			s.config.Logo = logo
+			s.config().Logo = logo
 		} else {
 			ctx.Error = true
 			ctx.Message = "Pod logo not provided"
@@ -90,12 +124,36 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 			return
 		}
 
+		// Update uploaded logo and favicon variants
+		for _, variant := range BrandingVariants {
+			if r.FormValue("removeBranding-"+variant) == "on" {
+				RemoveBrandingImage(s.config(), variant)
+				continue
+			}
+
+			file, _, err := r.FormFile("branding-" + variant)
+			if err == http.ErrMissingFile {
+				continue
+			}
+			if err == nil {
+				err = StoreBrandingImage(s.config(), variant, file)
+				file.Close()
+			}
+			if err != nil {
+				log.WithError(err).Errorf("error storing branding image %s", variant)
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error uploading %s: %s", variant, err)
+				s.render("error", w, ctx)
+				return
+			}
+		}
+
 		// Update CSS customisation
-		s.config.CSS = css
+		s.config().CSS = css
 
 		// Update pod description
 		if description != "" {
-			s.config.Description = description
+			s.config().Description = description
 		} else {
 			ctx.Error = true
 			ctx.Message = "Pod description not provided"
@@ -103,27 +161,26 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 			return
 		}
 
-		// Update alert type and message
-		s.config.AlertFloat = alertFloat
-		s.config.AlertGuest = alertGuest
-		s.config.AlertMessage = alertMessage
-		s.config.AlertType = alertType
+		// Update whether announcements float
+		s.config().AlertFloat = alertFloat
 
 		// Update Max Twt Length
-		s.config.MaxTwtLength = maxTwtLength
+		s.config().MaxTwtLength = maxTwtLength
 		// Update Twts Per Page
-		s.config.TwtsPerPage = twtsPerPage
+		s.config().TwtsPerPage = twtsPerPage
 		// Update Avatar Resolution
-		s.config.AvatarResolution = avatarResolution
+		s.config().AvatarResolution = avatarResolution
 		// Update Media Resolution
-		s.config.MediaResolution = mediaResolution
+		s.config().MediaResolution = mediaResolution
 		// Update open profiles
-		s.config.OpenProfiles = openProfiles
+		s.config().OpenProfiles = openProfiles
+		// Update public api
+		s.config().PublicAPI = publicAPI
 		// Update open registrations
-		s.config.OpenRegistrations = openRegistrations
+		s.config().OpenRegistrations = openRegistrations
 
 		// Update PermittedImages
-		if err := WithPermittedImages(strings.Split(permittedImages, "\n"))(s.config); err != nil {
+		if err := WithPermittedImages(strings.Split(permittedImages, "\n"))(s.config()); err != nil {
 			ctx.Error = true
 			ctx.Message = fmt.Sprintf("Error applying permitted images: %s", err)
 			s.render("error", w, ctx)
@@ -131,13 +188,39 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 		}
 
 		// Update BlockedFeeds
-		if err := WithBlockedFeeds(strings.Split(blockedFeeds, "\n"))(s.config); err != nil {
+		if err := WithBlockedFeeds(strings.Split(blockedFeeds, "\n"))(s.config()); err != nil {
 			ctx.Error = true
 			ctx.Message = fmt.Sprintf("Error applying blocked feeds: %s", err)
 			s.render("error", w, ctx)
 			return
 		}
 
+		// Update AllowedFeeds
+		if err := WithAllowedFeeds(strings.Split(allowedFeeds, "\n"))(s.config()); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error applying allowed feeds: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		// Update Username Policy
+		if usernameMaxLength > 0 && usernameMinLength > usernameMaxLength {
+			ctx.Error = true
+			ctx.Message = "Minimum username length cannot exceed the maximum length"
+			s.render("error", w, ctx)
+			return
+		}
+		if err := WithUsernamePattern(usernamePattern)(s.config()); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error applying username pattern: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+		s.config().ReservedUsernames = strings.Split(reservedUsernames, "\n")
+		s.config().UsernameMinLength = usernameMinLength
+		s.config().UsernameMaxLength = usernameMaxLength
+		s.config().UsernameProfanity = strings.Split(usernameProfanity, "\n")
+
 		// Update Enabled Optional Features
 
 		features, err := FeaturesFromStrings(strings.Split(enabledFeatures, "\n"))
@@ -147,7 +230,7 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 			s.render("error", w, ctx)
 			return
 		}
-		if err := WithEnabledFeatures(features)(s.config); err != nil {
+		if err := WithEnabledFeatures(features)(s.config()); err != nil {
 			ctx.Error = true
 			ctx.Message = fmt.Sprintf("Error applying features: %s", err)
 			s.render("error", w, ctx)
@@ -155,15 +238,57 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 		}
 
 		// Update Pod Settings (overrideable by Users)
-		s.config.DisplayDatesInTimezone = displayDatesInTimezone
-		s.config.DisplayTimePreference = displayTimePreference
-		s.config.OpenLinksInPreference = openLinksInPreference
-		s.config.DisplayImagesPreference = displayImagesPreference
-		s.config.DisplayMedia = displayMedia
-		s.config.OriginalMedia = originalMedia
+		s.config().DisplayDatesInTimezone = displayDatesInTimezone
+		s.config().DisplayTimePreference = displayTimePreference
+		s.config().OpenLinksInPreference = openLinksInPreference
+		s.config().DisplayImagesPreference = displayImagesPreference
+		s.config().DisplayMedia = displayMedia
+		s.config().OriginalMedia = originalMedia
+		if IsDiscoverRanking(discoverRanking) {
+			s.config().DiscoverRanking = discoverRanking
+		}
+
+		// Update log levels of subsystems
+		if err := SetLogLevels(logLevels); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error applying log levels: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+		s.config().LogLevels = logLevels
+
+		// Update the pod's active theme and reload its templates
+		if theme != s.config().ActiveTheme {
+			if theme != "" {
+				found := false
+				for _, info := range s.config().AvailableThemes() {
+					if info.ID == theme {
+						found = true
+						break
+					}
+				}
+				if !found {
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("Theme %s not found", theme)
+					s.render("error", w, ctx)
+					return
+				}
+			}
+
+			previousTheme := s.config().ActiveTheme
+			s.config().ActiveTheme = theme
+			if err := s.tmplman.Reload(); err != nil {
+				log.WithError(err).Errorf("error loading templates for theme %s", theme)
+				s.config().ActiveTheme = previousTheme
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error loading theme %s: %s", theme, err)
+				s.render("error", w, ctx)
+				return
+			}
+		}
 
 		// Save config file
-		if err := s.config.Settings().Save(filepath.Join(s.config.Data, "settings.yaml")); err != nil {
+		if err := s.config().Settings().Save(filepath.Join(s.config().Data, "settings.yaml")); err != nil {
 			log.WithError(err).Error("error saving config")
 			ctx.Error = true
 			ctx.Message = "Error saving pod settings"
@@ -179,7 +304,7 @@ func (s *Server) ManagePodHandler() httprouter.Handle {
 
 // ManageUsersHandler ...
 func (s *Server) ManageUsersHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -191,13 +316,96 @@ func (s *Server) ManageUsersHandler() httprouter.Handle {
 			return
 		}
 
+		users, err := s.db.GetAllUsers()
+		if err != nil {
+			log.WithError(err).Error("error loading users")
+		}
+		for _, user := range users {
+			if !user.IsActive() {
+				ctx.InactiveUsers = append(ctx.InactiveUsers, user)
+			}
+		}
+
+		entries, err := audit.Entries(maxAuditEntries)
+		if err != nil {
+			log.WithError(err).Error("error reading audit log")
+		}
+		ctx.AuditEntries = entries
+
 		s.render("manageUsers", w, ctx)
 	}
 }
 
+// SetUserStateHandler suspends, disables or reactivates a user's account
+func (s *Server) SetUserStateHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		username := NormalizeUsername(r.FormValue("username"))
+		reason := strings.TrimSpace(r.FormValue("reason"))
+
+		state, err := ParseAccountState(r.FormValue("state"))
+		if err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Invalid account state %s", r.FormValue("state"))
+			s.render("error", w, ctx)
+			return
+		}
+
+		if username == NormalizeUsername(s.config().AdminUser) {
+			ctx.Error = true
+			ctx.Message = "Cannot change the state of the Pod Owner's account"
+			s.render("error", w, ctx)
+			return
+		}
+
+		user, err := s.db.GetUser(username)
+		if err != nil {
+			log.WithError(err).Errorf("error loading user object for %s", username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorGetUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		previous := user.AccountState()
+		if err := user.SetAccountState(state, reason); err != nil {
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Cannot change state of %s from %s to %s", username, previous, state)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := s.db.SetUser(username, user); err != nil {
+			log.WithError(err).Errorf("error saving user object for %s", username)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error changing state of %s", username)
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err := audit.Record(ctx.Username, fmt.Sprintf("%s -> %s", previous, state), username, reason); err != nil {
+			log.WithError(err).Error("error recording audit entry")
+		}
+
+		ctx.Error = false
+		ctx.Message = fmt.Sprintf("Successfully changed state of %s to %s", username, state)
+		s.render("error", w, ctx)
+	}
+}
+
 // AddUserHandler ...
 func (s *Server) AddUserHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -216,7 +424,7 @@ func (s *Server) AddUserHandler() httprouter.Handle {
 		// Random password -- User is expected to user "Password Reset"
 		password := shortuuid.New()
 
-		if err := ValidateUsername(username); err != nil {
+		if err := s.config().ValidateUsername(username); err != nil {
 			ctx.Error = true
 			ctx.Message = fmt.Sprintf("Username validation failed: %s", err.Error())
 			s.render("error", w, ctx)
@@ -230,7 +438,7 @@ func (s *Server) AddUserHandler() httprouter.Handle {
 			return
 		}
 
-		p := filepath.Join(s.config.Data, feedsDir)
+		p := filepath.Join(s.config().Data, feedsDir)
 		if err := os.MkdirAll(p, 0755); err != nil {
 			log.WithError(err).Error("error creating feeds directory")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -264,7 +472,7 @@ func (s *Server) AddUserHandler() httprouter.Handle {
 		user.Username = username
 		user.Recovery = recoveryHash
 		user.Password = hash
-		user.URL = URLForUser(s.config.BaseURL, username)
+		user.URL = URLForUser(s.config().BaseURL, username)
 		user.CreatedAt = time.Now()
 
 		if err := s.db.SetUser(username, user); err != nil {
@@ -281,7 +489,7 @@ func (s *Server) AddUserHandler() httprouter.Handle {
 
 // DelUserHandler ...
 func (s *Server) DelUserHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -304,150 +512,18 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 			return
 		}
 
-		// Get all user feeds
-		feeds, err := s.db.GetAllFeeds()
-		if err != nil {
-			ctx.Error = true
-			ctx.Message = "An error occured whilst deleting your account"
-			s.render("error", w, ctx)
-			return
-		}
-
-		for _, feed := range feeds {
-			// Get user's owned feeds
-			if user.OwnsFeed(feed.Name) {
-				// Get twts in a feed
-				nick := feed.Name
-				if nick != "" {
-					if s.db.HasFeed(nick) {
-						// Fetch feed twts
-						twts, err := GetAllTwts(s.config, nick)
-						if err != nil {
-							ctx.Error = true
-							ctx.Message = "An error occured whilst deleting your account"
-							s.render("error", w, ctx)
-							return
-						}
-
-						// Parse twts to search and remove uploaded media
-						for _, twt := range twts {
-							// Delete archived twts
-							if err := s.archive.Del(twt.Hash()); err != nil {
-								ctx.Error = true
-								ctx.Message = "An error occured whilst deleting your account"
-								s.render("error", w, ctx)
-								return
-							}
-
-							mediaPaths := GetMediaNamesFromText(fmt.Sprintf("%t", twt))
-
-							// Remove all uploaded media in a twt
-							for _, mediaPath := range mediaPaths {
-								// Delete .png
-								fn := filepath.Join(s.config.Data, mediaDir, fmt.Sprintf("%s.png", mediaPath))
-								if FileExists(fn) {
-									if err := os.Remove(fn); err != nil {
-										ctx.Error = true
-										ctx.Message = "An error occured whilst deleting your account"
-										s.render("error", w, ctx)
-										return
-									}
-								}
-							}
-						}
-					}
-				}
-
-				// Delete feed
-				if err := s.db.DelFeed(nick); err != nil {
-					ctx.Error = true
-					ctx.Message = "An error occured whilst deleting your account"
-					s.render("error", w, ctx)
-					return
-				}
-
-				// Delete feeds's twtxt.txt
-				fn := filepath.Join(s.config.Data, feedsDir, nick)
-				if FileExists(fn) {
-					if err := os.Remove(fn); err != nil {
-						log.WithError(err).Error("error removing feed")
-						ctx.Error = true
-						ctx.Message = "An error occured whilst deleting your account"
-						s.render("error", w, ctx)
-					}
-				}
-
-				// Delete feed from cache
-				s.cache.DeleteFeeds(feed.Source())
-			}
-		}
-
-		// Get user's primary feed twts
-		twts, err := GetAllTwts(s.config, user.Username)
-		if err != nil {
-			ctx.Error = true
-			ctx.Message = "An error occured whilst deleting your account"
-			s.render("error", w, ctx)
-			return
-		}
-
-		// Parse twts to search and remove primary feed uploaded media
-		for _, twt := range twts {
-			// Delete archived twts
-			if err := s.archive.Del(twt.Hash()); err != nil {
-				ctx.Error = true
-				ctx.Message = "An error occured whilst deleting your account"
-				s.render("error", w, ctx)
-				return
-			}
-
-			mediaPaths := GetMediaNamesFromText(fmt.Sprintf("%t", twt))
-
-			// Remove all uploaded media in a twt
-			for _, mediaPath := range mediaPaths {
-				// Delete .png
-				fn := filepath.Join(s.config.Data, mediaDir, fmt.Sprintf("%s.png", mediaPath))
-				if FileExists(fn) {
-					if err := os.Remove(fn); err != nil {
-						log.WithError(err).Error("error removing media")
-						ctx.Error = true
-						ctx.Message = "An error occured whilst deleting your account"
-						s.render("error", w, ctx)
-					}
-				}
-			}
-		}
-
-		// Delete user's primary feed
-		if err := s.db.DelFeed(user.Username); err != nil {
+		if err := PurgeUser(s.config(), s.cache, s.archive, s.db, user); err != nil {
+			log.WithError(err).Errorf("error deleting account %s", user.Username)
 			ctx.Error = true
-			ctx.Message = "An error occured whilst deleting your account"
+			ctx.Message = "An error occured whilst deleting the account"
 			s.render("error", w, ctx)
 			return
 		}
 
-		// Delete user's twtxt.txt
-		fn := filepath.Join(s.config.Data, feedsDir, user.Username)
-		if FileExists(fn) {
-			if err := os.Remove(fn); err != nil {
-				log.WithError(err).Error("error removing user's feed")
-				ctx.Error = true
-				ctx.Message = "An error occured whilst deleting your account"
-				s.render("error", w, ctx)
-			}
-		}
-
-		// Delete user
-		if err := s.db.DelUser(user.Username); err != nil {
-			ctx.Error = true
-			ctx.Message = "An error occured whilst deleting your account"
-			s.render("error", w, ctx)
-			return
+		if err := audit.Record(ctx.Username, "delete user", user.Username, ""); err != nil {
+			log.WithError(err).Error("error recording audit entry")
 		}
 
-		// Delete user's feed from cache
-		s.cache.DeleteFeeds(user.Source())
-
 		ctx.Error = false
 		ctx.Message = "Successfully deleted account"
 		s.render("error", w, ctx)
@@ -456,7 +532,7 @@ func (s *Server) DelUserHandler() httprouter.Handle {
 
 // DelFeedHandler ...
 func (s *Server) DelFeedHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -488,7 +564,7 @@ func (s *Server) DelFeedHandler() httprouter.Handle {
 		}
 
 		// Delete feeds's twtxt.txt
-		fn := filepath.Join(s.config.Data, feedsDir, name)
+		fn := filepath.Join(s.config().Data, feedsDir, name)
 		if FileExists(fn) {
 			if err := os.Remove(fn); err != nil {
 				log.WithError(err).Error("error removing feed")
@@ -501,6 +577,10 @@ func (s *Server) DelFeedHandler() httprouter.Handle {
 		// Delete feed from cache
 		s.cache.DeleteFeeds(feed.Source())
 
+		if err := audit.Record(ctx.Username, "delete feed", feed.Name, ""); err != nil {
+			log.WithError(err).Error("error recording audit entry")
+		}
+
 		ctx.Error = false
 		ctx.Message = "Successfully deleted account"
 		s.render("error", w, ctx)
@@ -509,7 +589,7 @@ func (s *Server) DelFeedHandler() httprouter.Handle {
 
 // RstUserHandler ...
 func (s *Server) RstUserHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -556,6 +636,10 @@ func (s *Server) RstUserHandler() httprouter.Handle {
 			return
 		}
 
+		if err := audit.Record(ctx.Username, "reset password", username, ""); err != nil {
+			log.WithError(err).Error("error recording audit entry")
+		}
+
 		ctx.Error = false
 		ctx.Message = fmt.Sprintf(
 			"Successfully reset password for %s to: %s",
@@ -567,7 +651,7 @@ func (s *Server) RstUserHandler() httprouter.Handle {
 
 // RefreshCacheHandler ...
 func (s *Server) RefreshCacheHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	var UpdateFeeds Job
 	for _, entry := range s.cron.Entries() {
@@ -590,7 +674,7 @@ func (s *Server) RefreshCacheHandler() httprouter.Handle {
 			return
 		}
 
-		s.tasks.DispatchFunc(func() error {
+		s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityBackground, func() error {
 			s.cache.Reset()
 			UpdateFeeds.Run()
 			return nil
@@ -602,9 +686,38 @@ func (s *Server) RefreshCacheHandler() httprouter.Handle {
 	}
 }
 
+// ReloadHandler reloads the pod's settings, translations and templates
+// without restarting the pod
+func (s *Server) ReloadHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if err := s.Reload(); err != nil {
+			log.WithError(err).Error("error reloading pod")
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error reloading pod: %s", err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = "Successfully reloaded pod settings, translations and templates"
+		s.render("error", w, ctx)
+	}
+}
+
 // ManagePeersHandler ...
 func (s *Server) ManagePeersHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -616,7 +729,64 @@ func (s *Server) ManagePeersHandler() httprouter.Handle {
 			return
 		}
 
+		if r.Method == http.MethodPost {
+			uri, err := NormalizePeerURI(r.FormValue("uri"))
+			if err != nil {
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Invalid peer %s: %s", r.FormValue("uri"), err)
+				s.render("error", w, ctx)
+				return
+			}
+
+			if r.FormValue("action") == "remove" {
+				if err := s.db.DelPeer(uri); err != nil {
+					log.WithError(err).Errorf("error removing peer %s", uri)
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("Error removing peer %s", uri)
+					s.render("error", w, ctx)
+					return
+				}
+			} else {
+				state, err := ParsePeerState(r.FormValue("state"))
+				if err != nil {
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("Invalid state %s for peer %s", r.FormValue("state"), uri)
+					s.render("error", w, ctx)
+					return
+				}
+
+				peer := &ManagedPeer{
+					URI:     uri,
+					State:   state,
+					AddedBy: ctx.Username,
+					AddedAt: time.Now(),
+				}
+				if existing, err := s.db.GetPeer(uri); err == nil {
+					peer.AddedBy = existing.AddedBy
+					peer.AddedAt = existing.AddedAt
+				}
+
+				if err := s.db.SetPeer(uri, peer); err != nil {
+					log.WithError(err).Errorf("error saving peer %s", uri)
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("Error saving peer %s", uri)
+					s.render("error", w, ctx)
+					return
+				}
+			}
+
+			if _, err := s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityBackground, func() error {
+				return RefreshManagedPeers(s.config(), s.cache, s.db)
+			}); err != nil {
+				log.WithError(err).Error("error dispatching task to refresh managed peers")
+			}
+
+			http.Redirect(w, r, "/manage/peers", http.StatusFound)
+			return
+		}
+
 		ctx.Peers = s.cache.GetPeers()
+		ctx.ManagedPeers = s.cache.GetManagedPeers()
 
 		s.render("managePeers", w, ctx)
 	}
@@ -624,7 +794,7 @@ func (s *Server) ManagePeersHandler() httprouter.Handle {
 
 // ManageJobsHandler ...
 func (s *Server) ManageJobsHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -638,35 +808,141 @@ func (s *Server) ManageJobsHandler() httprouter.Handle {
 
 		if r.Method == http.MethodPost {
 			name := strings.TrimSpace(r.FormValue("name"))
-
-			var job Job
-			for _, entry := range s.cron.Entries() {
-				if strings.EqualFold(name, entry.Job.(Job).String()) {
-					job = entry.Job.(Job)
-					break
-				}
+			action := strings.TrimSpace(r.FormValue("action"))
+			if action == "" {
+				action = "run"
 			}
 
-			if job == nil {
+			if err := manageJob(s.tasks, name, action); err != nil {
+				if err == ErrJobNotFound {
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("No job found by that name: %s", name)
+					s.render("404", w, ctx)
+					return
+				}
+				log.WithError(err).Errorf("error managing job %s (%s)", name, action)
 				ctx.Error = true
-				ctx.Message = fmt.Sprintf("No job found by that name: %s", name)
-				s.render("404", w, ctx)
+				ctx.Message = fmt.Sprintf("Error managing job %s: %s", name, err)
+				s.render("error", w, ctx)
 				return
 			}
 
-			s.tasks.DispatchFunc(func() error {
-				job.Run()
-				return nil
-			})
+			if err := audit.Record(ctx.Username, fmt.Sprintf("%s job", action), name, ""); err != nil {
+				log.WithError(err).Error("error recording audit entry")
+			}
 
 			ctx.Error = false
-			ctx.Message = fmt.Sprintf("Job %s successfully queued for execution", name)
+			switch action {
+			case "run":
+				ctx.Message = fmt.Sprintf("Job %s successfully queued for execution", name)
+			case "disable":
+				ctx.Message = fmt.Sprintf("Job %s disabled", name)
+			default:
+				ctx.Message = fmt.Sprintf("Job %s enabled", name)
+			}
 			s.render("error", w, ctx)
 
 			return
 		}
 
-		ctx.Jobs = s.cron.Entries()
+		ctx.Jobs = jobRegistry.Statuses()
+
+		deadTasks, err := s.tasks.DeadTasks()
+		if err != nil {
+			log.WithError(err).Error("error loading dead tasks")
+		}
+		ctx.DeadTasks = deadTasks
+
 		s.render("manageJobs", w, ctx)
 	}
 }
+
+// ManageTasksHandler retries or discards a media task that failed all its
+// attempts (a dead letter listed on /manage/jobs)
+func (s *Server) ManageTasksHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		id := strings.TrimSpace(r.FormValue("id"))
+
+		var err error
+		switch r.FormValue("action") {
+		case "retry":
+			err = s.tasks.RetryDeadTask(id)
+		case "discard":
+			err = s.tasks.DiscardDeadTask(id)
+		default:
+			ctx.Error = true
+			ctx.Message = "Invalid action"
+			s.render("error", w, ctx)
+			return
+		}
+
+		if err != nil {
+			if err == ErrTaskNotFound {
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("No failed task found by that id: %s", id)
+				s.render("404", w, ctx)
+				return
+			}
+			log.WithError(err).Errorf("error managing task %s", id)
+			ctx.Error = true
+			ctx.Message = fmt.Sprintf("Error managing task %s: %s", id, err)
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/jobs", http.StatusFound)
+	}
+}
+
+// ManageGraylistHandler lists the graylisted feeds (See: Graylist) and lets
+// the Pod Owner/Operator approve them
+func (s *Server) ManageGraylistHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			url := NormalizeURL(r.FormValue("url"))
+			if err := graylist.Approve(url); err != nil {
+				log.WithError(err).Errorf("error approving graylisted feed %s", url)
+				ctx.Error = true
+				ctx.Message = fmt.Sprintf("Error approving feed %s", url)
+				s.render("error", w, ctx)
+				return
+			}
+
+			if err := audit.Record(ctx.Username, "approve feed", url, ""); err != nil {
+				log.WithError(err).Error("error recording audit entry")
+			}
+
+			// Let the feed's twts into the Discover timeline
+			s.cache.Refresh()
+
+			http.Redirect(w, r, "/manage/graylist", http.StatusFound)
+			return
+		}
+
+		ctx.Graylist = graylist.Entries()
+
+		s.render("manageGraylist", w, ctx)
+	}
+}
@@ -13,12 +13,11 @@ import (
 	"time"
 
 	"github.com/julienschmidt/httprouter"
-	log "github.com/sirupsen/logrus"
 )
 
 // MediaHandler ...
 func (s *Server) MediaHandler() httprouter.Handle {
-	dir := filepath.Join(s.config.Data, mediaDir)
+	dir := filepath.Join(s.config().Data, mediaDir)
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		name := p.ByName("name")
@@ -62,7 +61,7 @@ func (s *Server) MediaHandler() httprouter.Handle {
 
 		fileInfo, err := os.Stat(fn)
 		if err != nil {
-			log.WithError(err).Error("error reading media file info")
+			Logger(LogMedia).WithError(err).Error("error reading media file info")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -77,7 +76,7 @@ func (s *Server) MediaHandler() httprouter.Handle {
 
 		f, err := os.Open(fn)
 		if err != nil {
-			log.WithError(err).Error("error opening media file")
+			Logger(LogMedia).WithError(err).Error("error opening media file")
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
@@ -97,13 +96,13 @@ func (s *Server) MediaHandler() httprouter.Handle {
 // UploadMediaHandler ...
 func (s *Server) UploadMediaHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		if s.config.DisableMedia {
+		if s.config().DisableMedia {
 			http.Error(w, "Media support disabled", http.StatusNotFound)
 			return
 		}
 
 		// Limit request body to to abuse
-		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUploadSize)
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
 		defer r.Body.Close()
 
 		mfile, headers, err := r.FormFile("media_file")
@@ -112,7 +111,7 @@ func (s *Server) UploadMediaHandler() httprouter.Handle {
 				http.Error(w, "Media Upload Too Large", http.StatusRequestEntityTooLarge)
 				return
 			}
-			log.WithError(err).Error("error parsing form file")
+			Logger(LogMedia).WithError(err).Error("error parsing form file")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -129,64 +128,64 @@ func (s *Server) UploadMediaHandler() httprouter.Handle {
 		if strings.HasPrefix(ctype, "image/") {
 			fn, err := ReceiveImage(mfile)
 			if err != nil {
-				log.WithError(err).Error("error writing uploaded image")
+				Logger(LogMedia).WithError(err).Error("error writing uploaded image")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			uuid, err := s.tasks.Dispatch(NewImageTask(s.config, fn))
+			uuid, err := s.tasks.Dispatch(NewImageTask(s.config(), fn))
 			if err != nil {
-				log.WithError(err).Error("error dispatching image processing task")
+				Logger(LogMedia).WithError(err).Error("error dispatching image processing task")
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 			uri.Type = "taskURI"
-			uri.Path = URLForTask(s.config.BaseURL, uuid)
+			uri.Path = URLForTask(s.config().BaseURL, uuid)
 		}
 
 		if strings.HasPrefix(ctype, "audio/") {
-			if s.config.DisableFfmpeg {
+			if s.config().DisableFfmpeg {
 				http.Error(w, "FFMpeg support disabled", http.StatusNotFound)
 				return
 			}
 
 			fn, err := ReceiveAudio(mfile)
 			if err != nil {
-				log.WithError(err).Error("error writing uploaded audio")
+				Logger(LogMedia).WithError(err).Error("error writing uploaded audio")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			uuid, err := s.tasks.Dispatch(NewAudioTask(s.config, fn))
+			uuid, err := s.tasks.Dispatch(NewAudioTask(s.config(), fn))
 			if err != nil {
-				log.WithError(err).Error("error dispatching audio transcoding task")
+				Logger(LogMedia).WithError(err).Error("error dispatching audio transcoding task")
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 			uri.Type = "taskURI"
-			uri.Path = URLForTask(s.config.BaseURL, uuid)
+			uri.Path = URLForTask(s.config().BaseURL, uuid)
 		}
 
 		if strings.HasPrefix(ctype, "video/") {
-			if s.config.DisableFfmpeg {
+			if s.config().DisableFfmpeg {
 				http.Error(w, "FFMpeg support disabled", http.StatusNotFound)
 				return
 			}
 			fn, err := ReceiveVideo(mfile)
 			if err != nil {
-				log.WithError(err).Error("error writing uploaded video")
+				Logger(LogMedia).WithError(err).Error("error writing uploaded video")
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
 			}
 
-			uuid, err := s.tasks.Dispatch(NewVideoTask(s.config, fn))
+			uuid, err := s.tasks.Dispatch(NewVideoTask(s.config(), fn))
 			if err != nil {
-				log.WithError(err).Error("error dispatching vodeo transcode task")
+				Logger(LogMedia).WithError(err).Error("error dispatching vodeo transcode task")
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 			uri.Type = "taskURI"
-			uri.Path = URLForTask(s.config.BaseURL, uuid)
+			uri.Path = URLForTask(s.config().BaseURL, uuid)
 		}
 
 		if uri.IsZero() {
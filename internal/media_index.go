@@ -0,0 +1,35 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"regexp"
+
+	"go.yarn.social/types"
+)
+
+// mediaRegex matches the (markdown) images of a twt, ![alt](url "title")
+var mediaRegex = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)[^)]*\)`)
+
+// GetMediaURLs returns the urls of the media (images, audio, video) embedded
+// in a twt
+func GetMediaURLs(twt types.Twt) []string {
+	var urls []string
+	for _, match := range mediaRegex.FindAllStringSubmatch(fmt.Sprintf("%t", twt), -1) {
+		urls = append(urls, match[1])
+	}
+	return urls
+}
+
+// HasMedia returns true if a twt embeds any media
+func HasMedia(twt types.Twt) bool {
+	return mediaRegex.MatchString(fmt.Sprintf("%t", twt))
+}
+
+// mediaViewKey returns the key of the cache view (media index) of the twts
+// of a feed with media
+func mediaViewKey(uri string) string {
+	return fmt.Sprintf("media:%s", uri)
+}
@@ -0,0 +1,252 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	proxyDir = "proxy"
+
+	// mediaProxyMaxAge is how long a proxied image is cached before it is
+	// fetched again (and purged if no longer requested)
+	mediaProxyMaxAge = 7 * 24 * time.Hour
+
+	// mediaProxyTimeout is the timeout for fetching a proxied image
+	mediaProxyTimeout = 30 * time.Second
+)
+
+var (
+	// ErrProxyInvalidURL is returned for a proxied image that is not an
+	// absolute http(s) URL
+	ErrProxyInvalidURL = errors.New("error: invalid image url")
+
+	// ErrProxyNotPermitted is returned for a proxied image whose domain is
+	// not permitted (See: Config.PermittedImage)
+	ErrProxyNotPermitted = errors.New("error: image domain not permitted")
+
+	// ErrProxyTooLarge is returned for a proxied image larger than the
+	// maximum upload size
+	ErrProxyTooLarge = errors.New("error: image too large")
+)
+
+// proxyFetches collapses concurrent fetches of the same proxied image
+var proxyFetches singleflight.Group
+
+// URLForProxy returns the URL of the media proxy serving an external image
+func URLForProxy(conf *Config, uri string) string {
+	return fmt.Sprintf(
+		"%s/proxy?url=%s",
+		strings.TrimSuffix(conf.BaseURL, "/"),
+		url.QueryEscape(uri),
+	)
+}
+
+// proxiedImage returns the cached file of a proxied image (empty if not
+// cached or stale)
+func proxiedImage(conf *Config, name string) string {
+	for _, ext := range []string{"png", "gif"} {
+		fn := filepath.Join(conf.Data, proxyDir, fmt.Sprintf("%s.%s", name, ext))
+		stat, err := os.Stat(fn)
+		if err != nil {
+			continue
+		}
+		if time.Since(stat.ModTime()) > mediaProxyMaxAge {
+			return ""
+		}
+		return fn
+	}
+	return ""
+}
+
+// validateProxiedImageURL returns an error if u is not an absolute http(s)
+// url of an external domain permitted by the media proxy
+func validateProxiedImageURL(conf *Config, u *url.URL) error {
+	if u == nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrProxyInvalidURL
+	}
+
+	domain := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	if permitted, local := conf.PermittedImage(domain); !permitted || local {
+		return ErrProxyNotPermitted
+	}
+
+	return nil
+}
+
+// FetchProxiedImage fetches, resizes and caches an external image served by
+// the media proxy, returns the cached file
+func FetchProxiedImage(conf *Config, uri string) (string, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return "", ErrProxyInvalidURL
+	}
+	if err := validateProxiedImageURL(conf, u); err != nil {
+		return "", err
+	}
+
+	name := FastHashString(uri)
+	if fn := proxiedImage(conf, name); fn != "" {
+		return fn, nil
+	}
+
+	v, err, _ := proxyFetches.Do(name, func() (interface{}, error) {
+		// Remove a stale image before it is fetched again
+		stale, _ := filepath.Glob(filepath.Join(conf.Data, proxyDir, fmt.Sprintf("%s.*", name)))
+		for _, fn := range stale {
+			os.Remove(fn)
+		}
+
+		client := NewFetchClient(conf, mediaProxyTimeout)
+
+		// A permitted domain must not redirect the proxy anywhere else
+		checkRedirect := client.CheckRedirect
+		client.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+			if err := checkRedirect(req, via); err != nil {
+				return err
+			}
+			return validateProxiedImageURL(conf, req.URL)
+		}
+
+		res, err := client.Get(uri)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+
+		if res.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("error: non-success HTTP %s fetching %s", res.Status, uri)
+		}
+
+		if !strings.HasPrefix(strings.ToLower(res.Header.Get("Content-Type")), "image/") {
+			return "", ErrInvalidImage
+		}
+
+		if res.ContentLength > conf.MaxUploadSize {
+			return "", ErrProxyTooLarge
+		}
+
+		tf, err := receiveFile(io.LimitReader(res.Body, conf.MaxUploadSize+1), "yarnd-proxy-*")
+		if err != nil {
+			return "", err
+		}
+		defer os.Remove(tf.Name())
+		defer tf.Close()
+
+		stat, err := tf.Stat()
+		if err != nil {
+			return "", err
+		}
+		if stat.Size() > conf.MaxUploadSize {
+			return "", ErrProxyTooLarge
+		}
+
+		if !IsImage(tf.Name()) {
+			return "", ErrInvalidImage
+		}
+
+		opts := &ImageOptions{Resize: true, Width: conf.MediaResolution}
+		if _, err := ProcessImage(conf, tf.Name(), proxyDir, name, opts); err != nil {
+			return "", err
+		}
+
+		// Only the resized image is served
+		orig, _ := filepath.Glob(filepath.Join(conf.Data, proxyDir, fmt.Sprintf("%s.orig.*", name)))
+		for _, fn := range orig {
+			os.Remove(fn)
+		}
+
+		fn := proxiedImage(conf, name)
+		if fn == "" {
+			return "", ErrInvalidImage
+		}
+		return fn, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return v.(string), nil
+}
+
+// PurgeProxiedImages removes cached proxied images older than
+// mediaProxyMaxAge
+func PurgeProxiedImages(conf *Config) (int, error) {
+	dir := filepath.Join(conf.Data, proxyDir)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	purged := 0
+	for _, file := range files {
+		if time.Since(file.ModTime()) <= mediaProxyMaxAge {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, file.Name())); err != nil {
+			log.WithError(err).Warnf("error removing proxied image %s", file.Name())
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// ProxyHandler serves external images referenced in twts through the Pod so
+// the users' IPs are not exposed to third-party servers and images are never
+// served over plain HTTP
+func (s *Server) ProxyHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if s.config().DisableMediaProxy {
+			http.Error(w, "Media Proxy Disabled", http.StatusNotFound)
+			return
+		}
+
+		uri := r.URL.Query().Get("url")
+		if uri == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		fn, err := FetchProxiedImage(s.config(), uri)
+		if err != nil {
+			switch err {
+			case ErrProxyInvalidURL:
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+			case ErrProxyNotPermitted:
+				http.Error(w, "Forbidden", http.StatusForbidden)
+			case ErrProxyTooLarge:
+				http.Error(w, "Request Entity Too Large", http.StatusRequestEntityTooLarge)
+			default:
+				log.WithError(err).Warnf("error proxying image %s", uri)
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			}
+			return
+		}
+
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(mediaProxyMaxAge.Seconds())))
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+
+		http.ServeFile(w, r, fn)
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchProxiedImageRedirects(t *testing.T) {
+	// An arbitrary non-image page on a domain that is not permitted
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html>Hello World!</html>"))
+	}))
+	defer other.Close()
+
+	otherURL, err := url.Parse(other.URL)
+	require.NoError(t, err)
+	otherURL.Host = strings.Replace(otherURL.Host, "127.0.0.1", "localhost", 1)
+
+	permitted := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/redirect":
+			http.Redirect(w, r, otherURL.String(), http.StatusFound)
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte("<html>Hello World!</html>"))
+		}
+	}))
+	defer permitted.Close()
+
+	conf := NewConfig()
+	conf.Data = t.TempDir()
+	conf.MaxUploadSize = DefaultMaxUploadSize
+	require.NoError(t, WithBaseURL("https://pod.example")(conf))
+	require.NoError(t, WithFetchAllowedNetworks([]string{"127.0.0.0/8", "::1/128"})(conf))
+	require.NoError(t, WithPermittedImages([]string{`^127\.0\.0\.1$`})(conf))
+
+	_, err = FetchProxiedImage(conf, permitted.URL+"/redirect")
+	assert.ErrorIs(t, err, ErrProxyNotPermitted)
+
+	_, err = FetchProxiedImage(conf, permitted.URL+"/page")
+	assert.ErrorIs(t, err, ErrInvalidImage)
+}
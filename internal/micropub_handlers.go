@@ -0,0 +1,319 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+// MicropubEntry is the subset of a Micropub h-entry that maps onto a twt
+type MicropubEntry struct {
+	Content   string
+	Photos    []string
+	InReplyTo string
+}
+
+// Text renders the entry as the text of a twt
+func (e MicropubEntry) Text() string {
+	var sb strings.Builder
+
+	sb.WriteString(e.Content)
+	for _, photo := range e.Photos {
+		if sb.Len() > 0 {
+			sb.WriteString(" ")
+		}
+		sb.WriteString(fmt.Sprintf("![](%s)", photo))
+	}
+
+	return CleanTwt(sb.String())
+}
+
+type micropubJSONRequest struct {
+	Type       []string                 `json:"type"`
+	Properties map[string][]interface{} `json:"properties"`
+}
+
+// micropubContent extracts the text of a content property which may either
+// be a plain string or an object of the form {"html": ..., "value": ...}
+func micropubContent(v interface{}) string {
+	switch c := v.(type) {
+	case string:
+		return c
+	case map[string]interface{}:
+		if value, ok := c["value"].(string); ok {
+			return value
+		}
+		if html, ok := c["html"].(string); ok {
+			return html
+		}
+	}
+	return ""
+}
+
+// ParseMicropubEntry parses a Micropub create request (either form-encoded,
+// multipart or JSON) into a MicropubEntry
+func ParseMicropubEntry(r *http.Request) (*MicropubEntry, error) {
+	entry := &MicropubEntry{}
+
+	ctype, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	if ctype == "application/json" {
+		var req micropubJSONRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			return nil, err
+		}
+
+		if !HasString(req.Type, "h-entry") {
+			return nil, fmt.Errorf("error: unsupported type %v", req.Type)
+		}
+
+		for _, v := range req.Properties["content"] {
+			if content := micropubContent(v); content != "" {
+				entry.Content = content
+				break
+			}
+		}
+		for _, v := range req.Properties["photo"] {
+			switch photo := v.(type) {
+			case string:
+				entry.Photos = append(entry.Photos, photo)
+			case map[string]interface{}:
+				if value, ok := photo["value"].(string); ok {
+					entry.Photos = append(entry.Photos, value)
+				}
+			}
+		}
+		for _, v := range req.Properties["in-reply-to"] {
+			if inReplyTo, ok := v.(string); ok {
+				entry.InReplyTo = inReplyTo
+				break
+			}
+		}
+
+		return entry, nil
+	}
+
+	if h := r.FormValue("h"); h != "" && h != "entry" {
+		return nil, fmt.Errorf("error: unsupported type h-%s", h)
+	}
+
+	entry.Content = r.FormValue("content")
+	entry.InReplyTo = r.FormValue("in-reply-to")
+	if r.Form != nil {
+		entry.Photos = append(entry.Photos, r.Form["photo"]...)
+		entry.Photos = append(entry.Photos, r.Form["photo[]"]...)
+	}
+
+	return entry, nil
+}
+
+func micropubError(w http.ResponseWriter, status int, code, description string) {
+	data, _ := json.Marshal(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, _ = w.Write(data)
+}
+
+// micropubAuth authenticates a Micropub request and loads the token's user
+func (s *Server) micropubAuth(w http.ResponseWriter, r *http.Request, scope string) *User {
+	claims, err := s.parseIndieAuthAccessToken(r)
+	if err != nil {
+		log.WithError(err).Warn("error parsing micropub access token")
+		micropubError(w, http.StatusUnauthorized, "unauthorized", "missing or invalid access token")
+		return nil
+	}
+
+	if scope != "" && !claims.HasScope(scope) {
+		micropubError(w, http.StatusForbidden, "insufficient_scope", fmt.Sprintf("token is missing the %s scope", scope))
+		return nil
+	}
+
+	user, err := s.db.GetUser(claims.Username)
+	if err != nil {
+		log.WithError(err).Errorf("error loading user object for %s", claims.Username)
+		micropubError(w, http.StatusUnauthorized, "unauthorized", "unknown user")
+		return nil
+	}
+
+	if !user.IsActive() {
+		micropubError(w, http.StatusForbidden, "forbidden", "account inactive")
+		return nil
+	}
+
+	return user
+}
+
+// MicropubHandler implements a Micropub endpoint that allows IndieWeb
+// clients to publish twts on behalf of a user.
+func (s *Server) MicropubHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if r.Method == http.MethodGet {
+			if s.micropubAuth(w, r, "") == nil {
+				return
+			}
+
+			var res map[string]interface{}
+
+			switch r.URL.Query().Get("q") {
+			case "config":
+				res = map[string]interface{}{
+					"syndicate-to": []string{},
+				}
+				if !s.config().DisableMedia {
+					res["media-endpoint"] = fmt.Sprintf("%s/micropub/media", strings.TrimSuffix(s.config().BaseURL, "/"))
+				}
+			case "syndicate-to":
+				res = map[string]interface{}{
+					"syndicate-to": []string{},
+				}
+			default:
+				micropubError(w, http.StatusBadRequest, "invalid_request", "unsupported query")
+				return
+			}
+
+			data, err := json.Marshal(res)
+			if err != nil {
+				log.WithError(err).Error("error serializing micropub response")
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(data)
+			return
+		}
+
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
+		defer r.Body.Close()
+
+		user := s.micropubAuth(w, r, "create")
+		if user == nil {
+			return
+		}
+
+		if action := r.FormValue("action"); action != "" {
+			micropubError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unsupported action %s", action))
+			return
+		}
+
+		entry, err := ParseMicropubEntry(r)
+		if err != nil {
+			log.WithError(err).Warn("error parsing micropub request")
+			micropubError(w, http.StatusBadRequest, "invalid_request", err.Error())
+			return
+		}
+
+		// Photos uploaded directly to the Micropub endpoint
+		if r.MultipartForm != nil && !s.config().DisableMedia {
+			for _, fh := range r.MultipartForm.File["photo"] {
+				f, err := fh.Open()
+				if err != nil {
+					log.WithError(err).Error("error opening uploaded photo")
+					micropubError(w, http.StatusBadRequest, "invalid_request", "error reading photo")
+					return
+				}
+
+				opts := &ImageOptions{Resize: true, Width: s.config().MediaResolution, Height: 0}
+				mediaURI, err := StoreUploadedImage(s.config(), f, mediaDir, "", opts)
+				f.Close()
+				if err != nil {
+					log.WithError(err).Error("error storing uploaded photo")
+					micropubError(w, http.StatusBadRequest, "invalid_request", "error storing photo")
+					return
+				}
+				entry.Photos = append(entry.Photos, mediaURI)
+			}
+		}
+
+		text := entry.Text()
+		if text == "" {
+			micropubError(w, http.StatusBadRequest, "invalid_request", "no content")
+			return
+		}
+
+		if entry.InReplyTo != "" {
+			if hash := HashFromTwtURL(s.config(), entry.InReplyTo); hash != "" {
+				text = fmt.Sprintf("(#%s) %s", hash, text)
+			}
+		}
+
+		twt, err := s.AppendTwt(user, nil, text)
+		if err != nil {
+			log.WithError(err).Error("error posting twt via micropub")
+			micropubError(w, http.StatusInternalServerError, "server_error", "error posting twt")
+			return
+		}
+
+		// WebSub and WebMentions ... (local-only twts never leave the Pod)
+		feedURL := s.config().URLForUser(user.Username)
+		PublishTwts(s.config(), s.tasks, user, feedURL, "", twt)
+
+		// Update user's own timeline with their own new post.
+		s.cache.InjectFeed(feedURL, twt)
+
+		// Refresh user views.
+		s.cache.DeleteUserViews(user)
+		s.cache.GetByUser(user, true)
+
+		w.Header().Set("Location", URLForTwt(s.config().BaseURL, twt.Hash()))
+		w.WriteHeader(http.StatusCreated)
+	}
+}
+
+// MicropubMediaHandler implements the Micropub Media Endpoint
+func (s *Server) MicropubMediaHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		if s.config().DisableMedia {
+			http.Error(w, "Media support disabled", http.StatusNotFound)
+			return
+		}
+
+		// Limit request body to to abuse
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
+		defer r.Body.Close()
+
+		if s.micropubAuth(w, r, "media") == nil {
+			return
+		}
+
+		mfile, headers, err := r.FormFile("file")
+		if err != nil {
+			if err.Error() == "http: request body too large" {
+				micropubError(w, http.StatusRequestEntityTooLarge, "invalid_request", "media upload too large")
+				return
+			}
+			log.WithError(err).Error("error parsing form file")
+			micropubError(w, http.StatusBadRequest, "invalid_request", "missing file")
+			return
+		}
+		defer mfile.Close()
+
+		if !strings.HasPrefix(headers.Header.Get("Content-Type"), "image/") {
+			micropubError(w, http.StatusBadRequest, "invalid_request", "only images are supported")
+			return
+		}
+
+		opts := &ImageOptions{Resize: true, Width: s.config().MediaResolution, Height: 0}
+		mediaURI, err := StoreUploadedImage(s.config(), mfile, mediaDir, "", opts)
+		if err != nil {
+			log.WithError(err).Error("error storing the file")
+			micropubError(w, http.StatusBadRequest, "invalid_request", "error storing media")
+			return
+		}
+
+		w.Header().Set("Location", mediaURI)
+		w.WriteHeader(http.StatusCreated)
+	}
+}
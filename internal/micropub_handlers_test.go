@@ -0,0 +1,153 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yarn.social/types"
+)
+
+// newTestMicropubServer returns a server able to post twts for alice
+func newTestMicropubServer(t *testing.T) *Server {
+	oldWebSubPing, oldWebMentions := webSubPing, webMentions
+	t.Cleanup(func() { webSubPing, webMentions = oldWebSubPing, oldWebMentions })
+	webSubPing = func(topic string, content []byte) {}
+	webMentions = func(conf *Config, tasks *Dispatcher, twt types.Twt) {}
+
+	s := newTestHandlerServer(t)
+	s.AppendTwt = AppendTwtFactory(s.config(), s.cache, s.db)
+
+	user := NewUser()
+	user.Username = "alice"
+	user.URL = s.config().URLForUser(user.Username)
+	require.NoError(t, s.db.SetUser(user.Username, user))
+
+	return s
+}
+
+func testPNG(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x * 16), G: uint8(y * 16), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestMicropubCreate(t *testing.T) {
+	s := newTestMicropubServer(t)
+
+	feed := func() string {
+		data, err := ioutil.ReadFile(filepath.Join(s.config().Data, feedsDir, "alice"))
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	testCases := []struct {
+		name        string
+		scope       string
+		contentType string
+		body        string
+		status      int
+		text        string
+	}{
+		{
+			name:        "missing create scope",
+			scope:       "media",
+			contentType: "application/x-www-form-urlencoded",
+			body:        url.Values{"h": {"entry"}, "content": {"Not allowed"}}.Encode(),
+			status:      http.StatusForbidden,
+		}, {
+			name:        "form-encoded entry",
+			scope:       "create",
+			contentType: "application/x-www-form-urlencoded",
+			body:        url.Values{"h": {"entry"}, "content": {"Hello from a form"}}.Encode(),
+			status:      http.StatusCreated,
+			text:        "Hello from a form",
+		}, {
+			name:        "json entry",
+			scope:       "create media",
+			contentType: "application/json",
+			body:        `{"type": ["h-entry"], "properties": {"content": [{"value": "Hello from JSON"}]}}`,
+			status:      http.StatusCreated,
+			text:        "Hello from JSON",
+		}, {
+			name:        "unsupported type",
+			scope:       "create",
+			contentType: "application/json",
+			body:        `{"type": ["h-event"], "properties": {"name": ["Party"]}}`,
+			status:      http.StatusBadRequest,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/micropub", strings.NewReader(testCase.body))
+			r.Header.Set("Content-Type", testCase.contentType)
+			r.Header.Set("Authorization", "Bearer "+testIndieAuthToken(t, s.config(), "alice", testCase.scope))
+			w := httptest.NewRecorder()
+
+			s.MicropubHandler()(w, r, nil)
+			require.Equal(t, testCase.status, w.Code)
+
+			if testCase.status == http.StatusCreated {
+				assert.True(t, strings.HasPrefix(w.Header().Get("Location"), s.config().BaseURL))
+				assert.Contains(t, feed(), testCase.text)
+			}
+		})
+	}
+
+	assert.NotContains(t, feed(), "Not allowed")
+}
+
+func TestMicropubMedia(t *testing.T) {
+	s := newTestMicropubServer(t)
+
+	upload := func(scope string) *httptest.ResponseRecorder {
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", `form-data; name="file"; filename="photo.png"`)
+		h.Set("Content-Type", "image/png")
+		part, err := mw.CreatePart(h)
+		require.NoError(t, err)
+		_, err = part.Write(testPNG(t))
+		require.NoError(t, err)
+		require.NoError(t, mw.Close())
+
+		r := httptest.NewRequest(http.MethodPost, "/micropub/media", &body)
+		r.Header.Set("Content-Type", mw.FormDataContentType())
+		r.Header.Set("Authorization", "Bearer "+testIndieAuthToken(t, s.config(), "alice", scope))
+		w := httptest.NewRecorder()
+
+		s.MicropubMediaHandler()(w, r, nil)
+		return w
+	}
+
+	assert.Equal(t, http.StatusForbidden, upload("create").Code)
+
+	w := upload("create media")
+	require.Equal(t, http.StatusCreated, w.Code)
+	assert.NotEmpty(t, w.Header().Get("Location"))
+}
@@ -0,0 +1,182 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+	"go.yarn.social/types"
+)
+
+// MicrosubChannel ...
+type MicrosubChannel struct {
+	UID  string `json:"uid"`
+	Name string `json:"name"`
+}
+
+// MicrosubChannels are the channels exposed to Microsub readers, each one
+// maps onto one of the user's views.
+var MicrosubChannels = []MicrosubChannel{
+	{UID: "timeline", Name: "Timeline"},
+	{UID: "mentions", Name: "Mentions"},
+	{UID: "discover", Name: "Discover"},
+}
+
+// MicrosubAuthor is a jf2 h-card
+type MicrosubAuthor struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	URL   string `json:"url"`
+	Photo string `json:"photo,omitempty"`
+}
+
+// MicrosubContent ...
+type MicrosubContent struct {
+	Text string `json:"text"`
+	HTML string `json:"html"`
+}
+
+// MicrosubItem is a jf2 h-entry
+type MicrosubItem struct {
+	Type      string          `json:"type"`
+	ID        string          `json:"_id"`
+	URL       string          `json:"url"`
+	Published string          `json:"published"`
+	Content   MicrosubContent `json:"content"`
+	Author    MicrosubAuthor  `json:"author"`
+}
+
+// MicrosubPaging ...
+type MicrosubPaging struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+}
+
+// NewMicrosubItem converts a twt into a jf2 h-entry
+func NewMicrosubItem(conf *Config, twt types.Twt) MicrosubItem {
+	twter := twt.Twter()
+	return MicrosubItem{
+		Type:      "entry",
+		ID:        twt.Hash(),
+		URL:       URLForTwt(conf.BaseURL, twt.Hash()),
+		Published: twt.Created().Format(time.RFC3339),
+		Content: MicrosubContent{
+			Text: twt.FormatText(types.TextFmt, conf),
+			HTML: twt.FormatText(types.HTMLFmt, conf),
+		},
+		Author: MicrosubAuthor{
+			Type:  "card",
+			Name:  twter.DomainNick(),
+			URL:   twter.URI,
+			Photo: twter.Avatar,
+		},
+	}
+}
+
+func (s *Server) microsubTwts(user *User, channel string) (types.Twts, bool) {
+	switch channel {
+	case "timeline":
+		return s.cache.GetByUser(user, false), true
+	case "mentions":
+		twts := s.cache.GetMentions(user, false)
+		sort.Sort(twts)
+		return twts, true
+	case "discover":
+		return s.cache.GetByUserView(user, discoverViewKey, false), true
+	default:
+		return nil, false
+	}
+}
+
+// MicrosubHandler implements a read-only Microsub endpoint exposing the
+// user's timeline, mentions and discover views as channels.
+func (s *Server) MicrosubHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := s.micropubAuth(w, r, "read")
+		if user == nil {
+			return
+		}
+
+		var res interface{}
+
+		switch action := r.FormValue("action"); action {
+		case "channels":
+			if r.Method != http.MethodGet {
+				micropubError(w, http.StatusBadRequest, "invalid_request", "channels are read-only")
+				return
+			}
+			res = map[string]interface{}{"channels": MicrosubChannels}
+		case "timeline":
+			if r.Method != http.MethodGet {
+				micropubError(w, http.StatusBadRequest, "invalid_request", "timelines are read-only")
+				return
+			}
+
+			twts, ok := s.microsubTwts(user, r.FormValue("channel"))
+			if !ok {
+				micropubError(w, http.StatusNotFound, "not_found", "unknown channel")
+				return
+			}
+
+			page := 1
+			if after := r.FormValue("after"); after != "" {
+				if n, err := strconv.Atoi(after); err == nil && n > 0 {
+					page = n
+				}
+			} else if before := r.FormValue("before"); before != "" {
+				if n, err := strconv.Atoi(before); err == nil && n > 0 {
+					page = n
+				}
+			}
+
+			var pagedTwts types.Twts
+
+			pager := paginator.New(adapter.NewSliceAdapter(twts), s.config().TwtsPerPage)
+			pager.SetPage(page)
+
+			if err := pager.Results(&pagedTwts); err != nil {
+				log.WithError(err).Error("error loading microsub timeline")
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			items := make([]MicrosubItem, 0, len(pagedTwts))
+			for _, twt := range pagedTwts {
+				items = append(items, NewMicrosubItem(s.config(), twt))
+			}
+
+			var paging MicrosubPaging
+			if pager.HasNext() {
+				paging.After = fmt.Sprintf("%d", pager.Page()+1)
+			}
+			if pager.HasPrev() {
+				paging.Before = fmt.Sprintf("%d", pager.Page()-1)
+			}
+
+			res = map[string]interface{}{"items": items, "paging": paging}
+		default:
+			micropubError(w, http.StatusBadRequest, "invalid_request", fmt.Sprintf("unsupported action %q", action))
+			return
+		}
+
+		data, err := json.Marshal(res)
+		if err != nil {
+			log.WithError(err).Error("error serializing microsub response")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
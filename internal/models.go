@@ -28,6 +28,7 @@ var (
 	ErrFeedAlreadyExists = errors.New("error: feed already exists by that name")
 	ErrAlreadyFollows    = errors.New("error: you already follow this feed")
 	ErrTooManyFeeds      = errors.New("error: you have too many feeds")
+	ErrFeedNotAllowed    = errors.New("error: this pod does not allow following this feed")
 )
 
 // Feed ...
@@ -39,6 +40,12 @@ type Feed struct {
 
 	AvatarHash string `defaulf:""`
 
+	// BotTokenHash is the hash of the feed's bot token (if any)
+	BotTokenHash string `default:""`
+
+	// Automated flags the feed as a bot (See: AutomatedFeeds)
+	Automated bool `default:"false"`
+
 	Followers map[string]string `default:"{}"`
 
 	remotes map[string]string
@@ -53,16 +60,26 @@ type User struct {
 	CreatedAt  time.Time
 	LastSeenAt time.Time
 
+	// PreviousSeenAt is the day the user was seen before LastSeenAt, the
+	// start of the user's summary (See: Seen)
+	PreviousSeenAt time.Time
+
 	Theme      string `default:"auto"`
 	Lang       string `default:""`
 	Recovery   string `default:""`
 	AvatarHash string `default:""`
 
+	// AvatarStyle and AvatarSeed determine the generated avatar of users
+	// without an uploaded avatar
+	AvatarStyle string `default:"identicon"`
+	AvatarSeed  string `default:""`
+
 	DisplayDatesInTimezone    string `default:"UTC"`
 	DisplayTimePreference     string `default:"24h"`
 	OpenLinksInPreference     string `default:"newwindow"`
 	DisplayTimelinePreference string `default:"list"`
 	DisplayImagesPreference   string `default:"inline"`
+	TextDirection             string `default:"auto"`
 	DisplayMedia              bool   `default:"true"`
 	OriginalMedia             bool   `default:"false"`
 
@@ -71,21 +88,112 @@ type User struct {
 	LinkVerification   bool `default:"false"`
 	StripTrackingParam bool `default:"false"`
 
+	// LiteMode renders the timeline and profiles with the lite UI
+	LiteMode bool `default:"false"`
+
+	// DiscoverRanking is the user's ranking of the Discover timeline (See:
+	// DiscoverRankingFor), empty for the pod's ranking
+	DiscoverRanking string `default:""`
+
+	// DiscoverLanguages are the languages of the twts shown in the user's
+	// Discover timeline (See: FilterTwtsByLanguage), empty for all languages
+	DiscoverLanguages []string `default:"[]"`
+
+	// TimelineFilters filter the user's timeline and the Discover and Local
+	// timelines
+	TimelineFilters TimelineFilters
+
 	CustomPrimaryColor   string `default:""`
 	CustomSecondaryColor string `default:""`
 
+	Stylesheet string `default:""`
+	CustomCSS  string `default:""`
+
+	// Structured profile fields (See: User.SetProfileFields)
+	Website       string         `default:""`
+	Location      string         `default:""`
+	Pronouns      string         `default:""`
+	ProfileFields []ProfileField `default:"[]"`
+
+	// VerifiedLinks are the websites listed on the user's profile that link
+	// back to it with a rel=me link and when they were verified
+	VerifiedLinks map[string]string `default:"{}"`
+
 	IsFollowersPubliclyVisible bool `default:"true"`
 	IsFollowingPubliclyVisible bool `default:"true"`
 	IsBookmarksPubliclyVisible bool `default:"true"`
 
-	Feeds []string `default:"[]"`
+	// Protected accounts approve new followers and only serve their feed to
+	// approved followers signed in on this Pod
+	Protected bool `default:"false"`
 
-	Bookmarks map[string]string `default:"{}"`
-	Followers map[string]string `default:"{}"`
-	Following map[string]string `default:"{}"`
-	Links     map[string]string `default:"{}"`
-	Muted     map[string]string `default:"{}"`
+	// NoIndex discourages search engines from indexing the user's profile
+	// and twts (See: IsIndexable)
+	NoIndex bool `default:"false"`
+
+	// Unlisted keeps the user's twts out of the Pod's Discover and Local
+	// timelines and the Pod's Atom feed, the user's feed is still served to
+	// followers as usual
+	Unlisted bool `default:"false"`
+
+	// LocalOnly makes twts local-only by default (See: VisibilityLocal)
+	LocalOnly bool `default:"false"`
+
+	// Automated flags the user's account as a bot (See: AutomatedFeeds)
+	Automated bool `default:"false"`
+
+	// DismissedAnnouncements are the announcements the user dismissed and
+	// when
+	DismissedAnnouncements map[string]string `default:"{}"`
+
+	// OnboardingComplete is false until a newly registered user completed
+	// (or skipped) the onboarding wizard, users registered before the
+	// wizard existed never see it
+	OnboardingComplete bool `default:"true"`
+
+	// State is the state of the account (See: AccountState) and the reason
+	// and time it was last changed by the Pod Owner/Operator
+	State          AccountState `default:"active"`
+	StateReason    string       `default:""`
+	StateChangedAt time.Time
 
+	// SigningKey is the (base64 encoded) ed25519 seed used to sign the
+	// user's feed
+	SigningKey string `default:""`
+
+	PostByEmailToken string `default:""`
+
+	// FeedToken is the secret token of the user's private read-only feeds
+	FeedToken string `default:""`
+
+	XMPPJID             string `default:""`
+	XMPPNotifyMentions  bool   `default:"true"`
+	XMPPNotifyFollowers bool   `default:"true"`
+	XMPPAcceptReplies   bool   `default:"false"`
+
+	// XMPPVerified is set once the user confirmed the XMPPVerifyCode sent
+	// to their JID, no notifications are sent to or replies accepted from
+	// unverified JIDs
+	XMPPVerified   bool   `default:"false"`
+	XMPPVerifyCode string `default:""`
+
+	Feeds []string `default:"[]"`
+
+	Blocked        map[string]string `default:"{}"`
+	Bookmarks      map[string]string `default:"{}"`
+	Followers      map[string]string `default:"{}"`
+	FollowRequests map[string]string `default:"{}"`
+	Following      map[string]string `default:"{}"`
+	Links          map[string]string `default:"{}"`
+	Muted          map[string]string `default:"{}"`
+	ReadPositions  map[string]string `default:"{}"`
+	Watching       map[string]string `default:"{}"`
+
+	// BookmarkDetails are the folders, tags and notes of the user's
+	// bookmarks by twt hash (See: User.SetBookmarkDetails)
+	BookmarkDetails map[string]BookmarkDetails `default:"{}"`
+
+	blocked map[string]string
 	muted   map[string]string
 	remotes map[string]string
 	sources map[string]string
@@ -197,6 +305,7 @@ func NewUser() *User {
 	if err := defaults.Set(user); err != nil {
 		log.WithError(err).Error("error creating new user object")
 	}
+	user.blocked = make(map[string]string)
 	user.muted = make(map[string]string)
 	user.remotes = make(map[string]string)
 	user.sources = make(map[string]string)
@@ -216,12 +325,33 @@ func LoadUser(data []byte) (user *User, err error) {
 	if user.Bookmarks == nil {
 		user.Bookmarks = make(map[string]string)
 	}
+	if user.BookmarkDetails == nil {
+		user.BookmarkDetails = make(map[string]BookmarkDetails)
+	}
+	if user.VerifiedLinks == nil {
+		user.VerifiedLinks = make(map[string]string)
+	}
 	if user.Followers == nil {
 		user.Followers = make(map[string]string)
 	}
+	if user.FollowRequests == nil {
+		user.FollowRequests = make(map[string]string)
+	}
 	if user.Following == nil {
 		user.Following = make(map[string]string)
 	}
+	if user.Watching == nil {
+		user.Watching = make(map[string]string)
+	}
+
+	if user.Blocked == nil {
+		user.Blocked = make(map[string]string)
+	}
+
+	user.blocked = make(map[string]string)
+	for n, u := range user.Blocked {
+		user.blocked[u] = n
+	}
 
 	user.muted = make(map[string]string)
 	for n, u := range user.Muted {
@@ -335,6 +465,16 @@ func (u *User) OwnsFeed(name string) bool {
 	return false
 }
 
+// Seen records the user was seen today, LastSeenAt only has a resolution of
+// a day so the previous day the user was seen is kept as PreviousSeenAt
+func (u *User) Seen() {
+	seenAt := time.Now().Round(24 * time.Hour)
+	if !seenAt.Equal(u.LastSeenAt) {
+		u.PreviousSeenAt = u.LastSeenAt
+	}
+	u.LastSeenAt = seenAt
+}
+
 func (u *User) Is(url string) bool {
 	return u.URL == NormalizeURL(url)
 }
@@ -344,6 +484,7 @@ func (u *User) Bookmark(hash string) {
 		u.Bookmarks[hash] = ""
 	} else {
 		delete(u.Bookmarks, hash)
+		delete(u.BookmarkDetails, hash)
 	}
 }
 
@@ -352,6 +493,24 @@ func (u *User) Bookmarked(hash string) bool {
 	return ok
 }
 
+// Watch watches the conversation with the given subject hash so that new
+// replies to it appear in the user's mentions
+func (u *User) Watch(hash string) {
+	u.Watching[hash] = ""
+}
+
+// Unwatch stops watching the conversation with the given subject hash
+func (u *User) Unwatch(hash string) {
+	delete(u.Watching, hash)
+}
+
+// IsWatching returns true if the user watches the conversation with the
+// given subject hash
+func (u *User) IsWatching(hash string) bool {
+	_, ok := u.Watching[hash]
+	return ok
+}
+
 func (u *User) AddFollower(nick, uri string) {
 	uri = NormalizeURL(uri)
 	if _, ok := u.Followers[nick]; ok {
@@ -370,6 +529,27 @@ func (u *User) FollowedBy(url string) bool {
 	return ok
 }
 
+func (u *User) RemoveFollower(nick string) {
+	if uri, ok := u.Followers[nick]; ok {
+		delete(u.remotes, uri)
+		delete(u.Followers, nick)
+	}
+}
+
+func (u *User) AddFollowRequest(nick, uri string) {
+	uri = NormalizeURL(uri)
+	for _, v := range u.FollowRequests {
+		if v == uri {
+			return
+		}
+	}
+	u.FollowRequests[UniqueKeyFor(u.FollowRequests, nick)] = uri
+}
+
+func (u *User) RemoveFollowRequest(nick string) {
+	delete(u.FollowRequests, nick)
+}
+
 func (u *User) AddLink(title, url string) {
 	key := strings.TrimSpace(title)
 	if _, ok := u.Links[key]; !ok {
@@ -380,6 +560,7 @@ func (u *User) AddLink(title, url string) {
 func (u *User) RemoveLink(title string) {
 	key := strings.TrimSpace(title)
 	delete(u.Links, key)
+	u.pruneVerifiedLinks()
 }
 
 func (u *User) Mute(key, value string) {
@@ -397,6 +578,40 @@ func (u *User) Unmute(key string) {
 	}
 }
 
+// Block blocks a feed, unlike muting the feed's twts are hidden everywhere,
+// its webmentions are ignored and (for local users) it cannot see the user's
+// profile. Blocking a feed also unfollows it.
+func (u *User) Block(key, value string) {
+	value = NormalizeURL(value)
+	if !u.HasBlocked(value) {
+		u.Blocked[key] = value
+		u.blocked[value] = key
+	}
+	if alias, ok := u.sources[value]; ok {
+		u.Unfollow(alias)
+	}
+}
+
+// Unblock unblocks a previously blocked feed
+func (u *User) Unblock(key string) {
+	value, ok := u.Blocked[key]
+	if ok {
+		delete(u.Blocked, key)
+		delete(u.blocked, value)
+	}
+}
+
+// HasBlocked returns true if the user has blocked the feed
+func (u *User) HasBlocked(uri string) bool {
+	_, ok := u.blocked[NormalizeURL(uri)]
+	return ok
+}
+
+// BlockedAs returns the nick a blocked feed was blocked as
+func (u *User) BlockedAs(uri string) string {
+	return u.blocked[NormalizeURL(uri)]
+}
+
 func (u *User) Follow(alias, uri string) error {
 	if !u.Follows(uri) {
 		if _, ok := u.Following[alias]; ok {
@@ -414,12 +629,21 @@ func (u *User) Follow(alias, uri string) error {
 }
 
 func (u *User) FollowAndValidate(conf *Config, alias, uri string) error {
+	if !conf.AllowedFeed(uri) {
+		return ErrFeedNotAllowed
+	}
+
 	tf, err := ValidateFeed(conf, alias, uri)
 	if err != nil {
 		return err
 	}
 	twter := tf.Twter()
 
+	// The feed may advertise a different url than it was followed by
+	if !conf.AllowedFeed(twter.URI) {
+		return ErrFeedNotAllowed
+	}
+
 	if u.Follows(twter.URI) {
 		return ErrAlreadyFollows
 	}
@@ -577,12 +801,15 @@ func (u *User) Twter(conf *Config) types.Twter {
 
 func (u *User) Filter(twts []types.Twt) (filtered []types.Twt) {
 	// fast-path
-	if len(u.muted) == 0 {
+	if len(u.muted) == 0 && len(u.blocked) == 0 {
 		return twts
 	}
 
 	filtered = make([]types.Twt, 0)
 	for _, twt := range twts {
+		if u.HasBlocked(twt.Twter().URI) {
+			continue
+		}
 		if u.HasMuted(twt.Hash()) || u.HasMuted(twt.Twter().URI) {
 			continue
 		}
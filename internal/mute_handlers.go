@@ -30,7 +30,7 @@ func (s *Server) MuteHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
 			return
 		}
 
@@ -85,7 +85,8 @@ func (s *Server) UnmuteHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
 		}
 
 		if nick != "" {
@@ -112,3 +113,88 @@ func (s *Server) UnmuteHandler() httprouter.Handle {
 		s.render("error", w, ctx)
 	}
 }
+
+// BlockHandler blocks a feed (See: User.Block)
+func (s *Server) BlockHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Translate(s.translator)
+
+		nick := strings.TrimSpace(r.FormValue("nick"))
+		url := NormalizeURL(r.FormValue("url"))
+
+		if nick == "" || url == "" {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorNoBlockNickOrURL")
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if user.Is(url) {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorBlockSelf")
+			s.render("error", w, ctx)
+			return
+		}
+
+		user.Block(nick, url)
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error blocking feed %s: %s", nick, url)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorBlockingFeed", map[string]interface{}{"Nick": nick, "URL": url})
+			s.render("error", w, ctx)
+			return
+		}
+
+		s.cache.DeleteUserViews(ctx.User)
+
+		ctx.Error = false
+		ctx.Message = s.tr(ctx, "MsgBlockFeedSuccess", map[string]interface{}{"Nick": nick, "URL": url})
+		s.render("error", w, ctx)
+	}
+}
+
+// UnblockHandler unblocks a previously blocked feed
+func (s *Server) UnblockHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Translate(s.translator)
+
+		nick := strings.TrimSpace(r.FormValue("nick"))
+		if nick == "" {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorNoBlockNickOrURL")
+			s.render("error", w, ctx)
+			return
+		}
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		user.Unblock(nick)
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error unblocking feed %s", nick)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUnblockingFeed", map[string]interface{}{"Nick": nick})
+			s.render("error", w, ctx)
+			return
+		}
+
+		s.cache.DeleteUserViews(ctx.User)
+
+		ctx.Error = false
+		ctx.Message = s.tr(ctx, "MsgUnblockFeedSuccess", map[string]interface{}{"Nick": nick})
+		s.render("error", w, ctx)
+	}
+}
@@ -0,0 +1,613 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/textproto"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+const (
+	nntpLocalGroup       = "yarn.local"
+	nntpFeedsGroupPrefix = "yarn.feeds"
+	nntpIdleTimeout      = 10 * time.Minute
+	nntpMaxSubjectLength = 72
+)
+
+var nntpInvalidGroupChars = regexp.MustCompile(`[^a-z0-9_+-]+`)
+
+// nntpArticle is a twt numbered within a newsgroup. Articles are numbered
+// by the twt's creation time so numbering remains stable as feeds rotate
+// through the cache.
+type nntpArticle struct {
+	Number int64
+	Twt    types.Twt
+}
+
+// NNTPServer is a read-only NNTP gateway exposing local and followed feeds
+// held in the feed cache as newsgroups.
+type NNTPServer struct {
+	sync.Mutex
+
+	conf  *Config
+	cache *Cache
+
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closed   bool
+}
+
+// NewNNTPServer ...
+func NewNNTPServer(conf *Config, cache *Cache) *NNTPServer {
+	return &NNTPServer{
+		conf:  conf,
+		cache: cache,
+		conns: make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the given address and serves NNTP readers
+// until Close is called.
+func (n *NNTPServer) ListenAndServe(bind string) error {
+	ln, err := net.Listen("tcp", bind)
+	if err != nil {
+		return err
+	}
+
+	n.Lock()
+	n.listener = ln
+	n.Unlock()
+
+	log.Infof("NNTP gateway listening on %s", bind)
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			n.Lock()
+			closed := n.closed
+			n.Unlock()
+			if closed {
+				return nil
+			}
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				log.WithError(err).Warn("temporary error accepting nntp connection")
+				time.Sleep(time.Second)
+				continue
+			}
+			return err
+		}
+
+		n.Lock()
+		n.conns[conn] = struct{}{}
+		n.Unlock()
+
+		go n.serve(conn)
+	}
+}
+
+// Close stops the listener and closes all open reader connections
+func (n *NNTPServer) Close() error {
+	n.Lock()
+	defer n.Unlock()
+
+	n.closed = true
+
+	for conn := range n.conns {
+		conn.Close()
+	}
+
+	if n.listener != nil {
+		return n.listener.Close()
+	}
+	return nil
+}
+
+func (n *NNTPServer) hostname() string {
+	return n.conf.baseURL.Hostname()
+}
+
+func (n *NNTPServer) messageID(hash string) string {
+	return fmt.Sprintf("<%s@%s>", hash, n.hostname())
+}
+
+func (n *NNTPServer) hashFromMessageID(msgID string) string {
+	msgID = strings.TrimSuffix(strings.TrimPrefix(msgID, "<"), ">")
+	hash, host := msgID, ""
+	if i := strings.LastIndex(msgID, "@"); i > 0 {
+		hash, host = msgID[:i], msgID[i+1:]
+	}
+	if host != n.hostname() {
+		return ""
+	}
+	return hash
+}
+
+// groupName returns the newsgroup name for a cached feed url
+func (n *NNTPServer) groupName(uri string) string {
+	twter := n.cache.GetTwter(uri)
+
+	nick := ""
+	if twter != nil {
+		nick = twter.Nick
+	}
+
+	if n.conf.IsLocalURL(uri) {
+		if nick == "" {
+			nick = path.Base(strings.TrimSuffix(uri, "/twtxt.txt"))
+		}
+		return fmt.Sprintf("%s.%s", nntpLocalGroup, nntpInvalidGroupChars.ReplaceAllString(strings.ToLower(nick), "_"))
+	}
+
+	host := HostnameFromURL(uri)
+	if nick == "" {
+		nick = "feed"
+	}
+	return fmt.Sprintf(
+		"%s.%s.%s",
+		nntpFeedsGroupPrefix,
+		strings.Join(strings.FieldsFunc(strings.ToLower(host), func(r rune) bool { return r == '.' || r == ':' }), "."),
+		nntpInvalidGroupChars.ReplaceAllString(strings.ToLower(nick), "_"),
+	)
+}
+
+// groups returns a mapping of newsgroup names to the feed url backing them.
+// The special yarn.local group is backed by the pod's local view.
+func (n *NNTPServer) groups() map[string]string {
+	groups := map[string]string{nntpLocalGroup: ""}
+	for _, uri := range n.cache.GetFeedURLs() {
+		name := n.groupName(uri)
+		if _, exists := groups[name]; exists {
+			continue
+		}
+		groups[name] = uri
+	}
+	return groups
+}
+
+// articles returns the articles of a group numbered in ascending order
+func (n *NNTPServer) articles(group string) ([]nntpArticle, bool) {
+	uri, ok := n.groups()[group]
+	if !ok {
+		return nil, false
+	}
+
+	var twts types.Twts
+	if uri == "" {
+		twts = n.cache.GetByView(localViewKey)
+	} else {
+		twts = n.cache.GetByURL(uri)
+	}
+
+	twts = visibility.Federated(visibility.Filter(n.conf, nil, twts))
+	twts = append(types.Twts{}, twts...)
+	sort.SliceStable(twts, func(i, j int) bool {
+		return twts[i].Created().Before(twts[j].Created())
+	})
+
+	articles := make([]nntpArticle, 0, len(twts))
+
+	var last int64
+	for _, twt := range twts {
+		num := twt.Created().Unix()
+		if num <= last {
+			num = last + 1
+		}
+		last = num
+		articles = append(articles, nntpArticle{Number: num, Twt: twt})
+	}
+
+	return articles, true
+}
+
+func (n *NNTPServer) subject(twt types.Twt) string {
+	text := twt.FormatText(types.TextFmt, n.conf)
+
+	prefix := ""
+	if hash := ExtractHashFromSubject(twt.Subject().String()); hash != "" && hash != twt.Hash() {
+		prefix = "Re: "
+		if root, ok := n.cache.Lookup(hash); ok {
+			text = root.FormatText(types.TextFmt, n.conf)
+		}
+	}
+
+	text = strings.TrimSpace(strings.SplitN(strings.TrimSpace(text), "\n", 2)[0])
+	if len(text) > nntpMaxSubjectLength {
+		text = strings.TrimSpace(text[:nntpMaxSubjectLength]) + "..."
+	}
+	if text == "" {
+		text = "(no subject)"
+	}
+
+	return prefix + text
+}
+
+func (n *NNTPServer) from(twt types.Twt) string {
+	twter := twt.Twter()
+	return fmt.Sprintf("%s <%s@%s>", twter.Nick, twter.Nick, HostnameFromURL(twter.URI))
+}
+
+func (n *NNTPServer) references(twt types.Twt) string {
+	if hash := ExtractHashFromSubject(twt.Subject().String()); hash != "" && hash != twt.Hash() {
+		return n.messageID(hash)
+	}
+	return ""
+}
+
+func (n *NNTPServer) body(twt types.Twt) []string {
+	return strings.Split(twt.FormatText(types.TextFmt, n.conf), "\n")
+}
+
+func (n *NNTPServer) headers(group string, twt types.Twt) []string {
+	headers := []string{
+		fmt.Sprintf("Path: %s!not-for-mail", n.hostname()),
+		fmt.Sprintf("From: %s", n.from(twt)),
+		fmt.Sprintf("Newsgroups: %s", group),
+		fmt.Sprintf("Subject: %s", n.subject(twt)),
+		fmt.Sprintf("Date: %s", twt.Created().Format(time.RFC1123Z)),
+		fmt.Sprintf("Message-ID: %s", n.messageID(twt.Hash())),
+	}
+	if refs := n.references(twt); refs != "" {
+		headers = append(headers, fmt.Sprintf("References: %s", refs))
+	}
+	headers = append(headers,
+		fmt.Sprintf("X-Twt-URL: %s", URLForTwt(n.conf.BaseURL, twt.Hash())),
+		"Content-Type: text/plain; charset=utf-8",
+	)
+	return headers
+}
+
+// nntpSession holds the state of a single reader connection
+type nntpSession struct {
+	srv  *NNTPServer
+	conn net.Conn
+	tp   *textproto.Conn
+
+	group    string
+	articles []nntpArticle
+	current  int
+}
+
+func (n *NNTPServer) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		n.Lock()
+		delete(n.conns, conn)
+		n.Unlock()
+	}()
+
+	s := &nntpSession{
+		srv:     n,
+		conn:    conn,
+		tp:      textproto.NewConn(conn),
+		current: -1,
+	}
+
+	if err := s.tp.PrintfLine("201 %s yarnd NNTP gateway ready (posting prohibited)", n.hostname()); err != nil {
+		return
+	}
+
+	for {
+		_ = conn.SetReadDeadline(time.Now().Add(nntpIdleTimeout))
+
+		line, err := s.tp.ReadLine()
+		if err != nil {
+			return
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			_ = s.tp.PrintfLine("500 Unknown command")
+			continue
+		}
+
+		cmd, args := strings.ToUpper(fields[0]), fields[1:]
+		if cmd == "QUIT" {
+			_ = s.tp.PrintfLine("205 Bye")
+			return
+		}
+
+		if err := s.handle(cmd, args); err != nil {
+			log.WithError(err).Debug("error writing nntp response")
+			return
+		}
+	}
+}
+
+func (s *nntpSession) handle(cmd string, args []string) error {
+	switch cmd {
+	case "CAPABILITIES":
+		return s.writeMultiline("101 Capability list:", []string{
+			"VERSION 2",
+			"READER",
+			"LIST ACTIVE NEWSGROUPS",
+			"OVER",
+			"IMPLEMENTATION yarnd",
+		})
+	case "MODE":
+		if len(args) == 1 && strings.EqualFold(args[0], "READER") {
+			return s.tp.PrintfLine("201 Posting prohibited")
+		}
+		return s.tp.PrintfLine("501 Unknown MODE variant")
+	case "DATE":
+		return s.tp.PrintfLine("111 %s", time.Now().UTC().Format("20060102150405"))
+	case "HELP":
+		return s.writeMultiline("100 Help text follows", []string{
+			"ARTICLE HEAD BODY STAT [number|<message-id>]",
+			"GROUP LISTGROUP NEXT LAST",
+			"LIST [ACTIVE|NEWSGROUPS]",
+			"OVER XOVER [range]",
+			"CAPABILITIES DATE MODE READER QUIT",
+		})
+	case "POST", "IHAVE":
+		return s.tp.PrintfLine("440 Posting not permitted")
+	case "LIST":
+		return s.list(args)
+	case "GROUP":
+		if len(args) != 1 {
+			return s.tp.PrintfLine("501 Syntax error")
+		}
+		if !s.selectGroup(args[0]) {
+			return s.tp.PrintfLine("411 No such newsgroup")
+		}
+		count, low, high := s.summary()
+		return s.tp.PrintfLine("211 %d %d %d %s", count, low, high, s.group)
+	case "LISTGROUP":
+		if len(args) > 0 {
+			if !s.selectGroup(args[0]) {
+				return s.tp.PrintfLine("411 No such newsgroup")
+			}
+		} else if s.group == "" {
+			return s.tp.PrintfLine("412 No newsgroup selected")
+		}
+		count, low, high := s.summary()
+		var lines []string
+		for _, article := range s.articles {
+			lines = append(lines, strconv.FormatInt(article.Number, 10))
+		}
+		return s.writeMultiline(fmt.Sprintf("211 %d %d %d %s list follows", count, low, high, s.group), lines)
+	case "NEXT", "LAST":
+		if s.group == "" {
+			return s.tp.PrintfLine("412 No newsgroup selected")
+		}
+		if s.current < 0 {
+			return s.tp.PrintfLine("420 Current article number is invalid")
+		}
+		next := s.current + 1
+		if cmd == "LAST" {
+			next = s.current - 1
+		}
+		if next < 0 || next >= len(s.articles) {
+			if cmd == "LAST" {
+				return s.tp.PrintfLine("422 No previous article to retrieve")
+			}
+			return s.tp.PrintfLine("421 No next article to retrieve")
+		}
+		s.current = next
+		article := s.articles[s.current]
+		return s.tp.PrintfLine("223 %d %s", article.Number, s.srv.messageID(article.Twt.Hash()))
+	case "ARTICLE", "HEAD", "BODY", "STAT":
+		return s.article(cmd, args)
+	case "OVER", "XOVER":
+		return s.over(args)
+	default:
+		return s.tp.PrintfLine("500 Unknown command")
+	}
+}
+
+func (s *nntpSession) writeMultiline(status string, lines []string) error {
+	if err := s.tp.PrintfLine("%s", status); err != nil {
+		return err
+	}
+	dw := s.tp.DotWriter()
+	bw := bufio.NewWriter(dw)
+	for _, line := range lines {
+		fmt.Fprintf(bw, "%s\n", line)
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return dw.Close()
+}
+
+func (s *nntpSession) selectGroup(name string) bool {
+	articles, ok := s.srv.articles(strings.ToLower(name))
+	if !ok {
+		return false
+	}
+
+	s.group = strings.ToLower(name)
+	s.articles = articles
+	s.current = -1
+	if len(articles) > 0 {
+		s.current = 0
+	}
+
+	return true
+}
+
+func (s *nntpSession) summary() (count int, low, high int64) {
+	if len(s.articles) == 0 {
+		return 0, 1, 0
+	}
+	return len(s.articles), s.articles[0].Number, s.articles[len(s.articles)-1].Number
+}
+
+func (s *nntpSession) list(args []string) error {
+	keyword := "ACTIVE"
+	if len(args) > 0 {
+		keyword = strings.ToUpper(args[0])
+	}
+
+	groups := s.srv.groups()
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var lines []string
+
+	switch keyword {
+	case "ACTIVE":
+		for _, name := range names {
+			articles, _ := s.srv.articles(name)
+			low, high := int64(1), int64(0)
+			if len(articles) > 0 {
+				low, high = articles[0].Number, articles[len(articles)-1].Number
+			}
+			lines = append(lines, fmt.Sprintf("%s %d %d n", name, high, low))
+		}
+		return s.writeMultiline("215 List of newsgroups follows", lines)
+	case "NEWSGROUPS":
+		for _, name := range names {
+			uri := groups[name]
+			if uri == "" {
+				uri = fmt.Sprintf("Local timeline of %s", s.srv.conf.Name)
+			}
+			lines = append(lines, fmt.Sprintf("%s\t%s", name, uri))
+		}
+		return s.writeMultiline("215 List of newsgroup descriptions follows", lines)
+	default:
+		return s.tp.PrintfLine("501 Unsupported LIST keyword")
+	}
+}
+
+// lookup resolves an article argument (number or message-id) or the current
+// article if no argument is given
+func (s *nntpSession) lookup(args []string) (int64, types.Twt, string) {
+	if len(args) > 0 && strings.HasPrefix(args[0], "<") {
+		hash := s.srv.hashFromMessageID(args[0])
+		if hash == "" {
+			return 0, nil, "430 No article with that message-id"
+		}
+		twt, ok := s.srv.cache.Lookup(hash)
+		if !ok {
+			return 0, nil, "430 No article with that message-id"
+		}
+		for _, article := range s.articles {
+			if article.Twt.Hash() == hash {
+				return article.Number, twt, ""
+			}
+		}
+		return 0, twt, ""
+	}
+
+	if s.group == "" {
+		return 0, nil, "412 No newsgroup selected"
+	}
+
+	if len(args) == 0 {
+		if s.current < 0 || s.current >= len(s.articles) {
+			return 0, nil, "420 Current article number is invalid"
+		}
+		article := s.articles[s.current]
+		return article.Number, article.Twt, ""
+	}
+
+	num, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return 0, nil, "501 Syntax error"
+	}
+	for i, article := range s.articles {
+		if article.Number == num {
+			s.current = i
+			return article.Number, article.Twt, ""
+		}
+	}
+	return 0, nil, "423 No article with that number"
+}
+
+func (s *nntpSession) article(cmd string, args []string) error {
+	num, twt, errStatus := s.lookup(args)
+	if errStatus != "" {
+		return s.tp.PrintfLine("%s", errStatus)
+	}
+
+	msgID := s.srv.messageID(twt.Hash())
+	group := s.group
+	if group == "" {
+		group = s.srv.groupName(twt.Twter().URI)
+	}
+
+	switch cmd {
+	case "STAT":
+		return s.tp.PrintfLine("223 %d %s", num, msgID)
+	case "HEAD":
+		return s.writeMultiline(fmt.Sprintf("221 %d %s", num, msgID), s.srv.headers(group, twt))
+	case "BODY":
+		return s.writeMultiline(fmt.Sprintf("222 %d %s", num, msgID), s.srv.body(twt))
+	default:
+		lines := append(s.srv.headers(group, twt), "")
+		lines = append(lines, s.srv.body(twt)...)
+		return s.writeMultiline(fmt.Sprintf("220 %d %s", num, msgID), lines)
+	}
+}
+
+func (s *nntpSession) over(args []string) error {
+	if s.group == "" {
+		return s.tp.PrintfLine("412 No newsgroup selected")
+	}
+
+	low, high := int64(0), int64(0)
+	if len(args) == 0 {
+		if s.current < 0 {
+			return s.tp.PrintfLine("420 Current article number is invalid")
+		}
+		low = s.articles[s.current].Number
+		high = low
+	} else {
+		parts := strings.SplitN(args[0], "-", 2)
+		var err error
+		if low, err = strconv.ParseInt(parts[0], 10, 64); err != nil {
+			return s.tp.PrintfLine("501 Syntax error")
+		}
+		high = low
+		if len(parts) == 2 {
+			if parts[1] == "" {
+				high = 1<<63 - 1
+			} else if high, err = strconv.ParseInt(parts[1], 10, 64); err != nil {
+				return s.tp.PrintfLine("501 Syntax error")
+			}
+		}
+	}
+
+	sanitize := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ")
+
+	var lines []string
+	for _, article := range s.articles {
+		if article.Number < low || article.Number > high {
+			continue
+		}
+		twt := article.Twt
+		body := strings.Join(s.srv.body(twt), "\r\n")
+		lines = append(lines, strings.Join([]string{
+			strconv.FormatInt(article.Number, 10),
+			sanitize.Replace(s.srv.subject(twt)),
+			sanitize.Replace(s.srv.from(twt)),
+			twt.Created().Format(time.RFC1123Z),
+			s.srv.messageID(twt.Hash()),
+			s.srv.references(twt),
+			strconv.Itoa(len(body)),
+			strconv.Itoa(len(s.srv.body(twt))),
+		}, "\t"))
+	}
+
+	if len(lines) == 0 {
+		return s.tp.PrintfLine("423 No articles in that range")
+	}
+
+	return s.writeMultiline("224 Overview information follows", lines)
+}
@@ -0,0 +1,183 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ocsp"
+)
+
+const (
+	// ocspRequestTimeout is the timeout of requests to OCSP responders
+	ocspRequestTimeout = 10 * time.Second
+
+	// ocspMaxResponseSize is the maximum size of OCSP responses
+	ocspMaxResponseSize = 1 << 16
+
+	// ocspRefreshMargin is how long before its next update a stapled OCSP
+	// response is refreshed
+	ocspRefreshMargin = time.Hour
+
+	// ocspDefaultValidity is how long OCSP responses without a next update
+	// are stapled for
+	ocspDefaultValidity = time.Hour
+
+	// ocspRetryInterval is how long to wait before retrying a failed fetch
+	ocspRetryInterval = 5 * time.Minute
+)
+
+// ErrNoOCSPServer is returned when a certificate has no OCSP responder
+var ErrNoOCSPServer = errors.New("error: certificate has no ocsp server")
+
+type ocspStaple struct {
+	raw        []byte
+	nextUpdate time.Time
+}
+
+// OCSPStapler staples OCSP responses to the certificates served by the pod.
+// Responses are fetched in the background so TLS handshakes never wait on
+// an OCSP responder; handshakes before a response is available (or when the
+// responder is unreachable) are served without a staple.
+type OCSPStapler struct {
+	mu       sync.Mutex
+	staples  map[string]*ocspStaple
+	inflight map[string]bool
+	retry    map[string]time.Time
+
+	client *http.Client
+}
+
+// NewOCSPStapler ...
+func NewOCSPStapler() *OCSPStapler {
+	return &OCSPStapler{
+		staples:  make(map[string]*ocspStaple),
+		inflight: make(map[string]bool),
+		retry:    make(map[string]time.Time),
+		client:   &http.Client{Timeout: ocspRequestTimeout},
+	}
+}
+
+// GetCertificate wraps a tls.Config GetCertificate function stapling OCSP
+// responses to the returned certificates
+func (o *OCSPStapler) GetCertificate(get func(*tls.ClientHelloInfo) (*tls.Certificate, error)) func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+		cert, err := get(hello)
+		if err != nil || cert == nil {
+			return cert, err
+		}
+		return o.Staple(cert), nil
+	}
+}
+
+// Staple returns a copy of cert with a stapled OCSP response if one is
+// available and triggers a (background) refresh if it is missing or stale
+func (o *OCSPStapler) Staple(cert *tls.Certificate) *tls.Certificate {
+	if len(cert.Certificate) < 2 {
+		// Self-signed or missing the issuer's certificate
+		return cert
+	}
+
+	key := string(cert.Certificate[0])
+
+	o.mu.Lock()
+	staple, ok := o.staples[key]
+	refresh := !ok || time.Now().After(staple.nextUpdate.Add(-ocspRefreshMargin))
+	if refresh && !o.inflight[key] && time.Now().After(o.retry[key]) {
+		o.inflight[key] = true
+		go o.refresh(key, cert)
+	}
+	o.mu.Unlock()
+
+	if !ok || time.Now().After(staple.nextUpdate) {
+		return cert
+	}
+
+	stapled := *cert
+	stapled.OCSPStaple = staple.raw
+	return &stapled
+}
+
+func (o *OCSPStapler) refresh(key string, cert *tls.Certificate) {
+	defer func() {
+		o.mu.Lock()
+		delete(o.inflight, key)
+		o.mu.Unlock()
+	}()
+
+	staple, err := o.fetch(cert)
+	if err != nil {
+		if err != ErrNoOCSPServer {
+			log.WithError(err).Warn("error fetching ocsp response")
+		}
+		o.mu.Lock()
+		o.retry[key] = time.Now().Add(ocspRetryInterval)
+		o.mu.Unlock()
+		return
+	}
+
+	o.mu.Lock()
+	o.staples[key] = staple
+	delete(o.retry, key)
+	o.mu.Unlock()
+}
+
+func (o *OCSPStapler) fetch(cert *tls.Certificate) (*ocspStaple, error) {
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(leaf.OCSPServer) == 0 {
+		return nil, ErrNoOCSPServer
+	}
+
+	issuer, err := x509.ParseCertificate(cert.Certificate[1])
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := ocsp.CreateRequest(leaf, issuer, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := o.client.Post(leaf.OCSPServer[0], "application/ocsp-request", bytes.NewReader(req))
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error: ocsp responder %s returned %s", leaf.OCSPServer[0], res.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(res.Body, ocspMaxResponseSize))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := ocsp.ParseResponseForCert(raw, leaf, issuer)
+	if err != nil {
+		return nil, err
+	}
+	if resp.Status != ocsp.Good {
+		return nil, fmt.Errorf("error: ocsp status of certificate %s is not good (%d)", leaf.SerialNumber, resp.Status)
+	}
+
+	nextUpdate := resp.NextUpdate
+	if nextUpdate.IsZero() {
+		nextUpdate = time.Now().Add(ocspDefaultValidity)
+	}
+
+	return &ocspStaple{raw: raw, nextUpdate: nextUpdate}, nil
+}
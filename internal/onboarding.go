@@ -0,0 +1,316 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// maxPopularSuggestions is the maximum number of the pod's most followed
+	// feeds suggested to new users
+	maxPopularSuggestions = 10
+
+	// maxSourceSuggestions is the maximum number of feeds of each feed
+	// source suggested to new users
+	maxSourceSuggestions = 5
+)
+
+// Onboarding wizard steps in order
+const (
+	OnboardingStepProfile     = "profile"
+	OnboardingStepPreferences = "preferences"
+	OnboardingStepFollow      = "follow"
+	OnboardingStepIntro       = "intro"
+)
+
+// OnboardingSteps are the steps of the onboarding wizard in order
+var OnboardingSteps = []string{
+	OnboardingStepProfile,
+	OnboardingStepPreferences,
+	OnboardingStepFollow,
+	OnboardingStepIntro,
+}
+
+// NextOnboardingStep returns the step after the given step, empty after the
+// last step
+func NextOnboardingStep(step string) string {
+	for i, s := range OnboardingSteps {
+		if s == step && i+1 < len(OnboardingSteps) {
+			return OnboardingSteps[i+1]
+		}
+	}
+	return ""
+}
+
+// IsOnboardingStep returns true if step is a step of the onboarding wizard
+func IsOnboardingStep(step string) bool {
+	for _, s := range OnboardingSteps {
+		if s == step {
+			return true
+		}
+	}
+	return false
+}
+
+// FeedSuggestion is a feed suggested to new users to follow, either one of
+// the feeds most followed by the pod's users or one of a feed source
+type FeedSuggestion struct {
+	Nick        string
+	URL         string
+	Avatar      string
+	Description string
+	Source      string
+	Followers   int
+}
+
+// SuggestFeeds suggests feeds for the user to follow, the feeds most
+// followed by the pod's (active) users first followed by the feeds of the
+// feed sources, feeds the user follows already are left out
+func SuggestFeeds(user *User, users []*User, sources FeedSourceMap) []FeedSuggestion {
+	var (
+		suggestions []FeedSuggestion
+		seen        = make(map[string]bool)
+	)
+
+	skip := func(uri string) bool {
+		return uri == "" || seen[uri] || user.Is(uri) || user.Follows(uri)
+	}
+
+	popular := make(map[string]*FeedSuggestion)
+	for _, u := range users {
+		if !u.IsActive() || u.Username == user.Username {
+			continue
+		}
+		for nick, uri := range u.Following {
+			if skip(uri) {
+				continue
+			}
+			if s, ok := popular[uri]; ok {
+				s.Followers++
+				continue
+			}
+			popular[uri] = &FeedSuggestion{Nick: nick, URL: uri, Followers: 1}
+		}
+	}
+
+	var mostFollowed []FeedSuggestion
+	for _, s := range popular {
+		mostFollowed = append(mostFollowed, *s)
+	}
+	sort.Slice(mostFollowed, func(i, j int) bool {
+		if mostFollowed[i].Followers == mostFollowed[j].Followers {
+			return mostFollowed[i].Nick < mostFollowed[j].Nick
+		}
+		return mostFollowed[i].Followers > mostFollowed[j].Followers
+	})
+	if len(mostFollowed) > maxPopularSuggestions {
+		mostFollowed = mostFollowed[:maxPopularSuggestions]
+	}
+	for _, s := range mostFollowed {
+		seen[s.URL] = true
+		suggestions = append(suggestions, s)
+	}
+
+	var urls []string
+	for url := range sources {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	for _, url := range urls {
+		n := 0
+		for _, feed := range sources[url] {
+			if n >= maxSourceSuggestions {
+				break
+			}
+			if skip(feed.URL) {
+				continue
+			}
+			seen[feed.URL] = true
+			suggestions = append(suggestions, FeedSuggestion{
+				Nick:        feed.Name,
+				URL:         feed.URL,
+				Avatar:      feed.Avatar,
+				Description: feed.Description,
+				Source:      url,
+			})
+			n++
+		}
+	}
+
+	return suggestions
+}
+
+// OnboardingHandler walks newly registered users through setting up their
+// profile and preferences, following a few feeds and posting an intro twt
+func (s *Server) OnboardingHandler() httprouter.Handle {
+	var appendTwt = AppendTwtFactory(s.config(), s.cache, s.db)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			// Limit request body to to abuse
+			r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
+			defer r.Body.Close()
+		}
+
+		step := r.FormValue("step")
+		if !IsOnboardingStep(step) {
+			step = OnboardingSteps[0]
+		}
+
+		if r.Method == http.MethodGet {
+			if step == OnboardingStepFollow {
+				users, err := s.db.GetAllUsers()
+				if err != nil {
+					log.WithError(err).Warn("error loading users for feed suggestions")
+				}
+				sources, err := LoadFeedSources(s.config().Data)
+				if err != nil {
+					log.WithError(err).Warn("error loading feed sources for feed suggestions")
+					sources = &FeedSources{Sources: make(FeedSourceMap)}
+				}
+				if curated := directory.List(); len(curated) > 0 {
+					sources.Sources[s.config().BaseURL] = curated
+				}
+				ctx.FeedSuggestions = SuggestFeeds(user, users, sources.Sources)
+			}
+
+			ctx.Title = s.tr(ctx, "OnboardingTitle")
+			ctx.OnboardingStep = step
+			ctx.OnboardingSteps = OnboardingSteps
+			s.render("onboarding", w, ctx)
+			return
+		}
+
+		switch step {
+		case OnboardingStepProfile:
+			avatarFile, _, err := r.FormFile("avatar_file")
+			if err != nil && err != http.ErrMissingFile {
+				log.WithError(err).Error("error parsing form file")
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if avatarFile != nil {
+				if err := s.storeUserAvatar(user, avatarFile); err != nil {
+					ctx.Error = true
+					ctx.Message = fmt.Sprintf("Error updating user: %s", err)
+					s.render("error", w, ctx)
+					return
+				}
+			}
+			user.Tagline = strings.TrimSpace(r.FormValue("tagline"))
+		case OnboardingStepPreferences:
+			if tz := r.FormValue("displayDatesInTimezone"); tz != "" {
+				user.DisplayDatesInTimezone = tz
+			}
+			if theme := r.FormValue("theme"); theme != "" {
+				user.Theme = theme
+			}
+		case OnboardingStepFollow:
+			followed := false
+			for _, uri := range r.Form["follow"] {
+				nick := r.FormValue(fmt.Sprintf("nick:%s", uri))
+				uri = NormalizeURL(uri)
+
+				requested, err := RequestFollow(s.config(), s.db, user, uri)
+				if err != nil {
+					log.WithError(err).Warnf("error requesting to follow %s", uri)
+					continue
+				}
+				if requested {
+					continue
+				}
+
+				seen := s.cache.IsCached(uri)
+				if err := user.FollowAndValidate(s.config(), nick, uri); err != nil {
+					log.WithError(err).Warnf("error following %s", uri)
+					continue
+				}
+				if !seen {
+					if err := graylist.Add(uri, user.Username); err != nil {
+						log.WithError(err).Errorf("error graylisting feed %s", uri)
+					}
+				}
+				followed = true
+			}
+			if followed {
+				s.cache.GetByUser(user, true)
+			}
+		case OnboardingStepIntro:
+			if text := CleanTwt(r.FormValue("text")); text != "" {
+				twt, err := appendTwt(user, nil, text)
+				if err != nil {
+					log.WithError(err).Error("error posting intro twt")
+					ctx.Error = true
+					ctx.Message = s.tr(ctx, "ErrorPostingTwt")
+					s.render("error", w, ctx)
+					return
+				}
+
+				feedURL := s.config().URLForUser(user.Username)
+				PublishTwts(s.config(), s.tasks, user, feedURL, "", twt)
+
+				s.cache.InjectFeed(feedURL, twt)
+				s.cache.GetByUser(user, true)
+			}
+		}
+
+		next := NextOnboardingStep(step)
+		if next == "" {
+			user.OnboardingComplete = true
+		}
+
+		if err := s.db.SetUser(user.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		if next == "" {
+			http.Redirect(w, r, "/", http.StatusFound)
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/onboarding?step=%s", next), http.StatusFound)
+	}
+}
+
+// SkipOnboardingHandler completes the onboarding wizard without finishing
+// the remaining steps
+func (s *Server) SkipOnboardingHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		user.OnboardingComplete = true
+		if err := s.db.SetUser(user.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusFound)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextOnboardingStep(t *testing.T) {
+	assert.Equal(t, OnboardingStepPreferences, NextOnboardingStep(OnboardingStepProfile))
+	assert.Equal(t, OnboardingStepIntro, NextOnboardingStep(OnboardingStepFollow))
+	assert.Equal(t, "", NextOnboardingStep(OnboardingStepIntro))
+	assert.Equal(t, "", NextOnboardingStep("invalid"))
+}
+
+func TestSuggestFeeds(t *testing.T) {
+	newUser := func(username string, following map[string]string) *User {
+		user := NewUser()
+		user.Username = username
+		user.URL = "https://example.com/user/" + username + "/twtxt.txt"
+		for nick, uri := range following {
+			_ = user.Follow(nick, uri)
+		}
+		return user
+	}
+
+	const (
+		alice    = "https://example.com/user/alice/twtxt.txt"
+		bob      = "https://example.com/user/bob/twtxt.txt"
+		news     = "https://example.com/user/news/twtxt.txt"
+		prologic = "https://twtxt.net/user/prologic/twtxt.txt"
+	)
+
+	users := []*User{
+		newUser("alice", map[string]string{"bob": bob, "news": news}),
+		newUser("bob", map[string]string{"alice": alice, "news": news}),
+	}
+	sources := FeedSourceMap{
+		"https://feeds.example.com/": []FeedSource{
+			{Name: "prologic", URL: prologic, Description: "Yarn.social"},
+			{Name: "news", URL: news},
+		},
+	}
+
+	me := newUser("me", map[string]string{"alice": alice})
+
+	suggestions := SuggestFeeds(me, users, sources)
+	if assert.Len(t, suggestions, 3) {
+		// The most followed feeds first, feeds already followed are left out
+		assert.Equal(t, news, suggestions[0].URL)
+		assert.Equal(t, 2, suggestions[0].Followers)
+		assert.Equal(t, bob, suggestions[1].URL)
+
+		// Feeds of feed sources are suggested only once
+		assert.Equal(t, prologic, suggestions[2].URL)
+		assert.Equal(t, "https://feeds.example.com/", suggestions[2].Source)
+	}
+}
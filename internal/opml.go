@@ -0,0 +1,128 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// OPML is an OPML 2.0 subscription list as used by RSS readers and other
+// twtxt clients to exchange the feeds a user follows
+type OPML struct {
+	XMLName xml.Name    `xml:"opml"`
+	Version string      `xml:"version,attr"`
+	Head    OPMLHead    `xml:"head"`
+	Body    []OPMLEntry `xml:"body>outline"`
+}
+
+// OPMLHead ...
+type OPMLHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+	OwnerName   string `xml:"ownerName,omitempty"`
+	OwnerID     string `xml:"ownerId,omitempty"`
+}
+
+// OPMLEntry is a feed (with an xmlUrl) or a category of feeds
+type OPMLEntry struct {
+	Text     string      `xml:"text,attr"`
+	Title    string      `xml:"title,attr,omitempty"`
+	Type     string      `xml:"type,attr,omitempty"`
+	XMLURL   string      `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string      `xml:"htmlUrl,attr,omitempty"`
+	Category string      `xml:"category,attr,omitempty"`
+	Outlines []OPMLEntry `xml:"outline"`
+}
+
+// OPMLFeed is a feed found in an OPML document
+type OPMLFeed struct {
+	Nick     string
+	URL      string
+	Category string
+}
+
+// ExportOPML returns the feeds the user follows as an OPML document
+func ExportOPML(conf *Config, user *User) ([]byte, error) {
+	doc := OPML{
+		Version: "2.0",
+		Head: OPMLHead{
+			Title:       fmt.Sprintf("%s is following on %s", user.Username, conf.Name),
+			DateCreated: time.Now().Format(time.RFC1123Z),
+			OwnerName:   user.Username,
+			OwnerID:     conf.URLForUser(user.Username),
+		},
+	}
+
+	nicks := make([]string, 0, len(user.Following))
+	for nick := range user.Following {
+		nicks = append(nicks, nick)
+	}
+	sort.Strings(nicks)
+
+	for _, nick := range nicks {
+		url := user.Following[nick]
+		doc.Body = append(doc.Body, OPMLEntry{
+			Text:    nick,
+			Title:   nick,
+			Type:    "twtxt",
+			XMLURL:  url,
+			HTMLURL: conf.ExternalURL(nick, url),
+		})
+	}
+
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte(xml.Header), data...), nil
+}
+
+// ParseOPML returns the feeds of an OPML document. Feeds nested in an
+// outline without an xmlUrl take its text as their category.
+func ParseOPML(r io.Reader) ([]OPMLFeed, error) {
+	var doc OPML
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+
+	var (
+		feeds []OPMLFeed
+		walk  func(entries []OPMLEntry, category string)
+	)
+
+	walk = func(entries []OPMLEntry, category string) {
+		for _, entry := range entries {
+			if entry.XMLURL == "" {
+				walk(entry.Outlines, strings.TrimSpace(entry.Text))
+				continue
+			}
+
+			nick := strings.TrimSpace(entry.Text)
+			if nick == "" {
+				nick = strings.TrimSpace(entry.Title)
+			}
+
+			feed := OPMLFeed{
+				Nick:     nick,
+				URL:      NormalizeURL(entry.XMLURL),
+				Category: category,
+			}
+			if entry.Category != "" {
+				feed.Category = strings.TrimSpace(entry.Category)
+			}
+			feeds = append(feeds, feed)
+
+			walk(entry.Outlines, category)
+		}
+	}
+	walk(doc.Body, "")
+
+	return feeds, nil
+}
@@ -6,6 +6,8 @@ package internal
 import (
 	// embed resources
 	_ "embed"
+	"fmt"
+	"net"
 	"net/url"
 	"regexp"
 	"runtime"
@@ -33,6 +35,12 @@ const (
 	// DefaultTLSCert is the default path to a TLS certificate (if blank uses Let's Encrypt)
 	DefaultTLSCert = ""
 
+	// DefaultTLSOCSPStapling is the default for stapling OCSP responses
+	DefaultTLSOCSPStapling = false
+
+	// DefaultTLSHTTP3 is the default for serving HTTP/3 (QUIC) with TLS
+	DefaultTLSHTTP3 = false
+
 	// DefaultStore is the default data store used for accounts, sessions, etc
 	DefaultStore = "bitcask://yarn.db"
 
@@ -79,6 +87,10 @@ const (
 	// DefaultDisableFfmpeg is the default for disabling ffmpeg support
 	DefaultDisableFfmpeg = false
 
+	// DefaultDisableMediaProxy is the default for disabling the media proxy
+	// that serves external images referenced in twts
+	DefaultDisableMediaProxy = false
+
 	// DefaultCookieSecret is the server's default cookie secret
 	DefaultCookieSecret = InvalidConfigValue
 
@@ -91,6 +103,35 @@ const (
 	// DefaultMaxCacheTTL is the default maximum cache ttl of twts in memory
 	DefaultMaxCacheTTL = time.Hour * 24 * 14 // 2 weeks
 
+	// DefaultCacheSnapshotInterval is the default interval between snapshots
+	// of the feed cache to disk
+	DefaultCacheSnapshotInterval = 5 * time.Minute
+
+	// DefaultGraylistMinAge is the default minimum time a graylisted feed
+	// must be known for before its twts are shown on the Discover timeline
+	DefaultGraylistMinAge = 48 * time.Hour
+
+	// DefaultGraylistMinTwts is the default minimum number of twts a
+	// graylisted feed must have before its twts are shown on the Discover
+	// timeline
+	DefaultGraylistMinTwts = 5
+
+	// DefaultTaskMaxRetries is the default number of times failed media
+	// tasks (image processing, audio and video transcoding) are retried
+	DefaultTaskMaxRetries = 3
+
+	// DefaultTaskRetryBackoff is the default time to wait before the first
+	// retry of a failed media task, doubled after each retry
+	DefaultTaskRetryBackoff = time.Minute
+
+	// DefaultTaskConcurrency is the default limits of the number of tasks of
+	// each kind run concurrently
+	DefaultTaskConcurrency = "video=1,audio=2"
+
+	// DefaultMaxCacheMemory is the default memory budget of the feed cache in
+	// bytes (0 means unlimited)
+	DefaultMaxCacheMemory = 0
+
 	// DefaultFetchInterval is the default interval used by the global feed cache
 	// to control when to actually fetch and update feeds.
 	DefaultFetchInterval = "@every 5m"
@@ -102,6 +143,14 @@ const (
 	// DefaultOpenProfiles is the default for whether or not to have open user profiles
 	DefaultOpenProfiles = false
 
+	// DefaultPublicAPI is the default for whether or not to expose read-only
+	// public API endpoints without authentication
+	DefaultPublicAPI = false
+
+	// DefaultAPIValidation is the default for whether or not to validate API
+	// requests against the API's specification
+	DefaultAPIValidation = false
+
 	// DefaultMaxUploadSize is the default maximum upload size permitted
 	DefaultMaxUploadSize = 1 << 24 // ~16MB (enough for high-res photos)
 
@@ -111,12 +160,29 @@ const (
 	// DefaultSessionExpiry is the server's default session expiry time
 	DefaultSessionExpiry = 240 * time.Hour // 10 days
 
+	// DefaultDeletionGracePeriod is the default time a deleted account is kept
+	// (deactivated) before it is purged so the deletion can be cancelled
+	DefaultDeletionGracePeriod = 336 * time.Hour // 14 days
+
 	// DefaultTranscoderTimeout is the default vodeo transcoding timeout
 	DefaultTranscoderTimeout = 10 * time.Minute // 10mins
 
 	// DefaultMagicLinkSecret is the jwt magic link secret
 	DefaultMagicLinkSecret = InvalidConfigValue
 
+	// DefaultNNTPBind is the default bind address of the read-only NNTP
+	// gateway (blank disables the gateway)
+	DefaultNNTPBind = ""
+
+	// DefaultPluginsDir is the default directory plugins are loaded from
+	// (blank disables plugins)
+	DefaultPluginsDir = ""
+
+	// Default XMPP bridge configuration (blank JID disables the bridge)
+	DefaultXMPPJID      = ""
+	DefaultXMPPPassword = ""
+	DefaultXMPPServer   = ""
+
 	// Default Messaging settings
 	DefaultSMTPBind = "0.0.0.0:8025"
 	DefaultPOP3Bind = "0.0.0.0:8110"
@@ -128,9 +194,23 @@ const (
 	DefaultSMTPPass = InvalidConfigValue
 	DefaultSMTPFrom = InvalidConfigValue
 
+	// LegacyTwtHashLength is the original length of twt hashes which is
+	// always accepted for backwards compatibility
+	LegacyTwtHashLength = 7
+
+	// MaxTwtHashLength is the length of a full (untruncated) twt hash
+	MaxTwtHashLength = 52
+
+	// DefaultTwtHashLength is the default length of twt hashes
+	DefaultTwtHashLength = LegacyTwtHashLength
+
 	// DefaultMaxFetchLimit is the maximum fetch fetch limit in bytes
 	DefaultMaxFetchLimit = 1 << 20 // ~1MB (or more than enough for months)
 
+	// DefaultMaxFetchRedirects is the default maximum number of redirects
+	// followed by server-side fetches
+	DefaultMaxFetchRedirects = 5
+
 	// DefaultAPISessionTime is the server's default session time for API tokens
 	DefaultAPISessionTime = 240 * time.Hour // 10 days
 
@@ -164,11 +244,27 @@ var (
 	DefaultAlertType    = "safe"
 	DefaultAlertMessage string
 
+	// DefaultThemesDirs is the default list of directories containing themes
+	// that can be selected at runtime
+	DefaultThemesDirs = []string{}
+
 	// DefaultFeedSources is the default list of external feed sources
 	DefaultFeedSources = []string{
 		"https://feeds.twtxt.net/we-are-feeds.txt",
 	}
 
+	// DefaultCORSOrigins is the default list of origins allowed to make
+	// cross-origin requests to the API and media endpoints (none)
+	DefaultCORSOrigins = []string{}
+
+	// DefaultCORSHeaders is the default list of request headers allowed in
+	// cross-origin requests
+	DefaultCORSHeaders = []string{"Content-Type", "Token"}
+
+	// DefaultCORSMethods is the default list of methods allowed in
+	// cross-origin requests
+	DefaultCORSMethods = []string{"GET", "POST"}
+
 	// DefaultTwtPrompts are the set of default prompts  for twt text(s)
 	DefaultTwtPrompts = []string{
 		`What's on your mind? 🤔`,
@@ -197,6 +293,19 @@ var (
 		`gopher\.floodgap\.com`,
 	}
 
+	// DefaultReservedUsernames is the default list of usernames that cannot
+	// be registered (in addition to the names of special feeds)
+	DefaultReservedUsernames = []string{
+		"admin", "administrator", "root", "abuse", "postmaster",
+		"support", "help", "info", "www", "api",
+	}
+
+	// DefaultUsernameMinLength is the default minimum length of usernames
+	DefaultUsernameMinLength = 2
+
+	// DefaultUsernameMaxLength is the default maximum length of usernames
+	DefaultUsernameMaxLength = maxUsernameLength
+
 	// DefaultMaxCacheFetchers is the default maximun number of fetchers used
 	// by the global feed cache during update cycles. This controls how quickly
 	// feeds are updated in each feed cache cycle. The default is the number of
@@ -222,6 +331,10 @@ var (
 
 	// OriginalMedia is the default for whether to link or display original media or not
 	OriginalMedia bool
+
+	// DefaultDiscoverRanking is the default Pod level ranking of the Discover
+	// timeline (overridable by Users)
+	DefaultDiscoverRanking = DiscoverChronological
 )
 
 func NewConfig() *Config {
@@ -235,9 +348,13 @@ func NewConfig() *Config {
 		Description:             DefaultMetaDescription,
 		Store:                   DefaultStore,
 		Theme:                   DefaultTheme,
+		ThemesDirs:              DefaultThemesDirs,
 		BaseURL:                 DefaultBaseURL,
 		AdminUser:               DefaultAdminUser,
 		FeedSources:             DefaultFeedSources,
+		CORSOrigins:             DefaultCORSOrigins,
+		CORSHeaders:             DefaultCORSHeaders,
+		CORSMethods:             DefaultCORSMethods,
 		CookieSecret:            DefaultCookieSecret,
 		AlertFloat:              DefaultAlertFloat,
 		AlertGuest:              DefaultAlertGuest,
@@ -250,23 +367,45 @@ func NewConfig() *Config {
 		AvatarResolution:        DefaultAvatarResolution,
 		MediaResolution:         DefaultMediaResolution,
 		OpenProfiles:            DefaultOpenProfiles,
+		PublicAPI:               DefaultPublicAPI,
+		ReservedUsernames:       DefaultReservedUsernames,
+		UsernameMinLength:       DefaultUsernameMinLength,
+		UsernameMaxLength:       DefaultUsernameMaxLength,
+		APIValidation:           DefaultAPIValidation,
 		OpenRegistrations:       DefaultOpenRegistrations,
 		DisableGzip:             DefaultDisableGzip,
 		DisableLogger:           DefaultDisableLogger,
 		DisableFfmpeg:           DefaultDisableFfmpeg,
 		DisableMedia:            DefaultDisableMedia,
+		DisableMediaProxy:       DefaultDisableMediaProxy,
 		Features:                NewFeatureFlags(),
 		DisplayDatesInTimezone:  DefaultDisplayDatesInTimezone,
 		DisplayTimePreference:   DefaultDisplayTimePreference,
 		OpenLinksInPreference:   DefaultOpenLinksInPreference,
 		DisplayImagesPreference: DefaultDisplayImagesPreference,
 		DisplayMedia:            DefaultDisplayMedia,
+		DiscoverRanking:         DefaultDiscoverRanking,
 		SessionExpiry:           DefaultSessionExpiry,
+		DeletionGracePeriod:     DefaultDeletionGracePeriod,
 		MagicLinkSecret:         DefaultMagicLinkSecret,
 		SMTPHost:                DefaultSMTPHost,
 		SMTPPort:                DefaultSMTPPort,
 		SMTPUser:                DefaultSMTPUser,
 		SMTPPass:                DefaultSMTPPass,
+		NNTPBind:                DefaultNNTPBind,
+		XMPPJID:                 DefaultXMPPJID,
+		XMPPPassword:            DefaultXMPPPassword,
+		XMPPServer:              DefaultXMPPServer,
+		PluginsDir:              DefaultPluginsDir,
+		TwtHashLength:           DefaultTwtHashLength,
+		CacheSnapshotInterval:   DefaultCacheSnapshotInterval,
+		GraylistMinAge:          DefaultGraylistMinAge,
+		GraylistMinTwts:         DefaultGraylistMinTwts,
+		MaxFetchRedirects:       DefaultMaxFetchRedirects,
+		TaskMaxRetries:          DefaultTaskMaxRetries,
+		TaskRetryBackoff:        DefaultTaskRetryBackoff,
+		TaskConcurrency:         DefaultTaskConcurrency,
+		MaxCacheMemory:          DefaultMaxCacheMemory,
 	}
 
 	return conf
@@ -307,6 +446,41 @@ func WithTLSCert(tlsCert string) Option {
 	}
 }
 
+// WithListeners sets additional addresses (or UNIX domain sockets) to listen on
+func WithListeners(specs []string) Option {
+	return func(cfg *Config) error {
+		cfg.Listeners = specs
+		cfg.listeners = nil
+		for _, spec := range specs {
+			if spec == "" {
+				continue
+			}
+			l, err := ParseListener(spec)
+			if err != nil {
+				return err
+			}
+			cfg.listeners = append(cfg.listeners, l)
+		}
+		return nil
+	}
+}
+
+// WithTLSOCSPStapling enables stapling OCSP responses to TLS certificates
+func WithTLSOCSPStapling(stapling bool) Option {
+	return func(cfg *Config) error {
+		cfg.TLSOCSPStapling = stapling
+		return nil
+	}
+}
+
+// WithTLSHTTP3 enables serving HTTP/3 (QUIC) alongside HTTP/1.1 and HTTP/2
+func WithTLSHTTP3(http3 bool) Option {
+	return func(cfg *Config) error {
+		cfg.TLSHTTP3 = http3
+		return nil
+	}
+}
+
 // WithData sets the data directory to use for storage
 func WithData(data string) Option {
 	return func(cfg *Config) error {
@@ -360,6 +534,31 @@ func WithAdminEmail(adminEmail string) Option {
 	}
 }
 
+// WithCORSOrigins sets the origins allowed to make cross-origin requests to
+// the API and media endpoints (* allows any origin)
+func WithCORSOrigins(origins []string) Option {
+	return func(cfg *Config) error {
+		cfg.CORSOrigins = origins
+		return nil
+	}
+}
+
+// WithCORSHeaders sets the request headers allowed in cross-origin requests
+func WithCORSHeaders(headers []string) Option {
+	return func(cfg *Config) error {
+		cfg.CORSHeaders = headers
+		return nil
+	}
+}
+
+// WithCORSMethods sets the methods allowed in cross-origin requests
+func WithCORSMethods(methods []string) Option {
+	return func(cfg *Config) error {
+		cfg.CORSMethods = methods
+		return nil
+	}
+}
+
 // WithFeedSources sets the feed sources  to use for external feeds
 func WithFeedSources(feedSources []string) Option {
 	return func(cfg *Config) error {
@@ -392,6 +591,15 @@ func WithTheme(theme string) Option {
 	}
 }
 
+// WithThemesDirs sets the directories containing themes that can be selected
+// at runtime from the pod's management page
+func WithThemesDirs(dirs []string) Option {
+	return func(cfg *Config) error {
+		cfg.ThemesDirs = dirs
+		return nil
+	}
+}
+
 // WithOpenRegistrations sets the open registrations flag
 func WithOpenRegistrations(openRegistrations bool) Option {
 	return func(cfg *Config) error {
@@ -424,6 +632,14 @@ func WithDisableMedia(disablemedia bool) Option {
 	}
 }
 
+// WithDisableMediaProxy sets the disable media proxy flag
+func WithDisableMediaProxy(disableMediaProxy bool) Option {
+	return func(cfg *Config) error {
+		cfg.DisableMediaProxy = disableMediaProxy
+		return nil
+	}
+}
+
 // WithDisableFfmpeg sets the disable ffmpeg flag
 func WithDisableFfmpeg(disableFfmpeg bool) Option {
 	return func(cfg *Config) error {
@@ -464,6 +680,80 @@ func WithMaxCacheTTL(maxCacheTTL time.Duration) Option {
 	}
 }
 
+// WithGraylistMinAge sets the minimum time graylisted feeds must be known for
+// before their twts are shown on the Discover timeline (See: Graylist)
+func WithGraylistMinAge(age time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.GraylistMinAge = age
+		return nil
+	}
+}
+
+// WithGraylistMinTwts sets the minimum number of twts graylisted feeds must
+// have before their twts are shown on the Discover timeline (See: Graylist)
+func WithGraylistMinTwts(n int) Option {
+	return func(cfg *Config) error {
+		cfg.GraylistMinTwts = n
+		return nil
+	}
+}
+
+// WithTaskMaxRetries sets the number of times failed media tasks are retried
+// before they are kept as dead letters
+func WithTaskMaxRetries(n int) Option {
+	return func(cfg *Config) error {
+		if n < 0 {
+			return fmt.Errorf("error: invalid task max retries %d", n)
+		}
+		cfg.TaskMaxRetries = n
+		return nil
+	}
+}
+
+// WithTaskRetryBackoff sets the time to wait before the first retry of a
+// failed media task, doubled after each retry
+func WithTaskRetryBackoff(backoff time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.TaskRetryBackoff = backoff
+		return nil
+	}
+}
+
+// WithTaskConcurrency sets the limits of the number of tasks of each kind
+// (image, audio or video) run concurrently, e.g: "video=1,audio=2"
+func WithTaskConcurrency(concurrency string) Option {
+	return func(cfg *Config) error {
+		if _, err := ParseTaskConcurrency(concurrency); err != nil {
+			return err
+		}
+		cfg.TaskConcurrency = concurrency
+		return nil
+	}
+}
+
+// WithCacheSnapshotInterval sets the interval between snapshots of the feed
+// cache to disk
+func WithCacheSnapshotInterval(interval time.Duration) Option {
+	return func(cfg *Config) error {
+		if interval < time.Minute {
+			return fmt.Errorf("error: cache snapshot interval %s is less than 1m", interval)
+		}
+		cfg.CacheSnapshotInterval = interval
+		return nil
+	}
+}
+
+// WithMaxCacheMemory sets the memory budget of the feed cache in bytes
+func WithMaxCacheMemory(limit int64) Option {
+	return func(cfg *Config) error {
+		if limit < 0 {
+			return fmt.Errorf("error: max cache memory %d is negative", limit)
+		}
+		cfg.MaxCacheMemory = limit
+		return nil
+	}
+}
+
 // WithFetchInterval sets the cache fetch interval
 // Accepts a string as parsed by `time.ParseDuration`
 func WithFetchInterval(fetchInterval string) Option {
@@ -489,6 +779,24 @@ func WithMaxCacheItems(maxCacheItems int) Option {
 	}
 }
 
+// WithPublicAPI sets whether or not to expose read-only public API endpoints
+// without authentication
+func WithPublicAPI(publicAPI bool) Option {
+	return func(cfg *Config) error {
+		cfg.PublicAPI = publicAPI
+		return nil
+	}
+}
+
+// WithAPIValidation sets whether or not to validate API requests against the
+// API's specification
+func WithAPIValidation(apiValidation bool) Option {
+	return func(cfg *Config) error {
+		cfg.APIValidation = apiValidation
+		return nil
+	}
+}
+
 // WithOpenProfiles sets whether or not to have open user profiles
 func WithOpenProfiles(openProfiles bool) Option {
 	return func(cfg *Config) error {
@@ -521,6 +829,15 @@ func WithSessionExpiry(expiry time.Duration) Option {
 	}
 }
 
+// WithDeletionGracePeriod sets the time deleted accounts are kept before they
+// are purged (zero deletes accounts immediately)
+func WithDeletionGracePeriod(period time.Duration) Option {
+	return func(cfg *Config) error {
+		cfg.DeletionGracePeriod = period
+		return nil
+	}
+}
+
 // WithTranscoderTimeout sets the video transcoding timeout
 func WithTranscoderTimeout(timeout time.Duration) Option {
 	return func(cfg *Config) error {
@@ -537,6 +854,47 @@ func WithMagicLinkSecret(secret string) Option {
 	}
 }
 
+// WithNNTPBind sets the bind address of the read-only NNTP gateway
+func WithNNTPBind(bind string) Option {
+	return func(cfg *Config) error {
+		cfg.NNTPBind = bind
+		return nil
+	}
+}
+
+// WithXMPPJID sets the JID the XMPP notification bridge connects as
+func WithXMPPJID(jid string) Option {
+	return func(cfg *Config) error {
+		cfg.XMPPJID = jid
+		return nil
+	}
+}
+
+// WithXMPPPassword sets the password of the XMPP notification bridge's JID
+func WithXMPPPassword(password string) Option {
+	return func(cfg *Config) error {
+		cfg.XMPPPassword = password
+		return nil
+	}
+}
+
+// WithXMPPServer sets the host:port of the XMPP server to connect to
+// (if blank the server is discovered from the JID's domain)
+func WithXMPPServer(server string) Option {
+	return func(cfg *Config) error {
+		cfg.XMPPServer = server
+		return nil
+	}
+}
+
+// WithPluginsDir sets the directory Go plugins (*.so) are loaded from
+func WithPluginsDir(dir string) Option {
+	return func(cfg *Config) error {
+		cfg.PluginsDir = dir
+		return nil
+	}
+}
+
 // WithSMTPHost sets the SMTPHost to use for sending email
 func WithSMTPHost(host string) Option {
 	return func(cfg *Config) error {
@@ -585,6 +943,17 @@ func WithMaxFetchLimit(limit int64) Option {
 	}
 }
 
+// WithTwtHashLength sets the length of twt hashes
+func WithTwtHashLength(n int) Option {
+	return func(cfg *Config) error {
+		if !IsValidTwtHashLength(n) {
+			return fmt.Errorf("error: invalid twt hash length %d", n)
+		}
+		cfg.TwtHashLength = n
+		return nil
+	}
+}
+
 // WithAPISessionTime sets the API session time for tokens
 func WithAPISessionTime(duration time.Duration) Option {
 	return func(cfg *Config) error {
@@ -620,6 +989,101 @@ func WithPermittedImages(permittedImages []string) Option {
 	}
 }
 
+// WithOverrides sets options that take precedence over the pod settings
+// (settings.yaml), such as those explicitly set by flags or the environment
+func WithOverrides(options ...Option) Option {
+	return func(cfg *Config) error {
+		cfg.overrides = append(cfg.overrides, options...)
+		return nil
+	}
+}
+
+// WithUsernamePolicy replaces the username policy configured in the pod
+// settings with a custom policy
+func WithUsernamePolicy(policy UsernamePolicy) Option {
+	return func(cfg *Config) error {
+		cfg.usernamePolicy = policy
+		return nil
+	}
+}
+
+// WithUsernamePattern sets the pattern (regular expression) usernames must
+// match to be registered
+func WithUsernamePattern(pattern string) Option {
+	return func(cfg *Config) error {
+		cfg.UsernamePattern = pattern
+		cfg.usernamePattern = nil
+		if pattern == "" {
+			return nil
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return err
+		}
+		cfg.usernamePattern = re
+		return nil
+	}
+}
+
+// WithAllowedFeeds sets the list of feed uris (regexes) allowed to be
+// followed and fetched, if any are set the pod is in allowlist federation
+// mode and all other (external) feeds are prohibited
+func WithAllowedFeeds(allowedFeeds []string) Option {
+	return func(cfg *Config) error {
+		cfg.AllowedFeeds = allowedFeeds
+		cfg.allowedFeeds = nil
+		for _, allowedFeed := range allowedFeeds {
+			if allowedFeed == "" {
+				continue
+			}
+			re, err := regexp.Compile(allowedFeed)
+			if err != nil {
+				return err
+			}
+			cfg.allowedFeeds = append(cfg.allowedFeeds, re)
+		}
+		return nil
+	}
+}
+
+// WithFetchAllowedNetworks sets the list of networks (CIDRs or IPs) that
+// server-side fetches may connect to even though they are private or
+// reserved networks (e.g: for pods on an intranet)
+func WithFetchAllowedNetworks(networks []string) Option {
+	return func(cfg *Config) error {
+		cfg.FetchAllowedNetworks = networks
+		cfg.fetchAllowedNetworks = nil
+		for _, network := range networks {
+			if network == "" {
+				continue
+			}
+			if ip := net.ParseIP(network); ip != nil {
+				bits := 8 * len(ip)
+				if ip.To4() != nil {
+					ip, bits = ip.To4(), 32
+				}
+				cfg.fetchAllowedNetworks = append(cfg.fetchAllowedNetworks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+			_, ipnet, err := net.ParseCIDR(network)
+			if err != nil {
+				return fmt.Errorf("error: invalid fetch allowed network %q: %w", network, err)
+			}
+			cfg.fetchAllowedNetworks = append(cfg.fetchAllowedNetworks, ipnet)
+		}
+		return nil
+	}
+}
+
+// WithMaxFetchRedirects sets the maximum number of redirects followed by
+// server-side fetches
+func WithMaxFetchRedirects(n int) Option {
+	return func(cfg *Config) error {
+		cfg.MaxFetchRedirects = n
+		return nil
+	}
+}
+
 // WithBlockedFeeds sets the list of feed uris blocked
 // and prohibited from being fetched by the global feed cache
 func WithBlockedFeeds(blockedFeeds []string) Option {
@@ -28,8 +28,8 @@ const pagesDir = "pages"
 var builtinPages embed.FS
 
 type FrontMatter struct {
-	Title       string
-	Description string
+	Title       string `yaml:"title"`
+	Description string `yaml:"description,omitempty"`
 }
 
 type Page struct {
@@ -39,7 +39,7 @@ type Page struct {
 
 // PageHandler ...
 func (s *Server) PageHandler(name string) httprouter.Handle {
-	pagesBaseDir := filepath.Join(s.config.Data, pagesDir)
+	pagesBaseDir := filepath.Join(s.config().Data, pagesDir)
 
 	pageMutex := &sync.RWMutex{}
 	pageCache := make(map[string]*Page)
@@ -168,3 +168,91 @@ func (s *Server) PageHandler(name string) httprouter.Handle {
 		s.render("page", w, ctx)
 	}
 }
+
+// ManagePagesHandler lists, creates and edits the pod's custom pages
+func (s *Server) ManagePagesHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			ctx.EditPage = &CustomPage{}
+			if page, ok := customPages.Get(r.FormValue("name")); ok {
+				ctx.EditPage = page
+			}
+			ctx.Title = s.tr(ctx, "PageManagePagesTitle")
+			s.render("managePages", w, ctx)
+			return
+		}
+
+		page := &CustomPage{
+			Name:        strings.ToLower(strings.TrimSpace(r.FormValue("name"))),
+			Title:       r.FormValue("title"),
+			Description: r.FormValue("description"),
+			Content:     r.FormValue("content"),
+		}
+
+		if err := ValidatePageName(page.Name); err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorInvalidPageName")
+			s.render("error", w, ctx)
+			return
+		}
+
+		// Pages are served at /<name> when no route matches, a page named
+		// after an existing route would never be shown
+		if _, ok := customPages.Get(page.Name); !ok {
+			if handle, _, _ := s.router.Lookup(http.MethodGet, page.URL()); handle != nil {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorInvalidPageName")
+				s.render("error", w, ctx)
+				return
+			}
+		}
+
+		if err := customPages.Save(page); err != nil {
+			log.WithError(err).Errorf("error saving custom page %s", page.Name)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorSavingPage")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/pages", http.StatusFound)
+	}
+}
+
+// DelPageHandler deletes one of the pod's custom pages
+func (s *Server) DelPageHandler() httprouter.Handle {
+	isAdminUser := IsAdminUserFactory(s.config())
+
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		if !isAdminUser(ctx.User) {
+			ctx.Error = true
+			ctx.Message = "You are not a Pod Owner!"
+			s.render("403", w, ctx)
+			return
+		}
+
+		name := r.FormValue("name")
+		if err := customPages.Delete(name); err != nil {
+			log.WithError(err).Errorf("error deleting custom page %s", name)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorDeletingPage")
+			s.render("error", w, ctx)
+			return
+		}
+
+		http.Redirect(w, r, "/manage/pages", http.StatusFound)
+	}
+}
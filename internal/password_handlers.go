@@ -70,7 +70,7 @@ func (s *Server) ResetPasswordHandler() httprouter.Handle {
 			jwt.SigningMethodHS256,
 			jwt.MapClaims{"username": username, "expiresAt": expiryTime},
 		)
-		tokenString, err := token.SignedString([]byte(s.config.MagicLinkSecret))
+		tokenString, err := token.SignedString([]byte(s.config().MagicLinkSecret))
 		if err != nil {
 			ctx.Error = true
 			ctx.Message = err.Error()
@@ -80,7 +80,7 @@ func (s *Server) ResetPasswordHandler() httprouter.Handle {
 		parts := strings.SplitN(tokenString, ".", 3)
 		tokenCache.Inc(parts[2])
 
-		if err := SendPasswordResetEmail(s.config, user, email, tokenString); err != nil {
+		if err := SendPasswordResetEmail(s.config(), user, email, tokenString); err != nil {
 			log.WithError(err).Errorf("unable to send reset password email to %s", user.Username)
 			ctx.Error = true
 			ctx.Message = err.Error()
@@ -119,7 +119,7 @@ func (s *Server) ResetPasswordMagicLinkHandler() httprouter.Handle {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
 
-			return []byte(s.config.MagicLinkSecret), nil
+			return []byte(s.config().MagicLinkSecret), nil
 		})
 		if err != nil {
 			ctx.Error = true
@@ -188,7 +188,7 @@ func (s *Server) NewPasswordHandler() httprouter.Handle {
 				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 			}
 
-			return []byte(s.config.MagicLinkSecret), nil
+			return []byte(s.config().MagicLinkSecret), nil
 		})
 		if err != nil {
 			ctx.Error = true
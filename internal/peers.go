@@ -0,0 +1,231 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"time"
+)
+
+var (
+	// ErrPeerNotFound is returned when a managed peer is not in the store
+	ErrPeerNotFound = errors.New("error: peer not found")
+
+	// ErrInvalidPeer is returned when the url of a peer is not a valid url of
+	// a pod
+	ErrInvalidPeer = errors.New("error: invalid peer url")
+
+	// ErrInvalidPeerState is returned for unknown states of managed peers
+	ErrInvalidPeerState = errors.New("error: invalid peer state")
+)
+
+// PeerState is the state of a peer managed by the Pod Owner/Operator
+type PeerState string
+
+const (
+	// PeerTrusted peers are manually added peers that never expire
+	PeerTrusted PeerState = "trusted"
+
+	// PeerPinned peers are trusted peers that are always asked for missing
+	// twts (instead of a random subset of peers)
+	PeerPinned PeerState = "pinned"
+
+	// PeerBlocked peers are never peered with, even if discovered
+	PeerBlocked PeerState = "blocked"
+)
+
+// ParsePeerState parses the state of a managed peer
+func ParsePeerState(s string) (PeerState, error) {
+	switch state := PeerState(s); state {
+	case PeerTrusted, PeerPinned, PeerBlocked:
+		return state, nil
+	default:
+		return "", ErrInvalidPeerState
+	}
+}
+
+// ManagedPeer is a peer manually added, pinned or blocked by the Pod
+// Owner/Operator and persisted in the Store
+type ManagedPeer struct {
+	URI     string    `json:"uri"`
+	State   PeerState `json:"state"`
+	AddedBy string    `json:"added_by"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// LoadManagedPeer ...
+func LoadManagedPeer(data []byte) (peer *ManagedPeer, err error) {
+	peer = &ManagedPeer{}
+	if err = json.Unmarshal(data, &peer); err != nil {
+		return nil, err
+	}
+	if _, err := ParsePeerState(string(peer.State)); err != nil {
+		return nil, err
+	}
+	return peer, nil
+}
+
+// Bytes ...
+func (p *ManagedPeer) Bytes() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// NormalizePeerURI returns the base url of a pod given any url of the pod
+func NormalizePeerURI(uri string) (string, error) {
+	u, err := url.Parse(NormalizeURL(uri))
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", ErrInvalidPeer
+	}
+	return fmt.Sprintf("%s://%s", u.Scheme, u.Host), nil
+}
+
+// GetPeerInfo fetches the /info of the pod running at the base url uri
+func GetPeerInfo(conf *Config, uri string) (*Peer, error) {
+	headers := make(http.Header)
+	headers.Set("Accept", "application/json")
+
+	res, err := RequestHTTP(conf, http.MethodGet, uri+"/info", headers)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("non-success HTTP %s response for %s/info", res.Status, uri)
+	}
+
+	if ctype := res.Header.Get("Content-Type"); ctype != "" {
+		mediaType, _, err := mime.ParseMediaType(ctype)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing content type header '%s' for %s/info: %w", ctype, uri, err)
+		}
+		if mediaType != "application/json" {
+			return nil, fmt.Errorf("non-JSON response content type '%s' for %s/info", ctype, uri)
+		}
+	}
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var peer Peer
+	if err := json.Unmarshal(data, &peer); err != nil {
+		return nil, err
+	}
+	peer.URI = uri
+	peer.LastSeen = time.Now()
+	peer.LastUpdated = time.Now()
+
+	return &peer, nil
+}
+
+// SetManagedPeers replaces the peers managed by the Pod Owner/Operator and
+// forgets any blocked peers that were discovered
+func (cache *Cache) SetManagedPeers(peers []*ManagedPeer) {
+	managed := make(map[string]*ManagedPeer, len(peers))
+	for _, peer := range peers {
+		managed[peer.URI] = peer
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.managed = managed
+	for uri, peer := range managed {
+		if peer.State == PeerBlocked {
+			delete(cache.Peers, uri)
+		}
+	}
+}
+
+// GetManagedPeers returns the peers managed by the Pod Owner/Operator
+func (cache *Cache) GetManagedPeers() []*ManagedPeer {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	var peers []*ManagedPeer
+	for _, peer := range cache.managed {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].URI < peers[j].URI })
+
+	return peers
+}
+
+// IsPeerBlocked returns true if the pod at the base url uri is blocked
+func (cache *Cache) IsPeerBlocked(uri string) bool {
+	cache.mu.RLock()
+	defer cache.mu.RUnlock()
+
+	return cache.peerState(uri) == PeerBlocked
+}
+
+func (cache *Cache) peerState(uri string) PeerState {
+	if peer, ok := cache.managed[uri]; ok {
+		return peer.State
+	}
+	return ""
+}
+
+// getPinnedPeers returns the known peers that are pinned
+func (cache *Cache) getPinnedPeers() (peers Peers) {
+	for _, peer := range cache.getPeers() {
+		if cache.peerState(peer.URI) == PeerPinned {
+			peers = append(peers, peer)
+		}
+	}
+	return
+}
+
+// UpdatePeer adds or updates a known peer unless it is blocked
+func (cache *Cache) UpdatePeer(peer *Peer) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.peerState(peer.URI) == PeerBlocked {
+		return
+	}
+	cache.Peers[peer.URI] = peer
+}
+
+// RefreshManagedPeers loads the peers managed by the Pod Owner/Operator from
+// the store and refreshes the /info of trusted and pinned peers so they are
+// known peers even if they were never discovered
+func RefreshManagedPeers(conf *Config, cache *Cache, db Store) error {
+	peers, err := db.GetAllPeers()
+	if err != nil {
+		return err
+	}
+	cache.SetManagedPeers(peers)
+
+	for _, managed := range peers {
+		if managed.State == PeerBlocked || conf.IsLocalURL(managed.URI) {
+			continue
+		}
+
+		cache.mu.RLock()
+		known, ok := cache.Peers[managed.URI]
+		cache.mu.RUnlock()
+		if ok && !known.IsZero() && !known.ShouldRefresh() {
+			continue
+		}
+
+		peer, err := GetPeerInfo(conf, managed.URI)
+		if err != nil {
+			Logger(LogIPP).WithError(err).Warnf("error refreshing /info of managed peer %s", managed.URI)
+			continue
+		}
+		cache.UpdatePeer(peer)
+	}
+
+	return nil
+}
@@ -0,0 +1,40 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizePeerURI(t *testing.T) {
+	for _, uri := range []string{"https://twtxt.net", "https://twtxt.net/", "https://Twtxt.net/user/prologic/twtxt.txt"} {
+		normalized, err := NormalizePeerURI(uri)
+		require.NoError(t, err, uri)
+		assert.Equal(t, "https://twtxt.net", normalized, uri)
+	}
+
+	_, err := NormalizePeerURI("gopher://twtxt.net")
+	assert.ErrorIs(t, err, ErrInvalidPeer)
+}
+
+func TestCache_ManagedPeers(t *testing.T) {
+	cache := NewCache(NewConfig())
+	cache.Peers["https://a.example.com"] = &Peer{URI: "https://a.example.com", Name: "a"}
+	cache.Peers["https://b.example.com"] = &Peer{URI: "https://b.example.com", Name: "b"}
+
+	cache.SetManagedPeers([]*ManagedPeer{
+		{URI: "https://a.example.com", State: PeerPinned},
+		{URI: "https://b.example.com", State: PeerBlocked},
+	})
+
+	assert.True(t, cache.IsPeerBlocked("https://b.example.com"))
+	assert.Len(t, cache.GetPeers(), 1)
+	assert.Len(t, cache.getPinnedPeers(), 1)
+
+	cache.UpdatePeer(&Peer{URI: "https://b.example.com", Name: "b"})
+	assert.Len(t, cache.GetPeers(), 1)
+}
@@ -24,7 +24,7 @@ const (
 
 // PermalinkHandler ...
 func (s *Server) PermalinkHandler() httprouter.Handle {
-	isLocal := IsLocalURLFactory(s.config)
+	isLocal := IsLocalURLFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
@@ -35,7 +35,7 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
-		if len(hash) < types.TwtHashLength {
+		if !IsValidTwtHash(hash) {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
@@ -64,6 +64,24 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 			}
 		}
 
+		// Edited-away twts point to their replacement and deleted twts are
+		// gone even if they are still in the archive
+		history, _ := edits.Get(hash)
+		if history != nil && history.ReplacedBy != "" {
+			http.Redirect(w, r, URLForTwt(s.config().BaseURL, history.ReplacedBy), http.StatusFound)
+			return
+		}
+		if history.Deleted() {
+			if accept.PreferredContentTypeLike(r.Header, "text/html") == "text/html" {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorTwtDeleted")
+				s.render("error", w, ctx)
+			} else {
+				http.Error(w, "Twt was deleted", http.StatusGone)
+			}
+			return
+		}
+
 		if twt == nil || twt.IsZero() {
 			if accept.PreferredContentTypeLike(r.Header, "text/html") == "text/html" {
 				ctx.Error = true
@@ -93,9 +111,9 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 
 		var image string
 		if isLocal(twt.Twter().URI) {
-			image = URLForAvatar(s.config.BaseURL, twt.Twter().Nick, "")
+			image = URLForAvatar(s.config().BaseURL, twt.Twter().Nick, "")
 		} else {
-			image = URLForExternalAvatar(s.config, twt.Twter().URI)
+			image = URLForExternalAvatar(s.config(), twt.Twter().URI)
 		}
 
 		when := twt.Created().Format(time.RFC3339)
@@ -119,7 +137,7 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 
 		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		w.Header().Set("Last-Modified", twt.Created().Format(http.TimeFormat))
-		w.Header().Set("Link", fmt.Sprintf(`<%s/webmention>; rel="webmention"`, s.config.BaseURL))
+		w.Header().Set("Link", fmt.Sprintf(`<%s/webmention>; rel="webmention"`, s.config().BaseURL))
 
 		if r.Method == http.MethodHead {
 			defer r.Body.Close()
@@ -135,10 +153,15 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 			UpdatedAt:   when,
 			Author:      who,
 			Image:       image,
-			URL:         URLForTwt(s.config.BaseURL, hash),
+			URL:         URLForTwt(s.config().BaseURL, hash),
 			Keywords:    strings.Join(ks, ", "),
 		}
-		if strings.HasPrefix(twt.Twter().URI, s.config.BaseURL) {
+		if isLocal(twt.Twter().URI) {
+			if user, err := s.db.GetUser(NormalizeUsername(twt.Twter().Nick)); err == nil {
+				ctx.Meta.NoIndex = !user.IsIndexable()
+			}
+		}
+		if strings.HasPrefix(twt.Twter().URI, s.config().BaseURL) {
 			ctx.Alternatives = append(ctx.Alternatives, Alternatives{
 				Alternative{
 					Type:  "text/plain",
@@ -153,8 +176,22 @@ func (s *Server) PermalinkHandler() httprouter.Handle {
 			}...)
 		}
 
+		if visibility.CanView(s.config(), nil, twt) {
+			ctx.Alternatives = append(ctx.Alternatives, Alternative{
+				Type:  "application/json+oembed",
+				Title: title,
+				URL:   URLForOEmbed(s.config().BaseURL, hash),
+			})
+		}
+
+		if history.Edited() {
+			ctx.TwtHistory = history
+		}
+
+		ctx.WebMentions = receivedWebMentions.ForTwt(hash)
+
 		if r.URL.Query().Get("unfiltered") == "1" {
-			ctx.Twts = types.Twts{twt}
+			ctx.Twts = visibility.Filter(s.config(), ctx.User, types.Twts{twt})
 		} else {
 			ctx.Twts = s.FilterTwts(ctx.User, types.Twts{twt})
 		}
@@ -0,0 +1,199 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+	goplugin "plugin"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+
+	"git.mills.io/yarnsocial/yarn/plugin"
+)
+
+// PluginManager holds the loaded plugins and dispatches hooks to them. A nil
+// *PluginManager is valid and has no plugins.
+type PluginManager struct {
+	plugins []plugin.Plugin
+}
+
+// NewPluginManager returns a PluginManager for the given plugins
+func NewPluginManager(plugins ...plugin.Plugin) *PluginManager {
+	return &PluginManager{plugins: plugins}
+}
+
+// LoadPlugins loads all Go plugins (*.so) found in dir
+func LoadPlugins(dir string) (*PluginManager, error) {
+	m := NewPluginManager()
+
+	if dir == "" {
+		return m, nil
+	}
+
+	fns, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(fns)
+
+	for _, fn := range fns {
+		p, err := loadPlugin(fn)
+		if err != nil {
+			return nil, fmt.Errorf("error loading plugin %s: %w", fn, err)
+		}
+		log.Infof("loaded plugin %s from %s", p.Name(), fn)
+		m.plugins = append(m.plugins, p)
+	}
+
+	return m, nil
+}
+
+func loadPlugin(fn string) (plugin.Plugin, error) {
+	if _, err := os.Stat(fn); err != nil {
+		return nil, err
+	}
+
+	so, err := goplugin.Open(fn)
+	if err != nil {
+		return nil, err
+	}
+
+	sym, err := so.Lookup(plugin.Symbol)
+	if err != nil {
+		return nil, err
+	}
+
+	// Exported variables are looked up as pointers to the variable
+	switch p := sym.(type) {
+	case *plugin.Plugin:
+		return *p, nil
+	case plugin.Plugin:
+		return p, nil
+	default:
+		return nil, fmt.Errorf("symbol %s of type %T does not implement plugin.Plugin", plugin.Symbol, sym)
+	}
+}
+
+// Names returns the names of all loaded plugins
+func (m *PluginManager) Names() []string {
+	if m == nil {
+		return nil
+	}
+
+	var names []string
+	for _, p := range m.plugins {
+		names = append(names, p.Name())
+	}
+	return names
+}
+
+// OnPost runs all post hooks returning the (possibly rewritten) text or an
+// error if any plugin rejected the twt.
+func (m *PluginManager) OnPost(user *User, feed *Feed, text string) (string, error) {
+	if m == nil {
+		return text, nil
+	}
+
+	post := &plugin.Post{Username: user.Username, Text: text}
+	if feed != nil {
+		post.Feed = feed.Name
+	}
+
+	for _, p := range m.plugins {
+		if hook, ok := p.(plugin.PostHook); ok {
+			if err := hook.OnPost(post); err != nil {
+				return "", fmt.Errorf("twt rejected by plugin %s: %w", p.Name(), err)
+			}
+		}
+	}
+
+	return post.Text, nil
+}
+
+// OnFetch runs all fetch hooks over the twts of a fetched feed
+func (m *PluginManager) OnFetch(url string, twts types.Twts) types.Twts {
+	if m == nil {
+		return twts
+	}
+
+	for _, p := range m.plugins {
+		if hook, ok := p.(plugin.FetchHook); ok {
+			twts = hook.OnFetch(url, twts)
+		}
+	}
+
+	return twts
+}
+
+// OnRegister runs all register hooks for a newly registered user
+func (m *PluginManager) OnRegister(user *User) {
+	if m == nil {
+		return
+	}
+
+	account := &plugin.Account{Username: user.Username}
+
+	for _, p := range m.plugins {
+		if hook, ok := p.(plugin.RegisterHook); ok {
+			if err := hook.OnRegister(account); err != nil {
+				log.WithError(err).Warnf("error running register hook of plugin %s for %s", p.Name(), user.Username)
+			}
+		}
+	}
+}
+
+// TemplateFuncs returns the template functions provided by all plugins
+func (m *PluginManager) TemplateFuncs() template.FuncMap {
+	funcs := template.FuncMap{}
+
+	if m == nil {
+		return funcs
+	}
+
+	for _, p := range m.plugins {
+		if hook, ok := p.(plugin.TemplateHook); ok {
+			for name, fn := range hook.TemplateFuncs() {
+				funcs[name] = fn
+			}
+		}
+	}
+
+	return funcs
+}
+
+// Templates returns the template definitions of all extension points with
+// the templates of all plugins concatenated in load order. Every extension
+// point is always defined (empty if no plugin extends it).
+func (m *PluginManager) Templates() string {
+	points := map[string][]string{
+		plugin.Head:   nil,
+		plugin.Footer: nil,
+	}
+
+	if m != nil {
+		for _, p := range m.plugins {
+			if hook, ok := p.(plugin.TemplateHook); ok {
+				for point, tmpl := range hook.Templates() {
+					if _, ok := points[point]; !ok {
+						log.Warnf("plugin %s extends unknown extension point %s", p.Name(), point)
+						continue
+					}
+					points[point] = append(points[point], tmpl)
+				}
+			}
+		}
+	}
+
+	var sb strings.Builder
+	for point, tmpls := range points {
+		fmt.Fprintf(&sb, "{{ define \"plugin_%s\" }}%s{{ end }}", point, strings.Join(tmpls, "\n"))
+	}
+	return sb.String()
+}
@@ -14,11 +14,24 @@ import (
 	"go.yarn.social/types"
 )
 
+// replySubjectRegexp matches twts starting with a subject after any mentions
+var replySubjectRegexp = regexp.MustCompile(`^(@<.*>[, ]*)*(\(.*?\))(.*)`)
+
+// ReplyText prefixes the text of a reply with the subject of the conversation
+// replied to unless the text has a subject already
+func ReplyText(text, reply string) string {
+	reply = strings.TrimSpace(reply)
+	if reply == "" || replySubjectRegexp.MatchString(text) {
+		return text
+	}
+	return fmt.Sprintf("(%s) %s", reply, text)
+}
+
 // PostHandler handles the creation/modification/deletion of a twt.
 //
 // TODO: Support deleting/patching last feed (`postas`) twt too.
 func (s *Server) PostHandler() httprouter.Handle {
-	var appendTwt = AppendTwtFactory(s.config, s.cache, s.db)
+	var appendTwt = AppendTwtFactory(s.config(), s.cache, s.db)
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
 		postAs := strings.ToLower(strings.TrimSpace(r.FormValue("postas")))
 		ctx := NewContext(s, r)
@@ -42,7 +55,7 @@ func (s *Server) PostHandler() httprouter.Handle {
 		// Else, we are editing the last twt; so, delete it and continue.
 		if r.Method == http.MethodDelete || hash != "" {
 			// Retrieve the last twt.
-			lastTwt, _, err = GetLastTwt(s.config, ctx.User)
+			lastTwt, _, err = GetLastTwt(s.config(), ctx.User)
 			if err != nil {
 				ctx.Error = true
 				ctx.Message = s.tr(ctx, "ErrorPostingTwt")
@@ -60,7 +73,7 @@ func (s *Server) PostHandler() httprouter.Handle {
 			}
 
 			// Delete the last twt from persistent memory.
-			if err = DeleteLastTwt(s.config, ctx.User); err != nil {
+			if err = DeleteLastTwt(s.config(), ctx.User); err != nil {
 				ctx.Error = true
 				ctx.Message = s.tr(ctx, "ErrorDeleteLastTwt")
 				s.render("error", w, ctx)
@@ -77,6 +90,17 @@ func (s *Server) PostHandler() httprouter.Handle {
 			for _, feed := range s.cache.Views {
 				feed.Snipe(lastTwt)
 			}
+
+			if r.Method == http.MethodDelete {
+				if err := edits.RecordDelete(lastTwt); err != nil {
+					log.WithError(err).Warnf("error recording deletion of twt %s", lastTwt.Hash())
+				}
+
+				// Let subscribers know so they re-fetch the feed promptly
+				if s.config().Features.IsEnabled(FeatureWebSub) {
+					websub.SendNotification(lastTwt.Twter().URI)
+				}
+			}
 		}
 
 		//
@@ -93,83 +117,105 @@ func (s *Server) PostHandler() httprouter.Handle {
 		}
 
 		// Validate twt reply into twt text.
-		reply := strings.TrimSpace(r.FormValue("reply"))
-		if reply != "" {
-			re := regexp.MustCompile(`^(@<.*>[, ]*)*(\(.*?\))(.*)`)
-			match := re.FindStringSubmatch(text)
-			if match == nil {
-				text = fmt.Sprintf("(%s) %s", reply, text)
-			}
-		}
+		text = ReplyText(text, r.FormValue("reply"))
 
 		var (
-			twt     types.Twt = types.NilTwt
-			feedURL string
+			feed    *Feed
+			feedURL = s.config().URLForUser(ctx.User.Username)
 		)
 
-		// Post the twt.
 		switch postAs {
 		case "", ctx.User.Username:
-			feedURL = s.config.URLForUser(ctx.User.Username)
-
-			if hash != "" && lastTwt.Hash() == hash {
-				twt, err = appendTwt(ctx.User, nil, text, lastTwt.Created())
-			} else {
-				twt, err = appendTwt(ctx.User, nil, text)
-			}
 		default:
-			if ctx.User.OwnsFeed(postAs) {
-				feed, feedErr := s.db.GetFeed(postAs)
-				if feedErr != nil {
-					log.WithError(err).Error("error loading feed object")
-					ctx.Error = true
-					ctx.Message = s.tr(ctx, "ErrorPostingTwt")
-					s.render("error", w, ctx)
-					return
-				}
+			if !ctx.User.OwnsFeed(postAs) {
+				log.WithError(ErrFeedImposter).Error("error posting twt")
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorPostingTwt")
+				s.render("error", w, ctx)
+				return
+			}
 
-				feedURL = s.config.URLForUser(postAs)
-				if hash != "" && lastTwt.Hash() == hash {
-					twt, err = appendTwt(ctx.User, feed, text, lastTwt.Created)
-				} else {
-					twt, err = appendTwt(ctx.User, feed, text)
-				}
-			} else {
-				err = ErrFeedImposter
+			feed, err = s.db.GetFeed(postAs)
+			if err != nil {
+				log.WithError(err).Error("error loading feed object")
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorPostingTwt")
+				s.render("error", w, ctx)
+				return
 			}
+			feedURL = s.config().URLForUser(postAs)
 		}
 
-		if err != nil {
-			log.WithError(err).Error("error posting twt")
-			ctx.Error = true
-			ctx.Message = s.tr(ctx, "ErrorPostingTwt")
-			s.render("error", w, ctx)
-			return
+		var twts types.Twts
+
+		// Post the twt.
+		if hash != "" && lastTwt.Hash() == hash {
+			twt, err := appendTwt(ctx.User, feed, text, lastTwt.Created())
+			if err != nil {
+				log.WithError(err).Error("error posting twt")
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorPostingTwt")
+				s.render("error", w, ctx)
+				return
+			}
+			twts = append(twts, twt)
+
+			// Keep the previous version of an edited twt
+			if err := edits.RecordEdit(lastTwt, twt); err != nil {
+				log.WithError(err).Warnf("error recording edit of twt %s", hash)
+			}
+		} else {
+			// Twts longer than the maximum length are split into a thread
+			// once the user confirms the split in a preview
+			thread, err := SplitTwt(text, s.config().MaxTwtLength, s.config().TwtHashLength)
+			if err != nil {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorTwtTooLong", map[string]interface{}{
+					"MaxLength": s.config().MaxTwtLength,
+					"MaxParts":  maxThreadParts,
+				})
+				s.render("error", w, ctx)
+				return
+			}
+
+			if thread.IsThread() && r.FormValue("thread") != "confirm" {
+				ctx.Title = s.tr(ctx, "PageThreadPreviewTitle")
+				ctx.Thread = thread
+				ctx.ThreadText = text
+				ctx.ThreadPostAs = postAs
+				ctx.ThreadVisibility = r.FormValue("visibility")
+				ctx.Referer = RedirectRefererURL(r, s.config(), "/")
+				s.render("thread", w, ctx)
+				return
+			}
+
+			twts, err = PostThread(appendTwt, ctx.User, feed, thread)
+			if err != nil {
+				log.WithError(err).Error("error posting twt")
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorPostingTwt")
+				s.render("error", w, ctx)
+				return
+			}
 		}
 
+		// WebSub and WebMentions ... (local-only twts never leave the Pod)
+		PublishTwts(s.config(), s.tasks, ctx.User, feedURL, r.FormValue("visibility"), twts...)
+
 		// Update user's own timeline with their own new post.
-		s.cache.InjectFeed(feedURL, twt)
+		for _, twt := range twts {
+			s.cache.InjectFeed(feedURL, twt)
+		}
 
 		// Refresh user views.
 		s.cache.GetByUser(ctx.User, true)
 
-		// WebMentions ...
-		// TODO: Use a queue here instead?
-		if _, err := s.tasks.Dispatch(NewFuncTask(func() error {
-			for _, m := range twt.Mentions() {
-				twter := m.Twter()
-				if !s.config.IsLocalURL(twter.URI) {
-					log.Debugf("queueing outgoing webmention for %s", twter)
-					if err := WebMention(twter.URI, URLForTwt(s.config.BaseURL, twt.Hash())); err != nil {
-						log.WithError(err).Warnf("error sending webmention to %s", twter.URI)
-					}
-				}
-			}
-			return nil
-		})); err != nil {
-			log.WithError(err).Warn("error submitting task for webmentions")
+		// Threads confirmed in their preview return to where they were composed
+		redirectURL := RedirectRefererURL(r, s.config(), "/")
+		if referer := NormalizeURL(r.FormValue("referer")); referer != "" && strings.HasPrefix(referer, s.config().BaseURL) {
+			redirectURL = referer
 		}
 
-		http.Redirect(w, r, RedirectRefererURL(r, s.config, "/"), http.StatusFound)
+		http.Redirect(w, r, redirectURL, http.StatusFound)
 	}
 }
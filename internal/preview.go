@@ -0,0 +1,155 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+// PreviewResponse is the preview of a twt as it would be posted, its text
+// with mentions and tags expanded and rendered as HTML. Twts longer than the
+// maximum length of twts include the thread they would be split into.
+type PreviewResponse struct {
+	Text   string   `json:"text"`
+	HTML   string   `json:"html"`
+	Length int      `json:"length"`
+	Lang   string   `json:"lang,omitempty"`
+	Thread []string `json:"thread,omitempty"`
+}
+
+// PreviewTwtFunc previews the twt of a user, or of one of the user's feeds
+type PreviewTwtFunc func(user *User, feed *Feed, text string) PreviewResponse
+
+// PreviewTwtFactory returns a function that previews twts by expanding and
+// formatting them exactly as they are posted and displayed
+func PreviewTwtFactory(conf *Config, cache *Cache, db Store, archive Archiver) PreviewTwtFunc {
+	expandTwt := ExpandTwtFactory(conf, cache, db)
+	formatTwt := FormatTwtFactory(conf, cache, archive)
+
+	return func(user *User, feed *Feed, text string) PreviewResponse {
+		twt := expandTwt(user, feed, text, time.Now())
+
+		preview := PreviewResponse{
+			Text:   twt.FormatText(types.LiteralFmt, conf),
+			HTML:   string(formatTwt(twt, user)),
+			Length: utf8.RuneCountInString(text),
+			Lang:   DetectTwtLanguage(twt),
+		}
+
+		if thread, err := SplitTwt(text, conf.MaxTwtLength, conf.TwtHashLength); err == nil && thread.IsThread() {
+			preview.Thread = thread.Parts
+		}
+
+		return preview
+	}
+}
+
+// PreviewEndpoint previews a twt as it would be posted
+func (a *API) PreviewEndpoint() httprouter.Handle {
+	previewTwt := PreviewTwtFactory(a.config(), a.cache, a.db, a.archive)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error reading preview request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		req, err := types.NewPostRequest(bytes.NewReader(body))
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error parsing preview request")
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		text := CleanTwt(req.Text)
+		if text == "" {
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		var feed *Feed
+
+		switch req.PostAs {
+		case "", me:
+		default:
+			if !user.OwnsFeed(req.PostAs) {
+				apiError(w, http.StatusUnauthorized, ErrCodeFeedImposter, "You do not own this feed")
+				return
+			}
+			if feed, err = a.db.GetFeed(req.PostAs); err != nil {
+				apiLogger(r).WithError(err).Error("error loading feed object")
+				apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+				return
+			}
+		}
+
+		data, err := json.Marshal(previewTwt(user, feed, text))
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing preview response")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// PreviewHandler previews a twt composed in the post box as it would be
+// posted for the composer's preview
+func (s *Server) PreviewHandler() httprouter.Handle {
+	previewTwt := PreviewTwtFactory(s.config(), s.cache, s.db, s.archive)
+
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		text := CleanTwt(r.FormValue("text"))
+		if text == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		text = ReplyText(text, r.FormValue("reply"))
+
+		var feed *Feed
+
+		postAs := strings.ToLower(strings.TrimSpace(r.FormValue("postas")))
+		if postAs != "" && postAs != ctx.User.Username {
+			if !ctx.User.OwnsFeed(postAs) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+
+			var err error
+			if feed, err = s.db.GetFeed(postAs); err != nil {
+				log.WithError(err).Errorf("error loading feed %s", postAs)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		data, err := json.Marshal(previewTwt(ctx.User, feed, text))
+		if err != nil {
+			log.WithError(err).Error("error serializing preview")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/net/html"
+)
+
+const (
+	// MaxProfileFields is the maximum number of custom profile fields
+	MaxProfileFields = 4
+
+	// maxProfileFieldLength is the maximum length of a profile field's name
+	// or value
+	maxProfileFieldLength = 255
+
+	// maxRelMePageSize is the maximum size of a page parsed for rel=me links
+	maxRelMePageSize = 1 << 20
+)
+
+// ProfileField is a custom name/value field on a user's profile
+type ProfileField struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// URL returns the value of the field if it is an http(s) url
+func (f ProfileField) URL() string {
+	return profileLinkURL(f.Value)
+}
+
+// ProfileDetails are the structured fields of a user's profile and which of
+// the websites listed link back to the profile (See: VerifyRelMe)
+type ProfileDetails struct {
+	Website  string
+	Location string
+	Pronouns string
+	Fields   []ProfileField
+	Verified map[string]bool
+}
+
+// IsVerified returns true if the website links back to the profile
+func (d *ProfileDetails) IsVerified(uri string) bool {
+	return d != nil && d.Verified[uri]
+}
+
+// EditableFields returns the custom fields padded with empty fields up to
+// MaxProfileFields for editing
+func (d *ProfileDetails) EditableFields() []ProfileField {
+	fields := append([]ProfileField{}, d.Fields...)
+	for len(fields) < MaxProfileFields {
+		fields = append(fields, ProfileField{})
+	}
+	return fields
+}
+
+// profileLinkURL returns uri if it is an absolute http(s) url
+func profileLinkURL(uri string) string {
+	u, err := url.Parse(strings.TrimSpace(uri))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ""
+	}
+	return u.String()
+}
+
+// truncateProfileField truncates the name or value of a profile field
+func truncateProfileField(s string) string {
+	s = strings.TrimSpace(s)
+	if r := []rune(s); len(r) > maxProfileFieldLength {
+		return string(r[:maxProfileFieldLength])
+	}
+	return s
+}
+
+// SetProfileFields sets the user's website, location, pronouns and custom
+// fields (fields without a name or value are dropped), the verification of
+// websites no longer listed is forgotten
+func (u *User) SetProfileFields(website, location, pronouns string, fields []ProfileField) {
+	u.Website = profileLinkURL(website)
+	u.Location = truncateProfileField(location)
+	u.Pronouns = truncateProfileField(pronouns)
+
+	u.ProfileFields = nil
+	for _, field := range fields {
+		field.Name = truncateProfileField(field.Name)
+		field.Value = truncateProfileField(field.Value)
+		if field.Name == "" || field.Value == "" {
+			continue
+		}
+		if len(u.ProfileFields) == MaxProfileFields {
+			break
+		}
+		u.ProfileFields = append(u.ProfileFields, field)
+	}
+
+	u.pruneVerifiedLinks()
+}
+
+// pruneVerifiedLinks forgets the verification of websites no longer listed
+// on the user's profile
+func (u *User) pruneVerifiedLinks() {
+	websites := make(map[string]bool)
+	for _, website := range u.Websites() {
+		websites[website] = true
+	}
+	for website := range u.VerifiedLinks {
+		if !websites[website] {
+			delete(u.VerifiedLinks, website)
+		}
+	}
+}
+
+// Websites returns the websites listed on the user's profile (the website,
+// links and fields whose value is an url) whose rel=me backlinks are verified
+func (u *User) Websites() []string {
+	var websites []string
+
+	seen := make(map[string]bool)
+	add := func(uri string) {
+		if uri = profileLinkURL(uri); uri != "" && !seen[uri] {
+			seen[uri] = true
+			websites = append(websites, uri)
+		}
+	}
+
+	add(u.Website)
+	for _, field := range u.ProfileFields {
+		add(field.Value)
+	}
+	for _, link := range StringValues(u.Links) {
+		add(link)
+	}
+
+	return websites
+}
+
+// ProfileDetails returns the structured fields of the user's profile
+func (u *User) ProfileDetails() *ProfileDetails {
+	details := &ProfileDetails{
+		Website:  u.Website,
+		Location: u.Location,
+		Pronouns: u.Pronouns,
+		Fields:   u.ProfileFields,
+		Verified: make(map[string]bool),
+	}
+	for website := range u.VerifiedLinks {
+		details.Verified[website] = true
+	}
+	return details
+}
+
+// relMeURLs returns the urls a rel=me link from a website to the user's
+// profile may point to (the profile, the feed and the short profile url)
+func relMeURLs(conf *Config, username string) map[string]bool {
+	feedURL := URLForUser(conf.BaseURL, username)
+	return map[string]bool{
+		NormalizeURL(feedURL):          true,
+		NormalizeURL(UserURL(feedURL)): true,
+		NormalizeURL(fmt.Sprintf("%s/~%s", strings.TrimSuffix(conf.BaseURL, "/"), username)): true,
+	}
+}
+
+// parseRelMe returns the (absolute) urls of the rel=me links of a page
+func parseRelMe(base *url.URL, r io.Reader) []string {
+	var links []string
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return links
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			if (string(name) != "a" && string(name) != "link") || !hasAttr {
+				continue
+			}
+
+			var href, rel string
+			for {
+				key, val, more := z.TagAttr()
+				switch string(key) {
+				case "href":
+					href = string(val)
+				case "rel":
+					rel = string(val)
+				}
+				if !more {
+					break
+				}
+			}
+
+			isMe := false
+			for _, v := range strings.Fields(strings.ToLower(rel)) {
+				if v == "me" {
+					isMe = true
+				}
+			}
+			if !isMe || href == "" {
+				continue
+			}
+
+			if u, err := base.Parse(href); err == nil {
+				links = append(links, u.String())
+			}
+		}
+	}
+}
+
+// VerifyRelMe returns true if the website links back to the user's profile
+// with a rel=me link
+func VerifyRelMe(conf *Config, username, website string) (bool, error) {
+	res, err := RequestHTTP(conf, http.MethodGet, website, nil)
+	if err != nil {
+		return false, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("error: non-success HTTP %s fetching %s", res.Status, website)
+	}
+
+	profileURLs := relMeURLs(conf, username)
+	for _, link := range parseRelMe(res.Request.URL, io.LimitReader(res.Body, maxRelMePageSize)) {
+		if profileURLs[NormalizeURL(link)] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// VerifyProfileLinks verifies the rel=me backlinks of the websites listed on
+// the user's profile and records the verified ones, the user is reloaded
+// before it is updated as verifying websites can take a while
+func VerifyProfileLinks(conf *Config, db Store, username string) error {
+	user, err := db.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	verified := make(map[string]string)
+	for _, website := range user.Websites() {
+		ok, err := VerifyRelMe(conf, username, website)
+		if err != nil {
+			log.WithError(err).Debugf("error verifying %s for %s", website, username)
+		}
+		if ok {
+			verified[website] = time.Now().Format(time.RFC3339)
+		}
+	}
+
+	user, err = db.GetUser(username)
+	if err != nil {
+		return err
+	}
+
+	user.VerifiedLinks = make(map[string]string)
+	for _, website := range user.Websites() {
+		if verifiedAt, ok := verified[website]; ok {
+			user.VerifiedLinks[website] = verifiedAt
+		}
+	}
+
+	return db.SetUser(username, user)
+}
+
+// verifyProfileLinks verifies the user's websites in the background
+func (s *Server) verifyProfileLinks(ctx context.Context, username string) {
+	if _, err := s.tasks.DispatchFuncWithPriority(ctx, TaskPriorityBackground, func() error {
+		return VerifyProfileLinks(s.config(), s.db, username)
+	}); err != nil {
+		log.WithError(err).Warnf("error submitting task to verify links of %s", username)
+	}
+}
@@ -0,0 +1,48 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRelMe(t *testing.T) {
+	assert := assert.New(t)
+
+	base, _ := url.Parse("https://example.com/about")
+	page := `<html><head><link rel="me" href="https://pod.example/user/alice"></head>
+<body><a href="/contact">Contact</a><a rel="nofollow ME" href="/~alice">me</a></body></html>`
+
+	assert.Equal(
+		[]string{"https://pod.example/user/alice", "https://example.com/~alice"},
+		parseRelMe(base, strings.NewReader(page)),
+	)
+}
+
+func TestSetProfileFields(t *testing.T) {
+	assert := assert.New(t)
+
+	user := NewUser()
+	user.VerifiedLinks["https://old.example.com"] = "2021-01-01T00:00:00Z"
+	user.VerifiedLinks["https://example.com"] = "2021-01-01T00:00:00Z"
+
+	user.SetProfileFields("https://example.com", " Earth ", "they/them", []ProfileField{
+		{Name: "Code", Value: "https://git.example.com/alice"},
+		{Name: "", Value: "dropped"},
+		{Name: "a", Value: "1"}, {Name: "b", Value: "2"}, {Name: "c", Value: "3"}, {Name: "d", Value: "4"},
+	})
+
+	assert.Equal("Earth", user.Location)
+	assert.Len(user.ProfileFields, MaxProfileFields)
+	assert.Equal([]string{"https://example.com", "https://git.example.com/alice"}, user.Websites())
+	assert.Equal(map[string]string{"https://example.com": "2021-01-01T00:00:00Z"}, user.VerifiedLinks)
+
+	user.SetProfileFields("javascript:alert(1)", "", "", nil)
+	assert.Empty(user.Website)
+	assert.Empty(user.VerifiedLinks)
+}
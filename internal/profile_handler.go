@@ -6,6 +6,7 @@ package internal
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"go.yarn.social/types"
 	"github.com/julienschmidt/httprouter"
@@ -39,7 +40,22 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 				s.render("error", w, ctx)
 				return
 			}
-			profile = user.Profile(s.config.BaseURL, ctx.User)
+
+			// Users blocked by the user cannot see their profile
+			if ctx.Authenticated && user.HasBlocked(ctx.User.URL) {
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorUserOrFeedNotFound")
+				s.render("404", w, ctx)
+				return
+			}
+
+			profile = user.Profile(s.config().BaseURL, ctx.User)
+			ctx.ProfileDetails = user.ProfileDetails()
+			ctx.Meta.NoIndex = !user.IsIndexable()
+
+			for _, website := range user.Websites() {
+				ctx.Links = append(ctx.Links, Link{Href: website, Rel: "me"})
+			}
 		} else if s.db.HasFeed(nick) {
 			feed, err := s.db.GetFeed(nick)
 			if err != nil {
@@ -49,7 +65,7 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 				s.render("error", w, ctx)
 				return
 			}
-			profile = feed.Profile(s.config.BaseURL, ctx.User)
+			profile = feed.Profile(s.config().BaseURL, ctx.User)
 		} else {
 			ctx.Error = true
 			ctx.Message = s.tr(ctx, "ErrorUserOrFeedNotFound")
@@ -57,6 +73,8 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 			return
 		}
 
+		ctx.FeedStats = feedStats.Get(s.config(), profile.URI, s.cache.GetByURL(profile.URI))
+
 		followers := s.cache.GetFollowers(profile)
 
 		profile.Followers = followers
@@ -85,7 +103,23 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 			},
 		}...)
 
-		twts := s.FilterTwts(ctx.User, s.cache.GetByURL(profile.URI))
+		var twts types.Twts
+
+		if strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/media") {
+			// Media tab (gallery) of the twts with media of the feed
+			ctx.ProfileTab = "media"
+			twts = s.cache.GetByUserView(ctx.User, mediaViewKey(profile.URI), false)
+		} else {
+			twts = s.cache.GetByURL(profile.URI)
+
+			// Let visitors page back through the full history of local feeds,
+			// twts that are no longer cached are marked as archived
+			if history, err := GetFeedHistory(s.config(), profile.Nick); err == nil {
+				twts = MergeFeedHistory(s.archive, twts, history)
+			}
+		}
+
+		twts = s.FilterTwts(ctx.User, twts)
 
 		if len(twts) > 0 {
 			profile.LastPostedAt = twts[0].Created()
@@ -93,8 +127,10 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 
 		var pagedTwts types.Twts
 
+		lite := isLite(r, ctx)
+
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.twtsPerPage(lite))
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
@@ -109,6 +145,11 @@ func (s *Server) ProfileHandler() httprouter.Handle {
 		ctx.Twts = pagedTwts
 		ctx.Pager = &pager
 
+		if lite {
+			s.renderLite(w, ctx)
+			return
+		}
+
 		s.render("profile", w, ctx)
 	}
 }
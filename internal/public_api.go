@@ -0,0 +1,221 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+	"go.yarn.social/types"
+)
+
+// public wraps the read-only public endpoints which are served without
+// authentication to anyone (including browsers on other origins) only if the
+// Pod Owner/Operator enabled the public API
+func (a *API) public(next httprouter.Handle) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if !a.config().PublicAPI {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "Not Found")
+			return
+		}
+
+		if w.Header().Get("Access-Control-Allow-Origin") == "" {
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		}
+		w.Header().Set("Cache-Control", "public, max-age=60")
+
+		next(w, r, p)
+	}
+}
+
+// writePagedTwts writes the requested page (?p=) of twts visible to
+// anonymous visitors, less local-only twts, as a paged response
+func (a *API) writePagedTwts(w http.ResponseWriter, r *http.Request, twts types.Twts) {
+	twts = visibility.Federated(visibility.Filter(a.config(), nil, twts))
+
+	var pagedTwts types.Twts
+
+	pager := paginator.New(adapter.NewSliceAdapter(twts), a.config().TwtsPerPage)
+	pager.SetPage(SafeParseInt(r.URL.Query().Get("p"), 1))
+
+	if err := pager.Results(&pagedTwts); err != nil {
+		apiLogger(r).WithError(err).Error("error loading twts")
+		apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	res := types.PagedResponse{
+		Twts: pagedTwts,
+		Pager: types.PagerResponse{
+			Current:   pager.Page(),
+			MaxPages:  pager.PageNums(),
+			TotalTwts: pager.Nums(),
+		},
+	}
+
+	body, err := res.Bytes()
+	if err != nil {
+		apiLogger(r).WithError(err).Error("error serializing response")
+		apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+		return
+	}
+
+	if notModified(w, r, bodyETag(body)) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(body)
+}
+
+// lookupTwt returns the twt with the given hash from the cache or archive
+func (a *API) lookupTwt(hash string) (types.Twt, bool) {
+	if twt, ok := a.cache.Lookup(hash); ok {
+		return twt, true
+	}
+	if a.archive.Has(hash) {
+		if twt, err := a.archive.Get(hash); err == nil {
+			return twt, false
+		}
+	}
+	return types.NilTwt, false
+}
+
+// PublicDiscoverEndpoint returns the Pod's Discover timeline
+func (a *API) PublicDiscoverEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		a.writePagedTwts(w, r, RankDiscover(a.config(), nil, a.cache.GetByUserView(nil, discoverViewKey, false)))
+	}
+}
+
+// publicProfile returns the profile of a local user or feed if profiles are
+// open to anonymous visitors
+func (a *API) publicProfile(username string) (types.Profile, bool) {
+	if !a.config().OpenProfiles {
+		return types.Profile{}, false
+	}
+
+	if user, err := a.db.GetUser(username); err == nil {
+		return user.Profile(a.config().BaseURL, nil), true
+	}
+	if feed, err := a.db.GetFeed(username); err == nil {
+		return feed.Profile(a.config().BaseURL, nil), true
+	}
+	return types.Profile{}, false
+}
+
+// PublicProfileEndpoint returns the public profile of a local user or feed
+func (a *API) PublicProfileEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		profile, ok := a.publicProfile(NormalizeUsername(p.ByName("username")))
+		if !ok {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "User/Feed not found")
+			return
+		}
+
+		twter := types.Twter{Nick: profile.Nick, URI: profile.URI}
+		if cachedTwter := a.cache.GetTwter(profile.URI); cachedTwter != nil {
+			twter = *cachedTwter
+		}
+
+		followers := a.cache.GetFollowers(profile)
+		profile.Followers = followers
+		profile.NFollowers = len(followers)
+
+		data, err := json.Marshal(types.ProfileResponse{
+			Profile: profile.AsOldProfile(),
+			Twter:   twter,
+		})
+		if err != nil {
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error", err.Error())
+			return
+		}
+
+		if notModified(w, r, bodyETag(data)) {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
+
+// PublicProfileTwtsEndpoint returns the public twts of a local user or feed
+func (a *API) PublicProfileTwtsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		profile, ok := a.publicProfile(NormalizeUsername(p.ByName("username")))
+		if !ok {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "User/Feed not found")
+			return
+		}
+
+		a.writePagedTwts(w, r, a.cache.GetByURL(profile.URI))
+	}
+}
+
+// PublicProfileMediaEndpoint returns the public twts with media of a local
+// user or feed
+func (a *API) PublicProfileMediaEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		profile, ok := a.publicProfile(NormalizeUsername(p.ByName("username")))
+		if !ok {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "User/Feed not found")
+			return
+		}
+
+		a.writePagedTwts(w, r, a.cache.GetByUserView(nil, mediaViewKey(profile.URI), false))
+	}
+}
+
+// PublicTwtEndpoint returns a single twt by its hash (permalink)
+func (a *API) PublicTwtEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		twt, _ := a.lookupTwt(p.ByName("hash"))
+		if twt.IsZero() || !visibility.CanView(a.config(), nil, twt) {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "Twt Not Found")
+			return
+		}
+
+		a.writePagedTwts(w, r, types.Twts{twt})
+	}
+}
+
+// PublicConversationEndpoint returns the twts of a conversation
+func (a *API) PublicConversationEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		hash := p.ByName("hash")
+
+		twt, inCache := a.lookupTwt(hash)
+		if twt.IsZero() || !visibility.CanView(a.config(), nil, twt) {
+			apiError(w, http.StatusNotFound, ErrCodeNotFound, "Conversation Not Found")
+			return
+		}
+
+		twts := a.cache.GetByUserView(nil, fmt.Sprintf("subject:(#%s)", hash), false)[:]
+		if !inCache {
+			twts = append(twts, twt)
+		}
+		sort.Sort(sort.Reverse(twts))
+
+		a.writePagedTwts(w, r, twts)
+	}
+}
+
+// PublicTagEndpoint returns the twts with a hashtag newest first
+func (a *API) PublicTagEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		tag := NormalizeTag(p.ByName("tag"))
+		if tag == "" {
+			apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+			return
+		}
+
+		a.writePagedTwts(w, r, a.cache.GetByUserView(nil, tagViewKey(tag), false))
+	}
+}
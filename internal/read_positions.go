@@ -0,0 +1,123 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// ReadViewTimeline is the user's timeline
+	ReadViewTimeline = "timeline"
+
+	// ReadViewMentions is the user's mentions
+	ReadViewMentions = "mentions"
+
+	// ReadViewDiscover is the Pod's Discover timeline
+	ReadViewDiscover = "discover"
+)
+
+// IsReadView returns true if a user's read position can be tracked for view
+func IsReadView(view string) bool {
+	switch view {
+	case ReadViewTimeline, ReadViewMentions, ReadViewDiscover:
+		return true
+	default:
+		return false
+	}
+}
+
+// ReadPosition returns the hash of the last twt read by the user in a view
+// (empty if none)
+func (u *User) ReadPosition(view string) string {
+	return u.ReadPositions[view]
+}
+
+// SetReadPosition sets the hash of the last twt read by the user in a view,
+// returns true if the read position changed
+func (u *User) SetReadPosition(view, hash string) bool {
+	if u.ReadPositions == nil {
+		u.ReadPositions = make(map[string]string)
+	}
+	if u.ReadPositions[view] == hash {
+		return false
+	}
+	u.ReadPositions[view] = hash
+	return true
+}
+
+// updateReadPosition shows the unread marker of the first page of a view
+// (the twts before the previous read position are unread) and moves the
+// user's read position to the newest twt, keeping all clients in sync
+func (s *Server) updateReadPosition(ctx *Context, view string, page int) {
+	if !ctx.Authenticated || page != 1 || len(ctx.Twts) == 0 {
+		return
+	}
+
+	user := ctx.User
+	ctx.ReadPosition = user.ReadPosition(view)
+
+	if user.SetReadPosition(view, ctx.Twts[0].Hash()) {
+		if err := s.db.SetUser(user.Username, user); err != nil {
+			log.WithError(err).Warnf("error updating read position of %s for %s", view, user.Username)
+		}
+	}
+}
+
+// ReadPositionRequest sets the last twt read by the user in a view
+type ReadPositionRequest struct {
+	View string `json:"view"`
+	Hash string `json:"hash"`
+}
+
+// ReadPositionsEndpoint returns the user's read positions (the hash of the
+// last twt read by view), or with a POST sets the read position of a view
+func (a *API) ReadPositionsEndpoint() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		user := r.Context().Value(UserContextKey).(*User)
+
+		if r.Method == http.MethodPost {
+			var req ReadPositionRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				apiLogger(r).WithError(err).Error("error parsing read position request")
+				apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Bad Request")
+				return
+			}
+
+			if !IsReadView(req.View) {
+				apiError(w, http.StatusBadRequest, ErrCodeBadRequest, "Invalid View")
+				return
+			}
+
+			if user.SetReadPosition(req.View, req.Hash) {
+				if err := a.db.SetUser(user.Username, user); err != nil {
+					apiLogger(r).WithError(err).Error("error updating user object")
+					apiError(w, http.StatusInternalServerError, ErrCodeInternal, "User Update Failed")
+					return
+				}
+			}
+		}
+
+		positions := make(map[string]string)
+		for view, hash := range user.ReadPositions {
+			if IsReadView(view) {
+				positions[view] = hash
+			}
+		}
+
+		data, err := json.Marshal(positions)
+		if err != nil {
+			apiLogger(r).WithError(err).Error("error serializing read positions")
+			apiError(w, http.StatusInternalServerError, ErrCodeInternal, "Internal Server Error")
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(data)
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+const receivedWebMentionsFile = "webmentions.json"
+
+// maxWebMentionSummary is the maximum length of the summary of a received
+// webmention that is kept
+const maxWebMentionSummary = 280
+
+// WebMentionStatus is the moderation status of a received webmention
+type WebMentionStatus string
+
+const (
+	// WebMentionPending webmentions wait for the user's approval
+	WebMentionPending WebMentionStatus = "pending"
+
+	// WebMentionApproved webmentions are shown on the twt's permalink
+	WebMentionApproved WebMentionStatus = "approved"
+
+	// WebMentionRejected webmentions are kept (so they are not queued again
+	// when sent again) but never shown
+	WebMentionRejected WebMentionStatus = "rejected"
+)
+
+// ErrWebMentionNotFound is returned for an unknown received webmention
+var ErrWebMentionNotFound = errors.New("error: webmention not found")
+
+// ReceivedWebMention is a webmention received from a page (the source)
+// referencing a local twt or user (the target)
+type ReceivedWebMention struct {
+	ID         string           `json:"id"`
+	Source     string           `json:"source"`
+	Target     string           `json:"target"`
+	Username   string           `json:"username"`
+	Twt        string           `json:"twt,omitempty"`
+	Author     string           `json:"author,omitempty"`
+	Summary    string           `json:"summary,omitempty"`
+	Status     WebMentionStatus `json:"status"`
+	ReceivedAt time.Time        `json:"received_at"`
+}
+
+// ReceivedWebMentions records the webmentions received from ordinary web
+// pages (webmentions from other Pods are followed as feeds instead) that
+// users moderate, approved webmentions of twts are shown on their permalinks.
+// It is persisted in the data directory. A nil *ReceivedWebMentions records
+// nothing.
+type ReceivedWebMentions struct {
+	sync.RWMutex
+
+	conf     *Config
+	mentions map[string]*ReceivedWebMention
+}
+
+// NewReceivedWebMentions ...
+func NewReceivedWebMentions(conf *Config) (*ReceivedWebMentions, error) {
+	rw := &ReceivedWebMentions{
+		conf:     conf,
+		mentions: make(map[string]*ReceivedWebMention),
+	}
+
+	data, err := ioutil.ReadFile(rw.filename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return rw, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &rw.mentions); err != nil {
+		return nil, err
+	}
+
+	return rw, nil
+}
+
+func (rw *ReceivedWebMentions) filename() string {
+	return filepath.Join(rw.conf.Data, receivedWebMentionsFile)
+}
+
+func (rw *ReceivedWebMentions) save() error {
+	data, err := json.Marshal(rw.mentions)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(rw.filename(), data, 0644)
+}
+
+// Add records a webmention pending moderation, a webmention received again
+// is updated (keeping its status). Returns true if the webmention is new.
+func (rw *ReceivedWebMentions) Add(m ReceivedWebMention) (bool, error) {
+	if rw == nil {
+		return false, nil
+	}
+
+	m.ID = FastHashString(m.Source + " " + m.Target)
+	m.Summary = strings.TrimSpace(m.Summary)
+	if summary := []rune(m.Summary); len(summary) > maxWebMentionSummary {
+		m.Summary = string(summary[:maxWebMentionSummary]) + "…"
+	}
+
+	rw.Lock()
+	defer rw.Unlock()
+
+	existing, ok := rw.mentions[m.ID]
+	if ok {
+		existing.Author = m.Author
+		existing.Summary = m.Summary
+		return false, rw.save()
+	}
+
+	m.Status = WebMentionPending
+	m.ReceivedAt = time.Now()
+	rw.mentions[m.ID] = &m
+
+	return true, rw.save()
+}
+
+// Moderate sets the status of a webmention received by the user
+func (rw *ReceivedWebMentions) Moderate(username, id string, status WebMentionStatus) error {
+	if rw == nil {
+		return ErrWebMentionNotFound
+	}
+
+	rw.Lock()
+	defer rw.Unlock()
+
+	m, ok := rw.mentions[id]
+	if !ok || m.Username != username {
+		return ErrWebMentionNotFound
+	}
+	m.Status = status
+
+	return rw.save()
+}
+
+// ForUser returns the webmentions received by the user, newest first
+func (rw *ReceivedWebMentions) ForUser(username string) []ReceivedWebMention {
+	return rw.filter(func(m *ReceivedWebMention) bool {
+		return m.Username == username && m.Status != WebMentionRejected
+	}, func(a, b time.Time) bool { return a.After(b) })
+}
+
+// ForTwt returns the approved webmentions of a twt, oldest first
+func (rw *ReceivedWebMentions) ForTwt(hash string) []ReceivedWebMention {
+	return rw.filter(func(m *ReceivedWebMention) bool {
+		return m.Twt == hash && m.Status == WebMentionApproved
+	}, func(a, b time.Time) bool { return a.Before(b) })
+}
+
+func (rw *ReceivedWebMentions) filter(keep func(m *ReceivedWebMention) bool, less func(a, b time.Time) bool) []ReceivedWebMention {
+	if rw == nil {
+		return nil
+	}
+
+	rw.RLock()
+	defer rw.RUnlock()
+
+	var mentions []ReceivedWebMention
+	for _, m := range rw.mentions {
+		if keep(m) {
+			mentions = append(mentions, *m)
+		}
+	}
+
+	sort.Slice(mentions, func(i, j int) bool { return less(mentions[i].ReceivedAt, mentions[j].ReceivedAt) })
+
+	return mentions
+}
+
+// WebMentionsHandler lists the webmentions received by the user for
+// moderation, or with a POST approves, rejects or hides a webmention
+func (s *Server) WebMentionsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Translate(s.translator)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if r.Method == http.MethodPost {
+			id := r.FormValue("id")
+
+			var status WebMentionStatus
+			switch r.FormValue("action") {
+			case "approve":
+				status = WebMentionApproved
+			case "hide":
+				status = WebMentionPending
+			default:
+				status = WebMentionRejected
+			}
+
+			if err := receivedWebMentions.Moderate(user.Username, id, status); err != nil {
+				log.WithError(err).Errorf("error moderating webmention %s for %s", id, user.Username)
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorModeratingWebMention")
+				s.render("error", w, ctx)
+				return
+			}
+
+			http.Redirect(w, r, "/webmentions", http.StatusFound)
+			return
+		}
+
+		ctx.Title = s.tr(ctx, "WebMentionsTitle")
+		ctx.WebMentions = receivedWebMentions.ForUser(user.Username)
+		s.render("webmentions", w, ctx)
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReceivedWebMentions(t *testing.T) {
+	conf := &Config{Data: t.TempDir()}
+
+	rw, err := NewReceivedWebMentions(conf)
+	require.NoError(t, err)
+
+	mention := ReceivedWebMention{
+		Source:   "https://blog.example.com/post",
+		Target:   "https://pod.example.com/twt/abcdefg",
+		Username: "alice",
+		Twt:      "abcdefg",
+		Author:   "Bob",
+	}
+
+	isNew, err := rw.Add(mention)
+	require.NoError(t, err)
+	assert.True(t, isNew)
+
+	// Pending webmentions are not shown on permalinks
+	assert.Empty(t, rw.ForTwt("abcdefg"))
+
+	mentions := rw.ForUser("alice")
+	require.Len(t, mentions, 1)
+	assert.Equal(t, WebMentionPending, mentions[0].Status)
+
+	assert.ErrorIs(t, rw.Moderate("mallory", mentions[0].ID, WebMentionApproved), ErrWebMentionNotFound)
+	require.NoError(t, rw.Moderate("alice", mentions[0].ID, WebMentionApproved))
+	assert.Len(t, rw.ForTwt("abcdefg"), 1)
+
+	// Webmentions received again keep their status and are persisted
+	isNew, err = rw.Add(mention)
+	require.NoError(t, err)
+	assert.False(t, isNew)
+
+	rw, err = NewReceivedWebMentions(conf)
+	require.NoError(t, err)
+	assert.Len(t, rw.ForTwt("abcdefg"), 1)
+
+	require.NoError(t, rw.Moderate("alice", mentions[0].ID, WebMentionRejected))
+	assert.Empty(t, rw.ForTwt("abcdefg"))
+	assert.Empty(t, rw.ForUser("alice"))
+}
@@ -22,7 +22,7 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 		ctx := NewContext(s, r)
 
 		if r.Method == "GET" {
-			if s.config.OpenRegistrations {
+			if s.config().OpenRegistrations {
 				s.render("register", w, ctx)
 			} else {
 				ctx.Error = true
@@ -38,7 +38,7 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 		// XXX: We DO NOT store this! (EVER)
 		email := strings.TrimSpace(r.FormValue("email"))
 
-		if err := ValidateUsername(username); err != nil {
+		if err := s.config().ValidateUsername(username); err != nil {
 			ctx.Error = true
 			trdata := map[string]interface{}{
 				"Error": err.Error(),
@@ -55,7 +55,7 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 			return
 		}
 
-		p := filepath.Join(s.config.Data, feedsDir)
+		p := filepath.Join(s.config().Data, feedsDir)
 		if err := os.MkdirAll(p, 0755); err != nil {
 			log.WithError(err).Error("error creating feeds directory")
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -89,12 +89,13 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 		user.Username = username
 		user.Password = hash
 		user.Recovery = recoveryHash
-		user.URL = URLForUser(s.config.BaseURL, username)
+		user.URL = URLForUser(s.config().BaseURL, username)
 		user.CreatedAt = time.Now()
+		user.OnboardingComplete = false
 
 		// Default Feeds
-		user.Follow(newsSpecialUser, s.config.URLForUser(newsSpecialUser))
-		user.Follow(supportSpecialUser, s.config.URLForUser(supportSpecialUser))
+		user.Follow(newsSpecialUser, s.config().URLForUser(newsSpecialUser))
+		user.Follow(supportSpecialUser, s.config().URLForUser(supportSpecialUser))
 
 		if err := s.db.SetUser(username, user); err != nil {
 			log.WithError(err).Error("error saving user object for new user")
@@ -102,19 +103,21 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 			return
 		}
 
+		plugins.OnRegister(user)
+
 		//
 		// Onboarding: Welcome new User and notify Poderator
 		//
 
-		s.tasks.DispatchFunc(func() error {
-			if err := SendNewUserEmail(s.config, user.Username); err != nil {
+		s.tasks.DispatchFuncWithContext(r.Context(), func() error {
+			if err := SendNewUserEmail(s.config(), user.Username); err != nil {
 				log.WithError(err).Warnf("error notifying admin of new user %s", user.Username)
 				return err
 			}
 			return nil
 		})
-		s.tasks.DispatchFunc(func() error {
-			adminUser, err := s.db.GetUser(s.config.AdminUser)
+		s.tasks.DispatchFuncWithContext(r.Context(), func() error {
+			adminUser, err := s.db.GetUser(s.config().AdminUser)
 			if err != nil {
 				log.WithError(err).Warn("error loading admin user object")
 				return err
@@ -130,8 +133,8 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 			welcomeText := CleanTwt(
 				fmt.Sprintf(
 					"👋 Hello @<%s %s>, welcome to %s, a [Yarn.social](https://yarn.social) Pod! To get started you may want to check out the pod's [Discover](/discover) feed to find users to follow and interact with. To follow new users, use the `⨁ Follow` button on their profile page or use the [Follow](/follow) form and enter a Twtxt URL. You may also find other feeds of interest via [Feeds](/feeds). Welcome! 🤗",
-					user.Username, s.config.URLForUser(user.Username),
-					s.config.Name,
+					user.Username, s.config().URLForUser(user.Username),
+					s.config().Name,
 				),
 			)
 			welcomeTwt, err := s.AppendTwt(adminUser, supportFeed, welcomeText)
@@ -139,7 +142,9 @@ func (s *Server) RegisterHandler() httprouter.Handle {
 				log.WithError(err).Warnf("error posting welcome for %s", user.Username)
 				return err
 			}
-			s.cache.InjectFeed(s.config.URLForUser(supportFeed.Name), welcomeTwt)
+			supportURL := s.config().URLForUser(supportFeed.Name)
+			PublishTwts(s.config(), nil, adminUser, supportURL, string(VisibilityPublic), welcomeTwt)
+			s.cache.InjectFeed(supportURL, welcomeTwt)
 			s.cache.DeleteUserViews(user)
 
 			return nil
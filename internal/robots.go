@@ -6,6 +6,7 @@ package internal
 import (
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 	log "github.com/sirupsen/logrus"
@@ -25,6 +26,7 @@ Allow: /search
 Allow: /external
 Allow: /atom.xml
 Allow: /media
+Allow: /sitemap.xml
 `
 
 // RobotsHandler ...
@@ -39,6 +41,28 @@ func (s *Server) RobotsHandler() httprouter.Handle {
 			return
 		}
 
+		var sb strings.Builder
+		sb.WriteString(text)
+
+		for _, page := range customPages.List() {
+			sb.WriteString(fmt.Sprintf("Allow: %s\n", page.URL()))
+		}
+
+		// Profiles of users who discourage indexing are not allowed
+		users, err := s.db.GetAllUsers()
+		if err != nil {
+			log.WithError(err).Warn("error loading users for robots.txt")
+		}
+		for _, user := range users {
+			if !user.IsIndexable() {
+				sb.WriteString(fmt.Sprintf("Disallow: /user/%s/\n", user.Username))
+			}
+		}
+
+		sb.WriteString(fmt.Sprintf("\nSitemap: %s/sitemap.xml\n", strings.TrimSuffix(s.config().BaseURL, "/")))
+
+		text = sb.String()
+
 		w.Header().Set("Content-Type", "text/plain")
 		w.Header().Set("Content-Length", fmt.Sprintf("%d", len(text)))
 
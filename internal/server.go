@@ -4,7 +4,9 @@
 package internal
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
 	"embed"
 	"errors"
 	"fmt"
@@ -16,6 +18,7 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -24,7 +27,9 @@ import (
 	humanize "github.com/dustin/go-humanize"
 	"github.com/gabstv/merger"
 	"github.com/justinas/nosurf"
+	"github.com/lucas-clemente/quic-go/http3"
 	"github.com/robfig/cron"
+	sync "github.com/sasha-s/go-deadlock"
 	log "github.com/sirupsen/logrus"
 	metricsMiddlewarePrometheus "github.com/slok/go-http-metrics/metrics/prometheus"
 	metricsMiddleware "github.com/slok/go-http-metrics/middleware"
@@ -46,9 +51,23 @@ const (
 )
 
 var (
-	metrics     *observe.Metrics
-	webmentions *indieweb.WebMention
-	websub      *indieweb.WebSub
+	metrics       *observe.Metrics
+	webmentions   *indieweb.WebMention
+	websub        *indieweb.WebSub
+	plugins       *PluginManager
+	emojis        *CustomEmoji
+	announcements *Announcements
+	directory     *FeedDirectory
+	shortLinks    *ShortLinks
+	customPages   *CustomPages
+	edits         *EditHistory
+	visibility    *TwtVisibility
+	graylist      *Graylist
+	audit         *AuditLog
+	apiUsage      = NewAPIUsage()
+	jobRegistry   = NewJobRegistry()
+
+	receivedWebMentions *ReceivedWebMentions
 
 	//go:embed theme
 	builtinThemeFS embed.FS
@@ -61,7 +80,6 @@ func init() {
 // Server ...
 type Server struct {
 	bind    string
-	config  *Config
 	tmplman *TemplateManager
 	router  *Router
 	server  *http.Server
@@ -78,11 +96,27 @@ type Server struct {
 	// Scheduler
 	cron *cron.Cron
 
+	// Config (See: Server.config) which is swapped on reloads
+	liveConfig atomic.Value
+
+	// Serializes reloads (SIGHUP and /manage/reload)
+	reloadMu sync.Mutex
+
+	// Servers of additional listeners (--listen)
+	listeners []*http.Server
+
+	// HTTP/3 server (--tls-http3)
+	http3 *http3.Server
+
 	// Dispatcher
 	tasks *Dispatcher
 
+	// Resolver of nick@domain handles
+	handles *HandleResolver
+
 	// Auth
-	am *auth.Manager
+	am   *auth.Manager
+	csrf *nosurf.CSRFHandler
 
 	// Sessions
 	sc *SessionStore
@@ -97,11 +131,20 @@ type Server struct {
 	// Translator
 	translator *Translator
 
+	// Gateways
+	nntp *NNTPServer
+	xmpp *XMPPBridge
+
 	// Factory Functions
 	AppendTwt  AppendTwtFunc
 	FilterTwts FilterTwtsFunc
 }
 
+// config returns the pod's current config (See: Reload)
+func (s *Server) config() *Config {
+	return s.liveConfig.Load().(*Config)
+}
+
 func (s *Server) render(name string, w http.ResponseWriter, ctx *Context) {
 	//
 	// Update timeline view(s) UpdatedAt timestamps
@@ -155,6 +198,28 @@ func (s *Server) Shutdown(ctx context.Context) error {
 	s.cron.Stop()
 	s.tasks.Stop()
 
+	if s.nntp != nil {
+		if err := s.nntp.Close(); err != nil {
+			log.WithError(err).Warn("error shutting down nntp gateway")
+		}
+	}
+
+	if s.xmpp != nil {
+		s.xmpp.Stop()
+	}
+
+	for _, srv := range s.listeners {
+		if err := srv.Shutdown(ctx); err != nil {
+			log.WithError(err).Warn("error shutting down listener")
+		}
+	}
+
+	if s.http3 != nil {
+		if err := s.http3.Close(); err != nil {
+			log.WithError(err).Warn("error shutting down http/3 server")
+		}
+	}
+
 	if err := s.server.Shutdown(ctx); err != nil {
 		log.WithError(err).Error("error shutting down server")
 		return err
@@ -180,8 +245,17 @@ func (s *Server) Run() (err error) {
 	}()
 
 	sigch := make(chan os.Signal, 1)
-	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM)
+	signal.Notify(sigch, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
 	sig := <-sigch
+	for sig == syscall.SIGHUP {
+		log.Info("Received SIGHUP, reloading pod settings...")
+		if err := s.Reload(); err != nil {
+			log.WithError(err).Error("error reloading pod")
+		} else {
+			log.Info("Successfully reloaded pod settings")
+		}
+		sig = <-sigch
+	}
 	log.Infof("Received signal %s", sig)
 
 	log.Info("Shutting down...")
@@ -200,25 +274,36 @@ func (s *Server) Run() (err error) {
 
 // ListenAndServe ...
 func (s *Server) ListenAndServe() error {
+	if err := s.serveListeners(); err != nil {
+		return err
+	}
+
 	_, port, err := net.SplitHostPort(s.bind)
 	if err != nil {
 		log.WithError(err).Errorf("error parsing bind hostport %s", s.bind)
 		return err
 	}
 
-	useLetsEncrypt := s.config.TLSKey == "" && s.config.TLSCert == ""
+	useLetsEncrypt := s.config().TLSKey == "" && s.config().TLSCert == ""
 
-	if s.config.TLS {
+	if s.config().TLS {
 		if useLetsEncrypt && (port == "443" || port == "https") {
 			log.Info("Setting up Lets Encrypt ...")
 
 			m := &autocert.Manager{
-				Cache:      autocert.DirCache(filepath.Join(s.config.Data, acmeDir)),
+				Cache:      autocert.DirCache(filepath.Join(s.config().Data, acmeDir)),
 				Prompt:     autocert.AcceptTOS,
-				Email:      s.config.AdminEmail,
-				HostPolicy: autocert.HostWhitelist(s.config.baseURL.Hostname()),
+				Email:      s.config().AdminEmail,
+				HostPolicy: autocert.HostWhitelist(s.config().baseURL.Hostname()),
 			}
 			s.server.TLSConfig = m.TLSConfig()
+			if s.config().TLSOCSPStapling {
+				log.Info("Stapling OCSP responses")
+				s.server.TLSConfig.GetCertificate = NewOCSPStapler().GetCertificate(m.GetCertificate)
+			}
+			if s.config().TLSHTTP3 {
+				s.serveHTTP3(s.server.TLSConfig)
+			}
 
 			httpServer := &http.Server{
 				Addr: ":http",
@@ -236,8 +321,29 @@ func (s *Server) ListenAndServe() error {
 
 			return s.server.ListenAndServeTLS("", "")
 		}
-		log.Infof("Setting up TLS (key=%s cert=%s)", s.config.TLSKey, s.config.TLSCert)
-		return s.server.ListenAndServeTLS(s.config.TLSCert, s.config.TLSKey)
+		log.Infof("Setting up TLS (key=%s cert=%s)", s.config().TLSKey, s.config().TLSCert)
+		if s.config().TLSOCSPStapling || s.config().TLSHTTP3 {
+			cert, err := tls.LoadX509KeyPair(s.config().TLSCert, s.config().TLSKey)
+			if err != nil {
+				log.WithError(err).Error("error loading TLS certificate")
+				return err
+			}
+
+			getCertificate := func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+				return &cert, nil
+			}
+			if s.config().TLSOCSPStapling {
+				log.Info("Stapling OCSP responses")
+				getCertificate = NewOCSPStapler().GetCertificate(getCertificate)
+			}
+			s.server.TLSConfig = &tls.Config{GetCertificate: getCertificate}
+
+			if s.config().TLSHTTP3 {
+				s.serveHTTP3(s.server.TLSConfig)
+			}
+			return s.server.ListenAndServeTLS("", "")
+		}
+		return s.server.ListenAndServeTLS(s.config().TLSCert, s.config().TLSKey)
 	}
 	log.Warn("No TLS configured")
 	return s.server.ListenAndServe()
@@ -346,6 +452,30 @@ func (s *Server) setupMetrics() {
 		"Number of missing twts found in the feed cache",
 	)
 
+	// no. of new twts found by fetching feeds
+	metrics.NewCounter(
+		"cache", "new_twts",
+		"Number of new twts found by fetching feeds",
+	)
+
+	// feeds evicted from the cache to stay within its memory budget
+	metrics.NewCounter(
+		"cache", "evictions",
+		"Number of feeds evicted from the feed cache",
+	)
+
+	// estimated memory used by the feed cache
+	metrics.NewGauge(
+		"cache", "memory_bytes",
+		"Estimated memory used by the feed cache in bytes",
+	)
+
+	// feeds failing signature verification
+	metrics.NewCounter(
+		"cache", "tampered",
+		"Number of feed fetches that failed signature verification",
+	)
+
 	// archive size
 	metrics.NewCounter(
 		"archive", "size",
@@ -371,6 +501,23 @@ func (s *Server) setupMetrics() {
 			"commit":       yarn.Commit,
 		}).Set(1)
 
+	// api usage
+	metrics.NewCounterVec(
+		"api", "requests",
+		"Number of API requests by endpoint and client",
+		[]string{"endpoint", "client"},
+	)
+	metrics.NewCounterVec(
+		"api", "errors",
+		"Number of API requests that errored by endpoint and client",
+		[]string{"endpoint", "client"},
+	)
+	// old upload media
+	metrics.NewCounter(
+		"api", "old_upload_media",
+		"Count of media uploads by old clients (Goryon < v1.0.3)",
+	)
+
 	// old avatars
 	metrics.NewCounter(
 		"media", "old_avatar",
@@ -422,6 +569,38 @@ func (s *Server) setupMetrics() {
 			return float64(websub.Stats().Confirmed)
 		},
 	)
+	// websub active subscriptions
+	metrics.NewGaugeFunc(
+		"websub", "active",
+		"Number of confirmed subscriptions with an unexpired lease",
+		func() float64 {
+			return float64(websub.Stats().Active)
+		},
+	)
+	// websub expired subscriptions
+	metrics.NewGaugeFunc(
+		"websub", "expired",
+		"Number of confirmed subscriptions with an expired lease",
+		func() float64 {
+			return float64(websub.Stats().Expired)
+		},
+	)
+	// websub subscription renewals
+	metrics.NewGaugeFunc(
+		"websub", "renewals",
+		"Number of subscription renewals sent",
+		func() float64 {
+			return float64(websub.Stats().Renewals)
+		},
+	)
+	// websub subscription renewal errors
+	metrics.NewGaugeFunc(
+		"websub", "renewal_errors",
+		"Number of subscription renewals that failed to be sent",
+		func() float64 {
+			return float64(websub.Stats().RenewalErrors)
+		},
+	)
 
 	s.AddRoute("GET", "/metrics", metrics.Handler())
 }
@@ -497,11 +676,12 @@ func (s *Server) processWebMention(source, target *url.URL, data *microformats.D
 	var (
 		user      *User
 		userError error
+		hash      string
 	)
 
 	if strings.HasPrefix(target.Path, "/twt/") {
-		hash := strings.TrimPrefix(target.Path, "/twt/")
-		if len(hash) < types.TwtHashLength {
+		hash = strings.TrimPrefix(target.Path, "/twt/")
+		if !IsValidTwtHash(hash) {
 			log.Errorf("invalid twt %s from webmention target %s", hash, target.String())
 			return fmt.Errorf("invalid twt %s from webmention target %s", hash, target.String())
 		}
@@ -529,9 +709,9 @@ func (s *Server) processWebMention(source, target *url.URL, data *microformats.D
 			return fmt.Errorf("invalid twt %s processing webmention from %s", hash, target.String())
 		}
 
-		user, userError = GetUserFromTwter(s.config, s.db, twt.Twter())
+		user, userError = GetUserFromTwter(s.config(), s.db, twt.Twter())
 	} else if strings.HasPrefix(target.Path, "/user/") {
-		user, userError = GetUserFromURL(s.config, s.db, target.String())
+		user, userError = GetUserFromURL(s.config(), s.db, target.String())
 	} else {
 		log.Errorf("unable to process webmention from %s", target.String())
 		return fmt.Errorf("unable to process webmention from %s", target.String())
@@ -550,8 +730,32 @@ func (s *Server) processWebMention(source, target *url.URL, data *microformats.D
 	log.Debugf("summary: %q", summary)
 	log.Debugf("feed: %q", feed)
 
+	// Ignore webmentions from feeds (or sources) blocked by the user
+	if user.HasBlocked(source.String()) || (feed != "" && user.HasBlocked(feed)) {
+		log.Debugf("ignoring webmention from %s blocked by %s", source, user.Username)
+		return nil
+	}
+
 	if feed == "" {
-		adminUser, err := s.db.GetUser(s.config.AdminUser)
+		// Ordinary webmentions are kept for the user to moderate, approved
+		// webmentions of twts are shown on their permalinks
+		isNew, err := receivedWebMentions.Add(ReceivedWebMention{
+			Source:   source.String(),
+			Target:   target.String(),
+			Username: user.Username,
+			Twt:      hash,
+			Author:   name,
+			Summary:  summary,
+		})
+		if err != nil {
+			log.WithError(err).Warnf("error recording webmention from %s", source)
+			return err
+		}
+		if !isNew {
+			return nil
+		}
+
+		adminUser, err := s.db.GetUser(s.config().AdminUser)
 		if err != nil {
 			log.WithError(err).Warn("error loading admin user object")
 			return err
@@ -566,12 +770,14 @@ func (s *Server) processWebMention(source, target *url.URL, data *microformats.D
 		// TODO: Make this configurable?
 		mentionText := fmt.Sprintf(
 			"👋 Hello @<%s %s>, you were web mentioned on %s",
-			user.Username, s.config.URLForUser(user.Username),
+			user.Username, s.config().URLForUser(user.Username),
 			source.String(),
 		)
 
 		mentionText += fmt.Sprintf("\n\n%s", strings.TrimSpace(Indent(summary, "> ")))
 
+		mentionText += fmt.Sprintf("\n\nReview your web mentions at %s/webmentions", s.config().BaseURL)
+
 		mentionText = CleanTwt(mentionText)
 
 		mentionTwt, err := s.AppendTwt(adminUser, supportFeed, mentionText)
@@ -579,8 +785,9 @@ func (s *Server) processWebMention(source, target *url.URL, data *microformats.D
 			log.WithError(err).Warnf("error posting mention for %s", user.Username)
 			return err
 		}
-		s.cache.InjectFeed(s.config.URLForUser(supportFeed.Name), mentionTwt)
-		if user.Follows(s.config.URLForUser(supportFeed.Name)) {
+		PublishTwts(s.config(), nil, adminUser, s.config().URLForUser(supportFeed.Name), string(VisibilityPublic), mentionTwt)
+		s.cache.InjectFeed(s.config().URLForUser(supportFeed.Name), mentionTwt)
+		if user.Follows(s.config().URLForUser(supportFeed.Name)) {
 			s.cache.DeleteUserViews(user)
 		}
 		return nil
@@ -595,7 +802,7 @@ func (s *Server) processWebMention(source, target *url.URL, data *microformats.D
 	if !user.Follows(feed) {
 		sources := make(types.FetchFeedRequests)
 		sources[types.FetchFeedRequest{Nick: name, URL: feed}] = true
-		s.cache.FetchFeeds(s.config, s.archive, sources, nil)
+		s.cache.FetchFeeds(s.config(), s.archive, sources, nil)
 	}
 
 	return nil
@@ -604,21 +811,66 @@ func (s *Server) processWebMention(source, target *url.URL, data *microformats.D
 func (s *Server) setupWebMentions() {
 	webmentions = indieweb.NewWebMention()
 	webmentions.Mention = s.processWebMention
+	webmentions.Client = NewFetchClient(s.config(), s.config().RequestTimeout())
 }
 
-func (s *Server) processNotification(topic string) error {
+func (s *Server) processNotification(topic string, content []byte) error {
 	log.Debugf("received notification for %s", topic)
 
+	if len(content) > 0 {
+		n, err := s.injectNotification(topic, content)
+		if err == nil {
+			log.Debugf("injected %d twts from notification for %s", n, topic)
+			return nil
+		}
+		log.WithError(err).Warnf("error injecting twts from notification for %s, re-fetching", topic)
+	}
+
 	sources := make(types.FetchFeedRequests)
 	sources[types.FetchFeedRequest{Force: true, URL: topic}] = true
-	s.cache.FetchFeeds(s.config, s.archive, sources, nil)
+	s.cache.FetchFeeds(s.config(), s.archive, sources, nil)
 
 	return nil
 }
 
+// injectNotification injects the new twts of a feed sent as the content of a
+// notification (fat ping) into the cache instead of re-fetching the feed
+func (s *Server) injectNotification(topic string, content []byte) (int, error) {
+	twter := s.cache.GetTwter(topic)
+	if twter == nil {
+		return 0, fmt.Errorf("error: feed %s is not cached", topic)
+	}
+
+	tf, err := types.ParseFile(bytes.NewReader(content), twter)
+	if err != nil {
+		return 0, err
+	}
+
+	twts := plugins.OnFetch(topic, tf.Twts())
+	if len(twts) == 0 {
+		return 0, fmt.Errorf("error: no twts in notification")
+	}
+
+	for _, twt := range twts {
+		s.cache.InjectFeed(topic, twt)
+	}
+
+	return len(twts), nil
+}
+
+func (s *Server) setupNNTP() {
+	s.nntp = NewNNTPServer(s.config(), s.cache)
+
+	go func() {
+		if err := s.nntp.ListenAndServe(s.config().NNTPBind); err != nil {
+			log.WithError(err).Error("error running nntp gateway")
+		}
+	}()
+}
+
 func (s *Server) setupWebSub() error {
-	fn := filepath.Join(s.config.Data, "websub.json")
-	endpoint := fmt.Sprintf("%s/websub", s.config.BaseURL)
+	fn := filepath.Join(s.config().Data, "websub.json")
+	endpoint := fmt.Sprintf("%s/websub", s.config().BaseURL)
 
 	websub = indieweb.NewWebSub(fn, endpoint)
 	if err := websub.Load(); err != nil {
@@ -626,6 +878,7 @@ func (s *Server) setupWebSub() error {
 	}
 
 	websub.Notify = s.processNotification
+	websub.Client = NewFetchClient(s.config(), s.config().RequestTimeout())
 	websub.ValidateTopic = func(topic string) bool {
 		u, err := url.Parse(topic)
 		if err != nil {
@@ -633,7 +886,7 @@ func (s *Server) setupWebSub() error {
 			return false
 		}
 
-		if !s.config.IsLocalURL(topic) {
+		if !s.config().IsLocalURL(topic) {
 			log.Debugf("invalid topic %q (not a local url)", topic)
 			return false
 		}
@@ -659,13 +912,13 @@ func (s *Server) setupWebSub() error {
 }
 
 func (s *Server) setupJobs() error {
-	InitJobs(s.config)
+	InitJobs(s.config())
 	for name, jobSpec := range Jobs {
+		job := jobRegistry.Track(name, jobSpec.Schedule, jobSpec.Factory(s.config(), s.cache, s.archive, s.db))
 		if jobSpec.Schedule == "" {
 			continue
 		}
 
-		job := jobSpec.Factory(s.config, s.cache, s.archive, s.db)
 		if err := s.cron.AddJob(jobSpec.Schedule, job); err != nil {
 			return fmt.Errorf("invalid cron schedule for job %s: %v (see https://pkg.go.dev/github.com/robfig/cron)", name, err)
 		}
@@ -675,16 +928,37 @@ func (s *Server) setupJobs() error {
 	return nil
 }
 
+// restartJobs replaces the scheduler of the background jobs, such as after
+// their schedules changed. Jobs already running are left to complete.
+func (s *Server) restartJobs() error {
+	old := s.cron
+
+	s.cron = cron.New()
+	if err := s.setupJobs(); err != nil {
+		s.cron = old
+		return err
+	}
+	s.cron.Start()
+	old.Stop()
+
+	return nil
+}
+
 func (s *Server) runStartupJobs() {
-	Jobs["ActiveUsers"].Factory(s.config, s.cache, s.archive, s.db).Run()
+	Jobs["ActiveUsers"].Factory(s.config(), s.cache, s.archive, s.db).Run()
 
 	time.Sleep(time.Second * 5)
 
 	log.Info("running startup jobs")
-	for name, jobSpec := range StartupJobs {
-		job := jobSpec.Factory(s.config, s.cache, s.archive, s.db)
+	for name := range StartupJobs {
+		job, ok := jobRegistry.Get(name)
+		if !ok {
+			continue
+		}
 		log.Infof("running %s now...", name)
-		job.Run()
+		if err := job.RunNow(); err == ErrJobRunning {
+			log.Warnf("skipping startup job %s already running", name)
+		}
 	}
 
 	// Merge store
@@ -694,30 +968,25 @@ func (s *Server) runStartupJobs() {
 }
 
 func (s *Server) initRoutes() {
-	var (
-		staticDir string
-		staticFS  fs.FS
-		err       error
-	)
+	// Static assets are always served from the currently active theme
+	staticFS := themeFS(s.config().StaticFS)
 
-	if s.config.Theme == "" {
-		staticDir = "./internal/theme/static"
-		staticFS, err = fs.Sub(builtinThemeFS, "theme/static")
-		if err != nil {
-			log.WithError(err).Fatalf("error loading builtin theme static assets")
-		}
-	} else {
-		staticDir = filepath.Join(s.config.Theme, "static")
-		staticFS = os.DirFS(staticDir)
+	customFS, err := fs.Sub(staticFS, "custom")
+	if err != nil {
+		log.Fatal("error getting SubFS for static/custom")
 	}
 
 	// To serve up artbitrary static assets in /path/to/theme/static/custom/...
-	s.router.Static("/custom/*filepath", filepath.Join(staticDir, "custom"))
+	s.router.ServeFiles("/custom/*filepath", http.FS(customFS))
 
-	if s.config.Debug {
-		s.router.ServeFiles("/css/*filepath", http.Dir(filepath.Join(staticDir, "css")))
-		s.router.ServeFiles("/img/*filepath", http.Dir(filepath.Join(staticDir, "img")))
-		s.router.ServeFiles("/js/*filepath", http.Dir(filepath.Join(staticDir, "js")))
+	if s.config().Debug {
+		for _, name := range []string{"css", "img", "js"} {
+			subFS, err := fs.Sub(staticFS, name)
+			if err != nil {
+				log.Fatalf("error getting SubFS for static/%s", name)
+			}
+			s.router.ServeFiles(fmt.Sprintf("/%s/*filepath", name), http.FS(subFS))
+		}
 	} else {
 		cssFS, err := fs.Sub(staticFS, "css")
 		if err != nil {
@@ -759,21 +1028,43 @@ func (s *Server) initRoutes() {
 	s.router.GET("/", httproutermiddleware.Handler("timeline", s.TimelineHandler(), mdlw))
 	s.router.HEAD("/", httproutermiddleware.Handler("timeline", s.TimelineHandler(), mdlw))
 
+	// Command palette and keyboard shortcuts
+	s.router.GET("/actions", httproutermiddleware.Handler("actions", s.ActionsHandler(), mdlw))
+
+	// Lite UI (no JavaScript, minimal CSS)
+	s.router.GET("/lite", httproutermiddleware.Handler("lite_timeline", s.TimelineHandler(), mdlw))
+
 	s.router.GET("/robots.txt", httproutermiddleware.Handler("robots", s.RobotsHandler(), mdlw))
 	s.router.HEAD("/robots.txt", httproutermiddleware.Handler("robots", s.RobotsHandler(), mdlw))
+	s.router.GET("/sitemap.xml", httproutermiddleware.Handler("sitemap", s.SitemapHandler(), mdlw))
+	s.router.HEAD("/sitemap.xml", httproutermiddleware.Handler("sitemap", s.SitemapHandler(), mdlw))
 
 	s.router.GET("/discover", httproutermiddleware.Handler("discover", s.am.MustAuth(s.DiscoverHandler()), mdlw))
 	s.router.GET("/mentions", httproutermiddleware.Handler("mentions", s.am.MustAuth(s.MentionsHandler()), mdlw))
+	s.router.GET("/summary", httproutermiddleware.Handler("summary", s.am.MustAuth(s.SummaryHandler()), mdlw))
 	s.router.GET("/search", httproutermiddleware.Handler("search", s.SearchHandler(), mdlw))
 
+	s.router.GET("/tag/:tag", httproutermiddleware.Handler("tag", s.TagHandler(), mdlw))
+	s.router.HEAD("/tag/:tag/atom.xml", httproutermiddleware.Handler("tag_atom", s.TagAtomHandler(), mdlw))
+	s.router.GET("/tag/:tag/atom.xml", httproutermiddleware.Handler("tag_atom", s.TagAtomHandler(), mdlw))
+
 	s.router.HEAD("/twt/:hash", httproutermiddleware.Handler("twt", s.PermalinkHandler(), mdlw))
 	s.router.GET("/twt/:hash", httproutermiddleware.Handler("twt", s.PermalinkHandler(), mdlw))
+	s.router.HEAD("/twt/:hash/embed", httproutermiddleware.Handler("twt_embed", s.EmbedHandler(), mdlw))
+	s.router.GET("/twt/:hash/embed", httproutermiddleware.Handler("twt_embed", s.EmbedHandler(), mdlw))
+	s.router.GET("/oembed", httproutermiddleware.Handler("oembed", s.OEmbedHandler(), mdlw))
 
 	s.router.GET("/bookmark/:hash", httproutermiddleware.Handler("bookmark", s.am.MustAuth(s.BookmarkHandler()), mdlw))
 	s.router.POST("/bookmark/:hash", httproutermiddleware.Handler("bookmark", s.am.MustAuth(s.BookmarkHandler()), mdlw))
+	s.router.POST("/bookmark/:hash/details", httproutermiddleware.Handler("bookmark_details", s.am.MustAuth(s.BookmarkDetailsHandler()), mdlw))
+	s.router.POST("/announcement/:id/dismiss", httproutermiddleware.Handler("dismiss_announcement", s.am.MustAuth(s.DismissAnnouncementHandler()), mdlw))
 
 	s.router.HEAD("/conv/:hash", httproutermiddleware.Handler("conv", s.ConversationHandler(), mdlw))
 	s.router.GET("/conv/:hash", httproutermiddleware.Handler("conv", s.ConversationHandler(), mdlw))
+	s.router.HEAD("/conv/:hash/atom.xml", httproutermiddleware.Handler("conv_atom", s.ConversationAtomHandler(), mdlw))
+	s.router.GET("/conv/:hash/atom.xml", httproutermiddleware.Handler("conv_atom", s.ConversationAtomHandler(), mdlw))
+	s.router.POST("/conv/:hash/mute", httproutermiddleware.Handler("conv_mute", s.am.MustAuth(s.MuteConversationHandler()), mdlw))
+	s.router.POST("/conv/:hash/watch", httproutermiddleware.Handler("conv_watch", s.am.MustAuth(s.WatchConversationHandler()), mdlw))
 
 	s.router.GET("/feeds", httproutermiddleware.Handler("feeds", s.am.MustAuth(s.FeedsHandler()), mdlw))
 	s.router.POST("/feed", httproutermiddleware.Handler("feeds", s.am.MustAuth(s.FeedHandler()), mdlw))
@@ -781,27 +1072,44 @@ func (s *Server) initRoutes() {
 	s.router.POST("/post", httproutermiddleware.Handler("post", s.am.MustAuth(s.PostHandler()), mdlw))
 	s.router.PATCH("/post", httproutermiddleware.Handler("post", s.am.MustAuth(s.PostHandler()), mdlw))
 	s.router.DELETE("/post", httproutermiddleware.Handler("post", s.am.MustAuth(s.PostHandler()), mdlw))
+	s.router.POST("/preview", httproutermiddleware.Handler("preview", s.am.MustAuth(s.PreviewHandler()), mdlw))
+
+	s.router.GET("/l/:id", httproutermiddleware.Handler("short_link", s.ShortLinkHandler(), mdlw))
 
 	// TODO: Figure out how to internally rewrite/proxy /~:nick -> /user/:nick
 
 	// XXX: HEAD is always exposed for IndieAuth Authorization Discovery
 	s.router.HEAD("/user/:nick", s.ProfileHandler())
 
-	if s.config.OpenProfiles {
+	if s.config().OpenProfiles {
 		s.router.GET("/user/:nick/", httproutermiddleware.Handler("user", s.ProfileHandler(), mdlw))
 		s.router.GET("/user/:nick/config.yaml", httproutermiddleware.Handler("user_config", s.UserConfigHandler(), mdlw))
+		s.router.GET("/lite/user/:nick", httproutermiddleware.Handler("lite_user", s.ProfileHandler(), mdlw))
+		s.router.GET("/user/:nick/media", httproutermiddleware.Handler("user_media", s.ProfileHandler(), mdlw))
 	} else {
 		s.router.GET("/user/:nick/", httproutermiddleware.Handler("user", s.am.MustAuth(s.ProfileHandler()), mdlw))
 		s.router.GET("/user/:nick/config.yaml", httproutermiddleware.Handler("user_config", s.am.MustAuth(s.UserConfigHandler()), mdlw))
+		s.router.GET("/lite/user/:nick", httproutermiddleware.Handler("lite_user", s.am.MustAuth(s.ProfileHandler()), mdlw))
+		s.router.GET("/user/:nick/media", httproutermiddleware.Handler("user_media", s.am.MustAuth(s.ProfileHandler()), mdlw))
 	}
+	s.router.GET("/branding/:variant", httproutermiddleware.Handler("branding", s.BrandingHandler(), mdlw))
+	s.router.HEAD("/branding/:variant", httproutermiddleware.Handler("branding", s.BrandingHandler(), mdlw))
+
 	s.router.GET("/user/:nick/avatar", httproutermiddleware.Handler("avatar", s.AvatarHandler(), mdlw))
 	s.router.HEAD("/user/:nick/avatar", httproutermiddleware.Handler("avatar", s.AvatarHandler(), mdlw))
 	s.router.HEAD("/user/:nick/twtxt.txt", httproutermiddleware.Handler("twtxt", s.TwtxtHandler(), mdlw))
 	s.router.GET("/user/:nick/twtxt.txt", httproutermiddleware.Handler("twtxt", s.TwtxtHandler(), mdlw))
+	s.router.GET("/user/:nick/archive/:id", httproutermiddleware.Handler("twtxt_archive", s.FeedArchiveHandler(), mdlw))
 	s.router.GET("/user/:nick/followers", httproutermiddleware.Handler("followers", s.FollowersHandler(), mdlw))
 	s.router.GET("/user/:nick/following", httproutermiddleware.Handler("following", s.FollowingHandler(), mdlw))
 	s.router.GET("/user/:nick/bookmarks", httproutermiddleware.Handler("bookmarks", s.BookmarksHandler(), mdlw))
 
+	// Private read-only feeds (See: User.FeedToken)
+	s.router.HEAD("/user/:nick/timeline.xml", httproutermiddleware.Handler("private_timeline_feed", s.PrivateTimelineFeedHandler(), mdlw))
+	s.router.GET("/user/:nick/timeline.xml", httproutermiddleware.Handler("private_timeline_feed", s.PrivateTimelineFeedHandler(), mdlw))
+	s.router.HEAD("/user/:nick/bookmarks.xml", httproutermiddleware.Handler("private_bookmarks_feed", s.PrivateBookmarksFeedHandler(), mdlw))
+	s.router.GET("/user/:nick/bookmarks.xml", httproutermiddleware.Handler("private_bookmarks_feed", s.PrivateBookmarksFeedHandler(), mdlw))
+
 	// WebMentions
 	s.router.POST("/webmention", httproutermiddleware.Handler("webmentions", s.WebMentionHandler(), mdlw))
 
@@ -815,7 +1123,7 @@ func (s *Server) initRoutes() {
 	s.router.HEAD("/user/:nick/atom.xml", httproutermiddleware.Handler("user_atom", s.SyndicationHandler(), mdlw))
 	s.router.GET("/user/:nick/atom.xml", httproutermiddleware.Handler("user_atom", s.SyndicationHandler(), mdlw))
 
-	if s.config.OpenProfiles {
+	if s.config().OpenProfiles {
 		s.router.GET("/~:nick/", httproutermiddleware.Handler("user", s.ProfileHandler(), mdlw))
 		s.router.GET("/~:nick/config.yaml", httproutermiddleware.Handler("user_config", s.UserConfigHandler(), mdlw))
 	} else {
@@ -837,7 +1145,20 @@ func (s *Server) initRoutes() {
 	// IndieAuth  Authorization Endpoint
 	s.router.GET("/indieauth/auth", httproutermiddleware.Handler("indieauth_auth", s.am.MustAuth(s.IndieAuthHandler()), mdlw))
 	s.router.POST("/indieauth/auth", httproutermiddleware.Handler("indieauth_verify", s.IndieAuthVerifyHandler(), mdlw))
-	s.router.GET("/indieauth/callback", httproutermiddleware.Handler("indieauth_callback", s.am.MustAuth(s.IndieAuthCallbackHandler()), mdlw))
+	s.router.POST("/indieauth/callback", httproutermiddleware.Handler("indieauth_callback", s.am.MustAuth(s.IndieAuthCallbackHandler()), mdlw))
+
+	// IndieAuth Token Endpoint
+	s.router.GET("/indieauth/token", httproutermiddleware.Handler("indieauth_token", s.IndieAuthTokenHandler(), mdlw))
+	s.router.POST("/indieauth/token", httproutermiddleware.Handler("indieauth_token", s.IndieAuthTokenHandler(), mdlw))
+
+	// Micropub
+	s.router.GET("/micropub", httproutermiddleware.Handler("micropub", s.MicropubHandler(), mdlw))
+	s.router.POST("/micropub", httproutermiddleware.Handler("micropub", s.MicropubHandler(), mdlw))
+	s.router.POST("/micropub/media", httproutermiddleware.Handler("micropub_media", s.MicropubMediaHandler(), mdlw))
+
+	// Microsub
+	s.router.GET("/microsub", httproutermiddleware.Handler("microsub", s.MicrosubHandler(), mdlw))
+	s.router.POST("/microsub", httproutermiddleware.Handler("microsub", s.MicrosubHandler(), mdlw))
 
 	// External Feeds
 	s.router.GET("/external", httproutermiddleware.Handler("external", s.ExternalHandler(), mdlw))
@@ -845,6 +1166,9 @@ func (s *Server) initRoutes() {
 	s.router.GET("/externalAvatar", httproutermiddleware.Handler("external_avatar", s.ExternalAvatarHandler(), mdlw))
 	s.router.HEAD("/externalAvatar", httproutermiddleware.Handler("external_avatar", s.ExternalAvatarHandler(), mdlw))
 
+	s.router.GET("/proxy", httproutermiddleware.Handler("proxy", s.ProxyHandler(), mdlw))
+	s.router.HEAD("/proxy", httproutermiddleware.Handler("proxy", s.ProxyHandler(), mdlw))
+
 	// External Queries (protected by a short-lived token)
 	s.router.GET("/whoFollows", httproutermiddleware.Handler("whoFollows", s.WhoFollowsHandler(), mdlw))
 
@@ -855,6 +1179,8 @@ func (s *Server) initRoutes() {
 	s.router.GET("/feed/:name/manage", httproutermiddleware.Handler("feed_manage", s.am.MustAuth(s.ManageFeedHandler()), mdlw))
 	s.router.POST("/feed/:name/manage", httproutermiddleware.Handler("feed_manage", s.am.MustAuth(s.ManageFeedHandler()), mdlw))
 	s.router.POST("/feed/:name/delete", httproutermiddleware.Handler("feed_delete", s.am.MustAuth(s.DeleteFeedHandler()), mdlw))
+	s.router.POST("/feed/:name/token", httproutermiddleware.Handler("feed_token", s.am.MustAuth(s.ManageFeedTokenHandler()), mdlw))
+	s.router.POST("/feed/:name/post", httproutermiddleware.Handler("feed_post", s.BotPostHandler(), mdlw))
 
 	s.router.GET("/login", httproutermiddleware.Handler("login", s.am.HasAuth(s.LoginHandler()), mdlw))
 	s.router.POST("/login", httproutermiddleware.Handler("login", s.LoginHandler(), mdlw))
@@ -864,6 +1190,9 @@ func (s *Server) initRoutes() {
 	s.router.GET("/magiclinkauth", httproutermiddleware.Handler("magiclinkauth", s.MagicLinkAuthHandler(), mdlw))
 
 	s.router.GET("/logout", httproutermiddleware.Handler("logout", s.LogoutHandler(), mdlw))
+	s.router.GET("/accounts", httproutermiddleware.Handler("accounts", s.am.MustAuth(s.AccountsHandler()), mdlw))
+	s.router.GET("/accounts/add", httproutermiddleware.Handler("accounts_add", s.am.MustAuth(s.AddAccountHandler()), mdlw))
+	s.router.POST("/accounts/switch", httproutermiddleware.Handler("accounts_switch", s.am.MustAuth(s.SwitchAccountHandler()), mdlw))
 	s.router.POST("/logout", httproutermiddleware.Handler("logout", s.LogoutHandler(), mdlw))
 
 	s.router.GET("/register", httproutermiddleware.Handler("register", s.am.HasAuth(s.RegisterHandler()), mdlw))
@@ -878,6 +1207,9 @@ func (s *Server) initRoutes() {
 	// Media Handling
 	s.router.GET("/media/:name", httproutermiddleware.Handler("media", s.MediaHandler(), mdlw))
 	s.router.HEAD("/media/:name", httproutermiddleware.Handler("media", s.MediaHandler(), mdlw))
+
+	s.router.GET("/emoji/:name", httproutermiddleware.Handler("emoji", s.EmojiHandler(), mdlw))
+	s.router.HEAD("/emoji/:name", httproutermiddleware.Handler("emoji", s.EmojiHandler(), mdlw))
 	s.router.POST("/upload", httproutermiddleware.Handler("upload", s.am.MustAuth(s.UploadMediaHandler()), mdlw))
 
 	// Task State
@@ -889,6 +1221,8 @@ func (s *Server) initRoutes() {
 	s.router.GET("/follow", httproutermiddleware.Handler("follow", s.am.MustAuth(s.FollowHandler()), mdlw))
 	s.router.POST("/follow", httproutermiddleware.Handler("follow", s.am.MustAuth(s.FollowHandler()), mdlw))
 
+	s.router.GET("/remote-follow", httproutermiddleware.Handler("remote_follow", s.RemoteFollowHandler(), mdlw))
+
 	s.router.GET("/import", httproutermiddleware.Handler("import", s.am.MustAuth(s.ImportHandler()), mdlw))
 	s.router.POST("/import", httproutermiddleware.Handler("import", s.am.MustAuth(s.ImportHandler()), mdlw))
 
@@ -897,7 +1231,16 @@ func (s *Server) initRoutes() {
 
 	s.router.GET("/mute", httproutermiddleware.Handler("mute", s.am.MustAuth(s.MuteHandler()), mdlw))
 	s.router.POST("/mute", httproutermiddleware.Handler("mute", s.am.MustAuth(s.MuteHandler()), mdlw))
+	s.router.GET("/feed-health", httproutermiddleware.Handler("feed_health", s.am.MustAuth(s.FeedHealthHandler()), mdlw))
+
+	s.router.GET("/webmentions", httproutermiddleware.Handler("received_webmentions", s.am.MustAuth(s.WebMentionsHandler()), mdlw))
+	s.router.POST("/webmentions", httproutermiddleware.Handler("received_webmentions", s.am.MustAuth(s.WebMentionsHandler()), mdlw))
+	s.router.GET("/follow-requests", httproutermiddleware.Handler("follow_requests", s.am.MustAuth(s.FollowRequestsHandler()), mdlw))
+	s.router.POST("/follow-requests", httproutermiddleware.Handler("follow_requests", s.am.MustAuth(s.FollowRequestHandler()), mdlw))
+	s.router.GET("/connections", httproutermiddleware.Handler("connections", s.am.MustAuth(s.ConnectionsHandler()), mdlw))
 	s.router.GET("/muted", httproutermiddleware.Handler("muted", s.am.MustAuth(s.MutedHandler()), mdlw))
+	s.router.POST("/block", httproutermiddleware.Handler("block", s.am.MustAuth(s.BlockHandler()), mdlw))
+	s.router.POST("/unblock", httproutermiddleware.Handler("unblock", s.am.MustAuth(s.UnblockHandler()), mdlw))
 	s.router.GET("/unmute", httproutermiddleware.Handler("unmute", s.am.MustAuth(s.UnmuteHandler()), mdlw))
 	s.router.POST("/unmute", httproutermiddleware.Handler("unmute", s.am.MustAuth(s.UnmuteHandler()), mdlw))
 
@@ -906,27 +1249,61 @@ func (s *Server) initRoutes() {
 	s.router.GET("/unmute/:hash", httproutermiddleware.Handler("unmute", s.am.MustAuth(s.UnmuteHandler()), mdlw))
 	s.router.POST("/unmute/:hash", httproutermiddleware.Handler("unmute", s.am.MustAuth(s.UnmuteHandler()), mdlw))
 
+	s.router.GET("/onboarding", httproutermiddleware.Handler("onboarding", s.am.MustAuth(s.OnboardingHandler()), mdlw))
+	s.router.POST("/onboarding", httproutermiddleware.Handler("onboarding", s.am.MustAuth(s.OnboardingHandler()), mdlw))
+	s.router.POST("/onboarding/skip", httproutermiddleware.Handler("onboarding_skip", s.am.MustAuth(s.SkipOnboardingHandler()), mdlw))
+
 	s.router.GET("/settings", httproutermiddleware.Handler("settings", s.am.MustAuth(s.SettingsHandler()), mdlw))
 	s.router.POST("/settings", httproutermiddleware.Handler("settings", s.am.MustAuth(s.SettingsHandler()), mdlw))
 	s.router.POST("/settings/addlink", httproutermiddleware.Handler("settings_addlink", s.am.MustAuth(s.SettingsAddLinkHandler()), mdlw))
 	s.router.POST("/settings/removelink", httproutermiddleware.Handler("settings_removelink", s.am.MustAuth(s.SettingsRemoveLinkHandler()), mdlw))
+	s.router.GET("/settings/export-opml", httproutermiddleware.Handler("settings_export_opml", s.am.MustAuth(s.ExportOPMLHandler()), mdlw))
+	s.router.POST("/settings/regenerate-avatar", httproutermiddleware.Handler("settings_regenerate_avatar", s.am.MustAuth(s.SettingsRegenerateAvatarHandler()), mdlw))
+	s.router.POST("/settings/postbyemail", httproutermiddleware.Handler("settings_postbyemail", s.am.MustAuth(s.SettingsPostByEmailHandler()), mdlw))
+	s.router.POST("/settings/feedtoken", httproutermiddleware.Handler("settings_feedtoken", s.am.MustAuth(s.SettingsFeedTokenHandler()), mdlw))
+	s.router.POST("/settings/signing-key", httproutermiddleware.Handler("settings_signing_key", s.am.MustAuth(s.SettingsSigningKeyHandler()), mdlw))
+
+	// Post by Email (Inbound Mail)
+	s.router.POST("/mail/inbound", httproutermiddleware.Handler("mail_inbound", s.InboundMailHandler(), mdlw))
 
 	s.router.GET("/info", httproutermiddleware.Handler("info", s.PodInfoHandler(), mdlw))
 	s.router.GET("/config", httproutermiddleware.Handler("config", s.am.MustAuth(s.PodConfigHandler()), mdlw))
 	s.router.GET("/manage/pod", httproutermiddleware.Handler("manage_pod", s.am.MustAuth(s.ManagePodHandler()), mdlw))
 	s.router.GET("/manage/jobs", httproutermiddleware.Handler("manage_jobs", s.am.MustAuth(s.ManageJobsHandler()), mdlw))
 	s.router.POST("/manage/jobs", httproutermiddleware.Handler("manage_jobs", s.am.MustAuth(s.ManageJobsHandler()), mdlw))
+	s.router.POST("/manage/tasks", httproutermiddleware.Handler("manage_tasks", s.am.MustAuth(s.ManageTasksHandler()), mdlw))
 	s.router.GET("/manage/peers", httproutermiddleware.Handler("manage_peers", s.am.MustAuth(s.ManagePeersHandler()), mdlw))
+	s.router.POST("/manage/peers", httproutermiddleware.Handler("manage_peers", s.am.MustAuth(s.ManagePeersHandler()), mdlw))
+	s.router.GET("/manage/graylist", httproutermiddleware.Handler("manage_graylist", s.am.MustAuth(s.ManageGraylistHandler()), mdlw))
+	s.router.POST("/manage/graylist", httproutermiddleware.Handler("manage_graylist", s.am.MustAuth(s.ManageGraylistHandler()), mdlw))
+	s.router.GET("/manage/export", httproutermiddleware.Handler("manage_export", s.am.MustAuth(s.ExportHandler()), mdlw))
+	s.router.GET("/manage/stats", httproutermiddleware.Handler("manage_stats", s.am.MustAuth(s.ManageStatsHandler()), mdlw))
+	s.router.GET("/manage/emoji", httproutermiddleware.Handler("manage_emoji", s.am.MustAuth(s.ManageEmojiHandler()), mdlw))
+	s.router.POST("/manage/emoji", httproutermiddleware.Handler("manage_emoji", s.am.MustAuth(s.ManageEmojiHandler()), mdlw))
+	s.router.POST("/manage/delemoji", httproutermiddleware.Handler("delemoji", s.am.MustAuth(s.DelEmojiHandler()), mdlw))
+	s.router.GET("/manage/announcements", httproutermiddleware.Handler("manage_announcements", s.am.MustAuth(s.ManageAnnouncementsHandler()), mdlw))
+	s.router.POST("/manage/announcements", httproutermiddleware.Handler("manage_announcements", s.am.MustAuth(s.ManageAnnouncementsHandler()), mdlw))
+	s.router.POST("/manage/delannouncement", httproutermiddleware.Handler("delannouncement", s.am.MustAuth(s.DelAnnouncementHandler()), mdlw))
+	s.router.GET("/manage/directory", httproutermiddleware.Handler("manage_directory", s.am.MustAuth(s.ManageDirectoryHandler()), mdlw))
+	s.router.POST("/manage/directory", httproutermiddleware.Handler("manage_directory", s.am.MustAuth(s.ManageDirectoryHandler()), mdlw))
+	s.router.POST("/manage/deldirectoryfeed", httproutermiddleware.Handler("deldirectoryfeed", s.am.MustAuth(s.DelDirectoryFeedHandler()), mdlw))
+	s.router.GET("/manage/pages", httproutermiddleware.Handler("manage_pages", s.am.MustAuth(s.ManagePagesHandler()), mdlw))
+	s.router.POST("/manage/pages", httproutermiddleware.Handler("manage_pages", s.am.MustAuth(s.ManagePagesHandler()), mdlw))
+	s.router.POST("/manage/delpage", httproutermiddleware.Handler("delpage", s.am.MustAuth(s.DelPageHandler()), mdlw))
 	s.router.POST("/manage/pod", httproutermiddleware.Handler("manage_pod", s.am.MustAuth(s.ManagePodHandler()), mdlw))
 	s.router.GET("/manage/refreshcache", httproutermiddleware.Handler("manage_refreshcache", s.am.MustAuth(s.RefreshCacheHandler()), mdlw))
+	s.router.POST("/manage/reload", httproutermiddleware.Handler("manage_reload", s.am.MustAuth(s.ReloadHandler()), mdlw))
 
 	s.router.GET("/manage/users", httproutermiddleware.Handler("manager_users", s.am.MustAuth(s.ManageUsersHandler()), mdlw))
 	s.router.POST("/manage/adduser", httproutermiddleware.Handler("adduser", s.am.MustAuth(s.AddUserHandler()), mdlw))
 	s.router.POST("/manage/delfeed", httproutermiddleware.Handler("delfeed", s.am.MustAuth(s.DelFeedHandler()), mdlw))
 	s.router.POST("/manage/deluser", httproutermiddleware.Handler("deluser", s.am.MustAuth(s.DelUserHandler()), mdlw))
+	s.router.POST("/manage/userstate", httproutermiddleware.Handler("userstate", s.am.MustAuth(s.SetUserStateHandler()), mdlw))
 	s.router.POST("/manage/rstuser", httproutermiddleware.Handler("rstuser", s.am.MustAuth(s.RstUserHandler()), mdlw))
 
 	s.router.POST("/delete", httproutermiddleware.Handler("delete", s.am.MustAuth(s.DeleteHandler()), mdlw))
+	s.router.GET("/delete/cancel", httproutermiddleware.Handler("delete_cancel", s.CancelDeletionHandler(), mdlw))
+	s.router.POST("/delete/cancel", httproutermiddleware.Handler("delete_cancel", s.CancelDeletionHandler(), mdlw))
 
 	// Support / Report Abuse handlers
 	s.router.GET("/support", httproutermiddleware.Handler("support", s.SupportHandler(), mdlw))
@@ -939,30 +1316,19 @@ func (s *Server) initRoutes() {
 
 // NewServer ...
 func NewServer(bind string, options ...Option) (*Server, error) {
-	config := NewConfig()
-
-	for _, opt := range options {
-		if err := opt(config); err != nil {
-			return nil, err
-		}
+	config, err := LoadConfig(options...)
+	if err != nil {
+		log.WithError(err).Error("error loading config")
+		return nil, err
 	}
 
-	settingsFn := filepath.Join(config.Data, "settings.yaml")
-	if FileExists(settingsFn) {
-		if settings, err := LoadSettings(settingsFn); err != nil {
-			log.Warnf("error loading pod settings from %s: %s", settingsFn, err)
-		} else {
-			if err := merger.MergeOverwrite(config, settings); err != nil {
-				log.WithError(err).Error("error merging pod settings")
-				return nil, err
-			}
-		}
-	}
+	// Twt hashes (and so permalinks) are computed with the configured length
+	types.TwtHashLength = config.TwtHashLength
 
-	if err := config.Validate(); err != nil {
-		log.WithError(err).Error("error validating config")
-		return nil, fmt.Errorf("error validating config: %w", err)
+	if err := SetLogLevels(config.LogLevels); err != nil {
+		log.WithError(err).Warn("error applying log levels")
 	}
+	indieweb.SetWebSubLogger(func() *log.Entry { return Logger(LogWebSub) })
 
 	log.Debugf("Before Cache: %s", MemoryUsage())
 	cache, err := LoadCache(config)
@@ -984,13 +1350,109 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		return nil, err
 	}
 
+	peers, err := db.GetAllPeers()
+	if err != nil {
+		log.WithError(err).Error("error loading managed peers")
+		return nil, err
+	}
+	cache.SetManagedPeers(peers)
+
 	// translator
-	translator, err := NewTranslator()
+	translator, err := NewTranslator(config)
 	if err != nil {
 		log.WithError(err).Error("error loading translator")
 		return nil, err
 	}
 
+	plugins, err = LoadPlugins(config.PluginsDir)
+	if err != nil {
+		log.WithError(err).Error("error loading plugins")
+		return nil, err
+	}
+
+	emojis = NewCustomEmoji(config)
+	if err := emojis.Load(); err != nil {
+		log.WithError(err).Error("error loading custom emoji")
+		return nil, err
+	}
+
+	announcements, err = NewAnnouncements(config)
+	if err != nil {
+		log.WithError(err).Error("error loading announcements")
+		return nil, err
+	}
+	if migrated, err := announcements.MigrateAlert(config); err != nil {
+		log.WithError(err).Warn("error migrating pod alert to an announcement")
+	} else if migrated {
+		if err := config.Settings().Save(filepath.Join(config.Data, "settings.yaml")); err != nil {
+			log.WithError(err).Warn("error saving pod settings")
+		}
+	}
+
+	directory, err = NewFeedDirectory(config)
+	if err != nil {
+		log.WithError(err).Error("error loading feed directory")
+		return nil, err
+	}
+
+	shortLinks, err = NewShortLinks(config)
+	if err != nil {
+		log.WithError(err).Error("error loading short links")
+		return nil, err
+	}
+
+	customPages = NewCustomPages(config)
+	if err := customPages.Load(); err != nil {
+		log.WithError(err).Error("error loading custom pages")
+		return nil, err
+	}
+
+	edits, err = NewEditHistory(config)
+	if err != nil {
+		log.WithError(err).Error("error creating edit history")
+		return nil, err
+	}
+
+	receivedWebMentions, err = NewReceivedWebMentions(config)
+	if err != nil {
+		log.WithError(err).Error("error loading received webmentions")
+		return nil, err
+	}
+
+	visibility, err = NewTwtVisibility(config)
+	if err != nil {
+		log.WithError(err).Error("error loading twt visibility")
+		return nil, err
+	}
+
+	graylist, err = NewGraylist(config)
+	if err != nil {
+		log.WithError(err).Error("error loading graylist")
+		return nil, err
+	}
+
+	audit = NewAuditLog(config)
+
+	users, err := db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Error("error loading users")
+		return nil, err
+	}
+	for _, user := range users {
+		visibility.Protect(user)
+		visibility.Unlist(user)
+		automated.Flag(user.URL, user.Automated)
+	}
+
+	feeds, err := db.GetAllFeeds()
+	if err != nil {
+		log.WithError(err).Error("error loading feeds")
+		return nil, err
+	}
+	for _, feed := range feeds {
+		automated.Flag(feed.URL, feed.Automated)
+	}
+
 	tmplman, err := NewTemplateManager(config, translator, cache, archive)
 	if err != nil {
 		log.WithError(err).Error("error creating template manager")
@@ -999,9 +1461,16 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 
 	router := NewRouter()
 
-	am := auth.NewManager(auth.NewOptions("/login", "/register"))
+	am := auth.NewManager(auth.NewOptions("/login", "/register", CheckSessionAccount(db)))
 
 	tasks := NewDispatcher(10, 100) // TODO: Make this configurable?
+	tasks.SetStore(config, db)
+	tasks.SetRetryPolicy(RetryPolicy{MaxRetries: config.TaskMaxRetries, Backoff: config.TaskRetryBackoff})
+	if limits, err := ParseTaskConcurrency(config.TaskConcurrency); err == nil {
+		tasks.SetLimits(limits)
+	} else {
+		log.WithError(err).Warn("error parsing task concurrency limits")
+	}
 
 	pm := passwords.NewScryptPasswords(nil)
 
@@ -1017,13 +1486,19 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		sc,
 	)
 
-	api := NewAPI(router, config, cache, archive, db, pm, tasks)
+	api := NewAPI(router, config, cache, archive, db, pm, tasks, translator)
 
 	var handler http.Handler
 
 	csrfHandler := nosurf.New(router)
 	csrfHandler.ExemptGlob("/api/v1/*")
-	csrfHandler.ExemptGlob("/indieauth/*")
+	csrfHandler.ExemptPath("/indieauth/auth")
+	csrfHandler.ExemptPath("/indieauth/token")
+	csrfHandler.ExemptPath("/micropub")
+	csrfHandler.ExemptPath("/micropub/media")
+	csrfHandler.ExemptPath("/microsub")
+	csrfHandler.ExemptPath("/mail/inbound")
+	csrfHandler.ExemptGlob("/feed/*/post")
 	csrfHandler.ExemptPath("/webmention")
 	csrfHandler.ExemptPath("/websub")
 	csrfHandler.ExemptPath("/notify")
@@ -1036,6 +1511,8 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		handler = gziphandler.GzipHandler(sm.Handler(csrfHandler))
 	}
 
+	handler = CORSHandler(config, handler)
+
 	if !config.DisableLogger {
 		handler = logger.New(logger.Options{
 			Prefix:               "yarnd",
@@ -1043,9 +1520,10 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		}).Handler(handler)
 	}
 
+	handler = RequestIDHandler(handler)
+
 	server := &Server{
 		bind:    bind,
-		config:  config,
 		router:  router,
 		tmplman: tmplman,
 
@@ -1069,8 +1547,12 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		// Dispatcher
 		tasks: tasks,
 
+		// Resolver of nick@domain handles
+		handles: NewHandleResolver(config),
+
 		// Auth Manager
-		am: am,
+		am:   am,
+		csrf: csrfHandler,
 
 		// Session Manager
 		sc: sc,
@@ -1082,6 +1564,12 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 		// Translator
 		translator: translator,
 	}
+	server.liveConfig.Store(config)
+
+	// Let poderators reload the pod's settings via the API
+	api.config = server.config
+	api.reload = server.Reload
+	api.handles = server.handles
 
 	// Factory functions that require access to the Pod Config and Store
 	server.AppendTwt = AppendTwtFactory(config, cache, db)
@@ -1107,45 +1595,60 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 	log.Infof("started webmentions processor")
 
 	server.setupMetrics()
-	log.Infof("serving metrics endpoint at %s/metrics", server.config.BaseURL)
+	log.Infof("serving metrics endpoint at %s/metrics", server.config().BaseURL)
+
+	if server.config().NNTPBind != "" {
+		server.setupNNTP()
+		log.Infof("started nntp gateway on %s", server.config().NNTPBind)
+	}
+
+	if server.config().XMPPJID != "" {
+		server.xmpp = NewXMPPBridge(server.config(), server.cache, server.db, server.tasks, server.AppendTwt)
+		server.xmpp.Start()
+		log.Infof("started xmpp bridge as %s", server.config().XMPPJID)
+	}
 
 	// Log interesting configuration options
-	log.Infof("Debug: %t", server.config.Debug)
-	log.Infof("Instance Name: %s", server.config.Name)
-	log.Infof("Base URL: %s", server.config.BaseURL)
-	log.Infof("Using Theme: %s", server.config.Theme)
-	log.Infof("Admin User: %s", server.config.AdminUser)
-	log.Infof("Admin Name: %s", server.config.AdminName)
-	log.Infof("Admin Email: %s", server.config.AdminEmail)
-	log.Infof("Max Twts per Page: %d", server.config.TwtsPerPage)
-	log.Infof("Max Cache TTL: %s", server.config.MaxCacheTTL)
-	log.Infof("Fetch Interval: %s", server.config.FetchInterval)
-	log.Infof("Max Cache Items: %d", server.config.MaxCacheItems)
-	log.Infof("Maximum length of Posts: %d", server.config.MaxTwtLength)
-	log.Infof("Open User Profiles: %t", server.config.OpenProfiles)
-	log.Infof("Open Registrations: %t", server.config.OpenRegistrations)
-	log.Infof("Disable Gzip: %t", server.config.DisableGzip)
-	log.Infof("Disable Logger: %t", server.config.DisableLogger)
-	log.Infof("Disable Media: %t", server.config.DisableMedia)
-	log.Infof("Disable FFMpeg: %t", server.config.DisableFfmpeg)
-	log.Infof("SMTP Host: %s", server.config.SMTPHost)
-	log.Infof("SMTP Port: %d", server.config.SMTPPort)
-	log.Infof("SMTP User: %s", server.config.SMTPUser)
-	log.Infof("SMTP From: %s", server.config.SMTPFrom)
-	log.Infof("Max Fetch Limit: %s", humanize.Bytes(uint64(server.config.MaxFetchLimit)))
-	log.Infof("Max Upload Size: %s", humanize.Bytes(uint64(server.config.MaxUploadSize)))
-	log.Infof("API Session Time: %s", server.config.APISessionTime)
-	log.Infof("Enabled Features: %s", server.config.Features)
+	log.Infof("Debug: %t", server.config().Debug)
+	log.Infof("Instance Name: %s", server.config().Name)
+	log.Infof("Base URL: %s", server.config().BaseURL)
+	log.Infof("Using Theme: %s", server.config().Theme)
+	log.Infof("Admin User: %s", server.config().AdminUser)
+	log.Infof("Admin Name: %s", server.config().AdminName)
+	log.Infof("Admin Email: %s", server.config().AdminEmail)
+	log.Infof("Max Twts per Page: %d", server.config().TwtsPerPage)
+	log.Infof("Max Cache TTL: %s", server.config().MaxCacheTTL)
+	log.Infof("Fetch Interval: %s", server.config().FetchInterval)
+	log.Infof("Max Cache Items: %d", server.config().MaxCacheItems)
+	log.Infof("Maximum length of Posts: %d", server.config().MaxTwtLength)
+	log.Infof("Open User Profiles: %t", server.config().OpenProfiles)
+	log.Infof("Open Registrations: %t", server.config().OpenRegistrations)
+	log.Infof("Public API: %t", server.config().PublicAPI)
+	log.Infof("Disable Gzip: %t", server.config().DisableGzip)
+	log.Infof("Disable Logger: %t", server.config().DisableLogger)
+	log.Infof("Disable Media: %t", server.config().DisableMedia)
+	log.Infof("Disable FFMpeg: %t", server.config().DisableFfmpeg)
+	log.Infof("SMTP Host: %s", server.config().SMTPHost)
+	log.Infof("SMTP Port: %d", server.config().SMTPPort)
+	log.Infof("SMTP User: %s", server.config().SMTPUser)
+	log.Infof("SMTP From: %s", server.config().SMTPFrom)
+	log.Infof("NNTP Bind: %s", server.config().NNTPBind)
+	log.Infof("Plugins: %s", strings.Join(plugins.Names(), ", "))
+	log.Infof("Max Fetch Limit: %s", humanize.Bytes(uint64(server.config().MaxFetchLimit)))
+	log.Infof("Max Cache Memory: %s", humanize.Bytes(uint64(server.config().MaxCacheMemory)))
+	log.Infof("Max Upload Size: %s", humanize.Bytes(uint64(server.config().MaxUploadSize)))
+	log.Infof("API Session Time: %s", server.config().APISessionTime)
+	log.Infof("Enabled Features: %s", server.config().Features)
 
 	// Warn about user registration being disabled.
-	if !server.config.OpenRegistrations {
+	if !server.config().OpenRegistrations {
 		log.Warn("registrations are disabled as per configuration (no -R/--open-registrations)")
 	}
 
 	// Warn about `ffmpeg` not installed or available
 	if !CmdExists("ffmpeg") {
 		log.Warn("ffmpeg not found, audio and video support will be disabled")
-		server.config.DisableFfmpeg = true
+		server.config().DisableFfmpeg = true
 	}
 
 	server.initRoutes()
@@ -1156,6 +1659,88 @@ func NewServer(bind string, options ...Option) (*Server, error) {
 	return server, nil
 }
 
+// Reload reloads the pod's settings from settings.yaml followed by the
+// translations and templates of the pod's active theme and the custom pages
+// without a restart
+func (s *Server) Reload() error {
+	s.reloadMu.Lock()
+	defer s.reloadMu.Unlock()
+
+	// Merge and validate the settings on a copy of the config so that
+	// invalid settings are rejected without affecting the running pod
+	current := s.config()
+	config := *current
+	config.Features = NewFeatureFlags()
+	config.Features.Set(current.Features)
+	config.LogLevels = make(map[string]string)
+	for subsystem, level := range current.LogLevels {
+		config.LogLevels[subsystem] = level
+	}
+
+	settingsFn := filepath.Join(current.Data, "settings.yaml")
+	if FileExists(settingsFn) {
+		settings, err := LoadSettings(settingsFn)
+		if err != nil {
+			return fmt.Errorf("error loading pod settings from %s: %w", settingsFn, err)
+		}
+		if err := merger.MergeOverwrite(&config, settings); err != nil {
+			return fmt.Errorf("error merging pod settings: %w", err)
+		}
+	}
+
+	if err := config.applyOverrides(); err != nil {
+		return err
+	}
+
+	config.blockedFeeds = nil
+	config.allowedFeeds = nil
+	config.permittedImages = nil
+	if err := config.Validate(); err != nil {
+		return fmt.Errorf("error validating pod settings: %w", err)
+	}
+
+	// Twt hashes already cached, archived and linked to would no longer match
+	if config.TwtHashLength != current.TwtHashLength {
+		return errors.New("error validating pod settings: the twt hash length cannot be changed without a restart")
+	}
+
+	rescheduleJobs := config.FetchInterval != current.FetchInterval
+
+	// Feature flags are updated in place as components keep the config they
+	// were started with, the rest of the config is swapped so that requests
+	// being served never see a partially applied config
+	current.Features.Set(config.Features)
+	config.Features = current.Features
+
+	s.liveConfig.Store(&config)
+	s.cache.SetConfig(&config)
+
+	if rescheduleJobs {
+		if err := s.restartJobs(); err != nil {
+			return fmt.Errorf("error rescheduling background jobs: %w", err)
+		}
+		log.Infof("rescheduled background jobs with fetch interval %s", s.config().FetchInterval)
+	}
+
+	if err := SetLogLevels(s.config().LogLevels); err != nil {
+		return fmt.Errorf("error applying log levels: %w", err)
+	}
+
+	if err := s.translator.Reload(); err != nil {
+		return fmt.Errorf("error reloading translations: %w", err)
+	}
+
+	if err := s.tmplman.Reload(); err != nil {
+		return fmt.Errorf("error reloading templates: %w", err)
+	}
+
+	if err := customPages.Load(); err != nil {
+		return fmt.Errorf("error reloading custom pages: %w", err)
+	}
+
+	return nil
+}
+
 func (s *Server) tr(ctx *Context, msgID string, data ...interface{}) string {
 	return s.translator.Translate(ctx, msgID, data...)
 }
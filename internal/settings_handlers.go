@@ -5,9 +5,12 @@ package internal
 
 import (
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/julienschmidt/httprouter"
@@ -20,7 +23,7 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 		ctx := NewContext(s, r)
 
 		if r.Method == "GET" {
-			profile := ctx.User.Profile(s.config.BaseURL, ctx.User)
+			profile := ctx.User.Profile(s.config().BaseURL, ctx.User)
 
 			followers := s.cache.GetFollowers(profile)
 
@@ -32,13 +35,19 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 			ctx.Profile = profile
 
 			ctx.Title = s.tr(ctx, "PageSettingsTitle")
-			ctx.Bookmarklet = url.QueryEscape(fmt.Sprintf(bookmarkletTemplate, s.config.BaseURL))
+			ctx.Bookmarklet = url.QueryEscape(fmt.Sprintf(bookmarkletTemplate, s.config().BaseURL))
+			ctx.PostByEmailAddress = PostByEmailAddress(s.config(), ctx.User)
+			ctx.PrivateFeedURLs = GetPrivateFeedURLs(s.config(), ctx.User)
+			ctx.ProfileDetails = ctx.User.ProfileDetails()
+			if priv, err := ParseSigningKey(ctx.User.SigningKey); err == nil {
+				ctx.SigningPublicKey = FormatPublicKey(priv)
+			}
 			s.render("settings", w, ctx)
 			return
 		}
 
 		// Limit request body to to abuse
-		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUploadSize)
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
 		defer r.Body.Close()
 
 		// XXX: We DO NOT store this! (EVER)
@@ -47,12 +56,14 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 		password := r.FormValue("password")
 
 		theme := r.FormValue("theme")
+		avatarStyle := r.FormValue("avatarStyle")
 
 		displayDatesInTimezone := r.FormValue("displayDatesInTimezone")
 		displayTimePreference := r.FormValue("displayTimePreference")
 		openLinksInPreference := r.FormValue("openLinksInPreference")
 		displayTimelinePreference := r.FormValue("displayTimelinePreference")
 		displayImagesPreference := r.FormValue("displayImagesPreference")
+		textDirection := r.FormValue("textDirection")
 		displayMedia := r.FormValue("displayMedia") == "on"
 		originalMedia := r.FormValue("originalMedia") == "on"
 
@@ -60,13 +71,54 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 		visibilityReadmore := r.FormValue("visibilityReadmore") == "on"
 		linkVerification := r.FormValue("linkVerification") == "on"
 		stripTrackingParam := r.FormValue("stripTrackingParam") == "on"
+		liteMode := r.FormValue("liteMode") == "on"
+		discoverRanking := r.FormValue("discoverRanking")
+
+		var discoverLanguages []string
+		for _, lang := range UniqStrings(r.Form["discoverLanguages"]) {
+			if IsDetectedLanguage(lang) {
+				discoverLanguages = append(discoverLanguages, lang)
+			}
+		}
+		sort.Strings(discoverLanguages)
+
+		timelineFilters := TimelineFilters{
+			HideRepliesToStrangers: r.FormValue("hideRepliesToStrangers") == "on",
+			HideLinkOnly:           r.FormValue("hideLinkOnly") == "on",
+			HideAutomated:          r.FormValue("hideAutomated") == "on",
+			MediaOnly:              r.FormValue("mediaOnly") == "on",
+		}
 
 		customPrimaryColor := r.FormValue("customPrimaryColor")
 		customSecondaryColor := r.FormValue("customSecondaryColor")
 
+		stylesheet := r.FormValue("stylesheet")
+		customCSS := strings.TrimSpace(r.FormValue("customCSS"))
+
 		isFollowersPubliclyVisible := r.FormValue("isFollowersPubliclyVisible") == "on"
 		isFollowingPubliclyVisible := r.FormValue("isFollowingPubliclyVisible") == "on"
 		isBookmarksPubliclyVisible := r.FormValue("isBookmarksPubliclyVisible") == "on"
+		protected := r.FormValue("protected") == "on"
+		noIndex := r.FormValue("noIndex") == "on"
+		unlisted := r.FormValue("unlisted") == "on"
+		localOnly := r.FormValue("localOnly") == "on"
+		isAutomated := r.FormValue("automated") == "on"
+
+		website := r.FormValue("website")
+		location := r.FormValue("location")
+		pronouns := r.FormValue("pronouns")
+
+		var profileFields []ProfileField
+		names, values := r.Form["profileFieldName"], r.Form["profileFieldValue"]
+		for i := 0; i < len(names) && i < len(values); i++ {
+			profileFields = append(profileFields, ProfileField{Name: names[i], Value: values[i]})
+		}
+
+		xmppJID := strings.TrimSpace(r.FormValue("xmppJID"))
+		xmppNotifyMentions := r.FormValue("xmppNotifyMentions") == "on"
+		xmppNotifyFollowers := r.FormValue("xmppNotifyFollowers") == "on"
+		xmppAcceptReplies := r.FormValue("xmppAcceptReplies") == "on"
+		xmppVerifyCode := r.FormValue("xmppVerifyCode")
 
 		avatarFile, _, err := r.FormFile("avatar_file")
 		if err != nil && err != http.ErrMissingFile {
@@ -77,7 +129,8 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
 		}
 
 		if password != "" {
@@ -92,27 +145,19 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 		}
 
 		if avatarFile != nil {
-			opts := &ImageOptions{
-				Resize: true,
-				Width:  s.config.AvatarResolution,
-				Height: s.config.AvatarResolution,
-			}
-			_, err = StoreUploadedImage(
-				s.config, avatarFile,
-				avatarsDir, ctx.Username,
-				opts,
-			)
-			if err != nil {
+			if err := s.storeUserAvatar(user, avatarFile); err != nil {
 				ctx.Error = true
 				ctx.Message = fmt.Sprintf("Error updating user: %s", err)
 				s.render("error", w, ctx)
 				return
 			}
-			avatarFn := filepath.Join(s.config.Data, avatarsDir, fmt.Sprintf("%s.png", ctx.Username))
-			if avatarHash, err := FastHashFile(avatarFn); err == nil {
-				user.AvatarHash = avatarHash
-			} else {
-				log.WithError(err).Warnf("error updating avatar hash for %s", ctx.Username)
+		}
+
+		if avatarStyle != user.AvatarStyle && IsAvatarStyle(avatarStyle) {
+			user.AvatarStyle = avatarStyle
+			if avatarFile == nil && !HasUploadedAvatar(s.config(), ctx.Username) {
+				// Bust caches of the generated avatar
+				user.AvatarHash = FastHashString(user.AvatarStyle + user.AvatarSeed)
 			}
 		}
 
@@ -128,25 +173,85 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 		user.OpenLinksInPreference = openLinksInPreference
 		user.DisplayImagesPreference = displayImagesPreference
 		user.DisplayMedia = displayMedia
+
+		switch textDirection {
+		case "ltr", "rtl":
+			user.TextDirection = textDirection
+		default:
+			user.TextDirection = "auto"
+		}
 		user.OriginalMedia = originalMedia
 
 		user.VisibilityCompact = visibilityCompact
 		user.VisibilityReadmore = visibilityReadmore
 		user.LinkVerification = linkVerification
 		user.StripTrackingParam = stripTrackingParam
+		user.LiteMode = liteMode
+
+		if discoverRanking == "" || IsDiscoverRanking(discoverRanking) {
+			user.DiscoverRanking = discoverRanking
+		}
 
 		user.CustomPrimaryColor = customPrimaryColor
 		user.CustomSecondaryColor = customSecondaryColor
 
-		if displayTimelinePreference != user.DisplayTimelinePreference {
+		if stylesheet == "" || s.config().IsInstalledTheme(stylesheet) {
+			user.Stylesheet = stylesheet
+		}
+		user.CustomCSS = SanitizeCSS(s.config().BaseURL, customCSS)
+
+		if displayTimelinePreference != user.DisplayTimelinePreference || timelineFilters != user.TimelineFilters ||
+			strings.Join(discoverLanguages, ",") != strings.Join(user.DiscoverLanguages, ",") {
 			// Force User Views to be recalculated
 			s.cache.DeleteUserViews(ctx.User)
 		}
 		user.DisplayTimelinePreference = displayTimelinePreference
+		user.TimelineFilters = timelineFilters
+		user.DiscoverLanguages = discoverLanguages
 
 		user.IsFollowersPubliclyVisible = isFollowersPubliclyVisible
 		user.IsFollowingPubliclyVisible = isFollowingPubliclyVisible
 		user.IsBookmarksPubliclyVisible = isBookmarksPubliclyVisible
+		user.Protected = protected
+		user.NoIndex = noIndex
+
+		relist := unlisted != user.Unlisted || isAutomated != user.Automated
+		user.Unlisted = unlisted
+		user.LocalOnly = localOnly
+		user.Automated = isAutomated
+
+		user.SetProfileFields(website, location, pronouns, profileFields)
+
+		// A new JID must be confirmed with the code sent to it before any
+		// notifications are sent to it or replies accepted from it
+		sendXMPPVerifyCode := false
+		if s.xmpp != nil {
+			if !strings.EqualFold(xmppJID, user.XMPPJID) {
+				user.XMPPJID = xmppJID
+				user.XMPPVerified = false
+				user.XMPPVerifyCode = ""
+				if xmppJID != "" {
+					user.XMPPVerifyCode = NewXMPPVerifyCode()
+					sendXMPPVerifyCode = true
+				}
+			} else if xmppVerifyCode != "" && !user.XMPPVerified {
+				if !CheckXMPPVerifyCode(user, xmppVerifyCode) {
+					ctx.Error = true
+					ctx.Message = s.tr(ctx, "ErrorXMPPVerifyCode")
+					s.render("error", w, ctx)
+					return
+				}
+				user.XMPPVerified = true
+				user.XMPPVerifyCode = ""
+			} else if xmppJID != "" && !user.XMPPVerified && user.XMPPVerifyCode == "" {
+				// JIDs configured before confirmation codes were required
+				user.XMPPVerifyCode = NewXMPPVerifyCode()
+				sendXMPPVerifyCode = true
+			}
+			user.XMPPNotifyMentions = xmppNotifyMentions
+			user.XMPPNotifyFollowers = xmppNotifyFollowers
+			user.XMPPAcceptReplies = xmppAcceptReplies
+		}
 
 		if err := s.db.SetUser(ctx.Username, user); err != nil {
 			ctx.Error = true
@@ -155,19 +260,101 @@ func (s *Server) SettingsHandler() httprouter.Handle {
 			return
 		}
 
+		visibility.Protect(user)
+		visibility.Unlist(user)
+		automated.Flag(user.URL, user.Automated)
+
+		if sendXMPPVerifyCode {
+			if err := s.xmpp.SendVerifyCode(user); err != nil {
+				log.WithError(err).Warnf("error sending xmpp confirmation code to %s", user.Username)
+			}
+		}
+
+		// Rebuild the Discover and Local views with or without the user's twts
+		if relist {
+			if _, err := s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityBackground, func() error {
+				s.cache.Refresh()
+				return nil
+			}); err != nil {
+				log.WithError(err).Warn("error submitting task to refresh cache")
+			}
+		}
+
+		s.verifyProfileLinks(r.Context(), ctx.Username)
+
 		ctx.Error = false
 		ctx.Message = s.tr(ctx, "MsgUpdateSettingsSuccess")
 		s.render("error", w, ctx)
 	}
 }
 
+// storeUserAvatar stores an avatar uploaded by the user and updates the
+// user's avatar hash to bust caches of the previous avatar
+func (s *Server) storeUserAvatar(user *User, avatarFile io.Reader) error {
+	opts := &ImageOptions{
+		Resize: true,
+		Width:  s.config().AvatarResolution,
+		Height: s.config().AvatarResolution,
+	}
+	if _, err := StoreUploadedImage(s.config(), avatarFile, avatarsDir, user.Username, opts); err != nil {
+		return err
+	}
+
+	avatarFn := filepath.Join(s.config().Data, avatarsDir, fmt.Sprintf("%s.png", user.Username))
+	if avatarHash, err := FastHashFile(avatarFn); err == nil {
+		user.AvatarHash = avatarHash
+	} else {
+		log.WithError(err).Warnf("error updating avatar hash for %s", user.Username)
+	}
+
+	return nil
+}
+
+// SettingsRegenerateAvatarHandler replaces the user's avatar with a newly
+// generated one in their chosen style
+func (s *Server) SettingsRegenerateAvatarHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if fn := filepath.Join(s.config().Data, avatarsDir, fmt.Sprintf("%s.png", ctx.Username)); FileExists(fn) {
+			if err := os.Remove(fn); err != nil {
+				log.WithError(err).Errorf("error removing avatar of %s", ctx.Username)
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+				s.render("error", w, ctx)
+				return
+			}
+		}
+
+		user.AvatarSeed = GenerateRandomToken()
+		user.AvatarHash = FastHashString(user.AvatarStyle + user.AvatarSeed)
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = s.tr(ctx, "MsgRegenerateAvatarSuccess")
+		s.render("error", w, ctx)
+	}
+}
+
 // SettingsAddLinkHandler ...
 func (s *Server) SettingsAddLinkHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		ctx := NewContext(s, r)
 
 		// Limit request body to to abuse
-		r.Body = http.MaxBytesReader(w, r.Body, s.config.MaxUploadSize)
+		r.Body = http.MaxBytesReader(w, r.Body, s.config().MaxUploadSize)
 		defer r.Body.Close()
 
 		linkTitle := strings.TrimSpace(r.FormValue("linkTitle"))
@@ -175,7 +362,8 @@ func (s *Server) SettingsAddLinkHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
 		}
 
 		user.AddLink(linkTitle, linkURL)
@@ -187,6 +375,8 @@ func (s *Server) SettingsAddLinkHandler() httprouter.Handle {
 			return
 		}
 
+		s.verifyProfileLinks(r.Context(), ctx.Username)
+
 		ctx.Error = false
 		ctx.Message = s.tr(ctx, "MsgAddLinkSuccess")
 		s.render("error", w, ctx)
@@ -200,7 +390,8 @@ func (s *Server) SettingsRemoveLinkHandler() httprouter.Handle {
 
 		user := ctx.User
 		if user == nil {
-			log.Fatalf("user not found in context")
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
 		}
 
 		linkTitle := strings.TrimSpace(r.FormValue("link_title"))
@@ -0,0 +1,165 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// twtxtSignatureHeader carries the detached signature of a served feed
+	twtxtSignatureHeader = "X-Twtxt-Signature"
+
+	// publicKeyField is the feed metadata field advertising a feed's key
+	publicKeyField = "public_key"
+
+	// publicKeyPrefix is the key type prefix of advertised public keys
+	publicKeyPrefix = "ed25519:"
+)
+
+var (
+	// ErrInvalidSigningKey is returned for malformed signing or public keys
+	ErrInvalidSigningKey = errors.New("error: invalid signing key")
+
+	// ErrInvalidFeedSignature is returned when a feed's signature is missing
+	// or does not match its content
+	ErrInvalidFeedSignature = errors.New("error: invalid feed signature")
+)
+
+// GenerateSigningKey generates a new ed25519 signing key encoded as the
+// base64 of its seed
+func GenerateSigningKey() (string, error) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(priv.Seed()), nil
+}
+
+// ParseSigningKey decodes a signing key generated by GenerateSigningKey
+func ParseSigningKey(s string) (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(s)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrInvalidSigningKey
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// FormatPublicKey formats the public key of a signing key as advertised in
+// the public_key field of a feed's metadata
+func FormatPublicKey(priv ed25519.PrivateKey) string {
+	return publicKeyPrefix + base64.StdEncoding.EncodeToString(priv.Public().(ed25519.PublicKey))
+}
+
+// ParsePublicKey parses a public key as advertised in a feed's metadata
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	if !strings.HasPrefix(s, publicKeyPrefix) {
+		return nil, ErrInvalidSigningKey
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(s, publicKeyPrefix))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, ErrInvalidSigningKey
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// FeedPublicKey returns the public key advertised in the metadata of a feed
+func FeedPublicKey(data []byte) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if !strings.HasPrefix(line, "#") {
+			continue
+		}
+		kv := strings.SplitN(strings.TrimSpace(strings.TrimPrefix(line, "#")), "=", 2)
+		if len(kv) == 2 && strings.TrimSpace(kv[0]) == publicKeyField {
+			return strings.TrimSpace(kv[1]), true
+		}
+	}
+	return "", false
+}
+
+// CanonicalFeed returns the signed content of a feed, its twts without any
+// comments, blank lines or trailing whitespace, so that signatures survive
+// changes to a feed's (dynamically rendered) preamble
+func CanonicalFeed(data []byte) []byte {
+	var buf bytes.Buffer
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), len(data)+1)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	return buf.Bytes()
+}
+
+// SignFeed returns the detached signature of a feed
+func SignFeed(priv ed25519.PrivateKey, data []byte) string {
+	return base64.StdEncoding.EncodeToString(ed25519.Sign(priv, CanonicalFeed(data)))
+}
+
+// VerifyFeed verifies the detached signature of a feed
+func VerifyFeed(pub ed25519.PublicKey, data []byte, signature string) error {
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil || !ed25519.Verify(pub, CanonicalFeed(data), sig) {
+		return ErrInvalidFeedSignature
+	}
+	return nil
+}
+
+// SettingsSigningKeyHandler generates (or removes) the key used to sign the
+// user's feed
+func (s *Server) SettingsSigningKeyHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		ctx := NewContext(s, r)
+
+		user := ctx.User
+		if user == nil {
+			http.Redirect(w, r, "/login", http.StatusFound)
+			return
+		}
+
+		if r.FormValue("action") == "remove" {
+			user.SigningKey = ""
+		} else {
+			key, err := GenerateSigningKey()
+			if err != nil {
+				log.WithError(err).Errorf("error generating signing key for %s", ctx.Username)
+				ctx.Error = true
+				ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+				s.render("error", w, ctx)
+				return
+			}
+			user.SigningKey = key
+		}
+
+		if err := s.db.SetUser(ctx.Username, user); err != nil {
+			log.WithError(err).Errorf("error updating signing key for %s", ctx.Username)
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorUpdatingUser")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Error = false
+		ctx.Message = s.tr(ctx, "MsgUpdateSettingsSuccess")
+		s.render("error", w, ctx)
+	}
+}
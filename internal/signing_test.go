@@ -0,0 +1,47 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignFeed(t *testing.T) {
+	seed, err := GenerateSigningKey()
+	require.NoError(t, err)
+
+	priv, err := ParseSigningKey(seed)
+	require.NoError(t, err)
+
+	pub, err := ParsePublicKey(FormatPublicKey(priv))
+	require.NoError(t, err)
+
+	feed := []byte("# nick = test\n# public_key = " + FormatPublicKey(priv) + "\n\n2021-01-01T00:00:00Z\tHello World!\n")
+	signature := SignFeed(priv, feed)
+
+	key, ok := FeedPublicKey(feed)
+	assert.True(t, ok)
+	assert.Equal(t, FormatPublicKey(priv), key)
+
+	t.Run("Valid", func(t *testing.T) {
+		assert.NoError(t, VerifyFeed(pub, feed, signature))
+	})
+
+	t.Run("DifferentPreamble", func(t *testing.T) {
+		other := []byte("# nick = other\n2021-01-01T00:00:00Z\tHello World!   \r\n")
+		assert.NoError(t, VerifyFeed(pub, other, signature))
+	})
+
+	t.Run("Tampered", func(t *testing.T) {
+		tampered := []byte("2021-01-01T00:00:00Z\tHello Mallory!\n")
+		assert.ErrorIs(t, VerifyFeed(pub, tampered, signature), ErrInvalidFeedSignature)
+	})
+
+	t.Run("InvalidSignature", func(t *testing.T) {
+		assert.ErrorIs(t, VerifyFeed(pub, feed, "not a signature"), ErrInvalidFeedSignature)
+	})
+}
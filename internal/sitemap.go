@@ -0,0 +1,139 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+const (
+	// maxSitemapURLs is the maximum number of urls of a sitemap (See:
+	// https://www.sitemaps.org/protocol.html)
+	maxSitemapURLs = 50000
+
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
+// Sitemap is a sitemap.xml listing the pages of a pod search engines may
+// index
+type Sitemap struct {
+	XMLName xml.Name     `xml:"urlset"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	URLs    []SitemapURL `xml:"url"`
+}
+
+// SitemapURL ...
+type SitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// add adds an url to the sitemap, returning false if the sitemap is full
+func (s *Sitemap) add(loc string, lastMod time.Time) bool {
+	if len(s.URLs) >= maxSitemapURLs {
+		return false
+	}
+
+	u := SitemapURL{Loc: loc}
+	if !lastMod.IsZero() {
+		u.LastMod = lastMod.UTC().Format(time.RFC3339)
+	}
+	s.URLs = append(s.URLs, u)
+
+	return true
+}
+
+// IsIndexable returns true if search engines may index the user's profile
+// and twts (the user is active and has not opted out of indexing)
+func (u *User) IsIndexable() bool {
+	return u.IsActive() && !u.NoIndex
+}
+
+// BuildSitemap builds the sitemap of a pod from its pages, the profiles of
+// its users (if profiles are open) and the permalinks of their public twts,
+// users who discourage indexing are left out
+func BuildSitemap(conf *Config, users []*User, pages []*CustomPage, getTwts func(uri string) types.Twts) *Sitemap {
+	sitemap := &Sitemap{Xmlns: sitemapNamespace}
+
+	baseURL := strings.TrimSuffix(conf.BaseURL, "/")
+
+	sitemap.add(baseURL+"/", time.Time{})
+	for _, name := range BuiltinPageNames {
+		sitemap.add(URLForPage(baseURL, name), time.Time{})
+	}
+	for _, page := range pages {
+		sitemap.add(URLForPage(baseURL, page.Name), time.Time{})
+	}
+
+	for _, user := range users {
+		if !user.IsIndexable() {
+			continue
+		}
+
+		var twts types.Twts
+		for _, twt := range getTwts(user.URL) {
+			if visibility.CanView(conf, nil, twt) {
+				twts = append(twts, twt)
+			}
+		}
+
+		if conf.OpenProfiles {
+			var lastMod time.Time
+			if len(twts) > 0 {
+				lastMod = twts[0].Created()
+			}
+			if !sitemap.add(fmt.Sprintf("%s/user/%s/", baseURL, user.Username), lastMod) {
+				break
+			}
+		}
+
+		for _, twt := range twts {
+			if !sitemap.add(URLForTwt(baseURL, twt.Hash()), twt.Created()) {
+				break
+			}
+		}
+	}
+
+	return sitemap
+}
+
+// SitemapHandler serves the pod's sitemap.xml
+func (s *Server) SitemapHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+
+		if r.Method == http.MethodHead {
+			defer r.Body.Close()
+			return
+		}
+
+		users, err := s.db.GetAllUsers()
+		if err != nil {
+			log.WithError(err).Error("error loading users for sitemap")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		sitemap := BuildSitemap(s.config(), users, customPages.List(), s.cache.GetByURL)
+
+		data, err := xml.MarshalIndent(sitemap, "", "  ")
+		if err != nil {
+			log.WithError(err).Error("error serializing sitemap")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write([]byte(xml.Header))
+		_, _ = w.Write(data)
+	}
+}
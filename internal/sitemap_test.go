@@ -0,0 +1,54 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.yarn.social/types"
+)
+
+func TestBuildSitemap(t *testing.T) {
+	now := time.Now()
+	twt := types.MakeTwt(testLocalTwter, now, "Hello World!")
+
+	getTwts := func(uri string) types.Twts {
+		if uri == testLocalFeed {
+			return types.Twts{twt}
+		}
+		return nil
+	}
+
+	users := []*User{
+		{Username: testLocalNick, URL: testLocalFeed},
+		{Username: "hidden", URL: "https://example.com/user/hidden/twtxt.txt", NoIndex: true},
+	}
+	pages := []*CustomPage{{Name: "rules", Title: "Rules"}}
+
+	locs := func(sitemap *Sitemap) []string {
+		var locs []string
+		for _, u := range sitemap.URLs {
+			locs = append(locs, u.Loc)
+		}
+		return locs
+	}
+
+	conf := &Config{BaseURL: "https://example.com", OpenProfiles: true}
+	sitemap := BuildSitemap(conf, users, pages, getTwts)
+
+	assert.Contains(t, locs(sitemap), "https://example.com/about")
+	assert.Contains(t, locs(sitemap), "https://example.com/rules")
+	assert.Contains(t, locs(sitemap), "https://example.com/user/"+testLocalNick+"/")
+	assert.Contains(t, locs(sitemap), URLForTwt(conf.BaseURL, twt.Hash()))
+	assert.NotContains(t, locs(sitemap), "https://example.com/user/hidden/")
+
+	// Profiles are only listed if they are open to anonymous visitors
+	conf.OpenProfiles = false
+	sitemap = BuildSitemap(conf, users, pages, getTwts)
+
+	assert.NotContains(t, locs(sitemap), "https://example.com/user/"+testLocalNick+"/")
+	assert.Contains(t, locs(sitemap), URLForTwt(conf.BaseURL, twt.Hash()))
+}
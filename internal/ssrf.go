@@ -0,0 +1,268 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+)
+
+var (
+	// ErrFetchNotPermitted is returned for a server-side fetch of a private
+	// or reserved address (See: Config.IsFetchPermittedIP)
+	ErrFetchNotPermitted = errors.New("error: fetching private or reserved addresses is not permitted")
+
+	// ErrFetchInvalidURL is returned for a server-side fetch of an url that
+	// is not an absolute http(s) url
+	ErrFetchInvalidURL = errors.New("error: invalid or unsupported url")
+
+	// ErrTooManyRedirects is returned for a server-side fetch redirected more
+	// than Config.MaxFetchRedirects times
+	ErrTooManyRedirects = errors.New("error: too many redirects")
+)
+
+// reservedNetworks are the private, loopback, link-local (including cloud
+// metadata services), multicast and other reserved networks server-side
+// fetches are not permitted to connect to
+var reservedNetworks = mustParseCIDRs(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"127.0.0.0/8",
+	"169.254.0.0/16",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.0.2.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"198.51.100.0/24",
+	"203.0.113.0/24",
+	"224.0.0.0/4",
+	"240.0.0.0/4",
+	"::/128",
+	"::1/128",
+	"64:ff9b::/96",
+	"100::/64",
+	"2001:db8::/32",
+	"fc00::/7",
+	"fe80::/10",
+	"ff00::/8",
+)
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// IsFetchPermittedIP returns true if server-side fetches may connect to ip,
+// that is it is not in a private or reserved network or is in one of the
+// networks explicitly allowed (See: WithFetchAllowedNetworks)
+func (c *Config) IsFetchPermittedIP(ip net.IP) bool {
+	for _, network := range c.fetchAllowedNetworks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// hostPort returns the host:port of an url with the default port of its
+// scheme if it has none
+func hostPort(u *url.URL) string {
+	port := u.Port()
+	if port == "" {
+		switch strings.ToLower(u.Scheme) {
+		case "http":
+			port = "80"
+		case "https":
+			port = "443"
+		case "gopher":
+			port = "70"
+		case "gemini":
+			port = "1965"
+		}
+	}
+	return net.JoinHostPort(strings.ToLower(u.Hostname()), port)
+}
+
+// isPodAddr returns true if addr (host:port) is the Pod's own address, which
+// the Pod is always permitted to fetch (e.g: its own feeds). Other services
+// on the Pod's host are not.
+func (c *Config) isPodAddr(addr string) bool {
+	if c.baseURL == nil {
+		return false
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+
+	return strings.EqualFold(net.JoinHostPort(host, port), hostPort(c.baseURL))
+}
+
+// ValidateFetchURL returns an error if uri cannot be fetched server-side,
+// only absolute http(s) urls to hosts that are not private or reserved IPs
+// are permitted. Hostnames are checked when resolved (See: NewFetchClient)
+func ValidateFetchURL(conf *Config, uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return ErrFetchInvalidURL
+	}
+
+	if conf.isPodAddr(hostPort(u)) {
+		return nil
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil && !conf.IsFetchPermittedIP(ip) {
+		return ErrFetchNotPermitted
+	}
+
+	return nil
+}
+
+// validateFetchURI validates the host of a Gopher or Gemini uri
+func validateFetchURI(conf *Config, uri string) error {
+	u, err := url.Parse(uri)
+	if err != nil || u.Hostname() == "" {
+		return ErrFetchInvalidURL
+	}
+	if conf.isPodAddr(hostPort(u)) {
+		return nil
+	}
+	if err := ValidateFetchHost(conf, u.Hostname()); err != nil {
+		log.WithError(err).Warnf("%s: not fetching", uri)
+		return err
+	}
+	return nil
+}
+
+// ValidateFetchHost returns an error if host resolves to an address
+// server-side fetches are not permitted to connect to, used by fetches that
+// do not go through NewFetchClient (e.g: Gopher and Gemini feeds)
+func ValidateFetchHost(conf *Config, host string) error {
+	addrs, err := net.DefaultResolver.LookupIPAddr(context.Background(), host)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range addrs {
+		if !conf.IsFetchPermittedIP(ip.IP) {
+			return ErrFetchNotPermitted
+		}
+	}
+
+	return nil
+}
+
+// fetchTransports are the transports of server-side fetches by the settings
+// they depend on (See: fetchTransportKey), so connections are reused across
+// fetches and reloads of the config that leave those settings unchanged
+var fetchTransports = struct {
+	sync.Mutex
+	transports map[string]*http.Transport
+}{transports: make(map[string]*http.Transport)}
+
+// fetchTransportKey returns the settings of the config the transport of
+// server-side fetches depends on: the Pod's address and allowed networks
+func fetchTransportKey(conf *Config) string {
+	var podAddr string
+	if conf.baseURL != nil {
+		podAddr = hostPort(conf.baseURL)
+	}
+	return podAddr + "|" + strings.Join(conf.FetchAllowedNetworks, ",")
+}
+
+func fetchTransport(conf *Config) *http.Transport {
+	fetchTransports.Lock()
+	defer fetchTransports.Unlock()
+
+	key := fetchTransportKey(conf)
+	if transport, ok := fetchTransports.transports[key]; ok {
+		return transport
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+
+		if conf.isPodAddr(addr) {
+			return dialer.DialContext(ctx, network, addr)
+		}
+
+		// Resolve and dial the permitted addresses only, so a host cannot
+		// resolve to a private address after being checked (DNS rebinding)
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+
+		err = ErrFetchNotPermitted
+		for _, ip := range addrs {
+			if !conf.IsFetchPermittedIP(ip.IP) {
+				log.Warnf("denied fetch of %s resolving to %s", host, ip.IP)
+				continue
+			}
+
+			var conn net.Conn
+			conn, err = dialer.DialContext(ctx, network, net.JoinHostPort(ip.IP.String(), port))
+			if err == nil {
+				return conn, nil
+			}
+		}
+		return nil, err
+	}
+
+	fetchTransports.transports[key] = transport
+
+	return transport
+}
+
+// NewFetchClient returns the HTTP client for server-side fetches (feeds,
+// avatars, webmentions, WebSub, IndieAuth, etc) which only connects to
+// permitted addresses (See: Config.IsFetchPermittedIP) and follows up to
+// Config.MaxFetchRedirects redirects to permitted urls
+func NewFetchClient(conf *Config, timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: fetchTransport(conf),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > conf.MaxFetchRedirects {
+				return ErrTooManyRedirects
+			}
+			// The Pod token must not follow a redirect to another host
+			if !IsPodURL(conf, req.URL) {
+				req.Header.Del(podTokenHeader)
+			}
+			return ValidateFetchURL(conf, req.URL.String())
+		},
+	}
+}
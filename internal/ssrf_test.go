@@ -0,0 +1,95 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsFetchPermittedIP(t *testing.T) {
+	conf := &Config{}
+
+	testCases := []struct {
+		ip        string
+		permitted bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.permitted, conf.IsFetchPermittedIP(net.ParseIP(testCase.ip)), testCase.ip)
+	}
+
+	require.NoError(t, WithFetchAllowedNetworks([]string{"10.0.0.0/8", "192.168.1.1"})(conf))
+	assert.True(t, conf.IsFetchPermittedIP(net.ParseIP("10.1.2.3")))
+	assert.True(t, conf.IsFetchPermittedIP(net.ParseIP("192.168.1.1")))
+	assert.False(t, conf.IsFetchPermittedIP(net.ParseIP("192.168.1.2")))
+	assert.False(t, conf.IsFetchPermittedIP(net.ParseIP("169.254.169.254")))
+
+	assert.Error(t, WithFetchAllowedNetworks([]string{"not a network"})(conf))
+}
+
+func TestValidateFetchURL(t *testing.T) {
+	baseURL, err := url.Parse("http://127.0.0.1:8000")
+	require.NoError(t, err)
+	conf := &Config{BaseURL: baseURL.String(), baseURL: baseURL}
+
+	assert.NoError(t, ValidateFetchURL(conf, "https://example.com/twtxt.txt"))
+	assert.NoError(t, ValidateFetchURL(conf, "http://127.0.0.1:8000/user/admin/twtxt.txt"))
+	assert.ErrorIs(t, ValidateFetchURL(conf, "http://127.0.0.1:6379/"), ErrFetchNotPermitted)
+	assert.ErrorIs(t, ValidateFetchURL(conf, "http://127.0.0.1/"), ErrFetchNotPermitted)
+	assert.ErrorIs(t, ValidateFetchURL(conf, "http://169.254.169.254/latest/meta-data/"), ErrFetchNotPermitted)
+	assert.ErrorIs(t, ValidateFetchURL(conf, "http://[::1]:8080/"), ErrFetchNotPermitted)
+	assert.ErrorIs(t, ValidateFetchURL(conf, "file:///etc/passwd"), ErrFetchInvalidURL)
+	assert.ErrorIs(t, ValidateFetchURL(conf, "gopher://example.com/"), ErrFetchInvalidURL)
+	assert.ErrorIs(t, ValidateFetchURL(conf, "/relative"), ErrFetchInvalidURL)
+}
+
+func TestIsPodAddr(t *testing.T) {
+	baseURL, err := url.Parse("https://pod.example")
+	require.NoError(t, err)
+	conf := &Config{BaseURL: baseURL.String(), baseURL: baseURL}
+
+	assert.True(t, conf.isPodAddr("pod.example:443"))
+	assert.True(t, conf.isPodAddr("POD.example:443"))
+	assert.False(t, conf.isPodAddr("pod.example:6379"))
+	assert.False(t, conf.isPodAddr("pod.example:80"))
+	assert.False(t, conf.isPodAddr("pod.example"))
+	assert.False(t, conf.isPodAddr("other.example:443"))
+}
+
+func TestFetchTransportReload(t *testing.T) {
+	newConfig := func(options ...Option) *Config {
+		conf := NewConfig()
+		require.NoError(t, WithBaseURL("https://pod.example")(conf))
+		for _, option := range options {
+			require.NoError(t, option(conf))
+		}
+		return conf
+	}
+
+	// Reloading the config without changing the fetch settings reuses the
+	// transport (and its idle connections) instead of leaking a new one
+	conf := newConfig()
+	assert.Same(t, fetchTransport(conf), fetchTransport(newConfig()))
+
+	assert.NotSame(t, fetchTransport(conf), fetchTransport(newConfig(WithFetchAllowedNetworks([]string{"10.0.0.0/8"}))))
+}
@@ -48,6 +48,68 @@ type Store interface {
 	SyncSession(sess *session.Session) error
 	LenSessions() int64
 	GetAllSessions() ([]*session.Session, error)
+
+	DelPeer(uri string) error
+	GetPeer(uri string) (*ManagedPeer, error)
+	SetPeer(uri string, peer *ManagedPeer) error
+	GetAllPeers() ([]*ManagedPeer, error)
+
+	DelTask(id string) error
+	GetTask(id string) (*TaskRecord, error)
+	SetTask(id string, task *TaskRecord) error
+	GetAllTasks() ([]*TaskRecord, error)
+}
+
+// Kinds of records in a store
+const (
+	StoreKindFeeds    = "feeds"
+	StoreKindPeers    = "peers"
+	StoreKindSessions = "sessions"
+	StoreKindTasks    = "tasks"
+	StoreKindUsers    = "users"
+)
+
+// StoreProblem is a record of a store that cannot be decoded
+type StoreProblem struct {
+	Kind string
+	Name string
+	Err  error
+}
+
+func (p StoreProblem) String() string {
+	return fmt.Sprintf("%s/%s: %s", p.Kind, p.Name, p.Err)
+}
+
+// RawStore is implemented by stores that provide access to their raw records
+// for inspection and repair by admin tools (See: cmd/storectl)
+type RawStore interface {
+	Store
+
+	ListRaw(kind string) ([]string, error)
+	GetRaw(kind, name string) ([]byte, error)
+	SetRaw(kind, name string, data []byte) error
+	DelRaw(kind, name string) error
+	Fsck() ([]StoreProblem, error)
+}
+
+// ValidateStoreRecord returns an error if data is not a valid record of kind
+func ValidateStoreRecord(kind string, data []byte) error {
+	var err error
+	switch kind {
+	case StoreKindFeeds:
+		_, err = LoadFeed(data)
+	case StoreKindPeers:
+		_, err = LoadManagedPeer(data)
+	case StoreKindSessions:
+		err = session.LoadSession(data, &session.Session{})
+	case StoreKindTasks:
+		_, err = LoadTaskRecord(data)
+	case StoreKindUsers:
+		_, err = LoadUser(data)
+	default:
+		err = fmt.Errorf("error: unknown kind of record %q", kind)
+	}
+	return err
 }
 
 type StoreFactory func() (Store, error)
@@ -0,0 +1,181 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"go.yarn.social/types"
+)
+
+const (
+	// summaryMaxItems is the number of conversations, feeds and tags shown
+	// in each section of a summary
+	summaryMaxItems = 10
+
+	// summaryMaxAge is the longest period a summary covers
+	summaryMaxAge = 7 * 24 * time.Hour
+)
+
+// SummaryConversation is a conversation of a summary, Root is nil if the
+// root of the conversation is not cached
+type SummaryConversation struct {
+	Hash   string
+	Root   types.Twt
+	Latest types.Twt
+	Count  int
+}
+
+// SummaryFeed is a feed of a summary
+type SummaryFeed struct {
+	Twter  types.Twter
+	Count  int
+	Latest time.Time
+}
+
+// SummaryTag is a hashtag of a summary
+type SummaryTag struct {
+	Tag   string
+	Count int
+}
+
+// Summary is a "catch up" summary of the twts of a user's timeline since a
+// given time grouped by conversation and by feed with the top hashtags
+type Summary struct {
+	Since time.Time
+	Total int
+
+	Conversations []SummaryConversation
+	Feeds         []SummaryFeed
+	Tags          []SummaryTag
+}
+
+// SummarySince returns the start of a user's summary, the day the user was
+// seen before today bounded by summaryMaxAge
+func SummarySince(user *User) time.Time {
+	since := user.PreviousSeenAt
+	if oldest := time.Now().Add(-summaryMaxAge); since.Before(oldest) {
+		since = oldest
+	}
+	return since
+}
+
+// BuildSummary summarises the (newest first) twts of a timeline created
+// after since, looking up the roots of conversations in the cache
+func BuildSummary(cache *Cache, twts types.Twts, since time.Time) *Summary {
+	summary := &Summary{Since: since}
+
+	convs := make(map[string]*SummaryConversation)
+	feeds := make(map[string]*SummaryFeed)
+	tags := make(map[string]*SummaryTag)
+
+	for _, twt := range twts {
+		if !twt.Created().After(since) {
+			continue
+		}
+		summary.Total++
+
+		hash := ExtractHashFromSubject(twt.Subject().String())
+		if hash == "" {
+			hash = twt.Hash()
+		}
+		conv, ok := convs[hash]
+		if !ok {
+			conv = &SummaryConversation{Hash: hash, Latest: twt}
+			convs[hash] = conv
+		}
+		conv.Count++
+		if twt.Created().After(conv.Latest.Created()) {
+			conv.Latest = twt
+		}
+
+		twter := twt.Twter()
+		feed, ok := feeds[twter.URI]
+		if !ok {
+			feed = &SummaryFeed{Twter: twter}
+			feeds[twter.URI] = feed
+		}
+		feed.Count++
+		if twt.Created().After(feed.Latest) {
+			feed.Latest = twt.Created()
+		}
+
+		for _, tag := range GroupByTag(twt) {
+			if _, ok := tags[tag]; !ok {
+				tags[tag] = &SummaryTag{Tag: tag}
+			}
+			tags[tag].Count++
+		}
+	}
+
+	for _, conv := range convs {
+		// Twts without replies are not conversations
+		if conv.Count < 2 && conv.Latest.Hash() == conv.Hash {
+			continue
+		}
+		if root, ok := cache.Lookup(conv.Hash); ok {
+			conv.Root = root
+		}
+		summary.Conversations = append(summary.Conversations, *conv)
+	}
+	sort.Slice(summary.Conversations, func(i, j int) bool {
+		a, b := summary.Conversations[i], summary.Conversations[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Latest.Created().After(b.Latest.Created())
+	})
+	if len(summary.Conversations) > summaryMaxItems {
+		summary.Conversations = summary.Conversations[:summaryMaxItems]
+	}
+
+	for _, feed := range feeds {
+		summary.Feeds = append(summary.Feeds, *feed)
+	}
+	sort.Slice(summary.Feeds, func(i, j int) bool {
+		a, b := summary.Feeds[i], summary.Feeds[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Latest.After(b.Latest)
+	})
+	if len(summary.Feeds) > summaryMaxItems {
+		summary.Feeds = summary.Feeds[:summaryMaxItems]
+	}
+
+	for _, tag := range tags {
+		summary.Tags = append(summary.Tags, *tag)
+	}
+	sort.Slice(summary.Tags, func(i, j int) bool {
+		a, b := summary.Tags[i], summary.Tags[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Tag < b.Tag
+	})
+	if len(summary.Tags) > summaryMaxItems {
+		summary.Tags = summary.Tags[:summaryMaxItems]
+	}
+
+	return summary
+}
+
+// SummaryHandler shows a "catch up" summary of the user's timeline since
+// they were last seen
+func (s *Server) SummaryHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Translate(s.translator)
+
+		twts := s.cache.GetByUser(ctx.User, false)
+
+		ctx.Title = s.tr(ctx, "SummaryTitle")
+		ctx.Summary = BuildSummary(s.cache, twts, SummarySince(ctx.User))
+
+		s.render("summary", w, ctx)
+	}
+}
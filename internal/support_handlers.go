@@ -84,7 +84,7 @@ func (s *Server) SupportHandler() httprouter.Handle {
 			return
 		}
 
-		if err := SendSupportRequestEmail(s.config, name, email, subject, message); err != nil {
+		if err := SendSupportRequestEmail(s.config(), name, email, subject, message); err != nil {
 			log.WithError(err).Errorf("unable to send support email for %s", email)
 			ctx.Error = true
 			ctx.Message = "Error sending support message! Please try again."
@@ -97,7 +97,7 @@ func (s *Server) SupportHandler() httprouter.Handle {
 		ctx.Error = false
 		ctx.Message = fmt.Sprintf(
 			"Thank you for your message! Pod operator %s will get back to you soon!",
-			s.config.AdminName,
+			s.config().AdminName,
 		)
 		s.render("error", w, ctx)
 	}
@@ -158,7 +158,7 @@ func (s *Server) ReportHandler() httprouter.Handle {
 			return
 		}
 
-		if err := SendReportAbuseEmail(s.config, nick, url, name, email, category, message); err != nil {
+		if err := SendReportAbuseEmail(s.config(), nick, url, name, email, category, message); err != nil {
 			log.WithError(err).Errorf("unable to send report email for %s", email)
 			ctx.Error = true
 			ctx.Message = "Error sending report! Please try again."
@@ -169,7 +169,7 @@ func (s *Server) ReportHandler() httprouter.Handle {
 		ctx.Error = false
 		ctx.Message = fmt.Sprintf(
 			"Thank you for your report! Pod operator %s will get back to you soon!",
-			s.config.AdminName,
+			s.config().AdminName,
 		)
 		s.render("error", w, ctx)
 	}
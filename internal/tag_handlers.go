@@ -0,0 +1,123 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gorilla/feeds"
+	"github.com/julienschmidt/httprouter"
+	log "github.com/sirupsen/logrus"
+	"github.com/vcraescu/go-paginator"
+	"github.com/vcraescu/go-paginator/adapter"
+	"go.yarn.social/types"
+)
+
+// NormalizeTag normalizes a hashtag (without its leading #) as used by the
+// tag views of the cache
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// tagViewKey returns the key of the cache view of twts with a hashtag
+func tagViewKey(tag string) string {
+	return fmt.Sprintf("tag:%s", NormalizeTag(tag))
+}
+
+// getTagTwts returns the twts with a hashtag visible to a user (or anonymous
+// visitors if nil) newest first
+func (s *Server) getTagTwts(user *User, tag string) types.Twts {
+	view := s.cache.GetByUserView(user, tagViewKey(tag), false)
+
+	// Sort a copy so the cached view is never modified
+	twts := make(types.Twts, len(view))
+	copy(twts, view)
+	sort.Sort(twts)
+
+	return twts
+}
+
+// TagHandler shows the twts with a hashtag newest first
+func (s *Server) TagHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx := NewContext(s, r)
+		ctx.Translate(s.translator)
+
+		tag := NormalizeTag(p.ByName("tag"))
+		if tag == "" {
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorNoTag")
+			s.render("error", w, ctx)
+			return
+		}
+
+		twts := s.getTagTwts(ctx.User, tag)
+
+		var pagedTwts types.Twts
+
+		page := SafeParseInt(r.FormValue("p"), 1)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config().TwtsPerPage)
+		pager.SetPage(page)
+
+		if err := pager.Results(&pagedTwts); err != nil {
+			log.WithError(err).Error("error sorting and paging twts")
+			ctx.Error = true
+			ctx.Message = s.tr(ctx, "ErrorLoadingTimeline")
+			s.render("error", w, ctx)
+			return
+		}
+
+		ctx.Alternatives = append(ctx.Alternatives, Alternative{
+			Type:  "application/atom+xml",
+			Title: fmt.Sprintf("#%s Atom Feed", tag),
+			URL:   fmt.Sprintf("%s/atom.xml", URLForTag(s.config().BaseURL, tag)),
+		})
+
+		ctx.Title = s.tr(ctx, "TagTitle", map[string]interface{}{"Tag": tag})
+		ctx.Tag = tag
+		ctx.Twts = s.FilterTwts(ctx.User, pagedTwts)
+		ctx.Pager = &pager
+
+		s.render("tag", w, ctx)
+	}
+}
+
+// TagAtomHandler serves an Atom feed of the (public) twts with a hashtag so
+// visitors can follow a topic
+func (s *Server) TagAtomHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		tag := NormalizeTag(p.ByName("tag"))
+		if tag == "" {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		twts := visibility.Federated(visibility.Filter(s.config(), nil, s.getTagTwts(nil, tag)))
+		if len(twts) > s.config().TwtsPerPage {
+			twts = twts[:s.config().TwtsPerPage]
+		}
+
+		if r.Method == http.MethodHead {
+			defer r.Body.Close()
+			if len(twts) > 0 {
+				w.Header().Set("Last-Modified", twts[0].Created().Format(http.TimeFormat))
+			}
+			return
+		}
+
+		feed := &feeds.Feed{
+			Title:       fmt.Sprintf("#%s on %s", tag, s.config().Name),
+			Link:        &feeds.Link{Href: URLForTag(s.config().BaseURL, tag)},
+			Description: fmt.Sprintf("Twts tagged #%s", tag),
+			Author:      &feeds.Author{Name: s.config().Name, Email: s.config().AdminEmail},
+			Created:     time.Now(),
+		}
+
+		s.writeAtomFeed(w, feed, twts)
+	}
+}
@@ -29,6 +29,37 @@ func (t TaskState) String() string {
 	}
 }
 
+// TaskPriority is the priority of a task, queued tasks of a higher priority
+// are run first
+type TaskPriority int
+
+const (
+	// TaskPriorityBackground is for bulk work nobody is waiting on (e.g:
+	// refreshing the cache or peers), background tasks never take the
+	// workers reserved for other tasks (See: Dispatcher)
+	TaskPriorityBackground TaskPriority = iota - 1
+
+	// TaskPriorityNormal is the default priority of tasks
+	TaskPriorityNormal
+
+	// TaskPriorityInteractive is for tasks a user is waiting on (e.g: media
+	// of an upload or fetching an external feed being viewed)
+	TaskPriorityInteractive
+)
+
+func (p TaskPriority) String() string {
+	switch p {
+	case TaskPriorityBackground:
+		return "background"
+	case TaskPriorityNormal:
+		return "normal"
+	case TaskPriorityInteractive:
+		return "interactive"
+	default:
+		return "unknown"
+	}
+}
+
 type TaskData map[string]string
 
 type TaskResult struct {
@@ -0,0 +1,177 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TaskRecordQueued is a persisted task queued or waiting to be retried
+	TaskRecordQueued = "queued"
+
+	// TaskRecordDead is a persisted task that failed all its attempts (a dead
+	// letter) kept until retried or discarded by the Pod Owner/Operator
+	TaskRecordDead = "dead"
+
+	// maxTaskRetryBackoff bounds the exponential backoff between retries
+	maxTaskRetryBackoff = time.Hour
+)
+
+var (
+	// ErrTaskNotFound is returned for an unknown (persisted) task
+	ErrTaskNotFound = errors.New("error: task not found")
+
+	// ErrUnknownTaskKind is returned for a persisted task of a kind that
+	// cannot be restored
+	ErrUnknownTaskKind = errors.New("error: unknown kind of task")
+)
+
+// PersistentTask is a Task that can be persisted in the Store and restored
+// (See: taskFactories) so it survives restarts and can be retried
+type PersistentTask interface {
+	Task
+
+	// Kind is the kind of the task, also used for concurrency limits
+	Kind() string
+
+	// Args are the arguments the task is restored with
+	Args() TaskData
+}
+
+// TaskFactory restores a persisted task of a kind with its id and arguments
+type TaskFactory func(conf *Config, id string, args TaskData) Task
+
+// taskFactories are the kinds of tasks that can be persisted
+var taskFactories = map[string]TaskFactory{
+	"image": func(conf *Config, id string, args TaskData) Task {
+		task := NewImageTask(conf, args["fn"])
+		task.setID(id)
+		return task
+	},
+	"audio": func(conf *Config, id string, args TaskData) Task {
+		task := NewAudioTask(conf, args["fn"])
+		task.setID(id)
+		return task
+	},
+	"video": func(conf *Config, id string, args TaskData) Task {
+		task := NewVideoTask(conf, args["fn"])
+		task.setID(id)
+		return task
+	},
+	"webmention": func(conf *Config, id string, args TaskData) Task {
+		task := NewWebMentionTask(conf, args["source"], args["target"])
+		task.setID(id)
+		return task
+	},
+}
+
+// TaskRecord is a persisted task
+type TaskRecord struct {
+	ID        string    `json:"id"`
+	Kind      string    `json:"kind"`
+	Args      TaskData  `json:"args"`
+	State     string    `json:"state"`
+	Attempts  int       `json:"attempts"`
+	LastError string    `json:"last_error,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	FailedAt  time.Time `json:"failed_at,omitempty"`
+}
+
+// NewTaskRecord returns the record of a persistent task
+func NewTaskRecord(task PersistentTask) *TaskRecord {
+	return &TaskRecord{
+		ID:        task.ID(),
+		Kind:      task.Kind(),
+		Args:      task.Args(),
+		State:     TaskRecordQueued,
+		CreatedAt: time.Now(),
+	}
+}
+
+// LoadTaskRecord ...
+func LoadTaskRecord(data []byte) (*TaskRecord, error) {
+	record := &TaskRecord{}
+	if err := json.Unmarshal(data, record); err != nil {
+		return nil, err
+	}
+	if _, ok := taskFactories[record.Kind]; !ok {
+		return nil, ErrUnknownTaskKind
+	}
+	return record, nil
+}
+
+// Bytes ...
+func (r *TaskRecord) Bytes() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+// Restore returns a new task from the record
+func (r *TaskRecord) Restore(conf *Config) (Task, error) {
+	factory, ok := taskFactories[r.Kind]
+	if !ok {
+		return nil, ErrUnknownTaskKind
+	}
+	return factory(conf, r.ID, r.Args), nil
+}
+
+// RetryPolicy is the policy for retrying failed persistent tasks, a task is
+// attempted up to MaxRetries times more waiting Backoff doubled after each
+// attempt (bounded by maxTaskRetryBackoff)
+type RetryPolicy struct {
+	MaxRetries int
+	Backoff    time.Duration
+}
+
+// Delay returns the time to wait before the given attempt (the first retry
+// being the attempt 1)
+func (p RetryPolicy) Delay(attempt int) time.Duration {
+	delay := p.Backoff
+	for i := 1; i < attempt && delay < maxTaskRetryBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxTaskRetryBackoff {
+		delay = maxTaskRetryBackoff
+	}
+	return delay
+}
+
+// ParseTaskConcurrency parses per kind limits of the number of tasks run
+// concurrently, e.g: "video=1,audio=2"
+func ParseTaskConcurrency(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("error: invalid task concurrency %q (expected kind=limit)", part)
+		}
+
+		n, err := strconv.Atoi(strings.TrimSpace(kv[1]))
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("error: invalid task concurrency limit %q", part)
+		}
+		limits[strings.TrimSpace(kv[0])] = n
+	}
+
+	return limits, nil
+}
+
+// taskKind returns the kind of a task (empty if not a PersistentTask)
+func taskKind(task Task) string {
+	if pt, ok := task.(PersistentTask); ok {
+		return pt.Kind()
+	}
+	return ""
+}
@@ -0,0 +1,37 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, Backoff: time.Minute}
+
+	assert.Equal(t, time.Minute, policy.Delay(1))
+	assert.Equal(t, 2*time.Minute, policy.Delay(2))
+	assert.Equal(t, 4*time.Minute, policy.Delay(3))
+	assert.Equal(t, maxTaskRetryBackoff, policy.Delay(20))
+}
+
+func TestParseTaskConcurrency(t *testing.T) {
+	limits, err := ParseTaskConcurrency("video=1, audio=2")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"video": 1, "audio": 2}, limits)
+
+	limits, err = ParseTaskConcurrency("")
+	require.NoError(t, err)
+	assert.Empty(t, limits)
+
+	_, err = ParseTaskConcurrency("video")
+	assert.Error(t, err)
+
+	_, err = ParseTaskConcurrency("video=0")
+	assert.Error(t, err)
+}
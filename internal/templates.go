@@ -83,7 +83,11 @@ func NewTemplateManager(conf *Config, translator *Translator, cache *Cache, arch
 	funcMap["hostnameFromURL"] = HostnameFromURL
 	funcMap["baseFromURL"] = BaseFromURL
 	funcMap["prettyURL"] = PrettyURL
+	funcMap["isAutomated"] = automated.IsAutomated
 	funcMap["isLocalURL"] = IsLocalURLFactory(conf)
+	funcMap["isTamperedFeed"] = cache.IsTampered
+	funcMap["isArchivedTwt"] = cache.IsArchived
+	funcMap["mediaURLs"] = GetMediaURLs
 	funcMap["formatTwt"] = FormatTwtFactory(conf, cache, archive)
 	funcMap["unparseTwt"] = UnparseTwtFactory(conf)
 	funcMap["formatTwtContext"] = FormatTwtContextFactory(conf, cache, archive)
@@ -100,14 +104,21 @@ func NewTemplateManager(conf *Config, translator *Translator, cache *Cache, arch
 		return IsFeatureEnabled(conf.Features, name)
 	}
 
+	for name, fn := range plugins.TemplateFuncs() {
+		funcMap[name] = fn
+	}
+
 	funcMap["html"] = func(text string) template.HTML { return template.HTML(text) }
 	funcMap["tr"] = func(ctx *Context, msgid string, data ...interface{}) string {
 		return translator.Translate(ctx, msgid, data...)
 	}
+	funcMap["trn"] = func(ctx *Context, msgid string, count interface{}, data ...interface{}) string {
+		return translator.TranslatePlural(ctx, msgid, count, data...)
+	}
 
 	m := &TemplateManager{
 		debug:   conf.Debug,
-		tmplFS:  conf.TemplatesFS(),
+		tmplFS:  themeFS(conf.TemplatesFS),
 		tmplMap: tmplMap,
 		funcMap: funcMap,
 	}
@@ -143,22 +154,20 @@ func (m *TemplateManager) LoadTemplates() error {
 			t := template.New(name).Option("missingkey=zero")
 			t.Funcs(m.funcMap)
 
-			if f, err := fs.ReadFile(m.tmplFS, path); err == nil {
-				template.Must(t.Parse(string(f)))
-			} else {
-				return fmt.Errorf("error parsing template %s: %w", path, err)
-			}
-
-			if f, err := fs.ReadFile(m.tmplFS, partialsTemplate); err == nil {
-				template.Must(t.Parse(string(f)))
-			} else {
-				return fmt.Errorf("error parsing partials template %s: %w", partialsTemplate, err)
+			// Parse errors are returned rather than panicking as templates
+			// can be reloaded at runtime (e.g. when changing themes)
+			for _, fn := range []string{path, partialsTemplate, baseTemplate} {
+				f, err := fs.ReadFile(m.tmplFS, fn)
+				if err != nil {
+					return fmt.Errorf("error reading template %s: %w", fn, err)
+				}
+				if _, err := t.Parse(string(f)); err != nil {
+					return fmt.Errorf("error parsing template %s: %w", fn, err)
+				}
 			}
 
-			if f, err := fs.ReadFile(m.tmplFS, baseTemplate); err == nil {
-				template.Must(t.Parse(string(f)))
-			} else {
-				return fmt.Errorf("error parsing base template %s: %w", baseTemplate, err)
+			if _, err := t.Parse(plugins.Templates()); err != nil {
+				return fmt.Errorf("error parsing plugin templates: %w", err)
 			}
 
 			m.tmplMap[name] = t
@@ -172,6 +181,27 @@ func (m *TemplateManager) LoadTemplates() error {
 	return nil
 }
 
+// Reload (re)loads the templates of the pod's currently active theme keeping
+// the previously loaded templates if any of them fail to load
+func (m *TemplateManager) Reload() error {
+	m.RLock()
+	tmplMap := make(map[string]*template.Template, len(m.tmplMap))
+	for name, tmpl := range m.tmplMap {
+		tmplMap[name] = tmpl
+	}
+	m.RUnlock()
+
+	if err := m.LoadTemplates(); err != nil {
+		// Keep serving the previously loaded templates
+		m.Lock()
+		m.tmplMap = tmplMap
+		m.Unlock()
+		return err
+	}
+
+	return nil
+}
+
 func (m *TemplateManager) Add(name string, template *template.Template) {
 	m.Lock()
 	defer m.Unlock()
@@ -180,6 +210,16 @@ func (m *TemplateManager) Add(name string, template *template.Template) {
 }
 
 func (m *TemplateManager) Exec(name string, ctx *Context) (io.WriterTo, error) {
+	return m.exec(name, baseName, ctx)
+}
+
+// ExecStandalone executes a template on its own without the base layout
+// (e.g. for embeds)
+func (m *TemplateManager) ExecStandalone(name string, ctx *Context) (io.WriterTo, error) {
+	return m.exec(name, name, ctx)
+}
+
+func (m *TemplateManager) exec(name, layout string, ctx *Context) (io.WriterTo, error) {
 	if m.debug {
 		log.Debug("reloading templates in debug mode...")
 		if err := m.LoadTemplates(); err != nil {
@@ -202,7 +242,7 @@ func (m *TemplateManager) Exec(name string, ctx *Context) (io.WriterTo, error) {
 	}
 
 	buf := bytes.NewBuffer([]byte{})
-	err := template.ExecuteTemplate(buf, baseName, ctx)
+	err := template.ExecuteTemplate(buf, layout, ctx)
 	if err != nil {
 		log.WithError(err).WithField("name", name).Errorf("error executing template")
 		return nil, fmt.Errorf("error executing template %s: %w", name, err)
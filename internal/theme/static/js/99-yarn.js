@@ -195,6 +195,7 @@ u("#newPost").on("toggle", function (e) {
     var text = localStorage.getItem('text');
     if (text) {
       u("textarea#text").first().value = text;
+      updateTextLength();
     }
     u("textarea#text").first().focus();
   }
@@ -616,6 +617,17 @@ u("#imgBtn").on("click", function(e) {
   formatText(u("textarea#text"), "![](url)");
 });
 
+u("#emojiBtn").on("click", function(e) {
+  e.preventDefault();
+  u("#emoji-list").toggleClass("show");
+});
+
+u(".emoji-pick").on("click", function(e) {
+  e.preventDefault();
+  insertText(u("textarea#text"), u(e.currentTarget).data("shortcode") + " ");
+  u("#emoji-list").removeClass("show");
+});
+
 u("#usrBtn").on("click", function(e) {
   e.preventDefault();
   u("textarea#text").first().focus();
@@ -789,6 +801,56 @@ u("#burgerMenu").on("click", function(e) {
   }
 });
 
+// Count the characters (not UTF-16 code units) of the twt composed and warn
+// when it is too long for a single twt and will be offered as a thread
+function updateTextLength() {
+  var text = u("textarea#text").first();
+  if (!text || !u("#textLength").first()) {
+    return;
+  }
+
+  var value = text.value.trim();
+  var length = value.length - (value.match(/[\uD800-\uDBFF][\uDC00-\uDFFF]/g) || []).length;
+  var maxLength = parseInt(u(text).data("maxlength"), 10);
+
+  u("#textLengthCount").text(length);
+  if (maxLength && length > maxLength) {
+    u("#textLength").addClass("over");
+    u("#textLengthWarning").removeClass("invisible");
+  } else {
+    u("#textLength").removeClass("over");
+    u("#textLengthWarning").addClass("invisible");
+  }
+}
+
+u("textarea#text").on("input change focus", updateTextLength);
+updateTextLength();
+
+// Preview the twt composed exactly as it would be posted
+u("#previewBtn").on("click", function(e) {
+  e.preventDefault();
+
+  var preview = u("#textPreview");
+  if (!preview.hasClass("invisible")) {
+    preview.addClass("invisible");
+    return;
+  }
+
+  Twix.ajax({
+    type: "POST",
+    url: "/preview",
+    data: new FormData(u("#form").first()),
+    success: function(data) {
+      preview.html(data.html);
+      preview.removeClass("invisible");
+    },
+  });
+});
+
+u("textarea#text").on("input", function(e) {
+  u("#textPreview").addClass("invisible");
+});
+
 u("textarea#text").on('change click blur paste', function(e) {
   localStorage.setItem("text", u("textarea#text").first().value.trim());
 });
@@ -1146,3 +1208,190 @@ for (var e in ['a#e-media', 'a#v-info', 'span.help',
               'span.vp-d-help', 'span.vp-p-help', 'span.vp-f-help']) {
   if (!e) { document.querySelector(e).addEventListener('click', eiOS); }
 }
+
+/* Keyboard navigation and command palette (actions are served by /actions) */
+var actions = null;
+
+function loadActions(callback) {
+  if (actions !== null) {
+    callback(actions);
+    return;
+  }
+  Twix.ajax({
+    type: "GET",
+    url: "/actions",
+    success: function(data) {
+      actions = typeof data === "string" ? JSON.parse(data) : data;
+      callback(actions);
+    },
+  });
+}
+
+function isTyping(e) {
+  var tag = e.target.tagName;
+  return tag === "INPUT" || tag === "TEXTAREA" || tag === "SELECT" || e.target.isContentEditable;
+}
+
+function selectedTwt() {
+  return u("article.h-entry.selected").first();
+}
+
+function selectTwt(offset) {
+  var twts = u("article.h-entry").nodes;
+  if (twts.length === 0) {
+    return;
+  }
+
+  var idx = twts.indexOf(selectedTwt()) + offset;
+  if (idx < 0) {
+    idx = 0;
+  } else if (idx >= twts.length) {
+    idx = twts.length - 1;
+  }
+
+  u("article.h-entry.selected").removeClass("selected");
+  u(twts[idx]).addClass("selected");
+  twts[idx].scrollIntoView({ block: "center" });
+}
+
+function runAction(action) {
+  closePalette();
+
+  switch (action.id) {
+    case "palette":
+      openPalette("");
+      return;
+    case "search":
+      openPalette("#");
+      return;
+    case "next":
+      selectTwt(1);
+      return;
+    case "prev":
+      selectTwt(-1);
+      return;
+  }
+
+  if (action.twt) {
+    var twt = selectedTwt();
+    if (!twt) {
+      return;
+    }
+    if (action.selector) {
+      var target = u(twt).find(action.selector).filter(function(node) {
+        return node.offsetParent !== null;
+      }).first();
+      if (target) {
+        target.click();
+      }
+      return;
+    }
+    if (action.url) {
+      window.location.href = action.url.replace("{hash}", twt.id);
+    }
+    return;
+  }
+
+  if (action.url) {
+    window.location.href = action.url;
+  }
+}
+
+function closePalette() {
+  u("#palette").remove();
+}
+
+function renderPalette(query) {
+  var list = u("#palette ul");
+  list.empty();
+
+  var q = query.trim().toLowerCase();
+  var matches = actions.filter(function(action) {
+    if (action.twt && !selectedTwt()) {
+      return false;
+    }
+    return action.title.toLowerCase().indexOf(q.replace(/^#/, "")) >= 0;
+  });
+
+  if (q.replace(/^#/, "").length > 0) {
+    var tag = q.replace(/^#/, "");
+    matches.unshift({ id: "tag", title: "#" + tag, url: "/tag/" + encodeURIComponent(tag) });
+  }
+
+  matches.forEach(function(action, idx) {
+    var item = u("<li>").text(action.title);
+    if (action.key) {
+      item.append(u("<kbd>").text(action.key));
+    }
+    if (idx === 0) {
+      item.addClass("selected");
+    }
+    item.on("click", function() {
+      runAction(action);
+    });
+    item.first().action = action;
+    list.append(item);
+  });
+}
+
+function openPalette(query) {
+  if (u("#palette").length > 0) {
+    return;
+  }
+
+  loadActions(function() {
+    var palette = u("<div id='palette' role='dialog'>");
+    var input = u("<input type='search' autocomplete='off'>");
+    palette.append(input);
+    palette.append(u("<ul>"));
+    u("body").append(palette);
+
+    input.first().value = query;
+    input.first().focus();
+    renderPalette(query);
+
+    input.on("input", function() {
+      renderPalette(input.first().value);
+    });
+
+    input.on("keydown", function(e) {
+      var items = u("#palette li").nodes;
+      var idx = items.indexOf(u("#palette li.selected").first());
+
+      if (e.key === "Escape") {
+        e.preventDefault();
+        closePalette();
+      } else if (e.key === "Enter") {
+        e.preventDefault();
+        if (idx >= 0) {
+          runAction(items[idx].action);
+        }
+      } else if (e.key === "ArrowDown" || e.key === "ArrowUp") {
+        e.preventDefault();
+        if (items.length === 0) {
+          return;
+        }
+        var next = (idx + (e.key === "ArrowDown" ? 1 : items.length - 1)) % items.length;
+        u(items).removeClass("selected");
+        u(items[next]).addClass("selected");
+        items[next].scrollIntoView({ block: "nearest" });
+      }
+    });
+  });
+}
+
+u("body").on("keydown", function(e) {
+  if (isTyping(e) || e.ctrlKey || e.metaKey || e.altKey) {
+    return;
+  }
+
+  loadActions(function(actions) {
+    var action = actions.find(function(action) {
+      return action.key === e.key;
+    });
+    if (action) {
+      e.preventDefault();
+      runAction(action);
+    }
+  });
+});
@@ -0,0 +1,119 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/goccy/go-yaml"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// themeInfoFile is the optional metadata file of a theme
+	themeInfoFile = "theme.yaml"
+)
+
+// ThemeInfo describes a theme installed in one of the pod's theme directories
+type ThemeInfo struct {
+	// ID is the name of the theme's directory and is used to select it
+	ID   string `yaml:"-"`
+	Path string `yaml:"-"`
+
+	Name        string `yaml:"name"`
+	Author      string `yaml:"author"`
+	Version     string `yaml:"version"`
+	Description string `yaml:"description"`
+}
+
+// LoadThemeInfo loads the metadata of the theme in dir. Themes without a
+// metadata file are named after their directory.
+func LoadThemeInfo(dir string) (*ThemeInfo, error) {
+	info := &ThemeInfo{
+		ID:   filepath.Base(dir),
+		Path: dir,
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, themeInfoFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := yaml.Unmarshal(data, info); err != nil {
+			return nil, err
+		}
+	}
+
+	if info.Name == "" {
+		info.Name = info.ID
+	}
+
+	return info, nil
+}
+
+// AvailableThemes returns all themes found in the configured theme
+// directories. A theme is any directory with a templates directory.
+func (c *Config) AvailableThemes() []*ThemeInfo {
+	var themes []*ThemeInfo
+
+	seen := make(map[string]bool)
+
+	for _, themesDir := range c.ThemesDirs {
+		entries, err := os.ReadDir(themesDir)
+		if err != nil {
+			log.WithError(err).Warnf("error reading themes directory %s", themesDir)
+			continue
+		}
+
+		for _, entry := range entries {
+			dir := filepath.Join(themesDir, entry.Name())
+			if !entry.IsDir() || seen[entry.Name()] || !FileExists(filepath.Join(dir, "templates")) {
+				continue
+			}
+
+			info, err := LoadThemeInfo(dir)
+			if err != nil {
+				log.WithError(err).Warnf("error loading theme %s", dir)
+				continue
+			}
+
+			seen[info.ID] = true
+			themes = append(themes, info)
+		}
+	}
+
+	sort.Slice(themes, func(i, j int) bool {
+		return themes[i].ID < themes[j].ID
+	})
+
+	return themes
+}
+
+// ThemePath returns the path of the pod's active theme falling back to the
+// configured theme (blank for the builtin theme) if the active theme is not
+// (or no longer) installed.
+func (c *Config) ThemePath() string {
+	if c.ActiveTheme != "" {
+		for _, themesDir := range c.ThemesDirs {
+			dir := filepath.Join(themesDir, filepath.Base(c.ActiveTheme))
+			if FileExists(filepath.Join(dir, "templates")) {
+				return dir
+			}
+		}
+	}
+
+	return c.Theme
+}
+
+// themeFS is a fs.FS that always opens files from the pod's currently active
+// theme so that the active theme can be changed at runtime
+type themeFS func() fs.FS
+
+func (f themeFS) Open(name string) (fs.File, error) {
+	return f().Open(name)
+}
@@ -0,0 +1,176 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"go.yarn.social/types"
+)
+
+const (
+	// threadPartFormat is appended to each part of a thread to number it
+	threadPartFormat = " (%d/%d)"
+
+	// maxThreadParts is the maximum number of twts a twt is split into
+	maxThreadParts = 10
+)
+
+// ErrThreadTooLong is returned when a twt would have to be split into more
+// than maxThreadParts twts
+var ErrThreadTooLong = errors.New("error: twt is too long to split into a thread")
+
+// threadSubjectRegexp matches the subject a reply starts with e.g: (#abcdefg)
+var threadSubjectRegexp = regexp.MustCompile(`^(\(#[a-z0-9]+\))\s*`)
+
+// Thread is a twt longer than the maximum length of twts split into a thread
+// of twts replying to itself. The first part keeps the subject of the twt (if
+// it is a reply) and the other parts reply to the same conversation or, if
+// the twt is not a reply, to the first part.
+type Thread struct {
+	Subject string
+	Parts   []string
+}
+
+// IsThread returns true if the twt was split into more than one part
+func (t Thread) IsThread() bool {
+	return len(t.Parts) > 1
+}
+
+// Text returns the text of the i'th part of the thread where root is the hash
+// of the first part (only used by the other parts of threads not replying to
+// a conversation already)
+func (t Thread) Text(i int, root string) string {
+	subject := t.Subject
+	if subject == "" && i > 0 && root != "" {
+		subject = fmt.Sprintf("(#%s)", root)
+	}
+	if subject == "" {
+		return t.Parts[i]
+	}
+	return fmt.Sprintf("%s %s", subject, t.Parts[i])
+}
+
+// SplitTwt splits the text of a twt longer than maxLength characters into a
+// numbered thread of twts no longer than maxLength characters each including
+// the subject of the reply to the conversation. Text is split at line breaks
+// or spaces where possible but never within a mention or tag.
+func SplitTwt(text string, maxLength, hashLength int) (Thread, error) {
+	if utf8.RuneCountInString(text) <= maxLength {
+		return Thread{Parts: []string{text}}, nil
+	}
+
+	var thread Thread
+	if match := threadSubjectRegexp.FindStringSubmatch(text); match != nil {
+		thread.Subject = match[1]
+		text = text[len(match[0]):]
+	}
+
+	// Leave room for the subject of every part, either the subject of the
+	// twt or (#<hash>) of the first part, followed by a space
+	reserved := len("(#) ") + hashLength
+	if thread.Subject != "" {
+		reserved = utf8.RuneCountInString(thread.Subject) + 1
+	}
+
+	for digits := 1; ; digits++ {
+		n := pow10(digits) - 1
+		size := maxLength - reserved - utf8.RuneCountInString(fmt.Sprintf(threadPartFormat, n, n))
+		if size <= 0 {
+			return Thread{}, ErrThreadTooLong
+		}
+
+		parts := splitText(text, size)
+		if len(parts) > maxThreadParts {
+			return Thread{}, ErrThreadTooLong
+		}
+		if len(parts) > n {
+			continue
+		}
+
+		for i := range parts {
+			parts[i] += fmt.Sprintf(threadPartFormat, i+1, len(parts))
+		}
+		thread.Parts = parts
+
+		return thread, nil
+	}
+}
+
+// PostThread posts the parts of a thread in order and returns the twts
+// posted. Each part is posted a second after the previous part so the parts
+// of the thread are displayed in order.
+func PostThread(appendTwt AppendTwtFunc, user *User, feed *Feed, thread Thread) (types.Twts, error) {
+	var (
+		twts types.Twts
+		root string
+	)
+
+	now := time.Now()
+	for i := range thread.Parts {
+		twt, err := appendTwt(user, feed, thread.Text(i, root), now.Add(time.Duration(i)*time.Second))
+		if err != nil {
+			return twts, err
+		}
+		if i == 0 {
+			root = twt.Hash()
+		}
+		twts = append(twts, twt)
+	}
+
+	return twts, nil
+}
+
+// splitText splits text into parts of at most size characters preferring to
+// split at the last line break or space in the second half of each part
+func splitText(text string, size int) []string {
+	var parts []string
+
+	runes := []rune(strings.TrimSpace(text))
+	for len(runes) > size {
+		cut := size
+		lineBreak, space := -1, -1
+		inMention := false
+		for i, r := range runes[:size+1] {
+			switch {
+			case r == '<' && i > 0 && (runes[i-1] == '@' || runes[i-1] == '#'):
+				inMention = true
+			case r == '>':
+				inMention = false
+			case inMention:
+			case r == '\u2028' || r == '\n':
+				lineBreak = i
+			case unicode.IsSpace(r):
+				space = i
+			}
+		}
+		if lineBreak > size/2 {
+			cut = lineBreak
+		} else if space > size/2 {
+			cut = space
+		}
+
+		parts = append(parts, strings.TrimSpace(string(runes[:cut])))
+		runes = []rune(strings.TrimSpace(string(runes[cut:])))
+	}
+	if len(runes) > 0 {
+		parts = append(parts, string(runes))
+	}
+
+	return parts
+}
+
+func pow10(n int) int {
+	p := 1
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
@@ -0,0 +1,55 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitTwt(t *testing.T) {
+	assert := assert.New(t)
+
+	thread, err := SplitTwt("Hello World", 60, 7)
+	assert.NoError(err)
+	assert.False(thread.IsThread())
+	assert.Equal("Hello World", thread.Text(0, ""))
+
+	text := strings.TrimSpace(strings.Repeat("word ", 30))
+	thread, err = SplitTwt(text, 60, 7)
+	assert.NoError(err)
+	assert.True(thread.IsThread())
+	assert.Empty(thread.Subject)
+
+	var words []string
+	for i, part := range thread.Parts {
+		suffix := fmt.Sprintf(threadPartFormat, i+1, len(thread.Parts))
+		assert.True(strings.HasSuffix(part, suffix))
+		assert.LessOrEqual(utf8.RuneCountInString(thread.Text(i, "abcdefg")), 60)
+		words = append(words, strings.TrimSuffix(part, suffix))
+	}
+	assert.Equal(text, strings.Join(words, " "))
+	assert.False(strings.HasPrefix(thread.Text(0, "abcdefg"), "(#"))
+	assert.True(strings.HasPrefix(thread.Text(1, "abcdefg"), "(#abcdefg) "))
+
+	thread, err = SplitTwt("(#abcdefg) "+text, 60, 7)
+	assert.NoError(err)
+	assert.Equal("(#abcdefg)", thread.Subject)
+	assert.True(strings.HasPrefix(thread.Text(0, "zzzzzzz"), "(#abcdefg) word"))
+	assert.True(strings.HasPrefix(thread.Text(1, "zzzzzzz"), "(#abcdefg) word"))
+
+	_, err = SplitTwt(strings.Repeat("a", 1000), 30, 7)
+	assert.Equal(ErrThreadTooLong, err)
+}
+
+func TestSplitTextMentions(t *testing.T) {
+	assert.Equal(t,
+		[]string{"aaaaaaaaaaaa", "@<nick https://x.y>", "bbb"},
+		splitText("aaaaaaaaaaaa @<nick https://x.y> bbb", 20),
+	)
+}
@@ -0,0 +1,148 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"go.yarn.social/types"
+)
+
+var (
+	// linkRegex matches the links of a twt (markdown links and bare urls)
+	linkRegex = regexp.MustCompile(`\[[^\]]*\]\([^)]*\)|<?https?://[^\s>]+>?`)
+
+	// mentionRegex matches the mentions of a twt, @<nick url> or @<url>
+	mentionRegex = regexp.MustCompile(`@<[^>]+>`)
+)
+
+// TimelineFilters are a user's filters of their timeline and the Discover
+// and Local timelines, applied when the user's views of the cache are built
+// (See: TimelineFilterTwtsFactory)
+type TimelineFilters struct {
+	// HideRepliesToStrangers hides replies that mention none of the feeds
+	// the user follows (nor the user)
+	HideRepliesToStrangers bool `json:"hide_replies_to_strangers"`
+
+	// HideLinkOnly hides twts that consist only of links
+	HideLinkOnly bool `json:"hide_link_only"`
+
+	// MediaOnly only shows twts with media (images, audio, video)
+	MediaOnly bool `json:"media_only"`
+
+	// HideAutomated hides the twts of automated feeds (See: AutomatedFeeds)
+	HideAutomated bool `json:"hide_automated"`
+}
+
+// IsZero returns true if no filters are enabled
+func (f TimelineFilters) IsZero() bool {
+	return !f.HideRepliesToStrangers && !f.HideLinkOnly && !f.MediaOnly && !f.HideAutomated
+}
+
+// Filter filters the twts for a user (or anonymous visitors if nil), a
+// user's own twts are always kept
+func (f TimelineFilters) Filter(u *User, twts types.Twts) types.Twts {
+	if f.IsZero() {
+		return twts
+	}
+
+	filtered := make(types.Twts, 0, len(twts))
+	for _, twt := range twts {
+		if u == nil || !u.Is(twt.Twter().URI) {
+			if f.MediaOnly && !HasMedia(twt) {
+				continue
+			}
+			if f.HideLinkOnly && IsLinkOnly(twt) {
+				continue
+			}
+			if f.HideRepliesToStrangers && IsReplyToStranger(u, twt) {
+				continue
+			}
+			if f.HideAutomated && automated.IsAutomated(twt.Twter().URI) {
+				continue
+			}
+		}
+		filtered = append(filtered, twt)
+	}
+	return filtered
+}
+
+// IsLinkOnly returns true if the text of a twt (without its subject and
+// mentions) consists only of links, twts with media are never link only
+func IsLinkOnly(twt types.Twt) bool {
+	if HasMedia(twt) {
+		return false
+	}
+
+	text := strings.Replace(fmt.Sprintf("%t", twt), twt.Subject().String(), "", 1)
+	text = mentionRegex.ReplaceAllString(text, "")
+	if !linkRegex.MatchString(text) {
+		return false
+	}
+
+	return strings.TrimSpace(linkRegex.ReplaceAllString(text, "")) == ""
+}
+
+// IsReplyToStranger returns true if a twt is a reply (to a conversation)
+// that mentions none of the feeds the user follows nor the user, all replies
+// are replies to strangers of anonymous visitors (nil user)
+func IsReplyToStranger(u *User, twt types.Twt) bool {
+	hash := ExtractHashFromSubject(twt.Subject().String())
+	if hash == "" || hash == twt.Hash() {
+		return false
+	}
+
+	if u == nil {
+		return true
+	}
+
+	for _, mention := range twt.Mentions() {
+		if uri := mention.Twter().URI; u.Follows(uri) || u.Is(uri) {
+			return false
+		}
+	}
+	return true
+}
+
+// TimelineFilterTwtsFactory returns a function that filters twts like
+// FilterTwtsFactory and additionally applies the user's TimelineFilters
+func TimelineFilterTwtsFactory(conf *Config) FilterTwtsFunc {
+	filterTwts := FilterTwtsFactory(conf)
+
+	return func(user *User, twts types.Twts) types.Twts {
+		twts = filterTwts(user, twts)
+		if user == nil || user.Username == "" {
+			return twts
+		}
+		return user.TimelineFilters.Filter(user, twts)
+	}
+}
+
+// TimelineRequest is a paged request of the timeline or the Discover
+// timeline with optional filters applied in addition to the user's own
+// TimelineFilters. Languages filters the Discover timeline to twts in those
+// languages (See: FilterTwtsByLanguage).
+type TimelineRequest struct {
+	Page      int      `json:"page"`
+	Languages []string `json:"languages"`
+
+	TimelineFilters
+}
+
+// NewTimelineRequest ...
+func NewTimelineRequest(r io.Reader) (req TimelineRequest, err error) {
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if len(body) == 0 {
+		return
+	}
+	err = json.Unmarshal(body, &req)
+	return
+}
@@ -0,0 +1,219 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+const (
+	// maxTimelines is the maximum number of materialized timelines kept in
+	// memory, the least recently used timelines are evicted first
+	maxTimelines = 1024
+
+	// maxTimelineTwts is the maximum number of twts of a materialized timeline
+	maxTimelineTwts = 10000
+
+	// maxTimelineAge is how long a materialized timeline is incrementally
+	// updated before it is rebuilt from the cache (dropping expired twts)
+	maxTimelineAge = time.Hour * 24
+)
+
+// Timeline is a user's materialized timeline, the merged twts of the feeds
+// the user follows
+type Timeline struct {
+	user     *User
+	settings string
+	sources  map[string]bool
+	twts     types.Twts
+	built    time.Time
+	lastUsed time.Time
+}
+
+// follows returns true if the timeline includes the twts of the feed url
+func (tl *Timeline) follows(url string) bool {
+	return tl.sources[url] || tl.sources[NormalizeURL(url)]
+}
+
+// timelineSettings returns a hash of the user's settings that determine the
+// user's timeline, the feeds they follow and the twts they filter out
+func timelineSettings(u *User) string {
+	data, _ := json.Marshal(struct {
+		Feeds           []string
+		Following       map[string]string
+		Blocked         map[string]string
+		Muted           map[string]string
+		TimelineFilters TimelineFilters
+		Display         string
+	}{
+		Feeds:           u.Feeds,
+		Following:       u.Following,
+		Blocked:         u.Blocked,
+		Muted:           u.Muted,
+		TimelineFilters: u.TimelineFilters,
+		Display:         u.DisplayTimelinePreference,
+	})
+	return FastHash(data)
+}
+
+// merge merges new twts into the timeline
+func (tl *Timeline) merge(twts types.Twts) {
+	twts = UniqTwts(append(tl.twts, twts...))
+	sort.Sort(twts)
+	tl.twts = FirstNTwts(twts, maxTimelineTwts)
+}
+
+// Timelines are the materialized timelines of users. Timelines are built on
+// first use and then updated incrementally with the new twts of the feeds
+// they follow as these are fetched, rather than recomputed on every refresh.
+type Timelines struct {
+	mu sync.RWMutex
+
+	filterTwts FilterTwtsFunc
+	timelines  map[string]*Timeline
+}
+
+// NewTimelines ...
+func NewTimelines(filterTwts FilterTwtsFunc) *Timelines {
+	return &Timelines{
+		filterTwts: filterTwts,
+		timelines:  make(map[string]*Timeline),
+	}
+}
+
+// Get returns the materialized timeline of a user. The timeline is
+// invalidated if the user's settings changed since it was built (new twts
+// were merged into it with the user's previous settings).
+func (t *Timelines) Get(u *User) (types.Twts, bool) {
+	settings := timelineSettings(u)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	tl, ok := t.timelines[u.Username]
+	if !ok || time.Since(tl.built) > maxTimelineAge {
+		return nil, false
+	}
+	if tl.settings != settings {
+		delete(t.timelines, u.Username)
+		return nil, false
+	}
+	tl.user = u
+	tl.lastUsed = time.Now()
+
+	return tl.twts, true
+}
+
+// Set stores the timeline of a user built from the given twts, evicting the
+// least recently used timeline if there are too many
+func (t *Timelines) Set(u *User, twts types.Twts) {
+	sources := make(map[string]bool)
+	for feed := range u.Sources() {
+		sources[feed.URL] = true
+		sources[NormalizeURL(feed.URL)] = true
+	}
+	settings := timelineSettings(u)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.timelines[u.Username]; !ok && len(t.timelines) >= maxTimelines {
+		var (
+			lru      string
+			lastUsed time.Time
+		)
+		for username, tl := range t.timelines {
+			if lru == "" || tl.lastUsed.Before(lastUsed) {
+				lru, lastUsed = username, tl.lastUsed
+			}
+		}
+		delete(t.timelines, lru)
+	}
+
+	now := time.Now()
+	t.timelines[u.Username] = &Timeline{
+		user:     u,
+		settings: settings,
+		sources:  sources,
+		twts:     FirstNTwts(twts, maxTimelineTwts),
+		built:    now,
+		lastUsed: now,
+	}
+}
+
+// Apply merges the new twts of fetched feeds into the timelines following
+// them. Flat timelines (grouped by conversation) are invalidated instead.
+func (t *Timelines) Apply(deltas FeedDeltas) {
+	if len(deltas) == 0 {
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for username, tl := range t.timelines {
+		var twts types.Twts
+		for _, delta := range deltas {
+			if tl.follows(delta.URL) {
+				twts = append(twts, delta.Twts...)
+			}
+		}
+		if len(twts) == 0 {
+			continue
+		}
+
+		if tl.user.DisplayTimelinePreference == "flat" {
+			delete(t.timelines, username)
+			continue
+		}
+
+		tl.merge(t.filterTwts(tl.user, twts))
+	}
+}
+
+// Snipe removes a twt from all timelines
+func (t *Timelines) Snipe(twt types.Twt) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, tl := range t.timelines {
+		for i, x := range tl.twts {
+			if x.Hash() == twt.Hash() {
+				twts := make(types.Twts, 0, len(tl.twts)-1)
+				twts = append(twts, tl.twts[:i]...)
+				tl.twts = append(twts, tl.twts[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// Delete invalidates the timeline of a user
+func (t *Timelines) Delete(username string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.timelines, username)
+}
+
+// Reset invalidates all timelines
+func (t *Timelines) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.timelines = make(map[string]*Timeline)
+}
+
+// Len returns the number of materialized timelines
+func (t *Timelines) Len() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return len(t.timelines)
+}
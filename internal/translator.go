@@ -6,50 +6,177 @@ package internal
 import (
 	"fmt"
 	"io/fs"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
 
 	"github.com/naoina/toml"
 	"github.com/nicksnyder/go-i18n/v2/i18n"
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
 	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
 
 	"git.mills.io/yarnsocial/yarn/internal/langs"
 )
 
+// builtinLocales are the translations shipped with yarnd
+var builtinLocales = []string{
+	// English
+	"active.en.toml",
+	// Simplified Chinese
+	"active.zh-CN.toml",
+	// Traditional Chinese
+	"active.zh-TW.toml",
+}
+
+// Language describes a language translations are available for
+type Language struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+
+	// Completeness is the percentage of messages translated
+	Completeness float64 `json:"completeness"`
+}
+
 type Translator struct {
+	sync.RWMutex
+
+	conf   *Config
 	Bundle *i18n.Bundle
+
+	// messages are the ids of the messages translated per language
+	messages map[language.Tag]map[string]bool
+}
+
+func NewTranslator(conf *Config) (*Translator, error) {
+	t := &Translator{conf: conf}
+
+	if err := t.Reload(); err != nil {
+		return nil, err
+	}
+
+	return t, nil
 }
 
-func NewTranslator() (*Translator, error) {
+// Reload (re)loads the builtin translations along with any translations found
+// in the langs directory of the pod's active theme which override them
+func (t *Translator) Reload() error {
 	// lang
 	bundle := i18n.NewBundle(language.English)
 	bundle.RegisterUnmarshalFunc("toml", toml.Unmarshal)
-	// English
-	buf, err := fs.ReadFile(langs.LocaleFS, "active.en.toml")
-	if err != nil {
-		return nil, fmt.Errorf("error loading en locale: %w", err)
+
+	messages := make(map[language.Tag]map[string]bool)
+
+	addMessages := func(buf []byte, fn string) error {
+		mf, err := bundle.ParseMessageFileBytes(buf, fn)
+		if err != nil {
+			return err
+		}
+		if _, ok := messages[mf.Tag]; !ok {
+			messages[mf.Tag] = make(map[string]bool)
+		}
+		for _, m := range mf.Messages {
+			messages[mf.Tag][m.ID] = true
+		}
+		return nil
 	}
-	bundle.MustParseMessageFileBytes(buf, "active.en.toml")
-	// Simplified Chinese
-	buf, err = fs.ReadFile(langs.LocaleFS, "active.zh-CN.toml")
-	if err != nil {
-		return nil, fmt.Errorf("error loading zh-CN locale: %w", err)
+
+	for _, fn := range builtinLocales {
+		buf, err := fs.ReadFile(langs.LocaleFS, fn)
+		if err != nil {
+			return fmt.Errorf("error loading locale %s: %w", fn, err)
+		}
+		if err := addMessages(buf, fn); err != nil {
+			return fmt.Errorf("error parsing locale %s: %w", fn, err)
+		}
 	}
-	bundle.MustParseMessageFileBytes(buf, "active.zh-CN.toml")
-	// Traditional Chinese
-	buf, err = fs.ReadFile(langs.LocaleFS, "active.zh-TW.toml")
-	if err != nil {
-		return nil, fmt.Errorf("error loading zh-TW locale: %w", err)
+
+	if theme := t.conf.ThemePath(); theme != "" {
+		fns, err := filepath.Glob(filepath.Join(theme, "langs", "active.*.toml"))
+		if err != nil {
+			return fmt.Errorf("error finding theme locales: %w", err)
+		}
+		for _, fn := range fns {
+			buf, err := ioutil.ReadFile(fn)
+			if err != nil {
+				return fmt.Errorf("error loading theme locale %s: %w", fn, err)
+			}
+			if err := addMessages(buf, fn); err != nil {
+				return fmt.Errorf("error parsing theme locale %s: %w", fn, err)
+			}
+		}
+	}
+
+	t.Lock()
+	t.Bundle = bundle
+	t.messages = messages
+	t.Unlock()
+
+	return nil
+}
+
+// Languages returns the languages translations are available for along with
+// how complete each translation is compared to English
+func (t *Translator) Languages() []Language {
+	t.RLock()
+	defer t.RUnlock()
+
+	total := len(t.messages[language.English])
+
+	var languages []Language
+	for tag, ids := range t.messages {
+		translated := 0
+		for id := range ids {
+			if t.messages[language.English][id] {
+				translated++
+			}
+		}
+
+		completeness := 100.0
+		if total > 0 {
+			completeness = math.Round(float64(translated)/float64(total)*1000) / 10
+		}
+
+		languages = append(languages, Language{
+			Code:         tag.String(),
+			Name:         display.Self.Name(tag),
+			Completeness: completeness,
+		})
+	}
+
+	sort.Slice(languages, func(i, j int) bool {
+		return languages[i].Code < languages[j].Code
+	})
+
+	return languages
+}
+
+func (t *Translator) localize(ctx *Context, conf *i18n.LocalizeConfig) string {
+	t.RLock()
+	bundle := t.Bundle
+	t.RUnlock()
+
+	localizer := i18n.NewLocalizer(bundle, ctx.Lang, ctx.AcceptLangs)
+
+	msg, err := localizer.Localize(conf)
+	if err == nil {
+		return msg
+	}
+
+	// Fall back to English for messages missing from the user's language
+	log.WithError(err).Debugf("error translating %s for %s", conf.MessageID, ctx.Lang)
+	if msg, err = i18n.NewLocalizer(bundle, language.English.String()).Localize(conf); err == nil {
+		return msg
 	}
-	bundle.MustParseMessageFileBytes(buf, "active.zh-TW.toml")
 
-	return &Translator{
-		Bundle: bundle,
-	}, nil
+	log.WithError(err).Warnf("missing translation for %s", conf.MessageID)
+	return conf.MessageID
 }
 
 // Translate 翻译
 func (t *Translator) Translate(ctx *Context, msgID string, data ...interface{}) string {
-	localizer := i18n.NewLocalizer(t.Bundle, ctx.Lang, ctx.AcceptLangs)
-
 	conf := i18n.LocalizeConfig{
 		MessageID: msgID,
 	}
@@ -57,6 +184,21 @@ func (t *Translator) Translate(ctx *Context, msgID string, data ...interface{})
 		conf.TemplateData = data[0]
 	}
 
-	return localizer.MustLocalize(&conf)
+	return t.localize(ctx, &conf)
+}
+
+// TranslatePlural translates a message with plural forms (one, other, ...)
+// selecting the form for count. If no template data is given count is made
+// available to the message as {{ .Count }}.
+func (t *Translator) TranslatePlural(ctx *Context, msgID string, count interface{}, data ...interface{}) string {
+	conf := i18n.LocalizeConfig{
+		MessageID:    msgID,
+		PluralCount:  count,
+		TemplateData: map[string]interface{}{"Count": count},
+	}
+	if len(data) > 0 {
+		conf.TemplateData = data[0]
+	}
 
+	return t.localize(ctx, &conf)
 }
@@ -48,8 +48,44 @@ func DeleteLastTwt(conf *Config, user *User) error {
 
 type AppendTwtFunc func(user *User, feed *Feed, text string, args ...interface{}) (types.Twt, error)
 
+// ExpandTwtFunc makes the twt of a user, or of one of the user's feeds, from
+// the text posted
+type ExpandTwtFunc func(user *User, feed *Feed, text string, created time.Time) types.Twt
+
+// ExpandTwtFactory returns a function that makes twts exactly as they are
+// posted by AppendTwtFactory with their links processed (See: ProcessLinks)
+// and their mentions expanded
+func ExpandTwtFactory(conf *Config, cache *Cache, db Store) ExpandTwtFunc {
+	return func(user *User, feed *Feed, text string, created time.Time) types.Twt {
+		text = ProcessLinks(conf, user, text)
+
+		var twter types.Twter
+
+		if feed == nil {
+			twter = user.Twter(conf)
+		} else {
+			twter = feed.Twter(conf)
+		}
+
+		feedLookupFn := NewMultiFeedLookup(
+			NewUserFollowedFeedLookup(user),
+			NewCachedFeedLookup(cache),
+			NewLocalFeedLookup(conf, db),
+			NewRemoteFeedLookup(conf),
+		)
+
+		// XXX: This is a bit convoluted @xuu can we improve this somehow?
+		tmpTwt := types.MakeTwt(twter, created, strings.TrimSpace(text))
+		tmpTwt.ExpandMentions(conf, feedLookupFn)
+		newText := tmpTwt.FormatText(types.LiteralFmt, conf)
+
+		return types.MakeTwt(twter, created, newText)
+	}
+}
+
 func AppendTwtFactory(conf *Config, cache *Cache, db Store) AppendTwtFunc {
 	isAdminUser := IsAdminUserFactory(conf)
+	expandTwt := ExpandTwtFactory(conf, cache, db)
 	canPostAsFeed := func(user *User, feed *Feed) bool {
 		if user.OwnsFeed(feed.Name) {
 			return true
@@ -66,6 +102,12 @@ func AppendTwtFactory(conf *Config, cache *Cache, db Store) AppendTwtFunc {
 			return types.NilTwt, fmt.Errorf("cowardly refusing to twt empty text, or only spaces")
 		}
 
+		text, err := plugins.OnPost(user, feed, text)
+		if err != nil {
+			log.WithError(err).Warnf("twt from user %s rejected by plugin", user)
+			return types.NilTwt, err
+		}
+
 		p := filepath.Join(conf.Data, feedsDir)
 		if err := os.MkdirAll(p, 0755); err != nil {
 			log.WithError(err).Error("error creating feeds directory")
@@ -99,37 +141,54 @@ func AppendTwtFactory(conf *Config, cache *Cache, db Store) AppendTwtFunc {
 			}
 		}
 
-		var twter types.Twter
+		twt := expandTwt(user, feed, text, now)
 
-		if feed == nil {
-			twter = user.Twter(conf)
-		} else {
-			twter = feed.Twter(conf)
+		line := fmt.Sprintf("%+l\n", twt)
+		if _, err = f.WriteString(line); err != nil {
+			return types.NilTwt, err
 		}
 
-		feedLookupFn := NewMultiFeedLookup(
-			NewUserFollowedFeedLookup(user),
-			NewCachedFeedLookup(cache),
-			NewLocalFeedLookup(conf, db),
-			NewRemoteFeedLookup(conf),
-		)
+		return twt, nil
+	}
+}
 
-		// XXX: This is a bit convoluted @xuu can we improve this somehow?
-		tmpTwt := types.MakeTwt(twter, now, strings.TrimSpace(text))
-		tmpTwt.ExpandMentions(conf, feedLookupFn)
-		newText := tmpTwt.FormatText(types.LiteralFmt, conf)
-		twt := types.MakeTwt(twter, now, newText)
+// webSubPing sends new twts to the WebSub subscribers of a feed so they don't
+// re-fetch the feed (replaced by tests)
+var webSubPing = func(topic string, content []byte) {
+	websub.SendContent(topic, content)
+}
 
-		if _, err = fmt.Fprintf(f, "%+l\n", twt); err != nil {
-			return types.NilTwt, err
-		}
+// webMentions sends the WebMentions of a twt (replaced by tests)
+var webMentions = SendWebMentions
+
+// PublishTwts records the visibility of the twts just posted by a user to a
+// feed, the visibility requested or the user's default (See: PostVisibility),
+// and then federates them as far as their visibility allows. Local-only twts
+// never leave the Pod, WebSub subscribers are only sent twts anyone may see
+// and WebMentions are only sent if tasks is not nil.
+func PublishTwts(conf *Config, tasks *Dispatcher, user *User, feedURL, requested string, twts ...types.Twt) Visibility {
+	twtVisibility := PostVisibility(user, requested)
 
-		if conf.Features.IsEnabled(FeatureWebSub) {
-			websub.SendNotification(conf.URLForUser(user.Username))
+	for _, twt := range twts {
+		if err := visibility.Set(twt.Hash(), feedURL, twtVisibility); err != nil {
+			log.WithError(err).Warnf("error setting visibility of twt %s", twt.Hash())
 		}
+	}
 
-		return twt, nil
+	if twtVisibility == VisibilityLocal {
+		return twtVisibility
 	}
+
+	for _, twt := range twts {
+		if conf.Features.IsEnabled(FeatureWebSub) && visibility.CanView(conf, nil, twt) {
+			webSubPing(twt.Twter().URI, []byte(fmt.Sprintf("%+l\n", twt)))
+		}
+		if tasks != nil {
+			webMentions(conf, tasks, twt)
+		}
+	}
+
+	return twtVisibility
 }
 
 func FeedExists(conf *Config, username string) bool {
@@ -31,31 +31,31 @@ func TestExpandTag(t *testing.T) {
 		}, {
 			name:     "expands a folded tag",
 			input:    "#foo",
-			expected: "#<foo http://0.0.0.0:8000/search?tag=foo>",
+			expected: "#<foo http://0.0.0.0:8000/tag/foo>",
 		}, {
 			name:     "expands a folded tag preceded by a space",
 			input:    " #bar",
-			expected: " #<bar http://0.0.0.0:8000/search?tag=bar>",
+			expected: " #<bar http://0.0.0.0:8000/tag/bar>",
 		}, {
 			name:     "expands a folded tag surrounded with spaces",
 			input:    "foo #bar baz",
-			expected: "foo #<bar http://0.0.0.0:8000/search?tag=bar> baz",
+			expected: "foo #<bar http://0.0.0.0:8000/tag/bar> baz",
 		}, {
 			name:     "expands a folded tag preceded by a parenthesis",
 			input:    "(#bar) baz",
-			expected: "(#<bar http://0.0.0.0:8000/search?tag=bar>) baz",
+			expected: "(#<bar http://0.0.0.0:8000/tag/bar>) baz",
 		}, {
 			name:     "expands a folded tag preceded by a space with parenthesis",
 			input:    " (#bar) baz",
-			expected: " (#<bar http://0.0.0.0:8000/search?tag=bar>) baz",
+			expected: " (#<bar http://0.0.0.0:8000/tag/bar>) baz",
 		}, {
 			name:     "expands a folded tag in enclosed in parentheses",
 			input:    "foo (#bar) baz",
-			expected: "foo (#<bar http://0.0.0.0:8000/search?tag=bar>) baz",
+			expected: "foo (#<bar http://0.0.0.0:8000/tag/bar>) baz",
 		}, {
 			name:     "does nothing with an already expanded tag pointing to local instance",
-			input:    "#<foo http://0.0.0.0:8000/search?tag=foo>",
-			expected: "#<foo http://0.0.0.0:8000/search?tag=foo>",
+			input:    "#<foo http://0.0.0.0:8000/tag/foo>",
+			expected: "#<foo http://0.0.0.0:8000/tag/foo>",
 		}, {
 			name:     "does nothing with an already expanded tag pointing somewhere else",
 			input:    "#<foo https://example.com/foo>",
@@ -4,12 +4,19 @@
 package internal
 
 import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	std_ioutil "io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"git.mills.io/yarnsocial/yarn"
 	"github.com/badgerodon/ioutil"
@@ -30,27 +37,44 @@ const defaultPreambleTemplate = `# Twtxt is an open, distributed microblogging p
 #
 # nick        = {{ .Profile.Nick }}
 # url         = {{ .Profile.URI }}
+{{- if .Profile.Avatar }}
 # avatar      = {{ .Profile.Avatar }}
+{{- end }}
+{{- if .Profile.Description }}
 # description = {{ .Profile.Description }}
+{{- end }}
+{{- if .Automated }}
+# bot         = true
+{{- end }}
 #
-# followers   = {{ if .Profile.ShowFollowers }}{{ .Profile.NFollowers }}{{ end }}
-# following   = {{ if .Profile.ShowFollowing }}{{ .Profile.NFollowing }}{{ end }}
+{{- if .Profile.ShowFollowers }}
+# followers   = {{ .Profile.NFollowers }}
+{{- end }}
+{{- if .Profile.ShowFollowing }}
+# following   = {{ .Profile.NFollowing }}
+{{- end }}
 #
-{{- if .Profile.Links }}
-{{ range $link := .Profile.Links -}}
+{{- range $link := .Profile.Links }}
 # link = {{ $link.Title }} {{ $link.URL }}
-{{ end -}}
-#
-{{ end }}
-#
+{{- end }}
 {{- if .Profile.ShowFollowing }}
-{{ range $f := .Profile.Following -}}
+{{- range $f := .Profile.Following }}
 # follow = {{ $f.Nick }} {{ $f.URI }}
-{{ end -}}
+{{- end }}
+{{- end }}
+{{- with .PrevArchive }}
+# prev = {{ .Hash }} {{ .URL }}
+{{- end }}
 #
-{{ end }}
 `
 
+// preambleCacheTTL is how long a rendered preamble is served unchanged so the
+// byte offsets of twts in a feed stay stable for clients fetching only the
+// data appended since their last fetch with a Range request
+const preambleCacheTTL = time.Hour
+
+var preambleCache = NewTTLCache(preambleCacheTTL)
+
 // TwtxtHandler ...
 func (s *Server) TwtxtHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
@@ -62,7 +86,7 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			return
 		}
 
-		fn, err := securejoin.SecureJoin(filepath.Join(s.config.Data, "feeds"), nick)
+		fn, err := securejoin.SecureJoin(filepath.Join(s.config().Data, "feeds"), nick)
 		if err != nil {
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
@@ -79,13 +103,25 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			return
 		}
 
+		var signingKey ed25519.PrivateKey
+
 		if user, err := s.db.GetUser(nick); err == nil {
-			ctx.Profile = user.Profile(s.config.BaseURL, ctx.User)
+			// Feeds of suspended or disabled accounts are gone
+			if !user.IsActive() {
+				http.Error(w, "Feed Gone", http.StatusGone)
+				return
+			}
+			if user.SigningKey != "" {
+				if signingKey, err = ParseSigningKey(user.SigningKey); err != nil {
+					log.WithError(err).Warnf("error parsing signing key for %s", nick)
+				}
+			}
+			ctx.Profile = user.Profile(s.config().BaseURL, ctx.User)
 			followers := s.cache.GetFollowers(ctx.Profile)
 			ctx.Profile.Followers = followers
 			ctx.Profile.NFollowers = len(followers)
 		} else if feed, err := s.db.GetFeed(nick); err == nil {
-			ctx.Profile = feed.Profile(s.config.BaseURL, ctx.User)
+			ctx.Profile = feed.Profile(s.config().BaseURL, ctx.User)
 			followers := s.cache.GetFollowers(ctx.Profile)
 			ctx.Profile.Followers = followers
 			ctx.Profile.NFollowers = len(followers)
@@ -93,7 +129,7 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			log.WithError(err).Warnf("unable to load user or feed profile for %s", nick)
 		}
 
-		s.tasks.DispatchFunc(func() error {
+		s.tasks.DispatchFuncWithPriority(r.Context(), TaskPriorityBackground, func() error {
 			return s.cache.DetectClientFromRequest(r, ctx.Profile)
 		})
 
@@ -122,7 +158,7 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 		preampleTemplate := pr.Preamble()
 
 		if preampleTemplate == "" {
-			preampleCustomTemplateFn := filepath.Join(s.config.Data, feedsDir, fmt.Sprintf("%s.tpl", nick))
+			preampleCustomTemplateFn := filepath.Join(s.config().Data, feedsDir, fmt.Sprintf("%s.tpl", nick))
 			if FileExists(preampleCustomTemplateFn) {
 				if data, err := std_ioutil.ReadFile(preampleCustomTemplateFn); err == nil {
 					preampleTemplate = string(data)
@@ -137,21 +173,224 @@ func (s *Server) TwtxtHandler() httprouter.Handle {
 			preampleTemplate = defaultPreambleTemplate
 		}
 
-		preamble, err := RenderPlainText(preampleTemplate, ctx)
-		if err != nil {
-			log.WithError(err).Warn("error rendering twtxt preamble")
+		// Metadata values must fit on a single line
+		ctx.Profile.Description = strings.Join(strings.Fields(ctx.Profile.Description), " ")
+
+		ctx.Automated = automated.IsAutomated(ctx.Profile.URI)
+
+		// The most recent archive (if the feed was ever rotated)
+		var archivedAt int64
+		if stat, err := os.Stat(feedArchiveFilename(s.config(), nick, 0)); err == nil {
+			archivedAt = stat.ModTime().UnixNano()
+		}
+
+		// The feed's metadata is part of the key so edits to the nick, avatar
+		// or description and rotations are served straight away
+		preambleKey := fmt.Sprintf(
+			"%s:%s:%d:%t:%x", nick, ctx.Username, archivedAt, ctx.Automated,
+			sha256.Sum256([]byte(preampleTemplate+ctx.Profile.Nick+ctx.Profile.Avatar+ctx.Profile.Description)),
+		)
+		preamble := preambleCache.GetString(preambleKey)
+		if preamble == "" {
+			if archivedAt != 0 {
+				ctx.PrevArchive = GetFeedArchive(s.config(), nick, 0)
+			}
+
+			if preamble, err = RenderPlainText(preampleTemplate, ctx); err != nil {
+				log.WithError(err).Warn("error rendering twtxt preamble")
+			}
+
+			// Signed feeds advertise their public key
+			if signingKey != nil {
+				if _, ok := FeedPublicKey([]byte(preamble)); !ok {
+					preamble += fmt.Sprintf("# %s = %s\n#\n", publicKeyField, FormatPublicKey(signingKey))
+				}
+			}
+
+			preambleCache.SetString(preambleKey, preamble)
 		}
 
 		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-		w.Header().Add("Link", fmt.Sprintf(`<%s/webmention>; rel="webmention"`, s.config.BaseURL))
-		w.Header().Set("Powered-By", fmt.Sprintf("yarnd/%s (Pod: %s Support: %s)", yarn.FullVersion(), s.config.Name, URLForPage(s.config.BaseURL, "support")))
+		w.Header().Add("Link", fmt.Sprintf(`<%s/webmention>; rel="webmention"`, s.config().BaseURL))
+		w.Header().Set("Powered-By", fmt.Sprintf("yarnd/%s (Pod: %s Support: %s)", yarn.FullVersion(), s.config().Name, URLForPage(s.config().BaseURL, "support")))
 
-		if s.config.Features.IsEnabled(FeatureWebSub) {
-			w.Header().Add("Link", fmt.Sprintf(`<%s/websub>; rel="hub"`, s.config.BaseURL))
+		if s.config().Features.IsEnabled(FeatureWebSub) {
+			w.Header().Add("Link", fmt.Sprintf(`<%s/websub>; rel="hub"`, s.config().BaseURL))
 			w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, ctx.Profile.URI))
 		}
 
-		mrs := ioutil.NewMultiReadSeeker(strings.NewReader(preamble), pr)
+		w.Header().Set("Accept-Ranges", "bytes")
+
+		feedURL := s.config().URLForUser(nick)
+		feed, err := s.visibleFeed(w, r, ctx.User, nick, pr)
+		if err != nil {
+			log.WithError(err).Error("error filtering feed")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		data, err := io.ReadAll(feed)
+		if err != nil {
+			log.WithError(err).Error("error reading feed")
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// API-aware clients can ask for only the twts newer than a timestamp
+		// or than the twt with a given hash they have already seen
+		if since := r.URL.Query().Get("since"); since != "" {
+			twter := types.Twter{Nick: nick, URI: feedURL}
+			newer, err := feedTwtsSince(bytes.NewReader(data), twter, since)
+			if err != nil {
+				log.WithError(err).Error("error filtering feed")
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("ETag", feedETag(newer))
+			http.ServeContent(w, r, "", fileInfo.ModTime(), bytes.NewReader(newer))
+			return
+		}
+
+		// Signed feeds carry a detached signature of their twts
+		if signingKey != nil {
+			w.Header().Set(twtxtSignatureHeader, SignFeed(signingKey, data))
+		}
+
+		// A strong validator of the exact bytes served lets clients use
+		// If-None-Match and If-Range safely with Range requests
+		w.Header().Set("ETag", feedETag([]byte(preamble), data))
+
+		mrs := ioutil.NewMultiReadSeeker(strings.NewReader(preamble), bytes.NewReader(data))
 		http.ServeContent(w, r, "", fileInfo.ModTime(), mrs)
 	}
 }
+
+// visibleFeed returns the twts of a local feed (or one of its archives) the
+// request may see. Protected feeds are only served to approved followers,
+// followers-only twts are only served to the feed's owner, its followers and
+// the Pod itself and local-only twts are only served to the Pod itself. As
+// the response then depends on the viewer it is marked as such for caches.
+//
+// Viewers are only recognised by their session on this Pod (or the Pod's own
+// token), there is no signed fetch between Pods. Followers on other Pods are
+// therefore served neither protected feeds nor followers-only twts.
+func (s *Server) visibleFeed(w http.ResponseWriter, r *http.Request, user *User, nick string, feed io.ReadSeeker) (io.ReadSeeker, error) {
+	feedURL := s.config().URLForUser(nick)
+
+	protected := visibility.IsProtected(feedURL)
+	localOnly := visibility.LocalOnly(feedURL)
+	restricted := visibility.Restricted(feedURL)
+
+	// Shared caches must never serve what one viewer may see to another
+	if protected || len(localOnly) > 0 || len(restricted) > 0 {
+		w.Header().Set("Cache-Control", "private, no-cache")
+		w.Header().Add("Vary", fmt.Sprintf("Cookie, Authorization, %s", podTokenHeader))
+	}
+
+	if IsPodRequest(s.config(), r) {
+		return feed, nil
+	}
+
+	if protected && !visibility.IsApproved(user, feedURL) {
+		return strings.NewReader(""), nil
+	}
+
+	hidden := make(map[string]bool)
+	for hash := range localOnly {
+		hidden[hash] = true
+	}
+	if !protected && !CanViewFollowersOnly(s.config(), user, feedURL) {
+		for hash := range restricted {
+			hidden[hash] = true
+		}
+	}
+	if len(hidden) == 0 {
+		return feed, nil
+	}
+
+	return filterFeedTwts(feed, types.Twter{Nick: nick, URI: feedURL}, hidden)
+}
+
+// feedETag returns a strong entity tag of the given parts of a feed
+func feedETag(parts ...[]byte) string {
+	h := sha256.New()
+	for _, part := range parts {
+		h.Write(part)
+	}
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(h.Sum(nil))[:32])
+}
+
+// feedTwtsSince returns the twts of a feed newer than since which is either
+// a RFC 3339 timestamp or the hash of a twt in the feed. If no twt with the
+// hash is found all twts are returned as the client is too far behind.
+func feedTwtsSince(r io.Reader, twter types.Twter, since string) ([]byte, error) {
+	ts, err := time.Parse(time.RFC3339, since)
+	byTime := err == nil
+
+	var (
+		buf   bytes.Buffer
+		lines []string
+	)
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if text := strings.TrimSpace(line); text != "" && !strings.HasPrefix(text, "#") {
+			if twt, err := types.ParseLine(text, &twter); err == nil {
+				switch {
+				case byTime:
+					if twt.Created().After(ts) {
+						buf.WriteString(text + "\n")
+					}
+				case twt.Hash() == since:
+					lines = lines[:0]
+				default:
+					lines = append(lines, text)
+				}
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !byTime {
+		for _, line := range lines {
+			buf.WriteString(line + "\n")
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// filterFeedTwts returns the feed without the twts whose hashes are given
+func filterFeedTwts(r io.Reader, twter types.Twter, hashes map[string]bool) (io.ReadSeeker, error) {
+	var buf bytes.Buffer
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if line != "" {
+			skip := false
+			if text := strings.TrimSpace(line); text != "" && !strings.HasPrefix(text, "#") {
+				if twt, err := types.ParseLine(text, &twter); err == nil && hashes[twt.Hash()] {
+					skip = true
+				}
+			}
+			if !skip {
+				buf.WriteString(line)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return bytes.NewReader(buf.Bytes()), nil
+}
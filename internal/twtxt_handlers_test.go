@@ -0,0 +1,182 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yarn.social/types"
+)
+
+func TestFeedTwtsSince(t *testing.T) {
+	assert := assert.New(t)
+
+	twter := types.Twter{Nick: "alice", URI: "https://example.com/user/alice/twtxt.txt"}
+	feed := `# nick = alice
+2021-01-01T00:00:00Z	first
+2021-01-02T00:00:00Z	second
+2021-01-03T00:00:00Z	third
+`
+
+	second, err := types.ParseLine("2021-01-02T00:00:00Z\tsecond", &twter)
+	assert.NoError(err)
+
+	testCases := []struct {
+		name     string
+		since    string
+		expected string
+	}{
+		{
+			name:     "returns twts newer than a timestamp",
+			since:    "2021-01-01T12:00:00Z",
+			expected: "2021-01-02T00:00:00Z\tsecond\n2021-01-03T00:00:00Z\tthird\n",
+		}, {
+			name:     "returns twts after the twt with a hash",
+			since:    second.Hash(),
+			expected: "2021-01-03T00:00:00Z\tthird\n",
+		}, {
+			name:     "returns all twts for an unknown hash",
+			since:    "abcdefg",
+			expected: "2021-01-01T00:00:00Z\tfirst\n2021-01-02T00:00:00Z\tsecond\n2021-01-03T00:00:00Z\tthird\n",
+		}, {
+			name:     "returns nothing when there are no newer twts",
+			since:    "2021-01-03T00:00:00Z",
+			expected: "",
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			data, err := feedTwtsSince(strings.NewReader(feed), twter, testCase.since)
+			assert.NoError(err)
+			assert.Equal(testCase.expected, string(data))
+		})
+	}
+}
+
+func TestDefaultPreambleTemplate(t *testing.T) {
+	assert := assert.New(t)
+
+	ctx := &Context{
+		InstanceName: "example.com",
+		Profile: types.Profile{
+			Nick:          "alice",
+			URI:           "https://example.com/user/alice/twtxt.txt",
+			Avatar:        "https://example.com/user/alice/avatar#abc",
+			Description:   "Hello from Alice",
+			NFollowers:    3,
+			ShowFollowers: true,
+		},
+		PrevArchive: &FeedArchive{Hash: "abcdefg", URL: "https://example.com/user/alice/archive/0"},
+	}
+
+	preamble, err := RenderPlainText(defaultPreambleTemplate, ctx)
+	assert.NoError(err)
+
+	assert.Contains(preamble, "# nick        = alice\n")
+	assert.Contains(preamble, "# url         = https://example.com/user/alice/twtxt.txt\n")
+	assert.Contains(preamble, "# avatar      = https://example.com/user/alice/avatar#abc\n")
+	assert.Contains(preamble, "# description = Hello from Alice\n")
+	assert.Contains(preamble, "# followers   = 3\n")
+	assert.NotContains(preamble, "# following")
+	assert.Contains(preamble, "# prev = abcdefg https://example.com/user/alice/archive/0\n")
+
+	for _, line := range strings.Split(strings.TrimSuffix(preamble, "\n"), "\n") {
+		assert.True(strings.HasPrefix(line, "#"), "preamble line %q is not a comment", line)
+	}
+
+	report, err := LintFeed(NewConfig(), strings.NewReader(preamble+"2021-01-01T00:00:00Z\tHello World!\n"), ctx.Profile.URI)
+	assert.NoError(err)
+	assert.True(report.Valid(), "%v", report.Problems)
+}
+
+func TestParseFeedPrev(t *testing.T) {
+	assert := assert.New(t)
+
+	feedURL := "https://example.com/user/alice/twtxt.txt"
+
+	hash, prevURL, ok := ParseFeedPrev(feedURL, []byte("# nick = alice\n# prev = abcdefg archive/0\n#\n"))
+	assert.True(ok)
+	assert.Equal("abcdefg", hash)
+	assert.Equal("https://example.com/user/alice/archive/0", prevURL)
+
+	hash, prevURL, ok = ParseFeedPrev(feedURL, []byte("# prev = abcdefg https://other.example/alice.1.txt\n"))
+	assert.True(ok)
+	assert.Equal("abcdefg", hash)
+	assert.Equal("https://other.example/alice.1.txt", prevURL)
+
+	_, _, ok = ParseFeedPrev(feedURL, []byte("# nick = alice\n2021-01-01T00:00:00Z\tprev = abcdefg foo\n"))
+	assert.False(ok)
+}
+
+func TestFeedArchiveHandlerVisibility(t *testing.T) {
+	s := newTestHandlerServer(t)
+
+	tv, err := NewTwtVisibility(s.config())
+	require.NoError(t, err)
+
+	oldVisibility := visibility
+	defer func() { visibility = oldVisibility }()
+	visibility = tv
+
+	bobURL := s.config().URLForUser("bob")
+	twter := types.Twter{Nick: "bob", URI: bobURL}
+	archived := "2021-01-01T00:00:00Z\tHello World!\n" +
+		"2021-01-02T00:00:00Z\tHello followers!\n" +
+		"2021-01-03T00:00:00Z\tHello Pod!\n"
+
+	followers, err := types.ParseLine("2021-01-02T00:00:00Z\tHello followers!", &twter)
+	require.NoError(t, err)
+	local, err := types.ParseLine("2021-01-03T00:00:00Z\tHello Pod!", &twter)
+	require.NoError(t, err)
+	require.NoError(t, tv.Set(followers.Hash(), bobURL, VisibilityFollowers))
+	require.NoError(t, tv.Set(local.Hash(), bobURL, VisibilityLocal))
+
+	fn := feedArchiveFilename(s.config(), "bob", 0)
+	require.NoError(t, os.MkdirAll(filepath.Dir(fn), 0755))
+	require.NoError(t, os.WriteFile(fn, []byte(archived), 0644))
+
+	params := httprouter.Params{{Key: "nick", Value: "bob"}, {Key: "id", Value: "0"}}
+
+	// Anonymous visitors only see the public twts of an archive ...
+	r := httptest.NewRequest(http.MethodGet, "/user/bob/archive/0", nil)
+	w := httptest.NewRecorder()
+	s.FeedArchiveHandler()(w, r, params)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Hello World!")
+	assert.NotContains(t, w.Body.String(), "Hello followers!")
+	assert.NotContains(t, w.Body.String(), "Hello Pod!")
+
+	// ... and shared caches must not serve them to anyone else
+	assert.Contains(t, w.Header().Get("Cache-Control"), "private")
+	assert.Contains(t, w.Header().Get("Vary"), "Cookie")
+	assert.Contains(t, w.Header().Get("Vary"), podTokenHeader)
+
+	// ... while the Pod itself sees all of them
+	r = httptest.NewRequest(http.MethodGet, "/user/bob/archive/0", nil)
+	r.Header.Set(podTokenHeader, PodToken(s.config()))
+	w = httptest.NewRecorder()
+	s.FeedArchiveHandler()(w, r, params)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Hello followers!")
+	assert.Contains(t, w.Body.String(), "Hello Pod!")
+
+	// Protected feeds' archives are empty for anyone not approved
+	bob := &User{Username: "bob", URL: bobURL, Protected: true}
+	tv.Protect(bob)
+
+	r = httptest.NewRequest(http.MethodGet, "/user/bob/archive/0", nil)
+	w = httptest.NewRecorder()
+	s.FeedArchiveHandler()(w, r, params)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "Hello World!")
+}
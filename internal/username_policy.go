@@ -0,0 +1,88 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	// ErrUsernameTooShort is returned for usernames shorter than the minimum
+	// length of the pod's username policy
+	ErrUsernameTooShort = errors.New("error: username is too short")
+
+	// ErrUsernameNotAllowed is returned for usernames containing words
+	// prohibited by the pod's username policy
+	ErrUsernameNotAllowed = errors.New("error: username is not allowed")
+)
+
+// UsernamePolicy decides which usernames may be registered on the pod. The
+// default policy is configured by the Pod Owner/Operator (See:
+// WithUsernamePolicy to replace it).
+type UsernamePolicy interface {
+	// Validate returns an error if the (normalized) username may not be
+	// registered
+	Validate(username string) error
+}
+
+// configUsernamePolicy is the username policy configured in the pod settings
+type configUsernamePolicy struct {
+	conf *Config
+}
+
+func (p configUsernamePolicy) Validate(username string) error {
+	if p.conf.UsernameMinLength > 0 && len(username) < p.conf.UsernameMinLength {
+		return ErrUsernameTooShort
+	}
+
+	if p.conf.UsernameMaxLength > 0 && len(username) > p.conf.UsernameMaxLength {
+		return ErrUsernameTooLong
+	}
+
+	if p.conf.usernamePattern != nil && !p.conf.usernamePattern.MatchString(username) {
+		return ErrInvalidUsername
+	}
+
+	for _, reserved := range p.conf.ReservedUsernames {
+		if username == NormalizeUsername(reserved) {
+			return ErrReservedUsername
+		}
+	}
+
+	for _, word := range p.conf.UsernameProfanity {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" && strings.Contains(username, word) {
+			return ErrUsernameNotAllowed
+		}
+	}
+
+	return nil
+}
+
+// ValidateUsername validates a username before allowing it to be registered
+// against the built-in rules (See: ValidateUsername) and the pod's username
+// policy. The names of special feeds can never be registered whilst the Pod
+// Owner/Operator's own username is exempt from the policy.
+func (c *Config) ValidateUsername(username string) error {
+	username = NormalizeUsername(username)
+
+	if err := ValidateUsername(username); err != nil {
+		return err
+	}
+
+	for _, feed := range specialFeeds {
+		if username == feed {
+			return ErrReservedUsername
+		}
+	}
+
+	if username == NormalizeUsername(c.AdminUser) {
+		return nil
+	}
+
+	if c.usernamePolicy != nil {
+		return c.usernamePolicy.Validate(username)
+	}
+	return configUsernamePolicy{conf: c}.Validate(username)
+}
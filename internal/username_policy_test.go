@@ -0,0 +1,40 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type denyAllUsernamePolicy struct{}
+
+func (denyAllUsernamePolicy) Validate(username string) error { return ErrUsernameNotAllowed }
+
+func TestConfigValidateUsername(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := &Config{
+		AdminUser:         "admin",
+		ReservedUsernames: []string{"admin", "Support"},
+		UsernameMinLength: 3,
+		UsernameMaxLength: 8,
+		UsernameProfanity: []string{"darn"},
+	}
+	assert.NoError(WithUsernamePattern(`^[a-z0-9]+$`)(conf))
+
+	assert.NoError(conf.ValidateUsername("alice"))
+	assert.NoError(conf.ValidateUsername("admin"), "the pod owner is exempt")
+
+	assert.Equal(ErrReservedUsername, conf.ValidateUsername("support"))
+	assert.Equal(ErrReservedUsername, conf.ValidateUsername(statsBot))
+	assert.Equal(ErrUsernameTooShort, conf.ValidateUsername("al"))
+	assert.Equal(ErrUsernameTooLong, conf.ValidateUsername("alexandria"))
+	assert.Equal(ErrInvalidUsername, conf.ValidateUsername("al-ice"))
+	assert.Equal(ErrUsernameNotAllowed, conf.ValidateUsername("darnit"))
+
+	assert.NoError(WithUsernamePolicy(denyAllUsernamePolicy{})(conf))
+	assert.Equal(ErrUsernameNotAllowed, conf.ValidateUsername("alice"))
+}
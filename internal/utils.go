@@ -31,6 +31,7 @@ import (
 	"syscall"
 	text_template "text/template"
 	"time"
+	"unicode"
 
 	// Blank import so we can handle image/jpeg
 
@@ -54,7 +55,6 @@ import (
 	shortuuid "github.com/lithammer/shortuuid/v3"
 	"github.com/makeworld-the-better-one/go-gemini"
 	"github.com/microcosm-cc/bluemonday"
-	"github.com/nullrocks/identicon"
 	sync "github.com/sasha-s/go-deadlock"
 	log "github.com/sirupsen/logrus"
 	"github.com/writeas/slug"
@@ -68,8 +68,9 @@ const (
 	externalDir = "external"
 	mediaDir    = "media"
 
-	newsSpecialUser    = "news"
-	supportSpecialUser = "support"
+	newsSpecialUser          = "news"
+	supportSpecialUser       = "support"
+	announcementsSpecialUser = "announcements"
 
 	me       = "me"
 	statsBot = "stats"
@@ -77,6 +78,7 @@ const (
 	maxUsernameLength   = 15 // avg 6 chars / 2 syllables per name commonly
 	maxFeedNameLength   = 25 // avg 4.7 chars per word in English so ~5 words
 	maxTwtContextLength = 140
+	maxCustomCSSLength  = 8192
 
 	DayAgo   = time.Hour * 24
 	WeekAgo  = DayAgo * 7
@@ -100,6 +102,7 @@ var (
 	specialUsernames = []string{
 		newsSpecialUser,
 		supportSpecialUser,
+		announcementsSpecialUser,
 	}
 	reservedUsernames = []string{
 		me,
@@ -119,7 +122,10 @@ var (
 	multiUserUARegex  = regexp.MustCompile(`(.+) \(~(https?://\S+\/\S+); contact=(https?://\S+)\)`)
 	yarndUserUARegex  = regexp.MustCompile(`(.+) \(Pod: (\S+) Support: (https?://\S+)\)`)
 	mediaURIRegex     = regexp.MustCompile(`\/media\/[a-zA-Z0-9]{16,}\.(png|gif|mp4|mp3)`)
-	yarnURIRegex      = regexp.MustCompile(`@?(\S+)@(\S+)`)
+
+	cssImportPattern = regexp.MustCompile(`(?i)@import[^;]*;?`)
+	cssUnsafePattern = regexp.MustCompile(`(?i)(expression\s*\(|javascript:|behavior\s*:|-moz-binding\s*:)`)
+	cssURLPattern    = regexp.MustCompile(`(?i)url\(\s*([^)]*)\)`)
 
 	ErrInvalidFeedName  = errors.New("error: invalid feed name")
 	ErrBadRequest       = errors.New("error: request failed with non-200 response")
@@ -145,6 +151,32 @@ func DecodeHash(hash string) ([]byte, error) {
 	return encoding.DecodeString(strings.ToUpper(hash))
 }
 
+// IsValidTwtHashLength returns true if n is a supported twt hash length.
+// Twt hashes are a suffix of the base32 encoded (52 character) blake2b sum.
+func IsValidTwtHashLength(n int) bool {
+	return n >= LegacyTwtHashLength && n <= MaxTwtHashLength
+}
+
+// IsValidTwtHash returns true if hash is a well-formed twt hash of either the
+// legacy or the configured length
+func IsValidTwtHash(hash string) bool {
+	if !IsValidTwtHashLength(len(hash)) {
+		return false
+	}
+	bs, err := DecodeHash(hash)
+	return err == nil && len(bs) >= 2
+}
+
+// LegacyTwtHash returns the legacy (7 character) form of a longer twt hash.
+// Since hashes are suffixes of the same sum, this is the hash the twt had
+// before the hash length was increased.
+func LegacyTwtHash(hash string) string {
+	if len(hash) <= LegacyTwtHashLength {
+		return hash
+	}
+	return hash[len(hash)-LegacyTwtHashLength:]
+}
+
 func FastHash(data []byte) string {
 	sum := blake2b.Sum256(data)
 
@@ -167,6 +199,31 @@ func FastHashFile(fn string) (string, error) {
 	return FastHash(data), nil
 }
 
+// SanitizeCSS makes user provided CSS safe to embed in a <style> element by
+// removing anything that could break out of the element, execute scripts or
+// load external resources (to prevent tracking of viewers).
+func SanitizeCSS(baseURL, css string) string {
+	if len(css) > maxCustomCSSLength {
+		css = css[:maxCustomCSSLength]
+	}
+
+	css = strings.NewReplacer("<", "", "\\", "").Replace(css)
+	css = cssImportPattern.ReplaceAllString(css, "")
+	css = cssUnsafePattern.ReplaceAllString(css, "")
+	css = cssURLPattern.ReplaceAllStringFunc(css, func(m string) string {
+		u := strings.Trim(cssURLPattern.FindStringSubmatch(m)[1], `"' `)
+		if strings.HasPrefix(u, "/") && !strings.HasPrefix(u, "//") {
+			return m
+		}
+		if strings.HasPrefix(u, strings.TrimSuffix(baseURL, "/")+"/") {
+			return m
+		}
+		return "none"
+	})
+
+	return strings.TrimSpace(css)
+}
+
 func IntPow(x, y int) int {
 	return int(math.Pow(float64(x), float64(y)))
 }
@@ -182,19 +239,7 @@ func Slugify(uri string) string {
 }
 
 func GenerateAvatar(conf *Config, domainNick string) (image.Image, error) {
-	ig, err := identicon.New(conf.Name, 7, 4)
-	if err != nil {
-		log.WithError(err).Error("error creating identicon generator")
-		return nil, err
-	}
-
-	ii, err := ig.Draw(domainNick)
-	if err != nil {
-		log.WithError(err).Errorf("error generating external avatar for %s", domainNick)
-		return nil, err
-	}
-
-	return ii.Image(conf.AvatarResolution), nil
+	return GenerateAvatarWithStyle(conf, AvatarStyleIdenticon, domainNick, "")
 }
 
 func ReplaceExt(fn, newExt string) string {
@@ -245,10 +290,10 @@ func GetExternalAvatar(conf *Config, twter types.Twter) {
 	log := log.WithField("uri", uri)
 
 	//
-	// Use an already cached Avatar (unless there's a new one!)
+	// Use an already cached Avatar (unless there's a new one or it's stale!)
 	//
 
-	if FileExists(fn) && !HasExternalAvatarChanged(conf, twter) {
+	if FileExists(fn) && !HasExternalAvatarChanged(conf, twter) && !IsExternalAvatarStale(fn) {
 		return
 	}
 
@@ -263,16 +308,33 @@ func GetExternalAvatar(conf *Config, twter types.Twter) {
 		opts := &ImageOptions{Resize: true, Width: conf.AvatarResolution, Height: conf.AvatarResolution}
 		if _, err := DownloadImage(conf, u.String(), externalDir, slug, opts); err != nil {
 			log.WithError(err).Errorf("error downloading external avatar: %s", u)
+			// Keep using the stale avatar and retry after externalAvatarMaxAge
+			if FileExists(fn) {
+				now := time.Now()
+				_ = os.Chtimes(fn, now, now)
+			}
 			return
 		}
+		externalAvatarVersions.Forget(slug)
 		if err := os.WriteFile(ReplaceExt(fn, ".cbf"), []byte(FastHashString(u.String())), 0644); err != nil {
 			log.WithError(err).Warnf("error writing avatar cbf for %s", slug)
 		}
 		return
 	}
+
+	// Touch stale avatars of feeds that no longer advertise one so they
+	// aren't re-validated on every fetch
+	if FileExists(fn) {
+		now := time.Now()
+		_ = os.Chtimes(fn, now, now)
+	}
 }
 
 func RequestGemini(conf *Config, uri string) (*gemini.Response, error) {
+	if err := validateFetchURI(conf, uri); err != nil {
+		return nil, err
+	}
+
 	res, err := gemini.Fetch(uri)
 	if err != nil {
 		log.WithError(err).Errorf("%s: gemini.Fetch fail: %s", uri, err)
@@ -287,6 +349,10 @@ func RequestGemini(conf *Config, uri string) (*gemini.Response, error) {
 }
 
 func RequestGopher(conf *Config, uri string) (*gopher.Response, error) {
+	if err := validateFetchURI(conf, uri); err != nil {
+		return nil, err
+	}
+
 	res, err := gopher.Get(uri)
 	if err != nil {
 		log.WithError(err).Errorf("%s: gopher.Get fail: %s", uri, err)
@@ -301,6 +367,11 @@ func RequestGopher(conf *Config, uri string) (*gopher.Response, error) {
 }
 
 func RequestHTTP(conf *Config, method, url string, headers http.Header) (*http.Response, error) {
+	if err := ValidateFetchURL(conf, url); err != nil {
+		log.WithError(err).Warnf("%s: not fetching", url)
+		return nil, err
+	}
+
 	req, err := http.NewRequest(method, url, nil)
 	if err != nil {
 		log.WithError(err).Errorf("%s: http.NewRequest fail: %s", url, err)
@@ -311,6 +382,16 @@ func RequestHTTP(conf *Config, method, url string, headers http.Header) (*http.R
 		headers = make(http.Header)
 	}
 
+	// Let the Pod fetch its own feeds in full (including followers-only twts)
+	// but never hand the token to anyone else
+	if IsPodURL(conf, req.URL) {
+		if headers.Get(podTokenHeader) == "" {
+			headers.Set(podTokenHeader, PodToken(conf))
+		}
+	} else {
+		headers.Del(podTokenHeader)
+	}
+
 	// Set a default User-Agent (if none set)
 	if headers.Get("User-Agent") == "" {
 		headers.Set(
@@ -324,9 +405,7 @@ func RequestHTTP(conf *Config, method, url string, headers http.Header) (*http.R
 
 	req.Header = headers
 
-	client := http.Client{
-		Timeout: conf.RequestTimeout(),
-	}
+	client := NewFetchClient(conf, conf.RequestTimeout())
 
 	res, err := client.Do(req)
 	if err != nil {
@@ -474,21 +553,6 @@ func GetUserFromURL(conf *Config, db Store, url string) (*User, error) {
 	return db.GetUser(username)
 }
 
-func WebMention(target, source string) error {
-	targetURL, err := url.Parse(target)
-	if err != nil {
-		log.WithError(err).Error("error parsing target url")
-		return err
-	}
-	sourceURL, err := url.Parse(source)
-	if err != nil {
-		log.WithError(err).Error("error parsing source url")
-		return err
-	}
-	webmentions.SendNotification(targetURL, sourceURL)
-	return nil
-}
-
 func StringKeys(kv map[string]string) []string {
 	var res []string
 	for k := range kv {
@@ -650,7 +714,11 @@ type VideoOptions struct {
 }
 
 func DownloadImage(conf *Config, url string, resource, name string, opts *ImageOptions) (string, error) {
-	res, err := http.Get(url)
+	if err := ValidateFetchURL(conf, url); err != nil {
+		return "", err
+	}
+
+	res, err := NewFetchClient(conf, conf.RequestTimeout()).Get(url)
 	if err != nil {
 		log.WithError(err).Errorf("error downloading image from %s", url)
 		return "", err
@@ -1577,6 +1645,34 @@ func URLForTwt(baseURL, hash string) string {
 	)
 }
 
+// URLForConv returns the url of the conversation with the given subject hash
+func URLForConv(baseURL, hash string) string {
+	return fmt.Sprintf(
+		"%s/conv/%s",
+		strings.TrimSuffix(baseURL, "/"),
+		hash,
+	)
+}
+
+// URLForBotPost returns the endpoint bots post to for the given feed
+func URLForBotPost(baseURL, feed string) string {
+	return fmt.Sprintf(
+		"%s/feed/%s/post",
+		strings.TrimSuffix(baseURL, "/"),
+		feed,
+	)
+}
+
+// HashFromTwtURL returns the twt hash of a local twt permalink or an
+// empty string if the url is not a local twt permalink
+func HashFromTwtURL(conf *Config, uri string) string {
+	prefix := URLForTwt(conf.BaseURL, "")
+	if !strings.HasPrefix(uri, prefix) {
+		return ""
+	}
+	return strings.Trim(strings.TrimPrefix(uri, prefix), "/")
+}
+
 func URLForUser(baseURL, username string) string {
 	return fmt.Sprintf(
 		"%s/user/%s/twtxt.txt",
@@ -1606,6 +1702,15 @@ func URLForExternalProfile(conf *Config, nick, uri string) string {
 }
 
 func URLForExternalAvatar(conf *Config, uri string) string {
+	// Bust caches when the avatar changes by including its content hash
+	if version := externalAvatarVersions.Get(conf, Slugify(NormalizeURL(uri))); version != "" {
+		return fmt.Sprintf(
+			"%s/externalAvatar?v=%s&uri=%s",
+			strings.TrimSuffix(conf.BaseURL, "/"),
+			version, uri,
+		)
+	}
+
 	return fmt.Sprintf(
 		"%s/externalAvatar?uri=%s",
 		strings.TrimSuffix(conf.BaseURL, "/"),
@@ -1716,9 +1821,9 @@ func URLForRootConvFactory(conf *Config, cache *Cache, archive Archiver) func(tw
 
 func URLForTag(baseURL, tag string) string {
 	return fmt.Sprintf(
-		"%s/search?tag=%s",
+		"%s/tag/%s",
 		strings.TrimSuffix(baseURL, "/"),
-		tag,
+		NormalizeTag(tag),
 	)
 }
 
@@ -1753,7 +1858,8 @@ func SafeParseInt(s string, d int) int {
 
 // ValidateUsername validates the username before allowing it to be created.
 // This ensures usernames match a defined pattern and that some usernames
-// that are reserved are never used by users.
+// that are reserved are never used by users. The length and other rules of
+// the pod's username policy are checked by Config.ValidateUsername.
 func ValidateUsername(username string) error {
 	username = NormalizeUsername(username)
 
@@ -1767,10 +1873,6 @@ func ValidateUsername(username string) error {
 		}
 	}
 
-	if len(username) > maxUsernameLength {
-		return ErrUsernameTooLong
-	}
-
 	return nil
 }
 
@@ -1815,9 +1917,12 @@ func UnparseTwtFactory(conf *Config) func(twt types.Twt) string {
 type FilterTwtsFunc func(user *User, twts types.Twts) types.Twts
 
 // FilterTwtsFactory returns a function that filters out Twts from users/feeds that a User has chosen to mute
-// or are otherwise shadowed by the Pod (as decided by a Pod Owner/Operator).
+// or are otherwise shadowed by the Pod (as decided by a Pod Owner/Operator) as well as followers-only Twts
+// the User may not see.
 func FilterTwtsFactory(conf *Config) FilterTwtsFunc {
 	return func(user *User, twts types.Twts) types.Twts {
+		twts = visibility.Filter(conf, user, twts)
+
 		if user == nil || user.Username == "" {
 			// fast-path
 			if len(twts) == 0 {
@@ -1864,6 +1969,38 @@ func CleanTwt(text string) string {
 	return text
 }
 
+// rtlScripts are the scripts written from right to left
+var rtlScripts = []*unicode.RangeTable{
+	unicode.Arabic, unicode.Hebrew, unicode.Mandaic, unicode.Nko,
+	unicode.Samaritan, unicode.Syriac, unicode.Thaana,
+}
+
+// TextDirection returns the predominant direction of text, either "rtl" or
+// "ltr", by counting the letters of right-to-left and left-to-right scripts.
+// Mentions, tags and links are ignored.
+func TextDirection(text string) string {
+	var rtl, ltr int
+
+	for _, word := range strings.Fields(text) {
+		if strings.HasPrefix(word, "@") || strings.HasPrefix(word, "#") ||
+			strings.HasPrefix(word, "(#") || strings.Contains(word, "://") {
+			continue
+		}
+		for _, r := range word {
+			if unicode.In(r, rtlScripts...) {
+				rtl++
+			} else if unicode.IsLetter(r) {
+				ltr++
+			}
+		}
+	}
+
+	if rtl > ltr {
+		return "rtl"
+	}
+	return "ltr"
+}
+
 // RenderAudio ...
 func RenderAudio(conf *Config, uri, title, renderAs string, full bool) string {
 	// XXX: `renderAs` is ignored for Audio right now
@@ -2023,7 +2160,12 @@ func PreprocessMedia(user *User, conf *Config, u *url.URL, title, alt, renderAs
 		case ".mp3":
 			html = RenderAudio(conf, u.String(), title, renderAs, full)
 		default:
-			html = RenderImage(user, conf, u.String(), title, alt, renderAs, full)
+			// Serve external images through the media proxy
+			uri := u.String()
+			if !local && !conf.DisableMediaProxy {
+				uri = URLForProxy(conf, uri)
+			}
+			html = RenderImage(user, conf, uri, title, alt, renderAs, full)
 		}
 	} else {
 		var mtype, mtypeIcon string
@@ -2238,9 +2380,24 @@ func FormatTwtFactory(conf *Config, cache *Cache, archive Archiver) func(twt typ
 		p.AllowAttrs("class", "data-target").OnElements("i", "lightbox")
 		p.AllowAttrs("alt", "title", "loading", "data-target", "data-tooltip").OnElements("a", "img")
 		p.AllowAttrs("style").OnElements("a", "code", "img", "p", "pre", "span")
-		html := p.SanitizeBytes(maybeUnsafeHTML)
+		html := emojis.Render(string(p.SanitizeBytes(maybeUnsafeHTML)))
+
+		// Users may override the detected direction of twts
+		dir := ""
+		if user != nil {
+			dir = user.TextDirection
+		}
+		if dir != "ltr" && dir != "rtl" {
+			dir = TextDirection(twt.FormatText(types.TextFmt, conf))
+		}
 
-		return template.HTML(fmt.Sprintf(`<p>%s</p>`, html))
+		// Declare the detected language of twts for screen readers, spell
+		// checkers and translation
+		if lang := twtLanguages.Get(twt); lang != "" {
+			return template.HTML(fmt.Sprintf(`<div dir="%s" lang="%s"><p>%s</p></div>`, dir, lang, html))
+		}
+
+		return template.HTML(fmt.Sprintf(`<div dir="%s"><p>%s</p></div>`, dir, html))
 	}
 }
 
@@ -2262,7 +2419,7 @@ func GetRootTwtFactory(conf *Config, cache *Cache, archive Archiver) func(twt ty
 			return types.NilTwt
 		}
 
-		if u.HasMuted(rootTwt.Twter().URI) {
+		if u.HasMuted(rootTwt.Twter().URI) || u.HasBlocked(rootTwt.Twter().URI) {
 			return types.NilTwt
 		}
 
@@ -2558,41 +2715,12 @@ func NewLocalFeedLookup(conf *Config, db Store) types.FeedLookup {
 
 // NewRemoteFeedLookup returns a `types.FeedLookup` that resolves any @-mentions into
 // `types.Twter()` objects used for later expansion into the proper Twtxt URI
-// mention syntax @<nick url>; This uses a remote lookup mechanism based on a discovery
-// protocol as documetned here: xxx (TBD).
+// mention syntax @<nick url>; This resolves nick@domain mentions of remote feeds
+// via WebFinger, the yarn-uri of pods and well-known feed locations (See: ResolveHandle).
 func NewRemoteFeedLookup(conf *Config) types.FeedLookup {
 	return types.FeedLookupFn(func(alias string) *types.Twter {
-		// TODO: Add caching to avoid duplicate lookups on the same domain?
-		if match := yarnURIRegex.FindStringSubmatch(alias); match != nil {
-			log.Debugf("match: %v", match)
-			nick := match[1]
-			domain := match[2]
-			if baseURI, err := url.Parse(fmt.Sprintf("https://%s", domain)); err == nil {
-				if res, err := RequestHTTP(conf, http.MethodGet, fmt.Sprintf("https://%s", domain), nil); err == nil {
-					defer res.Body.Close()
-					if res.StatusCode == http.StatusOK {
-						if doc, err := goquery.NewDocumentFromReader(res.Body); err == nil {
-							if val, ok := doc.Find(`meta[name="yarn-uri"]`).Attr("content"); ok {
-								log.Debugf("val: %v", val)
-								var uri string
-								if strings.Contains(val, "%s") {
-									uri = fmt.Sprintf(val, nick)
-								} else {
-									uri = val
-								}
-								if u, err := url.Parse(uri); err == nil && !u.IsAbs() {
-									uri = baseURI.ResolveReference(u).String()
-								}
-								log.Debugf("uri: %s", uri)
-								if ResourceExists(conf, uri) {
-									return &types.Twter{Nick: nick, URI: uri}
-								}
-								return &types.Twter{}
-							}
-						}
-					}
-				}
-			}
+		if nick, uri, err := ResolveHandle(conf, alias); err == nil {
+			return &types.Twter{Nick: nick, URI: uri}
 		}
 		return &types.Twter{}
 	})
@@ -245,13 +245,100 @@ func TestFormatTwtFactory(t *testing.T) {
 	), NewUser())
 
 	actual := string(txt)
-	expected := "<p><p><img loading=\"lazy\" src=\"//example.com/hot.png\" title=\"This is title\" alt=\"This is alt\"/></p>\n</p>"
+	expected := "<div dir=\"ltr\"><p><p><img loading=\"lazy\" src=\"//example.com/hot.png\" title=\"This is title\" alt=\"This is alt\"/></p>\n</p></div>"
 	assert.Equal(actual, expected)
 }
 
+func TestTextDirection(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{"Hello World!", "ltr"},
+		{"שלום עולם", "rtl"},
+		{"مرحبا بالعالم", "rtl"},
+		{"@<prologic https://twtxt.net/user/prologic/twtxt.txt> مرحبا", "rtl"},
+		{"مرحبا Hello World", "ltr"},
+		{"", "ltr"},
+	}
+
+	for _, testCase := range testCases {
+		assert.Equal(t, testCase.expected, TextDirection(testCase.text))
+	}
+}
+
 func parseTime(s string) time.Time {
 	if dt, err := time.Parse(time.RFC3339, s); err == nil {
 		return dt
 	}
 	return time.Time{}
 }
+
+func TestSanitizeCSS(t *testing.T) {
+	testCases := []struct {
+		name     string
+		css      string
+		expected string
+	}{
+		{
+			name:     "safe",
+			css:      `.twt { color: red; }`,
+			expected: `.twt { color: red; }`,
+		},
+		{
+			name:     "style breakout",
+			css:      `</style><script>alert(1)</script>`,
+			expected: `/style>script>alert(1)/script>`,
+		},
+		{
+			name:     "import",
+			css:      `@import url("https://evil.com/x.css"); body { color: red; }`,
+			expected: `body { color: red; }`,
+		},
+		{
+			name:     "external url",
+			css:      `body { background: url("https://evil.com/track.png"); }`,
+			expected: `body { background: none; }`,
+		},
+		{
+			name:     "local url",
+			css:      `body { background: url(/media/foo.png); }`,
+			expected: `body { background: url(/media/foo.png); }`,
+		},
+		{
+			name:     "expression",
+			css:      `body { width: expression(alert(1)); }`,
+			expected: `body { width: alert(1)); }`,
+		},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, SanitizeCSS("https://example.com", testCase.css))
+		})
+	}
+}
+
+func TestIsValidTwtHash(t *testing.T) {
+	testCases := []struct {
+		name     string
+		hash     string
+		expected bool
+	}{
+		{name: "legacy", hash: "o6dsrga", expected: true},
+		{name: "long", hash: "ztfskbsao6dsrga", expected: true},
+		{name: "too short", hash: "dsrga", expected: false},
+		{name: "invalid", hash: "o6dsrg!", expected: false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			assert.Equal(t, testCase.expected, IsValidTwtHash(testCase.hash))
+		})
+	}
+}
+
+func TestLegacyTwtHash(t *testing.T) {
+	assert.Equal(t, "o6dsrga", LegacyTwtHash("ztfskbsao6dsrga"))
+	assert.Equal(t, "o6dsrga", LegacyTwtHash("o6dsrga"))
+}
@@ -3,11 +3,7 @@
 
 package internal
 
-import (
-	"fmt"
-
-	log "github.com/sirupsen/logrus"
-)
+import "fmt"
 
 type VideoTask struct {
 	*BaseTask
@@ -17,28 +13,33 @@ type VideoTask struct {
 }
 
 func NewVideoTask(conf *Config, fn string) *VideoTask {
-	return &VideoTask{
+	task := &VideoTask{
 		BaseTask: NewBaseTask(),
 
 		conf: conf,
 		fn:   fn,
 	}
+	// Media tasks are for uploads users are waiting on
+	task.SetPriority(TaskPriorityInteractive)
+	return task
 }
 
 func (t *VideoTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *VideoTask) Kind() string   { return "video" }
+func (t *VideoTask) Args() TaskData { return TaskData{"fn": t.fn} }
 func (t *VideoTask) Run() error {
 	defer t.Done()
 	t.SetState(TaskStateRunning)
 
-	log.Infof("starting video transcode task for %s", t.fn)
+	Logger(LogMedia).Infof("starting video transcode task for %s", t.fn)
 
 	opts := &VideoOptions{} // Resize: true, Size: MediaResolution}
 	mediaURI, err := TranscodeVideo(t.conf, t.fn, mediaDir, "", opts)
 	if err != nil {
-		log.WithError(err).Errorf("error transcoding video %s", t.fn)
+		Logger(LogMedia).WithError(err).Errorf("error transcoding video %s", t.fn)
 		return t.Fail(err)
 	}
-	log.Infof("video transcode complete for %s with uri %s", t.fn, mediaURI)
+	Logger(LogMedia).Infof("video transcode complete for %s with uri %s", t.fn, mediaURI)
 
 	t.SetData("mediaURI", mediaURI)
 
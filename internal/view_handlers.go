@@ -19,7 +19,7 @@ func (s *Server) getTimelineTwts(user *User) types.Twts {
 }
 
 func (s *Server) getDiscoverTwts(user *User) types.Twts {
-	return s.cache.GetByUserView(user, discoverViewKey, false)
+	return RankDiscover(s.config(), user, s.cache.GetByUserView(user, discoverViewKey, false))
 }
 
 func (s *Server) getMentionedTwts(user *User) types.Twts {
@@ -37,7 +37,7 @@ func (s *Server) timelineUpdatedAt(user *User) time.Time {
 }
 
 func (s *Server) discoverUpdatedAt(user *User) time.Time {
-	twts := s.getDiscoverTwts(user)
+	twts := s.cache.GetByUserView(user, discoverViewKey, false)
 
 	if len(twts) > 0 {
 		return twts[0].Created()
@@ -82,13 +82,16 @@ func (s *Server) TimelineHandler() httprouter.Handle {
 
 		var pagedTwts types.Twts
 
+		lite := isLite(r, ctx)
+		perPage := s.twtsPerPage(lite)
+
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), perPage)
 
-		if s.config.Features.IsEnabled(FeatureJumpTimelineAge) {
+		if s.config().Features.IsEnabled(FeatureJumpTimelineAge) {
 			age := SafeParseInt(r.URL.Query().Get("t"), 0)
 			if age > 0 {
-				page = page + FilterTwtsAge(twts, age, s.config.TwtsPerPage)
+				page = page + FilterTwtsAge(twts, age, perPage)
 			}
 		}
 
@@ -103,7 +106,7 @@ func (s *Server) TimelineHandler() httprouter.Handle {
 		}
 
 		if ctx.Authenticated {
-			lastTwt, _, err := GetLastTwt(s.config, ctx.User)
+			lastTwt, _, err := GetLastTwt(s.config(), ctx.User)
 			if err != nil {
 				log.WithError(err).Error("error getting user last twt")
 				ctx.Error = true
@@ -121,6 +124,13 @@ func (s *Server) TimelineHandler() httprouter.Handle {
 			ctx.TimelineUpdatedAt = ctx.Twts[0].Created()
 		}
 
+		s.updateReadPosition(ctx, ReadViewTimeline, page)
+
+		if lite {
+			s.renderLite(w, ctx)
+			return
+		}
+
 		s.render("timeline", w, ctx)
 	}
 }
@@ -136,7 +146,7 @@ func (s *Server) DiscoverHandler() httprouter.Handle {
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config().TwtsPerPage)
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
@@ -148,7 +158,7 @@ func (s *Server) DiscoverHandler() httprouter.Handle {
 		}
 
 		if ctx.Authenticated {
-			lastTwt, _, err := GetLastTwt(s.config, ctx.User)
+			lastTwt, _, err := GetLastTwt(s.config(), ctx.User)
 			if err != nil {
 				log.WithError(err).Error("error getting user last twt")
 				ctx.Error = true
@@ -163,9 +173,9 @@ func (s *Server) DiscoverHandler() httprouter.Handle {
 		ctx.Twts = pagedTwts
 		ctx.Pager = &pager
 
-		if len(ctx.Twts) > 0 {
-			ctx.DiscoverUpdatedAt = ctx.Twts[0].Created()
-		}
+		ctx.DiscoverUpdatedAt = s.discoverUpdatedAt(ctx.User)
+
+		s.updateReadPosition(ctx, ReadViewDiscover, page)
 
 		s.render("timeline", w, ctx)
 	}
@@ -181,7 +191,7 @@ func (s *Server) MentionsHandler() httprouter.Handle {
 		var pagedTwts types.Twts
 
 		page := SafeParseInt(r.FormValue("p"), 1)
-		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config.TwtsPerPage)
+		pager := paginator.New(adapter.NewSliceAdapter(twts), s.config().TwtsPerPage)
 		pager.SetPage(page)
 
 		if err := pager.Results(&pagedTwts); err != nil {
@@ -199,6 +209,8 @@ func (s *Server) MentionsHandler() httprouter.Handle {
 			ctx.LastMentionedAt = ctx.Twts[0].Created()
 		}
 
+		s.updateReadPosition(ctx, ReadViewMentions, page)
+
 		s.render("timeline", w, ctx)
 	}
 }
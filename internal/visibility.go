@@ -0,0 +1,386 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	sync "github.com/sasha-s/go-deadlock"
+	"go.yarn.social/types"
+)
+
+const (
+	visibilityFile = "visibility.json"
+
+	// podTokenHeader is sent by the Pod when fetching its own feeds so that
+	// the cache receives every twt regardless of its visibility
+	podTokenHeader = "X-Yarn-Pod-Token"
+)
+
+// Visibility is the audience of a twt
+type Visibility string
+
+const (
+	// VisibilityPublic twts are visible to everyone (the default)
+	VisibilityPublic Visibility = "public"
+
+	// VisibilityUnlisted twts are kept out of the Pod's Discover and Local
+	// timelines but are otherwise public
+	VisibilityUnlisted Visibility = "unlisted"
+
+	// VisibilityFollowers twts are only served to followers of the feed
+	VisibilityFollowers Visibility = "followers"
+
+	// VisibilityLocal twts are shown on the Pod but left out of the served
+	// twtxt.txt and Atom feeds so they never federate
+	VisibilityLocal Visibility = "local"
+)
+
+// ParseVisibility parses a visibility defaulting to VisibilityPublic
+func ParseVisibility(s string) Visibility {
+	switch v := Visibility(strings.ToLower(strings.TrimSpace(s))); v {
+	case VisibilityUnlisted, VisibilityFollowers, VisibilityLocal:
+		return v
+	default:
+		return VisibilityPublic
+	}
+}
+
+// PostVisibility parses the visibility of a twt posted by the user, twts
+// posted without a visibility are local-only if the user posts local-only
+// twts by default
+func PostVisibility(user *User, s string) Visibility {
+	if strings.TrimSpace(s) == "" && user.LocalOnly {
+		return VisibilityLocal
+	}
+	return ParseVisibility(s)
+}
+
+type twtVisibility struct {
+	Feed       string     `json:"feed"`
+	Visibility Visibility `json:"visibility"`
+}
+
+// TwtVisibility records the visibility of local twts that are not public and
+// is persisted in the data directory. It also keeps track of the approved
+// followers of protected accounts and the feeds of users who opted out of
+// the Discover and Local timelines. A nil *TwtVisibility treats every twt as
+// public.
+type TwtVisibility struct {
+	sync.RWMutex
+
+	conf *Config
+	twts map[string]twtVisibility
+
+	// protected maps the feeds of protected accounts to the URLs of their
+	// approved followers
+	protected map[string]map[string]bool
+
+	// unlisted are the feeds of users whose twts are kept out of the Pod's
+	// Discover and Local timelines (See: User.Unlisted)
+	unlisted map[string]bool
+}
+
+// NewTwtVisibility ...
+func NewTwtVisibility(conf *Config) (*TwtVisibility, error) {
+	tv := &TwtVisibility{
+		conf:      conf,
+		twts:      make(map[string]twtVisibility),
+		protected: make(map[string]map[string]bool),
+		unlisted:  make(map[string]bool),
+	}
+
+	data, err := ioutil.ReadFile(tv.filename())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tv, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &tv.twts); err != nil {
+		return nil, err
+	}
+
+	return tv, nil
+}
+
+func (tv *TwtVisibility) filename() string {
+	return filepath.Join(tv.conf.Data, visibilityFile)
+}
+
+func (tv *TwtVisibility) save() error {
+	data, err := json.Marshal(tv.twts)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(tv.filename(), data, 0644)
+}
+
+// Get returns the visibility of the twt with the given hash
+func (tv *TwtVisibility) Get(hash string) Visibility {
+	if tv == nil {
+		return VisibilityPublic
+	}
+
+	tv.RLock()
+	defer tv.RUnlock()
+
+	if v, ok := tv.twts[hash]; ok {
+		return v.Visibility
+	}
+	return VisibilityPublic
+}
+
+// Set sets the visibility of a twt posted to the given feed
+func (tv *TwtVisibility) Set(hash, feed string, v Visibility) error {
+	if tv == nil {
+		return nil
+	}
+
+	tv.Lock()
+	defer tv.Unlock()
+
+	if v == VisibilityPublic {
+		if _, ok := tv.twts[hash]; !ok {
+			return nil
+		}
+		delete(tv.twts, hash)
+	} else {
+		tv.twts[hash] = twtVisibility{Feed: NormalizeURL(feed), Visibility: v}
+	}
+
+	return tv.save()
+}
+
+// hashes returns the hashes of the twts of a feed with the given visibility
+func (tv *TwtVisibility) hashes(feed string, visibility Visibility) map[string]bool {
+	if tv == nil {
+		return nil
+	}
+
+	tv.RLock()
+	defer tv.RUnlock()
+
+	feed = NormalizeURL(feed)
+
+	hashes := make(map[string]bool)
+	for hash, v := range tv.twts {
+		if v.Visibility == visibility && v.Feed == feed {
+			hashes[hash] = true
+		}
+	}
+	return hashes
+}
+
+// Restricted returns the hashes of the followers-only twts of a feed
+func (tv *TwtVisibility) Restricted(feed string) map[string]bool {
+	return tv.hashes(feed, VisibilityFollowers)
+}
+
+// LocalOnly returns the hashes of the local-only twts of a feed
+func (tv *TwtVisibility) LocalOnly(feed string) map[string]bool {
+	return tv.hashes(feed, VisibilityLocal)
+}
+
+// Protect updates the approved followers of a user's feed, or forgets them
+// if the user's account is no longer protected
+func (tv *TwtVisibility) Protect(user *User) {
+	if tv == nil {
+		return
+	}
+
+	tv.Lock()
+	defer tv.Unlock()
+
+	feed := NormalizeURL(user.URL)
+
+	if !user.Protected {
+		delete(tv.protected, feed)
+		return
+	}
+
+	approved := make(map[string]bool, len(user.Followers))
+	for _, uri := range user.Followers {
+		approved[NormalizeURL(uri)] = true
+	}
+	tv.protected[feed] = approved
+}
+
+// IsProtected returns true if the feed belongs to a protected account
+func (tv *TwtVisibility) IsProtected(feed string) bool {
+	if tv == nil {
+		return false
+	}
+
+	tv.RLock()
+	defer tv.RUnlock()
+
+	_, ok := tv.protected[NormalizeURL(feed)]
+	return ok
+}
+
+// Unlist keeps the twts of a user's feed out of the Pod's Discover and Local
+// timelines if the user opted out of them, or lists them again
+func (tv *TwtVisibility) Unlist(user *User) {
+	if tv == nil {
+		return
+	}
+
+	tv.Lock()
+	defer tv.Unlock()
+
+	feed := NormalizeURL(user.URL)
+
+	if user.Unlisted {
+		tv.unlisted[feed] = true
+	} else {
+		delete(tv.unlisted, feed)
+	}
+}
+
+// IsUnlisted returns true if the feed's twts are kept out of the Pod's
+// Discover and Local timelines
+func (tv *TwtVisibility) IsUnlisted(feed string) bool {
+	if tv == nil {
+		return false
+	}
+
+	tv.RLock()
+	defer tv.RUnlock()
+
+	return tv.unlisted[NormalizeURL(feed)]
+}
+
+// IsApproved returns true if the user (nil for anonymous visitors) may see
+// the twts of a protected feed
+func (tv *TwtVisibility) IsApproved(user *User, feed string) bool {
+	if user == nil || user.IsZero() {
+		return false
+	}
+
+	if user.Is(feed) {
+		return true
+	}
+
+	if tv == nil {
+		return false
+	}
+
+	tv.RLock()
+	defer tv.RUnlock()
+
+	return tv.protected[NormalizeURL(feed)][NormalizeURL(user.URL)]
+}
+
+// Listed returns false if a twt must be kept out of the Pod's Discover and
+// Local timelines
+func (tv *TwtVisibility) Listed(twt types.Twt) bool {
+	switch tv.Get(twt.Hash()) {
+	case VisibilityPublic, VisibilityLocal:
+		uri := twt.Twter().URI
+		return !tv.IsProtected(uri) && !tv.IsUnlisted(uri)
+	default:
+		return false
+	}
+}
+
+// Federated filters out the local-only twts which must never leave the Pod
+func (tv *TwtVisibility) Federated(twts types.Twts) types.Twts {
+	if tv == nil || len(twts) == 0 {
+		return twts
+	}
+
+	federated := make(types.Twts, 0, len(twts))
+	for _, twt := range twts {
+		if tv.Get(twt.Hash()) != VisibilityLocal {
+			federated = append(federated, twt)
+		}
+	}
+	return federated
+}
+
+// CanView returns true if the user (nil for anonymous visitors) may see the
+// twt. Twts of protected accounts are only visible to approved followers and
+// followers-only twts are only visible to their author and followers.
+func (tv *TwtVisibility) CanView(conf *Config, user *User, twt types.Twt) bool {
+	if tv.IsProtected(twt.Twter().URI) {
+		return tv.IsApproved(user, twt.Twter().URI)
+	}
+	if tv.Get(twt.Hash()) != VisibilityFollowers {
+		return true
+	}
+	return CanViewFollowersOnly(conf, user, twt.Twter().URI)
+}
+
+// Filter filters out the twts the user (nil for anonymous visitors) may not see
+func (tv *TwtVisibility) Filter(conf *Config, user *User, twts types.Twts) types.Twts {
+	if tv == nil || len(twts) == 0 {
+		return twts
+	}
+
+	filtered := make(types.Twts, 0, len(twts))
+	for _, twt := range twts {
+		if tv.CanView(conf, user, twt) {
+			filtered = append(filtered, twt)
+		}
+	}
+	return filtered
+}
+
+// CanViewFollowersOnly returns true if the user owns or follows the feed
+func CanViewFollowersOnly(conf *Config, user *User, feed string) bool {
+	if user == nil || user.IsZero() {
+		return false
+	}
+
+	if user.Is(feed) || user.Follows(feed) {
+		return true
+	}
+
+	for _, name := range user.Feeds {
+		if NormalizeURL(conf.URLForUser(name)) == NormalizeURL(feed) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// PodToken returns the secret token the Pod sends when fetching its own feeds
+func PodToken(conf *Config) string {
+	return FastHashString("pod-token:" + conf.APISigningKey)
+}
+
+// IsPodURL returns true if uri points at this Pod, comparing the scheme and
+// host exactly against the configured base url (unlike IsLocalURL which only
+// checks for a common prefix)
+func IsPodURL(conf *Config, uri *url.URL) bool {
+	if uri == nil {
+		return false
+	}
+
+	base, err := url.Parse(conf.BaseURL)
+	if err != nil || base.Host == "" {
+		return false
+	}
+
+	return strings.EqualFold(uri.Scheme, base.Scheme) && strings.EqualFold(uri.Host, base.Host)
+}
+
+// IsPodRequest returns true if the request was made by the Pod itself
+func IsPodRequest(conf *Config, r *http.Request) bool {
+	token := r.Header.Get(podTokenHeader)
+	if token == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(token), []byte(PodToken(conf))) == 1
+}
@@ -0,0 +1,236 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.yarn.social/types"
+)
+
+func TestTwtVisibilityLocalOnly(t *testing.T) {
+	tv, err := NewTwtVisibility(&Config{Data: t.TempDir()})
+	require.NoError(t, err)
+
+	public := types.MakeTwt(testLocalTwter, time.Now(), "Hello World!")
+	local := types.MakeTwt(testLocalTwter, time.Now(), "Hello Pod!")
+	require.NoError(t, tv.Set(local.Hash(), testLocalFeed, VisibilityLocal))
+
+	// Local-only twts are shown on the Pod ...
+	assert.True(t, tv.Listed(local))
+	assert.True(t, tv.CanView(testConfig, nil, local))
+
+	// ... but never federated
+	assert.Equal(t, types.Twts{public}, tv.Federated(types.Twts{public, local}))
+	assert.Equal(t, map[string]bool{local.Hash(): true}, tv.LocalOnly(testLocalFeed))
+	assert.Empty(t, tv.Restricted(testLocalFeed))
+}
+
+func TestPostVisibility(t *testing.T) {
+	user := &User{}
+	assert.Equal(t, VisibilityPublic, PostVisibility(user, ""))
+	assert.Equal(t, VisibilityLocal, PostVisibility(user, "local"))
+
+	user.LocalOnly = true
+	assert.Equal(t, VisibilityLocal, PostVisibility(user, ""))
+	assert.Equal(t, VisibilityPublic, PostVisibility(user, "public"))
+}
+
+func TestPublishTwtsFederation(t *testing.T) {
+	conf := &Config{Data: t.TempDir(), Features: NewFeatureFlags()}
+	conf.Features.Enable(FeatureWebSub)
+
+	tv, err := NewTwtVisibility(conf)
+	require.NoError(t, err)
+
+	oldVisibility, oldWebSubPing, oldWebMentions := visibility, webSubPing, webMentions
+	defer func() { visibility, webSubPing, webMentions = oldVisibility, oldWebSubPing, oldWebMentions }()
+
+	var pinged, mentioned []string
+	visibility = tv
+	webSubPing = func(topic string, content []byte) { pinged = append(pinged, topic) }
+	webMentions = func(conf *Config, tasks *Dispatcher, twt types.Twt) { mentioned = append(mentioned, twt.Hash()) }
+
+	tasks := NewDispatcher(1, 1)
+	user := &User{Username: testLocalNick, URL: testLocalFeed}
+
+	// Local-only twts never leave the Pod
+	local := types.MakeTwt(testLocalTwter, time.Now(), "Hello Pod!")
+	assert.Equal(t, VisibilityLocal, PublishTwts(conf, tasks, user, testLocalFeed, "local", local))
+	assert.Equal(t, VisibilityLocal, tv.Get(local.Hash()))
+	assert.Empty(t, pinged)
+	assert.Empty(t, mentioned)
+
+	// Neither do the twts of users who post local-only twts by default
+	user.LocalOnly = true
+	local = types.MakeTwt(testLocalTwter, time.Now(), "Hello again Pod!")
+	assert.Equal(t, VisibilityLocal, PublishTwts(conf, tasks, user, testLocalFeed, "", local))
+	assert.Empty(t, pinged)
+	assert.Empty(t, mentioned)
+	user.LocalOnly = false
+
+	// Followers-only twts are not sent to WebSub subscribers
+	followers := types.MakeTwt(testLocalTwter, time.Now(), "Hello followers!")
+	PublishTwts(conf, tasks, user, testLocalFeed, "followers", followers)
+	assert.Empty(t, pinged)
+
+	public := types.MakeTwt(testLocalTwter, time.Now(), "Hello World!")
+	PublishTwts(conf, tasks, user, testLocalFeed, "", public)
+	assert.Equal(t, []string{testLocalFeed}, pinged)
+	assert.Contains(t, mentioned, public.Hash())
+}
+
+func TestIsPodURL(t *testing.T) {
+	conf := &Config{BaseURL: "https://pod.example.com"}
+
+	testCases := []struct {
+		uri      string
+		expected bool
+	}{
+		{"https://pod.example.com/user/admin/twtxt.txt", true},
+		{"https://POD.example.com/user/admin/twtxt.txt", true},
+		{"http://pod.example.com/user/admin/twtxt.txt", false},
+		{"https://pod.example.com.evil.com/user/admin/twtxt.txt", false},
+		{"https://pod.example.com:8443/user/admin/twtxt.txt", false},
+		{"https://evil.com/pod.example.com/twtxt.txt", false},
+	}
+
+	for _, testCase := range testCases {
+		uri, err := url.Parse(testCase.uri)
+		require.NoError(t, err)
+		assert.Equal(t, testCase.expected, IsPodURL(conf, uri), testCase.uri)
+	}
+}
+
+func TestRequestHTTPPodToken(t *testing.T) {
+	var tokens []string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		tokens = append(tokens, r.Header.Get(podTokenHeader))
+	}
+
+	other := httptest.NewServer(http.HandlerFunc(record))
+	defer other.Close()
+
+	pod := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		record(w, r)
+		if r.URL.Path == "/redirect" {
+			http.Redirect(w, r, other.URL+"/twtxt.txt", http.StatusFound)
+		}
+	}))
+	defer pod.Close()
+
+	baseURL, err := url.Parse(pod.URL)
+	require.NoError(t, err)
+	conf := &Config{
+		BaseURL:              baseURL.String(),
+		baseURL:              baseURL,
+		APISigningKey:        "secret",
+		MaxFetchRedirects:    3,
+		requestTimeout:       time.Second,
+		fetchAllowedNetworks: mustParseCIDRs("127.0.0.0/8"),
+	}
+
+	// The Pod's own feeds are fetched with the token ...
+	res, err := RequestHTTP(conf, http.MethodGet, pod.URL+"/user/admin/twtxt.txt", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	// ... other hosts never see it, even when set by the caller ...
+	headers := make(http.Header)
+	headers.Set(podTokenHeader, PodToken(conf))
+	res, err = RequestHTTP(conf, http.MethodGet, other.URL+"/twtxt.txt", headers)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	// ... nor when the Pod redirects to them
+	res, err = RequestHTTP(conf, http.MethodGet, pod.URL+"/redirect", nil)
+	require.NoError(t, err)
+	res.Body.Close()
+
+	assert.Equal(t, []string{PodToken(conf), "", PodToken(conf), ""}, tokens)
+}
+
+// newLocalOnlyTestServer returns a server whose cache holds a public and a
+// local-only twt tagged #yarn that both reply to a public root twt
+func newLocalOnlyTestServer(t *testing.T) (s *Server, root, public, local types.Twt) {
+	s = newTestHandlerServer(t)
+
+	tv, err := NewTwtVisibility(s.config())
+	require.NoError(t, err)
+
+	oldVisibility := visibility
+	t.Cleanup(func() { visibility = oldVisibility })
+	visibility = tv
+
+	feed := s.config().URLForUser("alice")
+	twter := types.NewTwter("alice", feed)
+
+	now := time.Now()
+	root = types.MakeTwt(twter, now.Add(-time.Hour), "Hello World!")
+	public = types.MakeTwt(twter, now.Add(-time.Minute), fmt.Sprintf("(#%s) Hello #yarn", root.Hash()))
+	local = types.MakeTwt(twter, now, fmt.Sprintf("(#%s) Hello Pod #yarn", root.Hash()))
+	require.NoError(t, tv.Set(local.Hash(), feed, VisibilityLocal))
+
+	s.cache.UpdateFeed(feed, "", types.Twts{local, public, root})
+	s.cache.Refresh()
+
+	return s, root, public, local
+}
+
+func TestTagAtomHandlerLocalOnly(t *testing.T) {
+	s, _, public, local := newLocalOnlyTestServer(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/tag/yarn/atom.xml", nil)
+	w := httptest.NewRecorder()
+	s.TagAtomHandler()(w, r, httprouter.Params{{Key: "tag", Value: "yarn"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), public.Hash())
+	assert.NotContains(t, w.Body.String(), local.Hash())
+}
+
+func TestConversationAtomHandlerLocalOnly(t *testing.T) {
+	s, root, public, local := newLocalOnlyTestServer(t)
+
+	r := httptest.NewRequest(http.MethodGet, "/conv/"+root.Hash()+"/atom.xml", nil)
+	w := httptest.NewRecorder()
+	s.ConversationAtomHandler()(w, r, httprouter.Params{{Key: "hash", Value: root.Hash()}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), public.Hash())
+	assert.NotContains(t, w.Body.String(), local.Hash())
+}
+
+func TestPublicAPILocalOnly(t *testing.T) {
+	s, _, _, _ := newLocalOnlyTestServer(t)
+	api := &API{config: s.config, cache: s.cache}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/v1/public/tag/yarn", nil)
+	w := httptest.NewRecorder()
+	api.PublicTagEndpoint()(w, r, httprouter.Params{{Key: "tag", Value: "yarn"}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Hello #yarn")
+	assert.NotContains(t, w.Body.String(), "Hello Pod")
+}
+
+func TestNNTPArticlesLocalOnly(t *testing.T) {
+	s, _, public, local := newLocalOnlyTestServer(t)
+	n := NewNNTPServer(s.config(), s.cache)
+
+	articles, ok := n.articles(nntpLocalGroup)
+	require.True(t, ok)
+
+	var hashes []string
+	for _, article := range articles {
+		hashes = append(hashes, article.Twt.Hash())
+	}
+	assert.Contains(t, hashes, public.Hash())
+	assert.NotContains(t, hashes, local.Hash())
+}
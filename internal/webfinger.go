@@ -0,0 +1,276 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+const (
+	// handleCacheTTL is how long resolved (or unresolvable) handles are cached
+	handleCacheTTL = time.Hour
+
+	// maxWebFingerSize is the maximum size of WebFinger responses
+	maxWebFingerSize = 1 << 16
+)
+
+var (
+	// ErrHandleNotResolved is returned when a nick@domain handle cannot be
+	// resolved to a feed
+	ErrHandleNotResolved = errors.New("error: unable to resolve handle to a feed")
+
+	// ErrInvalidPod is returned when the pod given to remote follow a feed
+	// from is not a valid pod url, domain or handle
+	ErrInvalidPod = errors.New("error: invalid pod")
+
+	validHandle = regexp.MustCompile(`^@?([a-zA-Z0-9][a-zA-Z0-9_.-]*)@([a-zA-Z0-9][a-zA-Z0-9.-]*\.[a-zA-Z]{2,}(:[0-9]+)?)$`)
+)
+
+// webFingerJRD is a WebFinger JSON Resource Descriptor (RFC 7033)
+type webFingerJRD struct {
+	Subject string `json:"subject"`
+	Links   []struct {
+		Rel  string `json:"rel"`
+		Type string `json:"type"`
+		Href string `json:"href"`
+	} `json:"links"`
+}
+
+type resolvedHandle struct {
+	url     string
+	err     error
+	expires time.Time
+}
+
+// HandleResolver resolves nick@domain handles to the urls of twtxt feeds and
+// caches the results (See: ResolveHandle)
+type HandleResolver struct {
+	mu    sync.Mutex
+	conf  *Config
+	cache map[string]resolvedHandle
+}
+
+// NewHandleResolver ...
+func NewHandleResolver(conf *Config) *HandleResolver {
+	return &HandleResolver{
+		conf:  conf,
+		cache: make(map[string]resolvedHandle),
+	}
+}
+
+// ParseHandle parses a handle of the form [@]nick@domain
+func ParseHandle(s string) (nick, domain string, ok bool) {
+	match := validHandle.FindStringSubmatch(strings.TrimSpace(s))
+	if match == nil {
+		return "", "", false
+	}
+	return match[1], strings.ToLower(match[2]), true
+}
+
+// Resolve resolves a nick@domain handle to the url of the user's twtxt feed
+// (See: ResolveHandle)
+func (hr *HandleResolver) Resolve(handle string) (nick, uri string, err error) {
+	nick, domain, ok := ParseHandle(handle)
+	if !ok {
+		return "", "", ErrHandleNotResolved
+	}
+	key := fmt.Sprintf("%s@%s", strings.ToLower(nick), domain)
+
+	hr.mu.Lock()
+	if res, ok := hr.cache[key]; ok && time.Now().Before(res.expires) {
+		hr.mu.Unlock()
+		return nick, res.url, res.err
+	}
+	hr.mu.Unlock()
+
+	_, uri, err = ResolveHandle(hr.conf, handle)
+
+	hr.mu.Lock()
+	hr.cache[key] = resolvedHandle{uri, err, time.Now().Add(handleCacheTTL)}
+	for k, res := range hr.cache {
+		if time.Now().After(res.expires) {
+			delete(hr.cache, k)
+		}
+	}
+	hr.mu.Unlock()
+
+	return nick, uri, err
+}
+
+// ResolveHandle resolves a nick@domain handle to the url of the user's twtxt
+// feed. Handles of this pod resolve to local feeds, otherwise the feed is
+// discovered via WebFinger and falls back to the well-known locations of
+// twtxt feeds (that of Yarn.social pods, tilde servers and single user sites).
+// Yarn.social pods advertise the location of their feeds with a yarn-uri meta
+// tag which is used before falling back to the well-known locations.
+func ResolveHandle(conf *Config, handle string) (nick, uri string, err error) {
+	nick, domain, ok := ParseHandle(handle)
+	if !ok {
+		return "", "", ErrHandleNotResolved
+	}
+
+	if conf.baseURL != nil && strings.EqualFold(conf.baseURL.Host, domain) {
+		return nick, URLForUser(conf.BaseURL, NormalizeUsername(nick)), nil
+	}
+
+	if uri := webFinger(conf, nick, domain); uri != "" {
+		return nick, uri, nil
+	}
+
+	if uri := yarnURI(conf, nick, domain); uri != "" {
+		return nick, uri, nil
+	}
+
+	candidates := []string{
+		fmt.Sprintf("https://%s/user/%s/twtxt.txt", domain, NormalizeUsername(nick)),
+		fmt.Sprintf("https://%s/~%s/twtxt.txt", domain, nick),
+		fmt.Sprintf("https://%s/.well-known/twtxt", domain),
+		fmt.Sprintf("https://%s/twtxt.txt", domain),
+	}
+
+	for i, candidate := range candidates {
+		tf, err := ValidateFeed(conf, nick, candidate)
+		if err != nil {
+			continue
+		}
+
+		// Domain-wide feeds must belong to the nick being resolved
+		if i >= 2 {
+			if feedNick := tf.Twter().Nick; feedNick != "" && !strings.EqualFold(feedNick, nick) {
+				continue
+			}
+		}
+
+		return nick, candidate, nil
+	}
+
+	return nick, "", ErrHandleNotResolved
+}
+
+// webFinger looks up the twtxt feed of nick@domain via WebFinger, returning
+// the url of the feed or an empty string if none was found
+func webFinger(conf *Config, nick, domain string) string {
+	uri := fmt.Sprintf(
+		"https://%s/.well-known/webfinger?resource=%s",
+		domain, url.QueryEscape(fmt.Sprintf("acct:%s@%s", nick, domain)),
+	)
+
+	headers := make(http.Header)
+	headers.Set("Accept", "application/jrd+json, application/json")
+
+	res, err := RequestHTTP(conf, http.MethodGet, uri, headers)
+	if err != nil {
+		return ""
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	var jrd webFingerJRD
+	if err := json.NewDecoder(io.LimitReader(res.Body, maxWebFingerSize)).Decode(&jrd); err != nil {
+		return ""
+	}
+
+	for _, link := range jrd.Links {
+		if link.Href == "" {
+			continue
+		}
+		if link.Type == "text/plain" || strings.HasSuffix(link.Href, "/twtxt.txt") {
+			if _, err := ValidateFeed(conf, nick, link.Href); err == nil {
+				return link.Href
+			}
+		}
+	}
+
+	return ""
+}
+
+// yarnURI looks up the twtxt feed of nick@domain from the yarn-uri meta tag of
+// the home page of a Yarn.social pod, returning the url of the feed or an
+// empty string if none was found
+func yarnURI(conf *Config, nick, domain string) string {
+	baseURI, err := url.Parse(fmt.Sprintf("https://%s", domain))
+	if err != nil {
+		return ""
+	}
+
+	res, err := RequestHTTP(conf, http.MethodGet, baseURI.String(), nil)
+	if err != nil {
+		return ""
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return ""
+	}
+
+	doc, err := goquery.NewDocumentFromReader(res.Body)
+	if err != nil {
+		return ""
+	}
+
+	val, ok := doc.Find(`meta[name="yarn-uri"]`).Attr("content")
+	if !ok {
+		return ""
+	}
+
+	uri := val
+	if strings.Contains(val, "%s") {
+		uri = fmt.Sprintf(val, nick)
+	}
+	if u, err := url.Parse(uri); err == nil && !u.IsAbs() {
+		uri = baseURI.ResolveReference(u).String()
+	}
+
+	if !ResourceExists(conf, uri) {
+		return ""
+	}
+
+	return uri
+}
+
+// RemoteFollowURL returns the url of the /follow page of the pod given as a
+// url, domain or nick@domain handle prefilled to follow the feed at uri. This
+// is used by visitors from other pods to follow a feed from their own pod.
+func RemoteFollowURL(pod, nick, uri string) (string, error) {
+	pod = strings.TrimSpace(pod)
+	if _, domain, ok := ParseHandle(pod); ok {
+		pod = domain
+	}
+	if !strings.Contains(pod, "://") {
+		pod = fmt.Sprintf("https://%s", pod)
+	}
+
+	u, err := url.Parse(pod)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", ErrInvalidPod
+	}
+
+	q := url.Values{}
+	q.Set("nick", nick)
+	q.Set("url", uri)
+	q.Set("remote", "1")
+
+	u = &url.URL{
+		Scheme:   u.Scheme,
+		Host:     u.Host,
+		Path:     "/follow",
+		RawQuery: q.Encode(),
+	}
+
+	return u.String(), nil
+}
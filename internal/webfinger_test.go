@@ -0,0 +1,65 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHandle(t *testing.T) {
+	testCases := []struct {
+		handle string
+		nick   string
+		domain string
+		ok     bool
+	}{
+		{"prologic@twtxt.net", "prologic", "twtxt.net", true},
+		{"@prologic@Twtxt.NET", "prologic", "twtxt.net", true},
+		{"james@example.com:8443", "james", "example.com:8443", true},
+		{"prologic", "", "", false},
+		{"https://twtxt.net/user/prologic/twtxt.txt", "", "", false},
+		{"prologic@localhost", "", "", false},
+	}
+
+	for _, testCase := range testCases {
+		nick, domain, ok := ParseHandle(testCase.handle)
+		assert.Equal(t, testCase.ok, ok, testCase.handle)
+		assert.Equal(t, testCase.nick, nick, testCase.handle)
+		assert.Equal(t, testCase.domain, domain, testCase.handle)
+	}
+}
+
+func TestResolveHandle_Local(t *testing.T) {
+	baseURL, err := url.Parse("https://pod.example.com")
+	require.NoError(t, err)
+	conf := &Config{BaseURL: baseURL.String(), baseURL: baseURL}
+
+	nick, uri, err := ResolveHandle(conf, "@Alice@pod.example.com")
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", nick)
+	assert.Equal(t, "https://pod.example.com/user/alice/twtxt.txt", uri)
+
+	_, _, err = ResolveHandle(conf, "not a handle")
+	assert.ErrorIs(t, err, ErrHandleNotResolved)
+}
+
+func TestRemoteFollowURL(t *testing.T) {
+	const feed = "https://pod.example.com/user/alice/twtxt.txt"
+	expected := "https://twtxt.net/follow?nick=alice&remote=1&url=" + url.QueryEscape(feed)
+
+	for _, pod := range []string{"twtxt.net", "https://twtxt.net/", "prologic@twtxt.net", " @prologic@twtxt.net "} {
+		uri, err := RemoteFollowURL(pod, "alice", feed)
+		require.NoError(t, err, pod)
+		assert.Equal(t, expected, uri, pod)
+	}
+
+	for _, pod := range []string{"", "ftp://twtxt.net", "https://"} {
+		_, err := RemoteFollowURL(pod, "alice", feed)
+		assert.ErrorIs(t, err, ErrInvalidPod, pod)
+	}
+}
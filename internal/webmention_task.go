@@ -0,0 +1,113 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+)
+
+// WebMentionTask sends a webmention to a target (an external feed mentioned
+// or a page linked to by a local twt) for the twt's permalink, failed
+// attempts are retried by the dispatcher
+type WebMentionTask struct {
+	*BaseTask
+
+	conf   *Config
+	source string
+	target string
+}
+
+func NewWebMentionTask(conf *Config, source, target string) *WebMentionTask {
+	task := &WebMentionTask{
+		BaseTask: NewBaseTask(),
+
+		conf:   conf,
+		source: source,
+		target: target,
+	}
+	task.SetPriority(TaskPriorityBackground)
+	return task
+}
+
+func (t *WebMentionTask) String() string { return fmt.Sprintf("%T: %s", t, t.ID()) }
+func (t *WebMentionTask) Kind() string   { return "webmention" }
+func (t *WebMentionTask) Args() TaskData {
+	return TaskData{"source": t.source, "target": t.target}
+}
+func (t *WebMentionTask) Run() error {
+	defer t.Done()
+	t.SetState(TaskStateRunning)
+
+	if webmentions == nil {
+		return t.Fail(errors.New("error: webmentions not setup"))
+	}
+
+	source, err := url.Parse(t.source)
+	if err != nil {
+		return t.Fail(err)
+	}
+	target, err := url.Parse(t.target)
+	if err != nil {
+		return t.Fail(err)
+	}
+
+	log.Debugf("sending webmention to %s for %s", t.target, t.source)
+	if err := webmentions.Send(source, target); err != nil {
+		log.WithError(err).Warnf("error sending webmention to %s", t.target)
+		return t.Fail(err)
+	}
+
+	return nil
+}
+
+// WebMentionTargets returns the external feeds mentioned and the external
+// pages linked to by a twt that are sent webmentions
+func WebMentionTargets(conf *Config, twt types.Twt) []string {
+	var targets []string
+
+	seen := make(map[string]bool)
+	add := func(target string) {
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			return
+		}
+		if conf.IsLocalURL(target) || seen[target] {
+			return
+		}
+		seen[target] = true
+		targets = append(targets, target)
+	}
+
+	for _, m := range twt.Mentions() {
+		add(m.Twter().URI)
+	}
+	for _, link := range twt.Links() {
+		add(link.Target())
+	}
+
+	return targets
+}
+
+// SendWebMentions dispatches a WebMentionTask for each of the targets of a
+// local twt (See: WebMentionTargets), twts that anonymous visitors cannot see
+// and local-only twts are never mentioned elsewhere
+func SendWebMentions(conf *Config, tasks *Dispatcher, twt types.Twt) {
+	if !visibility.CanView(conf, nil, twt) || visibility.Get(twt.Hash()) == VisibilityLocal {
+		return
+	}
+
+	source := URLForTwt(conf.BaseURL, twt.Hash())
+
+	for _, target := range WebMentionTargets(conf, twt) {
+		log.Debugf("queueing outgoing webmention for %s", target)
+		if _, err := tasks.Dispatch(NewWebMentionTask(conf, source, target)); err != nil {
+			log.WithError(err).Warnf("error submitting task for webmention to %s", target)
+		}
+	}
+}
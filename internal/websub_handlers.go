@@ -6,9 +6,13 @@ import (
 	"github.com/julienschmidt/httprouter"
 )
 
+// maxNotificationSize is the maximum size of WebSub notifications which
+// may include the new twts of the subscribed feed (fat pings)
+const maxNotificationSize = 1 << 16
+
 // WebSubHandler ...
 func (s *Server) WebSubHandler() httprouter.Handle {
-	isAdminUser := IsAdminUserFactory(s.config)
+	isAdminUser := IsAdminUserFactory(s.config())
 
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
 		r.Body = http.MaxBytesReader(w, r.Body, 1024)
@@ -40,7 +44,7 @@ func (s *Server) WebSubHandler() httprouter.Handle {
 // NotifyHandler ...
 func (s *Server) NotifyHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) {
-		r.Body = http.MaxBytesReader(w, r.Body, 1024)
+		r.Body = http.MaxBytesReader(w, r.Body, maxNotificationSize)
 		defer r.Body.Close()
 		websub.NotifyEndpoint(w, r)
 	}
@@ -68,7 +68,7 @@ func (s *Server) WhoFollowsHandler() httprouter.Handle {
 		)
 
 		for _, user := range users {
-			userURL := URLForUser(s.config.BaseURL, user.Username)
+			userURL := URLForUser(s.config().BaseURL, user.Username)
 
 			if !user.IsFollowingPubliclyVisible && !ctx.User.Is(userURL) {
 				continue
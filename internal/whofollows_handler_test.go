@@ -40,11 +40,11 @@ func TestWhoFollowsResource(t *testing.T) {
 
 	router := NewRouter()
 	server := &Server{
-		config: cfg,
 		router: router,
 		server: &http.Server{Addr: bind, Handler: router},
 		db:     db,
 	}
+	server.liveConfig.Store(cfg)
 	router.GET("/whoFollows", server.WhoFollowsHandler())
 	defer func() {
 		assert.NoError(t, server.server.Shutdown(context.Background()), "shutting down server failed")
@@ -35,7 +35,11 @@ func (w *Worker) Start() {
 			select {
 			case task := <-w.taskChannel:
 				if err := task.Run(); err != nil {
-					log.WithError(err).Errorf("error running task %s", task)
+					logger := log.WithField("task", task.ID())
+					if rt, ok := task.(interface{ RequestID() string }); ok && rt.RequestID() != "" {
+						logger = logger.WithField("request_id", rt.RequestID())
+					}
+					logger.WithError(err).Errorf("error running task %s", task)
 				}
 			case <-w.quit:
 				return
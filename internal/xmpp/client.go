@@ -0,0 +1,397 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package xmpp implements a minimal XMPP client (RFC 6120) sufficient for
+// sending and receiving chat messages. It supports STARTTLS, SASL PLAIN
+// authentication and resource binding.
+package xmpp
+
+import (
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+)
+
+const (
+	nsStream  = "http://etherx.jabber.org/streams"
+	nsTLS     = "urn:ietf:params:xml:ns:xmpp-tls"
+	nsSASL    = "urn:ietf:params:xml:ns:xmpp-sasl"
+	nsBind    = "urn:ietf:params:xml:ns:xmpp-bind"
+	nsClient  = "jabber:client"
+	nsStanzas = "urn:ietf:params:xml:ns:xmpp-stanzas"
+
+	defaultPort     = "5222"
+	defaultResource = "yarnd"
+	dialTimeout     = 30 * time.Second
+)
+
+var (
+	// ErrAuthFailed is returned when the server rejects the credentials
+	ErrAuthFailed = errors.New("error: xmpp authentication failed")
+
+	// ErrNoTLS is returned when the server does not offer STARTTLS
+	ErrNoTLS = errors.New("error: xmpp server does not support starttls")
+
+	// ErrNoPlainAuth is returned when the server does not offer SASL PLAIN
+	ErrNoPlainAuth = errors.New("error: xmpp server does not support plain authentication")
+)
+
+// Options ...
+type Options struct {
+	// JID is the bare JID (user@domain) to authenticate as
+	JID string
+
+	// Password is the password of the JID
+	Password string
+
+	// Server is an optional host:port to connect to. If blank the server is
+	// discovered via DNS SRV records of the JID's domain.
+	Server string
+
+	// Resource is the resource to bind (defaults to yarnd)
+	Resource string
+}
+
+// Message is a received chat message
+type Message struct {
+	From string
+	To   string
+	Type string
+	Body string
+}
+
+// Client is a connected and authenticated XMPP client
+type Client struct {
+	mu sync.Mutex
+
+	conn net.Conn
+	dec  *xml.Decoder
+	jid  string
+}
+
+type streamFeatures struct {
+	XMLName    xml.Name  `xml:"http://etherx.jabber.org/streams features"`
+	StartTLS   *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-tls starttls"`
+	Mechanisms struct {
+		Mechanism []string `xml:"mechanism"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-sasl mechanisms"`
+	Bind *struct{} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+}
+
+type bindResult struct {
+	XMLName xml.Name `xml:"jabber:client iq"`
+	Type    string   `xml:"type,attr"`
+	Bind    struct {
+		JID string `xml:"jid"`
+	} `xml:"urn:ietf:params:xml:ns:xmpp-bind bind"`
+}
+
+type clientMessage struct {
+	XMLName xml.Name `xml:"jabber:client message"`
+	From    string   `xml:"from,attr"`
+	To      string   `xml:"to,attr"`
+	Type    string   `xml:"type,attr"`
+	Body    string   `xml:"body"`
+}
+
+type clientIQ struct {
+	XMLName xml.Name  `xml:"jabber:client iq"`
+	ID      string    `xml:"id,attr"`
+	From    string    `xml:"from,attr"`
+	Type    string    `xml:"type,attr"`
+	Ping    *struct{} `xml:"urn:xmpp:ping ping"`
+}
+
+// SplitJID splits a JID into its local, domain and resource parts
+func SplitJID(jid string) (local, domain, resource string) {
+	if i := strings.Index(jid, "/"); i >= 0 {
+		jid, resource = jid[:i], jid[i+1:]
+	}
+	if i := strings.Index(jid, "@"); i >= 0 {
+		local, domain = jid[:i], jid[i+1:]
+	} else {
+		domain = jid
+	}
+	return
+}
+
+// BareJID returns the bare JID (without resource) of a JID
+func BareJID(jid string) string {
+	local, domain, _ := SplitJID(jid)
+	if local == "" {
+		return domain
+	}
+	return fmt.Sprintf("%s@%s", local, domain)
+}
+
+func escape(s string) string {
+	var sb strings.Builder
+	_ = xml.EscapeText(&sb, []byte(s))
+	return sb.String()
+}
+
+func serverAddr(opts Options, domain string) string {
+	if opts.Server != "" {
+		return opts.Server
+	}
+
+	if _, addrs, err := net.LookupSRV("xmpp-client", "tcp", domain); err == nil && len(addrs) > 0 {
+		return net.JoinHostPort(strings.TrimSuffix(addrs[0].Target, "."), fmt.Sprintf("%d", addrs[0].Port))
+	}
+
+	return net.JoinHostPort(domain, defaultPort)
+}
+
+// Dial connects to the XMPP server of the JID, negotiates TLS, authenticates
+// and binds a resource.
+func Dial(opts Options) (*Client, error) {
+	local, domain, _ := SplitJID(opts.JID)
+	if local == "" || domain == "" {
+		return nil, fmt.Errorf("error: invalid jid %q", opts.JID)
+	}
+
+	resource := opts.Resource
+	if resource == "" {
+		resource = defaultResource
+	}
+
+	conn, err := net.DialTimeout("tcp", serverAddr(opts, domain), dialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{conn: conn}
+
+	if err := c.negotiate(opts, local, domain, resource); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *Client) negotiate(opts Options, local, domain, resource string) error {
+	features, err := c.openStream(domain)
+	if err != nil {
+		return err
+	}
+
+	// STARTTLS (mandatory, we never send credentials in the clear)
+	if features.StartTLS == nil {
+		return ErrNoTLS
+	}
+	if err := c.write("<starttls xmlns='%s'/>", nsTLS); err != nil {
+		return err
+	}
+	se, err := c.nextStart()
+	if err != nil {
+		return err
+	}
+	if se.Name.Local != "proceed" {
+		return ErrNoTLS
+	}
+	if err := c.dec.Skip(); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(c.conn, &tls.Config{ServerName: domain})
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = tlsConn
+
+	if features, err = c.openStream(domain); err != nil {
+		return err
+	}
+
+	// SASL PLAIN
+	hasPlain := false
+	for _, mechanism := range features.Mechanisms.Mechanism {
+		if mechanism == "PLAIN" {
+			hasPlain = true
+			break
+		}
+	}
+	if !hasPlain {
+		return ErrNoPlainAuth
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte("\x00" + local + "\x00" + opts.Password))
+	if err := c.write("<auth xmlns='%s' mechanism='PLAIN'>%s</auth>", nsSASL, auth); err != nil {
+		return err
+	}
+	if se, err = c.nextStart(); err != nil {
+		return err
+	}
+	if err := c.dec.Skip(); err != nil {
+		return err
+	}
+	if se.Name.Local != "success" {
+		return ErrAuthFailed
+	}
+
+	if features, err = c.openStream(domain); err != nil {
+		return err
+	}
+
+	// Resource Binding
+	if features.Bind == nil {
+		return errors.New("error: xmpp server does not support resource binding")
+	}
+	if err := c.write(
+		"<iq type='set' id='bind_1'><bind xmlns='%s'><resource>%s</resource></bind></iq>",
+		nsBind, escape(resource),
+	); err != nil {
+		return err
+	}
+	if se, err = c.nextStart(); err != nil {
+		return err
+	}
+	var res bindResult
+	if err := c.dec.DecodeElement(&res, &se); err != nil {
+		return err
+	}
+	if res.Type != "result" {
+		return errors.New("error: xmpp resource binding failed")
+	}
+	c.jid = res.Bind.JID
+
+	// Initial presence so we receive messages
+	return c.write("<presence/>")
+}
+
+func (c *Client) openStream(domain string) (*streamFeatures, error) {
+	if err := c.write(
+		"<?xml version='1.0'?><stream:stream to='%s' xmlns='%s' xmlns:stream='%s' version='1.0'>",
+		escape(domain), nsClient, nsStream,
+	); err != nil {
+		return nil, err
+	}
+
+	c.dec = xml.NewDecoder(c.conn)
+
+	se, err := c.nextStart()
+	if err != nil {
+		return nil, err
+	}
+	if se.Name.Space != nsStream || se.Name.Local != "stream" {
+		return nil, fmt.Errorf("error: unexpected xmpp element <%s>", se.Name.Local)
+	}
+
+	if se, err = c.nextStart(); err != nil {
+		return nil, err
+	}
+
+	features := &streamFeatures{}
+	if err := c.dec.DecodeElement(features, &se); err != nil {
+		return nil, err
+	}
+
+	return features, nil
+}
+
+func (c *Client) nextStart() (xml.StartElement, error) {
+	for {
+		t, err := c.dec.Token()
+		if err != nil {
+			return xml.StartElement{}, err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			return t, nil
+		case xml.EndElement:
+			if t.Name.Space == nsStream && t.Name.Local == "stream" {
+				return xml.StartElement{}, io.EOF
+			}
+		}
+	}
+}
+
+func (c *Client) write(format string, args ...interface{}) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	_ = c.conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err := fmt.Fprintf(c.conn, format, args...)
+	return err
+}
+
+// JID returns the full JID bound to the client
+func (c *Client) JID() string {
+	return c.jid
+}
+
+// Send sends a chat message to the given JID
+func (c *Client) Send(to, body string) error {
+	return c.write(
+		"<message to='%s' type='chat'><body>%s</body></message>",
+		escape(to), escape(body),
+	)
+}
+
+// Ping sends a whitespace keepalive to the server
+func (c *Client) Ping() error {
+	return c.write(" ")
+}
+
+// Recv blocks until the next chat message with a body is received. Server
+// pings (XEP-0199) are answered transparently.
+func (c *Client) Recv() (Message, error) {
+	for {
+		se, err := c.nextStart()
+		if err != nil {
+			return Message{}, err
+		}
+
+		switch se.Name.Local {
+		case "message":
+			var msg clientMessage
+			if err := c.dec.DecodeElement(&msg, &se); err != nil {
+				return Message{}, err
+			}
+			if msg.Type == "error" || strings.TrimSpace(msg.Body) == "" {
+				continue
+			}
+			return Message{From: msg.From, To: msg.To, Type: msg.Type, Body: msg.Body}, nil
+		case "iq":
+			var iq clientIQ
+			if err := c.dec.DecodeElement(&iq, &se); err != nil {
+				return Message{}, err
+			}
+			if iq.Type != "get" && iq.Type != "set" {
+				continue
+			}
+			if iq.Ping != nil {
+				err = c.write("<iq type='result' id='%s' to='%s'/>", escape(iq.ID), escape(iq.From))
+			} else {
+				err = c.write(
+					"<iq type='error' id='%s' to='%s'><error type='cancel'><service-unavailable xmlns='%s'/></error></iq>",
+					escape(iq.ID), escape(iq.From), nsStanzas,
+				)
+			}
+			if err != nil {
+				return Message{}, err
+			}
+		case "error":
+			return Message{}, errors.New("error: xmpp stream error")
+		default:
+			if err := c.dec.Skip(); err != nil {
+				return Message{}, err
+			}
+		}
+	}
+}
+
+// Close ends the stream and closes the connection
+func (c *Client) Close() error {
+	_ = c.write("</stream:stream>")
+	return c.conn.Close()
+}
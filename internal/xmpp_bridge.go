@@ -0,0 +1,420 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	sync "github.com/sasha-s/go-deadlock"
+	log "github.com/sirupsen/logrus"
+	"go.yarn.social/types"
+
+	"git.mills.io/yarnsocial/yarn/internal/xmpp"
+)
+
+const (
+	xmppStateFile         = "xmpp.json"
+	xmppNotifyInterval    = time.Minute
+	xmppKeepaliveInterval = 5 * time.Minute
+	xmppMinBackoff        = time.Second
+	xmppMaxBackoff        = 5 * time.Minute
+)
+
+// xmppUserState tracks what a user has already been notified about
+type xmppUserState struct {
+	MentionsAt time.Time `json:"mentions_at"`
+	Followers  []string  `json:"followers"`
+}
+
+// XMPPBridge is a background subsystem that sends mention and follower
+// notifications to users' configured JIDs and (optionally) posts replies
+// received over XMPP as new twts.
+type XMPPBridge struct {
+	sync.RWMutex
+
+	conf      *Config
+	cache     *Cache
+	db        Store
+	tasks     *Dispatcher
+	appendTwt AppendTwtFunc
+
+	client *xmpp.Client
+
+	// state is keyed by username and persisted in the data directory
+	state map[string]*xmppUserState
+
+	// lastTwt is the hash of the last twt a JID was notified about and is
+	// used as the subject of replies
+	lastTwt map[string]string
+
+	stop chan struct{}
+}
+
+// NewXMPPBridge ...
+func NewXMPPBridge(conf *Config, cache *Cache, db Store, tasks *Dispatcher, appendTwt AppendTwtFunc) *XMPPBridge {
+	return &XMPPBridge{
+		conf:      conf,
+		cache:     cache,
+		db:        db,
+		tasks:     tasks,
+		appendTwt: appendTwt,
+		state:     make(map[string]*xmppUserState),
+		lastTwt:   make(map[string]string),
+		stop:      make(chan struct{}),
+	}
+}
+
+func (b *XMPPBridge) stateFile() string {
+	return filepath.Join(b.conf.Data, xmppStateFile)
+}
+
+// Load loads the notification state from disk
+func (b *XMPPBridge) Load() error {
+	data, err := ioutil.ReadFile(b.stateFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	return json.Unmarshal(data, &b.state)
+}
+
+// Save persists the notification state to disk
+func (b *XMPPBridge) Save() error {
+	b.RLock()
+	data, err := json.Marshal(b.state)
+	b.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(b.stateFile(), data, 0644)
+}
+
+// Start runs the bridge in the background, (re)connecting as needed
+func (b *XMPPBridge) Start() {
+	if err := b.Load(); err != nil {
+		log.WithError(err).Warn("error loading xmpp bridge state")
+	}
+
+	go b.run()
+}
+
+// Stop disconnects the bridge and saves its state
+func (b *XMPPBridge) Stop() {
+	close(b.stop)
+
+	b.Lock()
+	if b.client != nil {
+		b.client.Close()
+		b.client = nil
+	}
+	b.Unlock()
+
+	if err := b.Save(); err != nil {
+		log.WithError(err).Warn("error saving xmpp bridge state")
+	}
+}
+
+func (b *XMPPBridge) connect() (*xmpp.Client, error) {
+	return xmpp.Dial(xmpp.Options{
+		JID:      b.conf.XMPPJID,
+		Password: b.conf.XMPPPassword,
+		Server:   b.conf.XMPPServer,
+	})
+}
+
+func (b *XMPPBridge) run() {
+	backoff := xmppMinBackoff
+
+	for {
+		client, err := b.connect()
+		if err != nil {
+			log.WithError(err).Warnf("error connecting to xmpp server, retrying in %s", backoff)
+			select {
+			case <-b.stop:
+				return
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+			if backoff > xmppMaxBackoff {
+				backoff = xmppMaxBackoff
+			}
+			continue
+		}
+
+		log.Infof("xmpp bridge connected as %s", client.JID())
+		backoff = xmppMinBackoff
+
+		b.Lock()
+		b.client = client
+		b.Unlock()
+
+		if stopped := b.serve(client); stopped {
+			return
+		}
+
+		b.Lock()
+		b.client = nil
+		b.Unlock()
+		client.Close()
+
+		log.Warn("xmpp bridge disconnected, reconnecting ...")
+	}
+}
+
+// serve handles a single connection until it fails or the bridge is stopped
+func (b *XMPPBridge) serve(client *xmpp.Client) (stopped bool) {
+	errs := make(chan error, 1)
+
+	go func() {
+		for {
+			msg, err := client.Recv()
+			if err != nil {
+				errs <- err
+				return
+			}
+			b.handleMessage(client, msg)
+		}
+	}()
+
+	notify := time.NewTicker(xmppNotifyInterval)
+	defer notify.Stop()
+
+	keepalive := time.NewTicker(xmppKeepaliveInterval)
+	defer keepalive.Stop()
+
+	b.notify(client)
+
+	for {
+		select {
+		case <-b.stop:
+			return true
+		case err := <-errs:
+			log.WithError(err).Warn("error reading from xmpp server")
+			return false
+		case <-notify.C:
+			b.notify(client)
+		case <-keepalive.C:
+			if err := client.Ping(); err != nil {
+				log.WithError(err).Warn("error sending xmpp keepalive")
+				return false
+			}
+		}
+	}
+}
+
+func (b *XMPPBridge) send(client *xmpp.Client, user *User, twt types.Twt, body string) error {
+	jid := xmpp.BareJID(user.XMPPJID)
+
+	if err := client.Send(jid, body); err != nil {
+		return err
+	}
+
+	if twt != nil && !twt.IsZero() {
+		b.Lock()
+		b.lastTwt[jid] = twt.Hash()
+		b.Unlock()
+	}
+
+	return nil
+}
+
+// notify sends any pending mention and follower notifications
+func (b *XMPPBridge) notify(client *xmpp.Client) {
+	users, err := b.db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Error("error loading users for xmpp notifications")
+		return
+	}
+
+	changed := false
+
+	for _, user := range users {
+		if user.XMPPJID == "" || !user.XMPPVerified {
+			continue
+		}
+
+		profile := user.Profile(b.conf.BaseURL, user)
+		followers := b.cache.GetFollowers(profile)
+		mentions := b.cache.GetMentions(user, false)
+
+		b.Lock()
+		state, ok := b.state[user.Username]
+		if !ok {
+			// Don't flood newly configured users with their backlog
+			state = &xmppUserState{MentionsAt: time.Now()}
+			for _, follower := range followers {
+				state.Followers = append(state.Followers, follower.URI)
+			}
+			b.state[user.Username] = state
+			changed = true
+		}
+		b.Unlock()
+		if !ok {
+			continue
+		}
+
+		if user.XMPPNotifyMentions {
+			var pending types.Twts
+			for _, twt := range mentions {
+				if twt.Created().After(state.MentionsAt) {
+					pending = append(pending, twt)
+				}
+			}
+			sort.Slice(pending, func(i, j int) bool {
+				return pending[i].Created().Before(pending[j].Created())
+			})
+
+			for _, twt := range pending {
+				body := fmt.Sprintf(
+					"%s mentioned you: %s\n%s",
+					twt.Twter().DomainNick(),
+					twt.FormatText(types.TextFmt, b.conf),
+					URLForTwt(b.conf.BaseURL, twt.Hash()),
+				)
+				if err := b.send(client, user, twt, body); err != nil {
+					log.WithError(err).Warnf("error sending xmpp mention notification to %s", user.Username)
+					break
+				}
+				b.Lock()
+				state.MentionsAt = twt.Created()
+				b.Unlock()
+				changed = true
+			}
+		}
+
+		b.RLock()
+		known := make(map[string]bool, len(state.Followers))
+		for _, uri := range state.Followers {
+			known[uri] = true
+		}
+		b.RUnlock()
+
+		for _, follower := range followers {
+			if known[follower.URI] {
+				continue
+			}
+			if user.XMPPNotifyFollowers {
+				body := fmt.Sprintf("%s (%s) is now following you", follower.Nick, follower.URI)
+				if err := b.send(client, user, nil, body); err != nil {
+					log.WithError(err).Warnf("error sending xmpp follower notification to %s", user.Username)
+					break
+				}
+			}
+			b.Lock()
+			state.Followers = append(state.Followers, follower.URI)
+			b.Unlock()
+			changed = true
+		}
+	}
+
+	if changed {
+		if err := b.Save(); err != nil {
+			log.WithError(err).Warn("error saving xmpp bridge state")
+		}
+	}
+}
+
+// NewXMPPVerifyCode returns a new code a user confirms to prove they own
+// their JID
+func NewXMPPVerifyCode() string {
+	return GenerateRandomToken()[:8]
+}
+
+// CheckXMPPVerifyCode returns true if code is the user's pending code
+func CheckXMPPVerifyCode(user *User, code string) bool {
+	code = strings.ToLower(strings.TrimSpace(code))
+	if user.XMPPVerifyCode == "" || code == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(code), []byte(user.XMPPVerifyCode)) == 1
+}
+
+// SendVerifyCode sends the code a user confirms in their settings to the
+// JID they configured
+func (b *XMPPBridge) SendVerifyCode(user *User) error {
+	b.RLock()
+	client := b.client
+	b.RUnlock()
+
+	if client == nil {
+		return fmt.Errorf("xmpp bridge not connected")
+	}
+
+	body := fmt.Sprintf(
+		"Your confirmation code for %s on %s is: %s\nIf you did not request it you can ignore this message.",
+		user.Username, b.conf.Name, user.XMPPVerifyCode,
+	)
+	return client.Send(xmpp.BareJID(user.XMPPJID), body)
+}
+
+// verifiedXMPPUser returns the user with the verified JID or nil
+func verifiedXMPPUser(users []*User, jid string) *User {
+	for _, u := range users {
+		if u.XMPPJID != "" && u.XMPPVerified && strings.EqualFold(xmpp.BareJID(u.XMPPJID), jid) {
+			return u
+		}
+	}
+	return nil
+}
+
+// handleMessage posts a message received from a user's JID as a new twt
+// replying to the last twt they were notified about
+func (b *XMPPBridge) handleMessage(client *xmpp.Client, msg xmpp.Message) {
+	from := xmpp.BareJID(msg.From)
+
+	users, err := b.db.GetAllUsers()
+	if err != nil {
+		log.WithError(err).Error("error loading users for xmpp message")
+		return
+	}
+
+	user := verifiedXMPPUser(users, from)
+	if user == nil || !user.XMPPAcceptReplies || !user.IsActive() {
+		log.Debugf("ignoring xmpp message from unknown or disabled jid %s", from)
+		return
+	}
+
+	text := CleanTwt(msg.Body)
+	if text == "" {
+		return
+	}
+
+	b.RLock()
+	hash := b.lastTwt[from]
+	b.RUnlock()
+
+	if hash != "" && !strings.HasPrefix(text, "(#") {
+		text = fmt.Sprintf("(#%s) %s", hash, text)
+	}
+
+	twt, err := b.appendTwt(user, nil, text)
+	if err != nil {
+		log.WithError(err).Errorf("error posting twt from xmpp for %s", user.Username)
+		_ = client.Send(from, "Error posting twt")
+		return
+	}
+
+	feedURL := b.conf.URLForUser(user.Username)
+	PublishTwts(b.conf, b.tasks, user, feedURL, "", twt)
+
+	b.cache.InjectFeed(feedURL, twt)
+	b.cache.DeleteUserViews(user)
+
+	_ = client.Send(from, fmt.Sprintf("Posted %s", URLForTwt(b.conf.BaseURL, twt.Hash())))
+}
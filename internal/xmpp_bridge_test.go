@@ -0,0 +1,34 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package internal
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifiedXMPPUser(t *testing.T) {
+	// Anyone can claim a JID but only a verified claim is matched
+	mallory := &User{Username: "mallory", XMPPJID: "alice@example.com"}
+	alice := &User{Username: "alice", XMPPJID: "Alice@example.com/phone", XMPPVerified: true}
+
+	assert.Nil(t, verifiedXMPPUser([]*User{mallory}, "alice@example.com"))
+	assert.Equal(t, alice, verifiedXMPPUser([]*User{mallory, alice}, "alice@example.com"))
+	assert.Nil(t, verifiedXMPPUser([]*User{mallory, alice}, "bob@example.com"))
+}
+
+func TestCheckXMPPVerifyCode(t *testing.T) {
+	user := &User{XMPPJID: "alice@example.com", XMPPVerifyCode: NewXMPPVerifyCode()}
+
+	assert.True(t, CheckXMPPVerifyCode(user, user.XMPPVerifyCode))
+	assert.True(t, CheckXMPPVerifyCode(user, " "+strings.ToUpper(user.XMPPVerifyCode)+" "))
+	assert.False(t, CheckXMPPVerifyCode(user, "00000000"))
+	assert.False(t, CheckXMPPVerifyCode(user, ""))
+
+	// No code is pending once the JID is verified
+	user.XMPPVerifyCode = ""
+	assert.False(t, CheckXMPPVerifyCode(user, ""))
+}
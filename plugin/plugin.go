@@ -0,0 +1,103 @@
+// Copyright 2020-present Yarn.social
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package plugin defines the interfaces yarnd plugins implement in order to
+// extend a pod's behaviour without forking yarnd.
+//
+// Plugins are built as Go plugins (`go build -buildmode=plugin`) against the
+// same version of yarnd they are loaded into and must export a symbol named
+// `Plugin` whose value implements the Plugin interface and optionally one or
+// more of the hook interfaces below. For example:
+//
+//	package main
+//
+//	import (
+//		"strings"
+//
+//		"git.mills.io/yarnsocial/yarn/plugin"
+//	)
+//
+//	type shouty struct{}
+//
+//	func (shouty) Name() string { return "shouty" }
+//
+//	func (shouty) OnPost(post *plugin.Post) error {
+//		post.Text = strings.ToUpper(post.Text)
+//		return nil
+//	}
+//
+//	var Plugin shouty
+//
+// Plugins are loaded from the directory given by `yarnd --plugins-dir`.
+package plugin
+
+import (
+	"html/template"
+
+	"go.yarn.social/types"
+)
+
+// Symbol is the name of the symbol looked up in a plugin
+const Symbol = "Plugin"
+
+// Extension points plugins can inject HTML into
+const (
+	// Head is injected at the end of every page's <head>
+	Head = "head"
+
+	// Footer is injected at the end of every page's <footer>
+	Footer = "footer"
+)
+
+// Plugin is implemented by all plugins
+type Plugin interface {
+	// Name returns the name of the plugin
+	Name() string
+}
+
+// Post is a twt about to be posted by a local user
+type Post struct {
+	// Username is the user posting the twt
+	Username string
+
+	// Feed is the name of the feed being posted to (if not the user's own)
+	Feed string
+
+	// Text is the text of the twt and may be modified by plugins
+	Text string
+}
+
+// Account is a newly registered local user
+type Account struct {
+	Username string
+}
+
+// PostHook is implemented by plugins that filter or rewrite twts posted by
+// local users. Returning an error rejects the twt.
+type PostHook interface {
+	OnPost(post *Post) error
+}
+
+// FetchHook is implemented by plugins that filter or rewrite the twts of
+// feeds fetched by the pod. The returned twts replace the fetched twts.
+type FetchHook interface {
+	OnFetch(url string, twts types.Twts) types.Twts
+}
+
+// RegisterHook is implemented by plugins that act on new user
+// registrations. Returning an error is logged but does not prevent the
+// registration.
+type RegisterHook interface {
+	OnRegister(account *Account) error
+}
+
+// TemplateHook is implemented by plugins that extend the pod's templates.
+type TemplateHook interface {
+	// TemplateFuncs returns additional functions made available to all
+	// templates (including the plugin's own templates)
+	TemplateFuncs() template.FuncMap
+
+	// Templates returns template sources keyed by extension point (see Head
+	// and Footer) rendered with the page's context
+	Templates() map[string]string
+}